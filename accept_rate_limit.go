@@ -0,0 +1,142 @@
+package water
+
+import (
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+// AcceptRateLimit limits the rate at which incoming connections are
+// accepted from the NetworkListener of a Listener or a Relay, in total and
+// per source IP address, with token buckets. A connection over the limit
+// is closed immediately, before any WASM instance is created for it, which
+// protects a relay from connection floods.
+//
+// An AcceptRateLimit MUST NOT be copied after first use. It is safe for
+// concurrent use.
+type AcceptRateLimit struct {
+	// Rate optionally limits the number of connections accepted per
+	// second, from all sources. Up to Burst connections, or 1 if Burst is
+	// not set, may be accepted at once.
+	Rate  float64
+	Burst int
+
+	// PerIPRate optionally limits the number of connections accepted per
+	// second from each source IP address, allowing up to PerIPBurst, or 1
+	// if PerIPBurst is not set, at once.
+	PerIPRate  float64
+	PerIPBurst int
+
+	mu        sync.Mutex
+	total     tokenBucket
+	perIP     map[netip.Addr]*tokenBucket
+	lastSweep time.Time
+}
+
+// acceptRateLimitSweepInterval is how often the buckets of the source IP
+// addresses which have been idle for long enough to be refilled are
+// removed, bounding the memory used to the recently active addresses.
+const acceptRateLimitSweepInterval = time.Minute
+
+// Allow reports whether a connection from remoteAddr is within the limits,
+// consuming a token from each bucket concerned if so.
+func (l *AcceptRateLimit) Allow(remoteAddr net.Addr) bool {
+	if l == nil {
+		return true
+	}
+
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// checked first so that a single flooding source does not drain the
+	// bucket shared by all sources
+	if l.PerIPRate > 0 {
+		if addr, ok := remoteIP(remoteAddr); ok {
+			if l.perIP == nil {
+				l.perIP = make(map[netip.Addr]*tokenBucket)
+			}
+			l.sweep(now)
+
+			bucket, ok := l.perIP[addr]
+			if !ok {
+				bucket = &tokenBucket{}
+				l.perIP[addr] = bucket
+			}
+			if !bucket.take(now, l.PerIPRate, l.PerIPBurst) {
+				return false
+			}
+		}
+	}
+
+	if l.Rate > 0 && !l.total.take(now, l.Rate, l.Burst) {
+		return false
+	}
+
+	return true
+}
+
+// sweep removes the buckets which would be full by now, as if they had
+// never been created.
+func (l *AcceptRateLimit) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < acceptRateLimitSweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	for addr, bucket := range l.perIP {
+		if bucket.full(now, l.PerIPRate) {
+			delete(l.perIP, addr)
+		}
+	}
+}
+
+// remoteIP returns the IP address of remoteAddr, if any.
+func remoteIP(remoteAddr net.Addr) (netip.Addr, bool) {
+	if remoteAddr == nil {
+		return netip.Addr{}, false
+	}
+
+	if tcpAddr, ok := remoteAddr.(*net.TCPAddr); ok {
+		addr, ok := netip.AddrFromSlice(tcpAddr.IP)
+		return addr.Unmap(), ok
+	}
+
+	addrPort, err := netip.ParseAddrPort(remoteAddr.String())
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addrPort.Addr().Unmap(), true
+}
+
+// tokenBucket is a token bucket refilled at a rate per second, holding up
+// to a burst of tokens. The zero value is a full bucket.
+type tokenBucket struct {
+	used float64   // tokens missing from a full bucket
+	last time.Time // when used was last updated
+}
+
+func (b *tokenBucket) refill(now time.Time, rate float64) {
+	if !b.last.IsZero() {
+		b.used = max(b.used-now.Sub(b.last).Seconds()*rate, 0)
+	}
+	b.last = now
+}
+
+// take takes a token from the bucket, if there is any left.
+func (b *tokenBucket) take(now time.Time, rate float64, burst int) bool {
+	b.refill(now, rate)
+	if b.used+1 > float64(max(burst, 1)) {
+		return false
+	}
+	b.used++
+	return true
+}
+
+// full reports whether the bucket is refilled by now.
+func (b *tokenBucket) full(now time.Time, rate float64) bool {
+	b.refill(now, rate)
+	return b.used == 0
+}
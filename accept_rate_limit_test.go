@@ -0,0 +1,115 @@
+package water_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/refraction-networking/water"
+)
+
+func TestAcceptRateLimit(t *testing.T) {
+	a := &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 1234}
+	b := &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 1234}
+
+	t.Run("per IP", func(t *testing.T) {
+		limit := &water.AcceptRateLimit{PerIPRate: 1, PerIPBurst: 2}
+		for i := 0; i < 2; i++ {
+			if !limit.Allow(a) {
+				t.Fatalf("connection %d from %s denied within burst", i, a)
+			}
+		}
+		if limit.Allow(a) {
+			t.Fatalf("connection from %s allowed over burst", a)
+		}
+		if !limit.Allow(b) {
+			t.Fatalf("connection from %s denied by the limit of %s", b, a)
+		}
+	})
+
+	t.Run("total", func(t *testing.T) {
+		limit := &water.AcceptRateLimit{Rate: 50}
+		if !limit.Allow(a) {
+			t.Fatal("first connection denied")
+		}
+		if limit.Allow(b) {
+			t.Fatal("second connection allowed over burst")
+		}
+
+		time.Sleep(40 * time.Millisecond) // refills 2 tokens, capped at 1
+		if !limit.Allow(b) {
+			t.Fatal("connection denied after refill")
+		}
+		if limit.Allow(a) {
+			t.Fatal("connection allowed over burst after refill")
+		}
+	})
+
+	t.Run("flooding source", func(t *testing.T) {
+		// the denied connections from a do not drain the total bucket
+		limit := &water.AcceptRateLimit{Rate: 1, Burst: 2, PerIPRate: 1}
+		for i := 0; i < 10; i++ {
+			limit.Allow(a)
+		}
+		if !limit.Allow(b) {
+			t.Fatalf("connection from %s denied", b)
+		}
+	})
+
+	t.Run("nil", func(t *testing.T) {
+		var limit *water.AcceptRateLimit
+		if !limit.Allow(a) {
+			t.Fatal("nil AcceptRateLimit denied a connection")
+		}
+	})
+}
+
+func TestConfig_AcceptRateLimit(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+
+	config := &water.Config{
+		NetworkListener: lis,
+		AcceptRateLimit: &water.AcceptRateLimit{PerIPRate: 0.001},
+	}
+
+	accepted := make(chan net.Conn, 2)
+	go func() {
+		for {
+			conn, err := config.AcceptNetworkConn()
+			if err != nil {
+				close(accepted)
+				return
+			}
+			accepted <- conn
+		}
+	}()
+
+	for i := 0; i < 2; i++ {
+		conn, err := net.Dial("tcp", lis.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close() // skipcq: GO-S2307
+
+		if i == 0 {
+			c := <-accepted
+			defer c.Close() // skipcq: GO-S2307
+			continue
+		}
+
+		// the second connection is closed by the host without being accepted
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if _, err := conn.Read(make([]byte, 1)); err == nil {
+			t.Fatal("read from a connection over the limit succeeded")
+		}
+		select {
+		case <-accepted:
+			t.Fatal("connection over the limit accepted")
+		default:
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package water
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// AccessLogEntry describes a connection handled by a Relay, from the
+// moment it is accepted until both the inbound connection and the
+// connection to the upstream are closed.
+type AccessLogEntry struct {
+	// Start is the time the inbound connection was handed to the WATM.
+	Start time.Time
+
+	// Duration is the time elapsed from Start until the last of the
+	// connections was closed.
+	Duration time.Duration
+
+	// ClientAddr is the remote address of the inbound connection.
+	ClientAddr net.Addr
+
+	// UpstreamNetwork and UpstreamAddr describe the connection dialed to
+	// the upstream. UpstreamAddr is nil if no connection was established.
+	UpstreamNetwork string
+	UpstreamAddr    net.Addr
+
+	// BytesFromClient and BytesToClient count the bytes read from and
+	// written to the inbound connection.
+	BytesFromClient int64
+	BytesToClient   int64
+
+	// BytesFromUpstream and BytesToUpstream count the bytes read from and
+	// written to the connection to the upstream.
+	BytesFromUpstream int64
+	BytesToUpstream   int64
+
+	// CloseReason tells why the relayed connection ended, e.g., which side
+	// closed it first or the error encountered.
+	CloseReason string
+}
+
+// Close reasons reported in AccessLogEntry.CloseReason, other than the
+// text of an error.
+const (
+	CloseReasonClient     = "client closed"
+	CloseReasonUpstream   = "upstream closed"
+	CloseReasonLocal      = "closed locally"
+	CloseReasonDialFailed = "upstream dial failed"
+)
+
+// AccessLogger records an AccessLogEntry for each connection handled by
+// a Relay. LogAccess is called from the goroutine closing the last of
+// the connections and must be safe for concurrent use.
+type AccessLogger interface {
+	LogAccess(entry *AccessLogEntry)
+}
+
+// AccessLoggerFunc is a func implementing AccessLogger.
+type AccessLoggerFunc func(entry *AccessLogEntry)
+
+// LogAccess implements AccessLogger.
+func (f AccessLoggerFunc) LogAccess(entry *AccessLogEntry) {
+	f(entry)
+}
+
+// NewJSONAccessLogger creates an AccessLogger writing each entry to w as a
+// JSON object on its own line.
+func NewJSONAccessLogger(w io.Writer) AccessLogger {
+	var mu sync.Mutex
+	return AccessLoggerFunc(func(entry *AccessLogEntry) {
+		line, err := json.Marshal(struct {
+			Start             time.Time `json:"start"`
+			DurationMs        int64     `json:"duration_ms"`
+			Client            string    `json:"client"`
+			UpstreamNetwork   string    `json:"upstream_network,omitempty"`
+			Upstream          string    `json:"upstream,omitempty"`
+			BytesFromClient   int64     `json:"bytes_from_client"`
+			BytesToClient     int64     `json:"bytes_to_client"`
+			BytesFromUpstream int64     `json:"bytes_from_upstream"`
+			BytesToUpstream   int64     `json:"bytes_to_upstream"`
+			CloseReason       string    `json:"close_reason"`
+		}{
+			Start:             entry.Start,
+			DurationMs:        entry.Duration.Milliseconds(),
+			Client:            addrString(entry.ClientAddr),
+			UpstreamNetwork:   entry.UpstreamNetwork,
+			Upstream:          addrString(entry.UpstreamAddr),
+			BytesFromClient:   entry.BytesFromClient,
+			BytesToClient:     entry.BytesToClient,
+			BytesFromUpstream: entry.BytesFromUpstream,
+			BytesToUpstream:   entry.BytesToUpstream,
+			CloseReason:       entry.CloseReason,
+		})
+		if err != nil {
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		_, _ = w.Write(append(line, '\n'))
+	})
+}
+
+// NewCLFAccessLogger creates an AccessLogger writing each entry to w in
+// the Common Log Format, with the request line replaced by the upstream
+// relayed to and the size being the bytes sent to the client, e.g.:
+//
+//	192.0.2.1 - - [10/Oct/2000:13:55:36 -0700] "RELAY tcp 198.51.100.1:443" - 2326
+func NewCLFAccessLogger(w io.Writer) AccessLogger {
+	var mu sync.Mutex
+	return AccessLoggerFunc(func(entry *AccessLogEntry) {
+		host := "-"
+		if entry.ClientAddr != nil {
+			host = entry.ClientAddr.String()
+			if h, _, err := net.SplitHostPort(host); err == nil {
+				host = h
+			}
+		}
+
+		line := fmt.Sprintf("%s - - [%s] \"RELAY %s %s\" - %d\n",
+			host,
+			entry.Start.Format("02/Jan/2006:15:04:05 -0700"),
+			entry.UpstreamNetwork,
+			addrString(entry.UpstreamAddr),
+			entry.BytesToClient,
+		)
+
+		mu.Lock()
+		defer mu.Unlock()
+		_, _ = io.WriteString(w, line)
+	})
+}
+
+func addrString(addr net.Addr) string {
+	if addr == nil {
+		return "-"
+	}
+	return addr.String()
+}
+
+// accessLogSession collects the AccessLogEntry of a relayed connection
+// and logs it once all connections tracked are closed.
+type accessLogSession struct {
+	logger AccessLogger
+	open   atomic.Int32
+
+	mu    sync.Mutex
+	entry AccessLogEntry
+
+	client, upstream *accessLogConn
+}
+
+func (s *accessLogSession) setCloseReason(reason string) {
+	s.mu.Lock()
+	if s.entry.CloseReason == "" {
+		s.entry.CloseReason = reason
+	}
+	s.mu.Unlock()
+}
+
+func (s *accessLogSession) closed() {
+	if s.open.Add(-1) != 0 {
+		return
+	}
+
+	s.mu.Lock()
+	entry, upstream := s.entry, s.upstream
+	s.mu.Unlock()
+
+	entry.Duration = time.Since(entry.Start)
+	entry.BytesFromClient, entry.BytesToClient = s.client.read.Load(), s.client.written.Load()
+	if upstream != nil {
+		entry.BytesFromUpstream, entry.BytesToUpstream = upstream.read.Load(), upstream.written.Load()
+	}
+	if entry.CloseReason == "" {
+		entry.CloseReason = CloseReasonLocal
+	}
+
+	s.logger.LogAccess(&entry)
+}
+
+// accessLogConn counts the bytes read from and written to a connection
+// tracked by an accessLogSession.
+type accessLogConn struct {
+	net.Conn
+
+	session *accessLogSession
+	eofMsg  string
+
+	read, written atomic.Int64
+	closeOnce     sync.Once
+}
+
+func (c *accessLogConn) Read(b []byte) (n int, err error) {
+	n, err = c.Conn.Read(b)
+	c.read.Add(int64(n))
+	if err != nil {
+		c.observe(err)
+	}
+	return n, err
+}
+
+func (c *accessLogConn) Write(b []byte) (n int, err error) {
+	n, err = c.Conn.Write(b)
+	c.written.Add(int64(n))
+	if err != nil {
+		c.observe(err)
+	}
+	return n, err
+}
+
+func (c *accessLogConn) observe(err error) {
+	switch {
+	case errors.Is(err, io.EOF):
+		c.session.setCloseReason(c.eofMsg)
+	case errors.Is(err, net.ErrClosed), errors.Is(err, os.ErrDeadlineExceeded):
+	default:
+		c.session.setCloseReason(err.Error())
+	}
+}
+
+func (c *accessLogConn) Close() error {
+	err := c.Conn.Close()
+	c.closeOnce.Do(c.session.closed)
+	return err
+}
+
+// relayConnsFor returns the connection a Relay should hand to the WATM in
+// place of inbound, and the func it uses to dial the upstream for it,
+// which is relayDialerFuncFor(inbound).
+//
+// If AccessLogger is set, both connections are tracked to log an
+// AccessLogEntry once they are closed. The connections are then no longer
+// *net.TCPConn, costing an extra copy of the data relayed.
+func (c *Config) relayConnsFor(inbound net.Conn) (net.Conn, func(network, address string) (net.Conn, error)) {
+	dialerFunc := c.relayDialerFuncFor(inbound)
+	if c.AccessLogger == nil {
+		return inbound, dialerFunc
+	}
+
+	session := &accessLogSession{
+		logger: c.AccessLogger,
+		entry: AccessLogEntry{
+			Start:      time.Now(),
+			ClientAddr: inbound.RemoteAddr(),
+		},
+	}
+	session.client = &accessLogConn{Conn: inbound, session: session, eofMsg: CloseReasonClient}
+	session.open.Store(1)
+
+	return session.client, func(network, address string) (net.Conn, error) {
+		session.mu.Lock()
+		session.entry.UpstreamNetwork = network
+		session.mu.Unlock()
+
+		conn, err := dialerFunc(network, address)
+		if err != nil {
+			session.setCloseReason(fmt.Sprintf("%s: %v", CloseReasonDialFailed, err))
+			return nil, err
+		}
+
+		upstream := &accessLogConn{Conn: conn, session: session, eofMsg: CloseReasonUpstream}
+		session.open.Add(1)
+		session.mu.Lock()
+		session.entry.UpstreamAddr = conn.RemoteAddr()
+		session.upstream = upstream
+		session.mu.Unlock()
+		return upstream, nil
+	}
+}
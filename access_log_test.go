@@ -0,0 +1,61 @@
+package water_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/refraction-networking/water"
+)
+
+var testAccessLogEntry = &water.AccessLogEntry{
+	Start:             time.Date(2000, time.October, 10, 13, 55, 36, 0, time.FixedZone("", -7*60*60)),
+	Duration:          1500 * time.Millisecond,
+	ClientAddr:        &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 56324},
+	UpstreamNetwork:   "tcp",
+	UpstreamAddr:      &net.TCPAddr{IP: net.IPv4(198, 51, 100, 1), Port: 443},
+	BytesFromClient:   100,
+	BytesToClient:     2326,
+	BytesFromUpstream: 2326,
+	BytesToUpstream:   100,
+	CloseReason:       water.CloseReasonUpstream,
+}
+
+func TestNewJSONAccessLogger(t *testing.T) {
+	var buf bytes.Buffer
+	water.NewJSONAccessLogger(&buf).LogAccess(testAccessLogEntry)
+
+	var got map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+
+	for k, want := range map[string]any{
+		"start":               "2000-10-10T13:55:36-07:00",
+		"duration_ms":         1500.0,
+		"client":              "192.0.2.1:56324",
+		"upstream_network":    "tcp",
+		"upstream":            "198.51.100.1:443",
+		"bytes_from_client":   100.0,
+		"bytes_to_client":     2326.0,
+		"bytes_from_upstream": 2326.0,
+		"bytes_to_upstream":   100.0,
+		"close_reason":        water.CloseReasonUpstream,
+	} {
+		if got[k] != want {
+			t.Errorf("%s = %v, want %v", k, got[k], want)
+		}
+	}
+}
+
+func TestNewCLFAccessLogger(t *testing.T) {
+	var buf bytes.Buffer
+	water.NewCLFAccessLogger(&buf).LogAccess(testAccessLogEntry)
+
+	const want = "192.0.2.1 - - [10/Oct/2000:13:55:36 -0700] \"RELAY tcp 198.51.100.1:443\" - 2326\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,39 @@
+package water
+
+import (
+	"net"
+
+	"github.com/refraction-networking/water/internal/log"
+)
+
+// ConnMetadata describes a connection accepted by a Listener for the
+// AuthHandler of the Config to authorize it.
+type ConnMetadata struct {
+	// LocalAddr and RemoteAddr are the addresses of the connection.
+	LocalAddr  net.Addr
+	RemoteAddr net.Addr
+
+	// Metadata is the key/value metadata attached to the connection by
+	// the WATM during its handshake, see Conn.Metadata. It is nil if
+	// the WATM attaches none.
+	Metadata map[string]string
+}
+
+// authorize calls the AuthHandler, if set, with the metadata of the
+// connection accepted, and returns its error, if any. Rejections are
+// logged.
+func (c *Config) authorize(conn Conn) error {
+	if c.AuthHandler == nil {
+		return nil
+	}
+
+	err := c.AuthHandler(ConnMetadata{
+		LocalAddr:  conn.LocalAddr(),
+		RemoteAddr: conn.RemoteAddr(),
+		Metadata:   conn.Metadata(),
+	})
+	if err != nil {
+		log.LDebugf(c.Logger(), "water: connection from %s rejected by AuthHandler: %v", conn.RemoteAddr(), err)
+	}
+	return err
+}
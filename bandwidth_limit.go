@@ -0,0 +1,170 @@
+package water
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// Limiter limits the rate at which bytes flow, e.g., through a network
+// connection. A *rate.Limiter from golang.org/x/time/rate, with tokens
+// counting bytes, implements it. If the Limiter also has a method
+// `Burst() int`, as *rate.Limiter does, the bytes are waited for in
+// chunks no larger than the burst.
+//
+// A Limiter MUST be safe for concurrent use, as it may be shared by all
+// connections created from a Config.
+type Limiter interface {
+	// WaitN blocks until n bytes are allowed to flow, or until ctx is
+	// done, in which case it returns an error.
+	WaitN(ctx context.Context, n int) error
+}
+
+// RateLimiter is a Limiter allowing bytes to flow at a fixed rate, with
+// bursts of up to Burst bytes after a period of inactivity.
+type RateLimiter struct {
+	// BytesPerSecond is the rate in bytes per second. A RateLimiter with
+	// a non-positive rate allows all bytes without waiting.
+	BytesPerSecond int
+
+	// Burst optionally allows as many bytes to flow at once without
+	// waiting, after a period of inactivity long enough to accumulate
+	// them. If this field is unset, the bytes are evenly paced.
+	Burst int
+
+	mu   sync.Mutex
+	next time.Time // time at which the bytes already allowed are paid off
+}
+
+// WaitN implements Limiter.
+func (l *RateLimiter) WaitN(ctx context.Context, n int) error {
+	if l.BytesPerSecond <= 0 || n <= 0 {
+		return nil
+	}
+
+	now := time.Now()
+
+	l.mu.Lock()
+	if earliest := now.Add(-time.Duration(max(l.Burst, 0)) * time.Second / time.Duration(l.BytesPerSecond)); l.next.Before(earliest) {
+		l.next = earliest
+	}
+	l.next = l.next.Add(time.Duration(n) * time.Second / time.Duration(l.BytesPerSecond))
+	delay := l.next.Sub(now)
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// waitN waits for n bytes to be allowed by the Limiter, in chunks no
+// larger than its burst, if known.
+func waitN(ctx context.Context, l Limiter, n int) error {
+	chunk := n
+	if b, ok := l.(interface{ Burst() int }); ok && b.Burst() > 0 {
+		chunk = b.Burst()
+	}
+
+	for n > 0 {
+		m := min(n, chunk)
+		if err := l.WaitN(ctx, m); err != nil {
+			return err
+		}
+		n -= m
+	}
+	return nil
+}
+
+// limitConn returns conn, wrapped to be limited by the ReadLimiter, the
+// WriteLimiter, the ConnReadLimit and the ConnWriteLimit, if any is set.
+// The returned connection is then no longer a *net.TCPConn, costing an
+// extra copy of the data if handed to a WATM.
+func (c *Config) limitConn(conn net.Conn) net.Conn {
+	var readLimiters, writeLimiters []Limiter
+	if c.ConnReadLimit > 0 {
+		readLimiters = append(readLimiters, &RateLimiter{BytesPerSecond: c.ConnReadLimit})
+	}
+	if c.ReadLimiter != nil {
+		readLimiters = append(readLimiters, c.ReadLimiter)
+	}
+	if c.ConnWriteLimit > 0 {
+		writeLimiters = append(writeLimiters, &RateLimiter{BytesPerSecond: c.ConnWriteLimit})
+	}
+	if c.WriteLimiter != nil {
+		writeLimiters = append(writeLimiters, c.WriteLimiter)
+	}
+
+	if len(readLimiters) == 0 && len(writeLimiters) == 0 {
+		return conn
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &limitedConn{
+		Conn:          conn,
+		readLimiters:  readLimiters,
+		writeLimiters: writeLimiters,
+		ctx:           ctx,
+		cancel:        cancel,
+	}
+}
+
+// limitDialerFunc returns dialerFunc, wrapped to limit each connection
+// dialed with limitConn.
+func (c *Config) limitDialerFunc(dialerFunc func(network, address string) (net.Conn, error)) func(network, address string) (net.Conn, error) {
+	if c.ReadLimiter == nil && c.WriteLimiter == nil && c.ConnReadLimit <= 0 && c.ConnWriteLimit <= 0 {
+		return dialerFunc
+	}
+
+	return func(network, address string) (net.Conn, error) {
+		conn, err := dialerFunc(network, address)
+		if err != nil {
+			return nil, err
+		}
+		return c.limitConn(conn), nil
+	}
+}
+
+type limitedConn struct {
+	net.Conn
+	readLimiters  []Limiter
+	writeLimiters []Limiter
+
+	ctx    context.Context // done once the connection is closed, to stop waiting
+	cancel context.CancelFunc
+}
+
+// Read reads first and waits afterwards, as the number of bytes to wait
+// for is not known in advance, delaying the next Read instead.
+func (c *limitedConn) Read(b []byte) (n int, err error) {
+	n, err = c.Conn.Read(b)
+	for _, l := range c.readLimiters {
+		if waitErr := waitN(c.ctx, l, n); waitErr != nil && err == nil {
+			err = net.ErrClosed
+		}
+	}
+	return n, err
+}
+
+func (c *limitedConn) Write(b []byte) (n int, err error) {
+	for _, l := range c.writeLimiters {
+		if err := waitN(c.ctx, l, len(b)); err != nil {
+			return 0, net.ErrClosed
+		}
+	}
+	return c.Conn.Write(b)
+}
+
+func (c *limitedConn) Close() error {
+	c.cancel()
+	return c.Conn.Close()
+}
@@ -0,0 +1,78 @@
+package water_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/refraction-networking/water"
+)
+
+func TestRateLimiter(t *testing.T) {
+	limiter := &water.RateLimiter{BytesPerSecond: 10 << 10, Burst: 1 << 10}
+
+	start := time.Now()
+	if err := limiter.WaitN(context.Background(), 1<<10); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("burst took %v, want no wait", elapsed)
+	}
+
+	start = time.Now()
+	if err := limiter.WaitN(context.Background(), 2<<10); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("2 KiB at 10 KiB/s took %v, want at least 200ms", elapsed)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := limiter.WaitN(ctx, 10<<10); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("WaitN() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestConfig_BandwidthLimit(t *testing.T) {
+	var peer net.Conn
+	config := &water.Config{
+		NetworkDialerFunc: func(_, _ string) (net.Conn, error) {
+			var conn net.Conn
+			conn, peer = net.Pipe()
+			return conn, nil
+		},
+		ConnWriteLimit: 1 << 10,
+	}
+
+	conn, err := config.NetworkDialerFuncOrDefault()("tcp", "192.0.2.1:443")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peer.Close()
+
+	go func() {
+		_, _ = peer.Read(make([]byte, 1<<10))
+	}()
+
+	// the first write of 1 KiB waits for 1s, unless the Conn is closed
+	written := make(chan error, 1)
+	go func() {
+		_, err := conn.Write(make([]byte, 1<<10))
+		written <- err
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	conn.Close()
+
+	select {
+	case err := <-written:
+		if !errors.Is(err, net.ErrClosed) {
+			t.Errorf("Write() error = %v, want %v", err, net.ErrClosed)
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("Write() did not return once the Conn is closed")
+	}
+}
@@ -0,0 +1,113 @@
+package water
+
+import (
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/sys"
+)
+
+// Clock is a source of time observed by the WATM via WASI, i.e.,
+// clock_time_get, clock_res_get and the sleeps of poll_oneoff, in place
+// of the host's clocks, e.g., to fast-forward the timeouts of a handshake
+// in tests, or to coarsen the clocks so that the WATM cannot be used to
+// measure the host with a fine granularity.
+//
+// It does not affect the deadlines and timeouts enforced by the host.
+type Clock interface {
+	// Now returns the current wall clock time.
+	Now() time.Time
+
+	// Nanotime returns the current monotonic time in nanoseconds, since
+	// an arbitrary point in the past.
+	Nanotime() int64
+
+	// Sleep pauses the calling WATM for at least d.
+	Sleep(d time.Duration)
+
+	// Resolution returns the granularity of both Now and Nanotime, as
+	// reported to the WATM once clamped between 1 nanosecond and 500
+	// milliseconds.
+	Resolution() time.Duration
+}
+
+// SystemClock is the Clock of the host, used by the WATM if the Clock of
+// the Config is not set and the WASIPolicy grants Clock.
+var SystemClock Clock = systemClock{start: time.Now()}
+
+type systemClock struct {
+	start time.Time
+}
+
+// Now implements Clock.Now().
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// Nanotime implements Clock.Nanotime().
+func (c systemClock) Nanotime() int64 {
+	return time.Since(c.start).Nanoseconds()
+}
+
+// Sleep implements Clock.Sleep().
+func (systemClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+// Resolution implements Clock.Resolution().
+func (systemClock) Resolution() time.Duration {
+	return time.Nanosecond
+}
+
+// CoarseClock returns a Clock truncating the time of clock to multiples
+// of resolution, e.g., CoarseClock(SystemClock, time.Millisecond) hides
+// the host's clock below a millisecond.
+func CoarseClock(clock Clock, resolution time.Duration) Clock {
+	if resolution <= 0 {
+		return clock
+	}
+	return &coarseClock{
+		Clock:      clock,
+		resolution: resolution,
+	}
+}
+
+type coarseClock struct {
+	Clock
+
+	resolution time.Duration
+}
+
+// Now implements Clock.Now().
+func (c *coarseClock) Now() time.Time {
+	return c.Clock.Now().Truncate(c.resolution)
+}
+
+// Nanotime implements Clock.Nanotime().
+func (c *coarseClock) Nanotime() int64 {
+	nanotime := c.Clock.Nanotime()
+	return nanotime - nanotime%c.resolution.Nanoseconds()
+}
+
+// Resolution implements Clock.Resolution().
+func (c *coarseClock) Resolution() time.Duration {
+	return max(c.resolution, c.Clock.Resolution())
+}
+
+// maxClockResolution is the coarsest resolution reported to the WATM, as
+// wazero rejects those of a second or more.
+const maxClockResolution = 500 * time.Millisecond
+
+// withModuleClock returns mc with the clocks and the sleep of the WATM
+// replaced by the Clock of the Config.
+func (c *Config) withModuleClock(mc wazero.ModuleConfig) wazero.ModuleConfig {
+	clock := c.Clock
+	resolution := sys.ClockResolution(min(max(clock.Resolution(), time.Nanosecond), maxClockResolution).Nanoseconds())
+
+	return mc.WithWalltime(func() (sec int64, nsec int32) {
+		now := clock.Now()
+		return now.Unix(), int32(now.Nanosecond())
+	}, resolution).WithNanotime(clock.Nanotime, resolution).WithNanosleep(func(ns int64) {
+		clock.Sleep(time.Duration(ns))
+	})
+}
@@ -0,0 +1,26 @@
+package water_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/refraction-networking/water"
+)
+
+func TestCoarseClock(t *testing.T) {
+	clock := water.CoarseClock(water.SystemClock, time.Millisecond)
+
+	if now := clock.Now(); now.Nanosecond()%int(time.Millisecond) != 0 {
+		t.Errorf("Now() = %v, want a multiple of 1ms", now)
+	}
+	if nanotime := clock.Nanotime(); nanotime%int64(time.Millisecond) != 0 {
+		t.Errorf("Nanotime() = %d, want a multiple of 1ms", nanotime)
+	}
+	if resolution := clock.Resolution(); resolution != time.Millisecond {
+		t.Errorf("Resolution() = %v, want 1ms", resolution)
+	}
+
+	if water.CoarseClock(water.SystemClock, 0) != water.SystemClock {
+		t.Errorf("CoarseClock() with no resolution must return the clock as is")
+	}
+}
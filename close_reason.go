@@ -0,0 +1,76 @@
+package water
+
+import "fmt"
+
+// CloseCode classifies why a connection ended, as reported by the
+// WebAssembly Transport Module in a CloseReason.
+type CloseCode uint32
+
+const (
+	// CloseCodeUnknown is the zero value, meaning no code is reported.
+	CloseCodeUnknown CloseCode = iota
+
+	// CloseCodeNormal means the connection ended gracefully, e.g., both
+	// sides are done.
+	CloseCodeNormal
+
+	// CloseCodeProtocolError means the peer violated the protocol of the
+	// WATM, e.g., it failed the authentication or sent a malformed frame.
+	CloseCodeProtocolError
+
+	// CloseCodePeerReset means the peer reset or closed the connection
+	// unexpectedly.
+	CloseCodePeerReset
+
+	// CloseCodePolicyBlocked means the connection is blocked by a policy,
+	// e.g., one of the WATM or a middlebox interfering with the traffic.
+	CloseCodePolicyBlocked
+
+	// CloseCodeTimeout means an operation of the protocol timed out.
+	CloseCodeTimeout
+
+	// CloseCodeInternalError means the WATM failed on its own, e.g., due
+	// to a bug or an exhausted resource.
+	CloseCodeInternalError
+)
+
+// String returns the name of the CloseCode.
+func (c CloseCode) String() string {
+	switch c {
+	case CloseCodeUnknown:
+		return "unknown"
+	case CloseCodeNormal:
+		return "normal"
+	case CloseCodeProtocolError:
+		return "protocol error"
+	case CloseCodePeerReset:
+		return "peer reset"
+	case CloseCodePolicyBlocked:
+		return "policy blocked"
+	case CloseCodeTimeout:
+		return "timeout"
+	case CloseCodeInternalError:
+		return "internal error"
+	default:
+		return fmt.Sprintf("CloseCode(%d)", uint32(c))
+	}
+}
+
+// CloseReason is the reason why a connection ended, as reported by the
+// WebAssembly Transport Module, for diagnostics.
+type CloseReason struct {
+	// Code classifies the reason. A WATM may report codes beyond those
+	// defined in this package, which are up to the WATM to document.
+	Code CloseCode
+
+	// Message optionally details the reason in a human-readable form.
+	Message string
+}
+
+// String returns the CloseReason in a human-readable form.
+func (r CloseReason) String() string {
+	if r.Message == "" {
+		return r.Code.String()
+	}
+	return r.Code.String() + ": " + r.Message
+}
@@ -0,0 +1,20 @@
+package water_test
+
+import (
+	"testing"
+
+	"github.com/refraction-networking/water"
+)
+
+func TestCloseReason_String(t *testing.T) {
+	for reason, want := range map[water.CloseReason]string{
+		{}:                                   "unknown",
+		{Code: water.CloseCodeProtocolError}: "protocol error",
+		{Code: water.CloseCodePolicyBlocked, Message: "blocked by SNI"}: "policy blocked: blocked by SNI",
+		{Code: 1000, Message: "custom"}:                                 "CloseCode(1000): custom",
+	} {
+		if got := reason.String(); got != want {
+			t.Errorf("%#v.String() = %q, want %q", reason, got, want)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/refraction-networking/water"
+)
+
+// Mode selects what waterd runs.
+type Mode string
+
+const (
+	// ModeClient serves a local SOCKS5 proxy, dialing each connection
+	// requested through a water Dialer.
+	ModeClient Mode = "client"
+
+	// ModeServer accepts connections with a water Listener and forwards
+	// each of them to Remote.
+	ModeServer Mode = "server"
+
+	// ModeRelay accepts connections and relays each of them to Remote
+	// with a water Relay.
+	ModeRelay Mode = "relay"
+)
+
+// Config is the format of the config file of waterd.
+type Config struct {
+	// Mode is one of "client", "server" and "relay".
+	Mode Mode `json:"mode"`
+
+	// Network is the network to listen on and to dial, "tcp" if unset.
+	Network string `json:"network,omitempty"`
+
+	// Listen is the local address to listen on.
+	Listen string `json:"listen"`
+
+	// Remote is the address every connection is forwarded to in server
+	// and relay modes. In client mode, it is optional and overrides the
+	// address requested by the SOCKS5 client, e.g., to always dial a
+	// bridge.
+	Remote string `json:"remote,omitempty"`
+
+	// Water is the path to the config file of water, relative to this
+	// config file. See water.LoadConfig for the format.
+	Water string `json:"water"`
+}
+
+// loadConfig loads the config file of waterd at path and the config file
+// of water it references.
+func loadConfig(path string) (*Config, *water.Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	if config.Network == "" {
+		config.Network = "tcp"
+	}
+
+	switch config.Mode {
+	case ModeClient:
+	case ModeServer, ModeRelay:
+		if config.Remote == "" {
+			return nil, nil, fmt.Errorf("remote is required in %s mode", config.Mode)
+		}
+	default:
+		return nil, nil, fmt.Errorf("unknown mode %q", config.Mode)
+	}
+
+	if config.Listen == "" {
+		return nil, nil, fmt.Errorf("listen is required")
+	}
+
+	if config.Water == "" {
+		return nil, nil, fmt.Errorf("water is required")
+	}
+	waterPath := config.Water
+	if !filepath.IsAbs(waterPath) {
+		waterPath = filepath.Join(filepath.Dir(path), waterPath)
+	}
+
+	waterConfig, err := water.LoadConfig(waterPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &config, waterConfig, nil
+}
@@ -0,0 +1,148 @@
+// Command waterd is the reference deployment of WATER. Driven purely by a
+// config file, it runs as one of:
+//
+//   - client: a local SOCKS5 proxy dialing through a water Dialer,
+//   - server: a water Listener forwarding connections to a remote address,
+//   - relay: a water Relay relaying connections to a remote address.
+//
+// Usage:
+//
+//	waterd -c waterd.json
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/refraction-networking/water"
+	_ "github.com/refraction-networking/water/transport/all"
+	"github.com/refraction-networking/water/waterutil"
+)
+
+var configPath = flag.String("c", "waterd.json", "path to the config file")
+
+func main() {
+	flag.Parse()
+
+	config, waterConfig, err := loadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "waterd: %v\n", err)
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := run(ctx, config, waterConfig); err != nil {
+		fmt.Fprintf(os.Stderr, "waterd: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// run runs waterd in the configured mode until ctx is done.
+func run(ctx context.Context, config *Config, waterConfig *water.Config) error {
+	switch config.Mode {
+	case ModeClient:
+		return runClient(ctx, config, waterConfig)
+	case ModeServer:
+		return runServer(ctx, config, waterConfig)
+	case ModeRelay:
+		return runRelay(ctx, config, waterConfig)
+	default:
+		return fmt.Errorf("unknown mode %q", config.Mode)
+	}
+}
+
+func runClient(ctx context.Context, config *Config, waterConfig *water.Config) error {
+	dialer, err := water.NewDialerWithContext(ctx, waterConfig)
+	if err != nil {
+		return err
+	}
+
+	lis, err := net.Listen(config.Network, config.Listen)
+	if err != nil {
+		return err
+	}
+	closeOnDone(ctx, lis)
+
+	if config.Remote != "" {
+		dialer = &fixedRemoteDialer{Dialer: dialer, remote: config.Remote}
+	}
+
+	slog.Info("waterd: serving SOCKS5", "addr", lis.Addr())
+	return ignoreClosed(ctx, (&waterutil.SOCKS5Server{Dialer: dialer, Network: config.Network}).Serve(lis))
+}
+
+// fixedRemoteDialer dials remote whatever the address requested is.
+type fixedRemoteDialer struct {
+	water.Dialer
+	remote string
+}
+
+func (d *fixedRemoteDialer) DialContext(ctx context.Context, network, _ string) (water.Conn, error) {
+	return d.Dialer.DialContext(ctx, network, d.remote)
+}
+
+func runServer(ctx context.Context, config *Config, waterConfig *water.Config) error {
+	lis, err := waterConfig.ListenContext(ctx, config.Network, config.Listen)
+	if err != nil {
+		return err
+	}
+	closeOnDone(ctx, lis)
+
+	slog.Info("waterd: listening", "addr", lis.Addr(), "remote", config.Remote)
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			return ignoreClosed(ctx, err)
+		}
+
+		go func() {
+			defer conn.Close() // skipcq: GO-S2307
+
+			var d net.Dialer
+			remote, err := d.DialContext(ctx, config.Network, config.Remote)
+			if err != nil {
+				slog.Warn("waterd: dialing remote", "remote", config.Remote, "error", err)
+				return
+			}
+			defer remote.Close() // skipcq: GO-S2307
+
+			waterutil.Pipe(conn, remote)
+		}()
+	}
+}
+
+func runRelay(ctx context.Context, config *Config, waterConfig *water.Config) error {
+	relay, err := water.NewRelayWithContext(ctx, waterConfig)
+	if err != nil {
+		return err
+	}
+	closeOnDone(ctx, relay)
+
+	slog.Info("waterd: relaying", "listen", config.Listen, "remote", config.Remote)
+	return ignoreClosed(ctx, relay.ListenAndRelayTo(config.Network, config.Listen, config.Network, config.Remote))
+}
+
+func closeOnDone(ctx context.Context, c io.Closer) {
+	go func() {
+		<-ctx.Done()
+		c.Close()
+	}()
+}
+
+// ignoreClosed returns nil instead of err if it is caused by ctx being
+// done, which closes the listener.
+func ignoreClosed(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,275 @@
+package water
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/refraction-networking/water/internal/log"
+	"github.com/tetratelabs/wazero"
+)
+
+// ErrCompiledModuleInvalid is returned when a compiled transport module,
+// see CompileModule, is malformed.
+var ErrCompiledModuleInvalid = errors.New("water: invalid compiled transport module")
+
+// compiledModuleMagic starts each compiled transport module.
+const compiledModuleMagic = "WATERCM\x00"
+
+// CompileModule compiles the WebAssembly Transport Module ahead of time
+// into machine code, returned serialized for Config.TransportModuleCompiled,
+// so that the WATM is not compiled again at runtime, e.g., on constrained
+// devices where compiling a large WATM is slow.
+//
+// The machine code is specific to the platform (i.e., the OS, the
+// architecture and the CPU features) and to the version of the runtime
+// used by WATER, so CompileModule must run on a platform identical to the
+// one the compiled module is to be used on, e.g., at installation time. An
+// error is returned if the platform is not supported by the compiler.
+//
+// The compiled module is native code run without verification, see
+// Config.TransportModuleCompiled, so it must be stored where it cannot be
+// tampered with.
+func CompileModule(ctx context.Context, bin []byte) ([]byte, error) {
+	if isComponent(bin) {
+		return nil, ErrComponentUnsupported
+	}
+
+	dir, err := os.MkdirTemp("", "watercompile")
+	if err != nil {
+		return nil, fmt.Errorf("water: compiling transport module: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cache, err := wazero.NewCompilationCacheWithDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("water: compiling transport module: %w", err)
+	}
+	defer cache.Close(ctx)
+
+	r := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().WithCompilationCache(cache))
+	defer r.Close(ctx)
+
+	if _, err = r.CompileModule(ctx, bin); err != nil {
+		return nil, fmt.Errorf("water: (*Runtime).CompileModule returned error: %w", err)
+	}
+
+	platform, err := compilationCachePlatform(dir)
+	if err != nil {
+		return nil, fmt.Errorf("water: compiling transport module: %w", err)
+	}
+
+	entries, err := os.ReadDir(filepath.Join(dir, platform))
+	if err != nil {
+		return nil, fmt.Errorf("water: compiling transport module: %w", err)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(compiledModuleMagic)
+	buf.Write(binary.AppendUvarint(nil, uint64(len(platform))))
+	buf.WriteString(platform)
+	var count int
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasSuffix(entry.Name(), ".tmp") {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(dir, platform, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("water: compiling transport module: %w", err)
+		}
+		buf.Write(binary.AppendUvarint(nil, uint64(len(entry.Name()))))
+		buf.WriteString(entry.Name())
+		buf.Write(binary.AppendUvarint(nil, uint64(len(content))))
+		buf.Write(content)
+		count++
+	}
+
+	if count == 0 {
+		return nil, errors.New("water: compiling transport module produced no machine code, the platform may not support the compiler")
+	}
+
+	return buf.Bytes(), nil
+}
+
+// compilationCachePlatform returns the name of the platform-specific
+// directory created within the directory of a CompilationCache.
+func compilationCachePlatform(dir string) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			return entry.Name(), nil
+		}
+	}
+	return "", errors.New("no platform directory in compilation cache")
+}
+
+// compiledModuleEntry is an entry of a CompilationCache, holding the
+// machine code of a module.
+type compiledModuleEntry struct {
+	name    string
+	content []byte
+}
+
+// parseCompiledModule parses a compiled transport module returned by
+// CompileModule.
+func parseCompiledModule(compiled []byte) (platform string, entries []compiledModuleEntry, err error) {
+	rest, ok := bytes.CutPrefix(compiled, []byte(compiledModuleMagic))
+	if !ok {
+		return "", nil, ErrCompiledModuleInvalid
+	}
+
+	next := func() ([]byte, bool) {
+		n, size := binary.Uvarint(rest)
+		if size <= 0 || n > uint64(len(rest)-size) {
+			return nil, false
+		}
+		b := rest[size : size+int(n)]
+		rest = rest[size+int(n):]
+		return b, true
+	}
+
+	b, ok := next()
+	if !ok {
+		return "", nil, ErrCompiledModuleInvalid
+	}
+	platform = string(b)
+
+	for len(rest) > 0 {
+		name, ok := next()
+		// names must be plain file names, as they are written to disk
+		if !ok || len(name) == 0 || filepath.Base(string(name)) != string(name) || strings.ContainsAny(string(name), `/\`) {
+			return "", nil, ErrCompiledModuleInvalid
+		}
+		content, ok := next()
+		if !ok {
+			return "", nil, ErrCompiledModuleInvalid
+		}
+		entries = append(entries, compiledModuleEntry{string(name), content})
+	}
+
+	return platform, entries, nil
+}
+
+// precompiledCache is the CompilationCache into which the compiled
+// transport modules are installed, backed by a private temporary
+// directory created upon first use and removed by
+// RemoveCompiledModuleCache.
+var precompiledCache precompiledCacheState
+
+// precompiledCacheState is the state of the precompiledCache.
+type precompiledCacheState struct {
+	mu        sync.Mutex // protects all fields
+	cache     wazero.CompilationCache
+	root      string // directory of the cache
+	dir       string // platform-specific directory of the entries
+	platform  string
+	installed map[string]bool
+}
+
+// installCompiledModule installs the compiled transport module into the
+// precompiledCache, returning the cache to compile the WATM with. If the
+// compiled module is not for this platform, it is ignored with a warning
+// and nil is returned, so that the WATM is compiled at runtime instead.
+func installCompiledModule(compiled []byte, logger *log.Logger) (wazero.CompilationCache, error) {
+	platform, entries, err := parseCompiledModule(compiled)
+	if err != nil {
+		return nil, err
+	}
+
+	pc := &precompiledCache
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	if pc.cache == nil {
+		if err := pc.create(); err != nil {
+			return nil, fmt.Errorf("water: creating cache for compiled transport module: %w", err)
+		}
+	}
+
+	if platform != pc.platform {
+		log.LWarnf(logger, "water: transport module compiled for %s, not %s, compiling it again", platform, pc.platform)
+		return nil, nil
+	}
+
+	for _, entry := range entries {
+		if pc.installed[entry.name] {
+			continue
+		}
+		if err := os.WriteFile(filepath.Join(pc.dir, entry.name), entry.content, 0o600); err != nil {
+			return nil, fmt.Errorf("water: installing compiled transport module: %w", err)
+		}
+		pc.installed[entry.name] = true
+	}
+
+	return pc.cache, nil
+}
+
+// create creates the cache in a new temporary directory. The caller must
+// hold mu.
+func (pc *precompiledCacheState) create() error {
+	root, err := os.MkdirTemp("", "waterprecompiled")
+	if err != nil {
+		return err
+	}
+	cache, err := wazero.NewCompilationCacheWithDir(root)
+	if err != nil {
+		os.RemoveAll(root) // skipcq: GSC-G104
+		return err
+	}
+	platform, err := compilationCachePlatform(root)
+	if err != nil {
+		cache.Close(context.Background()) // skipcq: GSC-G104
+		os.RemoveAll(root)                // skipcq: GSC-G104
+		return err
+	}
+
+	pc.cache, pc.root, pc.platform = cache, root, platform
+	pc.dir = filepath.Join(root, platform)
+	pc.installed = make(map[string]bool)
+	return nil
+}
+
+// precompiledCacheDir returns the directory of the precompiledCache, or ""
+// if it is not created.
+func precompiledCacheDir() string {
+	pc := &precompiledCache
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	return pc.root
+}
+
+// RemoveCompiledModuleCache closes the CompilationCache the machine code
+// in Config.TransportModuleCompiled is installed into and removes the
+// temporary directory backing it, e.g., before the program exits. It must
+// only be called once no Core created with a TransportModuleCompiled is
+// in use. A Core created afterwards installs its machine code into a new
+// CompilationCache.
+func RemoveCompiledModuleCache(ctx context.Context) error {
+	pc := &precompiledCache
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	if pc.cache == nil {
+		return nil
+	}
+
+	err := pc.cache.Close(ctx)
+	if rmErr := os.RemoveAll(pc.root); err == nil {
+		err = rmErr
+	}
+	pc.cache, pc.root, pc.dir, pc.platform, pc.installed = nil, "", "", "", nil
+	if err != nil {
+		return fmt.Errorf("water: removing cache for compiled transport module: %w", err)
+	}
+	return nil
+}
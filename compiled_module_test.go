@@ -0,0 +1,91 @@
+package water_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/refraction-networking/water"
+)
+
+func TestCompileModule(t *testing.T) {
+	compiled, err := water.CompileModule(context.Background(), wasmReverse)
+	if err != nil {
+		t.Skipf("CompileModule: %v", err) // e.g., the compiler is not supported on this platform
+	}
+
+	for _, tc := range []struct {
+		name     string
+		compiled []byte
+		wantErr  error
+	}{
+		{"compiled", compiled, nil},
+		{"truncated", append([]byte("WATERCM\x00\x05other"), compiled[len(compiled)-1]), water.ErrCompiledModuleInvalid},
+		{"other platform", []byte("WATERCM\x00\x05other"), nil},
+		{"malformed", []byte("not compiled"), water.ErrCompiledModuleInvalid},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			config := &water.Config{
+				TransportModuleBin:      wasmReverse,
+				TransportModuleCompiled: tc.compiled,
+				ModuleConfigFactory:     water.NewWazeroModuleConfigFactory(),
+			}
+
+			dialed, accepted, err := water.Pipe(config)
+			if tc.wantErr != nil {
+				if !errors.Is(err, tc.wantErr) {
+					t.Fatalf("Pipe returned %v, want %v", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer dialed.Close()   // skipcq: GO-S2307
+			defer accepted.Close() // skipcq: GO-S2307
+
+			if _, err = dialed.Write([]byte("hello")); err != nil {
+				t.Fatal(err)
+			}
+			buf := make([]byte, 5)
+			if _, err = io.ReadFull(accepted, buf); err != nil {
+				t.Fatal(err)
+			}
+			if string(buf) != "hello" {
+				t.Errorf("read %q, want %q", buf, "hello")
+			}
+		})
+	}
+
+	// the temporary directory of the machine code is removed, and the
+	// machine code is installed again once used afterwards
+	pattern := filepath.Join(os.TempDir(), "waterprecompiled*")
+	before, _ := filepath.Glob(pattern)
+	if err = water.RemoveCompiledModuleCache(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if after, _ := filepath.Glob(pattern); len(after) != len(before)-1 {
+		t.Errorf("%d directories of compiled modules after RemoveCompiledModuleCache, want %d", len(after), len(before)-1)
+	}
+
+	dialed, accepted, err := water.Pipe(&water.Config{
+		TransportModuleBin:      wasmReverse,
+		TransportModuleCompiled: compiled,
+		ModuleConfigFactory:     water.NewWazeroModuleConfigFactory(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dialed.Close()   // skipcq: GO-S2307
+	accepted.Close() // skipcq: GO-S2307
+	if err = water.RemoveCompiledModuleCache(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = water.CompileModule(context.Background(), []byte("not a wasm")); err == nil {
+		t.Error("CompileModule must fail with an invalid binary")
+	}
+}
@@ -0,0 +1,6 @@
+// Constraints here must match those of the compiler of wazero.
+//go:build (amd64 || arm64) && (darwin || linux || freebsd || windows)
+
+package water
+
+const compilerSupported = true
@@ -0,0 +1,6 @@
+// This is the opposite constraint of compiler_supported.go
+//go:build !(amd64 || arm64) || !(darwin || linux || freebsd || windows)
+
+package water
+
+const compilerSupported = false
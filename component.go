@@ -0,0 +1,20 @@
+package water
+
+import "errors"
+
+// ErrComponentUnsupported is returned when the TransportModuleBin is a
+// WebAssembly component, e.g., one targeting WASI 0.2 (preview 2) with
+// WIT-defined interfaces. The underlying runtime implements only core
+// modules, so such a WATM must be built for WASI preview 1 instead.
+var ErrComponentUnsupported = errors.New("water: WebAssembly components (WASI 0.2) are not supported, a WASI preview 1 core module is required")
+
+// isComponent reports whether bin is encoded as a WebAssembly component
+// rather than a core module. Both start with the same magic number, but
+// a component sets the layer field following the version to 1.
+//
+// See https://github.com/WebAssembly/component-model/blob/main/design/mvp/Binary.md
+func isComponent(bin []byte) bool {
+	return len(bin) >= 8 &&
+		string(bin[:4]) == "\x00asm" &&
+		bin[6] == 0x01 && bin[7] == 0x00
+}
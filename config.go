@@ -2,10 +2,16 @@ package water
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"net"
-	"os"
+	"net/netip"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"github.com/refraction-networking/water/configbuilder"
 	"github.com/refraction-networking/water/internal/log"
@@ -13,6 +19,11 @@ import (
 )
 
 // Config defines the configuration for the WATER Dialer/Config interface.
+//
+// A Config may be shared to create several Dialers, Listeners and Relays,
+// each of which keeps its own copy, but it must not be modified once used:
+// creating another from a modified Config fails with ErrConfigMutated. To
+// derive a new Config, modify its Clone instead.
 type Config struct {
 	// TransportModuleBin contains the binary format of the WebAssembly
 	// Transport Module.
@@ -21,24 +32,188 @@ type Config struct {
 	// a .wat (WebAssembly Text Format) file.
 	TransportModuleBin []byte
 
+	// TransportModuleCompiled optionally provides the machine code of the
+	// TransportModuleBin compiled ahead of time with CompileModule, so that
+	// it is not compiled again for this Config. TransportModuleBin is still
+	// required. If the machine code is for another platform, it is ignored
+	// and the WATM is compiled at runtime.
+	//
+	// It is ignored if the RuntimeConfigFactory is isolated, and otherwise
+	// replaces the CompilationCache set for it. The machine code is
+	// installed into a temporary directory, removed by
+	// RemoveCompiledModuleCache.
+	//
+	// The machine code is run as-is, without being verified against
+	// TransportModuleBin nor validated like WebAssembly, so it escapes the
+	// sandbox of the WATM and must only come from a trusted source, e.g.,
+	// CompileModule run on the same device.
+	TransportModuleCompiled []byte
+
 	// TransportModuleConfig optionally provides a configuration file to be pushed into
 	// the WASM Transport Module.
 	TransportModuleConfig TransportModuleConfig
 
+	// TransportChain optionally composes more WATMs in series with the one
+	// above, e.g., to stack a padding WATM and an encryption WATM without
+	// compiling a combined WASM binary. A Dialer writes the data from the
+	// caller through the WATM above and then each WATM in the chain in
+	// order before it reaches the network, and a Listener with the same
+	// TransportChain reads it back through them in reverse order. For a
+	// Relay, the chain applies to the connections accepted only.
+	//
+	// Only the last WATM in the chain faces the network, so the
+	// NetworkDialerFunc, the Resolver, the Failover, the TCPOptions, the
+	// bandwidth limits, the AcceptRateLimit and the AcceptFilter apply to
+	// it only.
+	TransportChain []ModuleConfig
+
 	// NetworkDialerFunc specifies a func that dials the specified address on the
 	// named network. This optional field can be set to override the Go
 	// default dialer func:
 	// 	net.Dial(network, address)
 	NetworkDialerFunc func(network, address string) (net.Conn, error)
 
+	// Resolver optionally controls how hostnames are resolved by the host
+	// before dialing for the WATM, e.g., to use DNS-over-HTTPS instead of
+	// the system resolver, to pin the IP version, or to force the WATM to
+	// resolve hostnames by itself. If this field is unset, addresses are
+	// passed to the NetworkDialerFunc as-is, or resolved with the system
+	// resolver if the NetworkDialerFunc is unset as well.
+	//
+	// A hostname resolving to addresses of both IP versions is dialed as
+	// in Happy Eyeballs (RFC 8305), racing the two versions.
+	Resolver *Resolver
+
+	// RemoteAddress optionally specifies the logical destination the WATM
+	// is to target in its protocol, e.g., as the SNI or the Host header,
+	// when it differs from the address the host connects the socket to,
+	// e.g., the IP address of a front in domain fronting. The WATM learns
+	// it via the host functions of its version, e.g.,
+	// `env.water_get_remote_address` in v1. If this field is unset, the
+	// address requested to the Dialer is reported instead.
+	RemoteAddress string
+
+	// PreferIPv6 makes the host dial the IPv6 addresses of a hostname
+	// first, racing the IPv4 ones after the FallbackDelay of the Resolver.
+	// By default, the IPv4 addresses are dialed first.
+	PreferIPv6 bool
+
+	// Failover optionally lists backup remote endpoints the host tries
+	// when dialing for the WATM fails. It is shared, not copied, by Clone,
+	// so that the round-robin order spans all connections dialed with
+	// the same Config.
+	Failover *Failover
+
+	// DialRetry optionally makes a Dialer retry the dials failing
+	// transiently, e.g., with a connection reset during the handshake of
+	// the WATM, with a new WASM instance each. It is shared, not copied,
+	// by Clone.
+	DialRetry *DialRetry
+
+	// DialAllowlist optionally restricts the remote addresses the host
+	// dials for the WATM. Unlike the DialedAddressValidator, it applies to
+	// every address dialed, including the address requested to the Dialer,
+	// the Failover backups and those dialed by a Relay. It is enforced
+	// before hostnames are resolved by the Resolver.
+	DialAllowlist *DialAllowlist
+
+	// ReadLimiter and WriteLimiter optionally limit the aggregate rate at
+	// which the data is read from and written to the network, in bytes,
+	// by all connections dialed or accepted for the WATMs created with the
+	// Config, e.g., with a RateLimiter, so that a relay operator can cap
+	// the bandwidth used. They are shared, not copied, by Clone.
+	ReadLimiter, WriteLimiter Limiter
+
+	// ConnReadLimit and ConnWriteLimit optionally limit the rate at which
+	// the data is read from and written to the network by each connection
+	// dialed or accepted for a WATM, in bytes per second, in addition to
+	// the ReadLimiter and the WriteLimiter.
+	//
+	// A connection limited by any of the above is no longer a
+	// *net.TCPConn, costing an extra copy of the data to hand it to the
+	// WATM.
+	ConnReadLimit, ConnWriteLimit int
+
+	// TCPOptions optionally controls the socket options (e.g., TCP_NODELAY
+	// or SO_MARK) of the TCP connections dialed for the WATM and accepted
+	// from the NetworkListener.
+	TCPOptions *TCPOptions
+
+	// UnderlyingTLS optionally runs the WATM over TLS, i.e., water over
+	// TLS: each connection dialed for the WATM is a TLS client connection,
+	// and each connection accepted from the NetworkListener a TLS server
+	// connection, so that the WATM reads and writes the plaintext beneath
+	// the TLS records. Accepting requires a certificate, e.g., set in
+	// Certificates. If the ServerName is unset, it defaults to the host
+	// dialed. TLS is beneath the TransportChain, if any.
+	//
+	// To run TLS over water instead, i.e., within the transport of the
+	// WATM, see TLSClient and TLSServer.
+	UnderlyingTLS *tls.Config
+
+	// UnderlyingProtocol optionally selects the protocol carrying the
+	// traffic of the WATM instead of TCP, e.g., "quic" once the
+	// github.com/refraction-networking/water/quic package is imported, so
+	// that the transport benefits from its loss recovery or its
+	// connection migration. The built-in "ws" and "wss" carry it over
+	// WebSocket, see WebSocketOptions. See UnderlyingProtocol. It is
+	// ignored for dialing if a NetworkDialerFunc is set, and for listening
+	// if a NetworkListener is set.
+	UnderlyingProtocol string
+
+	// WebSocketOptions optionally controls the opening handshake of the
+	// WebSocket connections if the UnderlyingProtocol is "ws" or "wss",
+	// e.g., the Host header and the path requested through a CDN.
+	WebSocketOptions *WebSocketOptions
+
+	// ReadBufferSize optionally sets the size in bytes of the buffers
+	// staging the data from the WATM to the caller, i.e., the receive
+	// buffer of the caller's end and the send buffer of the WATM's end of
+	// the socket pair connecting them. If this field is unset, the
+	// operating system default is used, which is usually auto-tuned.
+	// Larger buffers help bulk transfer workloads.
+	ReadBufferSize int
+
+	// WriteBufferSize optionally sets the size in bytes of the buffers
+	// staging the data from the caller to the WATM, like ReadBufferSize
+	// does in the opposite direction.
+	WriteBufferSize int
+
 	// DialedAddressValidator is an optional field that can be set to validate
 	// the dialed address. It is only used when WATM specifies the remote
-	// address to dial.
+	// address to dial, e.g., for a FixedDialer, or for the extra outbound
+	// connections of a Dialer or a Relay, such as decoys.
 	//
 	// If not set, all addresses are considered invalid. To allow all addresses,
 	// simply set this field to a function that always returns nil.
 	DialedAddressValidator func(network, address string) error
 
+	// MaxOutboundConns optionally caps the number of outbound network
+	// connections each WASM instance may dial through the host, e.g., a
+	// primary connection and decoys, or the paths of a multipath
+	// transport, DefaultMaxOutboundConns if 0. Further dials fail with
+	// EMFILE.
+	MaxOutboundConns int
+
+	// PathInfoFunc optionally provides the PathInfo of each network
+	// connection of a WASM instance queried by the WATM, e.g., from the
+	// probing of the application, instead of NetConnPathInfo.
+	PathInfoFunc func(conn net.Conn) (PathInfo, error)
+
+	// AllowRaw allows the WATM to dial raw IP sockets, e.g., ICMP for a
+	// ping tunnel, through the host. Such sockets usually require the
+	// privileges of the operating system too, e.g., CAP_NET_RAW on Linux.
+	// The addresses dialed are validated by the DialedAddressValidator.
+	//
+	// If not set, the WATM is not allowed to dial raw sockets.
+	AllowRaw bool
+
+	// TUN optionally provides a TUN device to each WASM instance which
+	// asks for it, e.g., for a WATM tunneling the IP packets of a VPN
+	// client over its connection to the remote. It is shared, not copied,
+	// by Clone.
+	TUN *TUN
+
 	// NetworkListener specifies a net.listener implementation that listens
 	// on the specified address on the named network. This optional field
 	// will be used to provide (incoming) network connections from a
@@ -47,6 +222,65 @@ type Config struct {
 	// Calling (*Config).Listen will override this field.
 	NetworkListener net.Listener
 
+	// ListenConfig optionally controls how the network listeners are
+	// created by ListenContext, by a Relay's ListenAndRelayTo and from
+	// config files, e.g., to set SO_REUSEPORT or SO_REUSEADDR with its
+	// Control func so that multiple processes could share the same port,
+	// or IPV6_V6ONLY to control the dual-stack behavior. The TCPOptions,
+	// if set, are applied after its Control func.
+	ListenConfig net.ListenConfig
+
+	// AcceptFilter optionally decides whether an incoming connection
+	// accepted from the NetworkListener should be handled. It is invoked
+	// before a WASM instance is created for the connection, so dropping
+	// scanners or abusive sources costs no instantiation. A connection
+	// rejected by returning false is closed immediately.
+	AcceptFilter func(net.Conn) bool
+
+	// AcceptRateLimit optionally limits the rate at which incoming
+	// connections are accepted from the NetworkListener, in total and per
+	// source IP address. It is checked before the AcceptFilter. It is
+	// shared, not copied, by Clone, so that the limits span all Listeners
+	// and Relays created with the same Config.
+	AcceptRateLimit *AcceptRateLimit
+
+	// AuthHandler optionally authorizes each connection accepted by a
+	// Listener once the WATM has completed its handshake, but before
+	// Accept returns it, e.g., based on the credentials (a PSK identity or
+	// the fingerprint of a client certificate) the WATM attached to the
+	// connection as metadata. A connection rejected with an error is
+	// closed, which the peer observes as a generic failure of the
+	// transport, and Accept waits for the next one.
+	AuthHandler func(ConnMetadata) error
+
+	// ProxyProtocol optionally makes a Relay send a HAProxy PROXY protocol
+	// header carrying the address of the original client to the upstream
+	// before any data is relayed. It is ignored by Dialer and Listener.
+	ProxyProtocol ProxyProtocolVersion
+
+	// AccessLogger optionally makes a Relay log an AccessLogEntry for each
+	// connection relayed once it is closed. It is ignored by Dialer and
+	// Listener.
+	AccessLogger AccessLogger
+
+	// UpstreamPool optionally makes a Relay dial the connections to its
+	// upstream in advance, so that each inbound connection takes one
+	// already established. It is shared, not copied, by Clone. It is
+	// ignored by Dialer and Listener.
+	UpstreamPool *UpstreamPool
+
+	// ModuleEnv optionally sets environment variables for each WASM
+	// instance created, on top of those set via the ModuleConfigFactory.
+	// Like ModuleArgv, they could be overridden per connection with
+	// WithModuleEnv, and are withheld if the WASIPolicy does not grant
+	// the Environ capability.
+	ModuleEnv map[string]string
+
+	// ModuleArgv optionally sets the arguments for each WASM instance
+	// created, replacing those set via the ModuleConfigFactory. They could
+	// be replaced per connection with WithModuleArgv.
+	ModuleArgv []string
+
 	// ModuleConfigFactory is used to configure the system resource of
 	// each WASM instance created. This field is for advanced use cases
 	// and/or debugging purposes only.
@@ -65,11 +299,160 @@ type Config struct {
 	// be created and returned.
 	RuntimeConfigFactory *WazeroRuntimeConfigFactory
 
+	// RuntimeOptions optionally tunes the WebAssembly runtime, e.g., to
+	// limit the memory of each WASM instance, on top of the
+	// RuntimeConfigFactory.
+	RuntimeOptions *RuntimeOptions
+
+	// WASIPolicy specifies which WASI capabilities are granted to each
+	// WASM instance created. If this field is unset, DefaultWASIPolicy
+	// will be used, plus the capabilities explicitly configured, see
+	// WASIPolicyOrDefault.
+	WASIPolicy *WASIPolicy
+
+	// EntropySource optionally replaces the random source of each WASM
+	// instance created, i.e., what WASI random_get returns, whether or
+	// not the WASIPolicy grants Random, e.g., with a seeded generator for
+	// the choices of the WATM, such as nonces or padding lengths, to be
+	// reproducible in tests and fuzzing. It is shared by the instances,
+	// so it must be safe for concurrent use if several are created at
+	// once. It MUST NOT be set in production.
+	EntropySource io.Reader
+
+	// Clock optionally replaces the clocks and the sleep of each WASM
+	// instance created, whether or not the WASIPolicy grants Clock, e.g.,
+	// with a fake clock to fast-forward the timeouts of the WATM in tests,
+	// or with a CoarseClock to hide the granularity of the host's clock.
+	Clock Clock
+
+	// ExecutionPool optionally bounds the CPU-intensive operations on the
+	// WebAssembly modules created from this Config. It is shared, not
+	// copied, by Clone, so that all connections of a Listener are
+	// scheduled through the same ExecutionPool.
+	ExecutionPool *ExecutionPool
+
+	// WorkerPool optionally runs the worker threads of the WASM instances
+	// created from this Config on a pool of goroutines, bounding the
+	// number of connections served concurrently. It is shared, not
+	// copied, by Clone, like the ExecutionPool.
+	WorkerPool *WorkerPool
+
+	// InstantiationTimeout optionally bounds the time spent compiling and
+	// instantiating each WASM instance, so that a malformed or enormous
+	// WATM cannot block the caller indefinitely. It applies in addition to
+	// the deadline of the context passed, if any. If this field is unset,
+	// only the context passed bounds the instantiation.
+	InstantiationTimeout time.Duration
+
+	// HandshakeTimeout optionally bounds the time a Listener spends on
+	// each incoming connection, from creating its WASM instance to the
+	// end of the handshake of the WATM, so that a client stalling the
+	// handshake holds no instance for long. A connection not ready in
+	// time is closed, and ErrHandshakeTimeout is returned for it.
+	HandshakeTimeout time.Duration
+
+	// HandshakeConcurrency optionally makes a Listener create the WASM
+	// instances and run the handshakes of up to this many incoming
+	// connections concurrently, on goroutines separate from the one
+	// accepting them, so that a burst of slow handshakes does not hold
+	// back the next connections. Accept then returns the connections in
+	// the order their handshakes complete. If zero, each connection is
+	// handshaken by the Accept call returning it.
+	HandshakeConcurrency int
+
+	// IdleTimeout optionally closes each Conn on which no data is read or
+	// written for the given duration, reclaiming its WASM instance, e.g.,
+	// so that a long-lived Relay does not accumulate instances for peers
+	// silently gone. For a Dialer or a Listener, the reads and writes of
+	// the caller are observed. For a Relay, those of the WATM on the
+	// network connections are, which are then no longer *net.TCPConn,
+	// costing an extra copy of the data relayed.
+	IdleTimeout time.Duration
+
+	// KeepaliveInterval optionally makes the host notify each WASM
+	// instance every interval, upon which the WATM may emit protocol-level
+	// keepalives or padding, e.g., to keep NAT mappings alive or to mask
+	// idle traffic patterns. Only WATMs opting in to it are notified,
+	// i.e., exporting watm_keepalive_v1 in v1. It is ignored by v0.
+	KeepaliveInterval time.Duration
+
+	// Shaper optionally shapes the writes of each WASM instance created,
+	// on its request, e.g., with pacing, timing jitter and padding. It is
+	// shared, not copied, by Clone. It is ignored by v0.
+	Shaper Shaper
+
+	// OnDialStart is optionally called as each Dialer starts dialing,
+	// before the WASM instance is created. It is ignored by v0, like the
+	// other lifecycle callbacks below. The callbacks are called from the
+	// goroutine of the step reported and must not block.
+	OnDialStart func(*DialEvent)
+
+	// OnUnderlyingConnected is optionally called once the network
+	// connection to the address dialed by a Dialer is established, before
+	// the handshake of the WATM, if any, is complete.
+	OnUnderlyingConnected func(*DialEvent)
+
+	// OnHandshakeComplete is optionally called once a Dialer returns the
+	// Conn dialed, or the error the dial failed with.
+	OnHandshakeComplete func(*DialEvent)
+
+	// OnClose is optionally called once each Conn dialed by a Dialer is
+	// closed, with the time elapsed since the dial started.
+	OnClose func(*DialEvent)
+
+	// OnIdleTimeout is optionally called with each Conn closed for being
+	// idle for the IdleTimeout.
+	OnIdleTimeout func(Conn)
+
+	// OnModuleCrash is optionally called with each crash of a WASM
+	// instance, i.e., a trap or a panic in a call into the WATM, which
+	// fails the connection of the instance alone. It is called from the
+	// goroutine of the crashed call and must not block.
+	OnModuleCrash func(*ModuleCrash)
+
+	// CrashDumpSink optionally receives a CrashDump of each crash of a WASM
+	// instance, with the stack trace and a snapshot of the memory, for
+	// debugging the WATM in the field. It is shared, not copied, by Clone.
+	CrashDumpSink CrashDumpSink
+
+	// CrashDumpMemoryLimit caps the size of the memory snapshot in each
+	// CrashDump, DefaultCrashDumpMemoryLimit if 0. If negative, the memory
+	// is left out of the CrashDump.
+	CrashDumpMemoryLimit int
+
+	// Recorder optionally makes each WASM instance created record every
+	// call between the host and the WATM, including the data written into
+	// the memory by the host functions, into the writer it returns, which
+	// is closed with the Core. The recording may be fed back into the WATM
+	// offline with Replay. Recording copies the memory around each call
+	// into a host function, so it is meant for debugging only.
+	Recorder func() (io.WriteCloser, error)
+
+	// ProcessIsolation optionally makes each WASM instance of a Dialer or a
+	// Listener run in a child process of its own, for a stronger isolation
+	// of untrusted WATMs at the cost of latency. It is shared, not copied,
+	// by Clone.
+	ProcessIsolation *ProcessIsolation
+
+	// TimeBasedCredential optionally provides time-rotated credentials
+	// derived from a root secret to the WATM, which may query them
+	// without being given the secret itself.
+	TimeBasedCredential *TimeBasedCredential
+
+	// SessionState optionally provides opaque session state exported by a
+	// previous Conn, which each WASM instance created may import to resume
+	// the session, e.g., for 0-RTT reconnects. See ResumeSession.
+	SessionState []byte
+
 	// OverrideLogger is a slog.Logger, used by WATER to log messages including
 	// debugging information, warnings, errors that cannot be returned to the caller
 	// of the WATER API. If this field is unset, the default logger from the slog
 	// package will be used.
 	OverrideLogger *log.Logger
+
+	// used records the fields of the Config as of its first use, to
+	// detect its modification afterwards, see snapshot.
+	used atomic.Pointer[configFingerprint]
 }
 
 // Clone creates a deep copy of the Config.
@@ -81,26 +464,182 @@ func (c *Config) Clone() *Config {
 	wasmClone := make([]byte, len(c.TransportModuleBin))
 	copy(wasmClone, c.TransportModuleBin)
 
+	var moduleEnvClone map[string]string
+	if c.ModuleEnv != nil {
+		moduleEnvClone = make(map[string]string, len(c.ModuleEnv))
+		for k, v := range c.ModuleEnv {
+			moduleEnvClone[k] = v
+		}
+	}
+
+	var transportChainClone []ModuleConfig
+	if c.TransportChain != nil {
+		transportChainClone = make([]ModuleConfig, len(c.TransportChain))
+		for i, mc := range c.TransportChain {
+			transportChainClone[i] = ModuleConfig{
+				TransportModuleBin:    append([]byte(nil), mc.TransportModuleBin...),
+				TransportModuleConfig: mc.TransportModuleConfig,
+			}
+		}
+	}
+
 	return &Config{
-		TransportModuleBin:     wasmClone,
-		TransportModuleConfig:  c.TransportModuleConfig,
-		NetworkDialerFunc:      c.NetworkDialerFunc,
-		DialedAddressValidator: c.DialedAddressValidator,
-		NetworkListener:        c.NetworkListener,
-		ModuleConfigFactory:    c.ModuleConfigFactory.Clone(),
-		RuntimeConfigFactory:   c.RuntimeConfigFactory.Clone(),
-		OverrideLogger:         c.OverrideLogger,
+		TransportModuleBin:      wasmClone,
+		TransportModuleCompiled: append([]byte(nil), c.TransportModuleCompiled...),
+		TransportModuleConfig:   c.TransportModuleConfig,
+		TransportChain:          transportChainClone,
+		NetworkDialerFunc:       c.NetworkDialerFunc,
+		Resolver:                c.Resolver.Clone(),
+		PreferIPv6:              c.PreferIPv6,
+		RemoteAddress:           c.RemoteAddress,
+		Failover:                c.Failover,
+		DialRetry:               c.DialRetry,
+		DialAllowlist:           c.DialAllowlist.Clone(),
+		ReadLimiter:             c.ReadLimiter,
+		WriteLimiter:            c.WriteLimiter,
+		ConnReadLimit:           c.ConnReadLimit,
+		ConnWriteLimit:          c.ConnWriteLimit,
+		TCPOptions:              c.TCPOptions.Clone(),
+		UnderlyingTLS:           c.UnderlyingTLS.Clone(),
+		UnderlyingProtocol:      c.UnderlyingProtocol,
+		WebSocketOptions:        c.WebSocketOptions.Clone(),
+		ReadBufferSize:          c.ReadBufferSize,
+		WriteBufferSize:         c.WriteBufferSize,
+		DialedAddressValidator:  c.DialedAddressValidator,
+		MaxOutboundConns:        c.MaxOutboundConns,
+		PathInfoFunc:            c.PathInfoFunc,
+		AllowRaw:                c.AllowRaw,
+		TUN:                     c.TUN,
+		NetworkListener:         c.NetworkListener,
+		ListenConfig:            c.ListenConfig,
+		AcceptFilter:            c.AcceptFilter,
+		AcceptRateLimit:         c.AcceptRateLimit,
+		AuthHandler:             c.AuthHandler,
+		ProxyProtocol:           c.ProxyProtocol,
+		AccessLogger:            c.AccessLogger,
+		ModuleEnv:               moduleEnvClone,
+		ModuleArgv:              append([]string(nil), c.ModuleArgv...),
+		ModuleConfigFactory:     c.ModuleConfigFactory.Clone(),
+		RuntimeConfigFactory:    c.RuntimeConfigFactory.Clone(),
+		RuntimeOptions:          c.RuntimeOptions.Clone(),
+		WASIPolicy:              c.WASIPolicy.Clone(),
+		EntropySource:           c.EntropySource,
+		Clock:                   c.Clock,
+		ExecutionPool:           c.ExecutionPool,
+		WorkerPool:              c.WorkerPool,
+		UpstreamPool:            c.UpstreamPool,
+		InstantiationTimeout:    c.InstantiationTimeout,
+		HandshakeTimeout:        c.HandshakeTimeout,
+		HandshakeConcurrency:    c.HandshakeConcurrency,
+		IdleTimeout:             c.IdleTimeout,
+		OnDialStart:             c.OnDialStart,
+		OnUnderlyingConnected:   c.OnUnderlyingConnected,
+		OnHandshakeComplete:     c.OnHandshakeComplete,
+		OnClose:                 c.OnClose,
+		OnIdleTimeout:           c.OnIdleTimeout,
+		OnModuleCrash:           c.OnModuleCrash,
+		CrashDumpSink:           c.CrashDumpSink,
+		CrashDumpMemoryLimit:    c.CrashDumpMemoryLimit,
+		Recorder:                c.Recorder,
+		ProcessIsolation:        c.ProcessIsolation,
+		KeepaliveInterval:       c.KeepaliveInterval,
+		Shaper:                  c.Shaper,
+		TimeBasedCredential:     c.TimeBasedCredential.Clone(),
+		SessionState:            append([]byte(nil), c.SessionState...),
+		OverrideLogger:          c.OverrideLogger,
+	}
+}
+
+// ResumeSession returns a copy of the Config whose WASM instances are
+// seeded with the session state exported by a previous Conn with
+// [Conn.ExportSession]. The state is opaque to the host, and it is up to
+// the WATM to import and validate it.
+func (c *Config) ResumeSession(state []byte) *Config {
+	clone := c.Clone()
+	clone.SessionState = append([]byte(nil), state...)
+	return clone
+}
+
+// instantiationContext returns a context derived from ctx which is done
+// once InstantiationTimeout elapses, if set.
+func (c *Config) instantiationContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.InstantiationTimeout > 0 {
+		return context.WithTimeout(ctx, c.InstantiationTimeout)
 	}
+	return context.WithCancel(ctx)
 }
 
 // NetworkDialerFuncOrDefault returns the DialerFunc if it is not nil, otherwise
 // returns the default net.Dial function.
+//
+// If TCPOptions is set, they are applied to each connection dialed. If a
+// Resolver is set, or neither a Resolver nor a NetworkDialerFunc is, the
+// returned function resolves the address before dialing, racing the IP
+// versions of a dual-stack hostname. If Failover is set, the returned function tries the
+// backup addresses when dialing the address requested fails. If DialAllowlist is set,
+// each address is checked against it before being dialed. Each connection dialed is limited
+// by the ReadLimiter, the WriteLimiter, the ConnReadLimit and the ConnWriteLimit, if set.
+// If UnderlyingTLS is set, each connection dialed completes a TLS handshake
+// before being returned.
+//
+// If TransportChain is set, the returned function dials through the WATMs
+// in the chain, the last of which dials the network as described above.
+//
+// NetworkDialerFuncOrDefault uses context.Background internally; to
+// specify the context, use NetworkDialerFuncWithContext.
 func (c *Config) NetworkDialerFuncOrDefault() func(network, address string) (net.Conn, error) {
-	if c.NetworkDialerFunc == nil {
-		return net.Dial
+	return c.NetworkDialerFuncWithContext(context.Background())
+}
+
+// NetworkDialerFuncWithContext returns the func NetworkDialerFuncOrDefault
+// does, which resolves the addresses and dials the network with ctx, e.g.,
+// the context of the dial the WATM is dialing for.
+func (c *Config) NetworkDialerFuncWithContext(ctx context.Context) func(network, address string) (net.Conn, error) {
+	dialerFunc := c.tlsDialerFunc(c.networkDialerFunc(ctx))
+	if len(c.TransportChain) > 0 {
+		return c.chainDialerFunc(dialerFunc)
+	}
+	return dialerFunc
+}
+
+// networkDialerFunc returns the func dialing the network with ctx,
+// ignoring the TransportChain.
+func (c *Config) networkDialerFunc(ctx context.Context) func(network, address string) (net.Conn, error) {
+	dialerFunc := c.NetworkDialerFunc
+	if dialerFunc == nil {
+		dialerFunc = c.underlyingDialerFunc(ctx)
+	}
+	if dialerFunc == nil {
+		netDialer := &net.Dialer{Control: c.TCPOptions.Control}
+		dialerFunc = func(network, address string) (net.Conn, error) {
+			return netDialer.DialContext(ctx, network, address)
+		}
+	}
+
+	if c.TCPOptions != nil {
+		tcpOptions, rawDialerFunc := c.TCPOptions, dialerFunc
+		dialerFunc = func(network, address string) (net.Conn, error) {
+			conn, err := rawDialerFunc(network, address)
+			if err != nil {
+				return nil, err
+			}
+			if err := tcpOptions.Apply(conn); err != nil {
+				conn.Close()
+				return nil, err
+			}
+			return conn, nil
+		}
+	}
+
+	resolver := c.Resolver
+	if resolver == nil && c.NetworkDialerFunc == nil {
+		resolver = &Resolver{} // so that dual-stack dials follow PreferIPv6
+	}
+	if resolver != nil {
+		dialerFunc = resolver.dialFunc(ctx, dialerFunc, c.PreferIPv6)
 	}
 
-	return c.NetworkDialerFunc
+	return c.limitDialerFunc(c.Failover.DialFunc(c.DialAllowlist.DialFunc(dialerFunc)))
 }
 
 // NetworkListenerOrDefault returns the NetworkListener if it is not nil,
@@ -113,6 +652,82 @@ func (c *Config) NetworkListenerOrPanic() net.Listener {
 	return c.NetworkListener
 }
 
+// AcceptNetworkConn accepts the next incoming connection from the
+// NetworkListener which passes all checks to be done before a WASM
+// instance is created for it, including the AcceptRateLimit and the
+// AcceptFilter, and applies the TCPOptions and the bandwidth limits to it.
+// Rejected connections are closed and skipped. If UnderlyingTLS is set,
+// the connection returned is a TLS server connection, whose handshake
+// completes once the WATM first reads from it.
+//
+// If TransportChain is set, the connection returned has been accepted
+// through the WATMs in the chain.
+//
+// It panics if the NetworkListener is not provided.
+func (c *Config) AcceptNetworkConn() (net.Conn, error) {
+	for {
+		conn, err := c.NetworkListenerOrPanic().Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		if !c.AcceptRateLimit.Allow(conn.RemoteAddr()) {
+			log.LDebugf(c.Logger(), "water: connection from %s rejected by AcceptRateLimit", conn.RemoteAddr())
+			conn.Close()
+			continue
+		}
+
+		if c.AcceptFilter != nil && !c.AcceptFilter(conn) {
+			log.LDebugf(c.Logger(), "water: connection from %s rejected by AcceptFilter", conn.RemoteAddr())
+			conn.Close()
+			continue
+		}
+
+		if err := c.TCPOptions.Apply(conn); err != nil {
+			log.LErrorf(c.Logger(), "water: applying TCPOptions to connection from %s: %v", conn.RemoteAddr(), err)
+			conn.Close()
+			continue
+		}
+		conn = c.limitConn(conn)
+		conn = c.tlsServerConn(conn)
+
+		if len(c.TransportChain) > 0 {
+			remoteAddr := conn.RemoteAddr()
+			if conn, err = c.acceptThroughChain(conn); err != nil {
+				log.LErrorf(c.Logger(), "water: accepting connection from %s: %v", remoteAddr, err)
+				continue
+			}
+		}
+
+		return conn, nil
+	}
+}
+
+// ApplyBufferSizes applies ReadBufferSize and WriteBufferSize, if set, to
+// the socket pair connecting the caller, via callerConn, and the WATM, via
+// watmConn.
+func (c *Config) ApplyBufferSizes(callerConn, watmConn *net.TCPConn) error {
+	if c.ReadBufferSize > 0 {
+		if err := callerConn.SetReadBuffer(c.ReadBufferSize); err != nil {
+			return fmt.Errorf("water: setting ReadBufferSize: %w", err)
+		}
+		if err := watmConn.SetWriteBuffer(c.ReadBufferSize); err != nil {
+			return fmt.Errorf("water: setting ReadBufferSize: %w", err)
+		}
+	}
+
+	if c.WriteBufferSize > 0 {
+		if err := callerConn.SetWriteBuffer(c.WriteBufferSize); err != nil {
+			return fmt.Errorf("water: setting WriteBufferSize: %w", err)
+		}
+		if err := watmConn.SetReadBuffer(c.WriteBufferSize); err != nil {
+			return fmt.Errorf("water: setting WriteBufferSize: %w", err)
+		}
+	}
+
+	return nil
+}
+
 // WATMBinOrDefault returns the WATMBin if it is not nil, otherwise it panics.
 func (c *Config) WATMBinOrPanic() []byte {
 	if len(c.TransportModuleBin) == 0 {
@@ -136,6 +751,35 @@ func (c *Config) ModuleConfig() *WazeroModuleConfigFactory {
 	return c.ModuleConfigFactory
 }
 
+// WASIPolicyOrDefault returns the WASIPolicy if it is not nil, otherwise
+// returns a copy of DefaultWASIPolicy, which also grants the capabilities
+// explicitly configured: Environ if arguments or environment variables are
+// set via the ModuleConfigFactory, ModuleEnv or ModuleArgv, and Preopens if
+// a directory is preopened via the ModuleConfigFactory.
+func (c *Config) WASIPolicyOrDefault() *WASIPolicy {
+	if c.WASIPolicy == nil {
+		policy := DefaultWASIPolicy.Clone()
+		policy.Environ = c.ModuleConfigFactory.configuresEnviron() || len(c.ModuleEnv) > 0 || len(c.ModuleArgv) > 0
+		policy.Preopens = c.ModuleConfigFactory.configuresPreopens()
+		return policy
+	}
+
+	return c.WASIPolicy
+}
+
+// DefaultMaxOutboundConns is the number of outbound network connections
+// each WASM instance may dial unless the MaxOutboundConns is set.
+const DefaultMaxOutboundConns = 8
+
+// MaxOutboundConnsOrDefault returns the MaxOutboundConns if set, otherwise
+// DefaultMaxOutboundConns.
+func (c *Config) MaxOutboundConnsOrDefault() int {
+	if c.MaxOutboundConns > 0 {
+		return c.MaxOutboundConns
+	}
+	return DefaultMaxOutboundConns
+}
+
 func (c *Config) RuntimeConfig() *WazeroRuntimeConfigFactory {
 	if c.RuntimeConfigFactory == nil {
 		c.RuntimeConfigFactory = NewWazeroRuntimeConfigFactory()
@@ -157,19 +801,78 @@ func (c *Config) Listen(network, address string) (Listener, error) {
 // ListenContext creates a new Listener from the config on the specified network
 // and address with the given context.
 //
-// For now, only TCP is supported.
+// For a WATM declaring a datagram transport, a UDPListener is created on
+// a packet-oriented network, e.g., "udp". Otherwise, only TCP is supported
+// for now. If the network does not match the transport type declared by
+// the WATM, a *TransportTypeMismatchError is returned.
 func (c *Config) ListenContext(ctx context.Context, network, address string) (Listener, error) {
-	lis, err := net.Listen(network, address)
+	config, err := c.snapshot()
 	if err != nil {
 		return nil, err
 	}
 
-	config := c.Clone()
+	if err := config.CheckNetwork(network); err != nil {
+		return nil, err
+	}
+
+	if networkTransportType(network) == TransportTypeDatagram {
+		packetConn, err := config.ListenConfig.ListenPacket(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+
+		lis, err := NewUDPListener(ctx, &UDPListenerConfig{
+			Config:     config,
+			PacketConn: packetConn,
+		})
+		if err != nil {
+			packetConn.Close()
+			return nil, err
+		}
+		return lis, nil
+	}
+
+	lis, err := config.ListenNetwork(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
 	config.NetworkListener = lis
 
 	return NewListenerWithContext(ctx, config)
 }
 
+// ListenNetwork creates a network listener on the specified network and
+// address with the ListenConfig and TCPOptions, or with the
+// UnderlyingProtocol if set. It is to be set as the NetworkListener.
+func (c *Config) ListenNetwork(ctx context.Context, network, address string) (net.Listener, error) {
+	protocol, err := c.underlyingProtocol()
+	if err != nil {
+		return nil, err
+	}
+	if protocol != nil {
+		return protocol.Listen(ctx, c, network, address)
+	}
+	return c.listenTCP(ctx, network, address)
+}
+
+// listenTCP listens on the network address with the ListenConfig and
+// TCPOptions, ignoring the UnderlyingProtocol.
+func (c *Config) listenTCP(ctx context.Context, network, address string) (net.Listener, error) {
+	lc := c.ListenConfig
+	if control := lc.Control; control != nil && c.TCPOptions != nil {
+		lc.Control = func(network, address string, rawConn syscall.RawConn) error {
+			if err := control(network, address, rawConn); err != nil {
+				return err
+			}
+			return c.TCPOptions.Control(network, address, rawConn)
+		}
+	} else if c.TCPOptions != nil {
+		lc.Control = c.TCPOptions.Control
+	}
+
+	return lc.Listen(ctx, network, address)
+}
+
 func (c *Config) Logger() *log.Logger {
 	if c.OverrideLogger != nil {
 		return c.OverrideLogger
@@ -179,6 +882,10 @@ func (c *Config) Logger() *log.Logger {
 }
 
 // UnmarshalJSON implements the json.Unmarshaler interface.
+//
+// It does no network I/O: the transport module binary is not downloaded
+// from its URL, which fails unless the TransportModuleBin is already set.
+// Use LoadConfigContext instead to download it.
 func (c *Config) UnmarshalJSON(data []byte) error {
 	var confJson configbuilder.ConfigJSON
 
@@ -187,20 +894,108 @@ func (c *Config) UnmarshalJSON(data []byte) error {
 		return err
 	}
 
+	if c.TransportModuleBin == nil && len(confJson.TransportModule.BinPath) == 0 && len(confJson.TransportModule.URL) > 0 {
+		return errors.New("water: transport module url is not downloaded by UnmarshalJSON, use LoadConfigContext")
+	}
+
+	return c.fromConfigJSON(context.Background(), &confJson, "")
+}
+
+// fromConfigJSON populates c from confJson, resolving relative paths
+// against baseDir and downloading the transport module binary with ctx.
+func (c *Config) fromConfigJSON(ctx context.Context, confJson *configbuilder.ConfigJSON, baseDir string) (err error) {
 	// Load TMBin if not already set
 	if c.TransportModuleBin == nil {
-		tmBin, err := os.ReadFile(confJson.TransportModule.BinPath)
+		if len(confJson.TransportModule.BinPath) == 0 && len(confJson.TransportModule.URL) > 0 && len(confJson.TransportModule.SHA256) == 0 {
+			return ErrTransportModuleUnpinned
+		}
+
+		c.TransportModuleBin, err = loadTransportModuleBin(ctx, confJson.TransportModule.BinPath, confJson.TransportModule.URL, baseDir)
 		if err != nil {
 			return err
 		}
-		c.TransportModuleBin = tmBin
+	}
+
+	if len(confJson.TransportModule.SHA256) > 0 {
+		if err := verifyTransportModuleBin(c.TransportModuleBin, confJson.TransportModule.SHA256); err != nil {
+			return err
+		}
 	}
 
 	// Load TMConfig if not already set
-	if c.TransportModuleConfig == nil && len(confJson.TransportModule.ConfigPath) > 0 {
-		c.TransportModuleConfig, err = TransportModuleConfigFromFile(confJson.TransportModule.ConfigPath)
+	if c.TransportModuleConfig == nil {
+		if len(confJson.TransportModule.ConfigPath) > 0 {
+			c.TransportModuleConfig, err = TransportModuleConfigFromFile(resolvePath(baseDir, confJson.TransportModule.ConfigPath))
+			if err != nil {
+				return err
+			}
+		} else if len(confJson.TransportModule.ConfigInline) > 0 {
+			c.TransportModuleConfig = TransportModuleConfigFromBytes(confJson.TransportModule.ConfigInline)
+		}
+	}
+
+	if len(confJson.Network.Failover.Addresses) > 0 {
+		c.Failover = &Failover{Addresses: confJson.Network.Failover.Addresses}
+		switch confJson.Network.Failover.Mode {
+		case "", "in_order":
+		case "round_robin":
+			c.Failover.Mode = FailoverRoundRobin
+		default:
+			return fmt.Errorf("water: unknown failover mode %q", confJson.Network.Failover.Mode)
+		}
+	}
+
+	if allowlist := confJson.Network.DialAllowlist; len(allowlist.Prefixes) > 0 || len(allowlist.Hostnames) > 0 {
+		c.DialAllowlist = &DialAllowlist{Hostnames: allowlist.Hostnames}
+		for _, prefix := range allowlist.Prefixes {
+			p, err := netip.ParsePrefix(prefix)
+			if err != nil {
+				return fmt.Errorf("water: parsing dial_allowlist: %w", err)
+			}
+			c.DialAllowlist.Prefixes = append(c.DialAllowlist.Prefixes, p)
+		}
+	}
+
+	c.ProxyProtocol = ProxyProtocolVersion(confJson.Network.ProxyProtocol)
+
+	if len(confJson.Limits.InstantiationTimeout) > 0 {
+		c.InstantiationTimeout, err = time.ParseDuration(confJson.Limits.InstantiationTimeout)
 		if err != nil {
-			return err
+			return fmt.Errorf("water: parsing instantiation_timeout: %w", err)
+		}
+	}
+
+	if len(confJson.Limits.HandshakeTimeout) > 0 {
+		c.HandshakeTimeout, err = time.ParseDuration(confJson.Limits.HandshakeTimeout)
+		if err != nil {
+			return fmt.Errorf("water: parsing handshake_timeout: %w", err)
+		}
+	}
+	c.HandshakeConcurrency = confJson.Limits.HandshakeConcurrency
+
+	if confJson.Limits.ExecutionPoolSize > 0 {
+		c.ExecutionPool = NewExecutionPool(confJson.Limits.ExecutionPoolSize)
+	}
+
+	if confJson.Limits.WorkerPoolSize > 0 {
+		c.WorkerPool = NewWorkerPool(confJson.Limits.WorkerPoolSize)
+	}
+
+	if confJson.Limits.ReadRate > 0 {
+		c.ReadLimiter = &RateLimiter{BytesPerSecond: confJson.Limits.ReadRate}
+	}
+	if confJson.Limits.WriteRate > 0 {
+		c.WriteLimiter = &RateLimiter{BytesPerSecond: confJson.Limits.WriteRate}
+	}
+	c.ConnReadLimit, c.ConnWriteLimit = confJson.Limits.ConnReadRate, confJson.Limits.ConnWriteRate
+	c.MaxOutboundConns = confJson.Limits.MaxOutboundConns
+
+	if limit := confJson.Limits.AcceptRateLimit; limit.Rate > 0 || limit.PerIPRate > 0 {
+		c.AcceptRateLimit = &AcceptRateLimit{
+			Rate:       limit.Rate,
+			Burst:      limit.Burst,
+			PerIPRate:  limit.PerIPRate,
+			PerIPBurst: limit.PerIPBurst,
 		}
 	}
 
@@ -215,7 +1010,7 @@ func (c *Config) UnmarshalJSON(data []byte) error {
 	}
 
 	if len(confJson.Network.Listener.Network) > 0 && len(confJson.Network.Listener.Address) > 0 {
-		c.NetworkListener, err = net.Listen(confJson.Network.Listener.Network, confJson.Network.Listener.Address)
+		c.NetworkListener, err = c.ListenNetwork(context.Background(), confJson.Network.Listener.Network, confJson.Network.Listener.Address)
 		if err != nil {
 			return err
 		}
@@ -252,6 +1047,21 @@ func (c *Config) UnmarshalJSON(data []byte) error {
 		c.ModuleConfigFactory.SetPreopenDir(k, v)
 	}
 
+	// Explicitly configured capabilities are granted unless a WASIPolicy is already set
+	if c.WASIPolicy == nil && confJson.WASIPolicy != nil {
+		c.WASIPolicy = &WASIPolicy{
+			Clock:    confJson.WASIPolicy.Clock,
+			Random:   confJson.WASIPolicy.Random,
+			Environ:  confJson.WASIPolicy.Environ,
+			Preopens: confJson.WASIPolicy.Preopens,
+			Network:  confJson.WASIPolicy.Network,
+		}
+	} else if c.WASIPolicy == nil {
+		c.WASIPolicy = DefaultWASIPolicy.Clone()
+		c.WASIPolicy.Environ = len(confJson.Module.Argv) > 0 || len(confJson.Module.Env) > 0
+		c.WASIPolicy.Preopens = len(confJson.Module.PreopenedDirs) > 0
+	}
+
 	c.RuntimeConfigFactory = NewWazeroRuntimeConfigFactory()
 	if confJson.Runtime.ForceInterpreter {
 		c.RuntimeConfig().Interpreter()
@@ -261,6 +1071,18 @@ func (c *Config) UnmarshalJSON(data []byte) error {
 		c.RuntimeConfig().SetCloseOnContextDone(false)
 	}
 
+	strategy, err := ParseRuntimeStrategy(confJson.Runtime.Strategy)
+	if err != nil {
+		return err
+	}
+	if strategy != RuntimeStrategyAuto || confJson.Runtime.MemoryLimitPages > 0 || confJson.Runtime.StaticMemory {
+		c.RuntimeOptions = &RuntimeOptions{
+			Strategy:         strategy,
+			MemoryLimitPages: confJson.Runtime.MemoryLimitPages,
+			StaticMemory:     confJson.Runtime.StaticMemory,
+		}
+	}
+
 	return nil
 }
 
@@ -319,7 +1141,7 @@ func (c *Config) UnmarshalProto(b []byte) error {
 	// Parse NetworkListener
 	listenerNetwork, listenerAddress := confProto.GetNetwork().GetListener().GetNetwork(), confProto.GetNetwork().GetListener().GetAddress()
 	if len(listenerNetwork) > 0 && len(listenerAddress) > 0 {
-		c.NetworkListener, err = net.Listen(listenerNetwork, listenerAddress)
+		c.NetworkListener, err = c.ListenNetwork(context.Background(), listenerNetwork, listenerAddress)
 		if err != nil {
 			return err
 		}
@@ -357,6 +1179,13 @@ func (c *Config) UnmarshalProto(b []byte) error {
 		c.ModuleConfigFactory.SetPreopenDir(k, v)
 	}
 
+	// Explicitly configured capabilities are granted unless a WASIPolicy is already set
+	if c.WASIPolicy == nil {
+		c.WASIPolicy = DefaultWASIPolicy.Clone()
+		c.WASIPolicy.Environ = len(confProto.GetModule().GetArgv()) > 0 || len(confProto.GetModule().GetEnv()) > 0
+		c.WASIPolicy.Preopens = len(confProto.GetModule().GetPreopenedDirs()) > 0
+	}
+
 	if confProto.GetRuntime().GetForceInterpreter() {
 		c.RuntimeConfig().Interpreter()
 	}
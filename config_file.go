@@ -0,0 +1,248 @@
+package water
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/refraction-networking/water/configbuilder"
+)
+
+var (
+	// ErrUnsupportedConfigFormat is returned by LoadConfig if the format of
+	// the config file, told by its extension, is not supported. Only JSON
+	// (.json) and Protobuf (.pb, .binpb) are supported. YAML and TOML are
+	// not, but such files may be converted to JSON with any standard tool.
+	ErrUnsupportedConfigFormat = errors.New("water: unsupported config file format")
+
+	// ErrTransportModuleHashMismatch is returned when loading a config whose
+	// transport module binary does not match the SHA-256 digest specified.
+	ErrTransportModuleHashMismatch = errors.New("water: transport module binary does not match sha256")
+
+	// ErrTransportModuleUnpinned is returned when loading a config whose
+	// transport module binary is to be downloaded from a URL without the
+	// SHA-256 digest it must match.
+	ErrTransportModuleUnpinned = errors.New("water: transport module url requires sha256")
+)
+
+const (
+	// maxTransportModuleSize caps the size of a transport module binary
+	// downloaded from a URL specified in a config file.
+	maxTransportModuleSize = 64 << 20 // 64 MiB
+
+	// transportModuleDownloadTimeout bounds the download of a transport
+	// module binary, along with the context given to LoadConfigContext.
+	transportModuleDownloadTimeout = time.Minute
+)
+
+var transportModuleHTTPClient = &http.Client{Timeout: transportModuleDownloadTimeout}
+
+// LoadConfig loads a Config from the config file at path, so that a
+// deployment could be described without writing Go. The format is told by
+// the extension of the file, see ErrUnsupportedConfigFormat.
+//
+// In a JSON config file, paths to the transport module binary and to its
+// config file are relative to the directory of the config file. The
+// binary could also be downloaded from a URL, in which case it must be
+// pinned with its SHA-256 digest, see ErrTransportModuleUnpinned. See
+// configbuilder.ConfigJSON for the format.
+//
+// LoadConfig is equivalent to LoadConfigContext with context.Background.
+func LoadConfig(path string) (*Config, error) {
+	return LoadConfigContext(context.Background(), path)
+}
+
+// LoadConfigContext is like LoadConfig, downloading the transport module
+// binary from its URL, if any, with ctx. The download is bounded by a
+// timeout of one minute as well.
+func LoadConfigContext(ctx context.Context, path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Config{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		var confJson configbuilder.ConfigJSON
+		if err := json.Unmarshal(data, &confJson); err != nil {
+			return nil, fmt.Errorf("water: parsing %s: %w", path, err)
+		}
+		if err := c.fromConfigJSON(ctx, &confJson, filepath.Dir(path)); err != nil {
+			return nil, err
+		}
+	case ".pb", ".binpb":
+		if err := c.UnmarshalProto(data); err != nil {
+			return nil, fmt.Errorf("water: parsing %s: %w", path, err)
+		}
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedConfigFormat, filepath.Ext(path))
+	}
+
+	return c, nil
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+//
+// The transport module binary is referenced by its SHA-256 digest only,
+// so the output is to be completed with its path or URL before being
+// loaded, or unmarshaled into a Config with the TransportModuleBin
+// already set. Fields which cannot be serialized, e.g., funcs such as
+// DialedAddressValidator or the CompilationCache of the
+// RuntimeConfigFactory, are omitted.
+func (c *Config) MarshalJSON() ([]byte, error) {
+	var confJson configbuilder.ConfigJSON
+
+	if len(c.TransportModuleBin) > 0 {
+		digest := sha256.Sum256(c.TransportModuleBin)
+		confJson.TransportModule.SHA256 = hex.EncodeToString(digest[:])
+	}
+
+	if c.TransportModuleConfig != nil {
+		confJson.TransportModule.ConfigInline = c.TransportModuleConfig.AsBytes()
+	}
+
+	if c.NetworkListener != nil {
+		confJson.Network.Listener.Network = c.NetworkListener.Addr().Network()
+		confJson.Network.Listener.Address = c.NetworkListener.Addr().String()
+	}
+
+	if c.Failover != nil {
+		confJson.Network.Failover.Addresses = c.Failover.Addresses
+		if c.Failover.Mode == FailoverRoundRobin {
+			confJson.Network.Failover.Mode = "round_robin"
+		}
+	}
+
+	if c.DialAllowlist != nil {
+		for _, prefix := range c.DialAllowlist.Prefixes {
+			confJson.Network.DialAllowlist.Prefixes = append(confJson.Network.DialAllowlist.Prefixes, prefix.String())
+		}
+		confJson.Network.DialAllowlist.Hostnames = c.DialAllowlist.Hostnames
+	}
+
+	confJson.Network.ProxyProtocol = uint8(c.ProxyProtocol)
+
+	// the policy in effect is always written, so that it is not widened
+	// by the capabilities implied by the module section once unmarshaled
+	policy := c.WASIPolicyOrDefault()
+	confJson.WASIPolicy = &configbuilder.WASIPolicyJSON{
+		Clock:    policy.Clock,
+		Random:   policy.Random,
+		Environ:  policy.Environ,
+		Preopens: policy.Preopens,
+		Network:  policy.Network,
+	}
+
+	if c.ModuleConfigFactory != nil {
+		confJson.Module.Argv = c.ModuleConfigFactory.argv
+		if len(c.ModuleConfigFactory.envKeys) > 0 {
+			confJson.Module.Env = make(map[string]string, len(c.ModuleConfigFactory.envKeys))
+			for i, k := range c.ModuleConfigFactory.envKeys {
+				confJson.Module.Env[k] = c.ModuleConfigFactory.envValues[i]
+			}
+		}
+	}
+
+	if c.InstantiationTimeout > 0 {
+		confJson.Limits.InstantiationTimeout = c.InstantiationTimeout.String()
+	}
+	if c.HandshakeTimeout > 0 {
+		confJson.Limits.HandshakeTimeout = c.HandshakeTimeout.String()
+	}
+	confJson.Limits.HandshakeConcurrency = c.HandshakeConcurrency
+	confJson.Limits.ExecutionPoolSize = c.ExecutionPool.Size()
+	confJson.Limits.WorkerPoolSize = c.WorkerPool.Size()
+	if l, ok := c.ReadLimiter.(*RateLimiter); ok {
+		confJson.Limits.ReadRate = l.BytesPerSecond
+	}
+	if l, ok := c.WriteLimiter.(*RateLimiter); ok {
+		confJson.Limits.WriteRate = l.BytesPerSecond
+	}
+	confJson.Limits.ConnReadRate, confJson.Limits.ConnWriteRate = c.ConnReadLimit, c.ConnWriteLimit
+	if c.AcceptRateLimit != nil {
+		confJson.Limits.AcceptRateLimit.Rate = c.AcceptRateLimit.Rate
+		confJson.Limits.AcceptRateLimit.Burst = c.AcceptRateLimit.Burst
+		confJson.Limits.AcceptRateLimit.PerIPRate = c.AcceptRateLimit.PerIPRate
+		confJson.Limits.AcceptRateLimit.PerIPBurst = c.AcceptRateLimit.PerIPBurst
+	}
+	confJson.Limits.MaxOutboundConns = c.MaxOutboundConns
+
+	if c.RuntimeConfigFactory != nil {
+		confJson.Runtime.ForceInterpreter = c.RuntimeConfigFactory.interpreter
+		confJson.Runtime.DoNotCloseOnContextDone = !c.RuntimeConfigFactory.closeOnContextDone
+	}
+	if c.RuntimeOptions != nil {
+		confJson.Runtime.Strategy = c.RuntimeOptions.Strategy.String()
+		confJson.Runtime.MemoryLimitPages = c.RuntimeOptions.MemoryLimitPages
+		confJson.Runtime.StaticMemory = c.RuntimeOptions.StaticMemory
+	}
+
+	return json.Marshal(&confJson)
+}
+
+// loadTransportModuleBin reads the transport module binary from binPath,
+// relative to baseDir, or downloads it from url with ctx if binPath is
+// empty.
+func loadTransportModuleBin(ctx context.Context, binPath, url, baseDir string) ([]byte, error) {
+	if len(binPath) > 0 {
+		return os.ReadFile(resolvePath(baseDir, binPath))
+	}
+
+	if len(url) == 0 {
+		return nil, errors.New("water: transport module binary is not provided in config")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("water: downloading transport module: %w", err)
+	}
+	resp, err := transportModuleHTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("water: downloading transport module: %w", err)
+	}
+	defer resp.Body.Close() // skipcq: GO-S2307
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("water: downloading transport module: %s", resp.Status)
+	}
+
+	bin, err := io.ReadAll(io.LimitReader(resp.Body, maxTransportModuleSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("water: downloading transport module: %w", err)
+	}
+	if len(bin) > maxTransportModuleSize {
+		return nil, fmt.Errorf("water: downloading transport module: larger than %d bytes", maxTransportModuleSize)
+	}
+
+	return bin, nil
+}
+
+func verifyTransportModuleBin(bin []byte, hexDigest string) error {
+	want, err := hex.DecodeString(hexDigest)
+	if err != nil {
+		return fmt.Errorf("water: parsing sha256: %w", err)
+	}
+
+	if got := sha256.Sum256(bin); string(got[:]) != string(want) {
+		return fmt.Errorf("%w: got %x", ErrTransportModuleHashMismatch, got)
+	}
+
+	return nil
+}
+
+func resolvePath(baseDir, path string) string {
+	if baseDir == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(baseDir, path)
+}
@@ -0,0 +1,306 @@
+package water_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/refraction-networking/water"
+)
+
+func sha256Hex(b []byte) string {
+	digest := sha256.Sum256(b)
+	return hex.EncodeToString(digest[:])
+}
+
+func writeConfigFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	writeConfigFile(t, dir, "plain.wasm", string(wasmPlain))
+	writeConfigFile(t, dir, "watm.cfg", "foo")
+
+	t.Run("relative paths", func(t *testing.T) {
+		path := writeConfigFile(t, dir, "config.json", fmt.Sprintf(`{
+			"transport_module": {"bin": "plain.wasm", "sha256": %q, "config": "watm.cfg"},
+			"network": {
+				"failover": {"addresses": ["backup:443"], "mode": "round_robin"},
+				"dial_allowlist": {"prefixes": ["192.0.2.0/24"], "hostnames": ["*.example.com"]},
+				"proxy_protocol": 2
+			},
+			"limits": {
+				"instantiation_timeout": "5s",
+				"handshake_timeout": "10s",
+				"handshake_concurrency": 8,
+				"execution_pool_size": 4,
+				"worker_pool_size": 1024,
+				"accept_rate_limit": {"rate": 100, "burst": 10, "per_ip_rate": 1},
+				"read_rate": 1048576,
+				"conn_write_rate": 65536
+			},
+			"runtime": {
+				"strategy": "interpreter",
+				"memory_limit_pages": 256
+			}
+		}`, sha256Hex(wasmPlain)))
+
+		config, err := water.LoadConfig(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(config.TransportModuleBin, wasmPlain) {
+			t.Error("TransportModuleBin does not match plain.wasm")
+		}
+		if got := string(config.TransportModuleConfig.AsBytes()); got != "foo" {
+			t.Errorf("TransportModuleConfig = %q, want %q", got, "foo")
+		}
+		if want := (&water.Failover{Addresses: []string{"backup:443"}, Mode: water.FailoverRoundRobin}); !reflect.DeepEqual(config.Failover, want) {
+			t.Errorf("Failover = %+v, want %+v", config.Failover, want)
+		}
+		if want := (&water.DialAllowlist{Prefixes: []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")}, Hostnames: []string{"*.example.com"}}); !reflect.DeepEqual(config.DialAllowlist, want) {
+			t.Errorf("DialAllowlist = %+v, want %+v", config.DialAllowlist, want)
+		}
+		if config.ProxyProtocol != water.ProxyProtocolV2 {
+			t.Errorf("ProxyProtocol = %v, want %v", config.ProxyProtocol, water.ProxyProtocolV2)
+		}
+		if config.InstantiationTimeout != 5*time.Second {
+			t.Errorf("InstantiationTimeout = %v, want 5s", config.InstantiationTimeout)
+		}
+		if config.HandshakeTimeout != 10*time.Second || config.HandshakeConcurrency != 8 {
+			t.Errorf("HandshakeTimeout, HandshakeConcurrency = %v, %d, want 10s, 8", config.HandshakeTimeout, config.HandshakeConcurrency)
+		}
+		if config.ExecutionPool.Size() != 4 {
+			t.Errorf("ExecutionPool.Size() = %d, want 4", config.ExecutionPool.Size())
+		}
+		if config.WorkerPool.Size() != 1024 {
+			t.Errorf("WorkerPool.Size() = %d, want 1024", config.WorkerPool.Size())
+		}
+		if want := (&water.AcceptRateLimit{Rate: 100, Burst: 10, PerIPRate: 1}); !reflect.DeepEqual(config.AcceptRateLimit, want) {
+			t.Errorf("AcceptRateLimit = %+v, want %+v", config.AcceptRateLimit, want)
+		}
+		if want := (&water.RateLimiter{BytesPerSecond: 1 << 20}); !reflect.DeepEqual(config.ReadLimiter, want) || config.WriteLimiter != nil {
+			t.Errorf("ReadLimiter, WriteLimiter = %+v, %+v, want %+v, nil", config.ReadLimiter, config.WriteLimiter, want)
+		}
+		if config.ConnReadLimit != 0 || config.ConnWriteLimit != 65536 {
+			t.Errorf("ConnReadLimit, ConnWriteLimit = %d, %d, want 0, 65536", config.ConnReadLimit, config.ConnWriteLimit)
+		}
+		if want := (&water.RuntimeOptions{Strategy: water.RuntimeStrategyInterpreter, MemoryLimitPages: 256}); !reflect.DeepEqual(config.RuntimeOptions, want) {
+			t.Errorf("RuntimeOptions = %+v, want %+v", config.RuntimeOptions, want)
+		}
+	})
+
+	t.Run("url", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = w.Write(wasmPlain)
+		}))
+		defer server.Close()
+
+		path := writeConfigFile(t, dir, "url.json", fmt.Sprintf(`{
+			"transport_module": {"url": %q, "sha256": %q}
+		}`, server.URL, sha256Hex(wasmPlain)))
+
+		config, err := water.LoadConfig(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(config.TransportModuleBin, wasmPlain) {
+			t.Error("TransportModuleBin does not match plain.wasm")
+		}
+	})
+
+	t.Run("url without sha256", func(t *testing.T) {
+		path := writeConfigFile(t, dir, "unpinned.json", `{
+			"transport_module": {"url": "http://127.0.0.1:1/plain.wasm"}
+		}`)
+
+		if _, err := water.LoadConfig(path); !errors.Is(err, water.ErrTransportModuleUnpinned) {
+			t.Errorf("LoadConfig() error = %v, want %v", err, water.ErrTransportModuleUnpinned)
+		}
+	})
+
+	t.Run("url canceled", func(t *testing.T) {
+		stalled := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+			<-stalled
+		}))
+		defer server.Close()
+		defer close(stalled)
+
+		path := writeConfigFile(t, dir, "stalled.json", fmt.Sprintf(`{
+			"transport_module": {"url": %q, "sha256": %q}
+		}`, server.URL, sha256Hex(wasmPlain)))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		if _, err := water.LoadConfigContext(ctx, path); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("LoadConfigContext() error = %v, want %v", err, context.DeadlineExceeded)
+		}
+	})
+
+	t.Run("url unmarshaled", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+			t.Error("UnmarshalJSON must not download the transport module")
+		}))
+		defer server.Close()
+
+		data := fmt.Sprintf(`{"transport_module": {"url": %q, "sha256": %q}}`, server.URL, sha256Hex(wasmPlain))
+		if err := json.Unmarshal([]byte(data), &water.Config{}); err == nil {
+			t.Error("Unmarshal() must fail without the TransportModuleBin")
+		}
+	})
+
+	t.Run("hash mismatch", func(t *testing.T) {
+		path := writeConfigFile(t, dir, "mismatch.json", fmt.Sprintf(`{
+			"transport_module": {"bin": "plain.wasm", "sha256": %q}
+		}`, sha256Hex(wasmReverse)))
+
+		if _, err := water.LoadConfig(path); !errors.Is(err, water.ErrTransportModuleHashMismatch) {
+			t.Errorf("LoadConfig() error = %v, want %v", err, water.ErrTransportModuleHashMismatch)
+		}
+	})
+
+	t.Run("unsupported format", func(t *testing.T) {
+		path := writeConfigFile(t, dir, "config.yaml", "transport_module: {}")
+
+		if _, err := water.LoadConfig(path); !errors.Is(err, water.ErrUnsupportedConfigFormat) {
+			t.Errorf("LoadConfig() error = %v, want %v", err, water.ErrUnsupportedConfigFormat)
+		}
+	})
+}
+
+func TestConfig_MarshalJSON(t *testing.T) {
+	config := &water.Config{
+		TransportModuleBin:    wasmPlain,
+		TransportModuleConfig: water.TransportModuleConfigFromBytes([]byte("foo")),
+		Failover:              &water.Failover{Addresses: []string{"backup:443"}},
+		DialAllowlist:         &water.DialAllowlist{Prefixes: []netip.Prefix{netip.MustParsePrefix("2001:db8::/32")}, Hostnames: []string{"bridge.example.com"}},
+		ProxyProtocol:         water.ProxyProtocolV2,
+		InstantiationTimeout:  5 * time.Second,
+		HandshakeTimeout:      10 * time.Second,
+		HandshakeConcurrency:  8,
+		ExecutionPool:         water.NewExecutionPool(4),
+		WorkerPool:            water.NewWorkerPool(64),
+		AcceptRateLimit:       &water.AcceptRateLimit{PerIPRate: 0.5, PerIPBurst: 2},
+		WriteLimiter:          &water.RateLimiter{BytesPerSecond: 1 << 20},
+		ConnReadLimit:         64 << 10,
+		MaxOutboundConns:      2,
+		WASIPolicy:            &water.WASIPolicy{Random: true},
+		RuntimeOptions:        &water.RuntimeOptions{Strategy: water.RuntimeStrategyInterpreter, MemoryLimitPages: 256},
+		RuntimeConfigFactory:  water.NewWazeroRuntimeConfigFactory(),
+	}
+	config.RuntimeConfigFactory.Interpreter()
+	config.RuntimeConfigFactory.SetCloseOnContextDone(false)
+
+	data, err := json.Marshal(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the binary is only referenced by its digest, which must match
+	unmarshaled := &water.Config{TransportModuleBin: wasmPlain}
+	if err := json.Unmarshal(data, unmarshaled); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := string(unmarshaled.TransportModuleConfig.AsBytes()); got != "foo" {
+		t.Errorf("TransportModuleConfig = %q, want %q", got, "foo")
+	}
+	if !reflect.DeepEqual(unmarshaled.Failover, config.Failover) {
+		t.Errorf("Failover = %+v, want %+v", unmarshaled.Failover, config.Failover)
+	}
+	if !reflect.DeepEqual(unmarshaled.DialAllowlist, config.DialAllowlist) {
+		t.Errorf("DialAllowlist = %+v, want %+v", unmarshaled.DialAllowlist, config.DialAllowlist)
+	}
+	if unmarshaled.ProxyProtocol != config.ProxyProtocol {
+		t.Errorf("ProxyProtocol = %v, want %v", unmarshaled.ProxyProtocol, config.ProxyProtocol)
+	}
+	if unmarshaled.InstantiationTimeout != config.InstantiationTimeout {
+		t.Errorf("InstantiationTimeout = %v, want %v", unmarshaled.InstantiationTimeout, config.InstantiationTimeout)
+	}
+	if unmarshaled.HandshakeTimeout != config.HandshakeTimeout || unmarshaled.HandshakeConcurrency != config.HandshakeConcurrency {
+		t.Errorf("HandshakeTimeout, HandshakeConcurrency = %v, %d, want %v, %d", unmarshaled.HandshakeTimeout, unmarshaled.HandshakeConcurrency, config.HandshakeTimeout, config.HandshakeConcurrency)
+	}
+	if unmarshaled.ExecutionPool.Size() != config.ExecutionPool.Size() {
+		t.Errorf("ExecutionPool.Size() = %d, want %d", unmarshaled.ExecutionPool.Size(), config.ExecutionPool.Size())
+	}
+	if unmarshaled.WorkerPool.Size() != config.WorkerPool.Size() {
+		t.Errorf("WorkerPool.Size() = %d, want %d", unmarshaled.WorkerPool.Size(), config.WorkerPool.Size())
+	}
+	if !reflect.DeepEqual(unmarshaled.WriteLimiter, config.WriteLimiter) {
+		t.Errorf("WriteLimiter = %+v, want %+v", unmarshaled.WriteLimiter, config.WriteLimiter)
+	}
+	if unmarshaled.ConnReadLimit != config.ConnReadLimit {
+		t.Errorf("ConnReadLimit = %d, want %d", unmarshaled.ConnReadLimit, config.ConnReadLimit)
+	}
+	if !reflect.DeepEqual(unmarshaled.AcceptRateLimit, config.AcceptRateLimit) {
+		t.Errorf("AcceptRateLimit = %+v, want %+v", unmarshaled.AcceptRateLimit, config.AcceptRateLimit)
+	}
+
+	if unmarshaled.MaxOutboundConns != config.MaxOutboundConns {
+		t.Errorf("MaxOutboundConns = %d, want %d", unmarshaled.MaxOutboundConns, config.MaxOutboundConns)
+	}
+	if !reflect.DeepEqual(unmarshaled.WASIPolicy, config.WASIPolicy) {
+		t.Errorf("WASIPolicy = %+v, want %+v", unmarshaled.WASIPolicy, config.WASIPolicy)
+	}
+	if !reflect.DeepEqual(unmarshaled.RuntimeOptions, config.RuntimeOptions) {
+		t.Errorf("RuntimeOptions = %+v, want %+v", unmarshaled.RuntimeOptions, config.RuntimeOptions)
+	}
+
+	// the runtime section is marshaled as it was unmarshaled
+	remarshaled, err := json.Marshal(unmarshaled)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(remarshaled, data) {
+		t.Errorf("marshaled again:\n%s\nwant:\n%s", remarshaled, data)
+	}
+
+	if err := json.Unmarshal(data, &water.Config{TransportModuleBin: wasmReverse}); !errors.Is(err, water.ErrTransportModuleHashMismatch) {
+		t.Errorf("Unmarshal() error = %v, want %v", err, water.ErrTransportModuleHashMismatch)
+	}
+}
+
+func TestConfig_MarshalJSON_WASIPolicy(t *testing.T) {
+	// the environment set is still granted once unmarshaled, as it is
+	// explicitly configured and thus granted by the policy in effect
+	config := &water.Config{
+		TransportModuleBin:  wasmPlain,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+	}
+	config.ModuleConfigFactory.SetEnv([]string{"KEY"}, []string{"value"})
+
+	data, err := json.Marshal(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unmarshaled := &water.Config{TransportModuleBin: wasmPlain}
+	if err := json.Unmarshal(data, unmarshaled); err != nil {
+		t.Fatal(err)
+	}
+	want := water.DefaultWASIPolicy
+	want.Environ = true
+	if !reflect.DeepEqual(unmarshaled.WASIPolicy, &want) {
+		t.Errorf("WASIPolicy = %+v, want %+v", unmarshaled.WASIPolicy, want)
+	}
+}
@@ -0,0 +1,43 @@
+package water_test
+
+import (
+	"context"
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/refraction-networking/water"
+)
+
+// soReusePort is SO_REUSEPORT on Linux, which package syscall lacks.
+const soReusePort = 0xf
+
+func TestConfig_ListenNetwork(t *testing.T) {
+	config := &water.Config{
+		ListenConfig: net.ListenConfig{
+			Control: func(_, _ string, c syscall.RawConn) error {
+				var sockErr error
+				if err := c.Control(func(fd uintptr) {
+					sockErr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, soReusePort, 1)
+				}); err != nil {
+					return err
+				}
+				return sockErr
+			},
+		},
+		TCPOptions: &water.TCPOptions{},
+	}
+
+	lis, err := config.ListenNetwork(context.Background(), "tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close() // skipcq: GO-S2307
+
+	// with SO_REUSEPORT, another listener may share the same port
+	lis2, err := config.ListenNetwork(context.Background(), "tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatalf("ListenNetwork() on the same port error = %v", err)
+	}
+	defer lis2.Close() // skipcq: GO-S2307
+}
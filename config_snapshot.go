@@ -0,0 +1,88 @@
+package water
+
+import (
+	"errors"
+	"reflect"
+	"slices"
+)
+
+// ErrConfigMutated is returned when a Config is used again, e.g., to
+// create another Dialer, after being modified since it was first used.
+//
+// A Dialer, Listener or Relay keeps its own copy of the Config it is
+// created from, so a modification of the Config afterwards never reaches
+// it but only the ones created later, which is easily mistaken for a bug,
+// or races with the creation of another from a different goroutine. To
+// derive a Config from one in use, modify its Clone instead.
+var ErrConfigMutated = errors.New("water: Config modified after being used, modify its Clone instead")
+
+// configFingerprint identifies the values of the fields of a Config.
+type configFingerprint []any
+
+// snapshot returns a copy of the Config for a Dialer, Listener or Relay
+// to keep. The Config is then recorded as used, and once it is modified,
+// any later call to snapshot fails with ErrConfigMutated.
+//
+// Only the fields of the Config themselves are compared, not the values
+// they point to, e.g., replacing the ModuleEnv is detected but modifying
+// one of its entries is not.
+func (c *Config) snapshot() (*Config, error) {
+	fingerprint := c.fingerprint()
+	if !c.used.CompareAndSwap(nil, &fingerprint) && !slices.Equal(*c.used.Load(), fingerprint) {
+		return nil, ErrConfigMutated
+	}
+	return c.Clone(), nil
+}
+
+// fingerprint returns the configFingerprint of the Config as of now.
+func (c *Config) fingerprint() configFingerprint {
+	var fingerprint configFingerprint
+	v := reflect.ValueOf(c).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if v.Type().Field(i).Name == "used" {
+			continue
+		}
+		fingerprint = fingerprint.append(v.Field(i))
+	}
+	return fingerprint
+}
+
+// append appends the identity of v to the configFingerprint, i.e., the
+// value of a scalar, or the address of what a reference points to.
+func (fp configFingerprint) append(v reflect.Value) configFingerprint {
+	switch v.Kind() {
+	case reflect.Bool:
+		return append(fp, v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return append(fp, v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return append(fp, v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return append(fp, v.Float())
+	case reflect.Complex64, reflect.Complex128:
+		return append(fp, v.Complex())
+	case reflect.String:
+		return append(fp, v.String())
+	case reflect.Slice, reflect.Map:
+		return append(fp, v.Pointer(), v.Len())
+	case reflect.Pointer, reflect.Func, reflect.Chan, reflect.UnsafePointer:
+		return append(fp, v.Pointer())
+	case reflect.Interface:
+		if v.IsNil() {
+			return append(fp, nil)
+		}
+		return append(fp, v.Elem().Type()).append(v.Elem())
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			fp = fp.append(v.Index(i))
+		}
+		return fp
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			fp = fp.append(v.Field(i))
+		}
+		return fp
+	default:
+		return append(fp, v.Kind())
+	}
+}
@@ -0,0 +1,72 @@
+package water_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/refraction-networking/water"
+	"github.com/refraction-networking/water/internal/driver"
+	_ "github.com/refraction-networking/water/transport/v1"
+)
+
+func TestConfig_Snapshot(t *testing.T) {
+	config := &water.Config{
+		TransportModuleBin:  wasmPlain,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+		ModuleEnv:           map[string]string{"SNI": "example.com"},
+	}
+
+	// a Config may be used concurrently, as long as it is not modified
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			snapshot, err := driver.Snapshot(config)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if snapshot == config {
+				t.Error("Snapshot() returned the Config itself, want a copy")
+			}
+		}()
+	}
+	wg.Wait()
+
+	if _, err := water.NewDialerWithContext(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+
+	// a Clone of a used Config may be modified and used
+	clone := config.Clone()
+	clone.IdleTimeout = time.Minute
+	if _, err := water.NewDialerWithContext(context.Background(), clone); err != nil {
+		t.Fatal(err)
+	}
+
+	// a used Config must not be modified
+	for _, modify := range []func(*water.Config){
+		func(c *water.Config) { c.IdleTimeout = time.Minute },
+		func(c *water.Config) { c.ModuleEnv = map[string]string{"SNI": "example.org"} },
+		func(c *water.Config) { c.ListenConfig.KeepAlive = time.Second },
+		func(c *water.Config) { c.EntropySource = strings.NewReader("entropy") },
+	} {
+		mutated := config.Clone()
+		if _, err := driver.Snapshot(mutated); err != nil {
+			t.Fatal(err)
+		}
+		modify(mutated)
+
+		if _, err := water.NewDialerWithContext(context.Background(), mutated); !errors.Is(err, water.ErrConfigMutated) {
+			t.Errorf("NewDialerWithContext() with a modified Config returned %v, want ErrConfigMutated", err)
+		}
+		if _, err := mutated.ListenContext(context.Background(), "tcp", "localhost:0"); !errors.Is(err, water.ErrConfigMutated) {
+			t.Errorf("ListenContext() with a modified Config returned %v, want ErrConfigMutated", err)
+		}
+	}
+}
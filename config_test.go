@@ -2,9 +2,13 @@ package water_test
 
 import (
 	"crypto/rand"
+	"crypto/tls"
 	"net"
+	"net/http"
+	"net/netip"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/refraction-networking/water/internal/log"
 
@@ -36,14 +40,85 @@ func testConfigCloneValid(t *testing.T) {
 		switch fn := typ.Field(i).Name; fn {
 		case "TransportModuleBin":
 			f.Set(reflect.ValueOf(make([]byte, 256)))
+		case "TransportModuleCompiled":
+			f.Set(reflect.ValueOf([]byte("WATERCM\x00")))
 		case "TransportModuleConfig":
 			f.Set(reflect.ValueOf(water.TransportModuleConfigFromBytes([]byte("foo"))))
-		case "NetworkDialerFunc", "DialedAddressValidator": // functions aren't deeply equal unless nil
+		case "TransportChain":
+			f.Set(reflect.ValueOf([]water.ModuleConfig{{TransportModuleBin: []byte("bar")}}))
+		case "NetworkDialerFunc", "DialedAddressValidator", "AcceptFilter", "AuthHandler", "AccessLogger", "OnDialStart", "OnUnderlyingConnected", "OnHandshakeComplete", "OnClose", "OnIdleTimeout", "OnModuleCrash", "CrashDumpSink", "Recorder", "PathInfoFunc": // functions aren't deeply equal unless nil
 			continue
+		case "ListenConfig":
+			f.Set(reflect.ValueOf(net.ListenConfig{KeepAlive: time.Second}))
 		case "NetworkListener":
 			f.Set(reflect.ValueOf(&net.TCPListener{}))
-		case "ModuleConfigFactory", "RuntimeConfigFactory":
+		case "ProxyProtocol":
+			f.Set(reflect.ValueOf(water.ProxyProtocolV2))
+		case "ModuleEnv":
+			f.Set(reflect.ValueOf(map[string]string{"SNI": "example.com"}))
+		case "ModuleArgv":
+			f.Set(reflect.ValueOf([]string{"watm", "-v"}))
+		case "ModuleConfigFactory", "RuntimeConfigFactory", "used":
 			continue
+		case "Resolver":
+			f.Set(reflect.ValueOf(&water.Resolver{Network: "ip4"}))
+		case "RemoteAddress":
+			f.Set(reflect.ValueOf("example.com:443"))
+		case "PreferIPv6", "AllowRaw":
+			f.Set(reflect.ValueOf(true))
+		case "Failover":
+			f.Set(reflect.ValueOf(&water.Failover{Addresses: []string{"192.0.2.1:443"}, Mode: water.FailoverRoundRobin}))
+		case "DialRetry":
+			f.Set(reflect.ValueOf(&water.DialRetry{Attempts: 5, Backoff: time.Second, RotateEndpoints: true}))
+		case "AcceptRateLimit":
+			f.Set(reflect.ValueOf(&water.AcceptRateLimit{Rate: 10, PerIPRate: 1}))
+		case "ReadLimiter", "WriteLimiter":
+			f.Set(reflect.ValueOf(&water.RateLimiter{BytesPerSecond: 1 << 20}))
+		case "ConnReadLimit", "ConnWriteLimit":
+			f.Set(reflect.ValueOf(64 << 10))
+		case "DialAllowlist":
+			f.Set(reflect.ValueOf(&water.DialAllowlist{Prefixes: []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")}, Hostnames: []string{"*.example.com"}}))
+		case "UnderlyingProtocol":
+			f.Set(reflect.ValueOf("quic"))
+		case "WebSocketOptions":
+			f.Set(reflect.ValueOf(&water.WebSocketOptions{Host: "example.com", Path: "/ws", Header: http.Header{"Origin": {"https://example.com"}}}))
+		case "UnderlyingTLS":
+			f.Set(reflect.ValueOf(&tls.Config{ServerName: "example.com", MinVersion: tls.VersionTLS13}))
+		case "TCPOptions":
+			noDelay := false
+			f.Set(reflect.ValueOf(&water.TCPOptions{NoDelay: &noDelay, KeepAlivePeriod: time.Second, Mark: 1}))
+		case "ReadBufferSize", "WriteBufferSize":
+			f.Set(reflect.ValueOf(256 << 10))
+		case "WASIPolicy":
+			f.Set(reflect.ValueOf(&water.WASIPolicy{Clock: true, Network: true}))
+		case "InstantiationTimeout", "HandshakeTimeout":
+			f.Set(reflect.ValueOf(time.Second))
+		case "HandshakeConcurrency", "CrashDumpMemoryLimit", "MaxOutboundConns":
+			f.Set(reflect.ValueOf(8))
+		case "Clock":
+			f.Set(reflect.ValueOf(water.CoarseClock(water.SystemClock, time.Millisecond)))
+		case "EntropySource":
+			f.Set(reflect.ValueOf(rand.Reader))
+		case "ExecutionPool":
+			f.Set(reflect.ValueOf(water.NewExecutionPool(2)))
+		case "WorkerPool":
+			f.Set(reflect.ValueOf(water.NewWorkerPool(2)))
+		case "UpstreamPool":
+			f.Set(reflect.ValueOf(water.NewUpstreamPool(2)))
+		case "RuntimeOptions":
+			f.Set(reflect.ValueOf(&water.RuntimeOptions{Strategy: water.RuntimeStrategyInterpreter, MemoryLimitPages: 16, StaticMemory: true}))
+		case "TUN":
+			f.Set(reflect.ValueOf(&water.TUN{Name: "water0"}))
+		case "ProcessIsolation":
+			f.Set(reflect.ValueOf(&water.ProcessIsolation{Path: "/usr/local/bin/watm-host", Args: []string{"-isolated"}}))
+		case "TimeBasedCredential":
+			f.Set(reflect.ValueOf(&water.TimeBasedCredential{Secret: []byte("secret"), Skew: 1}))
+		case "IdleTimeout", "KeepaliveInterval":
+			f.Set(reflect.ValueOf(time.Minute))
+		case "Shaper":
+			f.Set(reflect.ValueOf(&water.RandomShaper{MaxJitter: time.Millisecond}))
+		case "SessionState":
+			f.Set(reflect.ValueOf([]byte("session")))
 		case "OverrideLogger":
 			f.Set(reflect.ValueOf(log.DefaultLogger()))
 		default:
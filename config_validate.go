@@ -0,0 +1,119 @@
+package water
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ValidateForDialer checks whether the Config is able to create a working
+// Dialer, before any network activity. It checks that the required fields
+// are set and valid, and that the WATM, along with each one in the
+// TransportChain, exports what a Dialer needs.
+//
+// All problems found are returned at once, joined with errors.Join, or
+// nil if none is found.
+//
+// Only WATM versions of the drivers imported (e.g., `transport/v1`) are
+// recognized.
+func (c *Config) ValidateForDialer() error {
+	return c.validateFor(RoleDialer)
+}
+
+// ValidateForListener checks whether the Config is able to create a
+// working Listener, like ValidateForDialer does for a Dialer. The
+// NetworkListener is not required, as it may be set by ListenContext.
+func (c *Config) ValidateForListener() error {
+	return c.validateFor(RoleListener)
+}
+
+// ValidateForRelay checks whether the Config is able to create a working
+// Relay, like ValidateForDialer does for a Dialer. The NetworkListener is
+// not required, as it may be set by the ListenAndRelayTo of the Relay.
+func (c *Config) ValidateForRelay() error {
+	return c.validateFor(RoleRelay)
+}
+
+func (c *Config) validateFor(role Role) error {
+	if c == nil {
+		return errors.New("water: config is nil")
+	}
+
+	var errs []error
+
+	if len(c.TransportModuleBin) == 0 {
+		errs = append(errs, errors.New("water: TransportModuleBin is not set"))
+	} else {
+		errs = append(errs, validateModuleFor("TransportModuleBin", c.TransportModuleBin, role)...)
+	}
+
+	// WATMs in the chain dial for a Dialer, and accept for a Listener or
+	// for a Relay, whichever the role of the WATM above is.
+	chainRole := RoleDialer
+	if role != RoleDialer {
+		chainRole = RoleListener
+	}
+	for i, mc := range c.TransportChain {
+		field := fmt.Sprintf("TransportChain[%d]", i)
+		if len(mc.TransportModuleBin) == 0 {
+			errs = append(errs, fmt.Errorf("water: %s: TransportModuleBin is not set", field))
+			continue
+		}
+		errs = append(errs, validateModuleFor(field, mc.TransportModuleBin, chainRole)...)
+	}
+
+	if c.ReadBufferSize < 0 {
+		errs = append(errs, fmt.Errorf("water: ReadBufferSize is negative: %d", c.ReadBufferSize))
+	}
+	if c.WriteBufferSize < 0 {
+		errs = append(errs, fmt.Errorf("water: WriteBufferSize is negative: %d", c.WriteBufferSize))
+	}
+	if c.InstantiationTimeout < 0 {
+		errs = append(errs, fmt.Errorf("water: InstantiationTimeout is negative: %v", c.InstantiationTimeout))
+	}
+	if c.IdleTimeout < 0 {
+		errs = append(errs, fmt.Errorf("water: IdleTimeout is negative: %v", c.IdleTimeout))
+	}
+	if c.KeepaliveInterval < 0 {
+		errs = append(errs, fmt.Errorf("water: KeepaliveInterval is negative: %v", c.KeepaliveInterval))
+	}
+
+	if err := c.RuntimeOptions.validate(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if _, err := c.underlyingProtocol(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if role != RoleDialer && c.UnderlyingTLS != nil &&
+		len(c.UnderlyingTLS.Certificates) == 0 && c.UnderlyingTLS.GetCertificate == nil && c.UnderlyingTLS.GetConfigForClient == nil {
+		errs = append(errs, errors.New("water: UnderlyingTLS has no certificate to accept connections with"))
+	}
+
+	if role == RoleRelay {
+		switch c.ProxyProtocol {
+		case ProxyProtocolDisabled, ProxyProtocolV2:
+		default:
+			errs = append(errs, fmt.Errorf("%w: %v", ErrProxyProtocolUnsupported, c.ProxyProtocol))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// validateModuleFor statically checks that the WATM in bin, set in the
+// given field, conforms to a registered version and is able to play role.
+func validateModuleFor(field string, bin []byte, role Role) (errs []error) {
+	report, err := ValidateTransportModule(bin)
+	if err != nil {
+		return []error{fmt.Errorf("water: %s: %w", field, err)}
+	}
+
+	for _, problem := range report.Problems {
+		errs = append(errs, fmt.Errorf("water: %s: %s", field, problem))
+	}
+	if report.Version != "" && !report.Supports(role) {
+		errs = append(errs, fmt.Errorf("water: %s: WATM %s cannot play the %v role", field, report.Version, role))
+	}
+	return errs
+}
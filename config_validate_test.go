@@ -0,0 +1,57 @@
+package water_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/refraction-networking/water"
+	_ "github.com/refraction-networking/water/transport/v1"
+)
+
+func TestConfig_Validate(t *testing.T) {
+	t.Run("valid config", testConfigValidateValid)
+	t.Run("all problems must be reported", testConfigValidateInvalid)
+}
+
+func testConfigValidateValid(t *testing.T) {
+	config := &water.Config{
+		TransportModuleBin: wasmPlain,
+		TransportChain:     []water.ModuleConfig{{TransportModuleBin: wasmReverse}},
+		ProxyProtocol:      water.ProxyProtocolV2,
+	}
+
+	if err := config.ValidateForDialer(); err != nil {
+		t.Errorf("ValidateForDialer() = %v", err)
+	}
+	if err := config.ValidateForListener(); err != nil {
+		t.Errorf("ValidateForListener() = %v", err)
+	}
+	if err := config.ValidateForRelay(); err != nil {
+		t.Errorf("ValidateForRelay() = %v", err)
+	}
+}
+
+func testConfigValidateInvalid(t *testing.T) {
+	config := &water.Config{
+		TransportChain:  []water.ModuleConfig{{TransportModuleBin: []byte("not a wasm binary")}},
+		ReadBufferSize:  -1,
+		WriteBufferSize: -1,
+		ProxyProtocol:   water.ProxyProtocolVersion(1),
+	}
+
+	err := config.ValidateForDialer()
+	if err == nil {
+		t.Fatal("ValidateForDialer() must fail")
+	}
+	if errs := err.(interface{ Unwrap() []error }).Unwrap(); len(errs) != 4 {
+		t.Errorf("ValidateForDialer() reported %d problems, want 4: %v", len(errs), err)
+	}
+
+	err = config.ValidateForRelay()
+	if !errors.Is(err, water.ErrProxyProtocolUnsupported) {
+		t.Errorf("ValidateForRelay() = %v, want %v", err, water.ErrProxyProtocolUnsupported)
+	}
+	if errs := err.(interface{ Unwrap() []error }).Unwrap(); len(errs) != 5 {
+		t.Errorf("ValidateForRelay() reported %d problems, want 5: %v", len(errs), err)
+	}
+}
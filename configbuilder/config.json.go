@@ -6,8 +6,11 @@ package configbuilder
 // non-trivial to represent a func or other non-serialized structures.
 type ConfigJSON struct {
 	TransportModule struct {
-		BinPath    string `json:"bin"`              // Path to the transport module binary
-		ConfigPath string `json:"config,omitempty"` // Path to the transport module config file
+		BinPath      string `json:"bin,omitempty"`           // Path to the transport module binary
+		URL          string `json:"url,omitempty"`           // URL to download the transport module binary from, if BinPath is not set, requiring SHA256
+		SHA256       string `json:"sha256,omitempty"`        // Hex-encoded SHA-256 digest the transport module binary must match, if set
+		ConfigPath   string `json:"config,omitempty"`        // Path to the transport module config file
+		ConfigInline []byte `json:"config_inline,omitempty"` // Content of the transport module config file, in base64, if ConfigPath is not set
 	} `json:"transport_module"`
 
 	Network struct {
@@ -21,8 +24,37 @@ type ConfigJSON struct {
 			Network string `json:"network"` // e.g. "tcp"
 			Address string `json:"address"` // e.g. "0.0.0.0:0"
 		} `json:"listener,omitempty"`
+		Failover struct {
+			Addresses []string `json:"addresses,omitempty"` // Backup addresses of the remote endpoint
+			Mode      string   `json:"mode,omitempty"`      // "in_order" (default) or "round_robin"
+		} `json:"failover,omitempty"`
+		DialAllowlist struct {
+			Prefixes  []string `json:"prefixes,omitempty"`  // e.g. ["192.0.2.0/24", "2001:db8::1/128"]
+			Hostnames []string `json:"hostnames,omitempty"` // e.g. ["bridge.example.com", "*.example.net"]
+		} `json:"dial_allowlist,omitempty"`
+		ProxyProtocol uint8 `json:"proxy_protocol,omitempty"` // Version of the PROXY protocol header sent by a Relay, 0 to disable
 	} `json:"network,omitempty"`
 
+	Limits struct {
+		InstantiationTimeout string `json:"instantiation_timeout,omitempty"` // e.g. "5s", parsed by time.ParseDuration
+		HandshakeTimeout     string `json:"handshake_timeout,omitempty"`     // e.g. "10s", parsed by time.ParseDuration
+		HandshakeConcurrency int    `json:"handshake_concurrency,omitempty"` // Maximum number of incoming connections handshaken concurrently, off the Accept loop
+		ExecutionPoolSize    int    `json:"execution_pool_size,omitempty"`   // Maximum number of CPU-intensive operations on WebAssembly modules running concurrently
+		WorkerPoolSize       int    `json:"worker_pool_size,omitempty"`      // Maximum number of worker threads of WebAssembly modules running concurrently
+		AcceptRateLimit      struct {
+			Rate       float64 `json:"rate,omitempty"`         // Connections accepted per second from all sources
+			Burst      int     `json:"burst,omitempty"`        // Connections accepted at once from all sources
+			PerIPRate  float64 `json:"per_ip_rate,omitempty"`  // Connections accepted per second from each source IP address
+			PerIPBurst int     `json:"per_ip_burst,omitempty"` // Connections accepted at once from each source IP address
+		} `json:"accept_rate_limit,omitempty"`
+		ReadRate      int `json:"read_rate,omitempty"`       // Bytes per second read from the network by all connections
+		WriteRate     int `json:"write_rate,omitempty"`      // Bytes per second written to the network by all connections
+		ConnReadRate  int `json:"conn_read_rate,omitempty"`  // Bytes per second read from the network by each connection
+		ConnWriteRate int `json:"conn_write_rate,omitempty"` // Bytes per second written to the network by each connection
+
+		MaxOutboundConns int `json:"max_outbound_conns,omitempty"` // Maximum number of connections dialed by each WebAssembly module on its own
+	} `json:"limits,omitempty"`
+
 	Module struct {
 		Argv          []string          `json:"argv,omitempty"` // Warning: this isn't a recommended way to pass configuration to the WebAssembly module. Instead, use TransportModuleConfig for a serializable configuration file.
 		Env           map[string]string `json:"env,omitempty"`  // Warning: this isn't a recommended way to pass configuration to the WebAssembly module. Instead, use TransportModuleConfig for a serializable configuration file.
@@ -32,9 +64,26 @@ type ConfigJSON struct {
 		PreopenedDirs map[string]string `json:"preopened_dirs,omitempty"` // hostPath: guestPath
 	} `json:"module,omitempty"`
 
+	// WASIPolicy lists the WASI capabilities granted to the WebAssembly
+	// module. If unset, the default capabilities are granted along with
+	// those implied by the Module, e.g., the environment if Env is set.
+	WASIPolicy *WASIPolicyJSON `json:"wasi_policy,omitempty"`
+
 	Runtime struct {
-		ForceInterpreter        bool `json:"force_interpreter,omitempty"`            // If set, will use interpreter mode even on platforms with compiler support
-		DoNotCloseOnContextDone bool `json:"do_not_close_on_context_done,omitempty"` // If unset, will close the module when the context is done and prevent any further calls to the module
+		ForceInterpreter        bool   `json:"force_interpreter,omitempty"`            // If set, will use interpreter mode even on platforms with compiler support
+		Strategy                string `json:"strategy,omitempty"`                     // One of "auto" (default), "compiler" or "interpreter"
+		DoNotCloseOnContextDone bool   `json:"do_not_close_on_context_done,omitempty"` // If unset, will close the module when the context is done and prevent any further calls to the module
+		MemoryLimitPages        uint32 `json:"memory_limit_pages,omitempty"`           // Limits the linear memory of each instance, in pages of 64 KiB
+		StaticMemory            bool   `json:"static_memory,omitempty"`                // If set, will reserve the maximum linear memory of each instance upfront
 		// Setting CompilationCache is not supported yet through JSON
 	} `json:"runtime,omitempty"`
 }
+
+// WASIPolicyJSON defines the JSON format of the WASIPolicy.
+type WASIPolicyJSON struct {
+	Clock    bool `json:"clock"`
+	Random   bool `json:"random"`
+	Environ  bool `json:"environ"`
+	Preopens bool `json:"preopens"`
+	Network  bool `json:"network"`
+}
@@ -1,7 +1,10 @@
 package water
 
 import (
+	"errors"
 	"net"
+	"os"
+	"syscall"
 )
 
 // Conn is an abstracted connection interface which is expected
@@ -9,6 +12,69 @@ import (
 type Conn interface {
 	net.Conn
 
+	// RuntimeStats returns a snapshot of the resources used by the
+	// WebAssembly instance behind the Conn.
+	RuntimeStats() RuntimeStats
+
+	// Stats returns a snapshot of the data read from and written to the
+	// Conn so far, e.g., to detect idle or stalled connections. It
+	// remains available once the Conn is closed.
+	Stats() ConnStats
+
+	// NetConn returns the underlying network connection carrying the
+	// traffic transformed by the WebAssembly Transport Module, e.g., to
+	// set TCP_NODELAY, keepalives or SO_MARK with its SyscallConn.
+	//
+	// Use with care: the network connection is driven by the WATM, so
+	// reading from or writing to it corrupts the transport, and closing
+	// it terminates the Conn. It may be nil if unavailable.
+	NetConn() net.Conn
+
+	// NetConns returns all the network connections dialed or accepted for
+	// the WebAssembly Transport Module, in order, including the one
+	// returned by NetConn, e.g., the decoys or the paths of a multipath
+	// transport dialed by the WATM. They are all closed with the Conn. It
+	// may be nil if unavailable.
+	NetConns() []net.Conn
+
+	// ExportSession returns the latest opaque session state (e.g., keys
+	// or tickets) exported by the WebAssembly Transport Module, or nil if
+	// none. It could seed a future Conn via Config.ResumeSession, so a
+	// WATM supporting it may reconnect without a full handshake.
+	ExportSession() []byte
+
+	// SyscallConn returns a raw connection to the socket through which the
+	// caller reads from and writes to the WebAssembly Transport Module,
+	// e.g., to integrate the Conn with a custom event loop or poller, to
+	// attach a socket filter or to use a zero-copy framework. Data read or
+	// written through it bypasses the Conn, including the IdleTimeout.
+	//
+	// It fails with errors.ErrUnsupported if there is no such socket, e.g.,
+	// for a Conn of a Relay.
+	SyscallConn() (syscall.RawConn, error)
+
+	// File returns a copy of the socket returned by SyscallConn as an
+	// os.File, which the caller is responsible for closing. Closing it does
+	// not close the Conn, and vice versa.
+	//
+	// It fails with errors.ErrUnsupported if there is no such socket. It
+	// also fails if the platform cannot copy it, e.g., on Windows.
+	File() (*os.File, error)
+
+	// CloseReason returns the reason why the connection ended, as last
+	// reported by the WebAssembly Transport Module, e.g., to distinguish
+	// protocol errors, peer resets and policy blocks. It remains available
+	// once the Conn is closed. A zero CloseReason is returned if the WATM
+	// reports none.
+	CloseReason() CloseReason
+
+	// Metadata returns a copy of the key/value metadata attached to the
+	// connection by the WebAssembly Transport Module, e.g., negotiated
+	// parameters, the identity of the peer or the cipher chosen, for
+	// authorization decisions or logging. It remains available once the
+	// Conn is closed. It returns nil if the WATM attaches none.
+	Metadata() map[string]string
+
 	// For forward compatibility with any new methods added to the
 	// interface, all Conn implementations MUST embed the
 	// UnimplementedConn in order to make sure they could be used
@@ -22,6 +88,51 @@ type Conn interface {
 // each of them.
 type UnimplementedConn struct{}
 
+// RuntimeStats implements Conn.RuntimeStats(). It returns a zero RuntimeStats.
+func (*UnimplementedConn) RuntimeStats() RuntimeStats {
+	return RuntimeStats{}
+}
+
+// Stats implements Conn.Stats(). It returns a zero ConnStats.
+func (*UnimplementedConn) Stats() ConnStats {
+	return ConnStats{}
+}
+
+// NetConn implements Conn.NetConn(). It returns nil.
+func (*UnimplementedConn) NetConn() net.Conn {
+	return nil
+}
+
+// NetConns implements Conn.NetConns(). It returns nil.
+func (*UnimplementedConn) NetConns() []net.Conn {
+	return nil
+}
+
+// ExportSession implements Conn.ExportSession(). It returns nil.
+func (*UnimplementedConn) ExportSession() []byte {
+	return nil
+}
+
+// SyscallConn implements Conn.SyscallConn(). It returns errors.ErrUnsupported.
+func (*UnimplementedConn) SyscallConn() (syscall.RawConn, error) {
+	return nil, errors.ErrUnsupported
+}
+
+// File implements Conn.File(). It returns errors.ErrUnsupported.
+func (*UnimplementedConn) File() (*os.File, error) {
+	return nil, errors.ErrUnsupported
+}
+
+// CloseReason implements Conn.CloseReason(). It returns a zero CloseReason.
+func (*UnimplementedConn) CloseReason() CloseReason {
+	return CloseReason{}
+}
+
+// Metadata implements Conn.Metadata(). It returns nil.
+func (*UnimplementedConn) Metadata() map[string]string {
+	return nil
+}
+
 // mustEmbedUnimplementedConn is a no-op method used to test an implementation
 // of Conn really embeds UnimplementedConn.
 func (*UnimplementedConn) mustEmbedUnimplementedConn() {} //nolint:unused
@@ -0,0 +1,33 @@
+package water
+
+import "time"
+
+// ConnStats is a snapshot of the data exchanged through a [Conn] by its
+// caller, e.g., to detect idle or stalled connections or for accounting.
+//
+// Only the data read from or written to the Conn is counted, not the
+// traffic transformed by the WebAssembly Transport Module on the network.
+type ConnStats struct {
+	// BytesRead and BytesWritten are the numbers of bytes read from and
+	// written to the Conn.
+	BytesRead    uint64
+	BytesWritten uint64
+
+	// Reads and Writes are the numbers of calls to Read (or WriteTo) and
+	// Write (or Writev and ReadFrom) which transferred any data.
+	Reads  uint64
+	Writes uint64
+
+	// LastRead and LastWrite are the times of the last calls to Read and
+	// Write which transferred any data. They are zero if there is none.
+	LastRead  time.Time
+	LastWrite time.Time
+}
+
+// LastActivity returns the later of LastRead and LastWrite.
+func (s ConnStats) LastActivity() time.Time {
+	if s.LastRead.After(s.LastWrite) {
+		return s.LastRead
+	}
+	return s.LastWrite
+}
@@ -6,14 +6,20 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net"
 	"os"
 	"runtime"
+	"runtime/pprof"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/refraction-networking/water/internal/log"
 	"github.com/tetratelabs/wazero"
 	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/experimental"
 	"github.com/tetratelabs/wazero/experimental/sys"
 	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
 
@@ -85,6 +91,11 @@ type Core interface {
 	// Module and returns the key of the inserted connection as a
 	// file descriptor accessible from the WebAssembly instance.
 	//
+	// A *net.UnixConn is inserted as a duplicate of its file descriptor
+	// where supported, and so is a *net.IPConn, which cannot be inserted
+	// otherwise. Any other connection than *net.TCPConn is wrapped into
+	// one before being inserted.
+	//
 	// This function SHOULD be called only if the WebAssembly instance
 	// execution is blocked/halted/stopped. Otherwise, race conditions
 	// or undefined behaviors may occur.
@@ -109,7 +120,9 @@ type Core interface {
 	InsertFile(osFile *os.File) (fd int32, err error)
 
 	// Instantiate instantiates the module into a new instance of
-	// WebAssembly Transport Module.
+	// WebAssembly Transport Module, then runs either its _start if it
+	// is a WASI command or its _initialize if it is a WASI reactor.
+	// It gives up once Config.InstantiationTimeout elapses, if set.
 	Instantiate() error
 
 	// Invoke invokes a function in the WebAssembly instance.
@@ -117,9 +130,22 @@ type Core interface {
 	// If the target function is not exported, this function returns an error.
 	Invoke(funcName string, params ...uint64) (results []uint64, err error)
 
+	// Call calls the exported function f of the WebAssembly instance once
+	// the pool, if not nil, allows it. The slot of the pool is released
+	// while the WATM waits in a host function. A trap in the WATM or a panic in
+	// the call is returned as a *ModuleCrash instead of propagating out of
+	// the goroutine, see Config.OnModuleCrash.
+	Call(pool *ExecutionPool, f api.Function, params ...uint64) (results []uint64, err error)
+
 	// ReadIovs reads data from the memory pointed by iovs and writes it to buf.
 	ReadIovs(iovs, iovsLen int32, buf []byte) (int, error)
 
+	// MemorySize returns the current size of the linear memory of the
+	// WebAssembly instance in bytes, or 0 if not instantiated, including
+	// while a function of the instance runs and grows it. Once closed, it
+	// is the last size of the memory.
+	MemorySize() uint64
+
 	// WASIPreview1 enables the WASI preview1 API.
 	//
 	// It is recommended that this function only to be invoked if
@@ -158,6 +184,10 @@ type core struct {
 	module    wazero.CompiledModule
 	instance  api.Module
 
+	// moduleShared is true if the module is compiled into an engine shared
+	// through a CompilationCache, in which case it must not be closed.
+	moduleShared bool
+
 	// saved after Exports() is called
 	exportsLoadOnce sync.Once
 	exports         map[string]api.ExternType
@@ -168,7 +198,20 @@ type core struct {
 
 	importModules map[string]wazero.HostModuleBuilder
 
+	// owned holds the files and connections created for the instance,
+	// which are closed with the Core.
+	owned ownedResources
+
+	// memorySize is the size of the linear memory of the instance,
+	// recorded by the memorySizeAllocator allocating it, see MemorySize.
+	memorySize *atomic.Uint64
+
 	closeOnce sync.Once
+	closed    atomic.Bool
+
+	createdAt []byte // the stack trace of the creation site, in debug mode
+
+	recorder *recorder // nil unless Config.Recorder is set
 }
 
 // NewCore creates a new Core with the given config.
@@ -192,28 +235,165 @@ func NewCore(config *Config) (Core, error) {
 // function call will return with an error. Call
 // [WazeroRuntimeConfigFactory.SetCloseOnContextDone] with false
 // to disable this behavior.
+//
+// Compiling the WATM here and instantiating it in Instantiate are both
+// bounded by the context and by Config.InstantiationTimeout, if set.
 func NewCoreWithContext(ctx context.Context, config *Config) (Core, error) {
 	var err error
 
+	if isComponent(config.WATMBinOrPanic()) {
+		return nil, ErrComponentUnsupported
+	}
+
 	c := &core{
 		config:        config,
 		importModules: make(map[string]wazero.HostModuleBuilder),
+		memorySize:    new(atomic.Uint64),
+		createdAt:     creationStack(),
+	}
+
+	if err := config.RuntimeOptions.validate(); err != nil {
+		return nil, err
+	}
+	runtimeConfig := config.RuntimeOptions.apply(config.RuntimeConfig())
+	if len(config.TransportModuleCompiled) > 0 && !runtimeConfig.isolated {
+		cache, err := installCompiledModule(config.TransportModuleCompiled, config.Logger())
+		if err != nil {
+			return nil, err
+		}
+		if cache != nil {
+			runtimeConfig = runtimeConfig.Clone()
+			runtimeConfig.SetCompilationCache(cache)
+		}
 	}
 
 	c.ctx, c.ctxCancel = context.WithCancel(ctx)
-	c.runtime = wazero.NewRuntimeWithConfig(ctx, config.RuntimeConfig().GetConfig())
+	c.ctx = pprof.WithLabels(c.ctx, pprof.Labels(
+		ProfilerLabelWATM, moduleHash(config.WATMBinOrPanic()),
+		ProfilerLabelConn, strconv.FormatUint(coreIDs.Add(1), 10),
+	))
+	c.ctx = experimental.WithMemoryAllocator(c.ctx, memorySizeAllocator{c.memorySize})
+	c.runtime = wazero.NewRuntimeWithConfig(ctx, runtimeConfig.GetConfig())
+	c.moduleShared = !runtimeConfig.isolated
+
+	if c.module, err = c.compile(ctx); err != nil {
+		c.ctxCancel()
+		return nil, err
+	}
 
-	if c.module, err = c.runtime.CompileModule(ctx, c.config.WATMBinOrPanic()); err != nil {
-		return nil, fmt.Errorf("water: (*Runtime).CompileModule returned error: %w", err)
+	// the host modules are compiled with the context of the Core, so that
+	// the recorder and the ExecutionPool listen to the host functions only
+	if config.Recorder != nil {
+		w, err := config.Recorder()
+		if err != nil {
+			c.runtime.Close(context.Background()) // skipcq: GO-S2307
+			c.ctxCancel()
+			return nil, fmt.Errorf("water: opening the recording: %w", err)
+		}
+		c.owned.own(w, "recording") // skipcq: GSC-G104
+		c.recorder = newRecorder(w)
+		c.ctx = experimental.WithFunctionListenerFactory(c.ctx, c.recorder)
+	}
+	if config.ExecutionPool != nil {
+		var factory experimental.FunctionListenerFactory = executionPoolListener{}
+		if c.recorder != nil {
+			factory = experimental.MultiFunctionListenerFactory(c.recorder, factory)
+		}
+		c.ctx = experimental.WithFunctionListenerFactory(c.ctx, factory)
 	}
 
 	runtime.SetFinalizer(c, func(core *core) {
-		c.Close()
+		if !core.closed.Load() {
+			core.reportLeak()
+		}
+		core.Close()
 	})
 
+	activeCores.Add(1)
+	instancesCreated.Add(1)
 	return c, nil
 }
 
+// compile compiles the WATM, returning early once ctx is done or the
+// InstantiationTimeout elapses. Compilation itself cannot be interrupted,
+// so it continues in the background and its result is discarded. The
+// runtime is closed if compilation does not succeed in time.
+func (c *core) compile(ctx context.Context) (wazero.CompiledModule, error) {
+	ctx, cancel := c.config.instantiationContext(ctx)
+	defer cancel()
+
+	if err := ctx.Err(); err != nil {
+		c.runtime.Close(context.Background()) // skipcq: GO-S2307
+		return nil, fmt.Errorf("water: compiling the WATM: %w", err)
+	}
+
+	if err := c.config.ExecutionPool.Acquire(ctx); err != nil {
+		c.runtime.Close(context.Background()) // skipcq: GO-S2307
+		return nil, fmt.Errorf("water: (*ExecutionPool).Acquire returned error: %w", err)
+	}
+
+	type compileResult struct {
+		module wazero.CompiledModule
+		err    error
+	}
+	done := make(chan compileResult, 1)
+	rt, bin, labels := c.runtime, c.config.WATMBinOrPanic(), c.ctx
+	go func() {
+		defer c.config.ExecutionPool.Release()
+		pprof.SetGoroutineLabels(labels)
+		compiles.Add(1)
+		module, err := rt.CompileModule(context.Background(), bin)
+		done <- compileResult{module, err}
+	}()
+
+	select {
+	case r := <-done:
+		if r.err != nil {
+			rt.Close(context.Background()) // skipcq: GO-S2307
+			return nil, fmt.Errorf("water: (*Runtime).CompileModule returned error: %w", r.err)
+		}
+		return r.module, nil
+	case <-ctx.Done():
+		go func() {
+			<-done
+			rt.Close(context.Background()) // skipcq: GO-S2307
+		}()
+		return nil, fmt.Errorf("water: compiling the WATM: %w", ctx.Err())
+	}
+}
+
+var activeCores atomic.Int64
+
+// coreIDs numbers the Cores created, for the profiler labels.
+var coreIDs atomic.Uint64
+
+// ActiveCores returns the number of Cores created and not yet closed,
+// including those only to be closed upon garbage collection. It is
+// intended for detecting leaked WebAssembly instances.
+func ActiveCores() int64 {
+	return activeCores.Load()
+}
+
+// reportLeak records the Core as garbage collected without being closed,
+// and logs what it leaked in debug mode.
+func (c *core) reportLeak() {
+	leakedCores.Add(1)
+	if !debugEnabled() {
+		return
+	}
+
+	leaked := "its WebAssembly instance"
+	if owned := c.owned.describe(); len(owned) > 0 {
+		leaked = fmt.Sprintf("its WebAssembly instance and %d resources: %s", len(owned), strings.Join(owned, ", "))
+	}
+
+	if c.createdAt == nil { // debug mode enabled after the Core was created
+		log.LErrorf(c.config.Logger(), "water: Core garbage collected without being closed, leaking %s", leaked)
+	} else {
+		log.LErrorf(c.config.Logger(), "water: Core garbage collected without being closed, leaking %s\nCore created at:\n%s", leaked, c.createdAt)
+	}
+}
+
 // Config implements Core.
 func (c *core) Config() *Config {
 	return c.config
@@ -248,6 +428,17 @@ func (c *core) Close() error {
 	var closeErr error
 
 	c.closeOnce.Do(func() {
+		c.closed.Store(true)
+		activeCores.Add(-1)
+
+		// the resources owned are closed after the instance using them,
+		// even if closing the instance or the runtime fails
+		defer func() {
+			if err := c.owned.closeAll(); err != nil && closeErr == nil {
+				closeErr = fmt.Errorf("water: closing the resources owned by the Core: %w", err)
+			}
+		}()
+
 		if c.instance != nil {
 			if err := c.instance.Close(c.ctx); err != nil {
 				closeErr = fmt.Errorf("water: (*wazero/api.Module).Close returned error: %w", err)
@@ -266,7 +457,11 @@ func (c *core) Close() error {
 			log.LDebugf(c.config.Logger(), "RUNTIME DROPPED")
 		}
 
-		if c.module != nil {
+		// A CompiledModule compiled with a CompilationCache lives in the engine
+		// shared by all runtimes using the same cache, where it is also used by
+		// all other Cores running the same WATM. Closing it would remove it
+		// from the engine, failing any of those Cores not yet instantiated.
+		if c.module != nil && !c.moduleShared {
 			if err := c.module.Close(c.ctx); err != nil {
 				closeErr = fmt.Errorf("water: (*wazero.CompiledModule).Close returned error: %w", err)
 				return
@@ -373,22 +568,31 @@ func (c *core) Instantiate() (err error) {
 		return fmt.Errorf("water: double instantiation is not allowed")
 	}
 
+	ctx, cancel := c.config.instantiationContext(c.ctx)
+	defer cancel()
+
 	// Instantiate the imported functions
 	for _, moduleBuilder := range c.importModules {
-		if _, err := moduleBuilder.Instantiate(c.ctx); err != nil {
+		if _, err := moduleBuilder.Instantiate(ctx); err != nil {
 			return fmt.Errorf("water: (*wazero.HostModuleBuilder).Instantiate returned error: %w", err)
 		}
 	}
 
-	// If TransportModuleConfig is set, we pass the config to the runtime.
-	if c.config.TransportModuleConfig != nil {
-		mc := c.config.ModuleConfig()
-		fsCfg := mc.GetFSConfig()
-		if fsCfg == nil {
-			fsCfg = wazero.NewFSConfig()
+	policy := c.config.WASIPolicyOrDefault()
+	if c.config.WASIPolicy == nil && contextHasModuleEnviron(c.ctx) {
+		policy.Environ = true // explicitly configured via WithModuleEnv
+	}
+	mc := c.config.ModuleConfig()
 
-		}
+	var fsCfg wazero.FSConfig = wazero.NewFSConfig()
+	if policy.Preopens {
+		fsCfg = mc.GetFSConfig()
+	} else if mc.configuresPreopens() {
+		log.LWarnf(c.config.Logger(), "water: preopened directories are withheld by WASIPolicy")
+	}
 
+	// If TransportModuleConfig is set, we pass the config to the runtime.
+	if c.config.TransportModuleConfig != nil {
 		memFS := memfs.New()
 
 		err := memFS.WriteFile("watm.cfg", c.config.TransportModuleConfig.AsBytes())
@@ -398,16 +602,45 @@ func (c *core) Instantiate() (err error) {
 
 		if expFsCfg, ok := fsCfg.(expsysfs.FSConfig); ok {
 			fsCfg = expFsCfg.WithSysFSMount(memFS, "/conf/")
-			mc.SetFSConfig(fsCfg)
 		}
 	} else {
 		log.LWarnf(c.config.Logger(), "water: TransportModuleConfig is not set, skipping...")
 	}
 
-	if c.instance, err = c.runtime.InstantiateModule(
-		c.ctx,
+	if err = c.config.ExecutionPool.Acquire(ctx); err != nil {
+		return fmt.Errorf("water: (*ExecutionPool).Acquire returned error: %w", err)
+	}
+	defer c.config.ExecutionPool.Release()
+
+	// A WATM built as a WASI command runs its _start, while one built as
+	// a WASI reactor (e.g., a Rust cdylib or a Go c-shared library) MUST
+	// have its _initialize called before any other export.
+	//
+	// The start function is interrupted once ctx is done, unless
+	// CloseOnContextDone is disabled in the RuntimeConfigFactory.
+	moduleConfig := mc.getConfigWithPolicy(policy)
+	if c.config.EntropySource != nil {
+		moduleConfig = moduleConfig.WithRandSource(c.config.EntropySource)
+	}
+	if c.config.Clock != nil {
+		moduleConfig = c.config.withModuleClock(moduleConfig)
+	}
+	if policy.Environ {
+		moduleConfig = c.config.withModuleEnviron(c.ctx, moduleConfig)
+	} else if mc.configuresEnviron() || c.config.hasModuleEnviron(c.ctx) {
+		log.LWarnf(c.config.Logger(), "water: arguments and environment variables are withheld by WASIPolicy")
+	}
+
+	c.recorder.call("instantiate", "", nil)
+	c.instance, err = c.runtime.InstantiateModule(
+		ctx,
 		c.module,
-		c.config.ModuleConfig().GetConfig()); err != nil {
+		moduleConfig.WithFSConfig(fsCfg).WithStartFunctions("_start", "_initialize"))
+	c.recorder.returned("", nil, err)
+	if err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("water: instantiating the WATM: %w: %w", ctx.Err(), err)
+		}
 		return fmt.Errorf("water: (*Runtime).InstantiateWithConfig returned error: %w", err)
 	}
 
@@ -425,7 +658,7 @@ func (c *core) Invoke(funcName string, params ...uint64) (results []uint64, err
 		return nil, fmt.Errorf("water: function %q is not exported", funcName)
 	}
 
-	results, err = expFunc.Call(c.ctx, params...)
+	results, err = c.Call(nil, expFunc, params...)
 	if err != nil {
 		return nil, fmt.Errorf("water: (*wazero.ExportedFunction)%q.Call returned error: %w", funcName, err)
 	}
@@ -433,12 +666,34 @@ func (c *core) Invoke(funcName string, params ...uint64) (results []uint64, err
 	return
 }
 
+// Call implements Core.
+func (c *core) Call(pool *ExecutionPool, f api.Function, params ...uint64) (results []uint64, err error) {
+	if c.recorder == nil {
+		return c.config.callModule(c.ctx, c.instance, pool, f, params...)
+	}
+
+	funcName := exportName(f.Definition())
+	c.recorder.call("call", funcName, params)
+	results, err = c.config.callModule(c.ctx, c.instance, pool, f, params...)
+	if err == nil {
+		c.recorder.returned(funcName, normalizeValues(f.Definition().ResultTypes(), results), nil)
+	} else {
+		c.recorder.returned(funcName, nil, err)
+	}
+	return results, err
+}
+
 var le = binary.LittleEndian
 
 // adapted from fd_write implementation in wazero
 func (c *core) ReadIovs(iovs, iovsLen int32, buf []byte) (n int, err error) {
 	mem := c.instance.Memory()
 
+	// a WATM may lie about iovsLen, which must not overflow iovsLen*8
+	if iovsLen < 0 || iovsLen > math.MaxInt32>>3 {
+		return 0, errors.New("ReadIovs: invalid iovs length")
+	}
+
 	iovsStop := uint32(iovsLen) << 3 // iovsCount * 8
 	iovsBuf, ok := mem.Read(uint32(iovs), iovsStop)
 	if !ok {
@@ -465,6 +720,49 @@ func (c *core) ReadIovs(iovs, iovsLen int32, buf []byte) (n int, err error) {
 	return
 }
 
+// MemorySize implements Core.
+func (c *core) MemorySize() uint64 {
+	return c.memorySize.Load()
+}
+
+// memorySizeAllocator is an experimental.MemoryAllocator recording the
+// size of the linear memory it allocates as the memory grows, as the
+// memory itself may only be inspected by the goroutine running the
+// instance. It allocates like wazero does by default, since the memory of
+// a WATM is never shared.
+type memorySizeAllocator struct {
+	size *atomic.Uint64
+}
+
+// Allocate implements experimental.MemoryAllocator.
+func (a memorySizeAllocator) Allocate(capacity, _ uint64) experimental.LinearMemory {
+	return &sizedLinearMemory{buf: make([]byte, 0, capacity), size: a.size}
+}
+
+// sizedLinearMemory is the experimental.LinearMemory allocated by a
+// memorySizeAllocator.
+type sizedLinearMemory struct {
+	buf  []byte
+	size *atomic.Uint64
+}
+
+// Reallocate implements experimental.LinearMemory.
+func (m *sizedLinearMemory) Reallocate(size uint64) []byte {
+	if size > uint64(cap(m.buf)) {
+		m.buf = append(m.buf, make([]byte, size-uint64(len(m.buf)))...)
+	} else {
+		m.buf = m.buf[:size]
+	}
+	m.size.Store(size)
+	return m.buf
+}
+
+// Free implements experimental.LinearMemory. The size of the memory is
+// kept as the last one.
+func (m *sizedLinearMemory) Free() {
+	m.buf = nil
+}
+
 // WASIPreview1 implements Core.
 func (c *core) WASIPreview1() error {
 	if _, err := wasi_snapshot_preview1.Instantiate(c.ctx, c.runtime); err != nil {
@@ -0,0 +1,122 @@
+package water_test
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/refraction-networking/water"
+)
+
+// wasmSpin is a WASI command whose _start never returns.
+//
+//go:embed testdata/spin.wasm
+var wasmSpin []byte
+
+func TestCore_InstantiationTimeout(t *testing.T) {
+	t.Run("canceled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := water.NewCoreWithContext(ctx, &water.Config{TransportModuleBin: wasmPlain})
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("NewCoreWithContext() error = %v, want %v", err, context.Canceled)
+		}
+	})
+
+	t.Run("start function", func(t *testing.T) {
+		core, err := water.NewCoreWithContext(context.Background(), &water.Config{
+			TransportModuleBin:   wasmSpin,
+			InstantiationTimeout: 100 * time.Millisecond,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer core.Close() // skipcq: GO-S2307
+
+		errCh := make(chan error, 1)
+		go func() { errCh <- core.Instantiate() }()
+
+		select {
+		case err := <-errCh:
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("Instantiate() error = %v, want %v", err, context.DeadlineExceeded)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatal("Instantiate() did not return after InstantiationTimeout")
+		}
+	})
+}
+
+func TestCore_CloseOwnedConns(t *testing.T) {
+	core, err := water.NewCoreWithContext(context.Background(), &water.Config{
+		TransportModuleBin: []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}, // empty module
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer core.Close() // skipcq: GO-S2307
+
+	if err = core.Instantiate(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a net.Pipe is wrapped into a socket pair owned by the Core
+	conn, peer := net.Pipe()
+	defer peer.Close() // skipcq: GO-S2307
+
+	if _, err = core.InsertConn(conn); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = core.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// closing the Core must close the connection inserted, without waiting
+	// for the garbage collector
+	if err = peer.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = peer.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+		t.Errorf("Read() from the peer after Close error = %v, want %v", err, io.EOF)
+	}
+}
+
+func TestCore_ClosedAfterVersionDetection(t *testing.T) {
+	tcpLis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcpLis.Close() // skipcq: GO-S2307
+
+	config := &water.Config{
+		TransportModuleBin: wasmPlain,
+		NetworkListener:    tcpLis,
+	}
+
+	// the Cores created to look up the version of the WATM must not
+	// outlive the constructors
+	active := water.ActiveCores()
+
+	if _, err := water.NewDialerWithContext(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := water.NewFixedDialerWithContext(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := water.NewListenerWithContext(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := water.NewRelayWithContext(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := water.ActiveCores(); got != active {
+		t.Errorf("ActiveCores() = %d after creating a Dialer, a FixedDialer, a Listener and a Relay, want %d", got, active)
+	}
+}
@@ -0,0 +1,144 @@
+package water
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/tetratelabs/wazero/api"
+)
+
+// DefaultCrashDumpMemoryLimit caps the memory snapshot of a CrashDump
+// unless the CrashDumpMemoryLimit is set.
+const DefaultCrashDumpMemoryLimit = 1 << 20 // 1 MiB
+
+// CrashDump is a snapshot of a crashed WASM instance, for debugging a
+// third-party WATM in the field.
+type CrashDump struct {
+	// Time is when the crash occurred.
+	Time time.Time
+
+	// Function is the name of the exported function which crashed, e.g.,
+	// "watm_start_v1".
+	Function string
+
+	// FaultingFunction is the innermost WebAssembly function on the stack
+	// when the WATM crashed, if known.
+	FaultingFunction string
+
+	// Error describes the trap or the panic, e.g., "wasm error:
+	// unreachable".
+	Error string
+
+	// StackTrace lists the WebAssembly functions on the stack when the
+	// WATM crashed, innermost first, if known.
+	StackTrace []string
+
+	// MemorySize is the size of the linear memory in bytes.
+	MemorySize uint64
+
+	// Memory is a snapshot of the linear memory from address 0, where the
+	// toolchains commonly place the stack and the static data, truncated
+	// to the CrashDumpMemoryLimit.
+	Memory []byte
+}
+
+// CrashDumpSink receives the CrashDump of each crash of a WASM instance.
+// WriteCrashDump is called from the goroutine of the crashed call and
+// must be safe for concurrent use.
+type CrashDumpSink interface {
+	WriteCrashDump(dump *CrashDump) error
+}
+
+// CrashDumpSinkFunc is a func implementing CrashDumpSink.
+type CrashDumpSinkFunc func(dump *CrashDump) error
+
+// WriteCrashDump implements CrashDumpSink.
+func (f CrashDumpSinkFunc) WriteCrashDump(dump *CrashDump) error {
+	return f(dump)
+}
+
+// NewDirCrashDumpSink creates a CrashDumpSink writing each CrashDump into
+// a new JSON file in dir, named after the time of the crash, e.g.,
+// "watm-crash-20240102T150405.000000000Z-123456.json", with the memory
+// snapshot encoded in base64.
+func NewDirCrashDumpSink(dir string) CrashDumpSink {
+	return CrashDumpSinkFunc(func(dump *CrashDump) error {
+		f, err := os.CreateTemp(dir, "watm-crash-"+dump.Time.UTC().Format("20060102T150405.000000000Z")+"-*.json")
+		if err != nil {
+			return fmt.Errorf("water: creating crash dump file: %w", err)
+		}
+		defer f.Close()
+
+		if err := json.NewEncoder(f).Encode(struct {
+			Time             time.Time `json:"time"`
+			Function         string    `json:"function"`
+			FaultingFunction string    `json:"faulting_function,omitempty"`
+			Error            string    `json:"error"`
+			StackTrace       []string  `json:"stack_trace,omitempty"`
+			MemorySize       uint64    `json:"memory_size"`
+			Memory           []byte    `json:"memory,omitempty"`
+		}{
+			Time:             dump.Time,
+			Function:         dump.Function,
+			FaultingFunction: dump.FaultingFunction,
+			Error:            dump.Error,
+			StackTrace:       dump.StackTrace,
+			MemorySize:       dump.MemorySize,
+			Memory:           dump.Memory,
+		}); err != nil {
+			return fmt.Errorf("water: writing crash dump file: %w", err)
+		}
+		return f.Close()
+	})
+}
+
+// wasmStackTracePrefix separates the error from the stack trace of the
+// WebAssembly functions in the errors of wazero, one function per line
+// indented with a tab.
+const wasmStackTracePrefix = "\nwasm stack trace:\n"
+
+// newCrashDump creates a CrashDump of the crash of the instance mod.
+func (c *Config) newCrashDump(mod api.Module, crash *ModuleCrash) *CrashDump {
+	dump := &CrashDump{
+		Time:     time.Now(),
+		Function: crash.Function,
+		Error:    crash.Err.Error(),
+	}
+
+	if i := strings.Index(dump.Error, wasmStackTracePrefix); i >= 0 {
+		for _, line := range strings.Split(dump.Error[i+len(wasmStackTracePrefix):], "\n") {
+			if !strings.HasPrefix(line, "\t") {
+				break
+			}
+			dump.StackTrace = append(dump.StackTrace, strings.TrimPrefix(line, "\t"))
+		}
+		dump.Error = dump.Error[:i]
+	}
+	if len(dump.StackTrace) > 0 {
+		dump.FaultingFunction, _, _ = strings.Cut(dump.StackTrace[0], "(")
+	}
+
+	if mod == nil || mod.Memory() == nil {
+		return dump
+	}
+	mem := mod.Memory()
+	dump.MemorySize = uint64(mem.Size())
+
+	limit := c.CrashDumpMemoryLimit
+	if limit == 0 {
+		limit = DefaultCrashDumpMemoryLimit
+	}
+	if limit > 0 {
+		size := mem.Size()
+		if uint64(size) > uint64(limit) {
+			size = uint32(limit)
+		}
+		if snapshot, ok := mem.Read(0, size); ok {
+			dump.Memory = append([]byte(nil), snapshot...)
+		}
+	}
+	return dump
+}
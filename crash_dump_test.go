@@ -0,0 +1,90 @@
+package water_test
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/refraction-networking/water"
+)
+
+// wasmCrashMemory is a module with memory whose exported function traps
+// in a nested call.
+//
+//go:embed testdata/crash_memory.wasm
+var wasmCrashMemory []byte
+
+func TestConfig_CrashDumpSink(t *testing.T) {
+	dir := t.TempDir()
+	dirSink := water.NewDirCrashDumpSink(dir)
+
+	var dumps []*water.CrashDump
+	core, err := water.NewCoreWithContext(context.Background(), &water.Config{
+		TransportModuleBin: wasmCrashMemory,
+		CrashDumpSink: water.CrashDumpSinkFunc(func(dump *water.CrashDump) error {
+			dumps = append(dumps, dump)
+			return dirSink.WriteCrashDump(dump)
+		}),
+		CrashDumpMemoryLimit: 16,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer core.Close() // skipcq: GO-S2307
+
+	if err = core.Instantiate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = core.Invoke("trap"); err == nil {
+		t.Fatal("Invoke() returned no error")
+	}
+	if len(dumps) != 1 {
+		t.Fatalf("CrashDumpSink received %d dumps, want 1", len(dumps))
+	}
+
+	dump := dumps[0]
+	if dump.Function != "trap" {
+		t.Errorf("Function = %q, want %q", dump.Function, "trap")
+	}
+	if dump.Error != "wasm error: unreachable" {
+		t.Errorf("Error = %q, want %q", dump.Error, "wasm error: unreachable")
+	}
+	if len(dump.StackTrace) != 2 {
+		t.Errorf("StackTrace = %q, want 2 functions", dump.StackTrace)
+	} else if dump.FaultingFunction == "" || dump.FaultingFunction == dump.StackTrace[1] {
+		t.Errorf("FaultingFunction = %q, want the innermost of %q", dump.FaultingFunction, dump.StackTrace)
+	}
+	if dump.MemorySize != 1<<16 {
+		t.Errorf("MemorySize = %d, want %d", dump.MemorySize, 1<<16)
+	}
+	if len(dump.Memory) != 16 || string(dump.Memory[:4]) != "WATM" {
+		t.Errorf("Memory = %q, want 16 bytes starting with %q", dump.Memory, "WATM")
+	}
+
+	// the dump written to the directory
+	files, err := filepath.Glob(filepath.Join(dir, "watm-crash-*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("found %d crash dump files, want 1", len(files))
+	}
+	b, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var written struct {
+		Function string `json:"function"`
+		Memory   []byte `json:"memory"`
+	}
+	if err = json.Unmarshal(b, &written); err != nil {
+		t.Fatal(err)
+	}
+	if written.Function != "trap" || string(written.Memory) != string(dump.Memory) {
+		t.Errorf("crash dump file = %s, want the CrashDump", b)
+	}
+}
@@ -0,0 +1,39 @@
+package water
+
+import (
+	"runtime/debug"
+	"sync/atomic"
+)
+
+var debugMode atomic.Bool
+
+// SetDebug enables or disables the debug mode of WATER, which is disabled
+// by default.
+//
+// In debug mode, each Core records the stack trace of where it is created,
+// e.g., by dialing or accepting a Conn. A Core garbage collected without
+// being closed, i.e., whose WebAssembly instance and duplicated file
+// descriptors outlived the Conn, Dialer or Listener owning it, is then
+// logged as an error with that stack trace and the resources it leaked.
+// See LeakedCores.
+//
+// Recording the stack traces is costly, so the debug mode is meant for
+// tests and troubleshooting, not for production. Builds with the race
+// detector or the waterdebug build tag are always in debug mode.
+func SetDebug(enabled bool) {
+	debugMode.Store(enabled)
+}
+
+// debugEnabled reports whether the debug mode is enabled.
+func debugEnabled() bool {
+	return leakDetection || debugMode.Load()
+}
+
+// creationStack returns the stack trace of the caller in debug mode, or
+// nil otherwise.
+func creationStack() []byte {
+	if !debugEnabled() {
+		return nil
+	}
+	return debug.Stack()
+}
@@ -0,0 +1,68 @@
+package water_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/refraction-networking/water"
+)
+
+// lockedBuffer is a bytes.Buffer safe for concurrent use, written by the
+// finalizers logging leaks.
+type lockedBuffer struct {
+	mutex sync.Mutex
+	buf   bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.String()
+}
+
+func TestSetDebug(t *testing.T) {
+	water.SetDebug(true)
+	defer water.SetDebug(false)
+
+	logs := new(lockedBuffer)
+	leaked := water.LeakedCores()
+	leakCore(t, &water.Config{
+		TransportModuleBin: []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}, // empty module
+		OverrideLogger:     slog.New(slog.NewTextHandler(logs, nil)),
+	})
+
+	for i := 0; i < 100 && water.LeakedCores() == leaked; i++ {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond) // allow finalizers to run
+	}
+	if water.LeakedCores() == leaked {
+		t.Fatal("Core garbage collected without being closed is not counted by LeakedCores")
+	}
+
+	// the leak is logged with the stack trace of the creation site
+	for i := 0; i < 100 && !strings.Contains(logs.String(), "leakCore"); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := logs.String(); !strings.Contains(got, "without being closed") || !strings.Contains(got, "leakCore") {
+		t.Errorf("leak not logged with the creation site, logs: %s", got)
+	}
+}
+
+// leakCore creates a Core, never closing it.
+func leakCore(t *testing.T, config *water.Config) {
+	if _, err := water.NewCoreWithContext(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+}
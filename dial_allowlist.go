@@ -0,0 +1,123 @@
+package water
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// ErrDialNotAllowed is returned by a dial for the WATM if the address is
+// not allowed by the DialAllowlist of the Config.
+var ErrDialNotAllowed = errors.New("water: address not allowed by DialAllowlist")
+
+// DialAllowlist restricts the remote addresses the host dials on behalf of
+// the WebAssembly Transport Module, so that even a compromised or
+// malicious WATM (e.g., a community-provided one) can only connect to the
+// intended bridges.
+//
+// An address is allowed if its host is an IP address within any of the
+// Prefixes, or a hostname matching any of the Hostnames, regardless of the
+// port. Any other address, including one that is not of the form
+// "host:port", is denied, except on the raw IP networks (e.g., "ip4:icmp"),
+// whose addresses are a host alone.
+type DialAllowlist struct {
+	// Prefixes lists the IP prefixes the IP addresses dialed must be
+	// within, e.g., "192.0.2.0/24". A single IP address may be listed as
+	// a prefix of its full length, e.g., "192.0.2.1/32".
+	Prefixes []netip.Prefix
+
+	// Hostnames lists the patterns the hostnames dialed must match, each
+	// either a hostname matched exactly (e.g., "bridge.example.com") or a
+	// wildcard (e.g., "*.example.com") matching any of its subdomains,
+	// both case-insensitively.
+	//
+	// A hostname is checked before it is resolved, so a hostname matching
+	// none of the patterns is denied even if it resolves to an IP address
+	// within the Prefixes.
+	Hostnames []string
+}
+
+// Clone returns a copy of the DialAllowlist.
+func (a *DialAllowlist) Clone() *DialAllowlist {
+	if a == nil {
+		return nil
+	}
+
+	return &DialAllowlist{
+		Prefixes:  append([]netip.Prefix(nil), a.Prefixes...),
+		Hostnames: append([]string(nil), a.Hostnames...),
+	}
+}
+
+// Allows reports whether address, in the form of "host:port", is allowed
+// to be dialed.
+func (a *DialAllowlist) Allows(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+	return a.AllowsHost(host)
+}
+
+// AllowsHost reports whether host, an IP address or a hostname without a
+// port, is allowed to be dialed, e.g., on a raw IP network.
+func (a *DialAllowlist) AllowsHost(host string) bool {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		addr = addr.WithZone("").Unmap()
+		for _, prefix := range a.Prefixes {
+			if prefix.Contains(addr) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, pattern := range a.Hostnames {
+		if matchHostname(host, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchHostname reports whether host matches pattern, either a hostname
+// matched exactly or a wildcard (e.g., "*.example.com") matching any of
+// its subdomains, both case-insensitively.
+func matchHostname(host, pattern string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	pattern = strings.ToLower(strings.TrimSuffix(pattern, "."))
+	if suffix, ok := strings.CutPrefix(pattern, "*"); ok {
+		return strings.HasPrefix(suffix, ".") && strings.HasSuffix(host, suffix) && len(host) > len(suffix)
+	}
+	return host == pattern
+}
+
+// DialFunc wraps dialerFunc, returning a function dialing only the
+// addresses allowed, and failing with ErrDialNotAllowed otherwise. The
+// address dialed on a raw IP network (e.g., "ip4:icmp") is checked as a
+// host alone.
+func (a *DialAllowlist) DialFunc(dialerFunc func(network, address string) (net.Conn, error)) func(network, address string) (net.Conn, error) {
+	if a == nil {
+		return dialerFunc
+	}
+
+	return func(network, address string) (net.Conn, error) {
+		allowed := a.Allows
+		if isRawIPNetwork(network) {
+			allowed = a.AllowsHost
+		}
+		if !allowed(address) {
+			return nil, fmt.Errorf("%w: %s %s", ErrDialNotAllowed, network, address)
+		}
+		return dialerFunc(network, address)
+	}
+}
+
+// isRawIPNetwork reports whether network names a raw IP network, e.g.,
+// "ip", "ip4:icmp" or "ip6:58", whose addresses carry no port.
+func isRawIPNetwork(network string) bool {
+	ip, _, _ := strings.Cut(network, ":")
+	return ip == "ip" || ip == "ip4" || ip == "ip6"
+}
@@ -0,0 +1,101 @@
+package water_test
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/refraction-networking/water"
+)
+
+func TestDialAllowlist_Allows(t *testing.T) {
+	allowlist := &water.DialAllowlist{
+		Prefixes: []netip.Prefix{
+			netip.MustParsePrefix("192.0.2.0/24"),
+			netip.MustParsePrefix("2001:db8::1/128"),
+		},
+		Hostnames: []string{"bridge.example.com", "*.example.net"},
+	}
+
+	for address, want := range map[string]bool{
+		"192.0.2.1:443":               true,
+		"[::ffff:192.0.2.1]:443":      true,
+		"198.51.100.1:443":            false,
+		"[2001:db8::1]:443":           true,
+		"[2001:db8::1%eth0]:443":      true,
+		"[2001:db8::2]:443":           false,
+		"bridge.example.com:443":      true,
+		"BRIDGE.example.com.:80":      true,
+		"other.example.com:443":       false,
+		"a.b.example.net:443":         true,
+		"example.net:443":             false,
+		"evilexample.net:443":         false,
+		"bridge.example.com":          false, // no port
+		"/var/run/bridge.sock":        false,
+		"bridge.example.com.evil:443": false,
+	} {
+		if got := allowlist.Allows(address); got != want {
+			t.Errorf("Allows(%q) = %v, want %v", address, got, want)
+		}
+	}
+}
+
+func TestDialAllowlist_AllowsHost(t *testing.T) {
+	allowlist := &water.DialAllowlist{
+		Prefixes:  []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")},
+		Hostnames: []string{"bridge.example.com"},
+	}
+
+	for host, want := range map[string]bool{
+		"192.0.2.1":          true,
+		"198.51.100.1":       false,
+		"bridge.example.com": true,
+		"other.example.com":  false,
+		"192.0.2.1:443":      false, // not a host
+	} {
+		if got := allowlist.AllowsHost(host); got != want {
+			t.Errorf("AllowsHost(%q) = %v, want %v", host, got, want)
+		}
+	}
+
+	// the address dialed on a raw IP network is a host alone
+	dialerFunc := allowlist.DialFunc(func(network, address string) (net.Conn, error) {
+		return nil, errors.New("unreachable")
+	})
+	if _, err := dialerFunc("ip4:icmp", "198.51.100.1"); !errors.Is(err, water.ErrDialNotAllowed) {
+		t.Errorf("dialing raw 198.51.100.1 returned %v, want ErrDialNotAllowed", err)
+	}
+	if _, err := dialerFunc("ip4:icmp", "192.0.2.1"); err == nil || errors.Is(err, water.ErrDialNotAllowed) {
+		t.Errorf("dialing raw 192.0.2.1 returned %v, want it dialed", err)
+	}
+}
+
+func TestConfig_DialAllowlist(t *testing.T) {
+	var dialed []string
+	config := &water.Config{
+		NetworkDialerFunc: func(network, address string) (net.Conn, error) {
+			dialed = append(dialed, address)
+			return nil, errors.New("unreachable")
+		},
+		Failover: &water.Failover{Addresses: []string{"198.51.100.1:443", "192.0.2.2:443"}},
+		DialAllowlist: &water.DialAllowlist{
+			Prefixes: []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")},
+		},
+	}
+
+	_, err := config.NetworkDialerFuncOrDefault()("tcp", "203.0.113.1:443")
+	if err == nil {
+		t.Fatal("dial succeeded, want an error")
+	}
+
+	// only the allowed Failover backup is dialed
+	if len(dialed) != 1 || dialed[0] != "192.0.2.2:443" {
+		t.Fatalf("dialed %v, want [192.0.2.2:443]", dialed)
+	}
+
+	config.Failover = nil
+	if _, err = config.NetworkDialerFuncOrDefault()("tcp", "203.0.113.1:443"); !errors.Is(err, water.ErrDialNotAllowed) {
+		t.Fatalf("dial returned %v, want %v", err, water.ErrDialNotAllowed)
+	}
+}
@@ -0,0 +1,162 @@
+package water
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/refraction-networking/water/internal/log"
+)
+
+const (
+	// DefaultDialRetryAttempts is the number of attempts of each dial
+	// unless the Attempts of the DialRetry is set.
+	DefaultDialRetryAttempts = 3
+
+	// DefaultDialRetryBackoff is the delay before the first retry unless
+	// the Backoff of the DialRetry is set.
+	DefaultDialRetryBackoff = 100 * time.Millisecond
+
+	dialRetryMaxBackoff = 30 * time.Second
+)
+
+// DefaultRetryableDialErrors are the errors a dial is retried on unless
+// the RetryableErrors of the DialRetry is set, i.e., the transient
+// failures of the network, such as a connection reset during the
+// handshake of the WATM or a timeout.
+var DefaultRetryableDialErrors = []error{
+	syscall.ENOTCONN, // reported by a WATM of v1 if the host fails to connect
+	syscall.ECONNREFUSED,
+	syscall.ECONNRESET,
+	syscall.ECONNABORTED,
+	syscall.ETIMEDOUT,
+	os.ErrDeadlineExceeded,
+	io.EOF,
+	io.ErrUnexpectedEOF,
+}
+
+// DialRetry makes a Dialer retry the dials failing transiently, i.e.,
+// with one of the RetryableErrors, each with a new WASM instance, waiting
+// for an exponential backoff between the attempts. Only DialContext and
+// Dial are retried, not DialWithConn, whose connection is consumed by the
+// first attempt.
+type DialRetry struct {
+	// Attempts is the maximum number of attempts of each dial, including
+	// the first one, DefaultDialRetryAttempts if not positive.
+	Attempts int
+
+	// Backoff is the delay before the first retry, doubled before each
+	// further retry up to 30 seconds, DefaultDialRetryBackoff if not
+	// positive.
+	Backoff time.Duration
+
+	// RetryableErrors are the errors a dial is retried on, matched with
+	// errors.Is, DefaultRetryableDialErrors if nil.
+	RetryableErrors []error
+
+	// RotateEndpoints makes each retry dial the next endpoint of the
+	// Failover of the Config, i.e., the address requested, then each of
+	// the backup addresses in turn, instead of the address requested.
+	// Unlike the Failover alone, it moves on to the next endpoint even if
+	// the connection failed after being established, e.g., during the
+	// handshake of the WATM.
+	RotateEndpoints bool
+}
+
+// retryDialer retries the dials of the Dialer it wraps as its DialRetry
+// specifies.
+type retryDialer struct {
+	Dialer
+
+	config *Config
+}
+
+// newRetryDialer wraps d to retry its dials as the DialRetry of c
+// specifies, if set.
+func newRetryDialer(d Dialer, c *Config) Dialer {
+	if c.DialRetry == nil {
+		return d
+	}
+	return &retryDialer{
+		Dialer: d,
+		config: c.Clone(),
+	}
+}
+
+// Dial implements Dialer.Dial().
+func (d *retryDialer) Dial(network, address string) (Conn, error) {
+	return d.dial(context.Background(), address, func(address string) (Conn, error) {
+		return d.Dialer.Dial(network, address)
+	})
+}
+
+// DialContext implements Dialer.DialContext().
+func (d *retryDialer) DialContext(ctx context.Context, network, address string) (Conn, error) {
+	return d.dial(ctx, address, func(address string) (Conn, error) {
+		return d.Dialer.DialContext(ctx, network, address)
+	})
+}
+
+func (d *retryDialer) dial(ctx context.Context, address string, dial func(address string) (Conn, error)) (Conn, error) {
+	retry := d.config.DialRetry
+	attempts := retry.Attempts
+	if attempts <= 0 {
+		attempts = DefaultDialRetryAttempts
+	}
+	backoff := retry.Backoff
+	if backoff <= 0 {
+		backoff = DefaultDialRetryBackoff
+	}
+
+	endpoints := []string{address}
+	if retry.RotateEndpoints && d.config.Failover != nil {
+		endpoints = append(endpoints, d.config.Failover.Addresses...)
+	}
+
+	var errs []error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			timer := time.NewTimer(backoff)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, ctx.Err()
+			case <-timer.C:
+			}
+			backoff = min(2*backoff, dialRetryMaxBackoff)
+		}
+
+		endpoint := endpoints[attempt%len(endpoints)]
+		conn, err := dial(endpoint)
+		if err == nil {
+			return conn, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", endpoint, err))
+		if !d.retryable(err) || ctx.Err() != nil {
+			break
+		}
+		log.LDebugf(d.config.Logger(), "water: retrying dial of %s after error: %v", endpoint, err)
+	}
+
+	if len(errs) == 1 {
+		return nil, errors.Unwrap(errs[0])
+	}
+	return nil, fmt.Errorf("water: all %d attempts failed: %w", len(errs), errors.Join(errs...))
+}
+
+func (d *retryDialer) retryable(err error) bool {
+	retryableErrors := d.config.DialRetry.RetryableErrors
+	if retryableErrors == nil {
+		retryableErrors = DefaultRetryableDialErrors
+	}
+	for _, retryableErr := range retryableErrors {
+		if errors.Is(err, retryableErr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+package water_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/refraction-networking/water"
+	_ "github.com/refraction-networking/water/transport/v1"
+)
+
+func TestDialRetry(t *testing.T) {
+	tcpLis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcpLis.Close() // skipcq: GO-S2307
+	peers := acceptAll(tcpLis)
+
+	// the first two dials are reset
+	var dials int
+	config := &water.Config{
+		TransportModuleBin:  wasmPlain,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+		NetworkDialerFunc: func(network, address string) (net.Conn, error) {
+			dials++
+			if dials <= 2 {
+				return nil, &net.OpError{Op: "dial", Net: network, Err: syscall.ECONNRESET}
+			}
+			return net.Dial(network, address)
+		},
+		DialRetry: &water.DialRetry{Attempts: 3, Backoff: time.Millisecond},
+	}
+	dialer, err := water.NewDialerWithContext(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := dialer.DialContext(context.Background(), "tcp", tcpLis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close() // skipcq: GO-S2307
+	peerConn := <-peers
+	defer peerConn.Close() // skipcq: GO-S2307
+	if dials != 3 {
+		t.Errorf("dialed %d times, want 3", dials)
+	}
+
+	// the errors not retryable fail the dial right away
+	dials = 0
+	config = config.Clone()
+	config.DialRetry = &water.DialRetry{Attempts: 3, Backoff: time.Millisecond, RetryableErrors: []error{syscall.ETIMEDOUT}}
+	dialer, err = water.NewDialerWithContext(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conn, err := dialer.DialContext(context.Background(), "tcp", tcpLis.Addr().String()); err == nil {
+		conn.Close()
+		t.Fatal("DialContext() with an error not retryable returned no error")
+	}
+	if dials != 1 {
+		t.Errorf("dialed %d times with an error not retryable, want 1", dials)
+	}
+}
+
+func TestDialRetry_RotateEndpoints(t *testing.T) {
+	var dialed []string
+	dialer, err := water.NewDialerWithContext(context.Background(), &water.Config{
+		TransportModuleBin:  wasmPlain,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+		NetworkDialerFunc: func(network, address string) (net.Conn, error) {
+			dialed = append(dialed, address)
+			return nil, &net.OpError{Op: "dial", Net: network, Err: syscall.ECONNREFUSED}
+		},
+		Failover:  &water.Failover{Addresses: []string{"192.0.2.2:443"}},
+		DialRetry: &water.DialRetry{Attempts: 2, Backoff: time.Millisecond, RotateEndpoints: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = dialer.DialContext(context.Background(), "tcp", "192.0.2.1:443")
+	if !errors.Is(err, syscall.ENOTCONN) {
+		t.Fatalf("DialContext() returned %v, want the errors of all attempts", err)
+	}
+
+	// the retry starts at the backup address
+	if len(dialed) < 3 || dialed[0] != "192.0.2.1:443" || dialed[2] != "192.0.2.2:443" {
+		t.Errorf("dialed %v, want the retry to start at the backup address", dialed)
+	}
+}
@@ -0,0 +1,33 @@
+package water
+
+import (
+	"net"
+	"time"
+)
+
+// DialEvent describes a step in the life of a connection dialed by a
+// Dialer, as reported to the lifecycle callbacks of the Config, e.g., to
+// show the progress of the connection or to tell the time spent
+// connecting to the remote from the time spent in the handshake of the
+// WATM.
+type DialEvent struct {
+	// Network and Address are those requested to the Dialer.
+	Network string
+	Address string
+
+	// Start is the time the dial started.
+	Start time.Time
+
+	// Elapsed is the time from Start until the step.
+	Elapsed time.Duration
+
+	// NetConn is the network connection to the remote, once connected.
+	NetConn net.Conn
+
+	// Conn is the connection dialed, once the handshake is complete.
+	Conn Conn
+
+	// Err is the error the dial failed with, if any, for
+	// OnHandshakeComplete.
+	Err error
+}
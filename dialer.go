@@ -3,6 +3,8 @@ package water
 import (
 	"context"
 	"errors"
+	"fmt"
+	"net"
 )
 
 // Dialer dials a remote network address upon caller calling
@@ -29,9 +31,41 @@ type Dialer interface {
 	// and returns a superset of net.Conn.
 	DialContext(ctx context.Context, network, address string) (Conn, error)
 
+	// DialWithConn skips dialing the remote network address and instead
+	// runs the WebAssembly Transport Module over the given connection, which
+	// is already established by the caller (e.g., through a proxy, over a
+	// QUIC stream or a net.Pipe in tests).
+	//
+	// The returned Conn takes the ownership of conn and closes it when
+	// being closed.
+	DialWithConn(ctx context.Context, conn net.Conn) (Conn, error)
+
+	// Warm compiles and instantiates n WebAssembly instances in the
+	// background, so that the next n calls to DialContext skip the
+	// cold-start latency. The context only bounds the warming.
+	Warm(ctx context.Context, n int) error
+
+	// DialStats returns the counters of dials served with and without
+	// an instance warmed by Warm.
+	DialStats() DialStats
+
 	mustEmbedUnimplementedDialer()
 }
 
+// DialStats is a snapshot of the counters of a [Dialer] about warm and
+// cold dials.
+type DialStats struct {
+	// Warm is the number of instances warmed and not yet used.
+	Warm int
+
+	// WarmDials is the number of dials served with a warmed instance.
+	WarmDials uint64
+
+	// ColdDials is the number of dials which instantiated the WebAssembly
+	// Transport Module on the spot.
+	ColdDials uint64
+}
+
 type newDialerFunc func(context.Context, *Config) (Dialer, error)
 
 var (
@@ -59,6 +93,21 @@ func (*UnimplementedDialer) DialContext(_ context.Context, _, _ string) (Conn, e
 	return nil, ErrUnimplementedDialer
 }
 
+// DialWithConn implements Dialer.DialWithConn().
+func (*UnimplementedDialer) DialWithConn(_ context.Context, _ net.Conn) (Conn, error) {
+	return nil, ErrUnimplementedDialer
+}
+
+// Warm implements Dialer.Warm().
+func (*UnimplementedDialer) Warm(_ context.Context, _ int) error {
+	return ErrUnimplementedDialer
+}
+
+// DialStats implements Dialer.DialStats().
+func (*UnimplementedDialer) DialStats() DialStats {
+	return DialStats{}
+}
+
 // mustEmbedUnimplementedDialer is a function that developers cannot
 // manually implement. It is used to ensure forward compatibility of
 // the Dialer interface.
@@ -104,24 +153,61 @@ func NewDialer(c *Config) (Dialer, error) {
 //
 // The context SHOULD be used as the default context for call to [Dialer.Dial]
 // by the dialer implementation.
+//
+// If the DialRetry of the Config is set, the dials failing transiently are
+// retried.
+//
+// The Dialer keeps a copy of the Config, which must not be modified
+// afterwards, see ErrConfigMutated.
 func NewDialerWithContext(ctx context.Context, c *Config) (Dialer, error) {
+	c, err := c.snapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := newDialerWithContext(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	return newRetryDialer(d, c), nil
+}
+
+func newDialerWithContext(ctx context.Context, c *Config) (Dialer, error) {
+	if c.ProcessIsolation != nil {
+		if err := c.checkIsolation(); err != nil {
+			return nil, err
+		}
+		return newIsolatedDialer(ctx, c), nil
+	}
+
+	spec, err := negotiateVersion(c.TransportModuleBin)
+	if err != nil {
+		return nil, err
+	}
+	if spec != nil {
+		for _, name := range spec.exportNames(RoleDialer) {
+			if f, ok := knownDialerVersions[name]; ok {
+				return f(ctx, c)
+			}
+		}
+		return nil, versionRoleError(ErrDialerVersionNotFound, spec, RoleDialer)
+	}
+
 	core, err := NewCoreWithContext(ctx, c)
 	if err != nil {
 		return nil, err
 	}
+	defer core.Close() // skipcq: GO-S2307
 
-	// Search through all exported names and match them to potential
-	// Dialer versions.
-	//
-	// TODO: detect the version of the WebAssembly Transport Module
-	// in a more organized way.
+	// The WATM declares no version, search through all exported names
+	// and match them to potential Dialer versions.
 	for exportName := range core.Exports() {
 		if f, ok := knownDialerVersions[exportName]; ok {
 			return f(ctx, c)
 		}
 	}
 
-	return nil, ErrDialerVersionNotFound
+	return nil, versionNotFoundError(ErrDialerVersionNotFound, c.TransportModuleBin, RoleDialer)
 }
 
 // FixedDialer acts like a dialer, despite the fact that the destination is managed by
@@ -182,10 +268,33 @@ func RegisterWATMFixedDialer(name string, dialer newFixedDialerFunc) error {
 }
 
 func NewFixedDialerWithContext(ctx context.Context, cfg *Config) (FixedDialer, error) {
+	cfg, err := cfg.snapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.ProcessIsolation != nil {
+		return nil, fmt.Errorf("%w: FixedDialer", ErrProcessIsolationUnsupported)
+	}
+
+	spec, err := negotiateVersion(cfg.TransportModuleBin)
+	if err != nil {
+		return nil, err
+	}
+	if spec != nil {
+		for _, name := range spec.exportNames(RoleFixedDialer) {
+			if f, ok := knownFixedDialerVersions[name]; ok {
+				return f(ctx, cfg)
+			}
+		}
+		return nil, versionRoleError(ErrFixedDialerVersionNotFound, spec, RoleFixedDialer)
+	}
+
 	core, err := NewCoreWithContext(ctx, cfg)
 	if err != nil {
 		return nil, err
 	}
+	defer core.Close() // skipcq: GO-S2307
 
 	// Sniff the version of the dialer
 	for exportName := range core.Exports() {
@@ -194,5 +303,5 @@ func NewFixedDialerWithContext(ctx context.Context, cfg *Config) (FixedDialer, e
 		}
 	}
 
-	return nil, ErrFixedDialerVersionNotFound
+	return nil, versionNotFoundError(ErrFixedDialerVersionNotFound, cfg.TransportModuleBin, RoleFixedDialer)
 }
@@ -0,0 +1,324 @@
+package water
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/refraction-networking/water/internal/log"
+)
+
+// ErrDialerPoolClosed is returned by Get on a DialerPool already closed.
+var ErrDialerPoolClosed = errors.New("water: dialer pool closed")
+
+const (
+	dialerPoolMinRetryDelay = 100 * time.Millisecond
+	dialerPoolMaxRetryDelay = 30 * time.Second
+
+	// dialerPoolProbeTimeout is how long the default health check waits
+	// for a read on an idle Conn, which must time out if it is healthy.
+	dialerPoolProbeTimeout = time.Millisecond
+)
+
+// DialerPool maintains a number of Conns pre-established by a Dialer to a
+// fixed address, so that an application doing many short-lived requests
+// does not pay for the instantiation of the WebAssembly Transport Module
+// and the handshake on every request.
+//
+// A Conn handed out by Get belongs to the caller and is never returned to
+// the pool, which dials another one in the background to replace it. Idle
+// Conns are probed periodically and replaced if found broken.
+//
+// The exported fields must not be modified after the first call to Start
+// or Get.
+type DialerPool struct {
+	// Dialer dials the Conns in the pool. It must be set.
+	Dialer Dialer
+
+	// Network and Address are passed to Dialer.DialContext.
+	Network string
+	Address string
+
+	// Size is the number of idle Conns to maintain. If not positive, 1
+	// will be used.
+	Size int
+
+	// HealthCheckInterval is the interval between two health checks of
+	// each idle Conn. If zero, idle Conns are not checked.
+	HealthCheckInterval time.Duration
+
+	// HealthCheck reports whether an idle Conn is still usable by returning
+	// nil. It may also be used to send keepalive messages at the
+	// application layer.
+	//
+	// If nil, an idle Conn is considered broken if reading from it does not
+	// time out immediately, i.e., if it is closed by the remote or has
+	// received unexpected data.
+	HealthCheck func(Conn) error
+
+	// MaxIdleTime is the maximum amount of time a Conn may stay idle in the
+	// pool before being closed and replaced. If zero, there is no limit.
+	MaxIdleTime time.Duration
+
+	startOnce sync.Once
+	ctx       context.Context
+	cancel    context.CancelFunc
+
+	mu     sync.Mutex
+	idle   []dialerPoolConn
+	closed bool
+	wake   chan struct{} // signals the maintainer that an idle Conn was taken
+}
+
+type dialerPoolConn struct {
+	conn    Conn
+	idledAt time.Time
+}
+
+// NewDialerPool creates a DialerPool maintaining size idle Conns dialed
+// by dialer to address on network, and starts filling it.
+func NewDialerPool(dialer Dialer, network, address string, size int) *DialerPool {
+	p := &DialerPool{
+		Dialer:  dialer,
+		Network: network,
+		Address: address,
+		Size:    size,
+	}
+	p.Start()
+	return p
+}
+
+// Start starts dialing the idle Conns in the background. Calling it is
+// optional, as the first Get starts the pool if not already started, but
+// only a started pool has Conns ready to be handed out.
+func (p *DialerPool) Start() {
+	p.startOnce.Do(func() {
+		p.ctx, p.cancel = context.WithCancel(context.Background())
+		p.wake = make(chan struct{}, 1)
+
+		p.mu.Lock()
+		closed := p.closed
+		p.mu.Unlock()
+		if closed {
+			return
+		}
+
+		go p.maintain()
+	})
+}
+
+// Get hands out an idle Conn if available, or dials a new one with ctx
+// otherwise.
+func (p *DialerPool) Get(ctx context.Context) (Conn, error) {
+	p.Start()
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, ErrDialerPoolClosed
+	}
+	for len(p.idle) > 0 {
+		pc := p.idle[len(p.idle)-1]
+		p.idle = p.idle[:len(p.idle)-1]
+		if p.expired(pc, time.Now()) {
+			go pc.conn.Close() // skipcq: GO-S2307
+			continue
+		}
+		p.mu.Unlock()
+		p.signal()
+		return pc.conn, nil
+	}
+	p.mu.Unlock()
+
+	p.signal()
+	return p.Dialer.DialContext(ctx, p.Network, p.Address)
+}
+
+// Idle returns the number of idle Conns in the pool.
+func (p *DialerPool) Idle() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.idle)
+}
+
+// Close stops maintaining the pool and closes all idle Conns. Conns
+// already handed out are not affected. A dial in progress is not
+// interrupted, but its Conn is closed once established.
+func (p *DialerPool) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	idle := p.idle
+	p.idle = nil
+	p.mu.Unlock()
+
+	p.Start() // synchronizes with a concurrent Start, which does nothing once closed
+	p.cancel()
+
+	var errs []error
+	for _, pc := range idle {
+		if err := pc.conn.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (p *DialerPool) size() int {
+	if p.Size <= 0 {
+		return 1
+	}
+	return p.Size
+}
+
+func (p *DialerPool) signal() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (p *DialerPool) expired(pc dialerPoolConn, now time.Time) bool {
+	return p.MaxIdleTime > 0 && now.Sub(pc.idledAt) >= p.MaxIdleTime
+}
+
+// maintain keeps the pool filled and checks the idle Conns until the pool
+// is closed.
+func (p *DialerPool) maintain() {
+	var tick <-chan time.Time
+	if interval := p.checkInterval(); interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	retryDelay := dialerPoolMinRetryDelay
+	for {
+		if err := p.fill(); err != nil {
+			log.Debugf("water: DialerPool dialing %s %s: %v", p.Network, p.Address, err)
+
+			select {
+			case <-p.ctx.Done():
+				return
+			case <-time.After(retryDelay):
+			}
+			retryDelay = min(2*retryDelay, dialerPoolMaxRetryDelay)
+			continue
+		}
+		retryDelay = dialerPoolMinRetryDelay
+
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-p.wake:
+		case <-tick:
+			p.check()
+		}
+	}
+}
+
+// checkInterval returns the interval at which idle Conns are checked,
+// which is the shorter of HealthCheckInterval and MaxIdleTime.
+func (p *DialerPool) checkInterval() time.Duration {
+	interval := p.HealthCheckInterval
+	if p.MaxIdleTime > 0 && (interval <= 0 || p.MaxIdleTime < interval) {
+		interval = p.MaxIdleTime
+	}
+	return interval
+}
+
+// fill dials until there are Size idle Conns in the pool.
+func (p *DialerPool) fill() error {
+	for {
+		p.mu.Lock()
+		if p.closed || len(p.idle) >= p.size() {
+			p.mu.Unlock()
+			return nil
+		}
+		p.mu.Unlock()
+
+		// the Conn must outlive the pool once handed out, so it is not
+		// dialed with the context of the pool
+		conn, err := p.Dialer.DialContext(context.Background(), p.Network, p.Address)
+		if err != nil {
+			return err
+		}
+
+		p.mu.Lock()
+		if p.closed || len(p.idle) >= p.size() {
+			p.mu.Unlock()
+			return conn.Close()
+		}
+		p.idle = append(p.idle, dialerPoolConn{conn: conn, idledAt: time.Now()})
+		p.mu.Unlock()
+	}
+}
+
+// check takes the idle Conns out of the pool, closes those expired or
+// failing the health check, and puts the others back.
+func (p *DialerPool) check() {
+	p.mu.Lock()
+	idle := p.idle
+	p.idle = nil
+	p.mu.Unlock()
+
+	now := time.Now()
+	healthy := make([]dialerPoolConn, 0, len(idle))
+	for _, pc := range idle {
+		if p.expired(pc, now) {
+			pc.conn.Close()
+			continue
+		}
+		if p.HealthCheckInterval > 0 {
+			if err := p.healthCheck(pc.conn); err != nil {
+				log.Debugf("water: DialerPool closing unhealthy Conn: %v", err)
+				pc.conn.Close()
+				continue
+			}
+		}
+		healthy = append(healthy, pc)
+	}
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		for _, pc := range healthy {
+			pc.conn.Close()
+		}
+		return
+	}
+	p.idle = append(healthy, p.idle...)
+	p.mu.Unlock()
+}
+
+func (p *DialerPool) healthCheck(conn Conn) error {
+	if p.HealthCheck != nil {
+		return p.HealthCheck(conn)
+	}
+	return probeIdleConn(conn)
+}
+
+// probeIdleConn returns nil if reading from conn times out, which is
+// expected of a Conn nobody sent anything to.
+func probeIdleConn(conn net.Conn) error {
+	if err := conn.SetReadDeadline(time.Now().Add(dialerPoolProbeTimeout)); err != nil {
+		return err
+	}
+
+	var b [1]byte
+	_, err := conn.Read(b[:])
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		if err == nil {
+			err = errors.New("water: unexpected read on idle Conn")
+		}
+		return err
+	}
+
+	return conn.SetReadDeadline(time.Time{})
+}
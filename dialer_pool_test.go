@@ -0,0 +1,163 @@
+package water_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/refraction-networking/water"
+	_ "github.com/refraction-networking/water/transport/v1"
+)
+
+// acceptAll accepts connections on lis and sends them to the returned
+// channel until lis is closed.
+func acceptAll(lis net.Listener) <-chan net.Conn {
+	conns := make(chan net.Conn, 16)
+	go func() {
+		defer close(conns)
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			conns <- conn
+		}
+	}()
+	return conns
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDialerPool(t *testing.T) {
+	tcpLis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcpLis.Close() // skipcq: GO-S2307
+	peers := acceptAll(tcpLis)
+
+	dialer, err := water.NewDialer(&water.Config{
+		TransportModuleBin:  wasmPlain,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := water.NewDialerPool(dialer, "tcp", tcpLis.Addr().String(), 2)
+	defer pool.Close() // skipcq: GO-S2307
+
+	waitFor(t, func() bool { return pool.Idle() == 2 })
+
+	conn, err := pool.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close() // skipcq: GO-S2307
+
+	// the pool is refilled in the background
+	waitFor(t, func() bool { return pool.Idle() == 2 })
+
+	var peerConns []net.Conn
+	for i := 0; i < 3; i++ {
+		peerConns = append(peerConns, <-peers)
+	}
+	defer func() {
+		for _, c := range peerConns {
+			c.Close()
+		}
+	}()
+
+	// the Conn handed out must be connected to one of the peers
+	msg := []byte("hello")
+	if _, err := conn.Write(msg); err != nil {
+		t.Fatal(err)
+	}
+	if err := firstPeerToRead(peerConns, msg); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := pool.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if pool.Idle() != 0 {
+		t.Errorf("Idle() = %d after Close, want 0", pool.Idle())
+	}
+	if _, err := pool.Get(context.Background()); !errors.Is(err, water.ErrDialerPoolClosed) {
+		t.Errorf("Get() error = %v after Close, want %v", err, water.ErrDialerPoolClosed)
+	}
+}
+
+func TestDialerPool_HealthCheck(t *testing.T) {
+	tcpLis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcpLis.Close() // skipcq: GO-S2307
+	peers := acceptAll(tcpLis)
+
+	dialer, err := water.NewDialer(&water.Config{
+		TransportModuleBin:  wasmPlain,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := &water.DialerPool{
+		Dialer:              dialer,
+		Network:             "tcp",
+		Address:             tcpLis.Addr().String(),
+		HealthCheckInterval: 50 * time.Millisecond,
+	}
+	pool.Start()
+	defer pool.Close() // skipcq: GO-S2307
+
+	// the remote closing the idle Conn must get it replaced
+	first := <-peers
+	first.Close()
+
+	second := <-peers
+	defer second.Close() // skipcq: GO-S2307
+	waitFor(t, func() bool { return pool.Idle() == 1 })
+
+	conn, err := pool.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close() // skipcq: GO-S2307
+
+	msg := []byte("hello")
+	if _, err := conn.Write(msg); err != nil {
+		t.Fatal(err)
+	}
+	if err := firstPeerToRead([]net.Conn{second}, msg); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// firstPeerToRead returns nil if any of peers reads msg.
+func firstPeerToRead(peers []net.Conn, msg []byte) error {
+	buf := make([]byte, len(msg))
+	for _, peer := range peers {
+		if err := peer.SetReadDeadline(time.Now().Add(time.Second)); err != nil {
+			return err
+		}
+		n, err := peer.Read(buf)
+		if err == nil && string(buf[:n]) == string(msg) {
+			return nil
+		}
+	}
+	return errors.New("no peer read the message")
+}
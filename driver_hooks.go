@@ -0,0 +1,18 @@
+package water
+
+import "github.com/refraction-networking/water/internal/hooks"
+
+func init() {
+	hooks.Set(hooks.Funcs[Config, Conn, AcceptResult, TUN, WorkerPool, TransportModuleSpec, UnderlyingProtocol]{
+		RegisterWATMSpec:           registerWATMSpec,
+		RegisterUnderlyingProtocol: registerUnderlyingProtocol,
+		Snapshot:                   (*Config).snapshot,
+		Authorize:                  (*Config).authorize,
+		RelayConnsFor:              (*Config).relayConnsFor,
+		ContextHasModuleEnviron:    contextHasModuleEnviron,
+		OpenTUN:                    (*TUN).openFile,
+		GoWorker:                   (*WorkerPool).goFunc,
+		ServeAcceptResults:         serveAcceptResults,
+		ServeHandshakes:            serveHandshakes,
+	})
+}
@@ -0,0 +1,149 @@
+package water
+
+import (
+	"context"
+	"runtime"
+
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/experimental"
+)
+
+// ExecutionPool bounds the number of CPU-intensive operations on
+// WebAssembly modules running concurrently, including compilation,
+// instantiation, the calls into the WATM to initialize it and to set up
+// each connection (e.g., handshakes), and the worker thread of each
+// connection (e.g., `watm_start_v1`).
+//
+// Setting the same ExecutionPool in the Config of a Listener caps the
+// share of the machine spent on WebAssembly under a burst of incoming
+// connections, so it does not starve the application's own goroutines.
+//
+// A call into a WATM releases its slot while the WATM waits in a host
+// function, e.g., for I/O in poll_oneoff, and acquires one again before
+// the WATM resumes. So the worker threads of idle connections hold no
+// slot, and the pool bounds the WATMs running at once rather than the
+// connections, see WorkerPool for the latter. Pinning to specific CPUs is
+// not supported, as the Go runtime schedules goroutines across all OS
+// threads.
+//
+// A nil *ExecutionPool does not bound anything.
+type ExecutionPool struct {
+	slots chan struct{}
+}
+
+// NewExecutionPool creates an ExecutionPool allowing up to size
+// operations to run concurrently. If size is not positive,
+// runtime.GOMAXPROCS(0) will be used.
+func NewExecutionPool(size int) *ExecutionPool {
+	if size <= 0 {
+		size = runtime.GOMAXPROCS(0)
+	}
+
+	return &ExecutionPool{
+		slots: make(chan struct{}, size),
+	}
+}
+
+// NewExecutionPoolWithShare creates an ExecutionPool sized to the given
+// share (between 0 and 1) of runtime.GOMAXPROCS(0), with at least one
+// slot.
+func NewExecutionPoolWithShare(share float64) *ExecutionPool {
+	size := int(float64(runtime.GOMAXPROCS(0)) * share)
+	if size < 1 {
+		size = 1
+	}
+
+	return NewExecutionPool(size)
+}
+
+// Size returns the maximum number of operations allowed to run
+// concurrently, or 0 if p is nil.
+func (p *ExecutionPool) Size() int {
+	if p == nil {
+		return 0
+	}
+	return cap(p.slots)
+}
+
+// Acquire blocks until a slot is available or ctx is done. Each
+// successful Acquire must be paired with a Release.
+func (p *ExecutionPool) Acquire(ctx context.Context) error {
+	if p == nil {
+		return nil
+	}
+
+	select {
+	case p.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Release releases a slot acquired with Acquire.
+func (p *ExecutionPool) Release() {
+	if p == nil {
+		return
+	}
+	<-p.slots
+}
+
+// Call calls the WebAssembly function f once a slot is available.
+func (p *ExecutionPool) Call(ctx context.Context, f api.Function, params ...uint64) ([]uint64, error) {
+	if err := p.Acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer p.Release()
+
+	return f.Call(ctx, params...)
+}
+
+// executionPoolSlotKey is the context.Context key of the
+// *executionPoolSlot of a call into a WATM.
+type executionPoolSlotKey struct{}
+
+// executionPoolSlot tracks the slot of an ExecutionPool held by a call
+// into a WATM, released by executionPoolListener while the WATM waits in
+// a host function.
+type executionPoolSlot struct {
+	pool     *ExecutionPool
+	held     bool // to be released once the call returns
+	released bool // by the host function in progress, to be acquired again
+}
+
+// executionPoolListener is an experimental.FunctionListenerFactory
+// listening to the host functions, releasing the slot of the call into
+// the WATM calling them for their duration.
+type executionPoolListener struct{}
+
+// NewFunctionListener implements experimental.FunctionListenerFactory.
+func (executionPoolListener) NewFunctionListener(def api.FunctionDefinition) experimental.FunctionListener {
+	if def.GoFunction() == nil {
+		return nil
+	}
+	return executionPoolListener{}
+}
+
+// Before implements experimental.FunctionListener.
+func (executionPoolListener) Before(ctx context.Context, _ api.Module, _ api.FunctionDefinition, _ []uint64, _ experimental.StackIterator) {
+	if slot, ok := ctx.Value(executionPoolSlotKey{}).(*executionPoolSlot); ok && slot.held {
+		slot.pool.Release()
+		slot.held, slot.released = false, true
+	}
+}
+
+// After implements experimental.FunctionListener. If ctx is done before a
+// slot is available, the WATM resumes without one, to be interrupted.
+func (executionPoolListener) After(ctx context.Context, _ api.Module, _ api.FunctionDefinition, _ []uint64) {
+	if slot, ok := ctx.Value(executionPoolSlotKey{}).(*executionPoolSlot); ok && slot.released {
+		slot.released = false
+		slot.held = slot.pool.Acquire(ctx) == nil
+	}
+}
+
+// Abort implements experimental.FunctionListener.
+func (executionPoolListener) Abort(ctx context.Context, _ api.Module, _ api.FunctionDefinition, _ error) {
+	if slot, ok := ctx.Value(executionPoolSlotKey{}).(*executionPoolSlot); ok {
+		slot.released = false
+	}
+}
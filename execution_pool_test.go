@@ -0,0 +1,109 @@
+package water_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/refraction-networking/water"
+	_ "github.com/refraction-networking/water/transport/v1"
+)
+
+func TestExecutionPool(t *testing.T) {
+	pool := water.NewExecutionPool(1)
+	if pool.Size() != 1 {
+		t.Fatalf("Size() = %d, want 1", pool.Size())
+	}
+
+	if err := pool.Acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := pool.Acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Acquire() = %v on a full pool, want %v", err, context.DeadlineExceeded)
+	}
+
+	pool.Release()
+	if err := pool.Acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	pool.Release()
+
+	// a nil pool must not bound anything
+	var nilPool *water.ExecutionPool
+	if err := nilPool.Acquire(ctx); err != nil {
+		t.Fatal(err)
+	}
+	nilPool.Release()
+
+	if size := water.NewExecutionPoolWithShare(0).Size(); size != 1 {
+		t.Errorf("NewExecutionPoolWithShare(0).Size() = %d, want 1", size)
+	}
+}
+
+func TestExecutionPool_Dialer(t *testing.T) {
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close() // skipcq: GO-S2307
+
+	config := &water.Config{
+		TransportModuleBin: wasmPlain,
+		ExecutionPool:      water.NewExecutionPool(1),
+	}
+
+	dialer, err := water.NewDialerWithContext(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// connections must be set up one after another without deadlocking,
+	// as the worker thread of each releases its slot while waiting for
+	// I/O
+	for i := 0; i < 3; i++ {
+		conn, err := dialer.DialContext(context.Background(), "tcp", lis.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close() // skipcq: GO-S2307
+
+		peerConn, err := lis.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer peerConn.Close() // skipcq: GO-S2307
+
+		if err := conn.SetDeadline(time.Now().Add(5 * time.Second)); err != nil {
+			t.Fatal(err)
+		}
+		if err := peerConn.SetDeadline(time.Now().Add(5 * time.Second)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := conn.Write([]byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.ReadFull(peerConn, make([]byte, 5)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := peerConn.Write([]byte("world")); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.ReadFull(conn, make([]byte, 5)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the idle worker threads hold no slot
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := config.ExecutionPool.Acquire(ctx); err != nil {
+		t.Fatalf("Acquire() = %v with idle connections only", err)
+	}
+	config.ExecutionPool.Release()
+}
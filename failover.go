@@ -0,0 +1,88 @@
+package water
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync/atomic"
+)
+
+// ErrNoEndpoint is returned by a dial with Failover if there is no
+// endpoint to dial at all.
+var ErrNoEndpoint = errors.New("water: no endpoint to dial")
+
+// FailoverMode determines the order in which the endpoints are tried by
+// a Failover.
+type FailoverMode uint8
+
+const (
+	// FailoverInOrder tries the address requested first, then each of the
+	// backup addresses in the listed order.
+	FailoverInOrder FailoverMode = iota
+
+	// FailoverRoundRobin distributes the dials across the address
+	// requested and the backup addresses by starting each dial at the
+	// endpoint next to the one the previous dial started at, wrapping
+	// around the list until one succeeds.
+	FailoverRoundRobin
+)
+
+// Failover lists backup remote endpoints to be tried by the host, when the
+// WebAssembly Transport Module asks the host to dial, if dialing the
+// address requested fails. It is useful when a remote peer (e.g., a
+// bridge) is reachable at several addresses.
+//
+// Each endpoint is resolved with the Resolver of the Config, if set, and
+// the first connection established is returned to the WATM.
+type Failover struct {
+	// Addresses lists the backup addresses, on the same network as the
+	// address requested.
+	Addresses []string
+
+	// Mode determines the order in which the endpoints are tried.
+	Mode FailoverMode
+
+	next atomic.Uint32 // index of the endpoint the next dial starts at, for FailoverRoundRobin
+}
+
+// DialFunc wraps dialerFunc, returning a function dialing the address
+// requested or any of the backup addresses according to the Mode.
+func (f *Failover) DialFunc(dialerFunc func(network, address string) (net.Conn, error)) func(network, address string) (net.Conn, error) {
+	if f == nil {
+		return dialerFunc
+	}
+
+	return func(network, address string) (net.Conn, error) {
+		endpoints := f.endpoints(address)
+		if len(endpoints) == 0 {
+			return nil, ErrNoEndpoint
+		}
+
+		var errs []error
+		for _, endpoint := range endpoints {
+			conn, err := dialerFunc(network, endpoint)
+			if err == nil {
+				return conn, nil
+			}
+			errs = append(errs, fmt.Errorf("%s: %w", endpoint, err))
+		}
+
+		return nil, fmt.Errorf("water: all %d endpoints failed: %w", len(endpoints), errors.Join(errs...))
+	}
+}
+
+// endpoints returns the endpoints in the order they are to be tried.
+func (f *Failover) endpoints(address string) []string {
+	endpoints := make([]string, 0, len(f.Addresses)+1)
+	if address != "" {
+		endpoints = append(endpoints, address)
+	}
+	endpoints = append(endpoints, f.Addresses...)
+
+	if f.Mode == FailoverRoundRobin && len(endpoints) > 1 {
+		start := int(f.next.Add(1)-1) % len(endpoints)
+		endpoints = append(endpoints[start:], endpoints[:start]...)
+	}
+
+	return endpoints
+}
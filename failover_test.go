@@ -0,0 +1,94 @@
+package water_test
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/refraction-networking/water"
+)
+
+// recordingDialerFunc fails to dial any address not in reachable and records
+// all addresses dialed.
+func recordingDialerFunc(dialed *[]string, reachable ...string) func(network, address string) (net.Conn, error) {
+	return func(_, address string) (net.Conn, error) {
+		*dialed = append(*dialed, address)
+		for _, r := range reachable {
+			if address == r {
+				c1, c2 := net.Pipe()
+				c2.Close()
+				return c1, nil
+			}
+		}
+		return nil, errors.New("unreachable")
+	}
+}
+
+func TestFailover_DialFunc(t *testing.T) {
+	t.Run("InOrder", func(t *testing.T) {
+		var dialed []string
+		config := &water.Config{
+			NetworkDialerFunc: recordingDialerFunc(&dialed, "backup2:443"),
+			Failover:          &water.Failover{Addresses: []string{"backup1:443", "backup2:443"}},
+		}
+
+		dialerFunc := config.NetworkDialerFuncOrDefault()
+		for i := 0; i < 2; i++ {
+			conn, err := dialerFunc("tcp", "primary:443")
+			if err != nil {
+				t.Fatal(err)
+			}
+			conn.Close()
+		}
+
+		want := []string{"primary:443", "backup1:443", "backup2:443", "primary:443", "backup1:443", "backup2:443"}
+		if !reflect.DeepEqual(dialed, want) {
+			t.Errorf("dialed %v, want %v", dialed, want)
+		}
+	})
+
+	t.Run("RoundRobin", func(t *testing.T) {
+		var dialed []string
+		config := &water.Config{
+			NetworkDialerFunc: recordingDialerFunc(&dialed, "primary:443", "backup1:443", "backup2:443"),
+			Failover:          &water.Failover{Addresses: []string{"backup1:443", "backup2:443"}, Mode: water.FailoverRoundRobin},
+		}
+
+		// the order is shared by clones
+		for i := 0; i < 4; i++ {
+			conn, err := config.Clone().NetworkDialerFuncOrDefault()("tcp", "primary:443")
+			if err != nil {
+				t.Fatal(err)
+			}
+			conn.Close()
+		}
+
+		want := []string{"primary:443", "backup1:443", "backup2:443", "primary:443"}
+		if !reflect.DeepEqual(dialed, want) {
+			t.Errorf("dialed %v, want %v", dialed, want)
+		}
+	})
+
+	t.Run("AllFailed", func(t *testing.T) {
+		var dialed []string
+		config := &water.Config{
+			NetworkDialerFunc: recordingDialerFunc(&dialed),
+			Failover:          &water.Failover{Addresses: []string{"backup1:443"}},
+		}
+
+		if _, err := config.NetworkDialerFuncOrDefault()("tcp", "primary:443"); err == nil {
+			t.Fatal("dial must fail when all endpoints are unreachable")
+		}
+		if len(dialed) != 2 {
+			t.Errorf("dialed %v, want both endpoints", dialed)
+		}
+	})
+
+	t.Run("NoEndpoint", func(t *testing.T) {
+		config := &water.Config{Failover: &water.Failover{}}
+		if _, err := config.NetworkDialerFuncOrDefault()("tcp", ""); !errors.Is(err, water.ErrNoEndpoint) {
+			t.Errorf("got error %v, want %v", err, water.ErrNoEndpoint)
+		}
+	})
+}
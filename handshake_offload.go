@@ -0,0 +1,82 @@
+package water
+
+import (
+	"errors"
+	"net"
+	"sync"
+)
+
+// ErrHandshakeTimeout is returned for an incoming connection whose WATM
+// is not ready within the HandshakeTimeout.
+var ErrHandshakeTimeout = errors.New("water: handshake timed out")
+
+// serveHandshakes calls acceptNetworkConn in a loop from a new goroutine,
+// and handshake for each network connection accepted from other
+// goroutines, up to concurrency at once, delivering each result on the
+// returned channel until done is closed, for a Listener with the
+// HandshakeConcurrency set. A Conn still undelivered when done is closed
+// is closed instead of leaked. The channel is closed once all handshakes
+// in progress return after done is closed.
+//
+// The handshakes in progress and the Conns ready but not yet delivered
+// count against concurrency, so the network connections are no longer
+// accepted while the caller is not accepting Conns.
+func serveHandshakes(concurrency int, acceptNetworkConn func() (net.Conn, error), handshake func(net.Conn) AcceptResult, done <-chan struct{}) <-chan AcceptResult {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	results := make(chan AcceptResult)
+	deliver := func(res AcceptResult) bool {
+		select {
+		case results <- res:
+			return true
+		case <-done:
+			if res.Conn != nil {
+				res.Conn.Close()
+			}
+			return false
+		}
+	}
+
+	slots := make(chan struct{}, concurrency)
+	go func() {
+		var wg sync.WaitGroup
+		defer func() {
+			wg.Wait()
+			close(results)
+		}()
+
+		for {
+			select {
+			case slots <- struct{}{}:
+			case <-done:
+				return
+			}
+
+			netConn, err := acceptNetworkConn()
+			if err != nil {
+				<-slots
+
+				// errors caused by closing the Listener are not delivered
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if !deliver(AcceptResult{Err: err}) {
+					return
+				}
+				continue
+			}
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() { <-slots }()
+				deliver(handshake(netConn))
+			}()
+		}
+	}()
+	return results
+}
@@ -0,0 +1,57 @@
+package water_test
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/refraction-networking/water"
+	"github.com/refraction-networking/water/internal/driver"
+)
+
+func TestServeHandshakes(t *testing.T) {
+	netConns := make(chan net.Conn, 2)
+	slow, fast := &addrConn{remote: &net.TCPAddr{Port: 1}}, &addrConn{remote: &net.TCPAddr{Port: 2}}
+	netConns <- slow
+	netConns <- fast
+
+	release := make(chan struct{})
+	done := make(chan struct{})
+	results := driver.ServeHandshakes(2,
+		func() (net.Conn, error) {
+			select {
+			case conn := <-netConns:
+				return conn, nil
+			case <-done:
+				return nil, net.ErrClosed
+			}
+		},
+		func(netConn net.Conn) water.AcceptResult {
+			if netConn == slow {
+				<-release
+			}
+			return water.AcceptResult{RemoteAddr: netConn.RemoteAddr(), Err: errors.New("handshaken")}
+		},
+		done,
+	)
+
+	// the slow handshake must not hold back the fast one
+	select {
+	case res := <-results:
+		if res.RemoteAddr != fast.remote {
+			t.Fatalf("first result is for %v, want %v", res.RemoteAddr, fast.remote)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("fast handshake held back by the slow one")
+	}
+
+	close(release)
+	if res := <-results; res.RemoteAddr != slow.remote {
+		t.Fatalf("second result is for %v, want %v", res.RemoteAddr, slow.remote)
+	}
+
+	close(done)
+	for range results { // must be closed once done
+	}
+}
@@ -0,0 +1,64 @@
+package water
+
+import (
+	"errors"
+)
+
+// ErrHardenUnsupported is returned by Harden on the platforms where the
+// process cannot be hardened, or by the layers of hardening unsupported
+// by the kernel unless the BestEffort of the HardenPolicy is set.
+var ErrHardenUnsupported = errors.New("water: hardening is not supported")
+
+// HardenPolicy describes the restrictions applied by Harden. The zero
+// HardenPolicy is the most restrictive one, suitable for a pure relay
+// workload which only needs the network once the WATMs are loaded.
+type HardenPolicy struct {
+	// ReadPaths are the files and directories, including everything
+	// beneath them, left readable once the filesystem is restricted, e.g.,
+	// "/etc/resolv.conf" and "/etc/hosts" for resolving hostnames, or the
+	// directory of a WatchedConfig. Paths which do not exist are skipped.
+	ReadPaths []string
+
+	// WritePaths are the files and directories, including everything
+	// beneath them, left readable and writable once the filesystem is
+	// restricted, e.g., the directory of a CrashDumpSink or of a
+	// CompilationCache. Paths which do not exist are skipped.
+	WritePaths []string
+
+	// UnrestrictedFilesystem leaves the filesystem unrestricted, ignoring
+	// ReadPaths and WritePaths.
+	UnrestrictedFilesystem bool
+
+	// AllowExec leaves the process able to execute programs, e.g., for
+	// the child processes of ProcessIsolation. Once the filesystem is
+	// restricted, only the executable of the process and the programs
+	// beneath the ReadPaths may be executed, and the shared libraries
+	// they load, if any, have to be beneath the ReadPaths as well.
+	AllowExec bool
+
+	// BestEffort skips the layers of hardening unsupported by the kernel,
+	// e.g., Landlock before Linux 5.13, instead of failing with
+	// ErrHardenUnsupported.
+	BestEffort bool
+}
+
+// Harden irreversibly restricts what the current process, including all
+// of its threads, is able to do, reducing the blast radius of a bug in
+// the WebAssembly runtime or in a WATM exploited by a remote peer. It is
+// meant to be called once the Dialers, Listeners or Relays are set up,
+// and the WATMs loaded.
+//
+// On Linux, on amd64 and arm64, the process is no longer able to gain
+// privileges (no_new_privs), and:
+//   - Landlock denies any access to the filesystem beyond the ReadPaths
+//     and the WritePaths, unless UnrestrictedFilesystem is set. It is
+//     unsupported if the program is built with cgo.
+//   - A seccomp-bpf filter fails the system calls a relay has no use for
+//     with EPERM, e.g., ptrace, mount, bpf, kexec_load, the loading of
+//     kernel modules, unshare and setns, and execve unless AllowExec is
+//     set.
+//
+// On other platforms, it fails with ErrHardenUnsupported.
+func Harden(policy HardenPolicy) error {
+	return harden(policy)
+}
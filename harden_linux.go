@@ -0,0 +1,245 @@
+//go:build linux && (amd64 || arm64)
+
+package water
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"syscall"
+	"unsafe"
+
+	"github.com/refraction-networking/water/internal/log"
+)
+
+// The system calls and constants of Landlock and seccomp, which package
+// syscall lacks.
+const (
+	sysLandlockCreateRuleset = 444
+	sysLandlockAddRule       = 445
+	sysLandlockRestrictSelf  = 446
+
+	landlockCreateRulesetVersion = 1 << 0
+	landlockRulePathBeneath      = 1
+
+	prSetNoNewPrivs = 0x26
+	oPath           = 0x200000
+
+	seccompSetModeFilter   = 1
+	seccompFilterFlagTsync = 1 << 0
+	seccompRetAllow        = 0x7fff0000
+	seccompRetErrno        = 0x00050000
+
+	// the system calls of the x32 ABI have this bit set on amd64
+	x32SyscallBit = 0x40000000
+)
+
+// The access rights to the filesystem of Landlock.
+const (
+	landlockAccessFsExecute    = 1 << 0
+	landlockAccessFsWriteFile  = 1 << 1
+	landlockAccessFsReadFile   = 1 << 2
+	landlockAccessFsReadDir    = 1 << 3
+	landlockAccessFsRemoveDir  = 1 << 4
+	landlockAccessFsRemoveFile = 1 << 5
+	landlockAccessFsMakeChar   = 1 << 6
+	landlockAccessFsMakeDir    = 1 << 7
+	landlockAccessFsMakeReg    = 1 << 8
+	landlockAccessFsMakeSock   = 1 << 9
+	landlockAccessFsMakeFifo   = 1 << 10
+	landlockAccessFsMakeBlock  = 1 << 11
+	landlockAccessFsMakeSym    = 1 << 12
+	landlockAccessFsRefer      = 1 << 13 // ABI 2
+	landlockAccessFsTruncate   = 1 << 14 // ABI 3
+	landlockAccessFsIoctlDev   = 1 << 15 // ABI 5
+
+	// the rights which apply to files, not only to directories
+	landlockAccessFsFile = landlockAccessFsExecute | landlockAccessFsWriteFile | landlockAccessFsReadFile |
+		landlockAccessFsTruncate | landlockAccessFsIoctlDev
+
+	landlockAccessFsRead  = landlockAccessFsReadFile | landlockAccessFsReadDir
+	landlockAccessFsWrite = landlockAccessFsRead | landlockAccessFsWriteFile | landlockAccessFsRemoveDir |
+		landlockAccessFsRemoveFile | landlockAccessFsMakeDir | landlockAccessFsMakeReg |
+		landlockAccessFsMakeSym | landlockAccessFsRefer | landlockAccessFsTruncate
+)
+
+func harden(policy HardenPolicy) error {
+	// no_new_privs is required by both Landlock and seccomp
+	if _, _, errno := syscall.AllThreadsSyscall(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0); errno != 0 {
+		if errno != syscall.ENOTSUP { // unless built with cgo, see seccomp
+			return fmt.Errorf("water: setting no_new_privs: %w", errno)
+		}
+	}
+
+	if !policy.UnrestrictedFilesystem {
+		if err := landlockRestrict(policy.ReadPaths, policy.WritePaths, policy.AllowExec); err != nil {
+			if !policy.BestEffort || !errors.Is(err, ErrHardenUnsupported) {
+				return err
+			}
+			log.Warnf("water: skipping Landlock: %v", err)
+		}
+	}
+
+	denied := hardenedSyscalls
+	if !policy.AllowExec {
+		denied = append(denied[:len(denied):len(denied)], execSyscalls...)
+	}
+	if err := seccompDeny(denied); err != nil {
+		if !policy.BestEffort || !errors.Is(err, ErrHardenUnsupported) {
+			return err
+		}
+		log.Warnf("water: skipping seccomp: %v", err)
+	}
+	return nil
+}
+
+// landlockRestrict denies any access to the filesystem beyond the paths
+// given to all threads of the process. If allowExec, the readPaths and the
+// executable of the process, e.g., for the child processes of
+// ProcessIsolation, are left executable.
+func landlockRestrict(readPaths, writePaths []string, allowExec bool) error {
+	abi, _, errno := syscall.Syscall(sysLandlockCreateRuleset, 0, 0, landlockCreateRulesetVersion)
+	if errno != 0 {
+		if errno == syscall.ENOSYS || errno == syscall.EOPNOTSUPP {
+			return fmt.Errorf("%w: Landlock: %w", ErrHardenUnsupported, errno)
+		}
+		return fmt.Errorf("water: querying Landlock ABI: %w", errno)
+	}
+
+	var handled uint64
+	switch {
+	case abi >= 5:
+		handled = landlockAccessFsIoctlDev<<1 - 1
+	case abi >= 3:
+		handled = landlockAccessFsTruncate<<1 - 1
+	case abi == 2:
+		handled = landlockAccessFsRefer<<1 - 1
+	default:
+		handled = landlockAccessFsMakeSym<<1 - 1
+	}
+
+	rulesetAttr := struct{ handledAccessFs uint64 }{handled}
+	rulesetFd, _, errno := syscall.Syscall(sysLandlockCreateRuleset, uintptr(unsafe.Pointer(&rulesetAttr)), unsafe.Sizeof(rulesetAttr), 0)
+	if errno != 0 {
+		return fmt.Errorf("water: creating Landlock ruleset: %w", errno)
+	}
+	defer syscall.Close(int(rulesetFd))
+
+	readAccess := uint64(landlockAccessFsRead)
+	if allowExec {
+		readAccess |= landlockAccessFsExecute
+		if executable, err := os.Executable(); err == nil {
+			readPaths = append(readPaths[:len(readPaths):len(readPaths)], executable)
+		}
+	}
+
+	for _, rule := range []struct {
+		paths  []string
+		access uint64
+	}{
+		{readPaths, readAccess},
+		{writePaths, landlockAccessFsWrite},
+	} {
+		for _, path := range rule.paths {
+			if err := landlockAllow(int(rulesetFd), path, rule.access&handled); err != nil {
+				return err
+			}
+		}
+	}
+
+	if _, _, errno := syscall.AllThreadsSyscall(sysLandlockRestrictSelf, rulesetFd, 0, 0); errno != 0 {
+		if errno == syscall.ENOTSUP {
+			return fmt.Errorf("%w: Landlock with cgo", ErrHardenUnsupported)
+		}
+		return fmt.Errorf("water: enforcing Landlock ruleset: %w", errno)
+	}
+	return nil
+}
+
+// landlockAllow adds a rule allowing access to path, and everything
+// beneath it, to the ruleset. A path which does not exist is skipped.
+func landlockAllow(rulesetFd int, path string, access uint64) error {
+	fd, err := syscall.Open(path, oPath|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("water: opening %s for Landlock: %w", path, err)
+	}
+	defer syscall.Close(fd)
+
+	var stat syscall.Stat_t
+	if err := syscall.Fstat(fd, &stat); err != nil {
+		return fmt.Errorf("water: opening %s for Landlock: %w", path, err)
+	}
+	if stat.Mode&syscall.S_IFMT != syscall.S_IFDIR {
+		access &= landlockAccessFsFile
+	}
+
+	// struct landlock_path_beneath_attr is packed
+	var attr [12]byte
+	*(*uint64)(unsafe.Pointer(&attr[0])) = access
+	*(*int32)(unsafe.Pointer(&attr[8])) = int32(fd)
+	if _, _, errno := syscall.Syscall6(sysLandlockAddRule, uintptr(rulesetFd), landlockRulePathBeneath, uintptr(unsafe.Pointer(&attr)), 0, 0, 0); errno != 0 {
+		return fmt.Errorf("water: adding Landlock rule for %s: %w", path, errno)
+	}
+	return nil
+}
+
+// seccompDeny installs a seccomp-bpf filter failing the system calls
+// given, and any system call of another architecture, with EPERM on all
+// threads of the process.
+func seccompDeny(syscalls []uint32) error {
+	const (
+		bpfLdWAbs = 0x20 // BPF_LD | BPF_W | BPF_ABS
+		bpfJeqK   = 0x15 // BPF_JMP | BPF_JEQ | BPF_K
+		bpfJgeK   = 0x35 // BPF_JMP | BPF_JGE | BPF_K
+		bpfRetK   = 0x06 // BPF_RET | BPF_K
+
+		// offsets in struct seccomp_data
+		offsetNr   = 0
+		offsetArch = 4
+	)
+
+	filter := []syscall.SockFilter{
+		{Code: bpfLdWAbs, K: offsetArch},
+		{Code: bpfJeqK, Jt: 1, K: auditArch},
+		{Code: bpfRetK, K: seccompRetErrno | uint32(syscall.EPERM)},
+		{Code: bpfLdWAbs, K: offsetNr},
+		{Code: bpfJgeK, K: x32SyscallBit},
+	}
+	for _, nr := range syscalls {
+		filter = append(filter, syscall.SockFilter{Code: bpfJeqK, K: nr})
+	}
+	filter = append(filter,
+		syscall.SockFilter{Code: bpfRetK, K: seccompRetAllow},
+		syscall.SockFilter{Code: bpfRetK, K: seccompRetErrno | uint32(syscall.EPERM)},
+	)
+
+	// the jumps of the checks of the system call number go to the last
+	// instruction, failing it
+	deny := len(filter) - 1
+	for i := 4; i < deny-1; i++ {
+		filter[i].Jt = uint8(deny - i - 1)
+	}
+
+	prog := syscall.SockFprog{Len: uint16(len(filter)), Filter: &filter[0]}
+
+	// if built with cgo, no_new_privs is set for the calling thread only,
+	// which has to install the filter to synchronize all threads with it
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0); errno != 0 {
+		return fmt.Errorf("water: setting no_new_privs: %w", errno)
+	}
+
+	if _, _, errno := syscall.RawSyscall(sysSeccomp, seccompSetModeFilter, seccompFilterFlagTsync, uintptr(unsafe.Pointer(&prog))); errno != 0 {
+		if errno == syscall.ENOSYS || errno == syscall.EINVAL {
+			return fmt.Errorf("%w: seccomp: %w", ErrHardenUnsupported, errno)
+		}
+		return fmt.Errorf("water: installing seccomp filter: %w", errno)
+	}
+	runtime.KeepAlive(filter)
+	return nil
+}
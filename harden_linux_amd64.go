@@ -0,0 +1,47 @@
+package water
+
+const (
+	auditArch  = 0xc000003e // AUDIT_ARCH_X86_64
+	sysSeccomp = 317
+)
+
+// execSyscalls are the system calls denied by Harden unless AllowExec.
+var execSyscalls = []uint32{
+	59,  // execve
+	322, // execveat
+}
+
+// hardenedSyscalls are the system calls always denied by Harden.
+var hardenedSyscalls = []uint32{
+	57,  // fork
+	58,  // vfork
+	101, // ptrace
+	310, // process_vm_readv
+	311, // process_vm_writev
+	135, // personality
+	155, // pivot_root
+	161, // chroot
+	163, // acct
+	165, // mount
+	166, // umount2
+	167, // swapon
+	168, // swapoff
+	169, // reboot
+	172, // iopl
+	173, // ioperm
+	175, // init_module
+	176, // delete_module
+	313, // finit_module
+	246, // kexec_load
+	320, // kexec_file_load
+	248, // add_key
+	249, // request_key
+	250, // keyctl
+	272, // unshare
+	308, // setns
+	298, // perf_event_open
+	303, // name_to_handle_at
+	304, // open_by_handle_at
+	321, // bpf
+	323, // userfaultfd
+}
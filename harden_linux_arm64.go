@@ -0,0 +1,43 @@
+package water
+
+const (
+	auditArch  = 0xc00000b7 // AUDIT_ARCH_AARCH64
+	sysSeccomp = 277
+)
+
+// execSyscalls are the system calls denied by Harden unless AllowExec.
+var execSyscalls = []uint32{
+	221, // execve
+	281, // execveat
+}
+
+// hardenedSyscalls are the system calls always denied by Harden.
+var hardenedSyscalls = []uint32{
+	117, // ptrace
+	270, // process_vm_readv
+	271, // process_vm_writev
+	92,  // personality
+	41,  // pivot_root
+	51,  // chroot
+	89,  // acct
+	40,  // mount
+	39,  // umount2
+	224, // swapon
+	225, // swapoff
+	142, // reboot
+	105, // init_module
+	106, // delete_module
+	273, // finit_module
+	104, // kexec_load
+	294, // kexec_file_load
+	217, // add_key
+	218, // request_key
+	219, // keyctl
+	97,  // unshare
+	268, // setns
+	241, // perf_event_open
+	264, // name_to_handle_at
+	265, // open_by_handle_at
+	280, // bpf
+	282, // userfaultfd
+}
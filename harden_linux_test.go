@@ -0,0 +1,115 @@
+//go:build amd64 || arm64
+
+package water_test
+
+import (
+	"errors"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/refraction-networking/water"
+)
+
+// hardenTestEnv makes the test run in a child process, as Harden cannot be
+// undone.
+const hardenTestEnv = "WATER_TEST_HARDEN"
+
+func TestHarden(t *testing.T) {
+	if os.Getenv(hardenTestEnv) == "" {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestHarden$", "-test.v")
+		cmd.Env = append(os.Environ(), hardenTestEnv+"="+t.TempDir())
+		out, err := cmd.CombinedOutput()
+		t.Logf("hardened process:\n%s", out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	dir := os.Getenv(hardenTestEnv)
+	readable := filepath.Join(dir, "readable")
+	if err := os.WriteFile(readable, []byte("hello"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	hidden := filepath.Join(dir, "hidden")
+	if err := os.WriteFile(hidden, []byte("hello"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tcpLis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcpLis.Close() // skipcq: GO-S2307
+
+	if err := water.Harden(water.HardenPolicy{
+		ReadPaths:  []string{readable, filepath.Join(dir, "missing")},
+		BestEffort: true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr // not to open /dev/null
+	if err := cmd.Run(); !errors.Is(err, syscall.EPERM) {
+		t.Errorf("executing a program returned %v, want EPERM", err)
+	}
+
+	if _, err := os.ReadFile(readable); err != nil {
+		t.Errorf("reading a path of ReadPaths returned %v", err)
+	}
+	if _, err := os.ReadFile(hidden); err == nil {
+		t.Log("Landlock is unavailable, e.g., with cgo, the filesystem is unrestricted")
+	} else if !errors.Is(err, syscall.EACCES) {
+		t.Errorf("reading a path out of ReadPaths returned %v, want EACCES", err)
+	}
+
+	// the network is left usable
+	conn, err := net.Dial("tcp", tcpLis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+}
+
+func TestHarden_AllowExec(t *testing.T) {
+	if os.Getenv(hardenTestEnv) == "" {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestHarden_AllowExec$", "-test.v")
+		cmd.Env = append(os.Environ(), hardenTestEnv+"="+t.TempDir())
+		out, err := cmd.CombinedOutput()
+		t.Logf("hardened process:\n%s", out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	dir := os.Getenv(hardenTestEnv)
+	hidden := filepath.Join(dir, "hidden")
+	if err := os.WriteFile(hidden, []byte("hello"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := water.Harden(water.HardenPolicy{
+		AllowExec:  true,
+		BestEffort: true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.ReadFile(hidden); err == nil {
+		t.Log("Landlock is unavailable, e.g., with cgo, the filesystem is unrestricted")
+	}
+
+	// the executable of the process is left executable, e.g., for the
+	// child processes of ProcessIsolation
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr // not to open /dev/null
+	if err := cmd.Run(); err != nil {
+		t.Errorf("executing the executable of the process returned %v", err)
+	}
+}
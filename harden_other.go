@@ -0,0 +1,9 @@
+//go:build !linux || !(amd64 || arm64)
+
+package water
+
+// harden fails with ErrHardenUnsupported, as neither Landlock nor seccomp
+// is available on this platform.
+func harden(HardenPolicy) error {
+	return ErrHardenUnsupported
+}
@@ -0,0 +1,83 @@
+package water
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+)
+
+// NetDialer adapts a Dialer to the signatures of the Dial and DialContext
+// methods of net.Dialer, returning a net.Conn instead of a Conn. It can
+// thus be used wherever the standard library or third-party packages take
+// a dial function, e.g., as http.Transport.DialContext or as a
+// proxy.ContextDialer of golang.org/x/net/proxy.
+type NetDialer struct {
+	Dialer Dialer
+}
+
+// Dial implements net.Dialer.Dial.
+func (d *NetDialer) Dial(network, address string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, address)
+}
+
+// DialContext implements net.Dialer.DialContext.
+//
+// Unlike Dialer.DialContext, the context only bounds dialing, as with
+// net.Dialer: once the Conn is returned, canceling the context does not
+// close it. This matters for connections outliving the context they are
+// dialed with, e.g., an http.Transport reusing the connection dialed for
+// a request for the next ones.
+func (d *NetDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if d.Dialer == nil {
+		return nil, errors.New("water: dialing with nil Dialer is not allowed")
+	}
+
+	type dialResult struct {
+		conn Conn
+		err  error
+	}
+	dialed := make(chan dialResult, 1)
+	go func() {
+		conn, err := d.Dialer.DialContext(context.WithoutCancel(ctx), network, address)
+		dialed <- dialResult{conn, err}
+	}()
+
+	select {
+	case res := <-dialed:
+		if res.err != nil {
+			return nil, res.err
+		}
+		return res.conn, nil
+	case <-ctx.Done():
+		go func() {
+			if res := <-dialed; res.err == nil {
+				res.conn.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+// HTTPTransport creates an http.Transport dialing each connection through
+// the WebAssembly Transport Module in the Config, so that an HTTP client
+// rides the WATM with:
+//
+//	transport, err := water.HTTPTransport(config)
+//	client := &http.Client{Transport: transport}
+//
+// The http.Transport is otherwise configured as http.DefaultTransport,
+// except that no proxy is used regardless of the environment, since the
+// connections are already dialed by the WATM. HTTPS requests run TLS over
+// the Conn, i.e., within the transport of the WATM.
+func HTTPTransport(c *Config) (*http.Transport, error) {
+	dialer, err := NewDialerWithContext(context.Background(), c)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = (&NetDialer{Dialer: dialer}).DialContext
+	return transport, nil
+}
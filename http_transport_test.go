@@ -0,0 +1,56 @@
+package water_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/refraction-networking/water"
+	_ "github.com/refraction-networking/water/transport/v1"
+)
+
+func TestHTTPTransport(t *testing.T) {
+	// the plain WATM leaves the traffic untouched, so any HTTP server is
+	// able to serve the requests sent through it
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("hello over water"))
+	}))
+	defer server.Close() // skipcq: GO-S2307
+
+	transport, err := water.HTTPTransport(&water.Config{
+		TransportModuleBin:  wasmPlain,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer transport.CloseIdleConnections()
+
+	client := &http.Client{Transport: transport}
+
+	// the connection reused by the second request must outlive the
+	// context of the first one
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		cancel()
+		if err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+		if string(body) != "hello over water" {
+			t.Errorf("request %d: body = %q, want %q", i, body, "hello over water")
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package driver
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/refraction-networking/water"
+)
+
+// ConnStatsRecorder records the data exchanged through a Conn for
+// water.Conn.Stats. The zero value is ready to use and it is safe for
+// concurrent use.
+type ConnStatsRecorder struct {
+	bytesRead    atomic.Uint64
+	bytesWritten atomic.Uint64
+	reads        atomic.Uint64
+	writes       atomic.Uint64
+	lastRead     atomic.Int64 // in UnixNano
+	lastWrite    atomic.Int64 // in UnixNano
+}
+
+// RecordRead records a read of n bytes, if any.
+func (r *ConnStatsRecorder) RecordRead(n int64) {
+	if n <= 0 {
+		return
+	}
+	r.bytesRead.Add(uint64(n))
+	r.reads.Add(1)
+	r.lastRead.Store(time.Now().UnixNano())
+}
+
+// RecordWrite records a write of n bytes, if any.
+func (r *ConnStatsRecorder) RecordWrite(n int64) {
+	if n <= 0 {
+		return
+	}
+	r.bytesWritten.Add(uint64(n))
+	r.writes.Add(1)
+	r.lastWrite.Store(time.Now().UnixNano())
+}
+
+// Stats returns a snapshot of the ConnStats recorded.
+func (r *ConnStatsRecorder) Stats() water.ConnStats {
+	return water.ConnStats{
+		BytesRead:    r.bytesRead.Load(),
+		BytesWritten: r.bytesWritten.Load(),
+		Reads:        r.reads.Load(),
+		Writes:       r.writes.Load(),
+		LastRead:     unixNanoTime(r.lastRead.Load()),
+		LastWrite:    unixNanoTime(r.lastWrite.Load()),
+	}
+}
+
+func unixNanoTime(nsec int64) time.Time {
+	if nsec == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nsec)
+}
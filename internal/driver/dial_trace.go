@@ -0,0 +1,91 @@
+package driver
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/refraction-networking/water"
+)
+
+// DialTrace reports the steps of a dial to the lifecycle callbacks of
+// a water.Config, i.e., OnDialStart, OnUnderlyingConnected,
+// OnHandshakeComplete and OnClose. Each callback is called at most once.
+type DialTrace struct {
+	config *water.Config
+	event  water.DialEvent
+	mutex  sync.Mutex
+
+	connectedOnce sync.Once
+	closedOnce    sync.Once
+}
+
+// StartDialTrace starts tracing the dial of the network address with the
+// callbacks of config, calling OnDialStart if set.
+func StartDialTrace(config *water.Config, network, address string) *DialTrace {
+	t := &DialTrace{
+		config: config,
+		event: water.DialEvent{
+			Network: network,
+			Address: address,
+			Start:   time.Now(),
+		},
+	}
+	if config.OnDialStart != nil {
+		config.OnDialStart(t.eventNow())
+	}
+	return t
+}
+
+// DialerFunc wraps dialerFunc to call OnUnderlyingConnected once it
+// connects to the address traced, as opposed to those dialed by the WATM
+// for other purposes, e.g., decoys.
+func (t *DialTrace) DialerFunc(dialerFunc func(network, address string) (net.Conn, error)) func(network, address string) (net.Conn, error) {
+	return func(network, address string) (net.Conn, error) {
+		conn, err := dialerFunc(network, address)
+		if err == nil && network == t.event.Network && address == t.event.Address {
+			t.connectedOnce.Do(func() {
+				t.mutex.Lock()
+				t.event.NetConn = conn
+				t.mutex.Unlock()
+				if t.config.OnUnderlyingConnected != nil {
+					t.config.OnUnderlyingConnected(t.eventNow())
+				}
+			})
+		}
+		return conn, err
+	}
+}
+
+// HandshakeComplete calls OnHandshakeComplete with the connection dialed,
+// or the error the dial failed with.
+func (t *DialTrace) HandshakeComplete(conn water.Conn, err error) {
+	if t.config.OnHandshakeComplete != nil {
+		event := t.eventNow()
+		event.Conn, event.Err = conn, err
+		t.config.OnHandshakeComplete(event)
+	}
+}
+
+// Closed calls OnClose once the connection dialed is closed. The
+// DialTrace does not keep conn, which may be finalized once unreachable.
+func (t *DialTrace) Closed(conn water.Conn) {
+	t.closedOnce.Do(func() {
+		if t.config.OnClose != nil {
+			event := t.eventNow()
+			event.Conn = conn
+			t.config.OnClose(event)
+		}
+	})
+}
+
+// eventNow returns a copy of the event as of now, so that the callbacks
+// may keep it.
+func (t *DialTrace) eventNow() *water.DialEvent {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	event := t.event
+	event.Elapsed = time.Since(event.Start)
+	return &event
+}
@@ -0,0 +1,89 @@
+// Package driver provides the helpers shared by the transport drivers,
+// i.e., transport/v0 and transport/v1, to implement the Dialer, Listener
+// and Relay of package water, without them being a part of WATER API.
+package driver
+
+import (
+	"context"
+	"net"
+	"os"
+
+	"github.com/refraction-networking/water"
+	"github.com/refraction-networking/water/internal/hooks"
+)
+
+// funcs are the unexported functions of package water wrapped by this
+// package.
+var funcs = hooks.Get[water.Config, water.Conn, water.AcceptResult, water.TUN, water.WorkerPool, water.TransportModuleSpec, water.UnderlyingProtocol]()
+
+// RegisterWATMSpec registers the specification of the ABI version a
+// driver implements, so that water.ValidateTransportModule is able to
+// recognize it.
+func RegisterWATMSpec(spec water.TransportModuleSpec) error {
+	return funcs.RegisterWATMSpec(spec)
+}
+
+// RegisterUnderlyingProtocol registers the UnderlyingProtocol implemented
+// by a package (e.g., `quic`) under the given name, upon being imported.
+func RegisterUnderlyingProtocol(name string, protocol water.UnderlyingProtocol) error {
+	return funcs.RegisterUnderlyingProtocol(name, protocol)
+}
+
+// Snapshot returns a copy of config for a Dialer, Listener or Relay to
+// keep, or water.ErrConfigMutated if config was modified since it was
+// first used.
+func Snapshot(config *water.Config) (*water.Config, error) {
+	return funcs.Snapshot(config)
+}
+
+// Authorize calls the AuthHandler of config, if set, with the metadata of
+// the connection accepted, and returns its error, if any.
+func Authorize(config *water.Config, conn water.Conn) error {
+	return funcs.Authorize(config, conn)
+}
+
+// RelayConnsFor returns the connection a Relay should hand to the WATM in
+// place of inbound, and the func it uses to dial the upstream for it,
+// both tracked for the AccessLogger of config if set.
+func RelayConnsFor(config *water.Config, inbound net.Conn) (net.Conn, func(network, address string) (net.Conn, error)) {
+	return funcs.RelayConnsFor(config, inbound)
+}
+
+// ContextHasModuleEnviron reports whether ctx carries arguments or
+// environment variables set with water.WithModuleEnv or
+// water.WithModuleArgv, which instances created before the context is
+// known would miss.
+func ContextHasModuleEnviron(ctx context.Context) bool {
+	return funcs.ContextHasModuleEnviron(ctx)
+}
+
+// OpenTUN opens the TUN device for a WASM instance, i.e., duplicates the
+// File of tun if set, or opens the device of its Name otherwise.
+func OpenTUN(tun *water.TUN) (*os.File, error) {
+	return funcs.OpenTUN(tun)
+}
+
+// GoWorker runs the worker thread f on a goroutine of pool once the number
+// of worker threads running allows it, or returns ctx.Err() if ctx is done
+// before. A nil pool runs f on a new goroutine.
+func GoWorker(ctx context.Context, pool *water.WorkerPool, f func()) error {
+	return funcs.GoWorker(pool, ctx, f)
+}
+
+// ServeAcceptResults calls accept in a loop from a new goroutine and
+// delivers each result on the returned channel, until done is closed, for
+// Listener.Connections. A Conn still undelivered when done is closed is
+// closed instead of leaked.
+func ServeAcceptResults(accept func() water.AcceptResult, done <-chan struct{}) <-chan water.AcceptResult {
+	return funcs.ServeAcceptResults(accept, done)
+}
+
+// ServeHandshakes calls acceptNetworkConn in a loop from a new goroutine,
+// and handshake for each network connection accepted from other
+// goroutines, up to concurrency at once, delivering each result on the
+// returned channel until done is closed, for a Listener with the
+// HandshakeConcurrency set. The channel is closed once all handshakes in
+// progress return after done is closed.
+func ServeHandshakes(concurrency int, acceptNetworkConn func() (net.Conn, error), handshake func(net.Conn) water.AcceptResult, done <-chan struct{}) <-chan water.AcceptResult {
+	return funcs.ServeHandshakes(concurrency, acceptNetworkConn, handshake, done)
+}
@@ -0,0 +1,60 @@
+package driver
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/refraction-networking/water"
+)
+
+// Handshake creates a Core from config with ctx for the incoming
+// netConn and calls handshake with it, which instantiates the WATM and
+// runs its handshake over netConn, e.g., by calling watm_accept_v1. If no
+// Conn is returned, the Core and netConn are closed.
+//
+// If the HandshakeTimeout is set and elapses first, netConn is closed and
+// the context of the Core canceled, which fails the pending calls into
+// the WATM unless CloseOnContextDone is disabled in the
+// RuntimeConfigFactory, and water.ErrHandshakeTimeout is returned.
+func Handshake(ctx context.Context, config *water.Config, netConn net.Conn, handshake func(water.Core) (water.Conn, error)) (water.Conn, error) {
+	stopTimer := func() bool { return true } // reports whether the handshake is in time
+	if config.HandshakeTimeout > 0 {
+		// the context of the Core bounds the lifetime of the Conn, so it
+		// is only canceled if the handshake times out
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		timer := time.AfterFunc(config.HandshakeTimeout, func() {
+			cancel()
+			netConn.Close()
+		})
+		stopTimer = timer.Stop
+	}
+
+	core, err := water.NewCoreWithContext(ctx, config)
+	if err != nil {
+		netConn.Close()
+		if !stopTimer() {
+			return nil, water.ErrHandshakeTimeout
+		}
+		return nil, err
+	}
+
+	conn, err := handshake(core)
+	inTime := stopTimer()
+	if err == nil && !inTime {
+		conn.Close()
+	}
+	if err != nil || !inTime {
+		core.Close()
+		netConn.Close()
+		if !inTime {
+			return nil, water.ErrHandshakeTimeout
+		}
+		return nil, err
+	}
+	return conn, nil
+}
@@ -0,0 +1,17 @@
+package driver
+
+import (
+	"net"
+
+	"github.com/refraction-networking/water"
+)
+
+// PathInfoOf returns the PathInfo of the network connection conn, the
+// path of a WATM, from the PathInfoFunc of config if set, or
+// water.NetConnPathInfo.
+func PathInfoOf(config *water.Config, conn net.Conn) (water.PathInfo, error) {
+	if config.PathInfoFunc != nil {
+		return config.PathInfoFunc(conn)
+	}
+	return water.NetConnPathInfo(conn)
+}
@@ -0,0 +1,40 @@
+// Package hooks gives the transport drivers (e.g., transport/v1) access
+// to the unexported functions of package water they depend on, which are
+// not a part of WATER API.
+//
+// Package water sets its Funcs upon its initialization, instantiated with
+// its own types as this package cannot import it, and package driver
+// exposes them to the drivers.
+package hooks
+
+import (
+	"context"
+	"net"
+	"os"
+)
+
+// Funcs are the functions of package water the drivers call.
+type Funcs[Config, Conn, AcceptResult, TUN, WorkerPool, TransportModuleSpec, UnderlyingProtocol any] struct {
+	RegisterWATMSpec           func(TransportModuleSpec) error
+	RegisterUnderlyingProtocol func(name string, protocol UnderlyingProtocol) error
+	Snapshot                   func(*Config) (*Config, error)
+	Authorize                  func(*Config, Conn) error
+	RelayConnsFor              func(*Config, net.Conn) (net.Conn, func(network, address string) (net.Conn, error))
+	ContextHasModuleEnviron    func(context.Context) bool
+	OpenTUN                    func(*TUN) (*os.File, error)
+	GoWorker                   func(*WorkerPool, context.Context, func()) error
+	ServeAcceptResults         func(accept func() AcceptResult, done <-chan struct{}) <-chan AcceptResult
+	ServeHandshakes            func(concurrency int, acceptNetworkConn func() (net.Conn, error), handshake func(net.Conn) AcceptResult, done <-chan struct{}) <-chan AcceptResult
+}
+
+var funcs any
+
+// Set sets the Funcs of package water.
+func Set[Config, Conn, AcceptResult, TUN, WorkerPool, TransportModuleSpec, UnderlyingProtocol any](f Funcs[Config, Conn, AcceptResult, TUN, WorkerPool, TransportModuleSpec, UnderlyingProtocol]) {
+	funcs = f
+}
+
+// Get returns the Funcs of package water, which must be initialized.
+func Get[Config, Conn, AcceptResult, TUN, WorkerPool, TransportModuleSpec, UnderlyingProtocol any]() Funcs[Config, Conn, AcceptResult, TUN, WorkerPool, TransportModuleSpec, UnderlyingProtocol] {
+	return funcs.(Funcs[Config, Conn, AcceptResult, TUN, WorkerPool, TransportModuleSpec, UnderlyingProtocol])
+}
@@ -0,0 +1,158 @@
+// Package idle closes connections that stay idle for too long.
+package idle
+
+import (
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Timer calls a func once no activity is observed on a connection for a
+// timeout. A nil Timer, as created if no timeout is set, observes nothing
+// and never fires.
+type Timer struct {
+	timeout      time.Duration
+	lastActivity atomic.Int64 // in UnixNano
+
+	mu      sync.Mutex
+	timer   *time.Timer
+	stopped bool
+}
+
+// NewTimer creates a Timer for the timeout, or returns nil if timeout is
+// not positive. The Timer does not fire until started.
+func NewTimer(timeout time.Duration) *Timer {
+	if timeout <= 0 {
+		return nil
+	}
+
+	t := &Timer{timeout: timeout}
+	t.Touch()
+	return t
+}
+
+// Start makes the Timer call onIdle, in its own goroutine, once no
+// activity is observed for the timeout.
+func (t *Timer) Start(onIdle func()) {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.stopped || t.timer != nil {
+		return
+	}
+
+	t.Touch()
+	var check func()
+	check = func() {
+		idle := time.Since(time.Unix(0, t.lastActivity.Load()))
+
+		t.mu.Lock()
+		if t.stopped {
+			t.mu.Unlock()
+			return
+		}
+		if idle < t.timeout {
+			t.timer = time.AfterFunc(t.timeout-idle, check)
+			t.mu.Unlock()
+			return
+		}
+		t.stopped = true
+		t.mu.Unlock()
+
+		onIdle()
+	}
+	t.timer = time.AfterFunc(t.timeout, check)
+}
+
+// Touch records activity, postponing the call to onIdle.
+func (t *Timer) Touch() {
+	if t != nil {
+		t.lastActivity.Store(time.Now().UnixNano())
+	}
+}
+
+// Stop stops the Timer, which never fires afterwards.
+func (t *Timer) Stop() {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.stopped = true
+	if t.timer != nil {
+		t.timer.Stop()
+	}
+}
+
+// TrackConn returns conn, wrapped to record each read and write on it as
+// activity. The returned connection is then no longer a *net.TCPConn,
+// costing an extra copy of the data if handed to a WATM.
+func (t *Timer) TrackConn(conn net.Conn) net.Conn {
+	if t == nil {
+		return conn
+	}
+	return &idleTrackedConn{Conn: conn, timer: t}
+}
+
+// TrackDialerFunc returns dialerFunc, wrapped to track each connection
+// dialed with TrackConn.
+func (t *Timer) TrackDialerFunc(dialerFunc func(network, address string) (net.Conn, error)) func(network, address string) (net.Conn, error) {
+	if t == nil {
+		return dialerFunc
+	}
+	return func(network, address string) (net.Conn, error) {
+		conn, err := dialerFunc(network, address)
+		if err != nil {
+			return nil, err
+		}
+		return t.TrackConn(conn), nil
+	}
+}
+
+// TrackReader returns r, wrapped to record each read from it as activity.
+func (t *Timer) TrackReader(r io.Reader) io.Reader {
+	if t == nil {
+		return r
+	}
+	return &idleTrackedReader{Reader: r, timer: t}
+}
+
+type idleTrackedReader struct {
+	io.Reader
+	timer *Timer
+}
+
+func (r *idleTrackedReader) Read(b []byte) (n int, err error) {
+	n, err = r.Reader.Read(b)
+	if n > 0 {
+		r.timer.Touch()
+	}
+	return n, err
+}
+
+type idleTrackedConn struct {
+	net.Conn
+	timer *Timer
+}
+
+func (c *idleTrackedConn) Read(b []byte) (n int, err error) {
+	n, err = c.Conn.Read(b)
+	if n > 0 {
+		c.timer.Touch()
+	}
+	return n, err
+}
+
+func (c *idleTrackedConn) Write(b []byte) (n int, err error) {
+	n, err = c.Conn.Write(b)
+	if n > 0 {
+		c.timer.Touch()
+	}
+	return n, err
+}
@@ -0,0 +1,18 @@
+package socket
+
+import "net"
+
+// TotalBufferSize returns the total size in bytes of the receive and send
+// buffers of the TCP connections among conns, as reported by the
+// operating system. Other connections and those whose buffers cannot be
+// inspected count as 0.
+func TotalBufferSize(conns ...net.Conn) (total int) {
+	for _, conn := range conns {
+		if tcpConn, ok := conn.(*net.TCPConn); ok {
+			if read, write, err := BufferSizes(tcpConn); err == nil {
+				total += read + write
+			}
+		}
+	}
+	return total
+}
@@ -0,0 +1,15 @@
+//go:build !unix && !windows
+
+package socket
+
+import (
+	"errors"
+	"net"
+)
+
+// BufferSizes returns the sizes in bytes of the receive and send buffers
+// of conn, as reported by the operating system. It is not supported on
+// this platform.
+func BufferSizes(*net.TCPConn) (read, write int, err error) {
+	return 0, 0, errors.ErrUnsupported
+}
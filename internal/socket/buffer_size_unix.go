@@ -0,0 +1,29 @@
+//go:build unix
+
+package socket
+
+import (
+	"net"
+	"syscall"
+)
+
+// BufferSizes returns the sizes in bytes of the receive and send buffers
+// of conn, as reported by the operating system.
+func BufferSizes(conn *net.TCPConn) (read, write int, err error) {
+	rawConn, err := conn.SyscallConn()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var sockErr error
+	if err := rawConn.Control(func(fd uintptr) {
+		if read, sockErr = syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_RCVBUF); sockErr != nil {
+			return
+		}
+		write, sockErr = syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_SNDBUF)
+	}); err != nil {
+		return 0, 0, err
+	}
+
+	return read, write, sockErr
+}
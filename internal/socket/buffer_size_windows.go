@@ -0,0 +1,40 @@
+//go:build windows
+
+package socket
+
+import (
+	"net"
+	"syscall"
+	"unsafe"
+)
+
+// BufferSizes returns the sizes in bytes of the receive and send buffers
+// of conn, as reported by the operating system.
+func BufferSizes(conn *net.TCPConn) (read, write int, err error) {
+	rawConn, err := conn.SyscallConn()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var sockErr error
+	if err := rawConn.Control(func(fd uintptr) {
+		if read, sockErr = getsockoptInt(syscall.Handle(fd), syscall.SO_RCVBUF); sockErr != nil {
+			return
+		}
+		write, sockErr = getsockoptInt(syscall.Handle(fd), syscall.SO_SNDBUF)
+	}); err != nil {
+		return 0, 0, err
+	}
+
+	return read, write, sockErr
+}
+
+// getsockoptInt is syscall.GetsockoptInt, missing on Windows.
+func getsockoptInt(fd syscall.Handle, opt int32) (int, error) {
+	var value int32
+	size := int32(unsafe.Sizeof(value))
+	if err := syscall.Getsockopt(fd, syscall.SOL_SOCKET, opt, (*byte)(unsafe.Pointer(&value)), &size); err != nil {
+		return 0, err
+	}
+	return int(value), nil
+}
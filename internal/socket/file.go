@@ -0,0 +1,26 @@
+package socket
+
+import (
+	"errors"
+	"net"
+	"os"
+	"syscall"
+)
+
+// SyscallConn returns the raw connection of conn, if conn is backed by a
+// socket.
+func SyscallConn(conn net.Conn) (syscall.RawConn, error) {
+	if sc, ok := conn.(syscall.Conn); ok {
+		return sc.SyscallConn()
+	}
+	return nil, errors.ErrUnsupported
+}
+
+// File returns a copy of conn as an os.File, if conn is backed by a
+// socket.
+func File(conn net.Conn) (*os.File, error) {
+	if fc, ok := conn.(interface{ File() (*os.File, error) }); ok {
+		return fc.File()
+	}
+	return nil, errors.ErrUnsupported
+}
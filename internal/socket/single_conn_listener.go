@@ -0,0 +1,60 @@
+package socket
+
+import (
+	"net"
+	"sync"
+)
+
+// SingleConnListener is a net.Listener which returns a single,
+// already-accepted connection upon the first call to Accept and
+// net.ErrClosed afterwards.
+//
+// It is used to hand a connection accepted by the host over to
+// code expecting a net.Listener.
+type SingleConnListener struct {
+	conn net.Conn
+	addr net.Addr
+	mu   sync.Mutex
+}
+
+// NewSingleConnListener creates a SingleConnListener returning conn. The
+// addr is reported as the address of the listener, and if nil, the local
+// address of conn will be used instead.
+func NewSingleConnListener(conn net.Conn, addr net.Addr) *SingleConnListener {
+	if addr == nil {
+		addr = conn.LocalAddr()
+	}
+
+	return &SingleConnListener{
+		conn: conn,
+		addr: addr,
+	}
+}
+
+// Accept implements net.Listener.
+func (l *SingleConnListener) Accept() (net.Conn, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.conn == nil {
+		return nil, net.ErrClosed
+	}
+
+	conn := l.conn
+	l.conn = nil
+	return conn, nil
+}
+
+// Close implements net.Listener. It does not close the connection if
+// it has not been accepted yet, which is up to the caller.
+func (l *SingleConnListener) Close() error {
+	l.mu.Lock()
+	l.conn = nil
+	l.mu.Unlock()
+	return nil
+}
+
+// Addr implements net.Listener.
+func (l *SingleConnListener) Addr() net.Addr {
+	return l.addr
+}
@@ -0,0 +1,1065 @@
+// Package wat assembles WebAssembly modules written in the text format
+// (WAT), for the test modules of WATER to be kept as readable sources.
+package wat
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var ErrSyntax = errors.New("wat: syntax error")
+
+// Compile assembles the WebAssembly module in the text format src into
+// its binary format.
+//
+// Only the subset of the text format used by the test modules of WATER is
+// supported: functions, imported functions, a memory, globals, exports and
+// active data segments, with the instructions on integers, the locals,
+// globals and memory, and the control flow. Indices are either numbers or
+// names for functions, globals and locals, and numbers for labels.
+func Compile(src []byte) ([]byte, error) {
+	nodes, err := parse(string(src))
+	if err != nil {
+		return nil, err
+	}
+	if len(nodes) != 1 || nodes[0].keyword() != "module" {
+		return nil, fmt.Errorf("%w: expecting a single (module ...)", ErrSyntax)
+	}
+
+	m := &module{
+		funcNames:   map[string]uint32{},
+		globalNames: map[string]uint32{},
+	}
+	if err := m.compile(nodes[0].list[1:]); err != nil {
+		return nil, err
+	}
+	return m.encode(), nil
+}
+
+// Build assembles each .wat file in dir into the .wasm file of the same
+// name, e.g., for go:generate.
+func Build(dir string) error {
+	return eachFile(dir, func(wasmPath string, wasm []byte) error {
+		return os.WriteFile(wasmPath, wasm, 0o644) // skipcq: GSC-G306
+	})
+}
+
+// Verify checks that each .wat file in dir is assembled into the .wasm
+// file of the same name, e.g., for a test to catch a .wasm file not built
+// again after its source is modified.
+func Verify(dir string) error {
+	return eachFile(dir, func(wasmPath string, wasm []byte) error {
+		built, err := os.ReadFile(wasmPath)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(built, wasm) {
+			return fmt.Errorf("wat: %s is out of date, run go generate", wasmPath)
+		}
+		return nil
+	})
+}
+
+func eachFile(dir string, f func(wasmPath string, wasm []byte) error) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.wat"))
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("wat: no .wat file in %s", dir)
+	}
+
+	for _, path := range paths {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		wasm, err := Compile(src)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if err := f(strings.TrimSuffix(path, ".wat")+".wasm", wasm); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// node is either an atom, a string or a list of nodes.
+type node struct {
+	atom   string
+	str    []byte
+	isStr  bool
+	list   []node
+	isList bool
+	line   int
+}
+
+// keyword returns the leading atom of a list, if any.
+func (n node) keyword() string {
+	if n.isList && len(n.list) > 0 && !n.list[0].isList && !n.list[0].isStr {
+		return n.list[0].atom
+	}
+	return ""
+}
+
+func (n node) errorf(format string, args ...any) error {
+	return fmt.Errorf("%w: line %d: %s", ErrSyntax, n.line, fmt.Sprintf(format, args...))
+}
+
+func parse(src string) ([]node, error) {
+	var stack [][]node
+	var lines []int
+	var cur []node
+	line := 1
+
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case strings.HasPrefix(src[i:], ";;"):
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(src[i:], "(;"):
+			end := strings.Index(src[i:], ";)")
+			if end < 0 {
+				return nil, fmt.Errorf("%w: line %d: unterminated comment", ErrSyntax, line)
+			}
+			line += strings.Count(src[i:i+end], "\n")
+			i += end + 2
+		case c == '(':
+			stack = append(stack, cur)
+			lines = append(lines, line)
+			cur = nil
+			i++
+		case c == ')':
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("%w: line %d: unexpected )", ErrSyntax, line)
+			}
+			n := node{list: cur, isList: true, line: lines[len(lines)-1]}
+			cur = append(stack[len(stack)-1], n)
+			stack = stack[:len(stack)-1]
+			lines = lines[:len(lines)-1]
+			i++
+		case c == '"':
+			s, n, err := unquote(src[i:])
+			if err != nil {
+				return nil, fmt.Errorf("%w: line %d: %v", ErrSyntax, line, err)
+			}
+			cur = append(cur, node{str: s, isStr: true, line: line})
+			i += n
+		default:
+			j := i
+			for j < len(src) && !strings.ContainsRune(" \t\r\n()\";", rune(src[j])) {
+				j++
+			}
+			cur = append(cur, node{atom: src[i:j], line: line})
+			i = j
+		}
+	}
+	if len(stack) != 0 {
+		return nil, fmt.Errorf("%w: line %d: missing )", ErrSyntax, line)
+	}
+	return cur, nil
+}
+
+// unquote decodes the string literal at the start of s, returning its
+// bytes and the length of the literal.
+func unquote(s string) ([]byte, int, error) {
+	var b []byte
+	for i := 1; i < len(s); {
+		switch c := s[i]; c {
+		case '"':
+			return b, i + 1, nil
+		case '\\':
+			if i+1 >= len(s) {
+				return nil, 0, errors.New("unterminated string")
+			}
+			switch e := s[i+1]; e {
+			case 'n':
+				b = append(b, '\n')
+			case 't':
+				b = append(b, '\t')
+			case 'r':
+				b = append(b, '\r')
+			case '\\', '\'', '"':
+				b = append(b, e)
+			default:
+				if i+2 >= len(s) {
+					return nil, 0, errors.New("unterminated string")
+				}
+				v, err := strconv.ParseUint(s[i+1:i+3], 16, 8)
+				if err != nil {
+					return nil, 0, fmt.Errorf("invalid escape \\%s", s[i+1:i+3])
+				}
+				b = append(b, byte(v))
+				i++
+			}
+			i += 2
+		case '\n':
+			return nil, 0, errors.New("unterminated string")
+		default:
+			b = append(b, c)
+			i++
+		}
+	}
+	return nil, 0, errors.New("unterminated string")
+}
+
+const (
+	sectionType     = 1
+	sectionImport   = 2
+	sectionFunction = 3
+	sectionMemory   = 5
+	sectionGlobal   = 6
+	sectionExport   = 7
+	sectionStart    = 8
+	sectionCode     = 10
+	sectionData     = 11
+
+	kindFunc   = 0x00
+	kindMemory = 0x02
+	kindGlobal = 0x03
+)
+
+var valueTypes = map[string]byte{
+	"i32": 0x7f,
+	"i64": 0x7e,
+	"f32": 0x7d,
+	"f64": 0x7c,
+}
+
+type funcType struct {
+	params, results []byte
+}
+
+func (t funcType) encode() []byte {
+	b := []byte{0x60}
+	b = appendVec(b, len(t.params), t.params)
+	return appendVec(b, len(t.results), t.results)
+}
+
+type function struct {
+	typeIdx    uint32
+	locals     []byte // the types of the locals, params excluded
+	localNames map[string]uint32
+	code       []byte
+}
+
+type module struct {
+	types       []funcType
+	imports     [][]byte
+	funcs       []*function
+	numImported uint32
+	memories    [][]byte
+	globals     [][]byte
+	exports     [][]byte
+	start       []byte
+	datas       [][]byte
+
+	funcNames   map[string]uint32
+	globalNames map[string]uint32
+}
+
+func (m *module) typeIndex(t funcType) uint32 {
+	for i, known := range m.types {
+		if bytes.Equal(known.params, t.params) && bytes.Equal(known.results, t.results) {
+			return uint32(i)
+		}
+	}
+	m.types = append(m.types, t)
+	return uint32(len(m.types) - 1)
+}
+
+func (m *module) compile(fields []node) error {
+	// The functions and globals are indexed first, so that they could be
+	// referred to before being defined. Imports precede the definitions
+	// in the index space.
+	var numGlobals uint32
+	for _, field := range fields {
+		switch field.keyword() {
+		case "import":
+			if len(field.list) == 4 && field.list[3].keyword() == "func" {
+				if name := optionalName(field.list[3].list[1:]); name != "" {
+					m.funcNames[name] = m.numImported
+				}
+				m.numImported++
+			}
+		case "global":
+			if name := optionalName(field.list[1:]); name != "" {
+				m.globalNames[name] = numGlobals
+			}
+			numGlobals++
+		}
+	}
+	numFuncs := m.numImported
+	for _, field := range fields {
+		if field.keyword() == "func" {
+			if name := optionalName(field.list[1:]); name != "" {
+				m.funcNames[name] = numFuncs
+			}
+			numFuncs++
+		}
+	}
+
+	globalIdx := uint32(0)
+	for _, field := range fields {
+		var err error
+		switch field.keyword() {
+		case "import":
+			err = m.compileImport(field)
+		case "func":
+			err = m.compileFunc(field, m.numImported+uint32(len(m.funcs)))
+		case "memory":
+			err = m.compileMemory(field)
+		case "global":
+			err = m.compileGlobal(field, globalIdx)
+			globalIdx++
+		case "export":
+			err = m.compileExport(field)
+		case "start":
+			if len(field.list) != 2 {
+				return field.errorf("malformed start")
+			}
+			var idx uint32
+			idx, err = m.index(field.list[1], m.funcNames)
+			m.start = appendUleb(nil, uint64(idx))
+		case "data":
+			err = m.compileData(field)
+		default:
+			return field.errorf("unsupported module field %q", field.keyword())
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// optionalName returns the $name starting nodes, if any.
+func optionalName(nodes []node) string {
+	if len(nodes) > 0 && !nodes[0].isList && strings.HasPrefix(nodes[0].atom, "$") {
+		return nodes[0].atom
+	}
+	return ""
+}
+
+// inlineExports appends the exports of the inline (export "name") nodes
+// leading nodes, and returns the nodes following them.
+func (m *module) inlineExports(nodes []node, kind byte, idx uint32) []node {
+	for len(nodes) > 0 && nodes[0].keyword() == "export" && len(nodes[0].list) == 2 && nodes[0].list[1].isStr {
+		m.exports = append(m.exports, encodeExport(nodes[0].list[1].str, kind, idx))
+		nodes = nodes[1:]
+	}
+	return nodes
+}
+
+func encodeExport(name []byte, kind byte, idx uint32) []byte {
+	b := appendVec(nil, len(name), name)
+	b = append(b, kind)
+	return appendUleb(b, uint64(idx))
+}
+
+// typeUse parses the params and results, and the locals if allowed,
+// leading nodes, and returns the nodes following them.
+func typeUse(nodes []node, f *function) (funcType, []node, error) {
+	var t funcType
+	numParams := uint32(0)
+	for len(nodes) > 0 {
+		kw := nodes[0].keyword()
+		if kw != "param" && kw != "result" && (kw != "local" || f == nil) {
+			break
+		}
+
+		types := nodes[0].list[1:]
+		if name := optionalName(types); name != "" {
+			if f == nil || kw == "result" || len(types) != 2 {
+				return t, nil, nodes[0].errorf("unexpected name %s", name)
+			}
+			f.localNames[name] = numParams + uint32(len(f.locals))
+			types = types[1:]
+		}
+		for _, n := range types {
+			vt, ok := valueTypes[n.atom]
+			if !ok || n.isList || n.isStr {
+				return t, nil, n.errorf("unknown value type %q", n.atom)
+			}
+			switch kw {
+			case "param":
+				if len(t.results) > 0 || (f != nil && len(f.locals) > 0) {
+					return t, nil, n.errorf("param after result or local")
+				}
+				t.params = append(t.params, vt)
+				numParams++
+			case "result":
+				if f != nil && len(f.locals) > 0 {
+					return t, nil, n.errorf("result after local")
+				}
+				t.results = append(t.results, vt)
+			case "local":
+				f.locals = append(f.locals, vt)
+			}
+		}
+		nodes = nodes[1:]
+	}
+	return t, nodes, nil
+}
+
+func (m *module) compileImport(field node) error {
+	if len(field.list) != 4 || !field.list[1].isStr || !field.list[2].isStr || field.list[3].keyword() != "func" {
+		return field.errorf("only functions could be imported")
+	}
+	desc := field.list[3].list[1:]
+	if optionalName(desc) != "" {
+		desc = desc[1:]
+	}
+	t, rest, err := typeUse(desc, nil)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 0 {
+		return rest[0].errorf("unexpected %s in imported function", describe(rest[0]))
+	}
+
+	b := appendVec(nil, len(field.list[1].str), field.list[1].str)
+	b = appendVec(b, len(field.list[2].str), field.list[2].str)
+	b = append(b, kindFunc)
+	m.imports = append(m.imports, appendUleb(b, uint64(m.typeIndex(t))))
+	return nil
+}
+
+func (m *module) compileFunc(field node, idx uint32) error {
+	nodes := field.list[1:]
+	if optionalName(nodes) != "" {
+		nodes = nodes[1:]
+	}
+	nodes = m.inlineExports(nodes, kindFunc, idx)
+
+	f := &function{localNames: map[string]uint32{}}
+	t, body, err := typeUse(nodes, f)
+	if err != nil {
+		return err
+	}
+	f.typeIdx = m.typeIndex(t)
+
+	code, err := m.expr(body, f)
+	if err != nil {
+		return err
+	}
+
+	// the locals of the same type in a row are declared at once
+	var locals []byte
+	numGroups := 0
+	for i := 0; i < len(f.locals); {
+		j := i
+		for j < len(f.locals) && f.locals[j] == f.locals[i] {
+			j++
+		}
+		locals = append(appendUleb(locals, uint64(j-i)), f.locals[i])
+		numGroups++
+		i = j
+	}
+	entry := append(appendVec(nil, numGroups, locals), code...)
+	f.code = appendVec(nil, len(entry), entry)
+	m.funcs = append(m.funcs, f)
+	return nil
+}
+
+func (m *module) compileMemory(field node) error {
+	nodes := field.list[1:]
+	if optionalName(nodes) != "" {
+		nodes = nodes[1:]
+	}
+	nodes = m.inlineExports(nodes, kindMemory, uint32(len(m.memories)))
+
+	var limits []uint64
+	for _, n := range nodes {
+		v, err := parseUint(n, 32)
+		if err != nil {
+			return err
+		}
+		limits = append(limits, v)
+	}
+	switch len(limits) {
+	case 1:
+		m.memories = append(m.memories, appendUleb([]byte{0x00}, limits[0]))
+	case 2:
+		m.memories = append(m.memories, appendUleb(appendUleb([]byte{0x01}, limits[0]), limits[1]))
+	default:
+		return field.errorf("malformed memory limits")
+	}
+	return nil
+}
+
+func (m *module) compileGlobal(field node, idx uint32) error {
+	nodes := field.list[1:]
+	if optionalName(nodes) != "" {
+		nodes = nodes[1:]
+	}
+	nodes = m.inlineExports(nodes, kindGlobal, idx)
+	if len(nodes) == 0 {
+		return field.errorf("missing global type")
+	}
+
+	var b []byte
+	gt := nodes[0]
+	if gt.keyword() == "mut" && len(gt.list) == 2 {
+		vt, ok := valueTypes[gt.list[1].atom]
+		if !ok {
+			return gt.errorf("unknown value type %q", gt.list[1].atom)
+		}
+		b = append(b, vt, 0x01)
+	} else {
+		vt, ok := valueTypes[gt.atom]
+		if !ok || gt.isList {
+			return gt.errorf("unknown global type")
+		}
+		b = append(b, vt, 0x00)
+	}
+
+	init, err := m.expr(nodes[1:], nil)
+	if err != nil {
+		return err
+	}
+	m.globals = append(m.globals, append(b, init...))
+	return nil
+}
+
+func (m *module) compileExport(field node) error {
+	if len(field.list) != 3 || !field.list[1].isStr || !field.list[2].isList || len(field.list[2].list) != 2 {
+		return field.errorf("malformed export")
+	}
+	desc := field.list[2]
+	var kind byte
+	var idx uint32
+	var err error
+	switch desc.keyword() {
+	case "func":
+		kind = kindFunc
+		idx, err = m.index(desc.list[1], m.funcNames)
+	case "memory":
+		kind = kindMemory
+		idx, err = m.index(desc.list[1], nil)
+	case "global":
+		kind = kindGlobal
+		idx, err = m.index(desc.list[1], m.globalNames)
+	default:
+		return desc.errorf("unsupported export %q", desc.keyword())
+	}
+	if err != nil {
+		return err
+	}
+	m.exports = append(m.exports, encodeExport(field.list[1].str, kind, idx))
+	return nil
+}
+
+func (m *module) compileData(field node) error {
+	nodes := field.list[1:]
+	if len(nodes) == 0 || !nodes[0].isList {
+		return field.errorf("only active data segments are supported")
+	}
+	offset := nodes[0]
+	if offset.keyword() == "offset" {
+		offset = node{list: offset.list[1:], isList: true, line: offset.line}
+	} else {
+		offset = node{list: []node{offset}, isList: true, line: offset.line}
+	}
+	expr, err := m.expr(offset.list, nil)
+	if err != nil {
+		return err
+	}
+
+	var data []byte
+	for _, n := range nodes[1:] {
+		if !n.isStr {
+			return n.errorf("expecting a string")
+		}
+		data = append(data, n.str...)
+	}
+	b := append([]byte{0x00}, expr...)
+	m.datas = append(m.datas, appendVec(b, len(data), data))
+	return nil
+}
+
+// index resolves the index n, a number or a $name in names.
+func (m *module) index(n node, names map[string]uint32) (uint32, error) {
+	if n.isList || n.isStr {
+		return 0, n.errorf("expecting an index")
+	}
+	if strings.HasPrefix(n.atom, "$") {
+		idx, ok := names[n.atom]
+		if !ok {
+			return 0, n.errorf("unknown name %s", n.atom)
+		}
+		return idx, nil
+	}
+	v, err := parseUint(n, 32)
+	return uint32(v), err
+}
+
+// expr encodes the instructions in nodes followed by end.
+func (m *module) expr(nodes []node, f *function) ([]byte, error) {
+	b, err := m.instrs(nil, nodes, f)
+	if err != nil {
+		return nil, err
+	}
+	return append(b, opEnd), nil
+}
+
+const (
+	opBlock = 0x02
+	opLoop  = 0x03
+	opIf    = 0x04
+	opElse  = 0x05
+	opEnd   = 0x0b
+)
+
+// immediate kinds
+const (
+	immNone = iota
+	immFunc
+	immLocal
+	immGlobal
+	immLabel
+	immI32
+	immI64
+	immMem
+	immZero
+)
+
+type opcode struct {
+	code  byte
+	imm   int
+	align uint32 // natural alignment of the memory instructions, in bytes
+}
+
+var opcodes = map[string]opcode{
+	"unreachable": {0x00, immNone, 0},
+	"nop":         {0x01, immNone, 0},
+	"br":          {0x0c, immLabel, 0},
+	"br_if":       {0x0d, immLabel, 0},
+	"return":      {0x0f, immNone, 0},
+	"call":        {0x10, immFunc, 0},
+	"drop":        {0x1a, immNone, 0},
+	"select":      {0x1b, immNone, 0},
+	"local.get":   {0x20, immLocal, 0},
+	"local.set":   {0x21, immLocal, 0},
+	"local.tee":   {0x22, immLocal, 0},
+	"global.get":  {0x23, immGlobal, 0},
+	"global.set":  {0x24, immGlobal, 0},
+
+	"i32.load":     {0x28, immMem, 4},
+	"i64.load":     {0x29, immMem, 8},
+	"i32.load8_s":  {0x2c, immMem, 1},
+	"i32.load8_u":  {0x2d, immMem, 1},
+	"i32.load16_s": {0x2e, immMem, 2},
+	"i32.load16_u": {0x2f, immMem, 2},
+	"i64.load8_s":  {0x30, immMem, 1},
+	"i64.load8_u":  {0x31, immMem, 1},
+	"i64.load16_s": {0x32, immMem, 2},
+	"i64.load16_u": {0x33, immMem, 2},
+	"i64.load32_s": {0x34, immMem, 4},
+	"i64.load32_u": {0x35, immMem, 4},
+	"i32.store":    {0x36, immMem, 4},
+	"i64.store":    {0x37, immMem, 8},
+	"i32.store8":   {0x3a, immMem, 1},
+	"i32.store16":  {0x3b, immMem, 2},
+	"i64.store8":   {0x3c, immMem, 1},
+	"i64.store16":  {0x3d, immMem, 2},
+	"i64.store32":  {0x3e, immMem, 4},
+	"memory.size":  {0x3f, immZero, 0},
+	"memory.grow":  {0x40, immZero, 0},
+
+	"i32.const": {0x41, immI32, 0},
+	"i64.const": {0x42, immI64, 0},
+
+	"i32.eqz":  {0x45, immNone, 0},
+	"i32.eq":   {0x46, immNone, 0},
+	"i32.ne":   {0x47, immNone, 0},
+	"i32.lt_s": {0x48, immNone, 0},
+	"i32.lt_u": {0x49, immNone, 0},
+	"i32.gt_s": {0x4a, immNone, 0},
+	"i32.gt_u": {0x4b, immNone, 0},
+	"i32.le_s": {0x4c, immNone, 0},
+	"i32.le_u": {0x4d, immNone, 0},
+	"i32.ge_s": {0x4e, immNone, 0},
+	"i32.ge_u": {0x4f, immNone, 0},
+	"i64.eqz":  {0x50, immNone, 0},
+	"i64.eq":   {0x51, immNone, 0},
+	"i64.ne":   {0x52, immNone, 0},
+	"i64.lt_s": {0x53, immNone, 0},
+	"i64.lt_u": {0x54, immNone, 0},
+	"i64.gt_s": {0x55, immNone, 0},
+	"i64.gt_u": {0x56, immNone, 0},
+	"i64.le_s": {0x57, immNone, 0},
+	"i64.le_u": {0x58, immNone, 0},
+	"i64.ge_s": {0x59, immNone, 0},
+	"i64.ge_u": {0x5a, immNone, 0},
+
+	"i32.add":   {0x6a, immNone, 0},
+	"i32.sub":   {0x6b, immNone, 0},
+	"i32.mul":   {0x6c, immNone, 0},
+	"i32.div_s": {0x6d, immNone, 0},
+	"i32.div_u": {0x6e, immNone, 0},
+	"i32.rem_s": {0x6f, immNone, 0},
+	"i32.rem_u": {0x70, immNone, 0},
+	"i32.and":   {0x71, immNone, 0},
+	"i32.or":    {0x72, immNone, 0},
+	"i32.xor":   {0x73, immNone, 0},
+	"i32.shl":   {0x74, immNone, 0},
+	"i32.shr_s": {0x75, immNone, 0},
+	"i32.shr_u": {0x76, immNone, 0},
+	"i64.add":   {0x7c, immNone, 0},
+	"i64.sub":   {0x7d, immNone, 0},
+	"i64.mul":   {0x7e, immNone, 0},
+	"i64.div_s": {0x7f, immNone, 0},
+	"i64.div_u": {0x80, immNone, 0},
+	"i64.rem_s": {0x81, immNone, 0},
+	"i64.rem_u": {0x82, immNone, 0},
+	"i64.and":   {0x83, immNone, 0},
+	"i64.or":    {0x84, immNone, 0},
+	"i64.xor":   {0x85, immNone, 0},
+	"i64.shl":   {0x86, immNone, 0},
+	"i64.shr_s": {0x87, immNone, 0},
+	"i64.shr_u": {0x88, immNone, 0},
+
+	"i32.wrap_i64":     {0xa7, immNone, 0},
+	"i64.extend_i32_s": {0xac, immNone, 0},
+	"i64.extend_i32_u": {0xad, immNone, 0},
+}
+
+// instrs appends the instructions in nodes, folded or not, to b.
+func (m *module) instrs(b []byte, nodes []node, f *function) ([]byte, error) {
+	for i := 0; i < len(nodes); {
+		n := nodes[i]
+		i++
+		if n.isList {
+			var err error
+			if b, err = m.folded(b, n, f); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if n.isStr {
+			return nil, n.errorf("unexpected string")
+		}
+
+		op, ok := opcodes[n.atom]
+		if !ok {
+			return nil, n.errorf("unsupported instruction %q", n.atom)
+		}
+		var imms []node
+		for i < len(nodes) && !nodes[i].isList && !nodes[i].isStr && isImmediate(nodes[i].atom) {
+			imms = append(imms, nodes[i])
+			i++
+		}
+		var err error
+		if b, err = m.instr(b, n, op, imms, f); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// isImmediate reports whether the atom is an immediate rather than an
+// instruction.
+func isImmediate(atom string) bool {
+	if atom == "" {
+		return false
+	}
+	c := atom[0]
+	return c == '$' || c == '-' || c == '+' || (c >= '0' && c <= '9') || strings.HasPrefix(atom, "offset=") || strings.HasPrefix(atom, "align=")
+}
+
+// folded appends the folded instruction n, i.e., its operands followed by
+// itself, to b.
+func (m *module) folded(b []byte, n node, f *function) ([]byte, error) {
+	kw := n.keyword()
+	if kw == "" {
+		return nil, n.errorf("expecting an instruction")
+	}
+	nodes := n.list[1:]
+
+	switch kw {
+	case "block", "loop":
+		bt, body, err := blockType(nodes)
+		if err != nil {
+			return nil, err
+		}
+		op := byte(opBlock)
+		if kw == "loop" {
+			op = opLoop
+		}
+		b = append(b, op, bt)
+		if b, err = m.instrs(b, body, f); err != nil {
+			return nil, err
+		}
+		return append(b, opEnd), nil
+
+	case "if":
+		bt, rest, err := blockType(nodes)
+		if err != nil {
+			return nil, err
+		}
+		var cond []node
+		for len(rest) > 0 && rest[0].keyword() != "then" {
+			cond = append(cond, rest[0])
+			rest = rest[1:]
+		}
+		if len(rest) == 0 || len(rest) > 2 || (len(rest) == 2 && rest[1].keyword() != "else") {
+			return nil, n.errorf("malformed if")
+		}
+		if b, err = m.instrs(b, cond, f); err != nil {
+			return nil, err
+		}
+		b = append(b, opIf, bt)
+		if b, err = m.instrs(b, rest[0].list[1:], f); err != nil {
+			return nil, err
+		}
+		if len(rest) == 2 {
+			b = append(b, opElse)
+			if b, err = m.instrs(b, rest[1].list[1:], f); err != nil {
+				return nil, err
+			}
+		}
+		return append(b, opEnd), nil
+	}
+
+	op, ok := opcodes[kw]
+	if !ok {
+		return nil, n.errorf("unsupported instruction %q", kw)
+	}
+	var imms []node
+	for len(nodes) > 0 && !nodes[0].isList && !nodes[0].isStr && isImmediate(nodes[0].atom) {
+		imms = append(imms, nodes[0])
+		nodes = nodes[1:]
+	}
+	var err error
+	if b, err = m.instrs(b, nodes, f); err != nil {
+		return nil, err
+	}
+	return m.instr(b, n, op, imms, f)
+}
+
+// blockType parses the optional (result t) leading nodes.
+func blockType(nodes []node) (byte, []node, error) {
+	if len(nodes) > 0 && nodes[0].keyword() == "result" {
+		if len(nodes[0].list) != 2 {
+			return 0, nil, nodes[0].errorf("only a single result is supported")
+		}
+		vt, ok := valueTypes[nodes[0].list[1].atom]
+		if !ok {
+			return 0, nil, nodes[0].errorf("unknown value type %q", nodes[0].list[1].atom)
+		}
+		return vt, nodes[1:], nil
+	}
+	return 0x40, nodes, nil
+}
+
+// instr appends the plain instruction n with its immediates to b.
+func (m *module) instr(b []byte, n node, op opcode, imms []node, f *function) ([]byte, error) {
+	want := 1
+	switch op.imm {
+	case immNone, immZero:
+		want = 0
+	case immMem:
+		want = len(imms)
+	}
+	if len(imms) != want {
+		return nil, n.errorf("%s: expecting %d immediate(s), got %d", n.atom, want, len(imms))
+	}
+
+	b = append(b, op.code)
+	switch op.imm {
+	case immFunc:
+		idx, err := m.index(imms[0], m.funcNames)
+		if err != nil {
+			return nil, err
+		}
+		return appendUleb(b, uint64(idx)), nil
+	case immGlobal:
+		idx, err := m.index(imms[0], m.globalNames)
+		if err != nil {
+			return nil, err
+		}
+		return appendUleb(b, uint64(idx)), nil
+	case immLocal:
+		if f == nil {
+			return nil, n.errorf("%s outside a function", n.atom)
+		}
+		idx, err := m.index(imms[0], f.localNames)
+		if err != nil {
+			return nil, err
+		}
+		return appendUleb(b, uint64(idx)), nil
+	case immLabel:
+		v, err := parseUint(imms[0], 32)
+		if err != nil {
+			return nil, err
+		}
+		return appendUleb(b, v), nil
+	case immI32:
+		v, err := parseInt(imms[0], 32)
+		if err != nil {
+			return nil, err
+		}
+		return appendSleb(b, v), nil
+	case immI64:
+		v, err := parseInt(imms[0], 64)
+		if err != nil {
+			return nil, err
+		}
+		return appendSleb(b, v), nil
+	case immMem:
+		offset, align := uint64(0), uint64(op.align)
+		for _, imm := range imms {
+			key, value, _ := strings.Cut(imm.atom, "=")
+			v, err := parseUint(node{atom: value, line: imm.line}, 32)
+			if err != nil {
+				return nil, err
+			}
+			switch key {
+			case "offset":
+				offset = v
+			case "align":
+				if v == 0 || v&(v-1) != 0 {
+					return nil, imm.errorf("alignment must be a power of 2")
+				}
+				align = v
+			default:
+				return nil, imm.errorf("unexpected %s", imm.atom)
+			}
+		}
+		b = appendUleb(b, uint64(bits.TrailingZeros64(align)))
+		return appendUleb(b, offset), nil
+	case immZero:
+		return append(b, 0x00), nil
+	}
+	return b, nil
+}
+
+func parseUint(n node, bitSize int) (uint64, error) {
+	if n.isList || n.isStr {
+		return 0, n.errorf("expecting a number")
+	}
+	v, err := strconv.ParseUint(strings.ReplaceAll(n.atom, "_", ""), 0, bitSize)
+	if err != nil {
+		return 0, n.errorf("invalid number %q", n.atom)
+	}
+	return v, nil
+}
+
+// parseInt parses a signed or unsigned integer of bitSize, returning its
+// signed interpretation.
+func parseInt(n node, bitSize int) (int64, error) {
+	atom := strings.ReplaceAll(n.atom, "_", "")
+	if v, err := strconv.ParseInt(atom, 0, bitSize); err == nil {
+		return v, nil
+	}
+	v, err := strconv.ParseUint(strings.TrimPrefix(atom, "+"), 0, bitSize)
+	if err != nil {
+		return 0, n.errorf("invalid number %q", n.atom)
+	}
+	if bitSize == 32 {
+		return int64(int32(uint32(v))), nil
+	}
+	return int64(v), nil
+}
+
+func describe(n node) string {
+	switch {
+	case n.isList:
+		return "(" + n.keyword() + " ...)"
+	case n.isStr:
+		return strconv.Quote(string(n.str))
+	}
+	return n.atom
+}
+
+func (m *module) encode() []byte {
+	b := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+
+	if len(m.types) > 0 {
+		var types [][]byte
+		for _, t := range m.types {
+			types = append(types, t.encode())
+		}
+		b = appendSection(b, sectionType, types)
+	}
+	if len(m.imports) > 0 {
+		b = appendSection(b, sectionImport, m.imports)
+	}
+	if len(m.funcs) > 0 {
+		var funcs [][]byte
+		for _, f := range m.funcs {
+			funcs = append(funcs, appendUleb(nil, uint64(f.typeIdx)))
+		}
+		b = appendSection(b, sectionFunction, funcs)
+	}
+	if len(m.memories) > 0 {
+		b = appendSection(b, sectionMemory, m.memories)
+	}
+	if len(m.globals) > 0 {
+		b = appendSection(b, sectionGlobal, m.globals)
+	}
+	if len(m.exports) > 0 {
+		b = appendSection(b, sectionExport, m.exports)
+	}
+	if m.start != nil {
+		b = appendUleb(append(b, sectionStart), uint64(len(m.start)))
+		b = append(b, m.start...)
+	}
+	if len(m.funcs) > 0 {
+		var codes [][]byte
+		for _, f := range m.funcs {
+			codes = append(codes, f.code)
+		}
+		b = appendSection(b, sectionCode, codes)
+	}
+	if len(m.datas) > 0 {
+		b = appendSection(b, sectionData, m.datas)
+	}
+	return b
+}
+
+func appendSection(b []byte, id byte, entries [][]byte) []byte {
+	content := appendUleb(nil, uint64(len(entries)))
+	for _, e := range entries {
+		content = append(content, e...)
+	}
+	b = append(b, id)
+	b = appendUleb(b, uint64(len(content)))
+	return append(b, content...)
+}
+
+// appendVec appends the length n followed by the encoded elements.
+func appendVec(b []byte, n int, elems []byte) []byte {
+	return append(appendUleb(b, uint64(n)), elems...)
+}
+
+func appendUleb(b []byte, v uint64) []byte {
+	return binary.AppendUvarint(b, v)
+}
+
+func appendSleb(b []byte, v int64) []byte {
+	for {
+		c := byte(v & 0x7f)
+		v >>= 7
+		if (v == 0 && c&0x40 == 0) || (v == -1 && c&0x40 != 0) {
+			return append(b, c)
+		}
+		b = append(b, c|0x80)
+	}
+}
@@ -0,0 +1,19 @@
+// Command wat2wasm assembles each .wat file in the directories given as
+// arguments into the .wasm file of the same name, for go generate.
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/refraction-networking/water/internal/wat"
+)
+
+func main() {
+	for _, dir := range os.Args[1:] {
+		if err := wat.Build(dir); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package wat_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/refraction-networking/water/internal/wat"
+	"github.com/tetratelabs/wazero"
+)
+
+func TestCompile(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		src  string
+		want []byte
+	}{
+		{
+			name: "empty",
+			src:  `(module)`,
+			want: []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00},
+		},
+		{
+			name: "loop",
+			src:  `(module (func (export "_start") (loop br 0)))`,
+			want: []byte{
+				0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00, // magic, version
+				0x01, 0x04, 0x01, 0x60, 0x00, 0x00, // type section: () -> ()
+				0x03, 0x02, 0x01, 0x00, // function section
+				0x07, 0x0a, 0x01, 0x06, '_', 's', 't', 'a', 'r', 't', 0x00, 0x00, // export section
+				0x0a, 0x09, 0x01, 0x07, 0x00, 0x03, 0x40, 0x0c, 0x00, 0x0b, 0x0b, // code section
+			},
+		},
+		{
+			name: "import",
+			src: `(module
+  (import "env" "boom" (func))
+  (func (export "trap") unreachable)
+  (func (export "panic") call 0))`,
+			want: []byte{
+				0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00, // magic, version
+				0x01, 0x04, 0x01, 0x60, 0x00, 0x00, // type section: () -> ()
+				0x02, 0x0c, 0x01, 0x03, 'e', 'n', 'v', 0x04, 'b', 'o', 'o', 'm', 0x00, 0x00, // import section
+				0x03, 0x03, 0x02, 0x00, 0x00, // function section
+				0x07, 0x10, 0x02, 0x04, 't', 'r', 'a', 'p', 0x00, 0x01, 0x05, 'p', 'a', 'n', 'i', 'c', 0x00, 0x02, // export section
+				0x0a, 0x0a, 0x02, 0x03, 0x00, 0x00, 0x0b, 0x04, 0x00, 0x10, 0x00, 0x0b, // code section
+			},
+		},
+		{
+			name: "data",
+			src: `(module
+  (memory 1)
+  (data (i32.const 0) "WA" "\54\4d") ;; "WATM"
+  (func unreachable)
+  (func (export "trap") call 0))`,
+			want: []byte{
+				0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00, // magic, version
+				0x01, 0x04, 0x01, 0x60, 0x00, 0x00, // type section: () -> ()
+				0x03, 0x03, 0x02, 0x00, 0x00, // function section
+				0x05, 0x03, 0x01, 0x00, 0x01, // memory section
+				0x07, 0x08, 0x01, 0x04, 't', 'r', 'a', 'p', 0x00, 0x01, // export section
+				0x0a, 0x0a, 0x02, 0x03, 0x00, 0x00, 0x0b, 0x04, 0x00, 0x10, 0x00, 0x0b, // code section
+				0x0b, 0x0a, 0x01, 0x00, 0x41, 0x00, 0x0b, 0x04, 'W', 'A', 'T', 'M', // data section
+			},
+		},
+		{
+			name: "immediates",
+			src: `(module
+  (memory 1)
+  (global $g (mut i64) (i64.const -1))
+  (func (param $p i32) (local i32 i32 i64)
+    (i32.store offset=4 align=1 (local.get $p) (i32.const 0xffffffff))
+    (global.set $g (i64.const 1000))))`,
+			want: []byte{
+				0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00, // magic, version
+				0x01, 0x05, 0x01, 0x60, 0x01, 0x7f, 0x00, // type section: (i32) -> ()
+				0x03, 0x02, 0x01, 0x00, // function section
+				0x05, 0x03, 0x01, 0x00, 0x01, // memory section
+				0x06, 0x06, 0x01, 0x7e, 0x01, 0x42, 0x7f, 0x0b, // global section
+				0x0a, 0x14, 0x01, 0x12, 0x02, 0x02, 0x7f, 0x01, 0x7e, // code section, locals
+				0x20, 0x00, 0x41, 0x7f, 0x36, 0x00, 0x04, // i32.store
+				0x42, 0xe8, 0x07, 0x24, 0x00, 0x0b, // global.set
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := wat.Compile([]byte(tc.src))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tc.want) {
+				t.Errorf("Compile() = %x, want %x", got, tc.want)
+			}
+		})
+	}
+}
+
+// TestCompile_Valid checks that the control flow, which has no expected
+// bytes above, is assembled into a module accepted by wazero.
+func TestCompile_Valid(t *testing.T) {
+	wasm, err := wat.Compile([]byte(`(module
+  (import "env" "f" (func $f (param i32 i64 i32) (result i32)))
+  (memory (export "memory") 1)
+  (global $n (mut i32) (i32.const 0))
+  (func (export "run") (param i32) (result i32) (local i32)
+    (if (result i32) (i32.lt_s (local.tee 1 (call $f (i32.const 0) (i64.const 1) (i32.const 16))) (i32.const 0))
+      (then (i32.const 1))
+      (else (i32.load8_u (local.get 1))))
+    (drop)
+    (loop
+      (global.set $n (i32.add (global.get $n) (i32.const 1)))
+      (br_if 0 (i32.ne (global.get $n) (local.get 0))))
+    (if (i64.ne (i64.load (i32.const 16)) (i64.const 1000))
+      (then (return (i32.const -3))))
+    (i32.load offset=4 (i32.const 0))))`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := wazero.NewRuntime(context.Background())
+	defer r.Close(context.Background()) // skipcq: GO-S2307
+
+	if _, err := r.CompileModule(context.Background(), wasm); err != nil {
+		t.Fatalf("CompileModule: %v", err)
+	}
+}
+
+func TestCompile_SyntaxError(t *testing.T) {
+	for _, src := range []string{
+		``,
+		`(module`,
+		`(module))`,
+		`(func)`,
+		`(module (func (i32.frobnicate)))`,
+		`(module (func (call $missing)))`,
+		`(module (func (local.get 0 1)))`,
+		`(module (data (i32.const 0) "unterminated))`,
+		`(module (table 1 funcref))`,
+	} {
+		if _, err := wat.Compile([]byte(src)); !errors.Is(err, wat.ErrSyntax) {
+			t.Errorf("Compile(%q) = %v, want %v", src, err, wat.ErrSyntax)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "empty.wat"), []byte(`(module)`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := wat.Verify(dir); err == nil {
+		t.Error("Verify() succeeded without the .wasm file")
+	}
+
+	if err := wat.Build(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := wat.Verify(dir); err != nil {
+		t.Errorf("Verify() = %v after Build()", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "empty.wat"), []byte(`(module (memory 1))`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := wat.Verify(dir); err == nil {
+		t.Error("Verify() succeeded with the .wasm file out of date")
+	}
+}
@@ -0,0 +1,243 @@
+package websocket
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xa
+)
+
+// closeNormal is the status code sent in the close frame by Close.
+const closeNormal = 1000
+
+var ErrProtocol = errors.New("websocket: protocol error")
+
+// Conn is a net.Conn carrying a byte stream over a WebSocket connection.
+//
+// Each Write is sent as a binary message. Read returns the payload of the
+// data messages received, binary or text, as a stream, regardless of
+// their boundaries, while pings are answered. Read returns io.EOF once a
+// close frame is received.
+type Conn struct {
+	net.Conn
+
+	client bool // whether the frames written are masked, see RFC 6455, Section 5.3
+
+	readMutex sync.Mutex
+	br        *bufio.Reader
+	remaining uint64 // bytes of payload left in the data frame being read
+	masked    bool
+	mask      [4]byte
+	maskPos   int
+	readErr   error
+
+	writeMutex sync.Mutex
+	closeSent  bool
+}
+
+func newConn(conn net.Conn, br *bufio.Reader, client bool) *Conn {
+	return &Conn{Conn: conn, client: client, br: br}
+}
+
+// Read implements net.Conn.
+func (c *Conn) Read(b []byte) (int, error) {
+	c.readMutex.Lock()
+	defer c.readMutex.Unlock()
+
+	if len(b) == 0 {
+		return 0, nil
+	}
+
+	for c.remaining == 0 {
+		if c.readErr != nil {
+			return 0, c.readErr
+		}
+		if err := c.nextFrame(); err != nil {
+			c.readErr = err
+			return 0, err
+		}
+	}
+
+	if uint64(len(b)) > c.remaining {
+		b = b[:c.remaining]
+	}
+	n, err := c.br.Read(b)
+	if c.masked {
+		for i := range b[:n] {
+			b[i] ^= c.mask[c.maskPos&3]
+			c.maskPos++
+		}
+	}
+	c.remaining -= uint64(n)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// nextFrame reads the header of the next frame. Control frames are read
+// and handled entirely, while only the header of a data frame is read,
+// leaving its payload to Read. It returns io.EOF upon a close frame.
+func (c *Conn) nextFrame() error {
+	var header [2]byte
+	if _, err := io.ReadFull(c.br, header[:]); err != nil {
+		return err
+	}
+
+	fin := header[0]&0x80 != 0
+	if header[0]&0x70 != 0 {
+		return fmt.Errorf("%w: reserved bits set without an extension", ErrProtocol)
+	}
+	opcode := header[0] & 0x0f
+
+	masked := header[1]&0x80 != 0
+	if masked == c.client {
+		return fmt.Errorf("%w: frame masking is invalid for its direction", ErrProtocol)
+	}
+
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+			return err
+		}
+	}
+
+	switch opcode {
+	case opContinuation, opText, opBinary:
+		c.remaining, c.masked, c.mask, c.maskPos = length, masked, mask, 0
+		return nil
+	case opClose, opPing, opPong:
+	default:
+		return fmt.Errorf("%w: unknown opcode %#x", ErrProtocol, opcode)
+	}
+
+	if !fin || length > 125 {
+		return fmt.Errorf("%w: fragmented or oversized control frame", ErrProtocol)
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i&3]
+		}
+	}
+
+	switch opcode {
+	case opPing:
+		c.writeMutex.Lock()
+		defer c.writeMutex.Unlock()
+		if !c.closeSent {
+			return c.writeFrame(opPong, payload)
+		}
+	case opClose:
+		// echo the status code, completing the closing handshake
+		if len(payload) > 2 {
+			payload = payload[:2]
+		}
+		c.writeMutex.Lock()
+		defer c.writeMutex.Unlock()
+		if !c.closeSent {
+			c.closeSent = true
+			c.writeFrame(opClose, payload) // skipcq: GSC-G104
+		}
+		return io.EOF
+	}
+	return nil
+}
+
+// Write implements net.Conn.
+func (c *Conn) Write(b []byte) (int, error) {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	if c.closeSent {
+		return 0, net.ErrClosed
+	}
+	if err := c.writeFrame(opBinary, b); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// writeFrame writes a single frame with the payload, masked if c is a
+// client. c.writeMutex must be held.
+func (c *Conn) writeFrame(opcode byte, payload []byte) error {
+	frame := make([]byte, 0, 14+len(payload))
+	frame = append(frame, 0x80|opcode) // FIN
+
+	var maskBit byte
+	if c.client {
+		maskBit = 0x80
+	}
+	switch length := len(payload); {
+	case length <= 125:
+		frame = append(frame, maskBit|byte(length))
+	case length <= 0xffff:
+		frame = append(frame, maskBit|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(length))
+	default:
+		frame = append(frame, maskBit|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(length))
+	}
+
+	if c.client {
+		var mask [4]byte
+		if _, err := rand.Read(mask[:]); err != nil {
+			return err
+		}
+		frame = append(frame, mask[:]...)
+		start := len(frame)
+		frame = append(frame, payload...)
+		for i := range frame[start:] {
+			frame[start+i] ^= mask[i&3]
+		}
+	} else {
+		frame = append(frame, payload...)
+	}
+
+	_, err := c.Conn.Write(frame)
+	return err
+}
+
+// Close implements net.Conn. It sends a close frame, without waiting for
+// the one of the peer, before closing the underlying connection.
+func (c *Conn) Close() error {
+	c.writeMutex.Lock()
+	if !c.closeSent {
+		c.closeSent = true
+		c.writeFrame(opClose, binary.BigEndian.AppendUint16(nil, closeNormal)) // skipcq: GSC-G104
+	}
+	c.writeMutex.Unlock()
+	return c.Conn.Close()
+}
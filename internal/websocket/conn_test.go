@@ -0,0 +1,83 @@
+package websocket_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/refraction-networking/water/internal/websocket"
+)
+
+// handshake returns the client and server ends of a WebSocket connection
+// over a net.Pipe.
+func handshake(t *testing.T, path, serverPath string) (client, server *websocket.Conn, clientErr, serverErr error) {
+	t.Helper()
+
+	c, s := net.Pipe()
+	t.Cleanup(func() {
+		c.Close()
+		s.Close()
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		server, serverErr = websocket.Server(s, serverPath)
+		if serverErr != nil {
+			s.Close()
+		}
+	}()
+	client, clientErr = websocket.Client(c, "example.com", path, http.Header{"User-Agent": {"water"}})
+	<-done
+	return client, server, clientErr, serverErr
+}
+
+func TestConn(t *testing.T) {
+	client, server, clientErr, serverErr := handshake(t, "/ws?k=v", "/ws")
+	if clientErr != nil || serverErr != nil {
+		t.Fatal(clientErr, serverErr)
+	}
+
+	for _, size := range []int{0, 1, 125, 126, 0xffff, 0x10000} {
+		msg := bytes.Repeat([]byte{byte(size)}, size)
+		for _, rw := range []struct {
+			name string
+			w, r net.Conn
+		}{
+			{"client to server", client, server},
+			{"server to client", server, client},
+		} {
+			go rw.w.Write(msg) // skipcq: GSC-G104
+			buf := make([]byte, size)
+			if _, err := io.ReadFull(rw.r, buf); err != nil {
+				t.Fatalf("%s, %d bytes: %v", rw.name, size, err)
+			}
+			if !bytes.Equal(buf, msg) {
+				t.Fatalf("%s, %d bytes: read mismatch", rw.name, size)
+			}
+		}
+	}
+
+	// the server reads io.EOF upon the close frame sent by the client,
+	// which then reads the close frame echoed
+	go client.Close() // skipcq: GSC-G104
+	if _, err := server.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+		t.Errorf("Read() after the peer closed = %v, want io.EOF", err)
+	}
+	if _, err := server.Write([]byte("late")); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Write() after the close frame = %v, want net.ErrClosed", err)
+	}
+}
+
+func TestServer_WrongPath(t *testing.T) {
+	_, _, clientErr, serverErr := handshake(t, "/other", "/ws")
+	if !errors.Is(serverErr, websocket.ErrBadHandshake) {
+		t.Errorf("Server() = %v, want ErrBadHandshake", serverErr)
+	}
+	if !errors.Is(clientErr, websocket.ErrBadHandshake) {
+		t.Errorf("Client() = %v, want ErrBadHandshake", clientErr)
+	}
+}
@@ -0,0 +1,145 @@
+package websocket
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1" // skipcq: GSC-G505
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// acceptGUID is appended to the key of the client to compute the
+// Sec-WebSocket-Accept of the server, see RFC 6455, Section 1.3.
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+var ErrBadHandshake = errors.New("websocket: bad handshake")
+
+// Client runs the opening handshake of a WebSocket client over conn,
+// requesting path (e.g., "/" or "/ws?token=x") from host, with the extra
+// header fields in header, if any.
+//
+// The handshake is not bounded in time, deadlines may be set on conn to
+// do so.
+func Client(conn net.Conn, host, path string, header http.Header) (*Conn, error) {
+	if path == "" {
+		path = "/"
+	}
+	u, err := url.ParseRequestURI(path)
+	if err != nil {
+		return nil, fmt.Errorf("websocket: invalid path %q: %w", path, err)
+	}
+	u.Scheme, u.Host = "http", host
+
+	var nonce [16]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce[:])
+
+	req := &http.Request{
+		Method:     http.MethodGet,
+		URL:        u,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     header.Clone(),
+		Host:       host,
+	}
+	if req.Header == nil {
+		req.Header = make(http.Header)
+	}
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return nil, fmt.Errorf("%w: server responded %s", ErrBadHandshake, resp.Status)
+	}
+	if !headerHasToken(resp.Header, "Upgrade", "websocket") || !headerHasToken(resp.Header, "Connection", "upgrade") {
+		return nil, fmt.Errorf("%w: server did not upgrade to WebSocket", ErrBadHandshake)
+	}
+	if resp.Header.Get("Sec-WebSocket-Accept") != acceptKey(key) {
+		return nil, fmt.Errorf("%w: mismatching Sec-WebSocket-Accept", ErrBadHandshake)
+	}
+
+	return newConn(conn, br, true), nil
+}
+
+// Server runs the opening handshake of a WebSocket server over conn. If
+// path is not empty, requests for other paths are rejected with 404 Not
+// Found. Invalid requests are responded to with an HTTP error before the
+// error is returned.
+//
+// The handshake is not bounded in time, deadlines may be set on conn to
+// do so.
+func Server(conn net.Conn, path string) (*Conn, error) {
+	br := bufio.NewReader(conn)
+	req, err := http.ReadRequest(br)
+	if err != nil {
+		return nil, err
+	}
+	req.Body.Close()
+
+	reject := func(code int, extra string, reason string) error {
+		fmt.Fprintf(conn, "HTTP/1.1 %03d %s\r\n%sConnection: close\r\nContent-Length: 0\r\n\r\n", code, http.StatusText(code), extra)
+		return fmt.Errorf("%w: %s", ErrBadHandshake, reason)
+	}
+
+	switch {
+	case req.Method != http.MethodGet:
+		return nil, reject(http.StatusMethodNotAllowed, "", "method is not GET")
+	case !headerHasToken(req.Header, "Upgrade", "websocket") || !headerHasToken(req.Header, "Connection", "upgrade"):
+		return nil, reject(http.StatusBadRequest, "", "client did not request an upgrade to WebSocket")
+	case req.Header.Get("Sec-WebSocket-Version") != "13":
+		return nil, reject(http.StatusUpgradeRequired, "Sec-WebSocket-Version: 13\r\n", "unsupported WebSocket version")
+	case path != "" && req.URL.Path != path:
+		return nil, reject(http.StatusNotFound, "", fmt.Sprintf("unexpected path %q", req.URL.Path))
+	}
+
+	key := req.Header.Get("Sec-WebSocket-Key")
+	if nonce, err := base64.StdEncoding.DecodeString(key); err != nil || len(nonce) != 16 {
+		return nil, reject(http.StatusBadRequest, "", "invalid Sec-WebSocket-Key")
+	}
+
+	_, err = fmt.Fprintf(conn, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n", acceptKey(key))
+	if err != nil {
+		return nil, err
+	}
+
+	return newConn(conn, br, false), nil
+}
+
+func acceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + acceptGUID)) // skipcq: GSC-G401
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// headerHasToken reports whether the comma-separated list of tokens in the
+// header field name contains token, case-insensitively.
+func headerHasToken(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, t := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,6 @@
+//go:build !race && !waterdebug
+
+package water
+
+// leakDetection is disabled, see leak_detection_enabled.go.
+const leakDetection = false
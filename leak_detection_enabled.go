@@ -0,0 +1,8 @@
+//go:build race || waterdebug
+
+package water
+
+// leakDetection enables the debug mode regardless of SetDebug in builds
+// with the race detector or the waterdebug build tag, e.g., go test -race
+// or go test -tags waterdebug.
+const leakDetection = true
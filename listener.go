@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"net"
+	"time"
 )
 
 // Listener listens on a local network address and upon caller
@@ -33,9 +34,50 @@ type Listener interface {
 	// as a water.Conn.
 	AcceptWATER() (Conn, error)
 
+	// Shutdown gracefully shuts down the Listener. It stops accepting new
+	// connections, then waits for all established connections to be closed
+	// or for ctx to expire, whichever happens first, before tearing down the
+	// WebAssembly instances of the remaining connections.
+	Shutdown(ctx context.Context) error
+
+	// UpdateConfig replaces the Config used for newly accepted connections
+	// while established connections keep the one they were accepted with,
+	// enabling zero-downtime upgrades of the WebAssembly Transport Module.
+	UpdateConfig(c *Config) error
+
+	// Connections returns a channel delivering the result of accepting
+	// each incoming connection, as an alternative to calling AcceptWATER
+	// in a loop, e.g., to select on it along with other channels. The
+	// same channel is returned on every call, which is closed once the
+	// Listener is closed.
+	//
+	// Connections should not be mixed with Accept or AcceptWATER, as each
+	// incoming connection is delivered to only one of them.
+	Connections() <-chan AcceptResult
+
 	mustEmbedUnimplementedListener()
 }
 
+// AcceptResult is the result of accepting an incoming connection with a
+// Listener, delivered by Listener.Connections.
+type AcceptResult struct {
+	// Conn is the connection accepted, or nil if Err is set.
+	Conn Conn
+
+	// Err is the error accepting the connection, if any. An error does
+	// not stop the delivery of the following connections.
+	Err error
+
+	// RemoteAddr is the address of the source of the incoming network
+	// connection, or nil if no network connection is accepted.
+	RemoteAddr net.Addr
+
+	// HandshakeDuration is the time spent from accepting the network
+	// connection until the Conn is ready, including the instantiation of
+	// the WebAssembly Transport Module and its handshake.
+	HandshakeDuration time.Duration
+}
+
 type newListenerFunc func(context.Context, *Config) (Listener, error)
 
 var (
@@ -56,6 +98,58 @@ func (*UnimplementedListener) AcceptWATER() (Conn, error) {
 	return nil, ErrUnimplementedListener
 }
 
+// Shutdown implements water.Listener.Shutdown().
+func (*UnimplementedListener) Shutdown(context.Context) error {
+	return ErrUnimplementedListener
+}
+
+// UpdateConfig implements water.Listener.UpdateConfig().
+func (*UnimplementedListener) UpdateConfig(*Config) error {
+	return ErrUnimplementedListener
+}
+
+// Connections implements water.Listener.Connections(). The channel
+// delivers ErrUnimplementedListener once before being closed.
+func (*UnimplementedListener) Connections() <-chan AcceptResult {
+	ch := make(chan AcceptResult, 1)
+	ch <- AcceptResult{Err: ErrUnimplementedListener}
+	close(ch)
+	return ch
+}
+
+// serveAcceptResults calls accept in a loop from a new goroutine and
+// delivers each result on the returned channel, until done is closed, for
+// Listener.Connections. A Conn still undelivered when done is closed is
+// closed instead of leaked.
+func serveAcceptResults(accept func() AcceptResult, done <-chan struct{}) <-chan AcceptResult {
+	results := make(chan AcceptResult)
+	go func() {
+		defer close(results)
+		for {
+			res := accept()
+
+			// errors caused by closing the Listener are not delivered
+			if res.Err != nil {
+				select {
+				case <-done:
+					return
+				default:
+				}
+			}
+
+			select {
+			case results <- res:
+			case <-done:
+				if res.Conn != nil {
+					res.Conn.Close()
+				}
+				return
+			}
+		}
+	}()
+	return results
+}
+
 // mustEmbedUnimplementedListener is a function that developers cannot
 func (*UnimplementedListener) mustEmbedUnimplementedListener() {} //nolint:unused
 
@@ -96,22 +190,48 @@ func NewListener(c *Config) (Listener, error) {
 // function call will return with an error.
 // Call [WazeroRuntimeConfigFactory.SetCloseOnContextDone] with false to disable
 // this behavior.
+//
+// The Listener keeps a copy of the Config, which must not be modified
+// afterwards, see ErrConfigMutated.
 func NewListenerWithContext(ctx context.Context, c *Config) (Listener, error) {
+	c, err := c.snapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	if c.ProcessIsolation != nil {
+		if err := c.checkIsolation(); err != nil {
+			return nil, err
+		}
+		return newIsolatedListener(ctx, c), nil
+	}
+
+	spec, err := negotiateVersion(c.TransportModuleBin)
+	if err != nil {
+		return nil, err
+	}
+	if spec != nil {
+		for _, name := range spec.exportNames(RoleListener) {
+			if f, ok := knownListenerVersions[name]; ok {
+				return f(ctx, c)
+			}
+		}
+		return nil, versionRoleError(ErrListenerVersionNotFound, spec, RoleListener)
+	}
+
 	core, err := NewCoreWithContext(ctx, c)
 	if err != nil {
 		return nil, err
 	}
+	defer core.Close() // skipcq: GO-S2307
 
-	// Search through all exported names and match them to potential
-	// Listener versions.
-	//
-	// TODO: detect the version of the WebAssembly Transport Module
-	// in a more organized way.
+	// The WATM declares no version, search through all exported names
+	// and match them to potential Listener versions.
 	for exportName := range core.Exports() {
 		if f, ok := knownListenerVersions[exportName]; ok {
 			return f(ctx, c)
 		}
 	}
 
-	return nil, ErrListenerVersionNotFound
+	return nil, versionNotFoundError(ErrListenerVersionNotFound, c.TransportModuleBin, RoleListener)
 }
@@ -0,0 +1,84 @@
+package water
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"expvar"
+	"sync"
+)
+
+// The counters of WATER published with expvar, under the "water" map,
+// e.g., served at /debug/vars by the net/http package:
+//   - "active_instances": the WASM instances not yet closed, see ActiveCores.
+//   - "leaked_instances": the WASM instances garbage collected without
+//     being closed, see LeakedCores.
+//   - "instances_created": the WASM instances created.
+//   - "compiles": the WATMs compiled, or loaded from a CompilationCache.
+//   - "traps": the WASM instances crashed, see Config.OnModuleCrash.
+var (
+	instancesCreated = new(expvar.Int)
+	compiles         = new(expvar.Int)
+	traps            = new(expvar.Int)
+)
+
+func init() {
+	vars := expvar.NewMap("water")
+	vars.Set("active_instances", expvar.Func(func() any { return ActiveCores() }))
+	vars.Set("leaked_instances", expvar.Func(func() any { return LeakedCores() }))
+	vars.Set("instances_created", instancesCreated)
+	vars.Set("compiles", compiles)
+	vars.Set("traps", traps)
+}
+
+// The labels of the goroutines running a WATM, for the profiler:
+//   - "watm": the first 8 bytes of the SHA-256 of the WATM, in hex.
+//   - "conn": the ID of the WASM instance, unique in the process.
+//   - "role": "dialer", "listener" or "relay", only set for the worker
+//     thread by the transport drivers.
+const (
+	ProfilerLabelWATM = "watm"
+	ProfilerLabelConn = "conn"
+	ProfilerLabelRole = "role"
+)
+
+// moduleHashCacheSize is the number of WATMs whose hash is cached.
+const moduleHashCacheSize = 16
+
+var moduleHashCache struct {
+	sync.Mutex
+	entries []moduleHashEntry // the least recently hashed first
+}
+
+type moduleHashEntry struct {
+	bin  []byte // kept so that it is not reallocated while cached
+	hash string
+}
+
+// moduleHash returns the first 8 bytes of the SHA-256 of the WATM bin in
+// hex, e.g., to label the profiles. The hash of the same slice is cached,
+// instead of hashing a WATM of megabytes for each connection.
+func moduleHash(bin []byte) string {
+	if len(bin) == 0 {
+		return ""
+	}
+
+	moduleHashCache.Lock()
+	for _, e := range moduleHashCache.entries {
+		if len(e.bin) == len(bin) && &e.bin[0] == &bin[0] {
+			moduleHashCache.Unlock()
+			return e.hash
+		}
+	}
+	moduleHashCache.Unlock()
+
+	digest := sha256.Sum256(bin)
+	hash := hex.EncodeToString(digest[:8])
+
+	moduleHashCache.Lock()
+	if len(moduleHashCache.entries) == moduleHashCacheSize {
+		moduleHashCache.entries = moduleHashCache.entries[1:]
+	}
+	moduleHashCache.entries = append(moduleHashCache.entries, moduleHashEntry{bin: bin, hash: hash})
+	moduleHashCache.Unlock()
+	return hash
+}
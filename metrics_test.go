@@ -0,0 +1,117 @@
+package water_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"expvar"
+	"net"
+	"runtime/pprof"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/refraction-networking/water"
+	_ "github.com/refraction-networking/water/transport/v1"
+)
+
+func expvarInt(t *testing.T, name string) int64 {
+	t.Helper()
+	v := expvar.Get("water").(*expvar.Map).Get(name)
+	if v == nil {
+		t.Fatalf("expvar water.%s is not published", name)
+	}
+	n, err := strconv.ParseInt(v.String(), 10, 64)
+	if err != nil {
+		t.Fatalf("expvar water.%s = %s: %v", name, v, err)
+	}
+	return n
+}
+
+func TestExpvar(t *testing.T) {
+	created, compiles, traps := expvarInt(t, "instances_created"), expvarInt(t, "compiles"), expvarInt(t, "traps")
+
+	core, err := water.NewCoreWithContext(context.Background(), &water.Config{TransportModuleBin: wasmCrash})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer core.Close() // skipcq: GO-S2307
+
+	if got := expvarInt(t, "instances_created"); got != created+1 {
+		t.Errorf("instances_created = %d, want %d", got, created+1)
+	}
+	if got := expvarInt(t, "compiles"); got != compiles+1 {
+		t.Errorf("compiles = %d, want %d", got, compiles+1)
+	}
+	if got := expvarInt(t, "active_instances"); got != water.ActiveCores() {
+		t.Errorf("active_instances = %d, want %d", got, water.ActiveCores())
+	}
+
+	if err = core.ImportFunction("env", "boom", func() {}); err != nil {
+		t.Fatal(err)
+	}
+	if err = core.Instantiate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = core.Invoke("trap"); err == nil {
+		t.Fatal("Invoke() returned no error")
+	}
+	if got := expvarInt(t, "traps"); got != traps+1 {
+		t.Errorf("traps = %d, want %d", got, traps+1)
+	}
+}
+
+func TestProfilerLabels(t *testing.T) {
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close() // skipcq: GO-S2307
+
+	dialer, err := water.NewDialerWithContext(context.Background(), &water.Config{
+		TransportModuleBin: wasmReverse,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := dialer.DialContext(context.Background(), "tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close() // skipcq: GO-S2307
+
+	peerConn, err := lis.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peerConn.Close() // skipcq: GO-S2307
+
+	digest := sha256.Sum256(wasmReverse)
+	want := []string{
+		`"` + water.ProfilerLabelWATM + `":"` + hex.EncodeToString(digest[:8]) + `"`,
+		`"` + water.ProfilerLabelRole + `":"dialer"`,
+		`"` + water.ProfilerLabelConn + `":"`,
+	}
+
+	// the worker thread is labeled once it is scheduled
+	var profile bytes.Buffer
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		profile.Reset()
+		if err := pprof.Lookup("goroutine").WriteTo(&profile, 1); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, line := range bytes.Split(profile.Bytes(), []byte("\n")) {
+			found := bytes.HasPrefix(line, []byte("# labels:"))
+			for _, label := range want {
+				found = found && bytes.Contains(line, []byte(label))
+			}
+			if found {
+				return
+			}
+		}
+	}
+	t.Errorf("goroutine profile has no worker thread labeled with %q:\n%s", want, profile.Bytes())
+}
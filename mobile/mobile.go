@@ -0,0 +1,270 @@
+// Package mobile provides a flattened API of WATER for gomobile, so that
+// Android and iOS apps could embed WATER directly with
+//
+//	gomobile bind -target=android github.com/refraction-networking/water/mobile
+//
+// gomobile only binds a few types (e.g., integers, strings, []byte and
+// pointers to exported structs), so this package wraps the Dialer, the
+// Listener and the Conn of WATER in structs with methods of such types
+// only. Durations are in milliseconds and addresses are strings.
+//
+// All WATM versions supported by WATER are registered by this package.
+package mobile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/refraction-networking/water"
+	_ "github.com/refraction-networking/water/transport/all" // register all WATM versions
+)
+
+var ErrNilConfig = errors.New("mobile: nil config")
+
+// Config configures a Dialer or a Listener. It is copied when used, so it
+// may be modified afterwards without affecting them.
+type Config struct {
+	config *water.Config
+}
+
+// NewConfig creates a Config running the WebAssembly Transport Module in
+// wasm.
+func NewConfig(wasm []byte) *Config {
+	return &Config{
+		config: &water.Config{
+			TransportModuleBin:  append([]byte(nil), wasm...),
+			ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+		},
+	}
+}
+
+// NewConfigFromJSON creates a Config from a JSON config, in the format of
+// configbuilder.ConfigJSON. Paths in it are relative to the working
+// directory, so the transport module is better given inline or as a URL.
+func NewConfigFromJSON(data []byte) (*Config, error) {
+	c := &water.Config{}
+	if err := c.UnmarshalJSON(data); err != nil {
+		return nil, err
+	}
+	return &Config{config: c}, nil
+}
+
+// SetTransportModuleConfig sets the config file pushed into the WATM.
+func (c *Config) SetTransportModuleConfig(config []byte) {
+	c.config.TransportModuleConfig = water.TransportModuleConfigFromBytes(append([]byte(nil), config...))
+}
+
+// SetModuleEnv sets the environment variable key of the WATM to value,
+// see water.Config.ModuleEnv.
+func (c *Config) SetModuleEnv(key, value string) {
+	if c.config.ModuleEnv == nil {
+		c.config.ModuleEnv = make(map[string]string)
+	}
+	c.config.ModuleEnv[key] = value
+}
+
+// SetRemoteAddress sets the logical destination the WATM is to target,
+// e.g., as the SNI, see water.Config.RemoteAddress.
+func (c *Config) SetRemoteAddress(address string) {
+	c.config.RemoteAddress = address
+}
+
+// SetInterpreter selects whether the WATM is interpreted instead of
+// compiled to machine code, which saves memory at the cost of speed.
+func (c *Config) SetInterpreter(interpreter bool) {
+	if c.config.RuntimeOptions == nil {
+		c.config.RuntimeOptions = &water.RuntimeOptions{}
+	}
+	c.config.RuntimeOptions.Strategy = water.RuntimeStrategyAuto
+	if interpreter {
+		c.config.RuntimeOptions.Strategy = water.RuntimeStrategyInterpreter
+	}
+}
+
+// SetIdleTimeout closes each connection after timeoutMillis milliseconds
+// without data flowing, see water.Config.IdleTimeout. Zero disables it.
+func (c *Config) SetIdleTimeout(timeoutMillis int64) {
+	c.config.IdleTimeout = time.Duration(timeoutMillis) * time.Millisecond
+}
+
+// Dialer dials connections running the WATM.
+type Dialer struct {
+	dialer water.Dialer
+}
+
+// NewDialer creates a Dialer from the Config.
+func NewDialer(c *Config) (*Dialer, error) {
+	if c == nil {
+		return nil, ErrNilConfig
+	}
+
+	dialer, err := water.NewDialerWithContext(context.Background(), c.config.Clone())
+	if err != nil {
+		return nil, err
+	}
+	return &Dialer{dialer: dialer}, nil
+}
+
+// Dial connects to address on the named network, e.g., "tcp".
+func (d *Dialer) Dial(network, address string) (*Conn, error) {
+	return d.DialTimeout(network, address, 0)
+}
+
+// DialTimeout is like Dial, but fails if the connection is not ready after
+// timeoutMillis milliseconds. Zero means no timeout.
+func (d *Dialer) DialTimeout(network, address string, timeoutMillis int64) (*Conn, error) {
+	// the context of DialContext bounds the lifetime of the connection, so
+	// the timeout only bounds the wait for it
+	type dialResult struct {
+		conn water.Conn
+		err  error
+	}
+	results := make(chan dialResult, 1)
+	go func() {
+		conn, err := d.dialer.DialContext(context.Background(), network, address)
+		results <- dialResult{conn, err}
+	}()
+
+	var timeout <-chan time.Time
+	if timeoutMillis > 0 {
+		timer := time.NewTimer(time.Duration(timeoutMillis) * time.Millisecond)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case res := <-results:
+		if res.err != nil {
+			return nil, res.err
+		}
+		return &Conn{conn: res.conn}, nil
+	case <-timeout:
+		go func() {
+			if res := <-results; res.conn != nil {
+				res.conn.Close()
+			}
+		}()
+		return nil, fmt.Errorf("mobile: dialing %s: %w", address, context.DeadlineExceeded)
+	}
+}
+
+// Listener accepts connections running the WATM.
+type Listener struct {
+	listener water.Listener
+}
+
+// Listen creates a Listener from the Config, listening on address on the
+// named network, e.g., "tcp".
+func Listen(c *Config, network, address string) (*Listener, error) {
+	if c == nil {
+		return nil, ErrNilConfig
+	}
+
+	listener, err := c.config.Clone().ListenContext(context.Background(), network, address)
+	if err != nil {
+		return nil, err
+	}
+	return &Listener{listener: listener}, nil
+}
+
+// Accept waits for and returns the next connection.
+func (l *Listener) Accept() (*Conn, error) {
+	conn, err := l.listener.AcceptWATER()
+	if err != nil {
+		return nil, err
+	}
+	return &Conn{conn: conn}, nil
+}
+
+// Addr returns the address the Listener is listening on.
+func (l *Listener) Addr() string {
+	return addrString(l.listener.Addr())
+}
+
+// Close stops accepting connections. The connections accepted are not
+// closed.
+func (l *Listener) Close() error {
+	return l.listener.Close()
+}
+
+// Conn is a connection running the WATM.
+type Conn struct {
+	conn water.Conn
+}
+
+// Read reads up to len(b) bytes into b. Some bindings copy b instead of
+// sharing it, in which case ReadBytes must be used instead.
+func (c *Conn) Read(b []byte) (int, error) {
+	return c.conn.Read(b)
+}
+
+// ReadBytes reads up to max bytes and returns them.
+func (c *Conn) ReadBytes(max int) ([]byte, error) {
+	b := make([]byte, max)
+	n, err := c.conn.Read(b)
+	if n > 0 {
+		// bound methods drop the result upon an error, so the error is
+		// left to the next read, e.g., io.EOF
+		return b[:n], nil
+	}
+	return nil, err
+}
+
+// Write writes b.
+func (c *Conn) Write(b []byte) (int, error) {
+	return c.conn.Write(b)
+}
+
+// SetReadTimeout makes reads fail once timeoutMillis milliseconds have
+// elapsed from now. Zero means no timeout.
+func (c *Conn) SetReadTimeout(timeoutMillis int64) error {
+	return c.conn.SetReadDeadline(deadline(timeoutMillis))
+}
+
+// SetWriteTimeout makes writes fail once timeoutMillis milliseconds have
+// elapsed from now. Zero means no timeout.
+func (c *Conn) SetWriteTimeout(timeoutMillis int64) error {
+	return c.conn.SetWriteDeadline(deadline(timeoutMillis))
+}
+
+// LocalAddr returns the local address of the connection.
+func (c *Conn) LocalAddr() string {
+	return addrString(c.conn.LocalAddr())
+}
+
+// RemoteAddr returns the remote address of the connection.
+func (c *Conn) RemoteAddr() string {
+	return addrString(c.conn.RemoteAddr())
+}
+
+// CloseReason returns why the WATM reports the connection ended, if it
+// does, see water.CloseReason.
+func (c *Conn) CloseReason() string {
+	reason := c.conn.CloseReason()
+	if reason == (water.CloseReason{}) {
+		return ""
+	}
+	return reason.String()
+}
+
+// Close closes the connection.
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+func deadline(timeoutMillis int64) time.Time {
+	if timeoutMillis <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(time.Duration(timeoutMillis) * time.Millisecond)
+}
+
+func addrString(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	return addr.String()
+}
@@ -0,0 +1,83 @@
+package mobile_test
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/refraction-networking/water/mobile"
+)
+
+func TestDialListen(t *testing.T) {
+	wasm, err := os.ReadFile("../transport/v1/testdata/plain.wasm")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := mobile.NewConfig(wasm)
+	config.SetInterpreter(true)
+
+	lis, err := mobile.Listen(config, "tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close() // skipcq: GO-S2307
+
+	serverConns := make(chan *mobile.Conn, 1)
+	go func() {
+		conn, err := lis.Accept()
+		if err != nil {
+			close(serverConns)
+			return
+		}
+		serverConns <- conn
+	}()
+
+	dialer, err := mobile.NewDialer(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clientConn, err := dialer.DialTimeout("tcp", lis.Addr(), 5000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clientConn.Close() // skipcq: GO-S2307
+
+	serverConn, ok := <-serverConns
+	if !ok {
+		t.Fatal("Accept failed")
+	}
+	defer serverConn.Close() // skipcq: GO-S2307
+
+	if serverConn.LocalAddr() != lis.Addr() {
+		t.Errorf("LocalAddr() = %q, want %q", serverConn.LocalAddr(), lis.Addr())
+	}
+
+	for _, pair := range [][2]*mobile.Conn{{clientConn, serverConn}, {serverConn, clientConn}} {
+		if err := pair[1].SetReadTimeout(5000); err != nil {
+			t.Fatal(err)
+		}
+
+		msg := []byte("hello")
+		if _, err := pair[0].Write(msg); err != nil {
+			t.Fatal(err)
+		}
+
+		var got []byte
+		for len(got) < len(msg) {
+			b, err := pair[1].ReadBytes(len(msg) - len(got))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, b...)
+		}
+		if !bytes.Equal(got, msg) {
+			t.Errorf("read %q, want %q", got, msg)
+		}
+	}
+
+	if _, err = mobile.NewDialer(nil); err != mobile.ErrNilConfig {
+		t.Errorf("NewDialer(nil) returned %v, want %v", err, mobile.ErrNilConfig)
+	}
+}
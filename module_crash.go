@@ -0,0 +1,112 @@
+package water
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+
+	"github.com/refraction-networking/water/internal/log"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/sys"
+)
+
+// ErrModuleCrashed is wrapped by the error of a call into a WebAssembly
+// Transport Module which trapped, e.g., on an unreachable instruction or
+// an out-of-bounds memory access, or panicked.
+var ErrModuleCrashed = errors.New("water: WATM crashed")
+
+// ModuleCrash describes a crash of the WASM instance of a connection,
+// which fails that connection alone instead of the whole process.
+type ModuleCrash struct {
+	// Function is the name of the exported function which crashed, e.g.,
+	// "watm_start_v1".
+	Function string
+
+	// Err is the trap or the recovered panic, including the stack trace
+	// of the WebAssembly functions if known.
+	Err error
+
+	// Stack is the stack trace of the goroutine if the panic is recovered
+	// outside of the WebAssembly runtime, or nil.
+	Stack []byte
+}
+
+// Error implements the error interface.
+func (c *ModuleCrash) Error() string {
+	return fmt.Sprintf("water: WATM crashed in %s: %v", c.Function, c.Err)
+}
+
+// Unwrap returns ErrModuleCrashed and the trap or the recovered panic.
+func (c *ModuleCrash) Unwrap() []error {
+	return []error{ErrModuleCrashed, c.Err}
+}
+
+// callModule calls the exported function f of the instance mod with ctx
+// once the pool, if not nil, allows it, releasing the slot while the WATM
+// waits in a host function. A trap in the WATM or a panic in
+// the call is returned as a *ModuleCrash, after reporting it to the
+// CrashDumpSink and OnModuleCrash if set. An exit of the WATM, e.g., as
+// ctx is done, is not a crash.
+func (c *Config) callModule(ctx context.Context, mod api.Module, pool *ExecutionPool, f api.Function, params ...uint64) (results []uint64, err error) {
+	if err := pool.Acquire(ctx); err != nil {
+		return nil, err
+	}
+	if pool != nil {
+		// released while the WATM waits in a host function, see
+		// executionPoolListener
+		slot := &executionPoolSlot{pool: pool, held: true}
+		ctx = context.WithValue(ctx, executionPoolSlotKey{}, slot)
+		defer func() {
+			if slot.held {
+				pool.Release()
+			}
+		}()
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			crashErr, ok := r.(error)
+			if !ok {
+				crashErr = fmt.Errorf("panic: %v", r)
+			}
+			results, err = nil, c.moduleCrashed(mod, f, crashErr, debug.Stack())
+		}
+	}()
+
+	results, err = f.Call(ctx, params...)
+	if err != nil {
+		var exitErr *sys.ExitError
+		if !errors.As(err, &exitErr) { // wazero recovers traps and panics in host functions as errors
+			return nil, c.moduleCrashed(mod, f, err, nil)
+		}
+	}
+	return results, err
+}
+
+func (c *Config) moduleCrashed(mod api.Module, f api.Function, err error, stack []byte) *ModuleCrash {
+	crash := &ModuleCrash{
+		Function: exportName(f.Definition()),
+		Err:      err,
+		Stack:    stack,
+	}
+
+	traps.Add(1)
+	if c.CrashDumpSink != nil {
+		if err := c.CrashDumpSink.WriteCrashDump(c.newCrashDump(mod, crash)); err != nil {
+			log.LErrorf(c.Logger(), "water: writing crash dump of %s: %v", crash.Function, err)
+		}
+	}
+	if c.OnModuleCrash != nil {
+		c.OnModuleCrash(crash)
+	}
+	return crash
+}
+
+// exportName returns the name def is exported as, or its name otherwise.
+func exportName(def api.FunctionDefinition) string {
+	if names := def.ExportNames(); len(names) > 0 {
+		return names[0]
+	}
+	return def.Name()
+}
@@ -0,0 +1,60 @@
+package water_test
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"testing"
+
+	"github.com/refraction-networking/water"
+)
+
+// wasmCrash is a module whose exported functions crash.
+//
+//go:embed testdata/crash.wasm
+var wasmCrash []byte
+
+func TestConfig_OnModuleCrash(t *testing.T) {
+	var crashes []*water.ModuleCrash
+	core, err := water.NewCoreWithContext(context.Background(), &water.Config{
+		TransportModuleBin: wasmCrash,
+		OnModuleCrash: func(crash *water.ModuleCrash) {
+			crashes = append(crashes, crash)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer core.Close() // skipcq: GO-S2307
+
+	if err = core.ImportFunction("env", "boom", func() { panic("boom") }); err != nil {
+		t.Fatal(err)
+	}
+	if err = core.Instantiate(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, funcName := range []string{"trap", "panic"} {
+		_, err := core.Invoke(funcName)
+		if !errors.Is(err, water.ErrModuleCrashed) {
+			t.Fatalf("Invoke(%q) error = %v, want %v", funcName, err, water.ErrModuleCrashed)
+		}
+
+		var crash *water.ModuleCrash
+		if !errors.As(err, &crash) {
+			t.Fatalf("Invoke(%q) error = %v, want a *ModuleCrash", funcName, err)
+		}
+		if crash.Function != funcName {
+			t.Errorf("Function = %q, want %q", crash.Function, funcName)
+		}
+
+		if len(crashes) != i+1 || crashes[i] != crash {
+			t.Fatalf("OnModuleCrash is not called with the crash of %q", funcName)
+		}
+	}
+
+	// a crashed instance keeps failing calls with errors, not panics
+	if _, err := core.Invoke("trap"); !errors.Is(err, water.ErrModuleCrashed) {
+		t.Errorf("Invoke(%q) error = %v, want %v", "trap", err, water.ErrModuleCrashed)
+	}
+}
@@ -0,0 +1,78 @@
+package water
+
+import (
+	"context"
+	"sort"
+
+	"github.com/tetratelabs/wazero"
+)
+
+type moduleEnvContextKey struct{}
+
+type moduleArgvContextKey struct{}
+
+// WithModuleEnv returns a copy of ctx carrying environment variables which
+// override those in Config.ModuleEnv for the WASM instance created with
+// the returned context, e.g., when passed to Dialer.DialContext. This
+// allows the same WATM to switch its behavior (e.g., the SNI to use) per
+// connection without a separate config channel.
+func WithModuleEnv(ctx context.Context, env map[string]string) context.Context {
+	return context.WithValue(ctx, moduleEnvContextKey{}, env)
+}
+
+// WithModuleArgv returns a copy of ctx carrying arguments which replace
+// Config.ModuleArgv for the WASM instance created with the returned
+// context, e.g., when passed to Dialer.DialContext.
+func WithModuleArgv(ctx context.Context, argv []string) context.Context {
+	return context.WithValue(ctx, moduleArgvContextKey{}, argv)
+}
+
+// contextHasModuleEnviron reports whether ctx carries arguments or
+// environment variables set with WithModuleEnv or WithModuleArgv, which
+// instances created before the context is known would miss.
+func contextHasModuleEnviron(ctx context.Context) bool {
+	_, hasEnv := ctx.Value(moduleEnvContextKey{}).(map[string]string)
+	_, hasArgv := ctx.Value(moduleArgvContextKey{}).([]string)
+	return hasEnv || hasArgv
+}
+
+// hasModuleEnviron reports whether any argument or environment variable is
+// set in the Config or carried by ctx.
+func (c *Config) hasModuleEnviron(ctx context.Context) bool {
+	env, _ := ctx.Value(moduleEnvContextKey{}).(map[string]string)
+	_, hasArgv := ctx.Value(moduleArgvContextKey{}).([]string)
+	return len(c.ModuleEnv) > 0 || len(c.ModuleArgv) > 0 || len(env) > 0 || hasArgv
+}
+
+// withModuleEnviron returns mc with the arguments and environment variables
+// in the Config, overridden by those carried by ctx, if any. They are
+// applied on top of those set via the ModuleConfigFactory.
+func (c *Config) withModuleEnviron(ctx context.Context, mc wazero.ModuleConfig) wazero.ModuleConfig {
+	if argv, ok := ctx.Value(moduleArgvContextKey{}).([]string); ok {
+		mc = mc.WithArgs(argv...)
+	} else if len(c.ModuleArgv) > 0 {
+		mc = mc.WithArgs(c.ModuleArgv...)
+	}
+
+	env := make(map[string]string, len(c.ModuleEnv))
+	for k, v := range c.ModuleEnv {
+		env[k] = v
+	}
+	if ctxEnv, ok := ctx.Value(moduleEnvContextKey{}).(map[string]string); ok {
+		for k, v := range ctxEnv {
+			env[k] = v
+		}
+	}
+
+	// sorted so that the WATM observes the same environment every time
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		mc = mc.WithEnv(k, env[k])
+	}
+
+	return mc
+}
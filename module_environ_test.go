@@ -0,0 +1,88 @@
+package water_test
+
+import (
+	"context"
+	_ "embed"
+	"testing"
+
+	"github.com/refraction-networking/water"
+)
+
+// wasmEnviron exports the sizes of its arguments and environment
+// variables, as reported by WASI, indexed by 0 for the count and 4 for the
+// total size in bytes.
+//
+//go:embed testdata/environ.wasm
+var wasmEnviron []byte
+
+// environSizes instantiates wasmEnviron with config and ctx, and returns
+// the count and total size of the arguments and environment variables
+// observed by the WATM.
+func environSizes(t *testing.T, ctx context.Context, config *water.Config) (argc, argvSize, envc, envSize uint64) {
+	t.Helper()
+
+	core, err := water.NewCoreWithContext(ctx, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer core.Close() // skipcq: GO-S2307
+
+	if err := core.WASIPreview1(); err != nil {
+		t.Fatal(err)
+	}
+	if err := core.Instantiate(); err != nil {
+		t.Fatal(err)
+	}
+
+	invoke := func(name string, offset uint64) uint64 {
+		results, err := core.Invoke(name, offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return results[0]
+	}
+
+	return invoke("args_sizes", 0), invoke("args_sizes", 4), invoke("environ_sizes", 0), invoke("environ_sizes", 4)
+}
+
+func TestConfig_ModuleEnviron(t *testing.T) {
+	config := &water.Config{
+		TransportModuleBin: wasmEnviron,
+		ModuleEnv:          map[string]string{"SNI": "example.com"}, // "SNI=example.com\x00" is 16 bytes
+		ModuleArgv:         []string{"watm"},                        // "watm\x00" is 5 bytes
+		WASIPolicy:         &water.WASIPolicy{Environ: true},
+	}
+
+	t.Run("config", func(t *testing.T) {
+		argc, argvSize, envc, envSize := environSizes(t, context.Background(), config)
+		if argc != 1 || argvSize != 5 {
+			t.Errorf("args sizes = (%d, %d), want (1, 5)", argc, argvSize)
+		}
+		if envc != 1 || envSize != 16 {
+			t.Errorf("environ sizes = (%d, %d), want (1, 16)", envc, envSize)
+		}
+	})
+
+	t.Run("per connection", func(t *testing.T) {
+		ctx := water.WithModuleEnv(context.Background(), map[string]string{"SNI": "example.org.", "V": "1"}) // 17 + 4 bytes
+		ctx = water.WithModuleArgv(ctx, []string{"watm", "-v"})                                              // 5 + 3 bytes
+
+		argc, argvSize, envc, envSize := environSizes(t, ctx, config)
+		if argc != 2 || argvSize != 8 {
+			t.Errorf("args sizes = (%d, %d), want (2, 8)", argc, argvSize)
+		}
+		if envc != 2 || envSize != 21 {
+			t.Errorf("environ sizes = (%d, %d), want (2, 21)", envc, envSize)
+		}
+	})
+
+	t.Run("withheld by policy", func(t *testing.T) {
+		withheld := config.Clone()
+		withheld.WASIPolicy = &water.WASIPolicy{}
+
+		argc, _, envc, _ := environSizes(t, context.Background(), withheld)
+		if argc != 0 || envc != 0 {
+			t.Errorf("args and environ counts = (%d, %d), want (0, 0)", argc, envc)
+		}
+	})
+}
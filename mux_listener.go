@@ -0,0 +1,548 @@
+package water
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/refraction-networking/water/internal/log"
+)
+
+// MuxListener is a Listener serving several WebAssembly Transport Modules
+// on a single NetworkListener, routing each incoming connection to one of
+// them by its local address or by the first bytes it sends, e.g., the SNI
+// of a TLS ClientHello.
+//
+// Each route is served by a Listener created from its Config, so the
+// AcceptFilter, AcceptRateLimit, TCPOptions, limits and TransportChain of
+// the route apply to the connections routed to it.
+//
+// A MuxListener does not support UpdateConfig. Instead, a new MuxListener
+// may be created from the same NetworkListener.
+type MuxListener struct {
+	networkListener net.Listener
+	routes          []MuxRoute
+	listeners       []Listener
+	queues          []*queueListener
+	peekTimeout     time.Duration
+	concurrency     int
+
+	closed          atomic.Bool
+	done            chan struct{} // closed once the MuxListener is closed
+	routed          <-chan AcceptResult
+	routedOnce      sync.Once
+	connections     <-chan AcceptResult
+	connectionsOnce sync.Once
+
+	UnimplementedListener // embedded to ensure forward compatibility
+}
+
+// MuxListenerConfig configures a MuxListener.
+type MuxListenerConfig struct {
+	// NetworkListener is the net.Listener to accept the incoming
+	// connections from. It is closed when the MuxListener is closed.
+	NetworkListener net.Listener
+
+	// Routes lists the routes an incoming connection may be routed to.
+	// An incoming connection is routed to the first route matching it,
+	// or closed if none does.
+	Routes []MuxRoute
+
+	// PeekTimeout optionally limits the time waited for the bytes peeked
+	// by the routes, after which the connection is closed unless a route
+	// not peeking, e.g., for a WATM whose server speaks first, matches it
+	// afterwards. If this field is unset, it defaults to 10 seconds.
+	PeekTimeout time.Duration
+
+	// HandshakeConcurrency optionally bounds the incoming connections
+	// routed and handshaken concurrently, each on its own goroutine, so
+	// that a client sending nothing holds back no other client for the
+	// PeekTimeout. Accept then returns the connections in the order they
+	// are ready. If this field is unset, it defaults to 16.
+	HandshakeConcurrency int
+}
+
+// MuxRoute routes the incoming connections matching it to the WATM
+// specified in its Config.
+type MuxRoute struct {
+	// Config configures the Listener serving the route. Its
+	// NetworkListener is ignored.
+	Config *Config
+
+	// Match optionally reports whether an incoming connection matches the
+	// route, e.g., one created with MatchLocalPort, MatchPrefix or
+	// MatchServerName. If this field is unset, all connections match.
+	Match func(*MuxProbe) bool
+}
+
+const (
+	defaultMuxPeekTimeout          = 10 * time.Second
+	defaultMuxHandshakeConcurrency = 16
+)
+
+var _ Listener = (*MuxListener)(nil) // type guard
+
+// errMuxQueueEmpty is returned by a queueListener with no connection to
+// hand over, meaning the connection routed to it has been rejected.
+var errMuxQueueEmpty = errors.New("water: no connection routed")
+
+// NewMuxListener creates a MuxListener from the MuxListenerConfig, with
+// a Listener for each route created with NewListenerWithContext.
+func NewMuxListener(ctx context.Context, mc *MuxListenerConfig) (*MuxListener, error) {
+	if mc == nil || mc.NetworkListener == nil {
+		return nil, errors.New("water: MuxListener requires a NetworkListener")
+	}
+	if len(mc.Routes) == 0 {
+		return nil, errors.New("water: MuxListener requires at least one route")
+	}
+
+	m := &MuxListener{
+		networkListener: mc.NetworkListener,
+		routes:          append([]MuxRoute(nil), mc.Routes...),
+		peekTimeout:     mc.PeekTimeout,
+		concurrency:     mc.HandshakeConcurrency,
+		done:            make(chan struct{}),
+	}
+	if m.peekTimeout <= 0 {
+		m.peekTimeout = defaultMuxPeekTimeout
+	}
+	if m.concurrency <= 0 {
+		m.concurrency = defaultMuxHandshakeConcurrency
+	}
+
+	for i, route := range m.routes {
+		if route.Config == nil {
+			m.closeListeners()
+			return nil, fmt.Errorf("water: MuxListener route %d has nil Config", i)
+		}
+
+		config, err := route.Config.snapshot()
+		if err != nil {
+			m.closeListeners()
+			return nil, fmt.Errorf("water: MuxListener route %d: %w", i, err)
+		}
+		queue := &queueListener{addr: mc.NetworkListener.Addr()}
+		config.NetworkListener = queue
+
+		lis, err := NewListenerWithContext(ctx, config)
+		if err != nil {
+			m.closeListeners()
+			return nil, fmt.Errorf("water: creating Listener for MuxListener route %d: %w", i, err)
+		}
+		m.queues = append(m.queues, queue)
+		m.listeners = append(m.listeners, lis)
+	}
+
+	return m, nil
+}
+
+// Accept waits for and returns the next connection to the listener.
+//
+// Implements [net.Listener].
+func (m *MuxListener) Accept() (net.Conn, error) {
+	return m.AcceptWATER()
+}
+
+// AcceptWATER waits for and returns the next connection to the listener,
+// served by the WATM of the route it matches.
+//
+// Implements [Listener].
+func (m *MuxListener) AcceptWATER() (Conn, error) {
+	res := m.accept()
+	return res.Conn, res.Err
+}
+
+// Connections returns a channel delivering the result of accepting each
+// incoming connection, which is closed once the MuxListener is closed.
+//
+// Implements [Listener].
+func (m *MuxListener) Connections() <-chan AcceptResult {
+	m.connectionsOnce.Do(func() {
+		m.connections = serveAcceptResults(m.accept, m.done)
+	})
+	return m.connections
+}
+
+// accept returns the next connection routed and handshaken by the
+// goroutines of serveHandshakes, skipping those not routed or rejected.
+func (m *MuxListener) accept() AcceptResult {
+	m.routedOnce.Do(func() {
+		m.routed = serveHandshakes(m.concurrency, m.acceptNetworkConn, m.handshake, m.done)
+	})
+
+	for {
+		select {
+		case res, ok := <-m.routed:
+			if !ok {
+				return AcceptResult{Err: errors.New("water: listener is closed")}
+			}
+			if res.Conn == nil && res.Err == nil {
+				continue // not routed or rejected
+			}
+			return res
+		case <-m.done:
+			return AcceptResult{Err: errors.New("water: listener is closed")}
+		}
+	}
+}
+
+// acceptNetworkConn accepts the next incoming network connection.
+func (m *MuxListener) acceptNetworkConn() (net.Conn, error) {
+	if m.closed.Load() {
+		return nil, errors.New("water: listener is closed")
+	}
+	return m.networkListener.Accept()
+}
+
+// handshake routes netConn and hands it over to the Listener of the route
+// matching it, returning an empty AcceptResult if it is not routed or
+// rejected by the Config of the route.
+//
+// The Conn returned may be served over a connection routed to the same
+// route by another goroutine in the meantime, as each connection queued
+// is taken by a single call to AcceptWATER of the Listener, but not
+// necessarily the one following it.
+func (m *MuxListener) handshake(netConn net.Conn) (res AcceptResult) {
+	start := time.Now()
+
+	i, conn, err := m.route(netConn)
+	if err != nil {
+		log.Debugf("water: connection from %s not routed by MuxListener: %v", netConn.RemoteAddr(), err)
+		netConn.Close()
+		return res
+	}
+
+	if !m.queues[i].push(conn) {
+		conn.Close()
+		return res
+	}
+
+	waterConn, err := m.listeners[i].AcceptWATER()
+	if errors.Is(err, errMuxQueueEmpty) {
+		return res // rejected by the Config of the route
+	}
+
+	res.Conn, res.Err = waterConn, err
+	res.RemoteAddr = netConn.RemoteAddr()
+	if waterConn != nil {
+		res.RemoteAddr = waterConn.RemoteAddr()
+	}
+	res.HandshakeDuration = time.Since(start)
+	return res
+}
+
+// route returns the index of the first route matching conn, along with
+// the connection to hand over to it, replaying the bytes peeked, if any.
+func (m *MuxListener) route(conn net.Conn) (int, net.Conn, error) {
+	probe := &MuxProbe{
+		conn:     conn,
+		deadline: time.Now().Add(m.peekTimeout),
+	}
+
+	for i, route := range m.routes {
+		if route.Match != nil && !route.Match(probe) {
+			continue
+		}
+
+		if probe.r == nil {
+			return i, conn, nil
+		}
+		if err := conn.SetReadDeadline(time.Time{}); err != nil {
+			return 0, nil, err
+		}
+		if probe.r.Buffered() == 0 {
+			return i, conn, nil
+		}
+		return i, &peekedConn{Conn: conn, r: probe.r}, nil
+	}
+
+	if probe.err != nil {
+		return 0, nil, probe.err
+	}
+	return 0, nil, errors.New("water: no route matched")
+}
+
+// Close closes the MuxListener, along with its NetworkListener. It does
+// not close the established connections.
+//
+// Implements [net.Listener].
+func (m *MuxListener) Close() error {
+	if !m.closed.CompareAndSwap(false, true) {
+		return nil
+	}
+	close(m.done)
+	err := m.networkListener.Close()
+	m.closeListeners()
+	return err
+}
+
+func (m *MuxListener) closeListeners() {
+	for _, lis := range m.listeners {
+		lis.Close()
+	}
+	for _, queue := range m.queues {
+		queue.Close()
+	}
+}
+
+// Addr returns the address of the NetworkListener.
+//
+// Implements [net.Listener].
+func (m *MuxListener) Addr() net.Addr {
+	return m.networkListener.Addr()
+}
+
+// Shutdown closes the MuxListener and gracefully shuts down the Listener
+// of each route, see Listener.Shutdown.
+//
+// Implements [Listener].
+func (m *MuxListener) Shutdown(ctx context.Context) error {
+	err := m.Close()
+
+	errs := make([]error, len(m.listeners))
+	var wg sync.WaitGroup
+	for i, lis := range m.listeners {
+		wg.Add(1)
+		go func(i int, lis Listener) {
+			defer wg.Done()
+			errs[i] = lis.Shutdown(ctx)
+		}(i, lis)
+	}
+	wg.Wait()
+
+	return errors.Join(append(errs, err)...)
+}
+
+// MuxProbe exposes an incoming connection to the routes of a MuxListener
+// for them to match it, e.g., by its first bytes.
+type MuxProbe struct {
+	conn     net.Conn
+	r        *bufio.Reader // created by the first Peek
+	deadline time.Time
+	err      error // first error peeking
+
+	serverName       string
+	serverNameParsed bool
+}
+
+// muxPeekLimit is the most bytes a route may peek, which fits a TLS
+// record of the maximum size.
+const muxPeekLimit = 5 + 1<<14
+
+// LocalAddr returns the local address of the connection.
+func (p *MuxProbe) LocalAddr() net.Addr {
+	return p.conn.LocalAddr()
+}
+
+// RemoteAddr returns the remote address of the connection.
+func (p *MuxProbe) RemoteAddr() net.Addr {
+	return p.conn.RemoteAddr()
+}
+
+// Peek returns the first n bytes sent over the connection, without
+// consuming them, waiting for them until the PeekTimeout of the
+// MuxListener expires. If fewer than n bytes are returned, the error
+// explains why. At most 16389 bytes may be peeked.
+func (p *MuxProbe) Peek(n int) ([]byte, error) {
+	if n > muxPeekLimit {
+		return nil, bufio.ErrBufferFull
+	}
+
+	if p.r == nil {
+		if err := p.conn.SetReadDeadline(p.deadline); err != nil {
+			return nil, err
+		}
+		p.r = bufio.NewReaderSize(p.conn, muxPeekLimit)
+	}
+
+	b, err := p.r.Peek(n)
+	if err != nil && p.err == nil {
+		p.err = err
+	}
+	return b, err
+}
+
+// ServerName returns the SNI of the TLS ClientHello sent over the
+// connection, if any, peeking it. It returns false if the connection does
+// not start with a ClientHello or the ClientHello has no SNI.
+func (p *MuxProbe) ServerName() (string, bool) {
+	if !p.serverNameParsed {
+		p.serverNameParsed = true
+		p.serverName = p.parseServerName()
+	}
+	return p.serverName, p.serverName != ""
+}
+
+func (p *MuxProbe) parseServerName() string {
+	header, err := p.Peek(5)
+	if err != nil || header[0] != 0x16 { // handshake record
+		return ""
+	}
+
+	record, err := p.Peek(5 + (int(header[3])<<8 | int(header[4])))
+	if err != nil {
+		return ""
+	}
+
+	// crypto/tls parses the ClientHello, while the handshake is aborted
+	// before any byte is written back
+	var serverName string
+	errHelloParsed := errors.New("ClientHello parsed")
+	_ = tls.Server(&helloConn{Conn: p.conn, record: record}, &tls.Config{
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			serverName = hello.ServerName
+			return nil, errHelloParsed
+		},
+	}).Handshake()
+	return serverName
+}
+
+// MatchLocalPort returns a function for MuxRoute.Match matching the
+// connections accepted on the local port, e.g., when the NetworkListener
+// accepts connections redirected from several ports.
+func MatchLocalPort(port uint16) func(*MuxProbe) bool {
+	return func(p *MuxProbe) bool {
+		_, portStr, err := net.SplitHostPort(p.LocalAddr().String())
+		if err != nil {
+			return false
+		}
+		localPort, err := strconv.ParseUint(portStr, 10, 16)
+		return err == nil && uint16(localPort) == port
+	}
+}
+
+// MatchPrefix returns a function for MuxRoute.Match matching the
+// connections starting with prefix.
+func MatchPrefix(prefix []byte) func(*MuxProbe) bool {
+	return func(p *MuxProbe) bool {
+		b, err := p.Peek(len(prefix))
+		return err == nil && string(b) == string(prefix)
+	}
+}
+
+// MatchServerName returns a function for MuxRoute.Match matching the
+// connections starting with a TLS ClientHello whose SNI matches any of the
+// patterns, each either a hostname matched exactly or a wildcard (e.g.,
+// "*.example.com") matching any of its subdomains, both case-insensitively.
+func MatchServerName(patterns ...string) func(*MuxProbe) bool {
+	return func(p *MuxProbe) bool {
+		serverName, ok := p.ServerName()
+		if !ok {
+			return false
+		}
+		for _, pattern := range patterns {
+			if matchHostname(serverName, pattern) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// peekedConn is a net.Conn replaying the bytes peeked from it before
+// reading further. It is no longer a *net.TCPConn, costing an extra copy
+// of the data if handed to a WATM.
+type peekedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *peekedConn) Read(b []byte) (int, error) {
+	if c.r.Buffered() > 0 {
+		return c.r.Read(b)
+	}
+	return c.Conn.Read(b)
+}
+
+// helloConn is a net.Conn reading only a TLS record holding a ClientHello
+// and failing to write, for crypto/tls to parse the ClientHello.
+type helloConn struct {
+	net.Conn
+	record []byte
+}
+
+func (c *helloConn) Read(b []byte) (int, error) {
+	if len(c.record) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(b, c.record)
+	c.record = c.record[n:]
+	return n, nil
+}
+
+func (*helloConn) Write([]byte) (int, error) {
+	return 0, io.ErrClosedPipe
+}
+
+func (*helloConn) SetDeadline(time.Time) error      { return nil }
+func (*helloConn) SetReadDeadline(time.Time) error  { return nil }
+func (*helloConn) SetWriteDeadline(time.Time) error { return nil }
+
+func (*helloConn) Close() error { return nil }
+
+// queueListener is a net.Listener handing over the connections routed to
+// a route of a MuxListener, without blocking, to the Listener of the route.
+type queueListener struct {
+	addr   net.Addr
+	mu     sync.Mutex
+	conns  []net.Conn
+	closed bool
+}
+
+// push queues conn for the next call to Accept, or returns false if the
+// queueListener is closed.
+func (l *queueListener) push(conn net.Conn) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return false
+	}
+	l.conns = append(l.conns, conn)
+	return true
+}
+
+// Accept implements net.Listener. It returns errMuxQueueEmpty if no
+// connection is queued.
+func (l *queueListener) Accept() (net.Conn, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return nil, net.ErrClosed
+	}
+	if len(l.conns) == 0 {
+		return nil, errMuxQueueEmpty
+	}
+
+	conn := l.conns[0]
+	l.conns[0] = nil
+	l.conns = l.conns[1:]
+	return conn, nil
+}
+
+// Close implements net.Listener, closing any connection still queued.
+func (l *queueListener) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.closed = true
+	for _, conn := range l.conns {
+		conn.Close()
+	}
+	l.conns = nil
+	return nil
+}
+
+// Addr implements net.Listener.
+func (l *queueListener) Addr() net.Addr {
+	return l.addr
+}
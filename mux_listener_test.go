@@ -0,0 +1,194 @@
+package water_test
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/refraction-networking/water"
+	_ "github.com/refraction-networking/water/transport/v1"
+)
+
+func TestMuxListener(t *testing.T) {
+	tcpLis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, portStr, _ := net.SplitHostPort(tcpLis.Addr().String())
+	port, _ := net.LookupPort("tcp", portStr)
+
+	plainConfig := &water.Config{
+		TransportModuleBin:  wasmPlain,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+	}
+	reverseConfig := &water.Config{
+		TransportModuleBin:  wasmReverse,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+	}
+
+	muxLis, err := water.NewMuxListener(context.Background(), &water.MuxListenerConfig{
+		NetworkListener: tcpLis,
+		Routes: []water.MuxRoute{
+			{Config: reverseConfig, Match: water.MatchLocalPort(uint16(port + 1))}, // never matches
+			{Config: reverseConfig, Match: water.MatchServerName("*.example.com")},
+			{Config: reverseConfig, Match: water.MatchPrefix([]byte("REV"))},
+			{Config: plainConfig, Match: water.MatchLocalPort(uint16(port))},
+		},
+		PeekTimeout: time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer muxLis.Close() // skipcq: GO-S2307
+
+	accept := func(peerMsg []byte) (net.Conn, net.Conn) {
+		t.Helper()
+
+		peerConn, err := net.Dial("tcp", muxLis.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = peerConn.Write(peerMsg); err != nil {
+			t.Fatal(err)
+		}
+
+		conn, err := muxLis.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return peerConn, conn
+	}
+
+	readFull := func(conn net.Conn, n int) []byte {
+		t.Helper()
+
+		if err := conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, n)
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			t.Fatal(err)
+		}
+		return buf
+	}
+
+	t.Run("prefix", func(t *testing.T) {
+		peerConn, conn := accept([]byte("REVhello"))
+		defer peerConn.Close() // skipcq: GO-S2307
+		defer conn.Close()     // skipcq: GO-S2307
+
+		// the peeked bytes must be replayed to the reverse WATM
+		if got := string(readFull(conn, 8)); got != "ollehVER" {
+			t.Fatalf("read %q, want %q", got, "ollehVER")
+		}
+	})
+
+	t.Run("fallback", func(t *testing.T) {
+		peerConn, conn := accept([]byte("hello"))
+		defer peerConn.Close() // skipcq: GO-S2307
+		defer conn.Close()     // skipcq: GO-S2307
+
+		if got := string(readFull(conn, 5)); got != "hello" {
+			t.Fatalf("read %q, want %q", got, "hello")
+		}
+	})
+
+	t.Run("server name", func(t *testing.T) {
+		helloConn, helloPeer := net.Pipe()
+		go tls.Client(helloConn, &tls.Config{ServerName: "bridge.example.com"}).Handshake() // skipcq: GSC-G402
+		clientHello := make([]byte, 4096)
+		n, err := helloPeer.Read(clientHello)
+		if err != nil {
+			t.Fatal(err)
+		}
+		helloConn.Close()
+		clientHello = clientHello[:n]
+
+		peerConn, conn := accept(clientHello)
+		defer peerConn.Close() // skipcq: GO-S2307
+		defer conn.Close()     // skipcq: GO-S2307
+
+		// routed to the reverse WATM
+		got := readFull(conn, len(clientHello))
+		if got[len(got)-1] != clientHello[0] {
+			t.Fatalf("ClientHello must be reversed, got first byte %#x", got[0])
+		}
+	})
+}
+
+func TestMuxListener_IdleClient(t *testing.T) {
+	tcpLis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	muxLis, err := water.NewMuxListener(context.Background(), &water.MuxListenerConfig{
+		NetworkListener: tcpLis,
+		Routes: []water.MuxRoute{
+			{
+				Config: &water.Config{
+					TransportModuleBin:  wasmPlain,
+					ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+				},
+				Match: water.MatchPrefix([]byte("hello")),
+			},
+		},
+		PeekTimeout: 10 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer muxLis.Close() // skipcq: GO-S2307
+
+	// the idle client sends nothing, keeping its connection peeked until
+	// the PeekTimeout expires
+	idleConn, err := net.Dial("tcp", muxLis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idleConn.Close() // skipcq: GO-S2307
+	time.Sleep(100 * time.Millisecond)
+
+	peerConn, err := net.Dial("tcp", muxLis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peerConn.Close() // skipcq: GO-S2307
+	if _, err = peerConn.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	type acceptResult struct {
+		conn net.Conn
+		err  error
+	}
+	accepted := make(chan acceptResult, 1)
+	go func() {
+		conn, err := muxLis.Accept()
+		accepted <- acceptResult{conn, err}
+	}()
+
+	select {
+	case res := <-accepted:
+		if res.err != nil {
+			t.Fatal(res.err)
+		}
+		defer res.conn.Close() // skipcq: GO-S2307
+
+		if err := res.conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, 5)
+		if _, err := io.ReadFull(res.conn, buf); err != nil {
+			t.Fatal(err)
+		}
+		if string(buf) != "hello" {
+			t.Fatalf("read %q, want %q", buf, "hello")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the second client is held back by the idle client")
+	}
+}
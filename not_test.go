@@ -2,12 +2,26 @@ package water_test
 
 import (
 	_ "embed"
+	"testing"
+
+	"github.com/refraction-networking/water/internal/wat"
 )
 
 var (
 	//go:embed transport/v1/testdata/plain.wasm
-	wasmPlain []byte //nolint:unused
+	wasmPlain []byte
 
 	//go:embed transport/v1/testdata/reverse.wasm
 	wasmReverse []byte
 )
+
+// The WATMs in testdata are assembled from their sources in the text
+// format, e.g., testdata/spin.wat into testdata/spin.wasm.
+//
+//go:generate go run ./internal/wat/wat2wasm testdata
+
+func TestTestdata(t *testing.T) {
+	if err := wat.Verify("testdata"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,85 @@
+package water
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// ownedResources is the registry of the files and connections a Core
+// creates on behalf of the WATM, e.g., the duplicated file descriptor of
+// a unix socket or the socket pair wrapping a connection of another type.
+// They are closed when the Core is closed, instead of whenever the garbage
+// collector finds them unreachable.
+type ownedResources struct {
+	mutex     sync.Mutex
+	closed    bool
+	resources []ownedResource
+}
+
+type ownedResource struct {
+	closer io.Closer
+	what   string // describes the resource in leak reports
+}
+
+// own registers r, described by what, to be closed with the Core. If the
+// Core is already closed, r is closed immediately and an error returned.
+func (o *ownedResources) own(r io.Closer, what string) error {
+	o.mutex.Lock()
+	if o.closed {
+		o.mutex.Unlock()
+		r.Close()
+		return fmt.Errorf("water: cannot take the ownership of %s, Core is closed", what)
+	}
+	o.resources = append(o.resources, ownedResource{closer: r, what: what})
+	o.mutex.Unlock()
+	return nil
+}
+
+// describe returns the description of each resource owned.
+func (o *ownedResources) describe() []string {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	whats := make([]string, 0, len(o.resources))
+	for _, r := range o.resources {
+		whats = append(whats, r.what)
+	}
+	return whats
+}
+
+// closeAll closes all the resources owned and any registered later. A
+// resource already closed, e.g., together with the WASM instance it was
+// inserted into, is not reported as an error.
+func (o *ownedResources) closeAll() error {
+	o.mutex.Lock()
+	resources := o.resources
+	o.resources = nil
+	o.closed = true
+	o.mutex.Unlock()
+
+	var errs []error
+	for _, r := range resources {
+		if err := r.closer.Close(); err != nil && !errors.Is(err, os.ErrClosed) && !errors.Is(err, net.ErrClosed) {
+			errs = append(errs, fmt.Errorf("closing %s: %w", r.what, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+var leakedCores atomic.Int64
+
+// LeakedCores returns the number of Cores garbage collected without being
+// closed. Each of them held a WebAssembly instance and the files and
+// connections owned by it until then, which is a bug in the transport
+// driver or the application failing to close a Conn, Dialer or Listener.
+//
+// In debug mode, an error is also logged for each of these Cores, listing
+// what it owned, see SetDebug.
+func LeakedCores() int64 {
+	return leakedCores.Load()
+}
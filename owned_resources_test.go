@@ -0,0 +1,48 @@
+package water
+
+// package water instead of water_test to access unexported struct ownedResources and its unexported methods
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestOwnedResources(t *testing.T) {
+	var owned ownedResources
+
+	c1, p1 := net.Pipe()
+	defer p1.Close() // skipcq: GO-S2307
+	if err := owned.own(c1, "first"); err != nil {
+		t.Fatal(err)
+	}
+	c1.Close() // closed by its user already, which is not an error
+
+	c2, p2 := net.Pipe()
+	defer p2.Close() // skipcq: GO-S2307
+	if err := owned.own(c2, "second"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := owned.describe(); len(got) != 2 || got[0] != "first" || got[1] != "second" {
+		t.Errorf("describe() = %v, want [first second]", got)
+	}
+
+	if err := owned.closeAll(); err != nil {
+		t.Fatalf("closeAll() error = %v", err)
+	}
+	if _, err := c2.Write([]byte("x")); !errors.Is(err, io.ErrClosedPipe) {
+		t.Errorf("Write() on a resource after closeAll error = %v, want %v", err, io.ErrClosedPipe)
+	}
+
+	// a resource owned once closed is closed immediately
+	c3, p3 := net.Pipe()
+	defer p3.Close() // skipcq: GO-S2307
+	if err := owned.own(c3, "third"); err == nil {
+		t.Error("own() after closeAll must fail")
+	}
+	if _, err := c3.Write([]byte("x")); !errors.Is(err, io.ErrClosedPipe) {
+		t.Errorf("Write() on a resource owned after closeAll error = %v, want %v", err, io.ErrClosedPipe)
+	}
+}
@@ -0,0 +1,60 @@
+package water
+
+import (
+	"errors"
+	"net"
+	"time"
+)
+
+// PathInfo describes the quality of the network path of a connection, as
+// hinted to the WebAssembly Transport Module, e.g., for a multipath
+// transport to schedule its data over, or duplicate it across, the paths
+// it dialed. Zero fields are unknown.
+type PathInfo struct {
+	// RTT is the smoothed round-trip time of the path.
+	RTT time.Duration
+
+	// RTTVar is the variation of the round-trip time of the path.
+	RTTVar time.Duration
+
+	// Retransmits is the number of segments retransmitted over the path.
+	Retransmits uint32
+
+	// Lost is the number of segments currently considered lost.
+	Lost uint32
+
+	// CongestionWindow is the congestion window of the path in bytes.
+	CongestionWindow uint32
+
+	// DeliveryRate is the recent delivery rate of the path in bytes per
+	// second.
+	DeliveryRate uint64
+}
+
+// ErrPathInfoUnsupported is returned by NetConnPathInfo for a connection
+// whose path cannot be inspected, e.g., not a TCP connection, or on the
+// platforms with no TCP_INFO.
+var ErrPathInfoUnsupported = errors.New("water: path info is not supported")
+
+// NetConnPathInfo returns the PathInfo of the network connection conn as
+// known by the kernel, e.g., from TCP_INFO on Linux. A connection wrapping
+// another, e.g., a *tls.Conn, is unwrapped with its NetConn method.
+func NetConnPathInfo(conn net.Conn) (PathInfo, error) {
+	for {
+		wrapper, ok := conn.(interface{ NetConn() net.Conn })
+		if !ok || wrapper.NetConn() == nil {
+			break
+		}
+		conn = wrapper.NetConn()
+	}
+
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		return PathInfo{}, ErrPathInfoUnsupported
+	}
+	rawConn, err := tcpConn.SyscallConn()
+	if err != nil {
+		return PathInfo{}, err
+	}
+	return tcpPathInfo(rawConn)
+}
@@ -0,0 +1,56 @@
+//go:build !386
+
+package water
+
+import (
+	"fmt"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// tcpInfo is the struct tcp_info of Linux up to tcpi_delivery_rate, which
+// syscall.TCPInfo lacks.
+type tcpInfo struct {
+	syscall.TCPInfo
+
+	pacingRate    uint64
+	maxPacingRate uint64
+	bytesAcked    uint64
+	bytesReceived uint64
+	segsOut       uint32
+	segsIn        uint32
+	notsentBytes  uint32
+	minRTT        uint32
+	dataSegsIn    uint32
+	dataSegsOut   uint32
+	deliveryRate  uint64 // since Linux 4.9
+}
+
+// tcpPathInfo reads the PathInfo of a TCP socket from TCP_INFO.
+func tcpPathInfo(rawConn syscall.RawConn) (PathInfo, error) {
+	var info tcpInfo
+	size := uint32(unsafe.Sizeof(info))
+	var errno syscall.Errno
+	if err := rawConn.Control(func(fd uintptr) {
+		_, _, errno = syscall.Syscall6(syscall.SYS_GETSOCKOPT, fd, syscall.IPPROTO_TCP, syscall.TCP_INFO,
+			uintptr(unsafe.Pointer(&info)), uintptr(unsafe.Pointer(&size)), 0)
+	}); err != nil {
+		return PathInfo{}, err
+	}
+	if errno != 0 {
+		return PathInfo{}, fmt.Errorf("water: getting TCP_INFO: %w", errno)
+	}
+
+	pathInfo := PathInfo{
+		RTT:              time.Duration(info.Rtt) * time.Microsecond,
+		RTTVar:           time.Duration(info.Rttvar) * time.Microsecond,
+		Retransmits:      info.Total_retrans,
+		Lost:             info.Lost,
+		CongestionWindow: info.Snd_cwnd * info.Snd_mss,
+	}
+	if uintptr(size) >= unsafe.Sizeof(info) {
+		pathInfo.DeliveryRate = info.deliveryRate
+	}
+	return pathInfo, nil
+}
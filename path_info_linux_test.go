@@ -0,0 +1,53 @@
+//go:build !386
+
+package water_test
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/refraction-networking/water"
+)
+
+func TestNetConnPathInfo(t *testing.T) {
+	tcpLis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcpLis.Close() // skipcq: GO-S2307
+
+	conn, err := net.Dial("tcp", tcpLis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close() // skipcq: GO-S2307
+
+	peerConn, err := tcpLis.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peerConn.Close() // skipcq: GO-S2307
+
+	if _, err := conn.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := peerConn.Read(make([]byte, 5)); err != nil {
+		t.Fatal(err)
+	}
+
+	// a connection wrapping the TCP connection is unwrapped
+	info, err := water.NetConnPathInfo(tls.Client(conn, &tls.Config{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.RTT <= 0 || info.CongestionWindow == 0 {
+		t.Errorf("NetConnPathInfo() = %+v, want RTT and CongestionWindow", info)
+	}
+
+	pipeConn, _ := net.Pipe()
+	if _, err := water.NetConnPathInfo(pipeConn); !errors.Is(err, water.ErrPathInfoUnsupported) {
+		t.Errorf("NetConnPathInfo() on a pipe returned %v, want ErrPathInfoUnsupported", err)
+	}
+}
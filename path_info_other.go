@@ -0,0 +1,13 @@
+//go:build !linux || 386
+
+package water
+
+import (
+	"syscall"
+)
+
+// tcpPathInfo fails with ErrPathInfoUnsupported, as there is no TCP_INFO
+// on this platform.
+func tcpPathInfo(syscall.RawConn) (PathInfo, error) {
+	return PathInfo{}, ErrPathInfoUnsupported
+}
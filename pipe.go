@@ -0,0 +1,96 @@
+package water
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync/atomic"
+
+	"github.com/refraction-networking/water/internal/socket"
+)
+
+// Pipe creates two connected Conns, the first dialed by a Dialer and the
+// second accepted by a Listener, both created from the config, over an
+// in-memory network connection instead of a socket bound to a port. What
+// is written to one Conn is read from the other after being transformed
+// by both WATMs, so that a WATM may be tested or fuzzed against itself
+// deterministically.
+//
+// The NetworkDialerFunc, NetworkListener, Resolver, Failover, TCPOptions,
+// DialAllowlist, AcceptRateLimit and AcceptFilter of the config are
+// ignored. WATER still connects each caller to its WATM with a loopback
+// socket pair.
+func Pipe(config *Config) (dialed, accepted Conn, err error) {
+	return PipeContext(context.Background(), config)
+}
+
+// PipeContext is like Pipe, but creates the Dialer and the Listener with
+// ctx, see NewDialerWithContext and NewListenerWithContext.
+func PipeContext(ctx context.Context, config *Config) (Conn, Conn, error) {
+	if config == nil {
+		return nil, nil, errors.New("water: config is nil")
+	}
+
+	dialerConfig, err := config.snapshot()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dialerNetConn, listenerNetConn := net.Pipe()
+
+	var used atomic.Bool
+	dialerConfig.NetworkDialerFunc = func(_, _ string) (net.Conn, error) {
+		if !used.CompareAndSwap(false, true) {
+			return nil, errors.New("water: pipe is already dialed")
+		}
+		return dialerNetConn, nil
+	}
+	dialerConfig.Resolver, dialerConfig.Failover, dialerConfig.TCPOptions, dialerConfig.DialAllowlist = nil, nil, nil, nil
+
+	listenerConfig := config.Clone()
+	listenerConfig.NetworkListener = socket.NewSingleConnListener(listenerNetConn, nil)
+	listenerConfig.AcceptFilter, listenerConfig.AcceptRateLimit, listenerConfig.TCPOptions = nil, nil, nil
+
+	dialer, err := NewDialerWithContext(ctx, dialerConfig)
+	if err != nil {
+		dialerNetConn.Close()
+		listenerNetConn.Close()
+		return nil, nil, fmt.Errorf("water: creating dialer for pipe: %w", err)
+	}
+
+	listener, err := NewListenerWithContext(ctx, listenerConfig)
+	if err != nil {
+		dialerNetConn.Close()
+		listenerNetConn.Close()
+		return nil, nil, fmt.Errorf("water: creating listener for pipe: %w", err)
+	}
+	defer listener.Close() // only closes the SingleConnListener
+
+	// both ends must be set up concurrently, as a WATM may exchange a
+	// handshake with its peer before the Conn is returned
+	acceptResults := make(chan AcceptResult, 1)
+	go func() {
+		conn, err := listener.AcceptWATER()
+		acceptResults <- AcceptResult{Conn: conn, Err: err}
+	}()
+
+	dialerConn, dialErr := dialer.DialContext(ctx, "tcp", listenerNetConn.LocalAddr().String())
+	if dialErr != nil {
+		dialerNetConn.Close() // unblocks the Listener
+	}
+
+	res := <-acceptResults
+	if dialErr != nil || res.Err != nil {
+		if dialerConn != nil {
+			dialerConn.Close()
+		}
+		if res.Conn != nil {
+			res.Conn.Close()
+		}
+		listenerNetConn.Close()
+		return nil, nil, fmt.Errorf("water: creating pipe: %w", errors.Join(dialErr, res.Err))
+	}
+
+	return dialerConn, res.Conn, nil
+}
@@ -0,0 +1,79 @@
+package water_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/refraction-networking/water"
+	_ "github.com/refraction-networking/water/transport/v1"
+)
+
+// ExamplePipe demonstrates how to use water.Pipe to test a WATM against
+// itself without binding any port.
+func ExamplePipe() {
+	config := &water.Config{
+		TransportModuleBin:  wasmReverse,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+	}
+
+	dialed, accepted, err := water.Pipe(config)
+	if err != nil {
+		panic(err)
+	}
+	defer dialed.Close()   // skipcq: GO-S2307
+	defer accepted.Close() // skipcq: GO-S2307
+
+	if _, err = dialed.Write([]byte("hello")); err != nil {
+		panic(err)
+	}
+
+	// reversed by the Dialer, then reversed back by the Listener
+	buf := make([]byte, 5)
+	if _, err = io.ReadFull(accepted, buf); err != nil {
+		panic(err)
+	}
+	fmt.Println(string(buf))
+	// Output: hello
+}
+
+func TestPipe(t *testing.T) {
+	config := &water.Config{
+		TransportModuleBin:  wasmPlain,
+		TransportChain:      []water.ModuleConfig{{TransportModuleBin: wasmReverse}},
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+	}
+
+	dialed, accepted, err := water.Pipe(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialed.Close()   // skipcq: GO-S2307
+	defer accepted.Close() // skipcq: GO-S2307
+
+	for _, tc := range []struct {
+		name     string
+		from, to water.Conn
+	}{
+		{"dialed to accepted", dialed, accepted},
+		{"accepted to dialed", accepted, dialed},
+	} {
+		msg := []byte("hello, " + tc.name)
+		if _, err = tc.from.Write(msg); err != nil {
+			t.Fatalf("%s: Write: %v", tc.name, err)
+		}
+
+		buf := make([]byte, len(msg))
+		if _, err = io.ReadFull(tc.to, buf); err != nil {
+			t.Fatalf("%s: Read: %v", tc.name, err)
+		}
+		if !bytes.Equal(buf, msg) {
+			t.Errorf("%s: read %q, want %q", tc.name, buf, msg)
+		}
+	}
+
+	if _, _, err = water.Pipe(nil); err == nil {
+		t.Error("Pipe(nil) must fail")
+	}
+}
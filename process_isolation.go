@@ -0,0 +1,453 @@
+package water
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/refraction-networking/water/internal/socket"
+)
+
+// ErrProcessIsolationUnsupported is returned for the features which are
+// not available when the ProcessIsolation of the Config is set, or on the
+// platforms where the WATM cannot run in a child process.
+var ErrProcessIsolationUnsupported = errors.New("water: not supported with process isolation")
+
+// isolatedProcessEnv is set in the environment of the child processes
+// started for ProcessIsolation, so that ServeIsolatedProcess tells them
+// apart.
+const isolatedProcessEnv = "WATER_ISOLATED_PROCESS"
+
+// isolatedProcessExitTimeout is how long the child process of a closed
+// Conn is given to exit by itself before being killed.
+const isolatedProcessExitTimeout = 5 * time.Second
+
+// ProcessIsolation makes each WASM instance run in a child process of its
+// own instead of in the process of the caller, trading the latency of
+// starting a process per connection and of an extra copy of the data for
+// a stronger isolation when executing untrusted WATMs: a vulnerability or
+// resource exhaustion in the WebAssembly runtime is confined to the
+// connection of the instance.
+//
+// The child process starts with an empty environment and hardens itself
+// with Harden before loading the WATM, see HardenPolicy, but otherwise
+// runs as the same user as the caller. Harden is only supported on Linux,
+// on amd64 and arm64, so elsewhere, or to confine the child process
+// further, e.g., to another user or to namespaces, use Setup.
+//
+// The caller process still dials and accepts the network connections,
+// applying the options of the Config to them, and passes them along with
+// a unix socket carrying the data of the caller to the child process,
+// which runs the WATM over them as with WrapConn. The child process is
+// given the Config as serialized by MarshalJSON, so fields which cannot be
+// serialized, e.g., the funcs such as OnModuleCrash, are not available in
+// it. Creating a Dialer or a Listener fails with
+// ErrProcessIsolationUnsupported if the Config sets any of those the WATM
+// would otherwise run without, i.e., the EntropySource or the Clock.
+//
+// The executable run as the child process, the one of the caller by
+// default, must call ServeIsolatedProcess first thing in its main.
+//
+// Only Dialers and Listeners support ProcessIsolation, on unix platforms.
+type ProcessIsolation struct {
+	// Path is the path of the executable to run as the child process, the
+	// executable of the current process if empty.
+	Path string
+
+	// Args are the command line arguments passed to the child process,
+	// excluding the name of the executable.
+	Args []string
+
+	// Env is the environment of the child process, empty if nil. The
+	// environment of the current process is not inherited, so that the
+	// secrets it may hold are not exposed to the WATM, unless passed
+	// explicitly, e.g., with os.Environ().
+	Env []string
+
+	// HardenPolicy is the policy the child process restricts itself with
+	// by calling Harden before loading the WATM, with the directories of
+	// the CompilationCache it uses added to the WritePaths. If nil, the
+	// zero HardenPolicy with BestEffort set and the ReadPaths resolving
+	// hostnames, e.g., localhost, require is applied, and the child
+	// process runs unhardened on the platforms where Harden is
+	// unsupported. Otherwise, the child process fails if Harden does.
+	HardenPolicy *HardenPolicy
+
+	// Setup is optionally called with each command before the child
+	// process is started, e.g., to drop privileges or to set the
+	// SysProcAttr for namespaces.
+	Setup func(cmd *exec.Cmd)
+}
+
+// ServeIsolatedProcess runs the WATM of the connection handed over by the
+// caller process and exits once the connection is closed, if the current
+// process is started as a child process for ProcessIsolation. Otherwise,
+// it returns immediately.
+//
+// It must be called first thing in the main of the executable run as the
+// child process, or in TestMain for the tests of a package using
+// ProcessIsolation, before any other work is done or flags are parsed.
+func ServeIsolatedProcess() {
+	if os.Getenv(isolatedProcessEnv) == "" {
+		return
+	}
+
+	if err := serveIsolatedProcess(); err != nil {
+		fmt.Fprintf(os.Stderr, "water: isolated process: %v\n", err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// isolatedProcessRequest is sent by the caller process to the standard
+// input of the child process.
+type isolatedProcessRequest struct {
+	Role               Role          `json:"role"`
+	Config             []byte        `json:"config"`
+	TransportModuleBin []byte        `json:"transport_module_bin"`
+	HardenPolicy       *HardenPolicy `json:"harden_policy,omitempty"`
+}
+
+// isolatedProcessStatus is written by the child process once the WATM is
+// ready, or failed.
+type isolatedProcessStatus struct {
+	Error string `json:"error,omitempty"`
+}
+
+// checkIsolation returns an error if c sets a field which cannot be
+// serialized for the child process and whose absence would leave the WATM
+// running with more access to the host than configured.
+func (c *Config) checkIsolation() error {
+	if c.EntropySource != nil {
+		return fmt.Errorf("%w: EntropySource", ErrProcessIsolationUnsupported)
+	}
+	if c.Clock != nil {
+		return fmt.Errorf("%w: Clock", ErrProcessIsolationUnsupported)
+	}
+	return nil
+}
+
+// childConfig returns the Config serialized for the child process, with
+// the options applied to the network connections by the caller process
+// removed so that they are not applied twice.
+func (c *Config) childConfig() ([]byte, error) {
+	if err := c.checkIsolation(); err != nil {
+		return nil, err
+	}
+
+	config := c.Clone()
+	config.NetworkListener = nil
+	config.Failover = nil
+	config.AcceptRateLimit = nil
+	config.ReadLimiter, config.WriteLimiter = nil, nil
+	config.ConnReadLimit, config.ConnWriteLimit = 0, 0
+	return config.MarshalJSON()
+}
+
+// isolatedConn is the Conn of a WASM instance running in a child process,
+// through a unix socket connected to the child process.
+type isolatedConn struct {
+	net.Conn
+	UnimplementedConn
+
+	localAddr, remoteAddr net.Addr
+
+	// exited is closed once the child process exits.
+	exited <-chan struct{}
+	kill   func() error
+
+	closeOnce sync.Once
+	onClose   func()
+}
+
+// LocalAddr returns the local address of the network connection.
+func (c *isolatedConn) LocalAddr() net.Addr {
+	return c.localAddr
+}
+
+// RemoteAddr returns the remote address of the network connection.
+func (c *isolatedConn) RemoteAddr() net.Addr {
+	return c.remoteAddr
+}
+
+// Close closes the socket connected to the child process, which then
+// closes the network connection and exits, or is killed if it does not
+// in time.
+func (c *isolatedConn) Close() error {
+	err := c.Conn.Close()
+	c.closeOnce.Do(func() {
+		go func() {
+			timer := time.NewTimer(isolatedProcessExitTimeout)
+			defer timer.Stop()
+			select {
+			case <-c.exited:
+			case <-timer.C:
+				_ = c.kill()
+			}
+		}()
+		if c.onClose != nil {
+			c.onClose()
+		}
+	})
+	return err
+}
+
+// SyscallConn implements Conn.SyscallConn().
+func (c *isolatedConn) SyscallConn() (syscall.RawConn, error) {
+	return socket.SyscallConn(c.Conn)
+}
+
+// File implements Conn.File().
+func (c *isolatedConn) File() (*os.File, error) {
+	return socket.File(c.Conn)
+}
+
+// isolatedDialer is the Dialer of a Config with ProcessIsolation set.
+type isolatedDialer struct {
+	UnimplementedDialer
+
+	ctx    context.Context
+	config *Config
+
+	dials atomic.Uint64
+}
+
+func newIsolatedDialer(ctx context.Context, c *Config) *isolatedDialer {
+	return &isolatedDialer{ctx: ctx, config: c.Clone()}
+}
+
+// Dial implements Dialer.Dial().
+func (d *isolatedDialer) Dial(network, address string) (Conn, error) {
+	return d.DialContext(d.ctx, network, address)
+}
+
+// DialContext implements Dialer.DialContext().
+func (d *isolatedDialer) DialContext(ctx context.Context, network, address string) (Conn, error) {
+	if err := d.config.CheckNetwork(network); err != nil {
+		return nil, err
+	}
+
+	netConn, err := d.config.NetworkDialerFuncWithContext(ctx)(network, address)
+	if err != nil {
+		return nil, err
+	}
+	return d.DialWithConn(ctx, netConn)
+}
+
+// DialWithConn implements Dialer.DialWithConn().
+func (d *isolatedDialer) DialWithConn(ctx context.Context, conn net.Conn) (Conn, error) {
+	if conn == nil {
+		return nil, fmt.Errorf("water: dialing with nil connection is not allowed")
+	}
+
+	d.dials.Add(1)
+	isolated, err := startIsolatedProcess(ctx, d.config, conn, RoleDialer)
+	if err != nil {
+		return nil, err
+	}
+	return isolated, nil
+}
+
+// Warm implements Dialer.Warm(). The child processes are not warmed, so
+// it fails with ErrProcessIsolationUnsupported.
+func (*isolatedDialer) Warm(context.Context, int) error {
+	return fmt.Errorf("%w: warming instances", ErrProcessIsolationUnsupported)
+}
+
+// DialStats implements Dialer.DialStats(). Every dial is cold.
+func (d *isolatedDialer) DialStats() DialStats {
+	return DialStats{ColdDials: d.dials.Load()}
+}
+
+// isolatedListener is the Listener of a Config with ProcessIsolation set.
+type isolatedListener struct {
+	UnimplementedListener
+
+	ctx context.Context
+
+	configMutex sync.RWMutex
+	config      *Config
+
+	closed atomic.Bool
+	done   chan struct{}
+
+	connectionsOnce sync.Once
+	connections     <-chan AcceptResult
+	handshakesOnce  sync.Once
+	handshakes      <-chan AcceptResult
+
+	connsMutex sync.Mutex
+	conns      map[*isolatedConn]struct{}
+}
+
+func newIsolatedListener(ctx context.Context, c *Config) *isolatedListener {
+	return &isolatedListener{ctx: ctx, config: c.Clone(), done: make(chan struct{})}
+}
+
+// Accept implements net.Listener.Accept().
+func (l *isolatedListener) Accept() (net.Conn, error) {
+	return l.AcceptWATER()
+}
+
+// Close implements net.Listener.Close().
+func (l *isolatedListener) Close() error {
+	if l.closed.CompareAndSwap(false, true) {
+		close(l.done)
+		return l.loadConfig().NetworkListenerOrPanic().Close()
+	}
+	return nil
+}
+
+// Addr implements net.Listener.Addr().
+func (l *isolatedListener) Addr() net.Addr {
+	return l.loadConfig().NetworkListenerOrPanic().Addr()
+}
+
+// AcceptWATER implements Listener.AcceptWATER().
+func (l *isolatedListener) AcceptWATER() (Conn, error) {
+	res := l.accept()
+	return res.Conn, res.Err
+}
+
+// Connections implements Listener.Connections().
+func (l *isolatedListener) Connections() <-chan AcceptResult {
+	l.connectionsOnce.Do(func() {
+		l.connections = serveAcceptResults(l.accept, l.done)
+	})
+	return l.connections
+}
+
+// accept accepts the next connection authorized by the AuthHandler, if
+// set, with the child process started either by the caller or, if the
+// HandshakeConcurrency is set, by the goroutines of serveHandshakes.
+func (l *isolatedListener) accept() AcceptResult {
+	for {
+		var res AcceptResult
+		if config := l.loadConfig(); config.HandshakeConcurrency > 0 {
+			l.handshakesOnce.Do(func() {
+				l.handshakes = serveHandshakes(config.HandshakeConcurrency, l.acceptNetworkConn, l.handshake, l.done)
+			})
+			var ok bool
+			if res, ok = <-l.handshakes; !ok {
+				res = AcceptResult{Err: net.ErrClosed}
+			}
+		} else {
+			netConn, err := l.acceptNetworkConn()
+			if err != nil {
+				return AcceptResult{Err: err}
+			}
+			res = l.handshake(netConn)
+		}
+		if res.Err != nil {
+			return res
+		}
+
+		if err := l.loadConfig().authorize(res.Conn); err != nil {
+			res.Conn.Close()
+			continue
+		}
+		return res
+	}
+}
+
+func (l *isolatedListener) acceptNetworkConn() (net.Conn, error) {
+	return l.loadConfig().AcceptNetworkConn()
+}
+
+func (l *isolatedListener) handshake(netConn net.Conn) AcceptResult {
+	start := time.Now()
+	res := AcceptResult{RemoteAddr: netConn.RemoteAddr()}
+
+	conn, err := startIsolatedProcess(l.ctx, l.loadConfig(), netConn, RoleListener)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	l.track(conn)
+
+	res.Conn, res.HandshakeDuration = conn, time.Since(start)
+	return res
+}
+
+// UpdateConfig implements Listener.UpdateConfig(). The WATM is not
+// compiled in the caller process to be checked, so a WATM which does not
+// support listening fails each connection accepted instead.
+func (l *isolatedListener) UpdateConfig(c *Config) error {
+	if l.closed.Load() {
+		return fmt.Errorf("water: listener is closed")
+	}
+	if c == nil {
+		return fmt.Errorf("water: updating with nil config is not allowed")
+	}
+	if c.ProcessIsolation == nil {
+		return fmt.Errorf("%w: disabling process isolation of a listener", ErrProcessIsolationUnsupported)
+	}
+
+	config := c.Clone()
+	config.NetworkListener = l.loadConfig().NetworkListener
+
+	l.configMutex.Lock()
+	l.config = config
+	l.configMutex.Unlock()
+	return nil
+}
+
+func (l *isolatedListener) loadConfig() *Config {
+	l.configMutex.RLock()
+	defer l.configMutex.RUnlock()
+	return l.config
+}
+
+// Shutdown implements Listener.Shutdown().
+func (l *isolatedListener) Shutdown(ctx context.Context) error {
+	err := l.Close()
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		l.connsMutex.Lock()
+		active := len(l.conns)
+		l.connsMutex.Unlock()
+		if active == 0 {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			l.connsMutex.Lock()
+			conns := make([]*isolatedConn, 0, len(l.conns))
+			for conn := range l.conns {
+				conns = append(conns, conn)
+			}
+			l.connsMutex.Unlock()
+			for _, conn := range conns {
+				conn.Close()
+			}
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// track records the established connection until it is closed.
+func (l *isolatedListener) track(conn *isolatedConn) {
+	l.connsMutex.Lock()
+	defer l.connsMutex.Unlock()
+
+	if l.conns == nil {
+		l.conns = make(map[*isolatedConn]struct{})
+	}
+	l.conns[conn] = struct{}{}
+	conn.onClose = func() {
+		l.connsMutex.Lock()
+		delete(l.conns, conn)
+		l.connsMutex.Unlock()
+	}
+}
@@ -0,0 +1,22 @@
+//go:build !unix
+
+package water
+
+import (
+	"context"
+	"fmt"
+	"net"
+)
+
+// startIsolatedProcess fails with ErrProcessIsolationUnsupported, since
+// the sockets cannot be passed to a child process on this platform.
+func startIsolatedProcess(_ context.Context, _ *Config, netConn net.Conn, _ Role) (*isolatedConn, error) {
+	netConn.Close()
+	return nil, fmt.Errorf("%w: on this platform", ErrProcessIsolationUnsupported)
+}
+
+// serveIsolatedProcess fails with ErrProcessIsolationUnsupported, since
+// the sockets cannot be passed to a child process on this platform.
+func serveIsolatedProcess() error {
+	return fmt.Errorf("%w: on this platform", ErrProcessIsolationUnsupported)
+}
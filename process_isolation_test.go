@@ -0,0 +1,185 @@
+package water_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/refraction-networking/water"
+	_ "github.com/refraction-networking/water/transport/v1"
+)
+
+func TestMain(m *testing.M) {
+	// the test binary is the child process of the tests using ProcessIsolation
+	water.ServeIsolatedProcess()
+	os.Exit(m.Run())
+}
+
+func TestProcessIsolation(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("process isolation is not supported on Windows")
+	}
+
+	tcpLis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := &water.Config{
+		TransportModuleBin:  wasmReverse,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+		NetworkListener:     tcpLis,
+		ProcessIsolation:    &water.ProcessIsolation{},
+	}
+
+	listener, err := water.NewListenerWithContext(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close() // skipcq: GO-S2307
+
+	type acceptResult struct {
+		conn water.Conn
+		err  error
+	}
+	accepted := make(chan acceptResult, 1)
+	go func() {
+		conn, err := listener.AcceptWATER()
+		accepted <- acceptResult{conn, err}
+	}()
+
+	dialer, err := water.NewDialerWithContext(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dialed, err := dialer.DialContext(context.Background(), "tcp", tcpLis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialed.Close() // skipcq: GO-S2307
+
+	res := <-accepted
+	if res.err != nil {
+		t.Fatal(res.err)
+	}
+	defer res.conn.Close() // skipcq: GO-S2307
+
+	if got := dialed.RemoteAddr().String(); got != tcpLis.Addr().String() {
+		t.Errorf("RemoteAddr() = %s, want %s", got, tcpLis.Addr())
+	}
+
+	for _, pair := range []struct{ from, to water.Conn }{{dialed, res.conn}, {res.conn, dialed}} {
+		msg := []byte("hello from another process")
+		if _, err = pair.from.Write(msg); err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, len(msg))
+		if _, err = io.ReadFull(pair.to, buf); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf, msg) {
+			t.Errorf("read %q, want %q", buf, msg)
+		}
+	}
+
+	// closing one side ends the child processes of both
+	if err := dialed.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := res.conn.Read(make([]byte, 1)); err == nil {
+		t.Error("Read() after the peer closed returned no error")
+	}
+
+	if _, err := water.NewRelayWithContext(context.Background(), config); !errors.Is(err, water.ErrProcessIsolationUnsupported) {
+		t.Errorf("NewRelayWithContext() = %v, want ErrProcessIsolationUnsupported", err)
+	}
+}
+
+func TestProcessIsolation_WATMError(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("process isolation is not supported on Windows")
+	}
+
+	config := &water.Config{
+		TransportModuleBin: []byte("not a WATM"),
+		ProcessIsolation:   &water.ProcessIsolation{},
+	}
+
+	dialer, err := water.NewDialerWithContext(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	existing, peer := net.Pipe()
+	defer peer.Close() // skipcq: GO-S2307
+
+	if _, err := dialer.DialWithConn(context.Background(), existing); err == nil {
+		t.Fatal("DialWithConn() with an invalid WATM returned no error")
+	}
+}
+
+func TestProcessIsolation_Harden(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("process isolation is not supported on Windows")
+	}
+	t.Setenv("WATER_TEST_SECRET", "secret")
+
+	var env []string
+	config := &water.Config{
+		TransportModuleBin:  wasmReverse,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+		ProcessIsolation: &water.ProcessIsolation{
+			// a path which is not a directory fails Harden, as does any
+			// platform where it is unsupported
+			HardenPolicy: &water.HardenPolicy{ReadPaths: []string{"/etc/hosts/not-a-dir"}},
+			Setup:        func(cmd *exec.Cmd) { env = cmd.Env },
+		},
+	}
+
+	dialer, err := water.NewDialerWithContext(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	existing, peer := net.Pipe()
+	defer peer.Close() // skipcq: GO-S2307
+
+	if _, err := dialer.DialWithConn(context.Background(), existing); err == nil || !strings.Contains(err.Error(), "hardening") {
+		t.Errorf("DialWithConn() = %v, want the error of Harden", err)
+	}
+
+	// only the variable telling the child process apart is set
+	if len(env) != 1 || strings.HasPrefix(env[0], "WATER_TEST_SECRET=") {
+		t.Errorf("environment of the child process = %q, want only the one of ProcessIsolation", env)
+	}
+}
+
+func TestProcessIsolation_Unserializable(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("process isolation is not supported on Windows")
+	}
+
+	// the child process would otherwise use the host's random source
+	config := &water.Config{
+		TransportModuleBin: wasmPlain,
+		EntropySource:      bytes.NewReader(make([]byte, 64)),
+		ProcessIsolation:   &water.ProcessIsolation{},
+	}
+
+	if _, err := water.NewDialerWithContext(context.Background(), config); !errors.Is(err, water.ErrProcessIsolationUnsupported) {
+		t.Errorf("NewDialerWithContext() = %v, want ErrProcessIsolationUnsupported", err)
+	}
+
+	config = config.Clone()
+	config.NetworkListener = &net.TCPListener{}
+	if _, err := water.NewListenerWithContext(context.Background(), config); !errors.Is(err, water.ErrProcessIsolationUnsupported) {
+		t.Errorf("NewListenerWithContext() = %v, want ErrProcessIsolationUnsupported", err)
+	}
+}
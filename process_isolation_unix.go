@@ -0,0 +1,295 @@
+//go:build unix
+
+package water
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+
+	"github.com/refraction-networking/water/internal/socket"
+)
+
+// The file descriptors passed to the child process, after the standard
+// input, output and error.
+const (
+	isolatedProcessNetworkFd = 3 + iota
+	isolatedProcessCallerFd
+	isolatedProcessStatusFd
+)
+
+// startIsolatedProcess starts a child process running the WATM of config
+// in role over netConn, which is closed if an error is returned, and
+// returns the Conn to it once the WATM is ready.
+func startIsolatedProcess(ctx context.Context, config *Config, netConn net.Conn, role Role) (conn *isolatedConn, err error) {
+	defer func() {
+		if err != nil {
+			netConn.Close()
+		}
+	}()
+
+	configJSON, err := config.childConfig()
+	if err != nil {
+		return nil, fmt.Errorf("water: serializing config for isolated process: %w", err)
+	}
+	request, err := json.Marshal(&isolatedProcessRequest{
+		Role:               role,
+		Config:             configJSON,
+		TransportModuleBin: config.TransportModuleBin,
+		HardenPolicy:       config.ProcessIsolation.HardenPolicy,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("water: serializing config for isolated process: %w", err)
+	}
+
+	cmd, err := config.ProcessIsolation.command()
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stdin = bytes.NewReader(request)
+
+	netFile, err := networkFile(netConn)
+	if err != nil {
+		return nil, err
+	}
+	defer netFile.Close()
+
+	callerConn, childCallerConn, err := socket.UnixConnPair()
+	if err != nil {
+		return nil, fmt.Errorf("water: socket.UnixConnPair returned error: %w", err)
+	}
+	childCallerFile, err := childCallerConn.File()
+	childCallerConn.Close()
+	if err != nil {
+		callerConn.Close()
+		return nil, fmt.Errorf("water: duplicating caller socket for isolated process: %w", err)
+	}
+	defer childCallerFile.Close()
+
+	statusReader, statusWriter, err := os.Pipe()
+	if err != nil {
+		callerConn.Close()
+		return nil, fmt.Errorf("water: creating status pipe for isolated process: %w", err)
+	}
+	defer statusReader.Close()
+
+	cmd.ExtraFiles = []*os.File{netFile, childCallerFile, statusWriter}
+	err = cmd.Start()
+	statusWriter.Close()
+	if err != nil {
+		callerConn.Close()
+		return nil, fmt.Errorf("water: starting isolated process: %w", err)
+	}
+
+	exited := make(chan struct{})
+	var waitErr error
+	go func() {
+		waitErr = cmd.Wait()
+		close(exited)
+	}()
+
+	statusReady := make(chan error, 1)
+	go func() {
+		var status isolatedProcessStatus
+		if err := json.NewDecoder(statusReader).Decode(&status); err != nil {
+			<-exited
+			statusReady <- fmt.Errorf("water: isolated process exited: %w", errors.Join(waitErr, err))
+			return
+		}
+		if status.Error != "" {
+			statusReady <- fmt.Errorf("water: isolated process: %s", status.Error)
+			return
+		}
+		statusReady <- nil
+	}()
+
+	select {
+	case err = <-statusReady:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if err != nil {
+		callerConn.Close()
+		_ = cmd.Process.Kill()
+		return nil, err
+	}
+
+	return &isolatedConn{
+		Conn:       callerConn,
+		localAddr:  netConn.LocalAddr(),
+		remoteAddr: netConn.RemoteAddr(),
+		exited:     exited,
+		kill:       cmd.Process.Kill,
+	}, nil
+}
+
+// command creates the command to start a child process with.
+func (p *ProcessIsolation) command() (*exec.Cmd, error) {
+	path := p.Path
+	if path == "" {
+		var err error
+		if path, err = os.Executable(); err != nil {
+			return nil, fmt.Errorf("water: locating executable for isolated process: %w", err)
+		}
+	}
+
+	cmd := exec.Command(path, p.Args...)
+	cmd.Env = append(p.Env[:len(p.Env):len(p.Env)], isolatedProcessEnv+"=1")
+	cmd.Stderr = os.Stderr
+	if p.Setup != nil {
+		p.Setup(cmd)
+	}
+	return cmd, nil
+}
+
+// networkFile returns the socket of netConn as a file to be passed to the
+// child process, and closes netConn, which is owned by the child process
+// from then on. A connection with no socket, e.g., a TLS connection, is
+// wrapped in a unix socket instead, which costs an extra copy of data in
+// both directions in the caller process.
+func networkFile(netConn net.Conn) (*os.File, error) {
+	switch netConn := netConn.(type) {
+	case *net.TCPConn, *net.UnixConn:
+		f, err := netConn.(interface{ File() (*os.File, error) }).File()
+		if err != nil {
+			return nil, fmt.Errorf("water: duplicating network connection for isolated process: %w", err)
+		}
+		netConn.Close()
+		return f, nil
+	default:
+		f, _, err := socket.UnixConnFileWrap(netConn)
+		if err != nil {
+			return nil, fmt.Errorf("water: socket.UnixConnFileWrap returned error: %w", err)
+		}
+		return f, nil
+	}
+}
+
+// serveIsolatedProcess runs the WATM over the connections passed by the
+// caller process, until either is closed.
+func serveIsolatedProcess() error {
+	status := os.NewFile(isolatedProcessStatusFd, "status")
+	conn, callerConn, err := acceptIsolatedProcessRequest()
+
+	var statusErr string
+	if err != nil {
+		statusErr = err.Error()
+	}
+	_ = json.NewEncoder(status).Encode(&isolatedProcessStatus{Error: statusErr})
+	status.Close()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()       // skipcq: GO-S2307
+	defer callerConn.Close() // skipcq: GO-S2307
+
+	// the caller process only closes the socket as a whole, so the first
+	// direction to end ends the connection
+	copied := make(chan struct{}, 2)
+	go func() {
+		_, _ = io.Copy(conn, callerConn) // unsafe: error is ignored
+		copied <- struct{}{}
+	}()
+	go func() {
+		_, _ = io.Copy(callerConn, conn) // unsafe: error is ignored
+		copied <- struct{}{}
+	}()
+	<-copied
+	return nil
+}
+
+// acceptIsolatedProcessRequest reads the request of the caller process
+// and runs the WATM over the network connection passed.
+func acceptIsolatedProcessRequest() (conn Conn, callerConn net.Conn, err error) {
+	netConn, err := fileConn(isolatedProcessNetworkFd, "network")
+	if err != nil {
+		return nil, nil, err
+	}
+	caller, err := fileConn(isolatedProcessCallerFd, "caller")
+	if err != nil {
+		netConn.Close()
+		return nil, nil, err
+	}
+	defer func() {
+		if err != nil {
+			caller.Close()
+		}
+	}()
+
+	var request isolatedProcessRequest
+	if err := json.NewDecoder(os.Stdin).Decode(&request); err != nil {
+		netConn.Close()
+		return nil, nil, fmt.Errorf("reading request: %w", err)
+	}
+
+	config := &Config{TransportModuleBin: request.TransportModuleBin}
+	if err := config.UnmarshalJSON(request.Config); err != nil {
+		netConn.Close()
+		return nil, nil, fmt.Errorf("parsing config: %w", err)
+	}
+
+	if err := hardenIsolatedProcess(config, request.HardenPolicy); err != nil {
+		netConn.Close()
+		return nil, nil, err
+	}
+
+	conn, err = WrapConn(context.Background(), config, netConn, request.Role)
+	if err != nil {
+		return nil, nil, err
+	}
+	return conn, caller, nil
+}
+
+// hardenIsolatedProcess hardens the child process with the policy, see
+// ProcessIsolation.HardenPolicy, once the CompilationCache the WATM of
+// config is to be compiled with is created, as no directory can be
+// created afterwards.
+func hardenIsolatedProcess(config *Config, policy *HardenPolicy) error {
+	explicit := policy != nil
+	if !explicit {
+		policy = &HardenPolicy{
+			ReadPaths:  []string{"/etc/hosts", "/etc/resolv.conf", "/etc/nsswitch.conf"},
+			BestEffort: true,
+		}
+	}
+
+	writePaths := policy.WritePaths[:len(policy.WritePaths):len(policy.WritePaths)]
+	if len(config.TransportModuleCompiled) > 0 {
+		if _, err := installCompiledModule(config.TransportModuleCompiled, config.Logger()); err != nil {
+			return err
+		}
+		if dir := precompiledCacheDir(); dir != "" {
+			writePaths = append(writePaths, dir)
+		}
+	}
+	getGlobalCompilationCache()
+	writePaths = append(writePaths, defaultCompilationCacheDir())
+
+	hardened := *policy
+	hardened.WritePaths = writePaths
+	if err := Harden(hardened); err != nil {
+		if explicit || !errors.Is(err, ErrHardenUnsupported) {
+			return fmt.Errorf("hardening: %w", err)
+		}
+	}
+	return nil
+}
+
+// fileConn returns the connection of the socket passed as the file
+// descriptor fd.
+func fileConn(fd uintptr, name string) (net.Conn, error) {
+	f := os.NewFile(fd, name)
+	defer f.Close()
+
+	conn, err := net.FileConn(f)
+	if err != nil {
+		return nil, fmt.Errorf("opening %s connection: %w", name, err)
+	}
+	return conn, nil
+}
@@ -0,0 +1,153 @@
+package water
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// ProxyProtocolVersion selects the version of the HAProxy PROXY protocol
+// header a Relay sends to the upstream before relaying the data of an
+// inbound connection, so that a backend behind the Relay sees the address
+// of the original client instead of the address of the Relay.
+//
+// See https://www.haproxy.org/download/2.9/doc/proxy-protocol.txt for
+// the specification.
+type ProxyProtocolVersion uint8
+
+const (
+	// ProxyProtocolDisabled sends no PROXY protocol header. This is the
+	// default.
+	ProxyProtocolDisabled ProxyProtocolVersion = 0
+
+	// ProxyProtocolV2 sends a PROXY protocol version 2 (binary) header.
+	ProxyProtocolV2 ProxyProtocolVersion = 2
+)
+
+var ErrProxyProtocolUnsupported = errors.New("water: unsupported PROXY protocol version")
+
+// proxyProtocolV2Signature is the fixed 12-byte signature every PROXY
+// protocol version 2 header starts with.
+var proxyProtocolV2Signature = []byte{0x0D, 0x0A, 0x0D, 0x0A, 0x00, 0x0D, 0x0A, 0x51, 0x55, 0x49, 0x54, 0x0A}
+
+const (
+	proxyProtocolV2CmdLocal = 0x20 // version 2, LOCAL command
+	proxyProtocolV2CmdProxy = 0x21 // version 2, PROXY command
+
+	proxyProtocolV2FamUnspec = 0x00
+	proxyProtocolV2FamTCP4   = 0x11
+	proxyProtocolV2FamTCP6   = 0x21
+	proxyProtocolV2FamUnix   = 0x31
+
+	proxyProtocolV2UnixAddrLen = 108
+)
+
+// String implements fmt.Stringer.
+func (v ProxyProtocolVersion) String() string {
+	switch v {
+	case ProxyProtocolDisabled:
+		return "disabled"
+	case ProxyProtocolV2:
+		return "v2"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(v))
+	}
+}
+
+// Header builds the PROXY protocol header describing a connection from
+// source to destination, i.e., the remote and local address of the inbound
+// connection as seen by the Relay.
+//
+// If either address is not a TCP or unix address, or the two are of
+// different families, a header with the LOCAL command is returned, which
+// tells the backend to use the real address of the connection instead.
+// If v is ProxyProtocolDisabled, an empty header is returned.
+func (v ProxyProtocolVersion) Header(source, destination net.Addr) ([]byte, error) {
+	switch v {
+	case ProxyProtocolDisabled:
+		return nil, nil
+	case ProxyProtocolV2:
+		return proxyProtocolV2Header(source, destination), nil
+	default:
+		return nil, ErrProxyProtocolUnsupported
+	}
+}
+
+func proxyProtocolV2Header(source, destination net.Addr) []byte {
+	var fam byte = proxyProtocolV2FamUnspec
+	var addrs []byte
+
+	switch src := source.(type) {
+	case *net.TCPAddr:
+		dst, ok := destination.(*net.TCPAddr)
+		if !ok {
+			break
+		}
+		if src4, dst4 := src.IP.To4(), dst.IP.To4(); src4 != nil && dst4 != nil {
+			fam = proxyProtocolV2FamTCP4
+			addrs = append(append(addrs, src4...), dst4...)
+		} else if src16, dst16 := src.IP.To16(), dst.IP.To16(); src16 != nil && dst16 != nil {
+			// a mix of IPv4 and IPv6 is expressed as IPv4-mapped IPv6
+			fam = proxyProtocolV2FamTCP6
+			addrs = append(append(addrs, src16...), dst16...)
+		} else {
+			break
+		}
+		addrs = binary.BigEndian.AppendUint16(addrs, uint16(src.Port))
+		addrs = binary.BigEndian.AppendUint16(addrs, uint16(dst.Port))
+	case *net.UnixAddr:
+		dst, ok := destination.(*net.UnixAddr)
+		if !ok || len(src.Name) > proxyProtocolV2UnixAddrLen || len(dst.Name) > proxyProtocolV2UnixAddrLen {
+			break
+		}
+		fam = proxyProtocolV2FamUnix
+		addrs = make([]byte, 2*proxyProtocolV2UnixAddrLen)
+		copy(addrs, src.Name)
+		copy(addrs[proxyProtocolV2UnixAddrLen:], dst.Name)
+	}
+
+	cmd := byte(proxyProtocolV2CmdProxy)
+	if fam == proxyProtocolV2FamUnspec {
+		cmd = proxyProtocolV2CmdLocal
+	}
+
+	header := make([]byte, 0, len(proxyProtocolV2Signature)+4+len(addrs))
+	header = append(header, proxyProtocolV2Signature...)
+	header = append(header, cmd, fam)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(addrs)))
+	return append(header, addrs...)
+}
+
+// relayDialerFuncFor returns the func a Relay uses to dial the upstream
+// for the given inbound connection. It is NetworkDialerFuncOrDefault except
+// for the TransportChain, which applies to the inbound only, plus
+// sending the PROXY protocol header describing inbound on every connection
+// dialed if ProxyProtocol is set. If UpstreamPool is set, the connections
+// are taken from it.
+func (c *Config) relayDialerFuncFor(inbound net.Conn) func(network, address string) (net.Conn, error) {
+	dialerFunc := c.UpstreamPool.dialFunc(c.networkDialerFunc(context.Background()))
+	if c.ProxyProtocol == ProxyProtocolDisabled {
+		return dialerFunc
+	}
+
+	version, source, destination := c.ProxyProtocol, inbound.RemoteAddr(), inbound.LocalAddr()
+	return func(network, address string) (net.Conn, error) {
+		header, err := version.Header(source, destination)
+		if err != nil {
+			return nil, err
+		}
+
+		conn, err := dialerFunc(network, address)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := conn.Write(header); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("water: writing PROXY protocol header: %w", err)
+		}
+		return conn, nil
+	}
+}
@@ -0,0 +1,145 @@
+package water_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/refraction-networking/water"
+	"github.com/refraction-networking/water/internal/driver"
+)
+
+func TestProxyProtocolVersion_Header(t *testing.T) {
+	const signature = "0d0a0d0a000d0a515549540a"
+
+	for _, tc := range []struct {
+		name        string
+		source      net.Addr
+		destination net.Addr
+		want        string
+	}{
+		{
+			name:        "tcp4",
+			source:      &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 56324},
+			destination: &net.TCPAddr{IP: net.IPv4(198, 51, 100, 1), Port: 443},
+			want:        signature + "2111000c" + "c0000201" + "c6336401" + "dc04" + "01bb",
+		},
+		{
+			name:        "tcp6",
+			source:      &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 1},
+			destination: &net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 2},
+			want: signature + "21210024" +
+				"20010db8000000000000000000000001" + "20010db8000000000000000000000002" + "0001" + "0002",
+		},
+		{
+			name:        "tcp4 to tcp6",
+			source:      &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 1},
+			destination: &net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 2},
+			want: signature + "21210024" +
+				"00000000000000000000ffffc0000201" + "20010db8000000000000000000000002" + "0001" + "0002",
+		},
+		{
+			name:        "unix",
+			source:      &net.UnixAddr{Name: "a", Net: "unix"},
+			destination: &net.UnixAddr{Name: "b", Net: "unix"},
+			want:        signature + "213100d8" + "61" + zeroHex(107) + "62" + zeroHex(107),
+		},
+		{
+			name:        "mismatched families",
+			source:      &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 1},
+			destination: &net.UnixAddr{Name: "b", Net: "unix"},
+			want:        signature + "20000000",
+		},
+		{
+			name:        "unknown",
+			source:      &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 1},
+			destination: &net.UDPAddr{IP: net.IPv4(192, 0, 2, 2), Port: 2},
+			want:        signature + "20000000",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			header, err := water.ProxyProtocolV2.Header(tc.source, tc.destination)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := hex.EncodeToString(header); got != tc.want {
+				t.Errorf("Header() = %s, want %s", got, tc.want)
+			}
+		})
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		header, err := water.ProxyProtocolDisabled.Header(&net.TCPAddr{}, &net.TCPAddr{})
+		if err != nil || len(header) != 0 {
+			t.Errorf("Header() = %x, %v, want empty header", header, err)
+		}
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		_, err := water.ProxyProtocolVersion(1).Header(&net.TCPAddr{}, &net.TCPAddr{})
+		if !errors.Is(err, water.ErrProxyProtocolUnsupported) {
+			t.Errorf("Header() error = %v, want %v", err, water.ErrProxyProtocolUnsupported)
+		}
+	})
+}
+
+func TestRelayConnsFor_ProxyProtocol(t *testing.T) {
+	upstream, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer upstream.Close() // skipcq: GO-S2307
+
+	inbound := &addrConn{
+		local:  &net.TCPAddr{IP: net.IPv4(198, 51, 100, 1), Port: 443},
+		remote: &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 56324},
+	}
+	want, err := water.ProxyProtocolV2.Header(inbound.remote, inbound.local)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := &water.Config{ProxyProtocol: water.ProxyProtocolV2}
+	conn, err := relayDialerFunc(config, inbound)("tcp", upstream.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close() // skipcq: GO-S2307
+
+	upstreamConn, err := upstream.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer upstreamConn.Close() // skipcq: GO-S2307
+
+	got := make([]byte, len(want))
+	if _, err := io.ReadFull(upstreamConn, got); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("upstream received %x, want %x", got, want)
+	}
+}
+
+// relayDialerFunc returns the func a Relay with config uses to dial the
+// upstream for inbound.
+func relayDialerFunc(config *water.Config, inbound net.Conn) func(network, address string) (net.Conn, error) {
+	_, dialerFunc := driver.RelayConnsFor(config, inbound)
+	return dialerFunc
+}
+
+// addrConn is a net.Conn that only reports its addresses.
+type addrConn struct {
+	net.Conn
+	local, remote net.Addr
+}
+
+func (c *addrConn) LocalAddr() net.Addr  { return c.local }
+func (c *addrConn) RemoteAddr() net.Addr { return c.remote }
+
+func zeroHex(n int) string {
+	return hex.EncodeToString(make([]byte, n))
+}
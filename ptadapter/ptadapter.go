@@ -0,0 +1,214 @@
+// Package ptadapter adapts WATER to the Go APIs of Pluggable Transports, so
+// that applications built around them (e.g., Tor's lyrebird and other PT
+// dispatchers) could run a WATM without new glue code.
+//
+// A [Transport] provides:
+//   - ClientFactory and ServerFactory, in the shape of the transport
+//     interfaces of lyrebird (formerly obfs4proxy), and
+//   - Dial and Listen, in the shape of the Go API of the Pluggable
+//     Transport specification 2.1 and 3.0.
+//
+// To avoid a dependency on goptlib, the per-bridge arguments are of type
+// [Args], to which a pt.Args converts directly as both are a
+// map[string][]string.
+package ptadapter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/refraction-networking/water"
+	"github.com/refraction-networking/water/internal/socket"
+)
+
+// Args are the per-bridge arguments of a transport, such as those of a
+// bridge line or SERVER_TRANSPORT_OPTIONS.
+type Args map[string][]string
+
+// DialFunc dials the underlying connection a ClientFactory runs the WATM
+// over, e.g., through the upstream proxy configured by the PT dispatcher.
+type DialFunc func(network, address string) (net.Conn, error)
+
+var ErrNilConfig = errors.New("ptadapter: nil config")
+
+// Transport is a Pluggable Transport running the WATM of Config.
+type Transport struct {
+	name   string
+	config *water.Config
+}
+
+// NewTransport creates a Transport named name running the WATM of config.
+// The name is the one used in bridge lines and TOR_PT_*_TRANSPORTS.
+func NewTransport(name string, config *water.Config) (*Transport, error) {
+	if config == nil {
+		return nil, ErrNilConfig
+	}
+
+	return &Transport{
+		name:   name,
+		config: config.Clone(),
+	}, nil
+}
+
+// Name returns the name of the transport.
+func (t *Transport) Name() string {
+	return t.name
+}
+
+// ClientFactory returns a ClientFactory for the transport. The stateDir is
+// not used, as a WATM keeps no state on the host.
+func (t *Transport) ClientFactory(_ string) (*ClientFactory, error) {
+	return &ClientFactory{transport: t}, nil
+}
+
+// ServerFactory returns a ServerFactory for the transport, passing args to
+// the WATM as its TransportModuleConfig if not empty. The stateDir is not
+// used, as a WATM keeps no state on the host.
+func (t *Transport) ServerFactory(_ string, args *Args) (*ServerFactory, error) {
+	config, err := t.configWithArgs(args)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ServerFactory{
+		transport: t,
+		config:    config,
+		args:      args,
+	}, nil
+}
+
+// Dial dials address and returns a connection running the WATM over it.
+func (t *Transport) Dial(address string) (net.Conn, error) {
+	return t.DialContext(context.Background(), address)
+}
+
+// DialContext dials address with ctx and returns a connection running the
+// WATM over it. The ctx also bounds the lifetime of the connection, see
+// water.Dialer.
+func (t *Transport) DialContext(ctx context.Context, address string) (net.Conn, error) {
+	dialer, err := water.NewDialerWithContext(ctx, t.config)
+	if err != nil {
+		return nil, err
+	}
+	return dialer.DialContext(ctx, "tcp", address)
+}
+
+// Listen listens on address and returns a listener accepting connections
+// running the WATM.
+func (t *Transport) Listen(address string) (net.Listener, error) {
+	return t.config.ListenContext(context.Background(), "tcp", address)
+}
+
+// configWithArgs returns the Config of the transport with args encoded in
+// JSON as the TransportModuleConfig, or the Config as-is if args is empty.
+func (t *Transport) configWithArgs(args *Args) (*water.Config, error) {
+	if args == nil || len(*args) == 0 {
+		return t.config, nil
+	}
+
+	b, err := json.Marshal(*args)
+	if err != nil {
+		return nil, fmt.Errorf("ptadapter: encoding args: %w", err)
+	}
+
+	config := t.config.Clone()
+	config.TransportModuleConfig = water.TransportModuleConfigFromBytes(b)
+	return config, nil
+}
+
+// ClientFactory creates client connections of a Transport.
+type ClientFactory struct {
+	transport *Transport
+}
+
+// Transport returns the Transport of the ClientFactory.
+func (cf *ClientFactory) Transport() *Transport {
+	return cf.transport
+}
+
+// ParseArgs parses the arguments of a bridge line into the value to be
+// passed to Dial, which is the Config to dial with, carrying args encoded
+// in JSON as the TransportModuleConfig if not empty.
+func (cf *ClientFactory) ParseArgs(args *Args) (any, error) {
+	return cf.transport.configWithArgs(args)
+}
+
+// Dial dials address with dialFn and returns a connection running the WATM
+// over it. The args must be the value returned by ParseArgs, or nil.
+func (cf *ClientFactory) Dial(network, address string, dialFn DialFunc, args any) (net.Conn, error) {
+	config := cf.transport.config
+	if args != nil {
+		var ok bool
+		if config, ok = args.(*water.Config); !ok {
+			return nil, fmt.Errorf("ptadapter: invalid args of type %T", args)
+		}
+	}
+
+	if dialFn == nil {
+		dialFn = config.NetworkDialerFuncOrDefault()
+	}
+
+	conn, err := dialFn(network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer, err := water.NewDialerWithContext(context.Background(), config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	waterConn, err := dialer.DialWithConn(context.Background(), conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return waterConn, nil
+}
+
+// ServerFactory creates server connections of a Transport.
+type ServerFactory struct {
+	transport *Transport
+	config    *water.Config
+	args      *Args
+}
+
+// Transport returns the Transport of the ServerFactory.
+func (sf *ServerFactory) Transport() *Transport {
+	return sf.transport
+}
+
+// Args returns the arguments clients need in their bridge lines, which are
+// the ones the ServerFactory was created with.
+func (sf *ServerFactory) Args() *Args {
+	if sf.args == nil {
+		return &Args{}
+	}
+	return sf.args
+}
+
+// WrapConn runs the WATM over conn accepted by the caller and returns the
+// connection to read the data of the client from. The returned connection
+// takes the ownership of conn.
+func (sf *ServerFactory) WrapConn(conn net.Conn) (net.Conn, error) {
+	config := sf.config.Clone()
+	config.NetworkListener = socket.NewSingleConnListener(conn, nil)
+
+	lis, err := water.NewListenerWithContext(context.Background(), config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	defer lis.Close() // skipcq: GO-S2307
+
+	waterConn, err := lis.AcceptWATER()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return waterConn, nil
+}
@@ -0,0 +1,154 @@
+package ptadapter_test
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/refraction-networking/water"
+	"github.com/refraction-networking/water/ptadapter"
+	_ "github.com/refraction-networking/water/transport/v1"
+)
+
+func newPlainTransport(t *testing.T) *ptadapter.Transport {
+	t.Helper()
+
+	wasm, err := os.ReadFile("../transport/v1/testdata/plain.wasm")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transport, err := ptadapter.NewTransport("plain", &water.Config{
+		TransportModuleBin:  wasm,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return transport
+}
+
+// TestFactories covers a ClientFactory dialing a ServerFactory wrapping
+// the connections accepted by a plain TCP listener.
+func TestFactories(t *testing.T) {
+	transport := newPlainTransport(t)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close() // skipcq: GO-S2307
+
+	args := &ptadapter.Args{"cert": {"AAAA"}}
+	sf, err := transport.ServerFactory("", args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sf.Args() != args {
+		t.Errorf("Args() = %v, want %v", sf.Args(), args)
+	}
+
+	serverConns := make(chan net.Conn, 1)
+	go func() {
+		conn, err := lis.Accept()
+		if err != nil {
+			close(serverConns)
+			return
+		}
+		wrapped, err := sf.WrapConn(conn)
+		if err != nil {
+			close(serverConns)
+			return
+		}
+		serverConns <- wrapped
+	}()
+
+	cf, err := transport.ClientFactory("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsedArgs, err := cf.ParseArgs(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clientConn, err := cf.Dial("tcp", lis.Addr().String(), net.Dial, parsedArgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clientConn.Close() // skipcq: GO-S2307
+
+	serverConn, ok := <-serverConns
+	if !ok {
+		t.Fatal("WrapConn failed")
+	}
+	defer serverConn.Close() // skipcq: GO-S2307
+
+	for _, pair := range [][2]net.Conn{{clientConn, serverConn}, {serverConn, clientConn}} {
+		if err := pair[1].SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+			t.Fatal(err)
+		}
+
+		msg := []byte("hello")
+		if _, err := pair[0].Write(msg); err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, len(msg))
+		if _, err := io.ReadFull(pair[1], buf); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf, msg) {
+			t.Errorf("read %q, want %q", buf, msg)
+		}
+	}
+}
+
+// TestTransport_DialListen covers the Dial and Listen of a Transport.
+func TestTransport_DialListen(t *testing.T) {
+	transport := newPlainTransport(t)
+
+	lis, err := transport.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close() // skipcq: GO-S2307
+
+	serverConns := make(chan net.Conn, 1)
+	go func() {
+		conn, err := lis.Accept()
+		if err != nil {
+			close(serverConns)
+			return
+		}
+		serverConns <- conn
+	}()
+
+	clientConn, err := transport.Dial(lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clientConn.Close() // skipcq: GO-S2307
+
+	serverConn, ok := <-serverConns
+	if !ok {
+		t.Fatal("Accept failed")
+	}
+	defer serverConn.Close() // skipcq: GO-S2307
+
+	if err := serverConn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := clientConn.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(serverConn, buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "hello" {
+		t.Errorf("read %q, want %q", buf, "hello")
+	}
+}
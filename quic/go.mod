@@ -0,0 +1,30 @@
+module github.com/refraction-networking/water/quic
+
+go 1.22
+
+replace (
+	github.com/refraction-networking/water => ../
+	github.com/tetratelabs/wazero => github.com/refraction-networking/wazero v1.7.3-w
+)
+
+require (
+	github.com/quic-go/quic-go v0.48.2
+	github.com/refraction-networking/water v0.0.0-00010101000000-000000000000
+)
+
+require (
+	github.com/blang/vfs v1.0.0 // indirect
+	github.com/gaukas/wazerofs v0.1.0 // indirect
+	github.com/go-task/slim-sprig v0.0.0-20230315185526-52ccab3ef572 // indirect
+	github.com/google/pprof v0.0.0-20210407192527-94a9f03dee38 // indirect
+	github.com/onsi/ginkgo/v2 v2.9.5 // indirect
+	github.com/tetratelabs/wazero v1.7.3 // indirect
+	go.uber.org/mock v0.4.0 // indirect
+	golang.org/x/crypto v0.26.0 // indirect
+	golang.org/x/exp v0.0.0-20240506185415-9bf2ced13842 // indirect
+	golang.org/x/mod v0.17.0 // indirect
+	golang.org/x/net v0.28.0 // indirect
+	golang.org/x/sys v0.23.0 // indirect
+	golang.org/x/tools v0.21.1-0.20240508182429-e35e4ccd0d2d // indirect
+	google.golang.org/protobuf v1.33.0 // indirect
+)
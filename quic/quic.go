@@ -0,0 +1,253 @@
+// Package quic implements the "quic" UnderlyingProtocol of WATER, carrying
+// the traffic of each WebAssembly Transport Module instance over a QUIC
+// stream instead of a TCP connection. It is selected with:
+//
+//	import _ "github.com/refraction-networking/water/quic"
+//
+//	config := &water.Config{
+//		// ...
+//		UnderlyingProtocol: "quic",
+//		UnderlyingTLS:      tlsConfig,
+//	}
+//
+// QUIC is always secured with TLS 1.3, so Config.UnderlyingTLS must be
+// set, with the certificates of the server for a Listener or a Relay. It
+// is used by QUIC itself instead of being layered over the stream.
+//
+// Each QUIC connection carries exactly one stream, i.e., one WATM
+// connection, so a Dialer dials a new QUIC connection for each Conn. It
+// is a separate module, so that the dependency on quic-go is only pulled
+// in by applications using it.
+package quic
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/refraction-networking/water"
+	"github.com/refraction-networking/water/internal/driver"
+)
+
+// ALPN is the application protocol negotiated by default, when
+// Config.UnderlyingTLS sets no NextProtos.
+const ALPN = "water"
+
+const (
+	// streamTimeout bounds how long a Listener waits for the first stream
+	// of a QUIC connection it accepted.
+	streamTimeout = 10 * time.Second
+
+	// closeLinger bounds how long closing a Conn waits for the peer to
+	// close its side of the stream, before closing the QUIC connection,
+	// which discards the data not yet delivered.
+	closeLinger = 5 * time.Second
+)
+
+// streamOpened is written by the dialing side as the first byte of the
+// stream, since a QUIC stream is only announced to the peer by sending
+// data over it.
+const streamOpened byte = 0x00
+
+func init() {
+	err := driver.RegisterUnderlyingProtocol("quic", water.UnderlyingProtocol{
+		Dial:   dial,
+		Listen: listen,
+		TLS:    true,
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// tlsConfig returns a copy of the Config.UnderlyingTLS, completed with the
+// defaults for QUIC.
+func tlsConfig(c *water.Config) (*tls.Config, error) {
+	if c.UnderlyingTLS == nil {
+		return nil, errors.New("water/quic: Config.UnderlyingTLS must be set to use QUIC")
+	}
+
+	config := c.UnderlyingTLS.Clone()
+	if len(config.NextProtos) == 0 {
+		config.NextProtos = []string{ALPN}
+	}
+	return config, nil
+}
+
+func dial(ctx context.Context, c *water.Config, _, address string) (net.Conn, error) {
+	config, err := tlsConfig(c)
+	if err != nil {
+		return nil, err
+	}
+	if config.ServerName == "" {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			host = address
+		}
+		config.ServerName = host
+	}
+
+	conn, err := quic.DialAddr(ctx, address, config, nil)
+	if err != nil {
+		return nil, fmt.Errorf("water/quic: dialing %s: %w", address, err)
+	}
+
+	stream, err := conn.OpenStreamSync(ctx)
+	if err != nil {
+		conn.CloseWithError(0, "")
+		return nil, fmt.Errorf("water/quic: opening stream to %s: %w", address, err)
+	}
+
+	if _, err := stream.Write([]byte{streamOpened}); err != nil {
+		conn.CloseWithError(0, "")
+		return nil, fmt.Errorf("water/quic: opening stream to %s: %w", address, err)
+	}
+
+	return &streamConn{Stream: stream, conn: conn}, nil
+}
+
+// streamConn is a net.Conn over the only stream of a QUIC connection.
+type streamConn struct {
+	quic.Stream
+
+	conn      quic.Connection
+	closeOnce sync.Once
+}
+
+// LocalAddr implements net.Conn.
+func (c *streamConn) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+// RemoteAddr implements net.Conn.
+func (c *streamConn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// CloseWrite shuts down the writing side of the stream, letting the peer
+// read io.EOF once all the data written is delivered.
+func (c *streamConn) CloseWrite() error {
+	return c.Stream.Close()
+}
+
+// Close implements net.Conn. It closes the writing side of the stream and
+// returns immediately, while the QUIC connection is closed in the
+// background once the peer closes its side too, or after a while, so that
+// the data written is still delivered.
+func (c *streamConn) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		err = c.Stream.Close()
+		go func() {
+			c.Stream.SetReadDeadline(time.Now().Add(closeLinger))
+			io.Copy(io.Discard, c.Stream) // skipcq: GSC-G104
+			c.conn.CloseWithError(0, "")
+		}()
+	})
+	return err
+}
+
+func listen(_ context.Context, c *water.Config, _, address string) (net.Listener, error) {
+	config, err := tlsConfig(c)
+	if err != nil {
+		return nil, err
+	}
+
+	ln, err := quic.ListenAddr(address, config, nil)
+	if err != nil {
+		return nil, fmt.Errorf("water/quic: listening on %s: %w", address, err)
+	}
+
+	l := &listener{
+		ln:     ln,
+		conns:  make(chan net.Conn),
+		closed: make(chan struct{}),
+	}
+	go l.run()
+	return l, nil
+}
+
+// listener is a net.Listener accepting the first stream of each QUIC
+// connection as a net.Conn.
+type listener struct {
+	ln *quic.Listener
+
+	conns chan net.Conn
+
+	closed    chan struct{}
+	closeOnce sync.Once
+	err       error // set before closed is closed
+}
+
+func (l *listener) run() {
+	for {
+		conn, err := l.ln.Accept(context.Background())
+		if err != nil {
+			l.closeOnce.Do(func() {
+				l.err = err
+				close(l.closed)
+			})
+			return
+		}
+		go l.acceptStream(conn)
+	}
+}
+
+// acceptStream accepts the stream opened by the dialing side and hands it
+// over to Accept.
+func (l *listener) acceptStream(conn quic.Connection) {
+	ctx, cancel := context.WithTimeout(context.Background(), streamTimeout)
+	defer cancel()
+
+	stream, err := conn.AcceptStream(ctx)
+	if err != nil {
+		conn.CloseWithError(0, "")
+		return
+	}
+
+	stream.SetReadDeadline(time.Now().Add(streamTimeout))
+	var opened [1]byte
+	if _, err := io.ReadFull(stream, opened[:]); err != nil || opened[0] != streamOpened {
+		conn.CloseWithError(0, "")
+		return
+	}
+	stream.SetReadDeadline(time.Time{})
+
+	sc := &streamConn{Stream: stream, conn: conn}
+	select {
+	case l.conns <- sc:
+	case <-l.closed:
+		conn.CloseWithError(0, "")
+	}
+}
+
+// Accept implements net.Listener.
+func (l *listener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closed:
+		return nil, l.err
+	}
+}
+
+// Close implements net.Listener. Since the connections accepted share its
+// UDP socket, they are closed too.
+func (l *listener) Close() error {
+	l.closeOnce.Do(func() {
+		l.err = net.ErrClosed
+		close(l.closed)
+	})
+	return l.ln.Close()
+}
+
+// Addr implements net.Listener.
+func (l *listener) Addr() net.Addr {
+	return l.ln.Addr()
+}
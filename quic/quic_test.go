@@ -0,0 +1,138 @@
+package quic_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/refraction-networking/water"
+	_ "github.com/refraction-networking/water/quic"
+	_ "github.com/refraction-networking/water/transport/v1"
+)
+
+// testTLSConfigs returns the configs of a TLS server presenting a
+// self-signed certificate valid for 127.0.0.1, and of a client trusting it.
+func testTLSConfigs(t *testing.T) (server, client *tls.Config) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "water test"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}, MinVersion: tls.VersionTLS13},
+		&tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS13}
+}
+
+func TestUnderlyingProtocol(t *testing.T) {
+	wasmPlain, err := os.ReadFile("../transport/v1/testdata/plain.wasm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverTLS, clientTLS := testTLSConfigs(t)
+
+	lis, err := (&water.Config{
+		TransportModuleBin:  wasmPlain,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+		UnderlyingProtocol:  "quic",
+		UnderlyingTLS:       serverTLS,
+	}).ListenContext(context.Background(), "tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close() // skipcq: GO-S2307
+
+	if _, ok := lis.Addr().(*net.UDPAddr); !ok {
+		t.Fatalf("Listener.Addr() = %T, want *net.UDPAddr", lis.Addr())
+	}
+
+	dialer, err := water.NewDialerWithContext(context.Background(), &water.Config{
+		TransportModuleBin:  wasmPlain,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+		UnderlyingProtocol:  "quic",
+		UnderlyingTLS:       clientTLS, // ServerName defaults to 127.0.0.1
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := lis.Accept()
+		if err != nil {
+			t.Error(err)
+		}
+		accepted <- conn
+	}()
+
+	conn, err := dialer.DialContext(context.Background(), "tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close() // skipcq: GO-S2307
+
+	peer := <-accepted
+	if peer == nil {
+		t.FailNow()
+	}
+	defer peer.Close() // skipcq: GO-S2307
+
+	for _, rw := range []struct {
+		name string
+		w    io.Writer
+		r    io.Reader
+	}{
+		{"dialer to listener", conn, peer},
+		{"listener to dialer", peer, conn},
+	} {
+		msg := []byte("hello over water over QUIC, " + rw.name)
+		if _, err = rw.w.Write(msg); err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, len(msg))
+		if _, err = io.ReadFull(rw.r, buf); err != nil {
+			t.Fatal(err)
+		}
+		if string(buf) != string(msg) {
+			t.Errorf("%s: read %q, want %q", rw.name, buf, msg)
+		}
+	}
+}
+
+func TestUnderlyingProtocol_NoTLS(t *testing.T) {
+	_, err := (&water.Config{
+		TransportModuleBin:  []byte{0x00, 0x61, 0x73, 0x6d},
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+		UnderlyingProtocol:  "quic",
+	}).ListenNetwork(context.Background(), "tcp", "127.0.0.1:0")
+	if err == nil {
+		t.Fatal("listening with QUIC without Config.UnderlyingTLS must fail")
+	}
+}
@@ -0,0 +1,402 @@
+package water
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/experimental"
+	"github.com/tetratelabs/wazero/sys"
+)
+
+// ErrReplayDiverged is wrapped by the error of Replay once the WATM does
+// not behave as recorded, e.g., calls another host function, or returns
+// other results.
+var ErrReplayDiverged = errors.New("water: replay diverged from the recording")
+
+// errRecordingEnded is raised from a host function replayed once the
+// recording ends, e.g., as the recorded instance was still running.
+var errRecordingEnded = errors.New("water: recording ended")
+
+// RecordToDir returns a Recorder for the Config writing the recording of
+// each WASM instance into a new file in dir, named after the time it is
+// created, e.g., "watm-record-20240102T150405.000000000Z-123456.jsonl".
+func RecordToDir(dir string) func() (io.WriteCloser, error) {
+	return func() (io.WriteCloser, error) {
+		f, err := os.CreateTemp(dir, "watm-record-"+time.Now().UTC().Format("20060102T150405.000000000Z")+"-*.jsonl")
+		if err != nil {
+			return nil, fmt.Errorf("water: creating recording file: %w", err)
+		}
+		return f, nil
+	}
+}
+
+// recordEntry is a line of a recording, in JSON.
+type recordEntry struct {
+	// Kind is one of:
+	//  - "instantiate": the host instantiates the WATM, running its start
+	//    function if any.
+	//  - "call": the host calls Func exported by the WATM with Params.
+	//  - "host": the WATM calls Func imported from Module with Params, and
+	//    the host function returns Results after applying Writes to the
+	//    memory, or fails with Err.
+	//  - "return": the last "instantiate" or "call" returns Results or
+	//    fails with Err.
+	Kind     string        `json:"kind"`
+	Module   string        `json:"module,omitempty"`
+	Func     string        `json:"func,omitempty"`
+	Params   []uint64      `json:"params,omitempty"`
+	Results  []uint64      `json:"results,omitempty"`
+	Writes   []memoryWrite `json:"writes,omitempty"`
+	Err      string        `json:"err,omitempty"`
+	ExitCode *uint32       `json:"exit_code,omitempty"` // set if Err is an exit of the WATM
+}
+
+// memoryWrite is a range of the memory written by a host function.
+type memoryWrite struct {
+	Offset uint32 `json:"offset"`
+	Data   []byte `json:"data"`
+}
+
+func (e *recordEntry) setErr(err error) {
+	e.Err = err.Error()
+	var exitErr *sys.ExitError
+	if errors.As(err, &exitErr) {
+		exitCode := exitErr.ExitCode()
+		e.ExitCode = &exitCode
+	}
+}
+
+// recorder records the interactions between the host and a WASM instance.
+// It is a FunctionListenerFactory listening to the host functions, which
+// is passed to wazero with the context the host modules are compiled in.
+type recorder struct {
+	mutex   sync.Mutex
+	enc     *json.Encoder
+	err     error          // the first error writing, which stops recording
+	pending []*recordEntry // the host functions in progress
+	before  [][]byte       // the memory before each host function in progress
+}
+
+func newRecorder(w io.Writer) *recorder {
+	return &recorder{enc: json.NewEncoder(w)}
+}
+
+// write writes the entry, with the mutex held.
+func (r *recorder) write(entry *recordEntry) {
+	if r.err == nil {
+		r.err = r.enc.Encode(entry)
+	}
+}
+
+// call records a call or an instantiation by the host. A nil *recorder
+// records nothing.
+func (r *recorder) call(kind, funcName string, params []uint64) {
+	if r == nil {
+		return
+	}
+	r.mutex.Lock()
+	r.write(&recordEntry{Kind: kind, Func: funcName, Params: params})
+	r.mutex.Unlock()
+}
+
+// returned records the return of the last call or instantiation by the
+// host. The host functions in progress are recorded as failed with err.
+func (r *recorder) returned(funcName string, results []uint64, err error) {
+	if r == nil {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for len(r.pending) > 0 {
+		r.abort(err)
+	}
+
+	entry := &recordEntry{Kind: "return", Func: funcName, Results: results}
+	if err != nil {
+		entry.setErr(err)
+	}
+	r.write(entry)
+}
+
+// abort records the innermost host function in progress as failed with
+// err, with the mutex held.
+func (r *recorder) abort(err error) {
+	entry := r.pending[len(r.pending)-1]
+	r.pending, r.before = r.pending[:len(r.pending)-1], r.before[:len(r.before)-1]
+	if err == nil {
+		err = errors.New("aborted")
+	}
+	entry.setErr(err)
+	r.write(entry)
+}
+
+// NewFunctionListener implements experimental.FunctionListenerFactory.
+func (r *recorder) NewFunctionListener(def api.FunctionDefinition) experimental.FunctionListener {
+	if def.GoFunction() == nil {
+		return nil
+	}
+	return r
+}
+
+// Before implements experimental.FunctionListener.
+func (r *recorder) Before(_ context.Context, mod api.Module, def api.FunctionDefinition, params []uint64, _ experimental.StackIterator) {
+	entry := &recordEntry{
+		Kind:   "host",
+		Module: def.ModuleName(),
+		Func:   exportName(def),
+		Params: normalizeValues(def.ParamTypes(), params),
+	}
+
+	var before []byte
+	if mem := mod.Memory(); mem != nil {
+		if b, ok := mem.Read(0, mem.Size()); ok {
+			before = slices.Clone(b)
+		}
+	}
+
+	r.mutex.Lock()
+	r.pending = append(r.pending, entry)
+	r.before = append(r.before, before)
+	r.mutex.Unlock()
+}
+
+// After implements experimental.FunctionListener.
+func (r *recorder) After(_ context.Context, mod api.Module, def api.FunctionDefinition, results []uint64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if len(r.pending) == 0 {
+		return
+	}
+	entry, before := r.pending[len(r.pending)-1], r.before[len(r.before)-1]
+	r.pending, r.before = r.pending[:len(r.pending)-1], r.before[:len(r.before)-1]
+
+	entry.Results = normalizeValues(def.ResultTypes(), results)
+	if mem := mod.Memory(); mem != nil {
+		if after, ok := mem.Read(0, mem.Size()); ok {
+			entry.Writes = memoryWrites(before, after)
+		}
+	}
+	r.write(entry)
+}
+
+// Abort implements experimental.FunctionListener.
+func (r *recorder) Abort(_ context.Context, _ api.Module, _ api.FunctionDefinition, err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if len(r.pending) > 0 {
+		r.abort(err)
+	}
+}
+
+// normalizeValues returns a copy of the values of the types, with the
+// upper bits of the 32-bit ones, undefined on the stack of wazero, unset.
+func normalizeValues(types []api.ValueType, values []uint64) []uint64 {
+	normalized := make([]uint64, len(types))
+	for i, typ := range types {
+		normalized[i] = values[i]
+		if typ == api.ValueTypeI32 || typ == api.ValueTypeF32 {
+			normalized[i] = uint64(uint32(values[i]))
+		}
+	}
+	return normalized
+}
+
+// memoryWrites returns the ranges of after differing from before.
+func memoryWrites(before, after []byte) []memoryWrite {
+	var writes []memoryWrite
+	for i := 0; i < len(after); {
+		if i < len(before) && before[i] == after[i] {
+			i++
+			continue
+		}
+
+		start := i
+		for i < len(after) && (i >= len(before) || before[i] != after[i]) {
+			i++
+		}
+		writes = append(writes, memoryWrite{Offset: uint32(start), Data: slices.Clone(after[start:i])})
+	}
+	return writes
+}
+
+// Replay replays the recording of a WASM instance made with the Recorder
+// of a Config, offline: the WATM of config is instantiated and called as
+// recorded, while each host function it imports returns as recorded,
+// writing the same data into the memory, instead of being called.
+//
+// Replay returns once the recording ends, or with an error wrapping
+// ErrReplayDiverged once the WATM does not behave as recorded, or with
+// the error of the WATM if it crashes, e.g., to reproduce a protocol bug
+// reported from the field deterministically. An exit of the WATM as
+// recorded, e.g., as the context of the recorded instance is canceled,
+// is not an error.
+//
+// The RuntimeConfig of config is used, so that e.g., the interpreter
+// can be forced, while the other fields of config are ignored.
+func Replay(ctx context.Context, config *Config, recording io.Reader) error {
+	runtime := wazero.NewRuntimeWithConfig(ctx, config.RuntimeConfig().GetConfig())
+	defer runtime.Close(ctx) // skipcq: GO-S2307
+
+	compiled, err := runtime.CompileModule(ctx, config.WATMBinOrPanic())
+	if err != nil {
+		return fmt.Errorf("water: (*Runtime).CompileModule returned error: %w", err)
+	}
+
+	rp := &replayer{dec: json.NewDecoder(recording)}
+
+	// replace every function imported by the WATM
+	builders := make(map[string]wazero.HostModuleBuilder)
+	for _, def := range compiled.ImportedFunctions() {
+		moduleName, name, _ := def.Import()
+		if _, ok := builders[moduleName]; !ok {
+			builders[moduleName] = runtime.NewHostModuleBuilder(moduleName)
+		}
+		builders[moduleName].NewFunctionBuilder().
+			WithGoModuleFunction(rp.hostFunction(moduleName, name, def.ParamTypes()), def.ParamTypes(), def.ResultTypes()).
+			Export(name)
+	}
+	for _, builder := range builders {
+		if _, err := builder.Instantiate(ctx); err != nil {
+			return fmt.Errorf("water: (*wazero.HostModuleBuilder).Instantiate returned error: %w", err)
+		}
+	}
+
+	var mod api.Module
+	for {
+		entry, err := rp.next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		var results []uint64
+		switch entry.Kind {
+		case "instantiate":
+			if mod != nil {
+				return rp.diverged("instantiating twice")
+			}
+			mod, err = runtime.InstantiateModule(ctx, compiled, wazero.NewModuleConfig().WithStartFunctions("_start", "_initialize"))
+		case "call":
+			if mod == nil {
+				return rp.diverged("calling %s before instantiating", entry.Func)
+			}
+			f := mod.ExportedFunction(entry.Func)
+			if f == nil {
+				return rp.diverged("function %s is not exported", entry.Func)
+			}
+			if results, err = f.Call(ctx, entry.Params...); err == nil {
+				results = normalizeValues(f.Definition().ResultTypes(), results)
+			}
+		default:
+			return rp.diverged("unexpected %s of %s", entry.Kind, entry.Func)
+		}
+
+		if done, err := rp.returned(entry, results, err); done || err != nil {
+			return err
+		}
+	}
+}
+
+// replayer feeds a recording to a WATM.
+type replayer struct {
+	mutex sync.Mutex
+	dec   *json.Decoder
+	line  int // the line of the recording last read
+}
+
+// next reads the next entry of the recording, or returns io.EOF.
+func (rp *replayer) next() (*recordEntry, error) {
+	rp.mutex.Lock()
+	defer rp.mutex.Unlock()
+
+	var entry recordEntry
+	if err := rp.dec.Decode(&entry); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("water: reading recording after line %d: %w", rp.line, err)
+	}
+	rp.line++
+	return &entry, nil
+}
+
+func (rp *replayer) diverged(format string, args ...any) error {
+	rp.mutex.Lock()
+	defer rp.mutex.Unlock()
+	return fmt.Errorf("%w: line %d: %s", ErrReplayDiverged, rp.line, fmt.Sprintf(format, args...))
+}
+
+// returned checks the return of the instantiation or call entry against
+// the recording, reporting whether the replay is done.
+func (rp *replayer) returned(entry *recordEntry, results []uint64, err error) (done bool, _ error) {
+	if errors.Is(err, errRecordingEnded) {
+		return true, nil
+	} else if errors.Is(err, ErrReplayDiverged) {
+		return true, err
+	}
+
+	ret, nextErr := rp.next()
+	if errors.Is(nextErr, io.EOF) {
+		return true, nil
+	} else if nextErr != nil {
+		return true, nextErr
+	}
+	if ret.Kind != "return" || ret.Func != entry.Func {
+		return true, rp.diverged("%s returned, want %s of %s", entry.Func, ret.Kind, ret.Func)
+	}
+
+	var exitErr *sys.ExitError
+	switch {
+	case err != nil && !errors.As(err, &exitErr):
+		return true, fmt.Errorf("water: replaying %s %s: %w", entry.Kind, entry.Func, err)
+	case (err != nil) != (ret.Err != ""):
+		return true, rp.diverged("%s returned error %v, want %q", entry.Func, err, ret.Err)
+	case !slices.Equal(results, ret.Results):
+		return true, rp.diverged("%s returned %v, want %v", entry.Func, results, ret.Results)
+	}
+	return false, nil
+}
+
+// hostFunction returns the function replacing moduleName.name imported by
+// the WATM, which returns as recorded.
+func (rp *replayer) hostFunction(moduleName, name string, paramTypes []api.ValueType) api.GoModuleFunc {
+	return func(_ context.Context, mod api.Module, stack []uint64) {
+		entry, err := rp.next()
+		if errors.Is(err, io.EOF) {
+			panic(errRecordingEnded)
+		} else if err != nil {
+			panic(err)
+		}
+
+		params := normalizeValues(paramTypes, stack)
+		if entry.Kind != "host" || entry.Module != moduleName || entry.Func != name || !slices.Equal(params, entry.Params) {
+			panic(rp.diverged("called %s.%s%v, want %s of %s.%s%v", moduleName, name, params, entry.Kind, entry.Module, entry.Func, entry.Params))
+		}
+
+		for _, w := range entry.Writes {
+			if mem := mod.Memory(); mem == nil || !mem.Write(w.Offset, w.Data) {
+				panic(rp.diverged("%s.%s writing %d bytes at %d out of the memory", moduleName, name, len(w.Data), w.Offset))
+			}
+		}
+
+		if entry.ExitCode != nil {
+			panic(sys.NewExitError(*entry.ExitCode))
+		} else if entry.Err != "" {
+			panic(errors.New(entry.Err))
+		}
+		copy(stack, entry.Results)
+	}
+}
@@ -0,0 +1,105 @@
+package water_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/refraction-networking/water"
+	_ "github.com/refraction-networking/water/transport/v1"
+)
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+func TestReplay(t *testing.T) {
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close() // skipcq: GO-S2307
+
+	var recording bytes.Buffer
+	dialer, err := water.NewDialerWithContext(context.Background(), &water.Config{
+		TransportModuleBin: wasmReverse,
+		Recorder: func() (io.WriteCloser, error) {
+			return nopWriteCloser{&recording}, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := dialer.DialContext(context.Background(), "tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	peerConn, err := lis.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peerConn.Close() // skipcq: GO-S2307
+
+	if _, err = conn.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 16)
+	n, err := peerConn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf[:n]) != "olleh" {
+		t.Fatalf("read %q, want %q", buf[:n], "olleh")
+	}
+	if err = conn.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Contains(recording.Bytes(), []byte(`"func":"watm_start_v1"`)) {
+		t.Fatalf("recording does not cover watm_start_v1:\n%s", recording.Bytes())
+	}
+
+	t.Run("replay", func(t *testing.T) {
+		err := water.Replay(context.Background(), &water.Config{TransportModuleBin: wasmReverse}, bytes.NewReader(recording.Bytes()))
+		if err != nil {
+			t.Errorf("Replay() error = %v", err)
+		}
+	})
+
+	t.Run("diverged", func(t *testing.T) {
+		tampered := bytes.Replace(recording.Bytes(), []byte(`"func":"fd_write"`), []byte(`"func":"fd_read"`), 1)
+		if bytes.Equal(tampered, recording.Bytes()) {
+			t.Skip("recording has no fd_write call")
+		}
+
+		err := water.Replay(context.Background(), &water.Config{TransportModuleBin: wasmReverse}, bytes.NewReader(tampered))
+		if !errors.Is(err, water.ErrReplayDiverged) {
+			t.Errorf("Replay() error = %v, want %v", err, water.ErrReplayDiverged)
+		}
+	})
+}
+
+func TestRecordToDir(t *testing.T) {
+	dir := t.TempDir()
+
+	w, err := water.RecordToDir(dir)()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "watm-record-*.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Errorf("found %d recording files, want 1", len(files))
+	}
+}
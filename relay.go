@@ -3,6 +3,7 @@ package water
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net"
 )
 
@@ -124,22 +125,45 @@ func NewRelay(c *Config) (Relay, error) {
 // function call will return with an error.
 // Call [WazeroRuntimeConfigFactory.SetCloseOnContextDone] with false to disable
 // this behavior.
+//
+// The Relay keeps a copy of the Config, which must not be modified
+// afterwards, see ErrConfigMutated.
 func NewRelayWithContext(ctx context.Context, c *Config) (Relay, error) {
+	c, err := c.snapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	if c.ProcessIsolation != nil {
+		return nil, fmt.Errorf("%w: Relay", ErrProcessIsolationUnsupported)
+	}
+
+	spec, err := negotiateVersion(c.TransportModuleBin)
+	if err != nil {
+		return nil, err
+	}
+	if spec != nil {
+		for _, name := range spec.exportNames(RoleRelay) {
+			if f, ok := knownRelayVersions[name]; ok {
+				return f(ctx, c)
+			}
+		}
+		return nil, versionRoleError(ErrRelayVersionNotFound, spec, RoleRelay)
+	}
+
 	core, err := NewCoreWithContext(ctx, c)
 	if err != nil {
 		return nil, err
 	}
+	defer core.Close() // skipcq: GO-S2307
 
-	// Search through all exported names and match them to potential
-	// Listener versions.
-	//
-	// TODO: detect the version of the WebAssembly Transport Module
-	// in a more organized way.
+	// The WATM declares no version, search through all exported names
+	// and match them to potential Relay versions.
 	for exportName := range core.Exports() {
 		if f, ok := knownRelayVersions[exportName]; ok {
 			return f(ctx, c)
 		}
 	}
 
-	return nil, ErrRelayVersionNotFound
+	return nil, versionNotFoundError(ErrRelayVersionNotFound, c.TransportModuleBin, RoleRelay)
 }
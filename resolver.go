@@ -0,0 +1,323 @@
+package water
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"time"
+)
+
+var (
+	ErrHostnameRejected   = errors.New("water: hostname is rejected, WATM must resolve it")
+	ErrNoAddressAvailable = errors.New("water: no address available for the requested IP version")
+	ErrNetworkConflict    = errors.New("water: dialed network conflicts with the IP version pinned by Resolver")
+)
+
+// Resolver controls how the hostname in an address is resolved by the host
+// before dialing for the WebAssembly Transport Module.
+type Resolver struct {
+	// LookupNetIP looks up host using the local resolver. It returns a
+	// slice of that host's IP addresses of the type specified by network.
+	// The network must be one of "ip", "ip4" or "ip6".
+	//
+	// If not set, net.DefaultResolver.LookupNetIP will be used. Set this
+	// field to (*net.Resolver).LookupNetIP of a custom net.Resolver or to
+	// a DNS-over-HTTPS/TLS client to avoid using the system resolver.
+	LookupNetIP func(ctx context.Context, network, host string) ([]netip.Addr, error)
+
+	// Network pins the IP version of the dialed address. It must be one
+	// of "ip" (default), "ip4" or "ip6". An IP literal of another version
+	// is rejected as well, and so is a dialed network of another version
+	// (e.g., "tcp6" if "ip4" is pinned) with ErrNetworkConflict.
+	Network string
+
+	// RejectHostnames forces the resolution to be done inside the WATM by
+	// rejecting any address not containing an IP literal.
+	RejectHostnames bool
+
+	// Timeout bounds each lookup. Zero means no timeout.
+	Timeout time.Duration
+
+	// FallbackDelay specifies how long to wait for a connection to the
+	// addresses of the preferred IP version before racing those of the
+	// other version, when a hostname resolves to both, as in Happy
+	// Eyeballs (RFC 8305). If zero, a default delay of 300ms is used. If
+	// negative, the IP versions are not raced but tried one after another.
+	FallbackDelay time.Duration
+}
+
+// defaultFallbackDelay is the FallbackDelay used if it is not set, the same
+// as the one of net.Dialer.
+const defaultFallbackDelay = 300 * time.Millisecond
+
+// Clone returns a copy of the Resolver.
+func (r *Resolver) Clone() *Resolver {
+	if r == nil {
+		return nil
+	}
+
+	resolver := *r
+	return &resolver
+}
+
+// ResolveAddress resolves the host part of the address according to the
+// Resolver and returns the address with the host replaced by an IP
+// literal. Addresses on non-IP networks (e.g., "unix") are returned as-is.
+//
+// ResolveAddress uses context.Background internally; to specify the
+// context, use ResolveAddressContext.
+func (r *Resolver) ResolveAddress(network, address string) (string, error) {
+	return r.ResolveAddressContext(context.Background(), network, address)
+}
+
+// ResolveAddressContext resolves the address like ResolveAddress does,
+// looking up the hostname with ctx.
+func (r *Resolver) ResolveAddressContext(ctx context.Context, network, address string) (string, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6", "udp", "udp4", "udp6":
+	default:
+		return address, nil
+	}
+
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", fmt.Errorf("water: net.SplitHostPort returned error: %w", err)
+	}
+
+	ipNetwork, err := r.ipNetwork(network)
+	if err != nil {
+		return "", err
+	}
+
+	if ip, err := netip.ParseAddr(host); err == nil {
+		if !ipMatchesNetwork(ip, ipNetwork) {
+			return "", ErrNoAddressAvailable
+		}
+		return address, nil
+	}
+
+	if r.RejectHostnames {
+		return "", ErrHostnameRejected
+	}
+
+	ips, err := r.lookup(ctx, ipNetwork, host)
+	if err != nil {
+		return "", err
+	}
+
+	for _, ip := range ips {
+		if ipMatchesNetwork(ip, ipNetwork) {
+			return net.JoinHostPort(ip.Unmap().String(), port), nil
+		}
+	}
+
+	return "", ErrNoAddressAvailable
+}
+
+// lookup looks up the IP addresses of host on the IP network.
+func (r *Resolver) lookup(ctx context.Context, ipNetwork, host string) ([]netip.Addr, error) {
+	lookup := r.LookupNetIP
+	if lookup == nil {
+		lookup = net.DefaultResolver.LookupNetIP
+	}
+
+	if r.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.Timeout)
+		defer cancel()
+	}
+
+	ips, err := lookup(ctx, ipNetwork, host)
+	if err != nil {
+		return nil, fmt.Errorf("water: resolving %s: %w", host, err)
+	}
+	return ips, nil
+}
+
+// resolveAddresses resolves the address like ResolveAddress does, but
+// returns all the addresses resolved, split into those of the preferred IP
+// version and those of the other version, each in the order looked up.
+func (r *Resolver) resolveAddresses(ctx context.Context, network, address string, preferIPv6 bool) (primaries, fallbacks []string, err error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, nil, fmt.Errorf("water: net.SplitHostPort returned error: %w", err)
+	}
+
+	if _, err := netip.ParseAddr(host); err == nil || r.RejectHostnames {
+		resolved, err := r.ResolveAddressContext(ctx, network, address)
+		if err != nil {
+			return nil, nil, err
+		}
+		return []string{resolved}, nil, nil
+	}
+
+	ipNetwork, err := r.ipNetwork(network)
+	if err != nil {
+		return nil, nil, err
+	}
+	ips, err := r.lookup(ctx, ipNetwork, host)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, ip := range ips {
+		if !ipMatchesNetwork(ip, ipNetwork) {
+			continue
+		}
+
+		ip = ip.Unmap()
+		if resolved := net.JoinHostPort(ip.String(), port); ip.Is6() == preferIPv6 {
+			primaries = append(primaries, resolved)
+		} else {
+			fallbacks = append(fallbacks, resolved)
+		}
+	}
+
+	if len(primaries) == 0 {
+		primaries, fallbacks = fallbacks, nil
+	}
+	if len(primaries) == 0 {
+		return nil, nil, ErrNoAddressAvailable
+	}
+	return primaries, fallbacks, nil
+}
+
+// dialFunc wraps dialerFunc, returning a function resolving the address
+// with ctx before dialing it. If a hostname resolves to addresses of both
+// IP versions, those of the preferred version are dialed first, and those
+// of the other version are raced after the FallbackDelay, as in Happy
+// Eyeballs (RFC 8305). The first connection established is returned.
+func (r *Resolver) dialFunc(ctx context.Context, dialerFunc func(network, address string) (net.Conn, error), preferIPv6 bool) func(network, address string) (net.Conn, error) {
+	return func(network, address string) (net.Conn, error) {
+		switch network {
+		case "tcp", "tcp4", "tcp6", "udp", "udp4", "udp6":
+		default:
+			return dialerFunc(network, address)
+		}
+
+		primaries, fallbacks, err := r.resolveAddresses(ctx, network, address, preferIPv6)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(fallbacks) == 0 || r.FallbackDelay < 0 {
+			return dialSerial(dialerFunc, network, append(primaries, fallbacks...))
+		}
+
+		fallbackDelay := r.FallbackDelay
+		if fallbackDelay == 0 {
+			fallbackDelay = defaultFallbackDelay
+		}
+		return dialParallel(dialerFunc, network, primaries, fallbacks, fallbackDelay)
+	}
+}
+
+// dialSerial dials the addresses one after another, returning the first
+// connection established.
+func dialSerial(dialerFunc func(network, address string) (net.Conn, error), network string, addresses []string) (net.Conn, error) {
+	if len(addresses) == 1 {
+		return dialerFunc(network, addresses[0])
+	}
+
+	var errs []error
+	for _, address := range addresses {
+		conn, err := dialerFunc(network, address)
+		if err == nil {
+			return conn, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", address, err))
+	}
+	return nil, fmt.Errorf("water: all %d addresses failed: %w", len(addresses), errors.Join(errs...))
+}
+
+// dialParallel dials the primaries, then races the fallbacks once the
+// fallbackDelay elapses or the primaries all fail, returning the first
+// connection established. The other one, if established later, is closed.
+func dialParallel(dialerFunc func(network, address string) (net.Conn, error), network string, primaries, fallbacks []string, fallbackDelay time.Duration) (net.Conn, error) {
+	type dialResult struct {
+		conn net.Conn
+		err  error
+	}
+
+	results := make(chan dialResult, 2)
+	dial := func(addresses []string) {
+		go func() {
+			conn, err := dialSerial(dialerFunc, network, addresses)
+			results <- dialResult{conn, err}
+		}()
+	}
+
+	dial(primaries)
+	pending := 1
+
+	fallbackTimer := time.NewTimer(fallbackDelay)
+	defer fallbackTimer.Stop()
+	startFallbacks := func() {
+		if fallbacks != nil {
+			dial(fallbacks)
+			fallbacks = nil
+			pending++
+		}
+	}
+
+	var errs []error
+	for {
+		select {
+		case <-fallbackTimer.C:
+			startFallbacks()
+		case res := <-results:
+			pending--
+			if res.err == nil {
+				if pending > 0 {
+					go func() {
+						if res := <-results; res.conn != nil {
+							res.conn.Close()
+						}
+					}()
+				}
+				return res.conn, nil
+			}
+
+			errs = append(errs, res.err)
+			startFallbacks() // the primaries failed, no need to wait
+			if pending == 0 {
+				return nil, errors.Join(errs...)
+			}
+		}
+	}
+}
+
+// ipNetwork returns the IP network to look up, combining the
+// Resolver's pinned version with the one implied by the dialed network.
+// It returns ErrNetworkConflict if they differ.
+func (r *Resolver) ipNetwork(network string) (string, error) {
+	ipNetwork := "ip"
+	switch network[len(network)-1] {
+	case '4':
+		ipNetwork = "ip4"
+	case '6':
+		ipNetwork = "ip6"
+	}
+
+	switch r.Network {
+	case "ip4", "ip6":
+		if ipNetwork != "ip" && ipNetwork != r.Network {
+			return "", fmt.Errorf("%w: %s with %s", ErrNetworkConflict, network, r.Network)
+		}
+		return r.Network, nil
+	}
+	return ipNetwork, nil
+}
+
+func ipMatchesNetwork(ip netip.Addr, network string) bool {
+	switch network {
+	case "ip4":
+		return ip.Unmap().Is4()
+	case "ip6":
+		return ip.Is6() && !ip.Is4In6()
+	default:
+		return true
+	}
+}
@@ -0,0 +1,236 @@
+package water_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/refraction-networking/water"
+)
+
+func TestResolver_ResolveAddress(t *testing.T) {
+	lookup := func(_ context.Context, network, host string) ([]netip.Addr, error) {
+		if host != "example.com" {
+			return nil, errors.New("no such host")
+		}
+		return []netip.Addr{netip.MustParseAddr("2001:db8::1"), netip.MustParseAddr("192.0.2.1")}, nil
+	}
+
+	for _, tc := range []struct {
+		name     string
+		resolver *water.Resolver
+		network  string
+		address  string
+		want     string
+		wantErr  error
+	}{
+		{"any version", &water.Resolver{LookupNetIP: lookup}, "tcp", "example.com:443", "[2001:db8::1]:443", nil},
+		{"pinned v4", &water.Resolver{LookupNetIP: lookup, Network: "ip4"}, "tcp", "example.com:443", "192.0.2.1:443", nil},
+		{"v4 from network", &water.Resolver{LookupNetIP: lookup}, "tcp4", "example.com:443", "192.0.2.1:443", nil},
+		{"IP literal passthrough", &water.Resolver{LookupNetIP: lookup}, "tcp", "198.51.100.1:80", "198.51.100.1:80", nil},
+		{"IP literal mismatch", &water.Resolver{LookupNetIP: lookup, Network: "ip6"}, "tcp", "198.51.100.1:80", "", water.ErrNoAddressAvailable},
+		{"hostname rejected", &water.Resolver{LookupNetIP: lookup, RejectHostnames: true}, "tcp", "example.com:443", "", water.ErrHostnameRejected},
+		{"non-IP network", &water.Resolver{LookupNetIP: lookup}, "unix", "/tmp/water.sock", "/tmp/water.sock", nil},
+		{"network conflict", &water.Resolver{LookupNetIP: lookup, Network: "ip4"}, "tcp6", "example.com:443", "", water.ErrNetworkConflict},
+		{"IP literal network conflict", &water.Resolver{LookupNetIP: lookup, Network: "ip6"}, "udp4", "[2001:db8::1]:443", "", water.ErrNetworkConflict},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := tc.resolver.ResolveAddress(tc.network, tc.address)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("ResolveAddress() error = %v, want %v", err, tc.wantErr)
+			}
+			if got != tc.want {
+				t.Errorf("ResolveAddress() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestResolver_ResolveAddressContext(t *testing.T) {
+	type ctxKey struct{}
+
+	resolver := &water.Resolver{
+		LookupNetIP: func(ctx context.Context, _, _ string) ([]netip.Addr, error) {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			if ctx.Value(ctxKey{}) == nil {
+				return nil, errors.New("lookup is not done with the context passed")
+			}
+			return []netip.Addr{netip.MustParseAddr("192.0.2.1")}, nil
+		},
+	}
+
+	ctx := context.WithValue(context.Background(), ctxKey{}, true)
+	if got, err := resolver.ResolveAddressContext(ctx, "tcp", "example.com:443"); err != nil || got != "192.0.2.1:443" {
+		t.Errorf("ResolveAddressContext() = %q, %v, want %q", got, err, "192.0.2.1:443")
+	}
+
+	// the dial context is passed through to the lookup
+	config := &water.Config{Resolver: resolver}
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if conn, err := config.NetworkDialerFuncWithContext(canceled)("tcp", "example.com:443"); !errors.Is(err, context.Canceled) {
+		if conn != nil {
+			conn.Close()
+		}
+		t.Errorf("NetworkDialerFuncWithContext() error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestConfig_DualStack(t *testing.T) {
+	t.Run("IPv4 must be dialed first by default", testDualStackPreferIPv4)
+	t.Run("IPv6 must be dialed first if preferred", testDualStackPreferIPv6)
+	t.Run("other IP version must be raced after delay", testDualStackRace)
+	t.Run("IPv6-only hostname must be dialed", testDualStackIPv6Only)
+	t.Run("IPv6-only network must be dialed", testDualStackIPv6OnlyNetwork)
+}
+
+func dualStackLookup(addrs ...string) func(context.Context, string, string) ([]netip.Addr, error) {
+	return func(_ context.Context, network, host string) ([]netip.Addr, error) {
+		ips := make([]netip.Addr, 0, len(addrs))
+		for _, addr := range addrs {
+			ips = append(ips, netip.MustParseAddr(addr))
+		}
+		return ips, nil
+	}
+}
+
+// addressedConn is a net.Conn recording the address it was dialed at.
+type addressedConn struct {
+	net.Conn
+	address string
+	closed  atomic.Bool
+}
+
+func (c *addressedConn) Close() error {
+	c.closed.Store(true)
+	return c.Conn.Close()
+}
+
+func addressRecordingDialerFunc(network, address string) (net.Conn, error) {
+	c1, _ := net.Pipe()
+	return &addressedConn{Conn: c1, address: address}, nil
+}
+
+func testDualStackPreferIPv4(t *testing.T) {
+	config := &water.Config{
+		NetworkDialerFunc: addressRecordingDialerFunc,
+		Resolver:          &water.Resolver{LookupNetIP: dualStackLookup("2001:db8::1", "192.0.2.1")},
+	}
+
+	conn, err := config.NetworkDialerFuncOrDefault()("tcp", "example.com:443")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close() // skipcq: GO-S2307
+
+	if got := conn.(*addressedConn).address; got != "192.0.2.1:443" {
+		t.Errorf("dialed %s, want 192.0.2.1:443", got)
+	}
+}
+
+func testDualStackPreferIPv6(t *testing.T) {
+	config := &water.Config{
+		NetworkDialerFunc: addressRecordingDialerFunc,
+		Resolver:          &water.Resolver{LookupNetIP: dualStackLookup("192.0.2.1", "2001:db8::1")},
+		PreferIPv6:        true,
+	}
+
+	conn, err := config.NetworkDialerFuncOrDefault()("tcp", "example.com:443")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close() // skipcq: GO-S2307
+
+	if got := conn.(*addressedConn).address; got != "[2001:db8::1]:443" {
+		t.Errorf("dialed %s, want [2001:db8::1]:443", got)
+	}
+}
+
+func testDualStackRace(t *testing.T) {
+	slowConns := make(chan *addressedConn, 1)
+	config := &water.Config{
+		NetworkDialerFunc: func(network, address string) (net.Conn, error) {
+			conn, _ := addressRecordingDialerFunc(network, address)
+			if address == "192.0.2.1:443" { // blackholed IPv4
+				time.Sleep(500 * time.Millisecond)
+				slowConns <- conn.(*addressedConn)
+			}
+			return conn, nil
+		},
+		Resolver: &water.Resolver{
+			LookupNetIP:   dualStackLookup("192.0.2.1", "2001:db8::1"),
+			FallbackDelay: 50 * time.Millisecond,
+		},
+	}
+
+	start := time.Now()
+	conn, err := config.NetworkDialerFuncOrDefault()("tcp", "example.com:443")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close() // skipcq: GO-S2307
+
+	if got := conn.(*addressedConn).address; got != "[2001:db8::1]:443" {
+		t.Errorf("dialed %s, want [2001:db8::1]:443", got)
+	}
+	if elapsed := time.Since(start); elapsed >= 500*time.Millisecond {
+		t.Errorf("dial took %v, want the IPv6 address raced after 50ms", elapsed)
+	}
+
+	// the connection established late must be closed
+	slowConn := <-slowConns
+	deadline := time.Now().Add(time.Second)
+	for !slowConn.closed.Load() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !slowConn.closed.Load() {
+		t.Error("losing connection is not closed")
+	}
+}
+
+func testDualStackIPv6Only(t *testing.T) {
+	config := &water.Config{
+		NetworkDialerFunc: addressRecordingDialerFunc,
+		Resolver:          &water.Resolver{LookupNetIP: dualStackLookup("2001:db8::1", "2001:db8::2")},
+	}
+
+	conn, err := config.NetworkDialerFuncOrDefault()("tcp", "example.com:443")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close() // skipcq: GO-S2307
+
+	if got := conn.(*addressedConn).address; got != "[2001:db8::1]:443" {
+		t.Errorf("dialed %s, want [2001:db8::1]:443", got)
+	}
+}
+
+func testDualStackIPv6OnlyNetwork(t *testing.T) {
+	lis, err := net.Listen("tcp6", "[::1]:0")
+	if err != nil {
+		t.Skipf("IPv6 is not available: %v", err)
+	}
+	defer lis.Close() // skipcq: GO-S2307
+
+	// the IPv4 address is refused, as if the host had no IPv4 connectivity
+	_, port, _ := net.SplitHostPort(lis.Addr().String())
+	config := &water.Config{
+		Resolver: &water.Resolver{LookupNetIP: dualStackLookup("127.0.0.1", "::1")},
+	}
+
+	conn, err := config.NetworkDialerFuncOrDefault()("tcp", net.JoinHostPort("localhost", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close() // skipcq: GO-S2307
+
+	if remote := conn.RemoteAddr().(*net.TCPAddr); !remote.IP.Equal(net.IPv6loopback) {
+		t.Errorf("connected to %v, want [::1]", remote)
+	}
+}
@@ -0,0 +1,221 @@
+package water
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/refraction-networking/water/internal/log"
+)
+
+const defaultReverseRetryInterval = time.Second
+
+// ReverseListenerConfig configures a Listener created with ListenReverse.
+type ReverseListenerConfig struct {
+	// Network and Address locate the rendezvous point the connections
+	// are dialed to, e.g., "tcp" and "rendezvous.example.com:443".
+	Network string
+	Address string
+
+	// IdleConns is the number of connections kept open to the rendezvous
+	// point waiting for a session, i.e., the number of sessions able to
+	// start at once. If this field is unset, it defaults to 1.
+	IdleConns int
+
+	// RetryInterval is the time waited before dialing the rendezvous
+	// point again once dialing it or waiting for a session failed. If
+	// this field is unset, it defaults to 1 second.
+	RetryInterval time.Duration
+
+	// Ready optionally blocks until the rendezvous point pairs the
+	// connection dialed with a client, e.g., by exchanging a custom
+	// registration protocol, and returns the connection to run the WATM
+	// over. If this field is unset, the connection is paired once the
+	// first byte is received from it, which is then replayed to the WATM.
+	Ready func(conn net.Conn) (net.Conn, error)
+}
+
+// ListenReverse creates a Listener accepting the sessions over connections
+// dialed out to a rendezvous point, instead of accepted from a local
+// network address, e.g., so that a server behind a NAT is able to host a
+// WATM. The WATM plays the listener role over each of these connections.
+//
+// The connections are dialed with the NetworkDialerFunc of the Config (or
+// with the UnderlyingProtocol, or net.Dial, if unset) and then treated as
+// accepted ones, so that, e.g., the AcceptFilter and the bandwidth limits
+// apply to them. The NetworkListener of the Config is ignored. The Listener keeps dialing the rendezvous point
+// until it is closed.
+func ListenReverse(ctx context.Context, c *Config, rc *ReverseListenerConfig) (Listener, error) {
+	if c == nil {
+		return nil, errors.New("water: listening in reverse with nil config is not allowed")
+	}
+	if rc == nil || rc.Network == "" || rc.Address == "" {
+		return nil, errors.New("water: listening in reverse requires the address of a rendezvous point")
+	}
+
+	dialerFunc := c.NetworkDialerFunc
+	if dialerFunc == nil {
+		dialerFunc = c.underlyingDialerFunc(ctx)
+	}
+	if dialerFunc == nil {
+		dialerFunc = (&net.Dialer{Control: c.TCPOptions.Control}).Dial
+	}
+
+	rl := &reverseNetworkListener{
+		rc:       *rc,
+		dial:     dialerFunc,
+		logger:   c.Logger(),
+		sessions: make(chan net.Conn),
+		done:     make(chan struct{}),
+		waiting:  make(map[net.Conn]struct{}),
+	}
+	if rl.rc.IdleConns <= 0 {
+		rl.rc.IdleConns = 1
+	}
+	if rl.rc.RetryInterval <= 0 {
+		rl.rc.RetryInterval = defaultReverseRetryInterval
+	}
+	if rl.rc.Ready == nil {
+		rl.rc.Ready = readyOnFirstByte
+	}
+
+	config, err := c.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	config.NetworkListener = rl
+
+	lis, err := NewListenerWithContext(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < rl.rc.IdleConns; i++ {
+		go rl.run()
+	}
+	return lis, nil
+}
+
+// readyOnFirstByte waits for the first byte from conn and returns conn
+// replaying it.
+func readyOnFirstByte(conn net.Conn) (net.Conn, error) {
+	r := bufio.NewReader(conn)
+	if _, err := r.Peek(1); err != nil {
+		return nil, err
+	}
+	return &peekedConn{Conn: conn, r: r}, nil
+}
+
+// reverseNetworkListener is a net.Listener handing over the connections
+// dialed to a rendezvous point once paired with a client.
+type reverseNetworkListener struct {
+	rc     ReverseListenerConfig
+	dial   func(network, address string) (net.Conn, error)
+	logger *log.Logger
+
+	sessions  chan net.Conn
+	done      chan struct{} // closed once the listener is closed
+	closeOnce sync.Once
+
+	waitingMutex sync.Mutex
+	waiting      map[net.Conn]struct{} // connections waiting to be paired, closed with the listener
+}
+
+// run keeps a connection to the rendezvous point waiting for a session
+// until the listener is closed.
+func (l *reverseNetworkListener) run() {
+	for {
+		conn, err := l.dial(l.rc.Network, l.rc.Address)
+		if err == nil {
+			if conn, err = l.waitReady(conn); err == nil {
+				select {
+				case l.sessions <- conn:
+					continue
+				case <-l.done:
+					conn.Close()
+					return
+				}
+			}
+		}
+
+		select {
+		case <-l.done:
+			return
+		default:
+		}
+
+		log.LWarnf(l.logger, "water: reverse listener failed to connect to rendezvous point %s: %v", l.rc.Address, err)
+		select {
+		case <-time.After(l.rc.RetryInterval):
+		case <-l.done:
+			return
+		}
+	}
+}
+
+// waitReady waits for conn to be paired with a client, unless the listener
+// is closed in the meantime.
+func (l *reverseNetworkListener) waitReady(conn net.Conn) (net.Conn, error) {
+	l.waitingMutex.Lock()
+	select {
+	case <-l.done:
+		l.waitingMutex.Unlock()
+		conn.Close()
+		return nil, net.ErrClosed
+	default:
+	}
+	l.waiting[conn] = struct{}{}
+	l.waitingMutex.Unlock()
+
+	ready, err := l.rc.Ready(conn)
+
+	l.waitingMutex.Lock()
+	delete(l.waiting, conn)
+	l.waitingMutex.Unlock()
+
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return ready, nil
+}
+
+// Accept implements net.Listener.
+func (l *reverseNetworkListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.sessions:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close implements net.Listener. It closes the connections waiting for a
+// session and stops dialing the rendezvous point.
+func (l *reverseNetworkListener) Close() error {
+	l.closeOnce.Do(func() {
+		l.waitingMutex.Lock()
+		close(l.done)
+		for conn := range l.waiting {
+			conn.Close()
+		}
+		l.waitingMutex.Unlock()
+	})
+	return nil
+}
+
+// Addr implements net.Listener. It returns the address of the rendezvous
+// point.
+func (l *reverseNetworkListener) Addr() net.Addr {
+	return reverseAddr{network: l.rc.Network, address: l.rc.Address}
+}
+
+type reverseAddr struct {
+	network, address string
+}
+
+func (a reverseAddr) Network() string { return a.network }
+func (a reverseAddr) String() string  { return a.address }
@@ -0,0 +1,90 @@
+package water_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/refraction-networking/water"
+	_ "github.com/refraction-networking/water/transport/v1"
+)
+
+func TestListenReverse(t *testing.T) {
+	config := &water.Config{
+		TransportModuleBin:  wasmReverse,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+	}
+
+	// the rendezvous point pairs each connection from the listener with
+	// the client, which is played by the test here
+	rendezvous, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rendezvous.Close() // skipcq: GO-S2307
+
+	lis, err := water.ListenReverse(context.Background(), config, &water.ReverseListenerConfig{
+		Network:       "tcp",
+		Address:       rendezvous.Addr().String(),
+		RetryInterval: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close() // skipcq: GO-S2307
+
+	if got := lis.Addr().String(); got != rendezvous.Addr().String() {
+		t.Errorf("Addr() = %s, want the rendezvous point %s", got, rendezvous.Addr())
+	}
+
+	outbound, err := rendezvous.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := water.WrapConn(context.Background(), config, outbound, water.RoleDialer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close() // skipcq: GO-S2307
+
+	msg := []byte("hello from behind the NAT")
+	if _, err = client.Write(msg); err != nil {
+		t.Fatal(err)
+	}
+
+	server, err := lis.AcceptWATER()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close() // skipcq: GO-S2307
+
+	buf := make([]byte, len(msg))
+	if _, err = io.ReadFull(server, buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, msg) {
+		t.Errorf("read %q, want %q", buf, msg)
+	}
+
+	// another connection waits for the next session, until the listener
+	// is closed
+	next, err := rendezvous.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer next.Close() // skipcq: GO-S2307
+
+	if err = lis.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = next.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = next.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("Read() on the idle connection after Close error = %v, want %v", err, io.EOF)
+	}
+}
@@ -0,0 +1,125 @@
+package water_test
+
+import (
+	"context"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/refraction-networking/water"
+	_ "github.com/refraction-networking/water/transport/v1"
+	"github.com/tetratelabs/wazero"
+)
+
+func TestWazeroRuntimeConfigFactory_SetIsolated(t *testing.T) {
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close() // skipcq: GO-S2307
+
+	config := &water.Config{
+		TransportModuleBin: wasmReverse,
+	}
+	config.RuntimeConfig().SetIsolated(true)
+
+	dialer, err := water.NewDialerWithContext(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// each connection must get a working, isolated runtime
+	for i := 0; i < 2; i++ {
+		conn, err := dialer.DialContext(context.Background(), "tcp", lis.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		peerConn, err := lis.Accept()
+		if err != nil {
+			conn.Close()
+			t.Fatal(err)
+		}
+
+		if _, err = conn.Write([]byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+
+		buf := make([]byte, 16)
+		n, err := peerConn.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(buf[:n]) != "olleh" {
+			t.Fatalf("read %q, want %q", buf[:n], "olleh")
+		}
+
+		conn.Close()
+		peerConn.Close()
+	}
+}
+
+// TestWazeroRuntimeConfigFactory_SetIsolated_CompilationCache checks that an
+// isolated Core does not hit the global CompilationCache, by prepopulating
+// it with corrupted machine code of the WATM, which would fail a Core
+// compiling the WATM through it.
+func TestWazeroRuntimeConfigFactory_SetIsolated_CompilationCache(t *testing.T) {
+	dir := t.TempDir()
+
+	// prepopulate the cache with the WATM compiled, then corrupt it
+	cache, err := wazero.NewCompilationCacheWithDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prepopulated := &water.Config{
+		TransportModuleBin:   wasmReverse,
+		RuntimeConfigFactory: water.NewWazeroRuntimeConfigFactory(),
+	}
+	prepopulated.RuntimeConfigFactory.SetCompilationCache(cache)
+	core, err := water.NewCoreWithContext(context.Background(), prepopulated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	core.Close()
+	cache.Close(context.Background()) // skipcq: GO-S2307
+
+	var corrupted int
+	if err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		corrupted++
+		return os.WriteFile(path, []byte("corrupted"), 0o600)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if corrupted == 0 {
+		t.Skip("the CompilationCache is not persisted on this platform")
+	}
+
+	cache, err = wazero.NewCompilationCacheWithDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close(context.Background()) // skipcq: GO-S2307
+	water.SetGlobalCompilationCache(cache)
+	defer water.SetGlobalCompilationCache(nil)
+
+	shared := &water.Config{
+		TransportModuleBin: wasmReverse,
+	}
+	if core, err := water.NewCoreWithContext(context.Background(), shared); err == nil {
+		core.Close()
+		t.Fatal("NewCoreWithContext must fail with the corrupted CompilationCache")
+	}
+
+	isolated := shared.Clone()
+	isolated.RuntimeConfig().SetIsolated(true)
+	core, err = water.NewCoreWithContext(context.Background(), isolated)
+	if err != nil {
+		t.Fatalf("NewCoreWithContext() error = %v, want the isolated Core to miss the CompilationCache", err)
+	}
+	core.Close()
+}
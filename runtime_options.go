@@ -0,0 +1,140 @@
+package water
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+)
+
+// ErrCompilerUnsupported is returned when RuntimeStrategyCompiler is
+// selected on a platform the compiler does not support.
+var ErrCompilerUnsupported = errors.New("water: compiler is not supported on " + runtime.GOOS + "/" + runtime.GOARCH)
+
+// CompilerSupported reports whether WATMs may be compiled to machine code
+// on this platform, i.e., on amd64 or arm64 running Linux, macOS, FreeBSD
+// or Windows. Elsewhere, e.g., on ARM32 or MIPS routers, WATMs are
+// interpreted, which runs slower but needs no JIT support.
+//
+// On amd64, the compiler also requires SSE4.1, which is not checked here
+// but is available on all x86-64 CPUs released since 2011.
+func CompilerSupported() bool {
+	return compilerSupported
+}
+
+// RuntimeStrategy selects how the WebAssembly Transport Module is
+// executed.
+type RuntimeStrategy uint8
+
+const (
+	// RuntimeStrategyAuto compiles the WATM to machine code if the
+	// platform is supported, and interprets it otherwise.
+	RuntimeStrategyAuto RuntimeStrategy = iota
+
+	// RuntimeStrategyCompiler compiles the WATM to machine code, failing
+	// with ErrCompilerUnsupported if the platform is not supported, see
+	// CompilerSupported.
+	RuntimeStrategyCompiler
+
+	// RuntimeStrategyInterpreter interprets the WATM, which runs slower
+	// but is available on all platforms.
+	RuntimeStrategyInterpreter
+)
+
+// RuntimeOptions tunes the WebAssembly runtime running the WATMs created
+// from a Config, trading memory for speed or the other way around.
+//
+// All WATMs compiled with the same strategy share a single engine, and
+// thus the compiled machine code, through the CompilationCache, unless
+// isolated with WazeroRuntimeConfigFactory.SetIsolated. A WATM is then
+// compiled once and each connection costs only its own instance and
+// linear memory, which these options mostly tune. The compilation of a
+// WATM is sequential, there is no knob for parallel compilation.
+type RuntimeOptions struct {
+	// Strategy selects how the WATM is executed. It overrides the mode
+	// set with WazeroRuntimeConfigFactory.Interpreter or Compiler, unless
+	// left as RuntimeStrategyAuto.
+	Strategy RuntimeStrategy
+
+	// MemoryLimitPages optionally limits the linear memory of each
+	// instance, in pages of 64 KiB, bounding the memory reserved for it.
+	// If this field is unset, the limit is 65536 pages, i.e., 4 GiB.
+	MemoryLimitPages uint32
+
+	// StaticMemory reserves the maximum linear memory declared by the
+	// WATM, or MemoryLimitPages if none is declared, for each instance
+	// upfront, instead of growing it on demand. It saves the copies on
+	// growth at the cost of resident memory, so it is only worth it for
+	// WATMs declaring a small maximum.
+	StaticMemory bool
+}
+
+// Clone returns a copy of the RuntimeOptions.
+func (o *RuntimeOptions) Clone() *RuntimeOptions {
+	if o == nil {
+		return nil
+	}
+
+	clone := *o
+	return &clone
+}
+
+// String returns the name of the RuntimeStrategy, as accepted by
+// ParseRuntimeStrategy.
+func (s RuntimeStrategy) String() string {
+	switch s {
+	case RuntimeStrategyAuto:
+		return "auto"
+	case RuntimeStrategyCompiler:
+		return "compiler"
+	case RuntimeStrategyInterpreter:
+		return "interpreter"
+	default:
+		return fmt.Sprintf("RuntimeStrategy(%d)", uint8(s))
+	}
+}
+
+// ParseRuntimeStrategy returns the RuntimeStrategy named s, i.e., "auto"
+// (or an empty string), "compiler" or "interpreter".
+func ParseRuntimeStrategy(s string) (RuntimeStrategy, error) {
+	switch s {
+	case "", "auto":
+		return RuntimeStrategyAuto, nil
+	case "compiler":
+		return RuntimeStrategyCompiler, nil
+	case "interpreter":
+		return RuntimeStrategyInterpreter, nil
+	default:
+		return RuntimeStrategyAuto, fmt.Errorf("water: unknown runtime strategy %q", s)
+	}
+}
+
+// validate checks that the options are supported on this platform.
+func (o *RuntimeOptions) validate() error {
+	if o != nil && o.Strategy == RuntimeStrategyCompiler && !CompilerSupported() {
+		return ErrCompilerUnsupported
+	}
+	return nil
+}
+
+// apply returns the WazeroRuntimeConfigFactory tuned with the options,
+// which is a copy of wrcf if any option is set.
+func (o *RuntimeOptions) apply(wrcf *WazeroRuntimeConfigFactory) *WazeroRuntimeConfigFactory {
+	if o == nil || *o == (RuntimeOptions{}) {
+		return wrcf
+	}
+
+	wrcf = wrcf.Clone()
+	switch o.Strategy {
+	case RuntimeStrategyCompiler:
+		wrcf.Compiler()
+	case RuntimeStrategyInterpreter:
+		wrcf.Interpreter()
+	}
+	if o.MemoryLimitPages > 0 {
+		wrcf.runtimeConfig = wrcf.runtimeConfig.WithMemoryLimitPages(o.MemoryLimitPages)
+	}
+	if o.StaticMemory {
+		wrcf.runtimeConfig = wrcf.runtimeConfig.WithMemoryCapacityFromMax(true)
+	}
+	return wrcf
+}
@@ -0,0 +1,93 @@
+package water_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/refraction-networking/water"
+)
+
+func TestRuntimeOptions(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		options *water.RuntimeOptions
+		wantErr bool
+	}{
+		{"interpreter", &water.RuntimeOptions{Strategy: water.RuntimeStrategyInterpreter}, false},
+		{"static memory", &water.RuntimeOptions{MemoryLimitPages: 1024, StaticMemory: true}, false},
+		{"memory limit too low", &water.RuntimeOptions{MemoryLimitPages: 1}, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			config := &water.Config{
+				TransportModuleBin:  wasmReverse,
+				ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+				RuntimeOptions:      tc.options,
+			}
+
+			dialed, accepted, err := water.Pipe(config)
+			if tc.wantErr {
+				if err == nil {
+					dialed.Close()
+					accepted.Close()
+					t.Fatal("Pipe must fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer dialed.Close()   // skipcq: GO-S2307
+			defer accepted.Close() // skipcq: GO-S2307
+
+			msg := []byte("hello")
+			if _, err = dialed.Write(msg); err != nil {
+				t.Fatal(err)
+			}
+			buf := make([]byte, len(msg))
+			if _, err = io.ReadFull(accepted, buf); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf, msg) {
+				t.Errorf("read %q, want %q", buf, msg)
+			}
+		})
+	}
+}
+
+func TestRuntimeOptions_Compiler(t *testing.T) {
+	config := &water.Config{
+		TransportModuleBin:  wasmReverse,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+		RuntimeOptions:      &water.RuntimeOptions{Strategy: water.RuntimeStrategyCompiler},
+	}
+
+	dialed, accepted, err := water.Pipe(config)
+	if !water.CompilerSupported() {
+		if !errors.Is(err, water.ErrCompilerUnsupported) {
+			t.Fatalf("Pipe returned %v, want %v", err, water.ErrCompilerUnsupported)
+		}
+		if err = config.ValidateForDialer(); !errors.Is(err, water.ErrCompilerUnsupported) {
+			t.Fatalf("ValidateForDialer returned %v, want %v", err, water.ErrCompilerUnsupported)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	dialed.Close()
+	accepted.Close()
+}
+
+func TestParseRuntimeStrategy(t *testing.T) {
+	for _, s := range []water.RuntimeStrategy{water.RuntimeStrategyAuto, water.RuntimeStrategyCompiler, water.RuntimeStrategyInterpreter} {
+		if got, err := water.ParseRuntimeStrategy(s.String()); err != nil || got != s {
+			t.Errorf("ParseRuntimeStrategy(%q) = %v, %v, want %v", s.String(), got, err, s)
+		}
+	}
+
+	if _, err := water.ParseRuntimeStrategy("jit"); err == nil {
+		t.Error("ParseRuntimeStrategy must fail with an unknown strategy")
+	}
+}
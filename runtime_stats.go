@@ -0,0 +1,36 @@
+package water
+
+// RuntimeStats is a snapshot of the resources used by the WebAssembly
+// instance behind a [Conn], which helps spotting leaky Transport Modules.
+type RuntimeStats struct {
+	// MemorySize is the size of the linear memory of the WebAssembly
+	// instance in bytes, including the memory grown by the worker thread
+	// of the Conn while it runs. It is 0 once the Conn is closed.
+	MemorySize uint64
+
+	// PeakMemorySize is the largest size of the linear memory observed
+	// during the lifetime of the Conn in bytes. Since linear memory never
+	// shrinks, it is equal to MemorySize while the Conn is open and is
+	// the size once the worker thread exited after the Conn is closed.
+	PeakMemorySize uint64
+
+	// HostConns is the number of connections held open by the host on
+	// behalf of the WebAssembly instance.
+	HostConns int
+
+	// HostBufferSize is the total size in bytes of the buffers allocated
+	// by the host for the Conn outside of the WebAssembly instance, i.e.,
+	// the receive and send buffers of the TCP connections held by the
+	// host, including both ends of the socket pair between the caller and
+	// the WATM, as reported by the operating system. It is 0 if unknown,
+	// e.g., once the Conn is closed.
+	HostBufferSize int
+
+	// ReadBufferSize and WriteBufferSize are the sizes in bytes of the
+	// buffers staging the data between the caller and the WATM, as
+	// reported by the operating system, which may differ from those set
+	// in the Config (e.g., Linux doubles them for bookkeeping). They are
+	// 0 if unknown, e.g., once the Conn is closed.
+	ReadBufferSize  int
+	WriteBufferSize int
+}
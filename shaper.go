@@ -0,0 +1,79 @@
+package water
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Shaper decides, on behalf of a WebAssembly Transport Module, how its
+// writes are to be shaped, so that shaping policies (e.g., pacing, timing
+// jitter, padding) can be tuned by the host without recompiling the WATM.
+//
+// A WATM requests shaping through the host functions of its version, e.g.,
+// `env.water_shape_delay` and `env.water_shape_padding` in v1, and remains
+// responsible for framing the padding in its own protocol.
+//
+// A Shaper MUST be safe for concurrent use, as it is shared by all WASM
+// instances created from the Config.
+type Shaper interface {
+	// Delay returns how long the WATM is to wait before writing n bytes,
+	// e.g., to pace the writes or to add timing jitter.
+	Delay(n int) time.Duration
+
+	// Padding returns how many bytes of dummy padding the WATM is to
+	// write along with n bytes of data.
+	Padding(n int) int
+}
+
+// RandomShaper is a Shaper pacing the writes at a fixed rate, with random
+// timing jitter and random padding added to each write.
+type RandomShaper struct {
+	// BytesPerSecond optionally paces the writes, so that the data written
+	// by all WASM instances sharing the RandomShaper, excluding padding,
+	// does not exceed the given rate.
+	BytesPerSecond int
+
+	// MaxJitter optionally delays each write by a uniformly random
+	// duration in [0, MaxJitter), in addition to the pacing.
+	MaxJitter time.Duration
+
+	// MinPadding and MaxPadding optionally pad each write with a uniformly
+	// random number of bytes in [MinPadding, MaxPadding].
+	MinPadding, MaxPadding int
+
+	mu   sync.Mutex
+	next time.Time // earliest time the next write is paced to
+}
+
+// Delay implements Shaper.
+func (s *RandomShaper) Delay(n int) time.Duration {
+	var delay time.Duration
+
+	if s.BytesPerSecond > 0 {
+		now := time.Now()
+
+		s.mu.Lock()
+		if s.next.Before(now) {
+			s.next = now
+		}
+		delay = s.next.Sub(now)
+		s.next = s.next.Add(time.Duration(n) * time.Second / time.Duration(s.BytesPerSecond))
+		s.mu.Unlock()
+	}
+
+	if s.MaxJitter > 0 {
+		delay += time.Duration(rand.Int63n(int64(s.MaxJitter))) // skipcq: GSC-G404
+	}
+
+	return delay
+}
+
+// Padding implements Shaper.
+func (s *RandomShaper) Padding(int) int {
+	if s.MaxPadding <= s.MinPadding {
+		return max(s.MinPadding, 0)
+	}
+
+	return max(s.MinPadding+rand.Intn(s.MaxPadding-s.MinPadding+1), 0) // skipcq: GSC-G404
+}
@@ -0,0 +1,39 @@
+package water_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/refraction-networking/water"
+)
+
+func TestRandomShaper(t *testing.T) {
+	t.Run("writes must be paced", testRandomShaperPacing)
+	t.Run("padding must be within bounds", testRandomShaperPadding)
+}
+
+func testRandomShaperPacing(t *testing.T) {
+	shaper := &water.RandomShaper{BytesPerSecond: 1000}
+
+	if delay := shaper.Delay(100); delay > 0 {
+		t.Errorf("first Delay() = %v, want 0", delay)
+	}
+
+	// the first 100 bytes take 100ms at 1000 bytes per second
+	if delay := shaper.Delay(100); delay < 90*time.Millisecond || delay > 100*time.Millisecond {
+		t.Errorf("second Delay() = %v, want about 100ms", delay)
+	}
+}
+
+func testRandomShaperPadding(t *testing.T) {
+	shaper := &water.RandomShaper{MinPadding: 10, MaxPadding: 20, MaxJitter: time.Millisecond}
+
+	for i := 0; i < 100; i++ {
+		if padding := shaper.Padding(100); padding < 10 || padding > 20 {
+			t.Fatalf("Padding() = %d, want within [10, 20]", padding)
+		}
+		if delay := shaper.Delay(100); delay < 0 || delay >= time.Millisecond {
+			t.Fatalf("Delay() = %v, want within [0, 1ms)", delay)
+		}
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"net"
 	"os"
+
+	"github.com/refraction-networking/water/internal/socket"
 )
 
 // InsertConn implements Core.
@@ -22,10 +24,28 @@ func (c *core) InsertConn(conn net.Conn) (fd int32, err error) {
 			return key, fmt.Errorf("water: (*wazero.Module).InsertTCPConn returned invalid key")
 		}
 		return key, nil
+	case *net.UnixConn:
+		return c.insertUnixConn(conn)
+	case *net.IPConn:
+		return c.insertIPConn(conn)
 	default:
-		// TODO: support other types of connections as much as possible
-		return 0, fmt.Errorf("water: unsupported connection type: %T", conn)
+		return c.insertWrappedConn(conn)
+	}
+}
+
+// insertWrappedConn inserts any type of connection by wrapping it into a
+// *net.TCPConn, which costs an extra copy of data in both directions. The
+// wrapper is owned by the Core, and closing it with the Core stops the
+// copying and closes conn.
+func (c *core) insertWrappedConn(conn net.Conn) (fd int32, err error) {
+	wrapperConn, _, err := socket.TCPConnWrap(conn)
+	if err != nil {
+		return 0, fmt.Errorf("water: socket.TCPConnWrap returned error: %w", err)
+	}
+	if err := c.owned.own(wrapperConn, fmt.Sprintf("socket pair wrapping %T", conn)); err != nil {
+		return 0, err
 	}
+	return c.InsertConn(wrapperConn)
 }
 
 // InsertListener implements Core.
@@ -0,0 +1,21 @@
+//go:build !unix
+
+package water
+
+import (
+	"errors"
+	"net"
+)
+
+// insertUnixConn inserts a unix socket by wrapping it, since its file
+// descriptor cannot be passed to the WATM on this platform, e.g., the
+// AF_UNIX sockets on Windows, which are not files.
+func (c *core) insertUnixConn(conn *net.UnixConn) (fd int32, err error) {
+	return c.insertWrappedConn(conn)
+}
+
+// insertIPConn fails, as wrapping a raw IP socket into a stream would lose
+// the boundaries of the packets.
+func (*core) insertIPConn(*net.IPConn) (fd int32, err error) {
+	return 0, errors.New("water: raw sockets cannot be inserted on this platform")
+}
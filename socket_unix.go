@@ -0,0 +1,35 @@
+//go:build unix
+
+package water
+
+import (
+	"fmt"
+	"net"
+)
+
+// insertUnixConn inserts a unix socket as a duplicated file descriptor, so
+// the WATM reads and writes it directly without extra copies. The
+// duplicate is owned by the Core, and closed with it.
+func (c *core) insertUnixConn(conn *net.UnixConn) (fd int32, err error) {
+	if f, err := conn.File(); err == nil {
+		if err := c.owned.own(f, fmt.Sprintf("duplicated file descriptor of unix socket %s", conn.RemoteAddr())); err != nil {
+			return 0, err
+		}
+		return c.InsertFile(f)
+	}
+	return c.insertWrappedConn(conn)
+}
+
+// insertIPConn inserts a raw IP socket as a duplicated file descriptor,
+// which keeps the boundaries of the packets read and written by the WATM.
+// The duplicate is owned by the Core, and closed with it.
+func (c *core) insertIPConn(conn *net.IPConn) (fd int32, err error) {
+	f, err := conn.File()
+	if err != nil {
+		return 0, fmt.Errorf("water: (*net.IPConn).File returned error: %w", err)
+	}
+	if err := c.owned.own(f, fmt.Sprintf("duplicated file descriptor of raw socket %s", conn.RemoteAddr())); err != nil {
+		return 0, err
+	}
+	return c.InsertFile(f)
+}
@@ -0,0 +1,109 @@
+package water
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrTCPOptionUnsupported is returned when a TCPOptions field is set but
+// not supported on the current platform.
+var ErrTCPOptionUnsupported = errors.New("water: TCP option is not supported on this platform")
+
+// TCPOptions controls the socket options of the TCP connections created
+// for or by the WebAssembly Transport Module, i.e., the connections dialed
+// by the host for the WATM and the connections accepted from the
+// NetworkListener. Connections other than *net.TCPConn are left as-is.
+type TCPOptions struct {
+	// NoDelay sets TCP_NODELAY, i.e., whether Nagle's algorithm is
+	// disabled. If nil, the Go default (disabled Nagle's algorithm) is kept.
+	NoDelay *bool
+
+	// KeepAlive sets SO_KEEPALIVE. If nil, the Go default is kept.
+	KeepAlive *bool
+
+	// KeepAlivePeriod sets the time between keep-alive probes if KeepAlive
+	// is enabled. Zero keeps the default.
+	KeepAlivePeriod time.Duration
+
+	// Mark sets SO_MARK, which may be used for policy routing. Zero means
+	// unset. It is supported on Linux only and requires CAP_NET_ADMIN.
+	Mark int
+
+	// BindToDevice sets SO_BINDTODEVICE, binding the socket to the named
+	// network interface. Empty means unset. It is supported on Linux only.
+	BindToDevice string
+}
+
+// Clone returns a deep copy of the TCPOptions.
+func (o *TCPOptions) Clone() *TCPOptions {
+	if o == nil {
+		return nil
+	}
+
+	options := *o
+	if o.NoDelay != nil {
+		noDelay := *o.NoDelay
+		options.NoDelay = &noDelay
+	}
+	if o.KeepAlive != nil {
+		keepAlive := *o.KeepAlive
+		options.KeepAlive = &keepAlive
+	}
+	return &options
+}
+
+// Control sets the options to be set before a socket is connected or
+// bound, i.e., Mark and BindToDevice, so that they also apply to the
+// handshake. It may be used as the Control of a net.Dialer or a
+// net.ListenConfig. It does nothing on a socket of a non-TCP network,
+// e.g., unix.
+func (o *TCPOptions) Control(network, _ string, c syscall.RawConn) error {
+	if o == nil || (o.Mark == 0 && o.BindToDevice == "") || !strings.HasPrefix(network, "tcp") {
+		return nil
+	}
+
+	var sockErr error
+	if err := c.Control(func(fd uintptr) {
+		sockErr = setSocketOptions(fd, o.Mark, o.BindToDevice)
+	}); err != nil {
+		return err
+	}
+	return sockErr
+}
+
+// Apply sets all options on an established connection. It does nothing
+// if conn is not a *net.TCPConn.
+func (o *TCPOptions) Apply(conn net.Conn) error {
+	tcpConn, ok := conn.(*net.TCPConn)
+	if o == nil || !ok {
+		return nil
+	}
+
+	if o.NoDelay != nil {
+		if err := tcpConn.SetNoDelay(*o.NoDelay); err != nil {
+			return fmt.Errorf("water: (*net.TCPConn).SetNoDelay returned error: %w", err)
+		}
+	}
+
+	if o.KeepAlive != nil {
+		if err := tcpConn.SetKeepAlive(*o.KeepAlive); err != nil {
+			return fmt.Errorf("water: (*net.TCPConn).SetKeepAlive returned error: %w", err)
+		}
+	}
+
+	if o.KeepAlivePeriod > 0 {
+		if err := tcpConn.SetKeepAlivePeriod(o.KeepAlivePeriod); err != nil {
+			return fmt.Errorf("water: (*net.TCPConn).SetKeepAlivePeriod returned error: %w", err)
+		}
+	}
+
+	rawConn, err := tcpConn.SyscallConn()
+	if err != nil {
+		return fmt.Errorf("water: (*net.TCPConn).SyscallConn returned error: %w", err)
+	}
+	return o.Control(tcpConn.LocalAddr().Network(), "", rawConn)
+}
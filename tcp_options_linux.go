@@ -0,0 +1,22 @@
+package water
+
+import (
+	"fmt"
+	"syscall"
+)
+
+func setSocketOptions(fd uintptr, mark int, device string) error {
+	if mark != 0 {
+		if err := syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_MARK, mark); err != nil {
+			return fmt.Errorf("water: setting SO_MARK: %w", err)
+		}
+	}
+
+	if device != "" {
+		if err := syscall.SetsockoptString(int(fd), syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, device); err != nil {
+			return fmt.Errorf("water: setting SO_BINDTODEVICE: %w", err)
+		}
+	}
+
+	return nil
+}
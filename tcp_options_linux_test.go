@@ -0,0 +1,106 @@
+package water_test
+
+import (
+	"errors"
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/refraction-networking/water"
+)
+
+func TestTCPOptions(t *testing.T) {
+	t.Run("NoDelay and KeepAlive", testTCPOptionsNoDelayKeepAlive)
+	t.Run("Mark", testTCPOptionsMark)
+}
+
+func testTCPOptionsNoDelayKeepAlive(t *testing.T) {
+	noDelay, keepAlive := false, true
+	dialed, accepted := dialAndAcceptWithTCPOptions(t, &water.TCPOptions{
+		NoDelay:   &noDelay,
+		KeepAlive: &keepAlive,
+	})
+
+	for name, conn := range map[string]net.Conn{"dialed": dialed, "accepted": accepted} {
+		if v := getsockoptInt(t, conn, syscall.IPPROTO_TCP, syscall.TCP_NODELAY); v != 0 {
+			t.Errorf("%s conn: TCP_NODELAY = %d, want 0", name, v)
+		}
+		if v := getsockoptInt(t, conn, syscall.SOL_SOCKET, syscall.SO_KEEPALIVE); v == 0 {
+			t.Errorf("%s conn: SO_KEEPALIVE = 0, want enabled", name)
+		}
+	}
+}
+
+func testTCPOptionsMark(t *testing.T) {
+	const mark = 0x57
+
+	// setting SO_MARK requires CAP_NET_ADMIN
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	probe, err := net.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer probe.Close()
+	if err := (&water.TCPOptions{Mark: mark}).Apply(probe); errors.Is(err, syscall.EPERM) {
+		t.Skip("CAP_NET_ADMIN is required to set SO_MARK")
+	}
+
+	dialed, accepted := dialAndAcceptWithTCPOptions(t, &water.TCPOptions{Mark: mark})
+	for name, conn := range map[string]net.Conn{"dialed": dialed, "accepted": accepted} {
+		if v := getsockoptInt(t, conn, syscall.SOL_SOCKET, syscall.SO_MARK); v != mark {
+			t.Errorf("%s conn: SO_MARK = %#x, want %#x", name, v, mark)
+		}
+	}
+}
+
+// dialAndAcceptWithTCPOptions dials a connection with the NetworkDialerFunc
+// of a Config with the TCPOptions and accepts it with AcceptNetworkConn.
+func dialAndAcceptWithTCPOptions(t *testing.T, options *water.TCPOptions) (dialed, accepted net.Conn) {
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { lis.Close() })
+
+	config := &water.Config{
+		NetworkListener: lis,
+		TCPOptions:      options,
+	}
+
+	dialed, err = config.NetworkDialerFuncOrDefault()("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { dialed.Close() })
+
+	accepted, err = config.AcceptNetworkConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { accepted.Close() })
+
+	return dialed, accepted
+}
+
+func getsockoptInt(t *testing.T, conn net.Conn, level, opt int) int {
+	rawConn, err := conn.(*net.TCPConn).SyscallConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var value int
+	var sockErr error
+	if err := rawConn.Control(func(fd uintptr) {
+		value, sockErr = syscall.GetsockoptInt(int(fd), level, opt)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if sockErr != nil {
+		t.Fatal(sockErr)
+	}
+	return value
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package water
+
+func setSocketOptions(_ uintptr, mark int, device string) error {
+	if mark != 0 || device != "" {
+		return ErrTCPOptionUnsupported
+	}
+	return nil
+}
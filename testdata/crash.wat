@@ -0,0 +1,4 @@
+(module
+  (import "env" "boom" (func))
+  (func (export "trap") unreachable)
+  (func (export "panic") call 0))
@@ -0,0 +1,5 @@
+(module
+  (memory 1)
+  (data (i32.const 0) "WATM")
+  (func unreachable)
+  (func (export "trap") call 0))
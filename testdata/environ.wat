@@ -0,0 +1,8 @@
+(module
+  (import "wasi_snapshot_preview1" "environ_sizes_get" (func (param i32 i32) (result i32)))
+  (import "wasi_snapshot_preview1" "args_sizes_get" (func (param i32 i32) (result i32)))
+  (memory (export "memory") 1)
+  (func (export "environ_sizes") (param i32) (result i32)
+    (drop (call 0 (i32.const 0) (i32.const 4))) (i32.load (local.get 0)))
+  (func (export "args_sizes") (param i32) (result i32)
+    (drop (call 1 (i32.const 0) (i32.const 4))) (i32.load (local.get 0))))
@@ -0,0 +1 @@
+(module (func (export "_start") (loop br 0)))
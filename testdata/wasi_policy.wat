@@ -0,0 +1,21 @@
+(module
+  (import "wasi_snapshot_preview1" "clock_time_get" (func $clock_time_get (param i32 i64 i32) (result i32)))
+  (import "wasi_snapshot_preview1" "random_get" (func $random_get (param i32 i32) (result i32)))
+  (import "wasi_snapshot_preview1" "fd_prestat_get" (func $fd_prestat_get (param i32 i32) (result i32)))
+  (memory (export "memory") 1)
+
+  ;; realtime returns the wall clock in nanoseconds.
+  (func (export "realtime") (result i64)
+    (drop (call $clock_time_get (i32.const 0) (i64.const 1) (i32.const 0)))
+    (i64.load (i32.const 0)))
+
+  ;; random returns 8 bytes from the random source.
+  (func (export "random") (result i64)
+    (drop (call $random_get (i32.const 0) (i32.const 8)))
+    (i64.load (i32.const 0)))
+
+  ;; prestat returns the errno of fd_prestat_get on the first preopened
+  ;; file descriptor, i.e., 0 if a directory is preopened or 8 (EBADF) if
+  ;; not.
+  (func (export "prestat") (result i32)
+    (call $fd_prestat_get (i32.const 3) (i32.const 0))))
@@ -0,0 +1,103 @@
+package water
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"time"
+)
+
+// DefaultCredentialPeriod is the period used by a [TimeBasedCredential]
+// if none is specified.
+const DefaultCredentialPeriod = 30 * time.Second
+
+// TimeBasedCredential derives time-rotated credentials (TOTP-style epoch
+// keys) from a root secret held by the host.
+//
+// When set in the Config, the credential of the current epoch is exposed
+// to the WATM via the optional `env.water_get_credential` import, so
+// modules implementing time-rotated handshakes never need access to the
+// root secret nor to a disciplined clock.
+type TimeBasedCredential struct {
+	// Secret is the root secret all credentials are derived from.
+	Secret []byte
+
+	// Period is the lifetime of each credential. If zero,
+	// DefaultCredentialPeriod will be used.
+	Period time.Duration
+
+	// Skew is the number of periods before and after the current one
+	// for which credentials are still accepted, to tolerate the clock
+	// skew between peers.
+	Skew uint
+
+	// Now returns the current time. If nil, time.Now will be used.
+	// It is intended to be set to a clock synchronized with the peer.
+	Now func() time.Time
+}
+
+// Clone returns a copy of the TimeBasedCredential.
+func (tbc *TimeBasedCredential) Clone() *TimeBasedCredential {
+	if tbc == nil {
+		return nil
+	}
+
+	clone := *tbc
+	clone.Secret = make([]byte, len(tbc.Secret))
+	copy(clone.Secret, tbc.Secret)
+	return &clone
+}
+
+func (tbc *TimeBasedCredential) period() time.Duration {
+	if tbc.Period <= 0 {
+		return DefaultCredentialPeriod
+	}
+	return tbc.Period
+}
+
+func (tbc *TimeBasedCredential) now() time.Time {
+	if tbc.Now == nil {
+		return time.Now()
+	}
+	return tbc.Now()
+}
+
+// Epoch returns the epoch the given time falls into.
+func (tbc *TimeBasedCredential) Epoch(t time.Time) int64 {
+	return t.UnixNano() / int64(tbc.period())
+}
+
+// CurrentEpoch returns the epoch of the current time.
+func (tbc *TimeBasedCredential) CurrentEpoch() int64 {
+	return tbc.Epoch(tbc.now())
+}
+
+// CredentialAt derives the credential of the given epoch, which is the
+// HMAC-SHA256 of the big-endian epoch keyed with the Secret.
+func (tbc *TimeBasedCredential) CredentialAt(epoch int64) []byte {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(epoch))
+
+	mac := hmac.New(sha256.New, tbc.Secret)
+	mac.Write(msg[:])
+	return mac.Sum(nil)
+}
+
+// Current returns the credential of the current epoch.
+func (tbc *TimeBasedCredential) Current() []byte {
+	return tbc.CredentialAt(tbc.CurrentEpoch())
+}
+
+// Verify reports whether cred is the credential of any epoch within
+// the skew window around the current epoch.
+func (tbc *TimeBasedCredential) Verify(cred []byte) bool {
+	current := tbc.CurrentEpoch()
+	skew := int64(tbc.Skew)
+
+	var ok int
+	for epoch := current - skew; epoch <= current+skew; epoch++ {
+		ok |= subtle.ConstantTimeCompare(tbc.CredentialAt(epoch), cred)
+	}
+	return ok == 1
+}
@@ -0,0 +1,54 @@
+package water_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/refraction-networking/water"
+)
+
+func TestTimeBasedCredential(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	server := &water.TimeBasedCredential{
+		Secret: []byte("root secret"),
+		Period: 30 * time.Second,
+		Skew:   1,
+		Now:    func() time.Time { return now },
+	}
+
+	if !bytes.Equal(server.Current(), server.CredentialAt(server.Epoch(now))) {
+		t.Fatal("Current() must be the credential of the current epoch")
+	}
+
+	if bytes.Equal(server.CredentialAt(1), server.CredentialAt(2)) {
+		t.Fatal("credentials of different epochs must differ")
+	}
+
+	other := server.Clone()
+	other.Secret = []byte("another secret")
+	if bytes.Equal(server.Current(), other.Current()) {
+		t.Fatal("credentials derived from different secrets must differ")
+	}
+
+	for _, tc := range []struct {
+		name   string
+		offset time.Duration
+		valid  bool
+	}{
+		{"in sync", 0, true},
+		{"client behind within skew", -30 * time.Second, true},
+		{"client ahead within skew", 30 * time.Second, true},
+		{"client behind beyond skew", -60 * time.Second, false},
+		{"client ahead beyond skew", 60 * time.Second, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			client := server.Clone()
+			client.Now = func() time.Time { return now.Add(tc.offset) }
+
+			if got := server.Verify(client.Current()); got != tc.valid {
+				t.Errorf("Verify() = %v, want %v", got, tc.valid)
+			}
+		})
+	}
+}
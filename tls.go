@@ -0,0 +1,136 @@
+package water
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+)
+
+// TLSConn is a Conn running TLS over a water Conn, i.e., TLS over water:
+// the application data is encrypted by TLS first, and the TLS records are
+// then transformed by the WebAssembly Transport Module. It is created with
+// TLSClient or TLSServer.
+//
+// The methods of the water Conn not moving data, e.g., Stats or Metadata,
+// describe the water Conn, i.e., count the TLS records.
+type TLSConn struct {
+	Conn // the water Conn carrying the TLS records
+
+	tlsConn *tls.Conn
+}
+
+// TLSClient returns a TLSConn running a TLS client over conn, like
+// tls.Client does over a net.Conn. The handshake is done on the first
+// Read or Write, unless Handshake is called first.
+//
+// To run the WATM over TLS instead, see Config.UnderlyingTLS.
+func TLSClient(conn Conn, config *tls.Config) *TLSConn {
+	return &TLSConn{Conn: conn, tlsConn: tls.Client(conn, config)}
+}
+
+// TLSServer returns a TLSConn running a TLS server over conn, like
+// tls.Server does over a net.Conn. The config must hold at least one
+// certificate, or set GetCertificate.
+func TLSServer(conn Conn, config *tls.Config) *TLSConn {
+	return &TLSConn{Conn: conn, tlsConn: tls.Server(conn, config)}
+}
+
+// Read implements net.Conn.
+func (c *TLSConn) Read(b []byte) (int, error) {
+	return c.tlsConn.Read(b)
+}
+
+// Write implements net.Conn.
+func (c *TLSConn) Write(b []byte) (int, error) {
+	return c.tlsConn.Write(b)
+}
+
+// Close implements net.Conn. It sends a close_notify alert before closing
+// the water Conn.
+func (c *TLSConn) Close() error {
+	return c.tlsConn.Close()
+}
+
+// CloseWrite shuts down the writing side of the TLS connection, see
+// tls.Conn.CloseWrite.
+func (c *TLSConn) CloseWrite() error {
+	return c.tlsConn.CloseWrite()
+}
+
+// Handshake runs the TLS handshake, if not yet done, see
+// tls.Conn.Handshake.
+func (c *TLSConn) Handshake() error {
+	return c.tlsConn.Handshake()
+}
+
+// HandshakeContext runs the TLS handshake, if not yet done, see
+// tls.Conn.HandshakeContext.
+func (c *TLSConn) HandshakeContext(ctx context.Context) error {
+	return c.tlsConn.HandshakeContext(ctx)
+}
+
+// ConnectionState returns the details of the TLS connection, see
+// tls.Conn.ConnectionState.
+func (c *TLSConn) ConnectionState() tls.ConnectionState {
+	return c.tlsConn.ConnectionState()
+}
+
+// SyscallConn implements Conn. It returns errors.ErrUnsupported, since the
+// data read from or written to the socket of the water Conn would bypass
+// TLS.
+func (c *TLSConn) SyscallConn() (syscall.RawConn, error) {
+	return nil, errors.ErrUnsupported
+}
+
+// File implements Conn. It returns errors.ErrUnsupported, like
+// SyscallConn.
+func (c *TLSConn) File() (*os.File, error) {
+	return nil, errors.ErrUnsupported
+}
+
+// tlsDialerFunc returns dialerFunc, wrapped to run a TLS client over each
+// connection dialed if UnderlyingTLS is set, unless the UnderlyingProtocol
+// uses it itself.
+func (c *Config) tlsDialerFunc(dialerFunc func(network, address string) (net.Conn, error)) func(network, address string) (net.Conn, error) {
+	if !c.underlyingTLS() {
+		return dialerFunc
+	}
+
+	config := c.UnderlyingTLS
+	return func(network, address string) (net.Conn, error) {
+		tlsConfig := config
+		if tlsConfig.ServerName == "" {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				host = address
+			}
+			tlsConfig = config.Clone()
+			tlsConfig.ServerName = host
+		}
+
+		conn, err := dialerFunc(network, address)
+		if err != nil {
+			return nil, err
+		}
+
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err := tlsConn.Handshake(); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("water: TLS handshake with %s: %w", address, err)
+		}
+		return tlsConn, nil
+	}
+}
+
+// tlsServerConn returns conn, wrapped to run a TLS server over it if
+// UnderlyingTLS is set, unless the UnderlyingProtocol uses it itself.
+func (c *Config) tlsServerConn(conn net.Conn) net.Conn {
+	if !c.underlyingTLS() {
+		return conn
+	}
+	return tls.Server(conn, c.UnderlyingTLS)
+}
@@ -0,0 +1,207 @@
+package water_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/refraction-networking/water"
+	_ "github.com/refraction-networking/water/transport/v1"
+)
+
+// testTLSConfigs returns the configs of a TLS server presenting a
+// self-signed certificate valid for 127.0.0.1, and of a client trusting it.
+func testTLSConfigs(t *testing.T) (server, client *tls.Config) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "water test"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}, MinVersion: tls.VersionTLS13},
+		&tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS13}
+}
+
+func TestTLSClient(t *testing.T) {
+	serverTLS, clientTLS := testTLSConfigs(t)
+	clientTLS.ServerName = "127.0.0.1"
+
+	dialed, accepted, err := water.Pipe(&water.Config{
+		TransportModuleBin:  wasmReverse,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := water.TLSClient(dialed, clientTLS)
+	defer client.Close() // skipcq: GO-S2307
+	server := water.TLSServer(accepted, serverTLS)
+	defer server.Close() // skipcq: GO-S2307
+
+	handshake := make(chan error, 1)
+	go func() { handshake <- server.Handshake() }()
+	if err = client.Handshake(); err != nil {
+		t.Fatal(err)
+	}
+	if err = <-handshake; err != nil {
+		t.Fatal(err)
+	}
+	if !client.ConnectionState().HandshakeComplete {
+		t.Error("ConnectionState() reports the handshake as not complete")
+	}
+
+	// the TLS records go through the reversing WATM both ways, so the
+	// plaintext is received intact
+	msg := []byte("hello over TLS over water")
+	if _, err = client.Write(msg); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, len(msg))
+	if _, err = io.ReadFull(server, buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != string(msg) {
+		t.Errorf("read %q, want %q", buf, msg)
+	}
+
+	if _, err = client.SyscallConn(); err == nil {
+		t.Error("SyscallConn() must fail, bypassing TLS")
+	}
+}
+
+func TestConfig_UnderlyingTLS(t *testing.T) {
+	serverTLS, clientTLS := testTLSConfigs(t)
+	msg := []byte("hello over water over TLS")
+
+	t.Run("dialer", func(t *testing.T) {
+		// the plain WATM leaves the traffic untouched, so a TLS server
+		// receives the plaintext written to the Conn
+		tlsLis, err := tls.Listen("tcp", "127.0.0.1:0", serverTLS)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tlsLis.Close() // skipcq: GO-S2307
+
+		dialer, err := water.NewDialerWithContext(context.Background(), &water.Config{
+			TransportModuleBin:  wasmPlain,
+			ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+			UnderlyingTLS:       clientTLS, // ServerName defaults to 127.0.0.1
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the handshake completes as the Conn is dialed
+		accepted := make(chan net.Conn, 1)
+		go func() {
+			conn, err := tlsLis.Accept()
+			if err == nil {
+				err = conn.(*tls.Conn).Handshake()
+			}
+			if err != nil {
+				t.Error(err)
+				conn = nil
+			}
+			accepted <- conn
+		}()
+
+		conn, err := dialer.DialContext(context.Background(), "tcp", tlsLis.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close() // skipcq: GO-S2307
+
+		peer := <-accepted
+		if peer == nil {
+			t.FailNow()
+		}
+		defer peer.Close() // skipcq: GO-S2307
+
+		if _, err = conn.Write(msg); err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, len(msg))
+		if _, err = io.ReadFull(peer, buf); err != nil {
+			t.Fatal(err)
+		}
+		if string(buf) != string(msg) {
+			t.Errorf("read %q, want %q", buf, msg)
+		}
+	})
+
+	t.Run("listener", func(t *testing.T) {
+		lis, err := (&water.Config{
+			TransportModuleBin:  wasmPlain,
+			ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+			UnderlyingTLS:       serverTLS,
+		}).ListenContext(context.Background(), "tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer lis.Close() // skipcq: GO-S2307
+
+		// the handshake completes as the WATM reads from the connection
+		// accepted
+		clientTLS := clientTLS.Clone()
+		clientTLS.ServerName = "127.0.0.1"
+		dialed := make(chan net.Conn, 1)
+		go func() {
+			peer, err := tls.Dial("tcp", lis.Addr().String(), clientTLS)
+			if err == nil {
+				_, err = peer.Write(msg)
+			}
+			if err != nil {
+				t.Error(err)
+				dialed <- nil
+				return
+			}
+			dialed <- peer
+		}()
+
+		conn, err := lis.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close() // skipcq: GO-S2307
+
+		if peer := <-dialed; peer != nil {
+			defer peer.Close() // skipcq: GO-S2307
+		}
+
+		buf := make([]byte, len(msg))
+		if _, err = io.ReadFull(conn, buf); err != nil {
+			t.Fatal(err)
+		}
+		if string(buf) != string(msg) {
+			t.Errorf("read %q, want %q", buf, msg)
+		}
+	})
+}
@@ -0,0 +1,16 @@
+// Package all registers the drivers of every WebAssembly Transport Module
+// (WATM) version supported by WATER, so that the version of any WATM is
+// detected automatically from its exports (or negotiated, see
+// water.NegotiateVersion) without knowing which version it implements:
+//
+//	import _ "github.com/refraction-networking/water/transport/all"
+//
+// Importing it links in every driver. Applications using WATMs of known
+// versions may import only the drivers of those versions instead, e.g.,
+// `transport/v1`, to keep their binaries smaller.
+package all
+
+import (
+	_ "github.com/refraction-networking/water/transport/v0" // register v0 WATMs
+	_ "github.com/refraction-networking/water/transport/v1" // register v1 WATMs
+)
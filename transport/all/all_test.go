@@ -0,0 +1,37 @@
+package all_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/refraction-networking/water"
+	_ "github.com/refraction-networking/water/transport/all"
+)
+
+func TestAll(t *testing.T) {
+	for _, version := range []string{"v0", "v1"} {
+		version := version
+		t.Run(version, func(t *testing.T) {
+			wasm, err := os.ReadFile("../" + version + "/testdata/plain.wasm")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got, err := water.NegotiateVersion(wasm); err != nil || got != version {
+				t.Fatalf("NegotiateVersion() = %q, %v, want %q", got, err, version)
+			}
+
+			dialer, err := water.NewDialerWithContext(context.Background(), &water.Config{
+				TransportModuleBin:  wasm,
+				ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if dialer == nil {
+				t.Fatal("NewDialerWithContext returned a nil Dialer")
+			}
+		})
+	}
+}
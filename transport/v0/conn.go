@@ -5,16 +5,34 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"os"
 	"sync"
 	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/refraction-networking/water"
+	"github.com/refraction-networking/water/internal/driver"
+	"github.com/refraction-networking/water/internal/idle"
 	"github.com/refraction-networking/water/internal/log"
 	"github.com/refraction-networking/water/internal/socket"
 )
 
 // Conn is the first experimental version of Conn implementation.
+//
+// Like any net.Conn, a Conn is safe for concurrent use: Read and Write may
+// be called simultaneously from different goroutines, including when the
+// Conn is used full-duplex. The data path never enters the WebAssembly
+// instance on the caller's goroutine, instead Read and Write operate on
+// the two directions of the callerConn, a socket pair whose other end is
+// driven by the worker thread of the WATM. Close may be called at any
+// time to unblock pending Read and Write calls.
+//
+// Read and Write do not allocate on the host side once the Conn is
+// established, while Writev allocates once per call for the buffers handed
+// to the socket. Any other allocations observed per call in profiles of
+// the data path come from the WASI socket implementation of the runtime
+// serving the worker thread of the WATM.
 type Conn struct {
 	// callerConn is used by DialV0() and AcceptV0(). It is used to talk to
 	// the caller of water API by allowing the caller to Read() and Write() to it.
@@ -33,6 +51,11 @@ type Conn struct {
 
 	closeOnce sync.Once
 	closed    atomic.Bool
+	onClose   func()      // called once the Conn is closed, if set. Protected by tmMutex.
+	idle      *idle.Timer // closes the Conn once idle, if the IdleTimeout is set
+
+	stats          driver.ConnStatsRecorder // the data read from and written to the Conn, for Stats
+	peakMemorySize atomic.Uint64            // the largest memory size observed, for RuntimeStats
 
 	water.UnimplementedConn // embedded to ensure forward compatibility
 }
@@ -40,13 +63,32 @@ type Conn struct {
 // dial dials the network address using through the WASM module
 // while using the dialerFunc specified in core.config.
 func dial(core water.Core, network, address string) (c water.Conn, err error) {
+	return dialWith(core, NewManagedDialer(network, address, core.Config().NetworkDialerFuncWithContext(core.Context())))
+}
+
+// dialWithConn runs the WASM module as a dialer over an existing connection
+// instead of dialing a new one.
+func dialWithConn(core water.Core, existingConn net.Conn) (c water.Conn, err error) {
+	var used atomic.Bool
+	dialer := NewManagedDialer(existingConn.RemoteAddr().Network(), existingConn.RemoteAddr().String(), func(_, _ string) (net.Conn, error) {
+		if !used.CompareAndSwap(false, true) {
+			return nil, errors.New("water: existing connection is already in use")
+		}
+		return existingConn, nil
+	})
+
+	return dialWith(core, dialer)
+}
+
+// dialWith drives the WASM module as a dialer using the given ManagedDialer
+// to establish the connection to the remote destination.
+func dialWith(core water.Core, dialer *ManagedDialer) (c water.Conn, err error) {
 	tm := UpgradeCore(core)
 	conn := &Conn{
-		tm: tm,
+		tm:   tm,
+		idle: idle.NewTimer(core.Config().IdleTimeout),
 	}
 
-	dialer := NewManagedDialer(network, address, core.Config().NetworkDialerFuncOrDefault())
-
 	if err = conn.tm.LinkNetworkInterface(dialer, nil); err != nil {
 		return nil, err
 	}
@@ -66,6 +108,12 @@ func dial(core water.Core, network, address string) (c water.Conn, err error) {
 	}
 	conn.callerConn = callerConn
 
+	if err = core.Config().ApplyBufferSizes(callerConn, reverseCallerConn); err != nil {
+		callerConn.Close()
+		reverseCallerConn.Close()
+		return nil, err
+	}
+
 	conn.dstConn, err = conn.tm.DialFrom(reverseCallerConn)
 	if err != nil {
 		return nil, err
@@ -74,24 +122,27 @@ func dial(core water.Core, network, address string) (c water.Conn, err error) {
 	// safety: we need to watch for the blocking worker thread's status.
 	// If it returns, no further data can be processed by the WASM module
 	// and we need to close this connection in that case.
-	go conn.closeOnWorkerError()
+	conn.tm.OnWorkerExit(conn.closeOnWorkerError)
 
 	if err := conn.tm.Worker(); err != nil {
 		return nil, err
 	}
 
+	conn.startIdleTimer(core.Config())
+
 	return conn, nil
 }
 
 // accept accepts the network connection using through the WASM module
 // while using the net.Listener specified in core.config.
-func accept(core water.Core) (c water.Conn, err error) {
+func accept(core water.Core, listener net.Listener) (c water.Conn, err error) {
 	tm := UpgradeCore(core)
 	conn := &Conn{
-		tm: tm,
+		tm:   tm,
+		idle: idle.NewTimer(core.Config().IdleTimeout),
 	}
 
-	if err = conn.tm.LinkNetworkInterface(nil, core.Config().NetworkListenerOrPanic()); err != nil {
+	if err = conn.tm.LinkNetworkInterface(nil, listener); err != nil {
 		return nil, err
 	}
 
@@ -112,6 +163,12 @@ func accept(core water.Core) (c water.Conn, err error) {
 
 	conn.callerConn = callerConn
 
+	if err = core.Config().ApplyBufferSizes(callerConn, reverseCallerConn); err != nil {
+		callerConn.Close()
+		reverseCallerConn.Close()
+		return nil, err
+	}
+
 	conn.srcConn, err = conn.tm.AcceptFor(reverseCallerConn)
 	if err != nil {
 		return nil, err
@@ -120,24 +177,30 @@ func accept(core water.Core) (c water.Conn, err error) {
 	// safety: we need to watch for the blocking worker thread's status.
 	// If it returns, no further data can be processed by the WASM module
 	// and we need to close this connection in that case.
-	go conn.closeOnWorkerError()
+	conn.tm.OnWorkerExit(conn.closeOnWorkerError)
 
 	if err := conn.tm.Worker(); err != nil {
 		return nil, err
 	}
 
+	conn.startIdleTimer(core.Config())
+
 	return conn, nil
 }
 
-func relay(core water.Core, network, address string) (c water.Conn, err error) {
+func relay(core water.Core, inbound net.Conn, network, address string) (c water.Conn, err error) {
 	tm := UpgradeCore(core)
 	conn := &Conn{
-		tm: tm,
+		tm:   tm,
+		idle: idle.NewTimer(core.Config().IdleTimeout),
 	}
 
-	dialer := NewManagedDialer(network, address, core.Config().NetworkDialerFuncOrDefault())
+	inbound, dialerFunc := driver.RelayConnsFor(core.Config(), inbound)
+	inbound, dialerFunc = conn.idle.TrackConn(inbound), conn.idle.TrackDialerFunc(dialerFunc)
+	dialer := NewManagedDialer(network, address, dialerFunc)
+	listener := socket.NewSingleConnListener(inbound, core.Config().NetworkListener.Addr())
 
-	if err = conn.tm.LinkNetworkInterface(dialer, core.Config().NetworkListenerOrPanic()); err != nil {
+	if err = conn.tm.LinkNetworkInterface(dialer, listener); err != nil {
 		return nil, err
 	}
 
@@ -152,12 +215,14 @@ func relay(core water.Core, network, address string) (c water.Conn, err error) {
 	// safety: we need to watch for the blocking worker thread's status.
 	// If it returns, no further data can be processed by the WASM module
 	// and we need to close this connection in that case.
-	go conn.closeOnWorkerError()
+	conn.tm.OnWorkerExit(conn.closeOnWorkerError)
 
 	if err := conn.tm.Worker(); err != nil {
 		return nil, err
 	}
 
+	conn.startIdleTimer(core.Config())
+
 	return conn, nil
 }
 
@@ -172,20 +237,44 @@ func (c *Conn) closeOnWorkerError() {
 	}
 	c.tmMutex.Unlock()
 
+	if tm == nil { // the worker thread exited as the Conn was closed
+		return
+	}
+
 	<-tm.WorkerErrored()
 	log.LDebugf(core.Logger(), "water: WATMv0: worker thread returned")
 	c.Close()
 }
 
+// startIdleTimer makes the Conn close itself once no activity is observed
+// for the IdleTimeout, if set.
+func (c *Conn) startIdleTimer(config *water.Config) {
+	c.idle.Start(func() {
+		log.LDebugf(config.Logger(), "water: WATMv0: closing Conn idle for %v", config.IdleTimeout)
+		c.Close()
+		if config.OnIdleTimeout != nil {
+			config.OnIdleTimeout(c)
+		}
+	})
+}
+
 // Read implements the net.Conn interface.
 //
 // It calls to the underlying user-oriented connection's [net.Conn.Read] method.
+// As the data from the WATM is buffered by that stream connection, b may be
+// of any size: bytes not fitting in b are returned by the subsequent calls,
+// so that, e.g., [io.ReadFull] works regardless of the framing of the WATM.
 func (c *Conn) Read(b []byte) (n int, err error) {
 	if c.callerConn == nil {
 		return 0, errors.New("water: cannot read, (*RuntimeConn).uoConn is nil")
 	}
 
-	return c.callerConn.Read(b)
+	n, err = c.callerConn.Read(b)
+	if n > 0 {
+		c.idle.Touch()
+		c.stats.RecordRead(int64(n))
+	}
+	return n, err
 }
 
 // Write implements the net.Conn interface.
@@ -197,6 +286,10 @@ func (c *Conn) Write(b []byte) (n int, err error) {
 	}
 
 	n, err = c.callerConn.Write(b)
+	if n > 0 {
+		c.idle.Touch()
+		c.stats.RecordWrite(int64(n))
+	}
 	if err != nil {
 		return n, fmt.Errorf("uoConn.Write: %w", err)
 	}
@@ -210,6 +303,81 @@ func (c *Conn) Write(b []byte) (n int, err error) {
 	}
 }
 
+// Writev writes the buffers to the WATM, in a single writev(2) system call
+// where supported, instead of one boundary crossing per buffer. It is
+// useful for applications writing, e.g., headers and body separately.
+func (c *Conn) Writev(buffers net.Buffers) (n int64, err error) {
+	if c.callerConn == nil {
+		return 0, errors.New("water: cannot write, (*RuntimeConn).uoConn is nil")
+	}
+
+	n, err = buffers.WriteTo(c.callerConn)
+	if n > 0 {
+		c.idle.Touch()
+		c.stats.RecordWrite(n)
+	}
+	if err != nil {
+		return n, fmt.Errorf("uoConn.Writev: %w", err)
+	}
+	return n, nil
+}
+
+// ReadFrom implements the io.ReaderFrom interface.
+//
+// It calls to the underlying user-oriented connection's ReadFrom method if
+// available, which may move the data with splice(2) or sendfile(2)
+// without copying it through the user space of the host.
+func (c *Conn) ReadFrom(r io.Reader) (n int64, err error) {
+	if c.callerConn == nil {
+		return 0, errors.New("water: cannot write, (*RuntimeConn).uoConn is nil")
+	}
+
+	n, err = io.Copy(c.callerConn, c.idle.TrackReader(r))
+	c.stats.RecordWrite(n)
+	if err != nil {
+		return n, fmt.Errorf("uoConn.ReadFrom: %w", err)
+	}
+	return n, nil
+}
+
+// WriteTo implements the io.WriterTo interface.
+//
+// It copies the data from the underlying user-oriented connection to w
+// with the ReadFrom method of w if available, e.g., that of a
+// *net.TCPConn, which may move the data with splice(2) without copying
+// it through the user space of the host.
+func (c *Conn) WriteTo(w io.Writer) (n int64, err error) {
+	if c.callerConn == nil {
+		return 0, errors.New("water: cannot read, (*RuntimeConn).uoConn is nil")
+	}
+
+	n, err = io.Copy(w, c.idle.TrackReader(c.callerConn))
+	c.stats.RecordRead(n)
+	if err != nil {
+		return n, fmt.Errorf("uoConn.WriteTo: %w", err)
+	}
+	return n, nil
+}
+
+// CloseRead shuts down the reading side of the connection, so no more
+// data from the WATM will be read.
+func (c *Conn) CloseRead() error {
+	if cr, ok := c.callerConn.(interface{ CloseRead() error }); ok {
+		return cr.CloseRead()
+	}
+	return errors.ErrUnsupported
+}
+
+// CloseWrite shuts down the writing side of the connection, so the WATM
+// reads EOF once it has read all data written before. Whether the
+// half-close is propagated to the remote depends on the WATM.
+func (c *Conn) CloseWrite() error {
+	if cw, ok := c.callerConn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return errors.ErrUnsupported
+}
+
 // Close implements the net.Conn interface.
 //
 // It will close both the network connection AND the WASM module, then
@@ -221,12 +389,30 @@ func (c *Conn) Close() (err error) {
 	}
 
 	c.closeOnce.Do(func() {
+		c.idle.Stop()
+
 		c.tmMutex.Lock()
 		if c.tm != nil {
+			core := c.tm.Core()
 			err = c.tm.Close()
 			c.tm = nil
+
+			// the memory is inspected once the worker thread has exited
+			if core != nil {
+				c.recordPeakMemorySize(core.MemorySize())
+			}
 		}
+		onClose := c.onClose
 		c.tmMutex.Unlock()
+
+		// callerConn is owned by the Conn and not managed by the WATM
+		if c.callerConn != nil {
+			c.callerConn.Close()
+		}
+
+		if onClose != nil {
+			onClose()
+		}
 	})
 
 	return err
@@ -258,6 +444,43 @@ func (c *Conn) RemoteAddr() net.Addr {
 	return c.dstConn.RemoteAddr() // for dialer
 }
 
+// NetConn implements [water.Conn].
+//
+// For Listener and Relay, the network connection returned is the srcConn.
+// And for Dialer, the network connection returned is the dstConn.
+func (c *Conn) NetConn() net.Conn {
+	// for Listener and Relay, the srcConn is of interest
+	if c.srcConn != nil {
+		return c.srcConn
+	}
+	return c.dstConn // for dialer
+}
+
+// NetConns implements [water.Conn]. A v0 WATM has a single network
+// connection, the one returned by NetConn.
+func (c *Conn) NetConns() []net.Conn {
+	if netConn := c.NetConn(); netConn != nil {
+		return []net.Conn{netConn}
+	}
+	return nil
+}
+
+// SyscallConn implements [water.Conn].
+//
+// For Dialer and Listener, the raw connection returned is the one of the
+// callerConn. For Relay, there is none.
+func (c *Conn) SyscallConn() (syscall.RawConn, error) {
+	return socket.SyscallConn(c.callerConn)
+}
+
+// File implements [water.Conn].
+//
+// For Dialer and Listener, the file returned is a copy of the callerConn.
+// For Relay, there is none.
+func (c *Conn) File() (*os.File, error) {
+	return socket.File(c.callerConn)
+}
+
 // SetDeadline implements the net.Conn interface.
 //
 // It calls to the underlying connections' [net.Conn.SetDeadline] method.
@@ -310,3 +533,45 @@ func (c *Conn) SetWriteDeadline(t time.Time) error {
 
 	return c.callerConn.SetWriteDeadline(t)
 }
+
+// Stats returns a snapshot of the data read from and written to the Conn.
+//
+// Implements [water.Conn].
+func (c *Conn) Stats() water.ConnStats {
+	return c.stats.Stats()
+}
+
+// RuntimeStats returns a snapshot of the resources used by the WebAssembly
+// instance behind the Conn.
+//
+// Implements [water.Conn].
+func (c *Conn) RuntimeStats() water.RuntimeStats {
+	var stats water.RuntimeStats
+
+	c.tmMutex.Lock()
+	if c.tm != nil {
+		stats = c.tm.RuntimeStats()
+	}
+	c.tmMutex.Unlock()
+
+	c.recordPeakMemorySize(stats.MemorySize)
+	stats.PeakMemorySize = c.peakMemorySize.Load()
+
+	if callerConn, ok := c.callerConn.(*net.TCPConn); ok && !c.closed.Load() {
+		if read, write, err := socket.BufferSizes(callerConn); err == nil {
+			stats.ReadBufferSize, stats.WriteBufferSize = read, write
+			stats.HostBufferSize += read + write
+		}
+	}
+
+	return stats
+}
+
+func (c *Conn) recordPeakMemorySize(size uint64) {
+	for {
+		peak := c.peakMemorySize.Load()
+		if size <= peak || c.peakMemorySize.CompareAndSwap(peak, size) {
+			return
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package v0
+
+import (
+	"io"
+	"testing"
+
+	"github.com/refraction-networking/water/internal/socket"
+)
+
+// TestConn_Allocs checks that Read and Write do not allocate on the host
+// side. The Conn is not served by a WATM, whose worker thread would
+// allocate in the WASI socket implementation of the runtime.
+func TestConn_Allocs(t *testing.T) {
+	peerConn, callerConn, err := socket.TCPConnPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peerConn.Close() // skipcq: GO-S2307
+
+	conn := &Conn{callerConn: callerConn}
+	defer callerConn.Close() // skipcq: GO-S2307
+
+	msg, peerBuf := make([]byte, 64), make([]byte, 64)
+	for _, tc := range []struct {
+		name string
+		f    func() error
+	}{
+		{"Write", func() error {
+			if _, err := conn.Write(msg); err != nil {
+				return err
+			}
+			_, err := io.ReadFull(peerConn, peerBuf)
+			return err
+		}},
+		{"Read", func() error {
+			if _, err := peerConn.Write(peerBuf); err != nil {
+				return err
+			}
+			_, err := io.ReadFull(conn, msg)
+			return err
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var err error
+			allocs := testing.AllocsPerRun(100, func() {
+				if e := tc.f(); e != nil && err == nil {
+					err = e
+				}
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if allocs != 0 {
+				t.Errorf("%s allocates %v times per call, want 0", tc.name, allocs)
+			}
+		})
+	}
+}
@@ -3,8 +3,10 @@ package v0
 import (
 	"context"
 	"fmt"
+	"net"
 
 	"github.com/refraction-networking/water"
+	"github.com/refraction-networking/water/internal/driver"
 )
 
 func init() {
@@ -34,8 +36,13 @@ func NewDialer(c *water.Config) (water.Dialer, error) {
 //
 // The context is used as the default context for call to [Dialer.Dial].
 func NewDialerWithContext(ctx context.Context, c *water.Config) (water.Dialer, error) {
+	config, err := driver.Snapshot(c)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Dialer{
-		config: c.Clone(),
+		config: config,
 		ctx:    ctx,
 	}, nil
 }
@@ -48,6 +55,8 @@ func (d *Dialer) Dial(network, address string) (conn water.Conn, err error) {
 }
 
 // DialContext dials the network address using the dialerFunc specified in config.
+// A *water.TransportTypeMismatchError is returned if the network does not
+// match the transport type declared by the WATM, see [water.Config.CheckNetwork].
 //
 // The context is passed to [water.NewCoreWithContext] to control the lifetime of
 // the call to function calls into the WebAssembly module.
@@ -62,22 +71,82 @@ func (d *Dialer) DialContext(ctx context.Context, network, address string) (conn
 		return nil, fmt.Errorf("water: dialing with nil config is not allowed")
 	}
 
+	if err := d.config.CheckNetwork(network); err != nil {
+		return nil, err
+	}
+
+	// the results of the dial are not returned directly, as the dial
+	// may still complete after returning once ctx is done
+	var dialConn water.Conn
+	var dialErr error
 	ctxReady, dialReady := context.WithCancel(context.Background())
 	go func() {
 		defer dialReady()
 		var core water.Core
-		core, err = water.NewCoreWithContext(ctx, d.config)
-		if err != nil {
+		core, dialErr = water.NewCoreWithContext(ctx, d.config)
+		if dialErr != nil {
 			return
 		}
 
-		conn, err = dial(core, network, address)
+		dialConn, dialErr = dial(core, network, address)
 	}()
 
 	select {
 	case <-ctx.Done():
 		return nil, ctx.Err()
 	case <-ctxReady.Done():
-		return conn, err
+		return dialConn, dialErr
+	}
+}
+
+// DialWithConn runs the WASM module over an existing connection instead of
+// dialing a new one. The returned Conn takes the ownership of existingConn,
+// which is closed if an error is returned.
+//
+// Implements [water.Dialer].
+func (d *Dialer) DialWithConn(ctx context.Context, existingConn net.Conn) (conn water.Conn, err error) {
+	if existingConn == nil {
+		return nil, fmt.Errorf("water: dialing with nil connection is not allowed")
+	}
+
+	if d.config == nil {
+		existingConn.Close()
+		return nil, fmt.Errorf("water: dialing with nil config is not allowed")
+	}
+
+	type dialResult struct {
+		conn water.Conn
+		err  error
+	}
+
+	results := make(chan dialResult, 1)
+	go func() {
+		core, err := water.NewCoreWithContext(ctx, d.config)
+		if err != nil {
+			existingConn.Close()
+			results <- dialResult{nil, err}
+			return
+		}
+
+		conn, err := dialWithConn(core, existingConn)
+		if err != nil {
+			existingConn.Close()
+		}
+		results <- dialResult{conn, err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		// the dial may still complete after returning, in which case the
+		// Conn nobody receives is closed along with existingConn
+		existingConn.Close()
+		go func() {
+			if res := <-results; res.conn != nil {
+				res.conn.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	case res := <-results:
+		return res.conn, res.err
 	}
 }
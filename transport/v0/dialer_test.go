@@ -4,8 +4,11 @@ import (
 	"bytes"
 	"context"
 	"crypto/rand"
+	"errors"
 	"fmt"
+	"io"
 	"net"
+	"sync"
 	"testing"
 	"time"
 
@@ -74,11 +77,327 @@ func ExampleDialer() {
 //  3. Dialer must fail when an invalid address is supplied.
 //  4. Dialer must fail when a WebAssembly Transport Module does not
 //     fully implement the v0 dialer spec.
+//  5. Conn must not corrupt data when Read and Write are called
+//     simultaneously from different goroutines.
 func TestDialer(t *testing.T) {
 	t.Run("plain must work", testDialerPlain)
 	t.Run("reverse must work", testDialerReverse)
 	t.Run("bad addr must fail", testDialerBadAddr)
 	t.Run("partial WATM must fail", testDialerPartialWATM)
+	t.Run("existing conn must be closed if the Core fails", testDialerWithConnCoreError)
+	t.Run("existing conn must be closed once the context is done", testDialerWithConnContextDone)
+	t.Run("full duplex must work", testDialerFullDuplex)
+	t.Run("short reads must not lose data", testDialerShortReads)
+	t.Run("vectored writes must work", testDialerWritev)
+	t.Run("WriteTo must copy from the WATM", testDialerWriteTo)
+}
+
+func testDialerFullDuplex(t *testing.T) {
+	tcpLis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcpLis.Close() // skipcq: GO-S2307
+
+	config := &water.Config{
+		TransportModuleBin:  wasmPlain,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+	}
+	dialer, err := v0.NewDialerWithContext(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := dialer.DialContext(context.Background(), "tcp", tcpLis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close() // skipcq: GO-S2307
+
+	peerConn, err := tcpLis.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peerConn.Close() // skipcq: GO-S2307
+
+	const size = 4 << 20
+	waterSent, peerSent := make([]byte, size), make([]byte, size)
+	if _, err := rand.Read(waterSent); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rand.Read(peerSent); err != nil {
+		t.Fatal(err)
+	}
+
+	// each of the 4 goroutines reads or writes in small chunks, so the
+	// Reads and Writes on each Conn are interleaved.
+	//
+	// The chunks in flight in each direction are bounded, as the worker of
+	// plain.wasm fails with EIO (io.ErrShortWrite) once a write to its
+	// non-blocking socket is short, which happens whenever the send buffer
+	// of the socket fills up.
+	const chunkSize, chunksInFlight = 1500, 8
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	failed, failOnce := make(chan struct{}), sync.Once{} // failed is closed once a reader fails, unblocking the writers
+	write := func(c net.Conn, data []byte, window chan struct{}) {
+		defer wg.Done()
+		for len(data) > 0 {
+			select {
+			case window <- struct{}{}:
+			case <-failed:
+				return
+			}
+			n := chunkSize
+			if len(data) < n {
+				n = len(data)
+			}
+			if _, err := c.Write(data[:n]); err != nil {
+				errs <- err
+				return
+			}
+			data = data[n:]
+		}
+	}
+	read := func(c net.Conn, expected []byte, window chan struct{}) {
+		defer wg.Done()
+		received := make([]byte, len(expected))
+		for off := 0; off < len(received); {
+			n := chunkSize
+			if len(received)-off < n {
+				n = len(received) - off
+			}
+			if _, err := io.ReadFull(c, received[off:off+n]); err != nil {
+				errs <- err
+				failOnce.Do(func() { close(failed) })
+				return
+			}
+			off += n
+			<-window
+		}
+		if !bytes.Equal(received, expected) {
+			errs <- fmt.Errorf("data corrupted in %s -> %s", c.RemoteAddr(), c.LocalAddr())
+		}
+	}
+
+	if err := conn.SetDeadline(time.Now().Add(30 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if err := peerConn.SetDeadline(time.Now().Add(30 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	upstream, downstream := make(chan struct{}, chunksInFlight), make(chan struct{}, chunksInFlight)
+	wg.Add(4)
+	go write(conn, waterSent, upstream)
+	go read(peerConn, waterSent, upstream)
+	go write(peerConn, peerSent, downstream)
+	go read(conn, peerSent, downstream)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func testDialerShortReads(t *testing.T) {
+	tcpLis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcpLis.Close() // skipcq: GO-S2307
+
+	config := &water.Config{
+		TransportModuleBin:  wasmPlain,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+	}
+	dialer, err := v0.NewDialerWithContext(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := dialer.DialContext(context.Background(), "tcp", tcpLis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close() // skipcq: GO-S2307
+
+	peerConn, err := tcpLis.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peerConn.Close() // skipcq: GO-S2307
+
+	if err := conn.SetDeadline(time.Now().Add(10 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	// a frame much larger than the buffer of the caller, written at once
+	frame := make([]byte, 64<<10)
+	if _, err := rand.Read(frame); err != nil {
+		t.Fatal(err)
+	}
+	go peerConn.Write(frame) // nolint:errcheck
+
+	// bytes left over by each short Read must be returned by the next ones
+	received := make([]byte, 0, len(frame))
+	buf := make([]byte, 7)
+	for len(received) < len(frame) {
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		received = append(received, buf[:n]...)
+	}
+	if !bytes.Equal(received, frame) {
+		t.Fatal("data corrupted")
+	}
+}
+
+func testDialerWritev(t *testing.T) {
+	tcpLis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcpLis.Close() // skipcq: GO-S2307
+
+	config := &water.Config{
+		TransportModuleBin:  wasmPlain,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+	}
+	dialer, err := v0.NewDialerWithContext(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := dialer.DialContext(context.Background(), "tcp", tcpLis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close() // skipcq: GO-S2307
+
+	peerConn, err := tcpLis.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peerConn.Close() // skipcq: GO-S2307
+
+	if err := peerConn.SetDeadline(time.Now().Add(10 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	vectoredConn, ok := conn.(interface {
+		Writev(net.Buffers) (int64, error)
+		io.ReaderFrom
+	})
+	if !ok {
+		t.Fatalf("%T does not implement Writev and io.ReaderFrom", conn)
+	}
+
+	header, body, trailer := []byte("header\r\n"), []byte("body"), []byte("trailer")
+	if n, err := vectoredConn.Writev(net.Buffers{header, body}); err != nil || n != int64(len(header)+len(body)) {
+		t.Fatalf("Writev() = %d, %v", n, err)
+	}
+	if n, err := vectoredConn.ReadFrom(bytes.NewReader(trailer)); err != nil || n != int64(len(trailer)) {
+		t.Fatalf("ReadFrom() = %d, %v", n, err)
+	}
+
+	expected := bytes.Join([][]byte{header, body, trailer}, nil)
+	received := make([]byte, len(expected))
+	if _, err := io.ReadFull(peerConn, received); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(received, expected) {
+		t.Fatalf("received %q, want %q", received, expected)
+	}
+}
+
+func testDialerWriteTo(t *testing.T) {
+	tcpLis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcpLis.Close() // skipcq: GO-S2307
+
+	config := &water.Config{
+		TransportModuleBin:  wasmPlain,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+	}
+	dialer, err := v0.NewDialerWithContext(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := dialer.DialContext(context.Background(), "tcp", tcpLis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close() // skipcq: GO-S2307
+
+	peerConn, err := tcpLis.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peerConn.Close() // skipcq: GO-S2307
+
+	// the data read from the WATM is copied to a TCP connection
+	sinkConn, err := net.Dial("tcp", tcpLis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sinkConn.Close() // skipcq: GO-S2307
+
+	sinkPeerConn, err := tcpLis.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sinkPeerConn.Close() // skipcq: GO-S2307
+
+	writerTo, ok := conn.(io.WriterTo)
+	if !ok {
+		t.Fatalf("%T does not implement io.WriterTo", conn)
+	}
+	type result struct {
+		n   int64
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		n, err := writerTo.WriteTo(sinkConn)
+		done <- result{n, err}
+	}()
+
+	msg := []byte("hello world")
+	if _, err := peerConn.Write(msg); err != nil {
+		t.Fatal(err)
+	}
+	if err := sinkPeerConn.SetReadDeadline(time.Now().Add(10 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	received := make([]byte, len(msg))
+	if _, err := io.ReadFull(sinkPeerConn, received); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(received, msg) {
+		t.Fatalf("received %q, want %q", received, msg)
+	}
+
+	// WriteTo returns once the Conn is closed
+	if err := conn.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case res := <-done:
+		if res.n != int64(len(msg)) {
+			t.Errorf("WriteTo() = %d, want %d", res.n, len(msg))
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("WriteTo() did not return once the Conn is closed")
+	}
+	if stats := conn.Stats(); stats.BytesRead != uint64(len(msg)) {
+		t.Errorf("Stats().BytesRead = %d, want %d", stats.BytesRead, len(msg))
+	}
 }
 
 func testDialerBadAddr(t *testing.T) {
@@ -365,6 +684,65 @@ func testDialerPartialWATM(t *testing.T) {
 	t.Skip("skipping [testDialerPartialWATM]...") // TODO: implement this with a few WebAssembly Transport Modules which partially implement the v0 dialer spec
 }
 
+func testDialerWithConnCoreError(t *testing.T) {
+	config := &water.Config{
+		TransportModuleBin:  []byte("not a WATM"),
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+	}
+
+	dialer, err := v0.NewDialerWithContext(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	existingConn, peerConn := net.Pipe()
+	defer peerConn.Close() // skipcq: GO-S2307
+
+	if conn, err := dialer.DialWithConn(context.Background(), existingConn); err == nil {
+		conn.Close()
+		t.Fatal("DialWithConn must fail with an invalid WATM")
+	}
+
+	peerConn.SetReadDeadline(time.Now().Add(time.Second)) // nolint: errcheck
+	if _, err := peerConn.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+		t.Errorf("peerConn.Read() error = %v, want %v as existingConn must be closed", err, io.EOF)
+	}
+}
+
+func testDialerWithConnContextDone(t *testing.T) {
+	config := &water.Config{
+		TransportModuleBin:   wasmDialSlow,
+		ModuleConfigFactory:  water.NewWazeroModuleConfigFactory(),
+		RuntimeConfigFactory: water.NewWazeroRuntimeConfigFactory(),
+	}
+	// the dial is not interrupted, but completes after DialWithConn
+	// returns, and the Conn nobody receives must be closed then
+	config.RuntimeConfigFactory.SetCloseOnContextDone(false)
+
+	dialer, err := v0.NewDialerWithContext(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	existingConn, peerConn := net.Pipe()
+	defer peerConn.Close() // skipcq: GO-S2307
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if conn, err := dialer.DialWithConn(ctx, existingConn); !errors.Is(err, context.DeadlineExceeded) {
+		if conn != nil {
+			conn.Close()
+		}
+		t.Fatalf("DialWithConn() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	peerConn.SetReadDeadline(time.Now().Add(time.Second)) // nolint: errcheck
+	if _, err := peerConn.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+		t.Errorf("peerConn.Read() error = %v, want %v as existingConn must be closed", err, io.EOF)
+	}
+}
+
 // BenchmarkDialerOutbound currently measures only the outbound throughput
 // of the dialer. Inbound throughput is measured for the listener instead.
 //
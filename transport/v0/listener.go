@@ -4,9 +4,13 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/refraction-networking/water"
+	"github.com/refraction-networking/water/internal/driver"
+	"github.com/refraction-networking/water/internal/socket"
 )
 
 func init() {
@@ -18,9 +22,22 @@ func init() {
 
 // Listener implements water.Listener utilizing Water WATM API v0.
 type Listener struct {
-	config *water.Config
-	closed *atomic.Bool
-	ctx    context.Context
+	config      *water.Config
+	configMutex sync.RWMutex // protects config, which may be updated by UpdateConfig
+	closed      *atomic.Bool
+	ctx         context.Context
+
+	conns      map[*Conn]struct{} // established connections, for Shutdown
+	connsWg    sync.WaitGroup     // counts the conns
+	connsMutex sync.Mutex         // protects conns and shutdown, and orders connsWg.Add before Wait
+	shutdown   bool               // set once Shutdown is called, no conn is tracked afterwards
+
+	done            chan struct{} // closed once the Listener is closed
+	connections     <-chan water.AcceptResult
+	connectionsOnce sync.Once
+
+	handshakes     <-chan water.AcceptResult // if the HandshakeConcurrency is set
+	handshakesOnce sync.Once
 
 	water.UnimplementedListener // embedded to ensure forward compatibility
 }
@@ -29,9 +46,15 @@ type Listener struct {
 //
 // Deprecated: use [NewListenerWithContext] instead.
 func NewListener(c *water.Config) (water.Listener, error) {
+	config, err := driver.Snapshot(c)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Listener{
-		config: c.Clone(),
+		config: config,
 		closed: new(atomic.Bool),
+		done:   make(chan struct{}),
 	}, nil
 }
 
@@ -45,9 +68,15 @@ func NewListener(c *water.Config) (water.Listener, error) {
 // Call [water.WazeroRuntimeConfigFactory.SetCloseOnContextDone] with false to
 // disable this behavior.
 func NewListenerWithContext(ctx context.Context, c *water.Config) (water.Listener, error) {
+	config, err := driver.Snapshot(c)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Listener{
-		config: c.Clone(),
+		config: config,
 		closed: new(atomic.Bool),
+		done:   make(chan struct{}),
 		ctx:    ctx,
 	}, nil
 }
@@ -69,7 +98,10 @@ func (l *Listener) Accept() (net.Conn, error) {
 // Implements [net.Listener].
 func (l *Listener) Close() error {
 	if l.closed.CompareAndSwap(false, true) {
-		return l.config.NetworkListener.Close()
+		if l.done != nil {
+			close(l.done)
+		}
+		return l.loadConfig().NetworkListener.Close()
 	}
 	return nil
 }
@@ -78,7 +110,7 @@ func (l *Listener) Close() error {
 //
 // Implements [net.Listener].
 func (l *Listener) Addr() net.Addr {
-	return l.config.NetworkListener.Addr()
+	return l.loadConfig().NetworkListener.Addr()
 }
 
 // AcceptWATER waits for and returns the next connection to the listener
@@ -86,20 +118,236 @@ func (l *Listener) Addr() net.Addr {
 //
 // Implements [water.Listener].
 func (l *Listener) AcceptWATER() (water.Conn, error) {
+	res := l.accept()
+	return res.Conn, res.Err
+}
+
+// Connections returns a channel delivering the result of accepting each
+// incoming connection, which is closed once the Listener is closed.
+//
+// Implements [water.Listener].
+func (l *Listener) Connections() <-chan water.AcceptResult {
+	l.connectionsOnce.Do(func() {
+		l.connections = driver.ServeAcceptResults(l.accept, l.done)
+	})
+	return l.connections
+}
+
+// accept accepts the next connection authorized by the AuthHandler, if
+// set, along with the metadata reported by Connections. Rejected
+// connections are closed and skipped.
+func (l *Listener) accept() water.AcceptResult {
+	for {
+		res := l.acceptOne()
+		if res.Err != nil {
+			return res
+		}
+
+		if err := driver.Authorize(l.loadConfig(), res.Conn); err != nil {
+			res.Conn.Close()
+			continue
+		}
+		return res
+	}
+}
+
+// acceptOne accepts the next connection, handshaken either by the
+// caller or, if the HandshakeConcurrency is set, by the goroutines of
+// driver.ServeHandshakes.
+func (l *Listener) acceptOne() water.AcceptResult {
+	if config := l.loadConfig(); config != nil && config.HandshakeConcurrency > 0 {
+		l.handshakesOnce.Do(func() {
+			l.handshakes = driver.ServeHandshakes(config.HandshakeConcurrency, l.acceptNetworkConn, l.handshake, l.done)
+		})
+
+		select {
+		case res, ok := <-l.handshakes:
+			if ok {
+				return res
+			}
+		case <-l.done:
+		}
+		return water.AcceptResult{Err: fmt.Errorf("water: listener is closed")}
+	}
+
+	netConn, err := l.acceptNetworkConn()
+	if err != nil {
+		return water.AcceptResult{Err: err}
+	}
+	return l.handshake(netConn)
+}
+
+// acceptNetworkConn accepts the next incoming network connection.
+func (l *Listener) acceptNetworkConn() (net.Conn, error) {
 	if l.closed.Load() {
 		return nil, fmt.Errorf("water: listener is closed")
 	}
 
-	if l.config == nil {
+	config := l.loadConfig()
+	if config == nil {
 		return nil, fmt.Errorf("water: accept with nil config is not allowed")
 	}
 
-	var core water.Core
-	var err error
-	core, err = water.NewCoreWithContext(l.ctx, l.config)
+	// accept the incoming connection before creating the WASM instance,
+	// so rejected connections cost no instantiation.
+	return config.AcceptNetworkConn()
+}
+
+// handshake creates the WASM instance for the incoming netConn and runs
+// the handshake of the WATM over it, bounded by the HandshakeTimeout.
+func (l *Listener) handshake(netConn net.Conn) (res water.AcceptResult) {
+	start := time.Now()
+	res.RemoteAddr = netConn.RemoteAddr()
+	defer func() { res.HandshakeDuration = time.Since(start) }()
+
+	// the config might have been updated while waiting for the connection
+	config := l.loadConfig()
+
+	conn, err := driver.Handshake(l.ctx, config, netConn, func(core water.Core) (water.Conn, error) {
+		return accept(core, socket.NewSingleConnListener(netConn, l.Addr()))
+	})
 	if err != nil {
-		return nil, err
+		res.Err = err
+		return res
+	}
+
+	if !l.track(conn.(*Conn)) {
+		conn.Close()
+		res.Err = fmt.Errorf("water: listener is shut down")
+		return res
+	}
+	res.Conn = conn
+	return res
+}
+
+// UpdateConfig replaces the config used for newly accepted connections,
+// e.g., to upgrade the WATM without downtime. Established connections keep
+// running the WATM they were accepted with.
+//
+// The network listener of the Listener is kept, and the NetworkListener
+// in the new config is ignored. An error is returned if the new WATM does
+// not implement the listener role of this version of the spec.
+//
+// Implements [water.Listener].
+func (l *Listener) UpdateConfig(c *water.Config) error {
+	if l.closed.Load() {
+		return fmt.Errorf("water: listener is closed")
 	}
 
-	return accept(core)
+	if c == nil {
+		return fmt.Errorf("water: updating with nil config is not allowed")
+	}
+
+	config, err := driver.Snapshot(c)
+	if err != nil {
+		return err
+	}
+	config.NetworkListener = l.loadConfig().NetworkListener
+
+	// make sure the new WATM is able to be used by this Listener
+	core, err := water.NewCoreWithContext(l.ctx, config)
+	if err != nil {
+		return err
+	}
+	defer core.Close()
+
+	if _, ok := core.Exports()["_water_v0"]; !ok {
+		return water.ErrListenerVersionNotFound
+	}
+
+	l.configMutex.Lock()
+	l.config = config
+	l.configMutex.Unlock()
+
+	return nil
+}
+
+func (l *Listener) loadConfig() *water.Config {
+	l.configMutex.RLock()
+	defer l.configMutex.RUnlock()
+
+	return l.config
+}
+
+// Shutdown gracefully shuts down the listener. It first stops accepting
+// new connections, then waits for all established connections to be
+// closed. If ctx expires before that, all remaining connections are
+// forcibly closed, tearing down their WASM instances, and ctx.Err() is
+// returned.
+//
+// Implements [water.Listener].
+func (l *Listener) Shutdown(ctx context.Context) error {
+	err := l.Close()
+
+	// a connection still being accepted is not tracked from now on
+	l.connsMutex.Lock()
+	l.shutdown = true
+	l.connsMutex.Unlock()
+
+	closed := make(chan struct{})
+	go func() {
+		l.connsWg.Wait()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+		return err
+	case <-ctx.Done():
+		l.closeAllConns()
+		return ctx.Err()
+	}
+}
+
+// track records the established connection until it is closed. It returns
+// false without recording it if the Listener is shut down.
+func (l *Listener) track(conn *Conn) bool {
+	l.connsMutex.Lock()
+	defer l.connsMutex.Unlock()
+
+	if l.shutdown {
+		return false
+	}
+
+	if l.conns == nil {
+		l.conns = make(map[*Conn]struct{})
+	}
+	l.conns[conn] = struct{}{}
+	l.connsWg.Add(1)
+
+	conn.tmMutex.Lock()
+	conn.onClose = func() {
+		l.connsMutex.Lock()
+		l.untrack(conn)
+		l.connsMutex.Unlock()
+	}
+	conn.tmMutex.Unlock()
+
+	// the connection might have been closed before onClose was set
+	if conn.closed.Load() {
+		l.untrack(conn)
+	}
+	return true
+}
+
+// untrack removes the connection recorded by track, if not yet removed.
+// The caller must hold connsMutex.
+func (l *Listener) untrack(conn *Conn) {
+	if _, ok := l.conns[conn]; ok {
+		delete(l.conns, conn)
+		l.connsWg.Done()
+	}
+}
+
+func (l *Listener) closeAllConns() {
+	l.connsMutex.Lock()
+	conns := make([]*Conn, 0, len(l.conns))
+	for conn := range l.conns {
+		conns = append(conns, conn)
+	}
+	l.connsMutex.Unlock()
+
+	for _, conn := range conns {
+		conn.Close()
+	}
 }
@@ -11,6 +11,8 @@ import (
 	"time"
 
 	_ "embed"
+
+	"github.com/refraction-networking/water/internal/wat"
 )
 
 var (
@@ -21,6 +23,24 @@ var (
 	wasmReverse []byte
 )
 
+// The mock WATMs in testdata are assembled from their sources in the text
+// format, e.g., testdata/dial_slow.wat into testdata/dial_slow.wasm.
+//
+//go:generate go run ../../internal/wat/wat2wasm testdata
+
+func TestTestdata(t *testing.T) {
+	if err := wat.Verify("testdata"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// wasmDialSlow is a WATM whose _water_dial spins for a while before dialing,
+// so that the dial completes only after a short context is done unless
+// interrupted. It works as a Dialer.
+//
+//go:embed testdata/dial_slow.wasm
+var wasmDialSlow []byte
+
 //// Gaukas: uncomment the following code once we decide to require
 //// go1.21 as minimum version
 // func init() {
@@ -58,6 +78,7 @@ func benchmarkUnidirectionalStream(b *testing.B, wrConn, rdConn net.Conn) {
 	tripleGC(100 * time.Microsecond)
 
 	b.SetBytes(1024)
+	b.ReportAllocs()
 	b.StartTimer()
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
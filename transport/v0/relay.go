@@ -4,9 +4,11 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"sync"
 	"sync/atomic"
 
 	"github.com/refraction-networking/water"
+	"github.com/refraction-networking/water/internal/driver"
 )
 
 func init() {
@@ -18,9 +20,10 @@ func init() {
 
 // Relay implements water.Relay utilizing Water WATM API v0.
 type Relay struct {
-	config  *water.Config
-	ctx     context.Context
-	running *atomic.Bool
+	config      *water.Config
+	configMutex sync.RWMutex // protects config, replaced by ListenAndRelayTo
+	ctx         context.Context
+	running     *atomic.Bool
 
 	dialNetwork, dialAddress string
 
@@ -46,8 +49,13 @@ func NewRelay(c *water.Config) (water.Relay, error) {
 // Call [water.WazeroRuntimeConfigFactory.SetCloseOnContextDone] with false to
 // disable this behavior.
 func NewRelayWithContext(ctx context.Context, c *water.Config) (water.Relay, error) {
+	config, err := driver.Snapshot(c)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Relay{
-		config:  c.Clone(),
+		config:  config,
 		ctx:     ctx,
 		running: new(atomic.Bool),
 	}, nil
@@ -69,12 +77,22 @@ func (r *Relay) RelayTo(network, address string) error {
 	var core water.Core
 	var err error
 	for r.running.Load() {
+		var netConn net.Conn
+		netConn, err = r.config.AcceptNetworkConn()
+		if err != nil {
+			if r.running.Load() { // errored before closing
+				return err
+			}
+			break
+		}
+
 		core, err = water.NewCoreWithContext(r.ctx, r.config)
 		if err != nil {
+			netConn.Close()
 			return err
 		}
 
-		_, err = relay(core, network, address)
+		_, err = relay(core, netConn, network, address)
 		if err != nil {
 			if r.running.Load() { // errored before closing
 				return err
@@ -93,30 +111,42 @@ func (r *Relay) ListenAndRelayTo(lnetwork, laddress, rnetwork, raddress string)
 	}
 	defer r.running.CompareAndSwap(true, false)
 
-	lis, err := net.Listen(lnetwork, laddress)
+	if r.config == nil {
+		return fmt.Errorf("water: relaying with nil config is not allowed")
+	}
+
+	lis, err := r.config.ListenNetwork(r.ctx, lnetwork, laddress)
 	if err != nil {
 		return err
 	}
 
 	config := r.config.Clone()
 	config.NetworkListener = lis
+	r.configMutex.Lock()
 	r.config = config
-
-	if r.config == nil {
-		return fmt.Errorf("water: relaying with nil config is not allowed")
-	}
+	r.configMutex.Unlock()
 
 	r.dialNetwork = rnetwork
 	r.dialAddress = raddress
 
 	var core water.Core
 	for r.running.Load() {
+		var netConn net.Conn
+		netConn, err = r.config.AcceptNetworkConn()
+		if err != nil {
+			if r.running.Load() { // errored before closing
+				return err
+			}
+			break
+		}
+
 		core, err = water.NewCoreWithContext(r.ctx, r.config)
 		if err != nil {
+			netConn.Close()
 			return err
 		}
 
-		_, err = relay(core, rnetwork, raddress)
+		_, err = relay(core, netConn, rnetwork, raddress)
 		if err != nil {
 			if r.running.Load() { // errored before closing
 				return err
@@ -134,6 +164,9 @@ func (r *Relay) Close() error {
 		return nil
 	}
 
+	r.configMutex.RLock()
+	defer r.configMutex.RUnlock()
+
 	if r.config != nil {
 		return r.config.NetworkListener.Close()
 	}
@@ -143,7 +176,10 @@ func (r *Relay) Close() error {
 
 // Addr implements [water.Relay].
 func (r *Relay) Addr() net.Addr {
-	if r.config == nil {
+	r.configMutex.RLock()
+	defer r.configMutex.RUnlock()
+
+	if r.config == nil || r.config.NetworkListener == nil {
 		return nil
 	}
 
@@ -0,0 +1,11 @@
+(module
+  (import "env" "host_dial" (func (result i32)))
+  (memory (export "memory") 1)
+  (func (export "_water_v0"))
+  (func (export "_water_init") (result i32) (i32.const 0))
+  (func (export "_water_cancel_with") (param i32) (result i32) (i32.const 0))
+  (func (export "_water_worker") (result i32) (i32.const 0))
+  (func (export "_water_dial") (param i32) (result i32) (local i32)
+    (local.set 1 (i32.const 0x4000000))
+    (loop (br_if 0 (local.tee 1 (i32.sub (local.get 1) (i32.const 1)))))
+    (call 0)))
@@ -5,10 +5,12 @@ import (
 	"fmt"
 	"net"
 	"runtime"
+	"runtime/pprof"
 	"sync"
 	"syscall"
 
 	"github.com/refraction-networking/water"
+	"github.com/refraction-networking/water/internal/driver"
 	"github.com/refraction-networking/water/internal/log"
 	"github.com/refraction-networking/water/internal/socket"
 	"github.com/refraction-networking/water/internal/wasip1"
@@ -85,6 +87,10 @@ type TransportModule struct {
 		// Read-only to the caller. Write-only to the worker thread.
 		chanWorkerErr chan error
 
+		// onExit is called after chanWorkerErr is closed, on the goroutine
+		// which ran the worker thread, see OnWorkerExit.
+		onExit func()
+
 		// a socket used to cancel the worker thread. When the host calls Cancel(), it should
 		// write to this socket.
 		cancelSocket net.Conn
@@ -94,6 +100,10 @@ type TransportModule struct {
 	pushedConn      map[int32]net.Conn // the conn we want to keep alive
 	pushedConnMutex sync.RWMutex
 
+	// role is "dialer", "listener" or "relay" once the WATM is used as
+	// one, which labels its worker thread for the profiler.
+	role string
+
 	deferOnce     sync.Once
 	deferredFuncs []func()
 
@@ -131,6 +141,7 @@ func (tm *TransportModule) AcceptFor(reverseCallerConn net.Conn) (sourceConn net
 	if tm._accept == nil {
 		return nil, fmt.Errorf("water: WASM module does not export _water_accept")
 	}
+	tm.role = "listener"
 
 	callerFd, err := tm.PushConn(reverseCallerConn)
 	if err != nil {
@@ -157,6 +168,7 @@ func (tm *TransportModule) Associate() error {
 	if tm._associate == nil {
 		return fmt.Errorf("water: WASM module does not export _water_associate")
 	}
+	tm.role = "relay"
 
 	_, err := tm._associate()
 	if err != nil {
@@ -178,7 +190,7 @@ func (tm *TransportModule) Associate() error {
 // Cancel cancels the worker thread if it is running and returns
 // the error returned by the worker thread. This call is designed
 // to block until the worker thread exits.
-func (tm *TransportModule) Cancel() error {
+func (tm *TransportModule) Cancel() (err error) {
 	if tm.backgroundWorker == nil {
 		return fmt.Errorf("water: Transport Module is not initialized")
 	}
@@ -187,6 +199,15 @@ func (tm *TransportModule) Cancel() error {
 		return fmt.Errorf("water: Transport Module is cancelled")
 	}
 
+	// the cancel pipe must be closed even if the worker thread has already
+	// exited or failed to be cancelled, otherwise it is leaked.
+	defer func() {
+		if closeErr := tm.backgroundWorker.cancelSocket.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("water: closing cancel pipe failed: %w", closeErr)
+		}
+		tm.backgroundWorker.cancelSocket = nil
+	}()
+
 	select {
 	case err := <-tm.backgroundWorker.chanWorkerErr: // if already returned, we don't need to cancel
 		if err != nil {
@@ -207,12 +228,6 @@ func (tm *TransportModule) Cancel() error {
 		return fmt.Errorf("water: worker thread returned error: %w", err)
 	}
 
-	if err := tm.backgroundWorker.cancelSocket.Close(); err != nil {
-		return fmt.Errorf("water: closing cancel pipe failed: %w", err)
-	}
-
-	tm.backgroundWorker.cancelSocket = nil
-
 	return nil
 }
 
@@ -271,6 +286,24 @@ func (tm *TransportModule) Core() water.Core {
 	return core
 }
 
+// RuntimeStats returns a snapshot of the resources used by the WATM.
+func (tm *TransportModule) RuntimeStats() water.RuntimeStats {
+	var stats water.RuntimeStats
+
+	if core := tm.Core(); core != nil {
+		stats.MemorySize = core.MemorySize()
+	}
+
+	tm.pushedConnMutex.RLock()
+	stats.HostConns = len(tm.pushedConn)
+	for _, conn := range tm.pushedConn {
+		stats.HostBufferSize += socket.TotalBufferSize(conn)
+	}
+	tm.pushedConnMutex.RUnlock()
+
+	return stats
+}
+
 func (tm *TransportModule) Defer(f func()) {
 	tm.deferredFuncs = append(tm.deferredFuncs, f)
 }
@@ -293,6 +326,7 @@ func (tm *TransportModule) DialFrom(reverseCallerConn net.Conn) (destConn net.Co
 	if tm._dial == nil {
 		return nil, fmt.Errorf("water: WASM module does not export _water_dial")
 	}
+	tm.role = "dialer"
 
 	callerFd, err := tm.PushConn(reverseCallerConn)
 	if err != nil {
@@ -401,8 +435,7 @@ func (tm *TransportModule) Initialize() error {
 			// If a config is provided, we will warn the user that the config WILL NOT be
 			// pushed to the WASM module.
 			if tm.Core().Config().TransportModuleConfig != nil {
-				f, err := tm.Core().Config().TransportModuleConfig.AsFile()
-				if f != nil && err == nil {
+				if len(tm.Core().Config().TransportModuleConfig.AsBytes()) > 0 {
 					// there is a config file provided, must warn
 					log.LWarnf(tm.Core().Logger(), "water: pull_config function is not imported by WATM, "+
 						"config file will not be pushed to the WASM module")
@@ -419,7 +452,8 @@ func (tm *TransportModule) Initialize() error {
 		return err
 	}
 
-	coreCtx := tm.Core().Context()
+	core := tm.Core()
+	pool := core.Config().ExecutionPool
 
 	// _init
 	init := tm.Core().ExportedFunction("_water_init")
@@ -439,7 +473,7 @@ func (tm *TransportModule) Initialize() error {
 		}
 
 		tm._init = func() (int32, error) {
-			ret, err := init.Call(coreCtx)
+			ret, err := core.Call(pool, init)
 			if err != nil {
 				return 0, fmt.Errorf("water: calling _water_init function returned error: %w", err)
 			}
@@ -471,7 +505,7 @@ func (tm *TransportModule) Initialize() error {
 		}
 
 		tm._dial = func(callerFd int32) (int32, error) {
-			ret, err := dial.Call(coreCtx, api.EncodeI32(callerFd))
+			ret, err := core.Call(pool, dial, api.EncodeI32(callerFd))
 			if err != nil {
 				return 0, fmt.Errorf("water: calling _water_dial function returned error: %w", err)
 			}
@@ -503,7 +537,7 @@ func (tm *TransportModule) Initialize() error {
 		}
 
 		tm._accept = func(callerFd int32) (int32, error) {
-			ret, err := accept.Call(coreCtx, api.EncodeI32(callerFd))
+			ret, err := core.Call(pool, accept, api.EncodeI32(callerFd))
 			if err != nil {
 				return 0, fmt.Errorf("water: calling _water_accept function returned error: %w", err)
 			}
@@ -533,7 +567,7 @@ func (tm *TransportModule) Initialize() error {
 		}
 
 		tm._associate = func() (int32, error) {
-			ret, err := associate.Call(coreCtx)
+			ret, err := core.Call(pool, associate)
 			if err != nil {
 				return 0, fmt.Errorf("water: calling _water_associate function returned error: %w", err)
 			}
@@ -585,10 +619,11 @@ func (tm *TransportModule) Initialize() error {
 		_cancel_with  func(int32) (int32, error)
 		_worker       func() (int32, error)
 		chanWorkerErr chan error
+		onExit        func()
 		cancelSocket  net.Conn
 	}{
 		_cancel_with: func(fd int32) (int32, error) {
-			ret, err := cancelWith.Call(coreCtx, api.EncodeI32(fd))
+			ret, err := core.Call(pool, cancelWith, api.EncodeI32(fd))
 			if err != nil {
 				return 0, fmt.Errorf("water: calling _water_cancel_with function returned error: %w", err)
 			}
@@ -596,7 +631,7 @@ func (tm *TransportModule) Initialize() error {
 			return wasip1.DecodeWATERError(api.DecodeI32(ret[0]))
 		},
 		_worker: func() (int32, error) {
-			ret, err := worker.Call(coreCtx)
+			ret, err := core.Call(pool, worker)
 			if err != nil {
 				return 0, fmt.Errorf("water: calling _water_worker function returned error: %w", err)
 			}
@@ -648,21 +683,38 @@ func (tm *TransportModule) Worker() error {
 
 	log.LDebugf(tm.Core().Logger(), "water: starting worker thread")
 
-	// in a goroutine, call _worker
-	go func() {
-		defer close(tm.backgroundWorker.chanWorkerErr)
-		_, err := tm.backgroundWorker._worker()
-		if err != nil && !errors.Is(err, syscall.ECANCELED) {
-			// multiple copies in case of multiple receivers on the channel
-			tm.backgroundWorker.chanWorkerErr <- err
-			tm.backgroundWorker.chanWorkerErr <- err
-			tm.backgroundWorker.chanWorkerErr <- err
-			tm.backgroundWorker.chanWorkerErr <- err
-			return
-		} else {
-			log.LDebugf(tm.Core().Logger(), "water: worker thread exited normally")
+	// the TransportModule does not keep what onExit notifies, e.g., its
+	// Conn, reachable once the worker thread exits
+	onExit := tm.backgroundWorker.onExit
+	tm.backgroundWorker.onExit = nil
+
+	// in a goroutine of the WorkerPool, if any, call _worker
+	labels := pprof.WithLabels(tm.Core().Context(), pprof.Labels(water.ProfilerLabelRole, tm.role))
+	err = driver.GoWorker(tm.Core().Context(), tm.Core().Config().WorkerPool, func() {
+		pprof.SetGoroutineLabels(labels)
+
+		func() {
+			defer close(tm.backgroundWorker.chanWorkerErr)
+			_, err := tm.backgroundWorker._worker()
+			if err != nil && !errors.Is(err, syscall.ECANCELED) {
+				// multiple copies in case of multiple receivers on the channel
+				tm.backgroundWorker.chanWorkerErr <- err
+				tm.backgroundWorker.chanWorkerErr <- err
+				tm.backgroundWorker.chanWorkerErr <- err
+				tm.backgroundWorker.chanWorkerErr <- err
+				return
+			} else {
+				log.LDebugf(tm.Core().Logger(), "water: worker thread exited normally")
+			}
+		}()
+
+		if onExit != nil {
+			onExit()
 		}
-	}()
+	})
+	if err != nil {
+		return fmt.Errorf("water: waiting for the WorkerPool: %w", err)
+	}
 
 	log.LDebugf(tm.Core().Logger(), "water: worker thread started")
 
@@ -676,6 +728,15 @@ func (tm *TransportModule) Worker() error {
 	}
 }
 
+// OnWorkerExit sets f to be called once the worker thread exits, on the
+// goroutine which ran it, so that watching for it does not take a
+// goroutine of its own. It must be called before Worker.
+func (tm *TransportModule) OnWorkerExit(f func()) {
+	if tm.backgroundWorker != nil {
+		tm.backgroundWorker.onExit = f
+	}
+}
+
 // WorkerErrored returns a channel that will be closed when the worker thread exits.
 func (tm *TransportModule) WorkerErrored() <-chan error {
 	if tm.backgroundWorker == nil {
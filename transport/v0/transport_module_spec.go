@@ -0,0 +1,45 @@
+package v0
+
+import (
+	"github.com/refraction-networking/water"
+	"github.com/refraction-networking/water/internal/driver"
+	"github.com/tetratelabs/wazero/api"
+)
+
+func init() {
+	err := driver.RegisterWATMSpec(Spec)
+	if err != nil {
+		panic(err)
+	}
+}
+
+var (
+	i32 = api.ValueTypeI32
+
+	sigVoidToI32 = water.FunctionSignature{Results: []api.ValueType{i32}}
+	sigI32ToI32  = water.FunctionSignature{Params: []api.ValueType{i32}, Results: []api.ValueType{i32}}
+)
+
+// Spec is the [water.TransportModuleSpec] of Water WATM API v0.
+var Spec = water.TransportModuleSpec{
+	Version: "v0",
+	Exports: map[string]water.FunctionSignature{
+		"_water_v0":          {},
+		"_water_init":        sigVoidToI32,
+		"_water_cancel_with": sigI32ToI32,
+		"_water_worker":      sigVoidToI32,
+	},
+	RoleExports: map[water.Role]map[string]water.FunctionSignature{
+		water.RoleDialer:   {"_water_dial": sigI32ToI32},
+		water.RoleListener: {"_water_accept": sigI32ToI32},
+		water.RoleRelay:    {"_water_associate": sigVoidToI32},
+	},
+	HostImports: map[string]map[string]water.FunctionSignature{
+		"env": {
+			"host_dial":   sigVoidToI32,
+			"host_accept": sigVoidToI32,
+			"host_defer":  {}, // deprecated
+			"pull_config": sigVoidToI32,
+		},
+	},
+}
@@ -0,0 +1,148 @@
+package v1_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/refraction-networking/water"
+	v1 "github.com/refraction-networking/water/transport/v1"
+)
+
+var (
+	wasmAsyncOnce sync.Once
+	wasmAsync     []byte
+	wasmAsyncErr  error
+)
+
+// buildAsyncWATM builds testdata/async with the Go toolchain running the
+// tests, since the WATM is too large to be checked in. The test is skipped
+// if the toolchain is unable to build it, e.g., older than Go 1.24.
+func buildAsyncWATM(t *testing.T) []byte {
+	if testing.Short() {
+		t.Skip("building testdata/async is slow, skipping in short mode")
+	}
+
+	wasmAsyncOnce.Do(func() {
+		dir, err := os.MkdirTemp("", "water-async-*")
+		if err != nil {
+			wasmAsyncErr = err
+			return
+		}
+		defer os.RemoveAll(dir)
+
+		out := filepath.Join(dir, "async.wasm")
+		cmd := exec.Command("go", "build", "-buildmode=c-shared", "-o", out, "./testdata/async")
+		cmd.Env = append(os.Environ(), "GOOS=wasip1", "GOARCH=wasm")
+		if output, err := cmd.CombinedOutput(); err != nil {
+			wasmAsyncErr = fmt.Errorf("%w: %s", err, output)
+			return
+		}
+		wasmAsync, wasmAsyncErr = os.ReadFile(out)
+	})
+
+	if wasmAsyncErr != nil {
+		t.Skipf("cannot build testdata/async: %v", wasmAsyncErr)
+	}
+	return wasmAsync
+}
+
+// TestAsyncWATM covers the following cases with a WATM built as a WASI
+// reactor that serves connections with non-blocking I/O and poll_oneoff:
+//  1. Dialer must work.
+//  2. Listener must work.
+func TestAsyncWATM(t *testing.T) {
+	t.Run("dialer must work", testAsyncWATMDialer)
+	t.Run("listener must work", testAsyncWATMListener)
+}
+
+func testAsyncWATMDialer(t *testing.T) {
+	config := &water.Config{
+		TransportModuleBin:  buildAsyncWATM(t),
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+	}
+
+	tcpLis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcpLis.Close() // skipcq: GO-S2307
+
+	dialer, err := v1.NewDialerWithContext(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := dialer.DialContext(context.Background(), "tcp", tcpLis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close() // skipcq: GO-S2307
+
+	peerConn, err := tcpLis.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peerConn.Close() // skipcq: GO-S2307
+
+	testAsyncWATMConnPair(t, conn, peerConn)
+}
+
+func testAsyncWATMListener(t *testing.T) {
+	config := &water.Config{
+		TransportModuleBin:  buildAsyncWATM(t),
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+	}
+
+	lis, err := config.ListenContext(context.Background(), "tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close() // skipcq: GO-S2307
+
+	peerConn, err := net.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peerConn.Close() // skipcq: GO-S2307
+
+	conn, err := lis.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close() // skipcq: GO-S2307
+
+	testAsyncWATMConnPair(t, conn, peerConn)
+}
+
+func testAsyncWATMConnPair(t *testing.T, conn, peerConn net.Conn) {
+	t.Helper()
+
+	if err := conn.SetDeadline(time.Now().Add(10 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 10; i++ {
+		msg := []byte("hello from the caller")
+		if err := sanityCheckConn(conn, peerConn, msg, msg); err != nil {
+			t.Fatal(err)
+		}
+
+		msg = []byte("hello from the peer")
+		if err := sanityCheckConn(peerConn, conn, msg, msg); err != nil {
+			t.Fatal(err)
+		}
+
+		tripleGC(100 * time.Microsecond)
+	}
+
+	if err := conn.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -5,11 +5,15 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"os"
 	"sync"
 	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/refraction-networking/water"
+	"github.com/refraction-networking/water/internal/driver"
+	"github.com/refraction-networking/water/internal/idle"
 	"github.com/refraction-networking/water/internal/log"
 	"github.com/refraction-networking/water/internal/socket"
 )
@@ -33,6 +37,16 @@ type Conn struct {
 
 	closeOnce sync.Once
 	closed    atomic.Bool
+	onClose   func()            // called once the Conn is closed, if set. Protected by tmMutex.
+	trace     *driver.DialTrace // reports the closing of a dialed Conn, if set. Protected by tmMutex.
+	idle      *idle.Timer       // closes the Conn once idle, if the IdleTimeout is set
+
+	stats          driver.ConnStatsRecorder // the data read from and written to the Conn, for Stats
+	peakMemorySize atomic.Uint64            // the largest memory size observed, for RuntimeStats
+	closedSession  []byte                   // the session exported by the WATM before Close. Protected by tmMutex.
+	closedReason   water.CloseReason        // the close reason reported by the WATM before Close. Protected by tmMutex.
+	closedMetadata map[string]string        // the metadata attached by the WATM before Close. Protected by tmMutex.
+	closedNetConns []net.Conn               // the network connections of the WATM before Close. Protected by tmMutex.
 
 	water.UnimplementedConn // embedded to ensure forward compatibility
 }
@@ -41,12 +55,13 @@ type Conn struct {
 func dialFixed(core water.Core) (c water.Conn, err error) {
 	tm := UpgradeCore(core)
 	conn := &Conn{
-		tm: tm,
+		tm:   tm,
+		idle: idle.NewTimer(core.Config().IdleTimeout),
 	}
 
 	dialer := &networkDialer{
-		dialerFunc:       core.Config().NetworkDialerFuncOrDefault(),
-		addressValidator: core.Config().DialedAddressValidator,
+		dialerFunc:       core.Config().NetworkDialerFuncWithContext(core.Context()),
+		addressValidator: dialedAddressValidator(core.Config()),
 	}
 
 	if err = conn.tm.LinkNetworkInterface(dialer, nil); err != nil {
@@ -68,6 +83,12 @@ func dialFixed(core water.Core) (c water.Conn, err error) {
 	}
 	conn.callerConn = callerConn
 
+	if err = core.Config().ApplyBufferSizes(callerConn, reverseCallerConn); err != nil {
+		callerConn.Close()
+		reverseCallerConn.Close()
+		return nil, err
+	}
+
 	conn.dstConn, err = conn.tm.DialFixedFrom(reverseCallerConn)
 	if err != nil {
 		return nil, err
@@ -76,24 +97,35 @@ func dialFixed(core water.Core) (c water.Conn, err error) {
 	// safety: we need to watch for the blocking worker thread's status.
 	// If it returns, no further data can be processed by the WASM module
 	// and we need to close this connection in that case.
-	go conn.closeOnWorkerError()
+	conn.tm.OnWorkerExit(conn.closeOnWorkerError)
 
 	if err := conn.tm.StartWorker(); err != nil {
 		return nil, err
 	}
 
+	conn.startIdleTimer(core.Config())
+
 	return conn, nil
 }
 
-// dial dials the network address specified using the WATM.
-func dial(core water.Core, network, address string) (c water.Conn, err error) {
-	tm := UpgradeCore(core)
-	conn := &Conn{
-		tm: tm,
+// dialedAddressValidator returns the validator of the addresses the WATM
+// specifies to dial, e.g., for the decoys or the paths of a multipath
+// transport besides the connection to the remote destination.
+func dialedAddressValidator(config *water.Config) func(network, address string) error {
+	if !config.WASIPolicyOrDefault().Network {
+		return func(_, _ string) error {
+			return water.ErrWASIPolicyDenied
+		}
 	}
+	return config.DialedAddressValidator
+}
 
+// dial dials the network address specified using the WATM, reporting its
+// progress to trace.
+func dial(core water.Core, network, address string, trace *driver.DialTrace) (c water.Conn, err error) {
 	dialer := &networkDialer{
-		dialerFunc: core.Config().NetworkDialerFuncOrDefault(),
+		dialerFunc:       trace.DialerFunc(core.Config().NetworkDialerFuncWithContext(core.Context())),
+		addressValidator: dialedAddressValidator(core.Config()),
 		overrideAddress: struct {
 			network string
 			address string
@@ -103,14 +135,68 @@ func dial(core water.Core, network, address string) (c water.Conn, err error) {
 		},
 	}
 
-	if err = conn.tm.LinkNetworkInterface(dialer, nil); err != nil {
+	return dialWith(core, dialer)
+}
+
+// dialWithConn runs the WATM as a dialer over an existing connection
+// instead of dialing a new one.
+func dialWithConn(core water.Core, existingConn net.Conn) (c water.Conn, err error) {
+	var used atomic.Bool
+	dialer := &networkDialer{
+		dialerFunc: func(_, _ string) (net.Conn, error) {
+			if !used.CompareAndSwap(false, true) {
+				return nil, errors.New("water: existing connection is already in use")
+			}
+			return existingConn, nil
+		},
+		overrideAddress: struct {
+			network string
+			address string
+		}{
+			network: existingConn.RemoteAddr().Network(),
+			address: existingConn.RemoteAddr().String(),
+		},
+	}
+
+	return dialWith(core, dialer)
+}
+
+// dialWith drives the WATM as a dialer using the given networkDialer
+// to establish the connection to the remote destination.
+func dialWith(core water.Core, dialer *networkDialer) (c water.Conn, err error) {
+	conn, err := prepareDial(core, dialer)
+	if err != nil {
 		return nil, err
 	}
 
-	if err = conn.tm.Initialize(); err != nil {
+	return conn.finishDial()
+}
+
+// prepareDial instantiates and initializes the WATM as a dialer using the
+// given networkDialer, which is not used until finishDial is called.
+func prepareDial(core water.Core, dialer *networkDialer) (*Conn, error) {
+	tm := UpgradeCore(core)
+	conn := &Conn{
+		tm:   tm,
+		idle: idle.NewTimer(core.Config().IdleTimeout),
+	}
+
+	if err := conn.tm.LinkNetworkInterface(dialer, nil); err != nil {
+		return nil, err
+	}
+
+	if err := conn.tm.Initialize(); err != nil {
 		return nil, err
 	}
 
+	return conn, nil
+}
+
+// finishDial drives the WATM prepared by prepareDial to establish the
+// connection to the remote destination.
+func (conn *Conn) finishDial() (c water.Conn, err error) {
+	core := conn.tm.Core()
+
 	reverseCallerConn, callerConn, err := socket.TCPConnPair()
 	// wasmCallerConn, conn.uoConn, err = socket.TCPConnPair()
 	if err != nil {
@@ -122,6 +208,12 @@ func dial(core water.Core, network, address string) (c water.Conn, err error) {
 	}
 	conn.callerConn = callerConn
 
+	if err = core.Config().ApplyBufferSizes(callerConn, reverseCallerConn); err != nil {
+		callerConn.Close()
+		reverseCallerConn.Close()
+		return nil, err
+	}
+
 	conn.dstConn, err = conn.tm.DialFrom(reverseCallerConn)
 	if err != nil {
 		return nil, err
@@ -130,24 +222,27 @@ func dial(core water.Core, network, address string) (c water.Conn, err error) {
 	// safety: we need to watch for the blocking worker thread's status.
 	// If it returns, no further data can be processed by the WASM module
 	// and we need to close this connection in that case.
-	go conn.closeOnWorkerError()
+	conn.tm.OnWorkerExit(conn.closeOnWorkerError)
 
 	if err := conn.tm.StartWorker(); err != nil {
 		return nil, err
 	}
 
+	conn.startIdleTimer(core.Config())
+
 	return conn, nil
 }
 
 // accept accepts the network connection using through the WASM module
 // while using the net.Listener specified in core.config.
-func accept(core water.Core) (c water.Conn, err error) {
+func accept(core water.Core, listener net.Listener) (c water.Conn, err error) {
 	tm := UpgradeCore(core)
 	conn := &Conn{
-		tm: tm,
+		tm:   tm,
+		idle: idle.NewTimer(core.Config().IdleTimeout),
 	}
 
-	if err = conn.tm.LinkNetworkInterface(nil, core.Config().NetworkListenerOrPanic()); err != nil {
+	if err = conn.tm.LinkNetworkInterface(nil, listener); err != nil {
 		return nil, err
 	}
 
@@ -168,6 +263,12 @@ func accept(core water.Core) (c water.Conn, err error) {
 
 	conn.callerConn = callerConn
 
+	if err = core.Config().ApplyBufferSizes(callerConn, reverseCallerConn); err != nil {
+		callerConn.Close()
+		reverseCallerConn.Close()
+		return nil, err
+	}
+
 	conn.srcConn, err = conn.tm.AcceptFor(reverseCallerConn)
 	if err != nil {
 		return nil, err
@@ -176,23 +277,29 @@ func accept(core water.Core) (c water.Conn, err error) {
 	// safety: we need to watch for the blocking worker thread's status.
 	// If it returns, no further data can be processed by the WASM module
 	// and we need to close this connection in that case.
-	go conn.closeOnWorkerError()
+	conn.tm.OnWorkerExit(conn.closeOnWorkerError)
 
 	if err := conn.tm.StartWorker(); err != nil {
 		return nil, err
 	}
 
+	conn.startIdleTimer(core.Config())
+
 	return conn, nil
 }
 
-func relay(core water.Core, network, address string) (c water.Conn, err error) {
+func relay(core water.Core, inbound net.Conn, network, address string) (c water.Conn, err error) {
 	tm := UpgradeCore(core)
 	conn := &Conn{
-		tm: tm,
+		tm:   tm,
+		idle: idle.NewTimer(core.Config().IdleTimeout),
 	}
 
+	inbound, dialerFunc := driver.RelayConnsFor(core.Config(), inbound)
+	inbound, dialerFunc = conn.idle.TrackConn(inbound), conn.idle.TrackDialerFunc(dialerFunc)
 	dialer := &networkDialer{
-		dialerFunc: core.Config().NetworkDialerFuncOrDefault(),
+		dialerFunc:       dialerFunc,
+		addressValidator: dialedAddressValidator(core.Config()),
 		overrideAddress: struct {
 			network string
 			address string
@@ -201,8 +308,9 @@ func relay(core water.Core, network, address string) (c water.Conn, err error) {
 			address: address,
 		},
 	}
+	listener := socket.NewSingleConnListener(inbound, core.Config().NetworkListener.Addr())
 
-	if err = conn.tm.LinkNetworkInterface(dialer, core.Config().NetworkListenerOrPanic()); err != nil {
+	if err = conn.tm.LinkNetworkInterface(dialer, listener); err != nil {
 		return nil, err
 	}
 
@@ -217,12 +325,14 @@ func relay(core water.Core, network, address string) (c water.Conn, err error) {
 	// safety: we need to watch for the blocking worker thread's status.
 	// If it returns, no further data can be processed by the WASM module
 	// and we need to close this connection in that case.
-	go conn.closeOnWorkerError()
+	conn.tm.OnWorkerExit(conn.closeOnWorkerError)
 
 	if err := conn.tm.StartWorker(); err != nil {
 		return nil, err
 	}
 
+	conn.startIdleTimer(core.Config())
+
 	return conn, nil
 }
 
@@ -237,14 +347,53 @@ func (c *Conn) closeOnWorkerError() {
 	}
 	c.tmMutex.Unlock()
 
+	if tm == nil { // the worker thread exited as the Conn was closed
+		return
+	}
+
 	if err := tm.WaitWorker(); err != nil { // block until worker thread returns
 		log.LErrorf(core.Logger(), "water: WATMv1: worker thread returned with error: %v", err)
 		c.Close()
+	} else if a, b, ok := tm.PassthroughConns(); ok {
+		log.LDebugf(core.Logger(), "water: WATMv1: worker thread returned for passthrough")
+		c.passthrough(a, b)
 	} else {
 		log.LDebugf(core.Logger(), "water: WATMv1: worker thread returned")
 	}
 }
 
+// passthrough copies the data between a and b directly, bypassing the WATM,
+// until both directions are done. A Relay is then closed, while a Dialer or
+// Listener is left for the caller to close, which may still be reading.
+func (c *Conn) passthrough(a, b *net.TCPConn) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	copyHalf := func(dst, src *net.TCPConn) {
+		defer wg.Done()
+		_, _ = dst.ReadFrom(src) // splice(2) on Linux
+		_ = dst.CloseWrite()
+	}
+	go copyHalf(a, b)
+	go copyHalf(b, a)
+	wg.Wait()
+
+	if c.callerConn == nil {
+		c.Close()
+	}
+}
+
+// startIdleTimer makes the Conn close itself once no activity is observed
+// for the IdleTimeout, if set.
+func (c *Conn) startIdleTimer(config *water.Config) {
+	c.idle.Start(func() {
+		log.LDebugf(config.Logger(), "water: WATMv1: closing Conn idle for %v", config.IdleTimeout)
+		c.Close()
+		if config.OnIdleTimeout != nil {
+			config.OnIdleTimeout(c)
+		}
+	})
+}
+
 // Read implements the net.Conn interface.
 //
 // It calls to the underlying user-oriented connection's [net.Conn.Read] method.
@@ -253,7 +402,12 @@ func (c *Conn) Read(b []byte) (n int, err error) {
 		return 0, errors.New("water: cannot read, (*RuntimeConn).uoConn is nil")
 	}
 
-	return c.callerConn.Read(b)
+	n, err = c.callerConn.Read(b)
+	if n > 0 {
+		c.idle.Touch()
+		c.stats.RecordRead(int64(n))
+	}
+	return n, err
 }
 
 // Write implements the net.Conn interface.
@@ -265,6 +419,10 @@ func (c *Conn) Write(b []byte) (n int, err error) {
 	}
 
 	n, err = c.callerConn.Write(b)
+	if n > 0 {
+		c.idle.Touch()
+		c.stats.RecordWrite(int64(n))
+	}
 	if err != nil {
 		return n, fmt.Errorf("uoConn.Write: %w", err)
 	}
@@ -278,6 +436,81 @@ func (c *Conn) Write(b []byte) (n int, err error) {
 	}
 }
 
+// Writev writes the buffers to the WATM, in a single writev(2) system call
+// where supported, instead of one boundary crossing per buffer. It is
+// useful for applications writing, e.g., headers and body separately.
+func (c *Conn) Writev(buffers net.Buffers) (n int64, err error) {
+	if c.callerConn == nil {
+		return 0, errors.New("water: cannot write, (*RuntimeConn).uoConn is nil")
+	}
+
+	n, err = buffers.WriteTo(c.callerConn)
+	if n > 0 {
+		c.idle.Touch()
+		c.stats.RecordWrite(n)
+	}
+	if err != nil {
+		return n, fmt.Errorf("uoConn.Writev: %w", err)
+	}
+	return n, nil
+}
+
+// ReadFrom implements the io.ReaderFrom interface.
+//
+// It calls to the underlying user-oriented connection's ReadFrom method if
+// available, which may move the data with splice(2) or sendfile(2)
+// without copying it through the user space of the host.
+func (c *Conn) ReadFrom(r io.Reader) (n int64, err error) {
+	if c.callerConn == nil {
+		return 0, errors.New("water: cannot write, (*RuntimeConn).uoConn is nil")
+	}
+
+	n, err = io.Copy(c.callerConn, c.idle.TrackReader(r))
+	c.stats.RecordWrite(n)
+	if err != nil {
+		return n, fmt.Errorf("uoConn.ReadFrom: %w", err)
+	}
+	return n, nil
+}
+
+// WriteTo implements the io.WriterTo interface.
+//
+// It copies the data from the underlying user-oriented connection to w
+// with the ReadFrom method of w if available, e.g., that of a
+// *net.TCPConn, which may move the data with splice(2) without copying
+// it through the user space of the host.
+func (c *Conn) WriteTo(w io.Writer) (n int64, err error) {
+	if c.callerConn == nil {
+		return 0, errors.New("water: cannot read, (*RuntimeConn).uoConn is nil")
+	}
+
+	n, err = io.Copy(w, c.idle.TrackReader(c.callerConn))
+	c.stats.RecordRead(n)
+	if err != nil {
+		return n, fmt.Errorf("uoConn.WriteTo: %w", err)
+	}
+	return n, nil
+}
+
+// CloseRead shuts down the reading side of the connection, so no more
+// data from the WATM will be read.
+func (c *Conn) CloseRead() error {
+	if cr, ok := c.callerConn.(interface{ CloseRead() error }); ok {
+		return cr.CloseRead()
+	}
+	return errors.ErrUnsupported
+}
+
+// CloseWrite shuts down the writing side of the connection, so the WATM
+// reads EOF once it has read all data written before. Whether the
+// half-close is propagated to the remote depends on the WATM.
+func (c *Conn) CloseWrite() error {
+	if cw, ok := c.callerConn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return errors.ErrUnsupported
+}
+
 // Close implements the net.Conn interface.
 //
 // It will close both the network connection AND the WASM module, then
@@ -289,17 +522,54 @@ func (c *Conn) Close() (err error) {
 	}
 
 	c.closeOnce.Do(func() {
+		c.idle.Stop()
+
 		c.tmMutex.Lock()
 		if c.tm != nil {
+			c.closedSession = c.tm.Session()
+			c.closedReason = c.tm.CloseReason()
+			c.closedMetadata = c.tm.Metadata()
+			c.closedNetConns = c.tm.NetworkConns()
+			core := c.tm.Core()
 			err = c.tm.Close()
 			c.tm = nil
+
+			// the memory is inspected once the worker thread has exited
+			if core != nil {
+				c.recordPeakMemorySize(core.MemorySize())
+			}
 		}
+		onClose, trace := c.onClose, c.trace
 		c.tmMutex.Unlock()
+
+		// callerConn is owned by the Conn and not managed by the WATM
+		if c.callerConn != nil {
+			c.callerConn.Close()
+		}
+
+		if onClose != nil {
+			onClose()
+		}
+		if trace != nil {
+			trace.Closed(c)
+		}
 	})
 
 	return err
 }
 
+// traceClose makes the Conn report its closing to trace.
+func (c *Conn) traceClose(trace *driver.DialTrace) {
+	c.tmMutex.Lock()
+	c.trace = trace
+	c.tmMutex.Unlock()
+
+	// the connection might have been closed before trace was set
+	if c.closed.Load() {
+		trace.Closed(c)
+	}
+}
+
 // LocalAddr implements the net.Conn interface.
 //
 // It calls to the underlying network connection's [net.Conn.LocalAddr] method.
@@ -326,6 +596,46 @@ func (c *Conn) RemoteAddr() net.Addr {
 	return c.dstConn.RemoteAddr() // for dialer
 }
 
+// NetConn implements [water.Conn].
+//
+// For Listener and Relay, the network connection returned is the srcConn.
+// And for Dialer, the network connection returned is the dstConn.
+func (c *Conn) NetConn() net.Conn {
+	// for Listener and Relay, the srcConn is of interest
+	if c.srcConn != nil {
+		return c.srcConn
+	}
+	return c.dstConn // for dialer
+}
+
+// NetConns implements [water.Conn]. The network connections, closed,
+// remain available once the Conn is closed.
+func (c *Conn) NetConns() []net.Conn {
+	c.tmMutex.Lock()
+	defer c.tmMutex.Unlock()
+
+	if c.tm != nil {
+		return c.tm.NetworkConns()
+	}
+	return append([]net.Conn(nil), c.closedNetConns...)
+}
+
+// SyscallConn implements [water.Conn].
+//
+// For Dialer and Listener, the raw connection returned is the one of the
+// callerConn. For Relay, there is none.
+func (c *Conn) SyscallConn() (syscall.RawConn, error) {
+	return socket.SyscallConn(c.callerConn)
+}
+
+// File implements [water.Conn].
+//
+// For Dialer and Listener, the file returned is a copy of the callerConn.
+// For Relay, there is none.
+func (c *Conn) File() (*os.File, error) {
+	return socket.File(c.callerConn)
+}
+
 // SetDeadline implements the net.Conn interface.
 //
 // It calls to the underlying connections' [net.Conn.SetDeadline] method.
@@ -352,7 +662,12 @@ func (c *Conn) SetDeadline(t time.Time) (err error) {
 		}
 	}
 
-	return c.callerConn.SetDeadline(t)
+	if err = c.callerConn.SetDeadline(t); err != nil {
+		return err
+	}
+
+	c.propagateDeadline(t, true, true)
+	return nil
 }
 
 // SetReadDeadline implements the net.Conn interface.
@@ -364,7 +679,12 @@ func (c *Conn) SetReadDeadline(t time.Time) error {
 		return errors.New("water: cannot set deadline, (*RuntimeConn).callerConn is nil")
 	}
 
-	return c.callerConn.SetReadDeadline(t)
+	if err := c.callerConn.SetReadDeadline(t); err != nil {
+		return err
+	}
+
+	c.propagateDeadline(t, true, false)
+	return nil
 }
 
 // SetWriteDeadline implements the net.Conn interface.
@@ -376,5 +696,116 @@ func (c *Conn) SetWriteDeadline(t time.Time) error {
 		return errors.New("water: cannot set deadline, (*RuntimeConn).callerConn is nil")
 	}
 
-	return c.callerConn.SetWriteDeadline(t)
+	if err := c.callerConn.SetWriteDeadline(t); err != nil {
+		return err
+	}
+
+	c.propagateDeadline(t, false, true)
+	return nil
+}
+
+// propagateDeadline communicates the deadline to the WATM, which may query
+// it with `env.water_get_deadline`.
+func (c *Conn) propagateDeadline(t time.Time, read, write bool) {
+	c.tmMutex.Lock()
+	defer c.tmMutex.Unlock()
+
+	if c.tm == nil {
+		return
+	}
+
+	if read {
+		c.tm.SetReadDeadline(t)
+	}
+	if write {
+		c.tm.SetWriteDeadline(t)
+	}
+}
+
+// Stats returns a snapshot of the data read from and written to the Conn.
+//
+// Implements [water.Conn].
+func (c *Conn) Stats() water.ConnStats {
+	return c.stats.Stats()
+}
+
+// RuntimeStats returns a snapshot of the resources used by the WebAssembly
+// instance behind the Conn.
+//
+// Implements [water.Conn].
+func (c *Conn) RuntimeStats() water.RuntimeStats {
+	var stats water.RuntimeStats
+
+	c.tmMutex.Lock()
+	if c.tm != nil {
+		stats = c.tm.RuntimeStats()
+	}
+	c.tmMutex.Unlock()
+
+	c.recordPeakMemorySize(stats.MemorySize)
+	stats.PeakMemorySize = c.peakMemorySize.Load()
+
+	if callerConn, ok := c.callerConn.(*net.TCPConn); ok && !c.closed.Load() {
+		if read, write, err := socket.BufferSizes(callerConn); err == nil {
+			stats.ReadBufferSize, stats.WriteBufferSize = read, write
+			stats.HostBufferSize += read + write
+		}
+	}
+
+	return stats
+}
+
+// ExportSession implements [water.Conn]. The session exported by the WATM
+// remains available once the Conn is closed.
+func (c *Conn) ExportSession() []byte {
+	c.tmMutex.Lock()
+	defer c.tmMutex.Unlock()
+
+	var session []byte
+	if c.tm != nil {
+		session = c.tm.Session()
+	} else {
+		session = c.closedSession
+	}
+	return append([]byte(nil), session...)
+}
+
+// CloseReason implements [water.Conn]. The close reason reported by the
+// WATM remains available once the Conn is closed.
+func (c *Conn) CloseReason() water.CloseReason {
+	c.tmMutex.Lock()
+	defer c.tmMutex.Unlock()
+
+	if c.tm != nil {
+		return c.tm.CloseReason()
+	}
+	return c.closedReason
+}
+
+// Metadata implements [water.Conn]. The metadata attached by the WATM remains
+// available once the Conn is closed.
+func (c *Conn) Metadata() map[string]string {
+	c.tmMutex.Lock()
+	defer c.tmMutex.Unlock()
+
+	if c.tm != nil {
+		return c.tm.Metadata()
+	}
+	if len(c.closedMetadata) == 0 {
+		return nil
+	}
+	metadata := make(map[string]string, len(c.closedMetadata))
+	for k, v := range c.closedMetadata {
+		metadata[k] = v
+	}
+	return metadata
+}
+
+func (c *Conn) recordPeakMemorySize(size uint64) {
+	for {
+		peak := c.peakMemorySize.Load()
+		if size <= peak || c.peakMemorySize.CompareAndSwap(peak, size) {
+			return
+		}
+	}
 }
@@ -8,10 +8,16 @@ type CtrlPipe struct {
 
 // CONTROL MESSAGE
 var (
-	_CTRLPIPE_EXIT = []byte{0x00}
+	_CTRLPIPE_EXIT      = []byte{0x00}
+	_CTRLPIPE_KEEPALIVE = []byte{0x01} // only sent to WATMs exporting watm_keepalive_v1
 )
 
 func (c *CtrlPipe) WriteExit() error {
 	_, err := c.Conn.Write(_CTRLPIPE_EXIT)
 	return err
 }
+
+func (c *CtrlPipe) WriteKeepalive() error {
+	_, err := c.Conn.Write(_CTRLPIPE_KEEPALIVE)
+	return err
+}
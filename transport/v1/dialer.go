@@ -3,8 +3,13 @@ package v1
 import (
 	"context"
 	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
 
 	"github.com/refraction-networking/water"
+	"github.com/refraction-networking/water/internal/driver"
+	"github.com/refraction-networking/water/internal/log"
 )
 
 func init() {
@@ -19,6 +24,11 @@ type Dialer struct {
 	config *water.Config
 	ctx    context.Context
 
+	warm      []*warmInstance // instances prepared by Warm, protected by warmMutex
+	warmMutex sync.Mutex
+	warmDials atomic.Uint64
+	coldDials atomic.Uint64
+
 	water.UnimplementedDialer // embedded to ensure forward compatibility
 }
 
@@ -34,8 +44,13 @@ func NewDialer(c *water.Config) (water.Dialer, error) {
 //
 // The context is used as the default context for call to [Dialer.Dial].
 func NewDialerWithContext(ctx context.Context, c *water.Config) (water.Dialer, error) {
+	config, err := driver.Snapshot(c)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Dialer{
-		config: c.Clone(),
+		config: config,
 		ctx:    ctx,
 	}, nil
 }
@@ -48,6 +63,9 @@ func (d *Dialer) Dial(network, address string) (conn water.Conn, err error) {
 }
 
 // DialContext dials the network address using the dialerFunc specified in config.
+// A *water.TransportTypeMismatchError is returned if the network does not
+// match the transport type declared by the WATM, see [water.Config.CheckNetwork].
+// An instance warmed by [Dialer.Warm] is used if available.
 //
 // The context is passed to [water.NewCoreWithContext] to control the lifetime of
 // the call to function calls into the WebAssembly module.
@@ -62,22 +80,217 @@ func (d *Dialer) DialContext(ctx context.Context, network, address string) (conn
 		return nil, fmt.Errorf("water: dialing with nil config is not allowed")
 	}
 
+	if err := d.config.CheckNetwork(network); err != nil {
+		return nil, err
+	}
+
+	trace := driver.StartDialTrace(d.config, network, address)
+	warm := d.takeWarm(ctx)
+
+	// the results of the dial are not returned directly, as the dial
+	// may still complete after returning once ctx is done
+	var dialConn water.Conn
+	var dialErr error
 	ctxReady, dialReady := context.WithCancel(context.Background())
 	go func() {
 		defer dialReady()
+		defer func() {
+			trace.HandshakeComplete(dialConn, dialErr)
+			if conn, ok := dialConn.(*Conn); ok {
+				conn.traceClose(trace)
+			}
+		}()
+
+		if warm != nil {
+			dialConn, dialErr = warm.dial(ctx, network, address, trace)
+			return
+		}
+
 		var core water.Core
-		core, err = water.NewCoreWithContext(ctx, d.config)
-		if err != nil {
+		core, dialErr = water.NewCoreWithContext(ctx, d.config)
+		if dialErr != nil {
 			return
 		}
 
-		conn, err = dial(core, network, address)
+		dialConn, dialErr = dial(core, network, address, trace)
 	}()
 
 	select {
 	case <-ctx.Done():
 		return nil, ctx.Err()
 	case <-ctxReady.Done():
-		return conn, err
+		return dialConn, dialErr
+	}
+}
+
+// DialWithConn runs the WATM over an existing connection instead of dialing
+// a new one. The returned Conn takes the ownership of existingConn, which
+// is closed if an error is returned.
+//
+// The context is passed to [water.NewCoreWithContext] to control the lifetime of
+// the call to function calls into the WebAssembly module.
+//
+// Implements [water.Dialer].
+func (d *Dialer) DialWithConn(ctx context.Context, existingConn net.Conn) (conn water.Conn, err error) {
+	if existingConn == nil {
+		return nil, fmt.Errorf("water: dialing with nil connection is not allowed")
+	}
+
+	if d.config == nil {
+		existingConn.Close()
+		return nil, fmt.Errorf("water: dialing with nil config is not allowed")
+	}
+
+	type dialResult struct {
+		conn water.Conn
+		err  error
+	}
+
+	results := make(chan dialResult, 1)
+	go func() {
+		core, err := water.NewCoreWithContext(ctx, d.config)
+		if err != nil {
+			existingConn.Close()
+			results <- dialResult{nil, err}
+			return
+		}
+
+		conn, err := dialWithConn(core, existingConn)
+		if err != nil {
+			existingConn.Close()
+		}
+		results <- dialResult{conn, err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		// the dial may still complete after returning, in which case the
+		// Conn nobody receives is closed along with existingConn
+		existingConn.Close()
+		go func() {
+			if res := <-results; res.conn != nil {
+				res.conn.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	case res := <-results:
+		return res.conn, res.err
+	}
+}
+
+// warmInstance is a WASM instance initialized as a dialer ahead of time,
+// whose networkDialer is given the address to dial only once used.
+type warmInstance struct {
+	conn   *Conn
+	dialer *networkDialer
+}
+
+// dial drives the warmed instance to dial the network address, reporting
+// its progress to trace. Since the instance was created before ctx is
+// known, the returned Conn is closed once ctx is done instead.
+func (w *warmInstance) dial(ctx context.Context, network, address string, trace *driver.DialTrace) (water.Conn, error) {
+	w.dialer.overrideAddress.network = network
+	w.dialer.overrideAddress.address = address
+	w.dialer.dialerFunc = trace.DialerFunc(w.conn.tm.Core().Config().NetworkDialerFuncWithContext(ctx))
+
+	conn, err := w.conn.finishDial()
+	if err != nil {
+		w.conn.tm.Core().Close()
+		return nil, err
+	}
+
+	context.AfterFunc(ctx, func() { conn.Close() })
+	return conn, nil
+}
+
+// Warm compiles and instantiates n WASM instances in the background, so
+// that the next n calls to DialContext skip the cold-start latency. The
+// instances are created with the context the Dialer was created with, as
+// is the case for Dial, and ctx only stops the warming early.
+//
+// A context carrying module arguments or environment variables (see
+// [water.WithModuleEnv]) passed to DialContext makes it skip the warmed
+// instances, which would miss them.
+//
+// Implements [water.Dialer].
+func (d *Dialer) Warm(ctx context.Context, n int) error {
+	if d.config == nil {
+		return fmt.Errorf("water: warming with nil config is not allowed")
+	}
+
+	go func() {
+		for i := 0; i < n && ctx.Err() == nil; i++ {
+			warm, err := d.newWarmInstance()
+			if err != nil {
+				log.LErrorf(d.config.Logger(), "water: warming instance: %v", err)
+				return
+			}
+
+			d.warmMutex.Lock()
+			d.warm = append(d.warm, warm)
+			d.warmMutex.Unlock()
+		}
+	}()
+
+	return nil
+}
+
+func (d *Dialer) newWarmInstance() (*warmInstance, error) {
+	ctx := d.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	core, err := water.NewCoreWithContext(ctx, d.config)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &networkDialer{
+		dialerFunc:       d.config.NetworkDialerFuncWithContext(ctx),
+		addressValidator: dialedAddressValidator(d.config),
+	}
+	conn, err := prepareDial(core, dialer)
+	if err != nil {
+		core.Close()
+		return nil, err
+	}
+
+	return &warmInstance{conn: conn, dialer: dialer}, nil
+}
+
+// takeWarm takes a warmed instance usable with ctx, if any, and counts the
+// dial as warm or cold accordingly.
+func (d *Dialer) takeWarm(ctx context.Context) *warmInstance {
+	var warm *warmInstance
+	if !driver.ContextHasModuleEnviron(ctx) {
+		d.warmMutex.Lock()
+		if len(d.warm) > 0 {
+			warm = d.warm[0]
+			d.warm = d.warm[1:]
+		}
+		d.warmMutex.Unlock()
+	}
+
+	if warm != nil {
+		d.warmDials.Add(1)
+	} else {
+		d.coldDials.Add(1)
+	}
+	return warm
+}
+
+// DialStats returns the counters of warm and cold dials by DialContext.
+//
+// Implements [water.Dialer].
+func (d *Dialer) DialStats() water.DialStats {
+	d.warmMutex.Lock()
+	warm := len(d.warm)
+	d.warmMutex.Unlock()
+
+	return water.DialStats{
+		Warm:      warm,
+		WarmDials: d.warmDials.Load(),
+		ColdDials: d.coldDials.Load(),
 	}
 }
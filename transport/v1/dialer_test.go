@@ -4,12 +4,21 @@ import (
 	"bytes"
 	"context"
 	"crypto/rand"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
+	"math"
 	"net"
+	"net/netip"
+	"os"
+	"runtime"
+	"syscall"
 	"testing"
 	"time"
 
 	"github.com/refraction-networking/water"
+	"github.com/refraction-networking/water/internal/wasip1"
 	v1 "github.com/refraction-networking/water/transport/v1"
 )
 
@@ -78,167 +87,221 @@ func ExampleDialer() {
 //  3. Dialer must fail when an invalid address is supplied.
 //  4. Dialer must fail when a WebAssembly Transport Module does not
 //     fully implement the v1 dialer spec.
+//  5. Dialer must work over an existing non-TCP connection.
+//  6. Conn must report the runtime stats of its WebAssembly instance.
+//  7. Conn must expose the network connection to the remote destination.
 func TestDialer(t *testing.T) {
 	t.Run("plain must work", testDialerPlain)
 	t.Run("reverse must work", testDialerReverse)
 	t.Run("bad addr must fail", testDialerBadAddr)
 	t.Run("partial WATM must fail", testDialerPartialWATM)
+	t.Run("existing conn must work", testDialerWithConn)
+	t.Run("existing conn must be closed if the Core fails", testDialerWithConnCoreError)
+	t.Run("existing conn must be closed once the context is done", testDialerWithConnContextDone)
+	t.Run("runtime stats must work", testDialerRuntimeStats)
+	t.Run("memory grown by the worker must be reported", testDialerRuntimeStatsMemoryGrow)
+	t.Run("buffer sizes must be applied", testDialerBufferSizes)
+	t.Run("passthrough must work", testDialerPassthrough)
+	t.Run("session must be resumed", testDialerSession)
+	t.Run("net conn must be exposed", testDialerNetConn)
+	t.Run("vectored writes must work", testDialerWritev)
+	t.Run("WriteTo must copy from the WATM", testDialerWriteTo)
+	t.Run("transport chain must work", testDialerTransportChain)
+	t.Run("warm instances must be used", testDialerWarm)
+	t.Run("idle connection must be closed", testDialerIdleTimeout)
+	t.Run("keepalives must be delivered to the WATM", testDialerKeepalive)
+	t.Run("writes must be shaped as the Shaper decides", testDialerShaper)
+	t.Run("raw connection must be exposed", testDialerSyscallConn)
+	t.Run("logical destination must be reported to the WATM", testDialerRemoteAddress)
+	t.Run("bandwidth must be limited", testDialerBandwidthLimit)
+	t.Run("close reason must be reported by the WATM", testDialerCloseReason)
+	t.Run("conn stats must be recorded", testDialerConnStats)
+	t.Run("metadata must be attached by the WATM", testDialerMetadata)
+	t.Run("multiple outbound conns must be tracked", testDialerMultipath)
+	t.Run("path info must be provided to WATM", testDialerPathInfo)
+	t.Run("raw socket must be allowed explicitly", testDialerRaw)
+	t.Run("TUN device must be provided to WATM", testDialerTUN)
+	t.Run("lifecycle callbacks must be called in order", testDialerLifecycle)
+	t.Run("entropy source must be consumed by random_get", testDialerEntropySource)
+	t.Run("clock must be observed by WATM", testDialerClock)
+	t.Run("deadlines must be observed by WATM", testDialerDeadline)
+	t.Run("credentials must be provided to WATM", testDialerCredential)
 }
 
-func testDialerBadAddr(t *testing.T) {
-	// Dial
+func testDialerNetConn(t *testing.T) {
+	tcpLis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcpLis.Close() // skipcq: GO-S2307
+
 	config := &water.Config{
 		TransportModuleBin:  wasmPlain,
 		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
 	}
-
 	dialer, err := v1.NewDialerWithContext(context.Background(), config)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	_, err = dialer.DialContext(context.Background(), "tcp", "256.267.278.289:2023")
-	if err == nil {
-		t.Fatal("dialer.Dial should fail")
+	conn, err := dialer.DialContext(context.Background(), "tcp", tcpLis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
 	}
-}
+	defer conn.Close() // skipcq: GO-S2307
 
-func testDialerPlain(t *testing.T) { // skipcq: GO-R1005
-	tcpLis, err := net.Listen("tcp", "localhost:0")
+	peerConn, err := tcpLis.Accept()
 	if err != nil {
 		t.Fatal(err)
 	}
-	defer tcpLis.Close() // skipcq: GO-S2307
+	defer peerConn.Close() // skipcq: GO-S2307
 
-	// Dial using water
+	netConn, ok := conn.NetConn().(*net.TCPConn)
+	if !ok {
+		t.Fatalf("NetConn() returned %T, want *net.TCPConn", conn.NetConn())
+	}
+	if netConn.RemoteAddr().String() != peerConn.LocalAddr().String() {
+		t.Fatalf("NetConn() is connected to %s, want %s", netConn.RemoteAddr(), peerConn.LocalAddr())
+	}
+
+	if stats := conn.RuntimeStats(); stats.HostBufferSize == 0 {
+		t.Errorf("HostBufferSize must not be 0 over TCP")
+	}
+
+	// socket options must be tunable without disturbing the transport
+	if err := netConn.SetNoDelay(false); err != nil {
+		t.Fatal(err)
+	}
+	if err := sanityCheckConn(conn, peerConn, []byte("hello"), []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testDialerRuntimeStats(t *testing.T) {
 	config := &water.Config{
 		TransportModuleBin:  wasmPlain,
 		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
 	}
+
 	dialer, err := v1.NewDialerWithContext(context.Background(), config)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	conn, err := dialer.DialContext(context.Background(), "tcp", tcpLis.Addr().String())
+	existingConn, peerConn := net.Pipe()
+	defer peerConn.Close() // skipcq: GO-S2307
+
+	conn, err := dialer.DialWithConn(context.Background(), existingConn)
 	if err != nil {
 		t.Fatal(err)
 	}
 	defer conn.Close() // skipcq: GO-S2307
 
-	// type assertion: conn must be *v1.Conn
-	if _, ok := conn.(*v1.Conn); !ok {
-		t.Fatalf("returned conn is not *v1.Conn")
+	stats := conn.RuntimeStats()
+	if stats.MemorySize == 0 {
+		t.Errorf("MemorySize must not be 0")
+	}
+	if stats.PeakMemorySize != stats.MemorySize {
+		t.Errorf("PeakMemorySize = %d, want %d", stats.PeakMemorySize, stats.MemorySize)
+	}
+	if stats.HostConns < 2 { // callerConn and dstConn
+		t.Errorf("HostConns = %d, want at least 2", stats.HostConns)
 	}
 
-	peerConn, err := tcpLis.Accept()
-	if err != nil {
+	if err = conn.Close(); err != nil {
 		t.Fatal(err)
 	}
-	defer peerConn.Close() // skipcq: GO-S2307
-
-	tripleGC(100 * time.Microsecond)
-
-	var waterSendBuf []byte = make([]byte, 1024)
-	var peerSendBuf []byte = make([]byte, 1024)
-	var waterRecvBuf []byte = make([]byte, 1024)
-	var peerRecvBuf []byte = make([]byte, 1024)
-	// send 10 messages in each direction
-	for i := 0; i < 10; i++ {
-		_, err = rand.Read(waterSendBuf)
-		if err != nil {
-			t.Fatalf("rand.Read error: %s", err)
-		}
-
-		_, err = rand.Read(peerSendBuf)
-		if err != nil {
-			t.Fatalf("rand.Read error: %s", err)
-		}
 
-		// dialer -> listener
-		_, err = conn.Write(waterSendBuf)
-		if err != nil {
-			t.Fatalf("conn.Write error: %s", err)
-		}
-
-		n, err := peerConn.Read(peerRecvBuf)
-		if err != nil {
-			t.Fatalf("peerConn.Read error: %s", err)
-		}
+	closedStats := conn.RuntimeStats()
+	if closedStats.MemorySize != 0 {
+		t.Errorf("MemorySize = %d after Close, want 0", closedStats.MemorySize)
+	}
+	if closedStats.PeakMemorySize != stats.PeakMemorySize {
+		t.Errorf("PeakMemorySize = %d after Close, want %d", closedStats.PeakMemorySize, stats.PeakMemorySize)
+	}
+}
 
-		if n != len(waterSendBuf) {
-			t.Fatalf("peerConn.Read error: read %d bytes, want %d bytes", n, len(waterSendBuf))
-		}
+func testDialerRuntimeStatsMemoryGrow(t *testing.T) {
+	config := &water.Config{
+		TransportModuleBin:  wasmMemoryGrow,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+	}
 
-		if !bytes.Equal(peerRecvBuf[:n], waterSendBuf) {
-			t.Fatalf("peerRecvBuf != waterSendBuf")
-		}
+	dialer, err := v1.NewDialerWithContext(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
 
-		// listener -> dialer
-		_, err = peerConn.Write(peerSendBuf)
-		if err != nil {
-			t.Fatalf("peerConn.Write error: %s", err)
-		}
+	existingConn, peerConn := net.Pipe()
+	defer peerConn.Close() // skipcq: GO-S2307
 
-		n, err = conn.Read(waterRecvBuf)
-		if err != nil {
-			t.Fatalf("conn.Read error: %s", err)
-		}
+	conn, err := dialer.DialWithConn(context.Background(), existingConn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close() // skipcq: GO-S2307
 
-		if n != len(peerSendBuf) {
-			t.Fatalf("conn.Read error: read %d bytes, want %d bytes", n, len(peerSendBuf))
-		}
+	// the worker writes 1 byte once it grew the memory by a page, then
+	// keeps running until closed
+	if _, err := io.ReadFull(peerConn, make([]byte, 1)); err != nil {
+		t.Fatal(err)
+	}
 
-		if !bytes.Equal(waterRecvBuf[:n], peerSendBuf) {
-			t.Fatalf("waterRecvBuf != peerSendBuf")
-		}
+	stats := conn.RuntimeStats()
+	if stats.MemorySize != 2<<16 {
+		t.Errorf("MemorySize = %d while the worker runs, want %d", stats.MemorySize, 2<<16)
+	}
+	if stats.PeakMemorySize != stats.MemorySize {
+		t.Errorf("PeakMemorySize = %d, want %d", stats.PeakMemorySize, stats.MemorySize)
+	}
+}
 
-		tripleGC(100 * time.Microsecond)
+func testDialerBufferSizes(t *testing.T) {
+	config := &water.Config{
+		TransportModuleBin:  wasmPlain,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+		ReadBufferSize:      32 << 10,
+		WriteBufferSize:     16 << 10,
 	}
 
-	// reading with a deadline
-	err = conn.SetDeadline(time.Now().Add(100 * time.Millisecond))
+	dialer, err := v1.NewDialerWithContext(context.Background(), config)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	_, err = conn.Read(waterRecvBuf)
-	if err == nil {
-		t.Fatalf("conn.Read must timeout")
-	}
+	existingConn, peerConn := net.Pipe()
+	defer peerConn.Close() // skipcq: GO-S2307
 
-	if err := conn.Close(); err != nil {
+	conn, err := dialer.DialWithConn(context.Background(), existingConn)
+	if err != nil {
 		t.Fatal(err)
 	}
+	defer conn.Close() // skipcq: GO-S2307
 
-	// after closing the conn, read/write MUST fail
-	_, err = conn.Write(waterSendBuf)
-	if err == nil {
-		t.Fatalf("conn.Write must fail after closing the conn")
+	// the operating system may round up the sizes set, e.g., Linux doubles
+	// them, but must not make them smaller
+	stats := conn.RuntimeStats()
+	if stats.ReadBufferSize < config.ReadBufferSize {
+		t.Errorf("ReadBufferSize = %d, want at least %d", stats.ReadBufferSize, config.ReadBufferSize)
 	}
-
-	_, err = conn.Read(waterRecvBuf)
-	if err == nil {
-		t.Fatalf("conn.Read must fail after closing the conn")
+	if stats.WriteBufferSize < config.WriteBufferSize || stats.WriteBufferSize >= stats.ReadBufferSize {
+		t.Errorf("WriteBufferSize = %d, want at least %d and less than ReadBufferSize", stats.WriteBufferSize, config.WriteBufferSize)
 	}
 
-	if err := tcpLis.Close(); err != nil {
+	if err := sanityCheckConn(conn, peerConn, []byte("hello"), []byte("hello")); err != nil {
 		t.Fatal(err)
 	}
-
-	tripleGC(100 * time.Microsecond)
 }
 
-func testDialerReverse(t *testing.T) { // skipcq: GO-R1005
+func testDialerPassthrough(t *testing.T) {
 	tcpLis, err := net.Listen("tcp", "localhost:0")
 	if err != nil {
 		t.Fatal(err)
 	}
 	defer tcpLis.Close() // skipcq: GO-S2307
 
-	// Dial using water
 	config := &water.Config{
-		TransportModuleBin:  wasmReverse,
+		TransportModuleBin:  wasmPassthrough,
 		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
 	}
 	dialer, err := v1.NewDialerWithContext(context.Background(), config)
@@ -252,373 +315,1541 @@ func testDialerReverse(t *testing.T) { // skipcq: GO-R1005
 	}
 	defer conn.Close() // skipcq: GO-S2307
 
-	// type assertion: conn must be *v1.Conn
-	if _, ok := conn.(*v1.Conn); !ok {
-		t.Fatalf("returned conn is not *v1.Conn")
-	}
-
 	peerConn, err := tcpLis.Accept()
 	if err != nil {
 		t.Fatal(err)
 	}
 	defer peerConn.Close() // skipcq: GO-S2307
 
-	tripleGC(100 * time.Microsecond)
+	// the WATM copies nothing, so the data must be copied by the host
+	if err = sanityCheckConn(conn, peerConn, []byte("hello"), []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if err = sanityCheckConn(peerConn, conn, []byte("world"), []byte("world")); err != nil {
+		t.Fatal(err)
+	}
 
-	var waterSendBuf []byte = make([]byte, 1024)
-	var peerSendBuf []byte = make([]byte, 1024)
-	var waterRecvBuf []byte = make([]byte, 1024)
-	var peerRecvBuf []byte = make([]byte, 1024)
-	// send 10 messages in each direction
-	for i := 0; i < 10; i++ {
-		_, err = rand.Read(waterSendBuf)
-		if err != nil {
-			t.Fatalf("rand.Read error: %s", err)
-		}
+	// data sent right before the peer closes must still be read
+	if _, err := peerConn.Write([]byte("bye")); err != nil {
+		t.Fatal(err)
+	}
+	peerConn.Close()
+	if err := conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	received, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(received) != "bye" {
+		t.Fatalf("received %q, want %q", received, "bye")
+	}
+}
 
-		_, err = rand.Read(peerSendBuf)
-		if err != nil {
-			t.Fatalf("rand.Read error: %s", err)
-		}
+func testDialerSession(t *testing.T) {
+	tcpLis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcpLis.Close() // skipcq: GO-S2307
 
-		// dialer -> listener
-		_, err = conn.Write(waterSendBuf)
-		if err != nil {
-			t.Fatalf("conn.Write error: %s", err)
-		}
+	config := &water.Config{
+		TransportModuleBin:  wasmSession,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+	}
 
-		n, err := peerConn.Read(peerRecvBuf)
+	exportSession := func(config *water.Config) []byte {
+		dialer, err := v1.NewDialerWithContext(context.Background(), config)
 		if err != nil {
-			t.Fatalf("peerConn.Read error: %s", err)
+			t.Fatal(err)
 		}
 
-		if n != len(waterSendBuf) {
-			t.Fatalf("peerConn.Read error: read %d bytes, want %d bytes", n, len(waterSendBuf))
-		}
-
-		// reverse the waterSendBuf
-		for i := 0; i < len(waterSendBuf)/2; i++ {
-			waterSendBuf[i], waterSendBuf[len(waterSendBuf)-1-i] = waterSendBuf[len(waterSendBuf)-1-i], waterSendBuf[i]
-		}
-
-		if !bytes.Equal(peerRecvBuf[:n], waterSendBuf) {
-			t.Fatalf("peerRecvBuf != waterSendBuf")
-		}
-
-		// listener -> dialer
-		_, err = peerConn.Write(peerSendBuf)
+		conn, err := dialer.DialContext(context.Background(), "tcp", tcpLis.Addr().String())
 		if err != nil {
-			t.Fatalf("peerConn.Write error: %s", err)
+			t.Fatal(err)
 		}
+		defer conn.Close() // skipcq: GO-S2307
 
-		n, err = conn.Read(waterRecvBuf)
+		peerConn, err := tcpLis.Accept()
 		if err != nil {
-			t.Fatalf("conn.Read error: %s", err)
+			t.Fatal(err)
 		}
+		defer peerConn.Close() // skipcq: GO-S2307
 
-		if n != len(peerSendBuf) {
-			t.Fatalf("conn.Read error: read %d bytes, want %d bytes", n, len(peerSendBuf))
+		// the session must remain available once the Conn is closed
+		if err := conn.Close(); err != nil {
+			t.Fatal(err)
 		}
+		return conn.ExportSession()
+	}
 
-		// reverse the peerSendBuf
-		for i := 0; i < len(peerSendBuf)/2; i++ {
-			peerSendBuf[i], peerSendBuf[len(peerSendBuf)-1-i] = peerSendBuf[len(peerSendBuf)-1-i], peerSendBuf[i]
-		}
+	if session := exportSession(config); string(session) != "new" {
+		t.Fatalf("ExportSession() = %q, want %q", session, "new")
+	}
 
-		if !bytes.Equal(waterRecvBuf[:n], peerSendBuf) {
-			t.Fatalf("waterRecvBuf != peerSendBuf")
-		}
+	if session := exportSession(config.ResumeSession([]byte("ticket"))); string(session) != "ticket" {
+		t.Fatalf("ExportSession() = %q, want %q", session, "ticket")
+	}
+}
 
-		tripleGC(100 * time.Microsecond)
+func testDialerWithConn(t *testing.T) {
+	config := &water.Config{
+		TransportModuleBin:  wasmReverse,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
 	}
 
-	// reading with a deadline
-	err = conn.SetDeadline(time.Now().Add(100 * time.Millisecond))
+	dialer, err := v1.NewDialerWithContext(context.Background(), config)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	_, err = conn.Read(waterRecvBuf)
-	if err == nil {
-		t.Fatalf("conn.Read must timeout")
+	existingConn, peerConn := net.Pipe()
+	defer peerConn.Close() // skipcq: GO-S2307
+
+	conn, err := dialer.DialWithConn(context.Background(), existingConn)
+	if err != nil {
+		t.Fatal(err)
 	}
+	defer conn.Close() // skipcq: GO-S2307
 
-	if err := conn.Close(); err != nil {
+	if err = sanityCheckConn(conn, peerConn, []byte("hello"), []byte("olleh")); err != nil {
 		t.Fatal(err)
 	}
 
-	// after closing the conn, read/write MUST fail
-	_, err = conn.Write(waterSendBuf)
-	if err == nil {
-		t.Fatalf("conn.Write must fail after closing the conn")
+	if err = sanityCheckConn(peerConn, conn, []byte("world"), []byte("dlrow")); err != nil {
+		t.Fatal(err)
 	}
+}
 
-	_, err = conn.Read(waterRecvBuf)
-	if err == nil {
-		t.Fatalf("conn.Read must fail after closing the conn")
+func testDialerWithConnCoreError(t *testing.T) {
+	config := &water.Config{
+		TransportModuleBin:  []byte("not a WATM"),
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
 	}
 
-	if err := tcpLis.Close(); err != nil {
+	dialer, err := v1.NewDialerWithContext(context.Background(), config)
+	if err != nil {
 		t.Fatal(err)
 	}
 
-	tripleGC(100 * time.Microsecond)
-}
+	existingConn, peerConn := net.Pipe()
+	defer peerConn.Close() // skipcq: GO-S2307
 
-func testDialerPartialWATM(t *testing.T) {
-	t.Skip("skipping [testDialerPartialWATM]...") // TODO: implement this with a few WebAssembly Transport Modules which partially implement the v1 dialer spec
+	if conn, err := dialer.DialWithConn(context.Background(), existingConn); err == nil {
+		conn.Close()
+		t.Fatal("DialWithConn must fail with an invalid WATM")
+	}
+
+	peerConn.SetReadDeadline(time.Now().Add(time.Second)) // nolint: errcheck
+	if _, err := peerConn.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+		t.Errorf("peerConn.Read() error = %v, want %v as existingConn must be closed", err, io.EOF)
+	}
 }
 
-// BenchmarkDialerOutbound currently measures only the outbound throughput
-// of the dialer. Inbound throughput is measured for the listener instead.
-//
-// Separate benchmark for the latency measurement will be needed.
-func BenchmarkDialerOutbound(b *testing.B) {
-	// create random TCP listener listening on localhost
+func testDialerWithConnContextDone(t *testing.T) {
+	config := &water.Config{
+		TransportModuleBin:   wasmDialSlow,
+		ModuleConfigFactory:  water.NewWazeroModuleConfigFactory(),
+		RuntimeConfigFactory: water.NewWazeroRuntimeConfigFactory(),
+	}
+	// the dial is not interrupted, but completes after DialWithConn
+	// returns, and the Conn nobody receives must be closed then
+	config.RuntimeConfigFactory.SetCloseOnContextDone(false)
+
+	dialer, err := v1.NewDialerWithContext(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	existingConn, peerConn := net.Pipe()
+	defer peerConn.Close() // skipcq: GO-S2307
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if conn, err := dialer.DialWithConn(ctx, existingConn); !errors.Is(err, context.DeadlineExceeded) {
+		if conn != nil {
+			conn.Close()
+		}
+		t.Fatalf("DialWithConn() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	peerConn.SetReadDeadline(time.Now().Add(time.Second)) // nolint: errcheck
+	if _, err := peerConn.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+		t.Errorf("peerConn.Read() error = %v, want %v as existingConn must be closed", err, io.EOF)
+	}
+}
+
+func testDialerWritev(t *testing.T) {
 	tcpLis, err := net.Listen("tcp", "localhost:0")
 	if err != nil {
-		b.Fatal(err)
+		t.Fatal(err)
 	}
 	defer tcpLis.Close() // skipcq: GO-S2307
 
-	// Dial
 	config := &water.Config{
 		TransportModuleBin:  wasmPlain,
 		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
 	}
 	dialer, err := v1.NewDialerWithContext(context.Background(), config)
 	if err != nil {
-		b.Fatal(err)
+		t.Fatal(err)
 	}
 
-	waterConn, err := dialer.DialContext(context.Background(), "tcp", tcpLis.Addr().String())
+	conn, err := dialer.DialContext(context.Background(), "tcp", tcpLis.Addr().String())
 	if err != nil {
-		b.Fatal(err)
+		t.Fatal(err)
 	}
-	defer waterConn.Close() // skipcq: GO-S2307
+	defer conn.Close() // skipcq: GO-S2307
 
 	peerConn, err := tcpLis.Accept()
 	if err != nil {
-		b.Fatal(err)
+		t.Fatal(err)
 	}
 	defer peerConn.Close() // skipcq: GO-S2307
 
-	err = sanityCheckConn(peerConn, waterConn, []byte("hello"), []byte("hello"))
-	if err != nil {
-		b.Fatal(err)
+	if err := peerConn.SetDeadline(time.Now().Add(10 * time.Second)); err != nil {
+		t.Fatal(err)
 	}
 
-	benchmarkUnidirectionalStream(b, waterConn, peerConn)
+	vectoredConn, ok := conn.(interface {
+		Writev(net.Buffers) (int64, error)
+		io.ReaderFrom
+	})
+	if !ok {
+		t.Fatalf("%T does not implement Writev and io.ReaderFrom", conn)
+	}
 
-	if err = waterConn.Close(); err != nil {
-		b.Fatal(err)
+	header, body, trailer := []byte("header\r\n"), []byte("body"), []byte("trailer")
+	if n, err := vectoredConn.Writev(net.Buffers{header, body}); err != nil || n != int64(len(header)+len(body)) {
+		t.Fatalf("Writev() = %d, %v", n, err)
+	}
+	if n, err := vectoredConn.ReadFrom(bytes.NewReader(trailer)); err != nil || n != int64(len(trailer)) {
+		t.Fatalf("ReadFrom() = %d, %v", n, err)
 	}
 
-	if err = tcpLis.Close(); err != nil {
-		b.Fatal(err)
+	expected := bytes.Join([][]byte{header, body, trailer}, nil)
+	received := make([]byte, len(expected))
+	if _, err := io.ReadFull(peerConn, received); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(received, expected) {
+		t.Fatalf("received %q, want %q", received, expected)
 	}
 }
 
-// BenchmarkDialerOutboundReverse currently measures only the outbound throughput
-// of the dialer. Inbound throughput is measured for the listener instead.
-//
-// Different from BenchmarkDialerOutbound, this benchmark uses the reverse
-// WebAssembly Transport Module, which reverse the bytes of each message before
-// sending it to the peer.
-//
-// Separate benchmark for the latency measurement will be needed.
-func BenchmarkDialerOutboundReverse(b *testing.B) {
-	// create random TCP listener listening on localhost
-	tcpLis, err := net.ListenTCP("tcp", &net.TCPAddr{
-		IP: net.ParseIP("127.0.0.1"),
-		// Port: 0,
-	})
+func testDialerWriteTo(t *testing.T) {
+	tcpLis, err := net.Listen("tcp", "localhost:0")
 	if err != nil {
-		b.Fatal(err)
+		t.Fatal(err)
 	}
 	defer tcpLis.Close() // skipcq: GO-S2307
 
-	// Dial
 	config := &water.Config{
-		TransportModuleBin:  wasmReverse,
+		TransportModuleBin:  wasmPlain,
 		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
 	}
 	dialer, err := v1.NewDialerWithContext(context.Background(), config)
 	if err != nil {
-		b.Fatal(err)
+		t.Fatal(err)
 	}
 
-	waterConn, err := dialer.DialContext(context.Background(), "tcp", tcpLis.Addr().String())
+	conn, err := dialer.DialContext(context.Background(), "tcp", tcpLis.Addr().String())
 	if err != nil {
-		b.Fatal(err)
+		t.Fatal(err)
 	}
-	defer waterConn.Close() // skipcq: GO-S2307
+	defer conn.Close() // skipcq: GO-S2307
 
 	peerConn, err := tcpLis.Accept()
 	if err != nil {
-		b.Fatal(err)
+		t.Fatal(err)
 	}
 	defer peerConn.Close() // skipcq: GO-S2307
 
-	err = sanityCheckConn(peerConn, waterConn, []byte("hello"), []byte("olleh"))
+	// the data read from the WATM is copied to a TCP connection
+	sinkConn, err := net.Dial("tcp", tcpLis.Addr().String())
 	if err != nil {
-		b.Fatal(err)
+		t.Fatal(err)
 	}
+	defer sinkConn.Close() // skipcq: GO-S2307
 
-	benchmarkUnidirectionalStream(b, waterConn, peerConn)
+	sinkPeerConn, err := tcpLis.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sinkPeerConn.Close() // skipcq: GO-S2307
 
-	if err = waterConn.Close(); err != nil {
-		b.Fatal(err)
+	writerTo, ok := conn.(io.WriterTo)
+	if !ok {
+		t.Fatalf("%T does not implement io.WriterTo", conn)
 	}
+	type result struct {
+		n   int64
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		n, err := writerTo.WriteTo(sinkConn)
+		done <- result{n, err}
+	}()
 
-	if err = tcpLis.Close(); err != nil {
-		b.Fatal(err)
+	msg := []byte("hello world")
+	if _, err := peerConn.Write(msg); err != nil {
+		t.Fatal(err)
+	}
+	if err := sinkPeerConn.SetReadDeadline(time.Now().Add(10 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	received := make([]byte, len(msg))
+	if _, err := io.ReadFull(sinkPeerConn, received); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(received, msg) {
+		t.Fatalf("received %q, want %q", received, msg)
+	}
+
+	// WriteTo returns once the Conn is closed
+	if err := conn.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case res := <-done:
+		if res.n != int64(len(msg)) {
+			t.Errorf("WriteTo() = %d, want %d", res.n, len(msg))
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("WriteTo() did not return once the Conn is closed")
+	}
+	if stats := conn.Stats(); stats.BytesRead != uint64(len(msg)) {
+		t.Errorf("Stats().BytesRead = %d, want %d", stats.BytesRead, len(msg))
 	}
 }
 
-// ExampleFixedDialer demonstrates how to use v1.FixedDialer as a water.Dialer.
-func ExampleFixedDialer() {
+func testDialerTransportChain(t *testing.T) {
+	tcpLis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcpLis.Close() // skipcq: GO-S2307
+
+	// reversed twice, the message must arrive as-is
 	config := &water.Config{
 		TransportModuleBin:  wasmReverse,
+		TransportChain:      []water.ModuleConfig{{TransportModuleBin: wasmReverse}},
 		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
-		DialedAddressValidator: func(network, address string) error {
-			if network != "tcp" || address != "localhost:7700" {
-				return fmt.Errorf("invalid address: %s", address)
-			}
-			return nil
-		},
 	}
-
-	waterDialer, err := v1.NewFixedDialerWithContext(context.Background(), config)
+	dialer, err := v1.NewDialerWithContext(context.Background(), config)
 	if err != nil {
-		panic(err)
+		t.Fatal(err)
 	}
 
-	// create a local TCP listener
-	tcpListener, err := net.Listen("tcp", "localhost:7700")
+	conn, err := dialer.DialContext(context.Background(), "tcp", tcpLis.Addr().String())
 	if err != nil {
-		panic(err)
+		t.Fatal(err)
 	}
-	defer tcpListener.Close() // skipcq: GO-S2307
+	defer conn.Close() // skipcq: GO-S2307
 
-	waterConn, err := waterDialer.DialFixedContext(context.Background())
+	peerConn, err := tcpLis.Accept()
 	if err != nil {
-		panic(err)
+		t.Fatal(err)
 	}
-	defer waterConn.Close() // skipcq: GO-S2307
+	defer peerConn.Close() // skipcq: GO-S2307
 
-	tcpConn, err := tcpListener.Accept()
-	if err != nil {
-		panic(err)
+	if err = sanityCheckConn(conn, peerConn, []byte("hello"), []byte("hello")); err != nil {
+		t.Fatal(err)
 	}
-	defer tcpConn.Close() // skipcq: GO-S2307
 
-	var msg = []byte("hello")
-	n, err := waterConn.Write(msg)
-	if err != nil {
-		panic(err)
+	if err = sanityCheckConn(peerConn, conn, []byte("world"), []byte("world")); err != nil {
+		t.Fatal(err)
 	}
-	if n != len(msg) {
-		panic("short write")
+}
+
+func testDialerWarm(t *testing.T) {
+	tcpLis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
 	}
+	defer tcpLis.Close() // skipcq: GO-S2307
 
-	buf := make([]byte, 1024)
-	n, err = tcpConn.Read(buf)
+	config := &water.Config{
+		TransportModuleBin:  wasmReverse,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+	}
+	dialer, err := v1.NewDialerWithContext(context.Background(), config)
 	if err != nil {
-		panic(err)
+		t.Fatal(err)
 	}
-	if n != len(msg) {
-		panic("short read")
+
+	if err = dialer.Warm(context.Background(), 2); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(10 * time.Second); dialer.DialStats().Warm < 2; {
+		if time.Now().After(deadline) {
+			t.Fatalf("DialStats().Warm = %d, want 2", dialer.DialStats().Warm)
+		}
+		time.Sleep(10 * time.Millisecond)
 	}
 
-	if err := waterConn.Close(); err != nil {
-		panic(err)
+	// 2 warm dials, then a cold one
+	for i := 0; i < 3; i++ {
+		conn, err := dialer.DialContext(context.Background(), "tcp", tcpLis.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close() // skipcq: GO-S2307
+
+		peerConn, err := tcpLis.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer peerConn.Close() // skipcq: GO-S2307
+
+		if err = sanityCheckConn(conn, peerConn, []byte("hello"), []byte("olleh")); err != nil {
+			t.Fatal(err)
+		}
 	}
 
-	fmt.Println(string(buf[:n]))
-	// Output: olleh
+	if stats := dialer.DialStats(); stats != (water.DialStats{Warm: 0, WarmDials: 2, ColdDials: 1}) {
+		t.Errorf("DialStats() = %+v, want 2 warm and 1 cold dials", stats)
+	}
 }
 
-// TestFixedDialer covers the following cases:
-//  1. FixedDialer must work with a plain WebAssembly Transport Module that
-//     doesn't transform the message.
-//  2. FixedDialer must work with a WebAssembly Transport Module that
-//     transforms the message by reversing it.
-//  3. FixedDialer must fail when an invalid address is supplied.
-//  4. FixedDialer must fail when a WebAssembly Transport Module does not
-//     fully implement the v1 dialer spec.
-func TestFixedDialer(t *testing.T) {
-	t.Run("plain must work", testFixedDialerPlain)
-	t.Run("reverse must work", testFixedDialerReverse)
-	t.Run("bad addr must fail", testFixedDialerBadAddr)
-	t.Run("partial WATM must fail", testFixedDialerPartialWATM)
-}
+func testDialerIdleTimeout(t *testing.T) {
+	tcpLis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcpLis.Close() // skipcq: GO-S2307
 
-func testFixedDialerBadAddr(t *testing.T) {
-	// Dial
+	idled := make(chan water.Conn, 1)
 	config := &water.Config{
 		TransportModuleBin:  wasmPlain,
 		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
-		DialedAddressValidator: func(network, address string) error {
-			if network != "tcp" || address != "localhost:7700" {
-				return fmt.Errorf("invalid address: %s", address)
-			}
-			return nil
+		IdleTimeout:         100 * time.Millisecond,
+		OnIdleTimeout: func(conn water.Conn) {
+			idled <- conn
 		},
 	}
+	dialer, err := v1.NewDialerWithContext(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	dialer, err := v1.NewFixedDialerWithContext(context.Background(), config)
+	conn, err := dialer.DialContext(context.Background(), "tcp", tcpLis.Addr().String())
 	if err != nil {
 		t.Fatal(err)
 	}
+	defer conn.Close() // skipcq: GO-S2307
 
-	_, err = dialer.DialFixedContext(context.Background())
-	if err == nil {
-		t.Fatal("dialer.DialFixed should fail")
+	peerConn, err := tcpLis.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peerConn.Close() // skipcq: GO-S2307
+
+	if err = sanityCheckConn(conn, peerConn, []byte("hello"), []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case idledConn := <-idled:
+		if idledConn != conn {
+			t.Errorf("OnIdleTimeout called with %v, want %v", idledConn, conn)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("idle connection is not closed")
+	}
+
+	if _, err = conn.Write([]byte("hello")); err == nil {
+		t.Error("writing to an idle connection closed must fail")
 	}
 }
 
-func testFixedDialerPlain(t *testing.T) { // skipcq: GO-R1005
-	tcpLis, err := net.Listen("tcp", "localhost:7700")
+func testDialerKeepalive(t *testing.T) {
+	tcpLis, err := net.Listen("tcp", "localhost:0")
 	if err != nil {
 		t.Fatal(err)
 	}
 	defer tcpLis.Close() // skipcq: GO-S2307
 
-	// Dial using water
 	config := &water.Config{
-		TransportModuleBin:  wasmPlain,
+		TransportModuleBin:  wasmKeepalive,
 		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
-		DialedAddressValidator: func(network, address string) error {
-			if network != "tcp" || address != "localhost:7700" {
-				return fmt.Errorf("invalid address: %s", address)
-			}
-			return nil
-		},
+		KeepaliveInterval:   50 * time.Millisecond,
 	}
-	dialer, err := v1.NewFixedDialerWithContext(context.Background(), config)
+	dialer, err := v1.NewDialerWithContext(context.Background(), config)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	conn, err := dialer.DialFixedContext(context.Background())
+	conn, err := dialer.DialContext(context.Background(), "tcp", tcpLis.Addr().String())
 	if err != nil {
 		t.Fatal(err)
 	}
 	defer conn.Close() // skipcq: GO-S2307
 
-	// type assertion: conn must be *v1.Conn
-	if _, ok := conn.(*v1.Conn); !ok {
-		t.Fatalf("returned conn is not *v1.Conn")
-	}
-
 	peerConn, err := tcpLis.Accept()
 	if err != nil {
 		t.Fatal(err)
 	}
 	defer peerConn.Close() // skipcq: GO-S2307
 
-	tripleGC(100 * time.Microsecond)
+	// the WATM forwards each keepalive to the remote
+	if err = peerConn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 3)
+	if _, err = io.ReadFull(peerConn, buf); err != nil {
+		t.Fatalf("reading keepalives: %v", err)
+	}
+	if !bytes.Equal(buf, []byte{0x01, 0x01, 0x01}) {
+		t.Errorf("keepalives = %x, want 010101", buf)
+	}
+}
+
+func testDialerCloseReason(t *testing.T) {
+	tcpLis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcpLis.Close() // skipcq: GO-S2307
+
+	config := &water.Config{
+		TransportModuleBin:  wasmCloseReason,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+	}
+	dialer, err := v1.NewDialerWithContext(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := dialer.DialContext(context.Background(), "tcp", tcpLis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close() // skipcq: GO-S2307
+
+	peerConn, err := tcpLis.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peerConn.Close() // skipcq: GO-S2307
+
+	want := water.CloseReason{Code: water.CloseCodePeerReset, Message: "peer went away"}
+
+	// the worker reports the reason once started
+	deadline := time.Now().Add(5 * time.Second)
+	for conn.CloseReason() != want && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := conn.CloseReason(); got != want {
+		t.Fatalf("CloseReason() = %v, want %v", got, want)
+	}
+
+	if err = conn.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := conn.CloseReason(); got != want {
+		t.Errorf("CloseReason() after Close = %v, want %v", got, want)
+	}
+}
+
+func testDialerMetadata(t *testing.T) {
+	tcpLis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcpLis.Close() // skipcq: GO-S2307
+
+	config := &water.Config{
+		TransportModuleBin:  wasmMetadata,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+	}
+	dialer, err := v1.NewDialerWithContext(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := dialer.DialContext(context.Background(), "tcp", tcpLis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close() // skipcq: GO-S2307
+
+	peerConn, err := tcpLis.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peerConn.Close() // skipcq: GO-S2307
+
+	// the worker attaches the metadata once started
+	deadline := time.Now().Add(5 * time.Second)
+	for conn.Metadata()["cipher"] == "" && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	metadata := conn.Metadata()
+	if len(metadata) != 1 || metadata["cipher"] != "chacha20" {
+		t.Fatalf("Metadata() = %v, want map[cipher:chacha20]", metadata)
+	}
+
+	// the metadata returned is a copy
+	metadata["cipher"] = "none"
+
+	if err = conn.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := conn.Metadata()["cipher"]; got != "chacha20" {
+		t.Errorf("Metadata()[cipher] after Close = %q, want %q", got, "chacha20")
+	}
+}
+
+func testDialerConnStats(t *testing.T) {
+	tcpLis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcpLis.Close() // skipcq: GO-S2307
+
+	config := &water.Config{
+		TransportModuleBin:  wasmPlain,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+	}
+	dialer, err := v1.NewDialerWithContext(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := dialer.DialContext(context.Background(), "tcp", tcpLis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close() // skipcq: GO-S2307
+
+	peerConn, err := tcpLis.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peerConn.Close() // skipcq: GO-S2307
+
+	if stats := conn.Stats(); stats != (water.ConnStats{}) {
+		t.Fatalf("Stats() = %+v before any data, want zero", stats)
+	}
+
+	start := time.Now()
+	for _, msg := range []string{"hello", "world!"} {
+		if _, err = conn.Write([]byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	buf := make([]byte, 11)
+	if _, err = io.ReadFull(peerConn, buf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = peerConn.Write([]byte("reply")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = io.ReadFull(conn, buf[:5]); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := conn.Stats()
+	if stats.BytesWritten != 11 || stats.Writes != 2 {
+		t.Errorf("BytesWritten, Writes = %d, %d, want 11, 2", stats.BytesWritten, stats.Writes)
+	}
+	if stats.BytesRead != 5 || stats.Reads == 0 {
+		t.Errorf("BytesRead, Reads = %d, %d, want 5, at least 1", stats.BytesRead, stats.Reads)
+	}
+	if stats.LastWrite.Before(start) || stats.LastRead.Before(stats.LastWrite) {
+		t.Errorf("LastWrite, LastRead = %v, %v, want in order after %v", stats.LastWrite, stats.LastRead, start)
+	}
+	if !stats.LastActivity().Equal(stats.LastRead) {
+		t.Errorf("LastActivity() = %v, want %v", stats.LastActivity(), stats.LastRead)
+	}
+
+	if err = conn.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := conn.Stats(); got != stats {
+		t.Errorf("Stats() after Close = %+v, want %+v", got, stats)
+	}
+}
+
+func testDialerBandwidthLimit(t *testing.T) {
+	tcpLis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcpLis.Close() // skipcq: GO-S2307
+
+	config := &water.Config{
+		TransportModuleBin:  wasmPlain,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+		ConnWriteLimit:      10 << 10, // 10 KiB/s
+		ReadLimiter:         &water.RateLimiter{BytesPerSecond: 10 << 10, Burst: 1 << 10},
+	}
+	dialer, err := v1.NewDialerWithContext(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := dialer.DialContext(context.Background(), "tcp", tcpLis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close() // skipcq: GO-S2307
+
+	peerConn, err := tcpLis.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peerConn.Close() // skipcq: GO-S2307
+
+	// 3 KiB at 10 KiB/s takes 300ms in each direction, minus the burst
+	msg := make([]byte, 3<<10)
+	for _, dir := range []struct {
+		name   string
+		wr, rd net.Conn
+		min    time.Duration
+	}{
+		{"write", conn, peerConn, 250 * time.Millisecond},
+		{"read", peerConn, conn, 150 * time.Millisecond},
+	} {
+		start := time.Now()
+		if _, err = dir.wr.Write(msg); err != nil {
+			t.Fatal(err)
+		}
+		if err = dir.rd.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = io.ReadFull(dir.rd, make([]byte, len(msg))); err != nil {
+			t.Fatal(err)
+		}
+		if elapsed := time.Since(start); elapsed < dir.min {
+			t.Errorf("%s of %d bytes took %v, want at least %v", dir.name, len(msg), elapsed, dir.min)
+		}
+	}
+}
+
+type fixedShaper struct {
+	delay   time.Duration
+	padding int
+}
+
+func (s fixedShaper) Delay(int) time.Duration { return s.delay }
+
+func (s fixedShaper) Padding(int) int { return s.padding }
+
+func testDialerShaper(t *testing.T) {
+	tcpLis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcpLis.Close() // skipcq: GO-S2307
+
+	config := &water.Config{
+		TransportModuleBin:  wasmShaper,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+		Shaper:              fixedShaper{delay: 200 * time.Millisecond, padding: 42},
+	}
+	dialer, err := v1.NewDialerWithContext(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	conn, err := dialer.DialContext(context.Background(), "tcp", tcpLis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close() // skipcq: GO-S2307
+
+	peerConn, err := tcpLis.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peerConn.Close() // skipcq: GO-S2307
+
+	if err = peerConn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 1)
+	if _, err = io.ReadFull(peerConn, buf); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("write delayed by %v, want at least 200ms", elapsed)
+	}
+	if buf[0] != 42 {
+		t.Errorf("padding = %d, want 42", buf[0])
+	}
+}
+
+func testDialerSyscallConn(t *testing.T) {
+	config := &water.Config{
+		TransportModuleBin:  wasmPlain,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+	}
+	dialer, err := v1.NewDialerWithContext(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	existingConn, peerConn := net.Pipe()
+	defer peerConn.Close() // skipcq: GO-S2307
+
+	conn, err := dialer.DialWithConn(context.Background(), existingConn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close() // skipcq: GO-S2307
+
+	rawConn, err := conn.SyscallConn()
+	if err != nil {
+		t.Fatalf("SyscallConn() = %v", err)
+	}
+	var controlled bool
+	if err = rawConn.Control(func(uintptr) { controlled = true }); err != nil || !controlled {
+		t.Fatalf("RawConn.Control() = %v, called: %v", err, controlled)
+	}
+
+	f, err := conn.File()
+	if runtime.GOOS == "windows" {
+		if err == nil {
+			t.Fatal("File() must fail on Windows")
+		}
+	} else {
+		if err != nil {
+			t.Fatalf("File() = %v", err)
+		}
+		// closing the copy must not close the Conn
+		if err = f.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = sanityCheckConn(conn, peerConn, []byte("hello"), []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testDialerRemoteAddress(t *testing.T) {
+	tcpLis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcpLis.Close() // skipcq: GO-S2307
+
+	for _, tc := range []struct {
+		name          string
+		remoteAddress string
+		want          string
+	}{
+		{"address dialed", "", tcpLis.Addr().String()},
+		{"fronted", "example.com:443", "example.com:443"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			config := &water.Config{
+				TransportModuleBin:  wasmRemoteAddress,
+				ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+				RemoteAddress:       tc.remoteAddress,
+			}
+			dialer, err := v1.NewDialerWithContext(context.Background(), config)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			conn, err := dialer.DialContext(context.Background(), "tcp", tcpLis.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close() // skipcq: GO-S2307
+
+			peerConn, err := tcpLis.Accept()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer peerConn.Close() // skipcq: GO-S2307
+
+			if err = peerConn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+				t.Fatal(err)
+			}
+			buf := make([]byte, len(tc.want))
+			if _, err = io.ReadFull(peerConn, buf); err != nil {
+				t.Fatal(err)
+			}
+			if string(buf) != tc.want {
+				t.Errorf("WATM targets %q, want %q", buf, tc.want)
+			}
+		})
+	}
+}
+
+func testDialerBadAddr(t *testing.T) {
+	// Dial
+	config := &water.Config{
+		TransportModuleBin:  wasmPlain,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+	}
+
+	dialer, err := v1.NewDialerWithContext(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = dialer.DialContext(context.Background(), "tcp", "256.267.278.289:2023")
+	if err == nil {
+		t.Fatal("dialer.Dial should fail")
+	}
+}
+
+func testDialerPlain(t *testing.T) { // skipcq: GO-R1005
+	tcpLis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcpLis.Close() // skipcq: GO-S2307
+
+	// Dial using water
+	config := &water.Config{
+		TransportModuleBin:  wasmPlain,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+	}
+	dialer, err := v1.NewDialerWithContext(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := dialer.DialContext(context.Background(), "tcp", tcpLis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close() // skipcq: GO-S2307
+
+	// type assertion: conn must be *v1.Conn
+	if _, ok := conn.(*v1.Conn); !ok {
+		t.Fatalf("returned conn is not *v1.Conn")
+	}
+
+	peerConn, err := tcpLis.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peerConn.Close() // skipcq: GO-S2307
+
+	tripleGC(100 * time.Microsecond)
+
+	var waterSendBuf []byte = make([]byte, 1024)
+	var peerSendBuf []byte = make([]byte, 1024)
+	var waterRecvBuf []byte = make([]byte, 1024)
+	var peerRecvBuf []byte = make([]byte, 1024)
+	// send 10 messages in each direction
+	for i := 0; i < 10; i++ {
+		_, err = rand.Read(waterSendBuf)
+		if err != nil {
+			t.Fatalf("rand.Read error: %s", err)
+		}
+
+		_, err = rand.Read(peerSendBuf)
+		if err != nil {
+			t.Fatalf("rand.Read error: %s", err)
+		}
+
+		// dialer -> listener
+		_, err = conn.Write(waterSendBuf)
+		if err != nil {
+			t.Fatalf("conn.Write error: %s", err)
+		}
+
+		n, err := peerConn.Read(peerRecvBuf)
+		if err != nil {
+			t.Fatalf("peerConn.Read error: %s", err)
+		}
+
+		if n != len(waterSendBuf) {
+			t.Fatalf("peerConn.Read error: read %d bytes, want %d bytes", n, len(waterSendBuf))
+		}
+
+		if !bytes.Equal(peerRecvBuf[:n], waterSendBuf) {
+			t.Fatalf("peerRecvBuf != waterSendBuf")
+		}
+
+		// listener -> dialer
+		_, err = peerConn.Write(peerSendBuf)
+		if err != nil {
+			t.Fatalf("peerConn.Write error: %s", err)
+		}
+
+		n, err = conn.Read(waterRecvBuf)
+		if err != nil {
+			t.Fatalf("conn.Read error: %s", err)
+		}
+
+		if n != len(peerSendBuf) {
+			t.Fatalf("conn.Read error: read %d bytes, want %d bytes", n, len(peerSendBuf))
+		}
+
+		if !bytes.Equal(waterRecvBuf[:n], peerSendBuf) {
+			t.Fatalf("waterRecvBuf != peerSendBuf")
+		}
+
+		tripleGC(100 * time.Microsecond)
+	}
+
+	// reading with a deadline
+	err = conn.SetDeadline(time.Now().Add(100 * time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = conn.Read(waterRecvBuf)
+	if err == nil {
+		t.Fatalf("conn.Read must timeout")
+	}
+
+	if err := conn.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// after closing the conn, read/write MUST fail
+	_, err = conn.Write(waterSendBuf)
+	if err == nil {
+		t.Fatalf("conn.Write must fail after closing the conn")
+	}
+
+	_, err = conn.Read(waterRecvBuf)
+	if err == nil {
+		t.Fatalf("conn.Read must fail after closing the conn")
+	}
+
+	if err := tcpLis.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tripleGC(100 * time.Microsecond)
+}
+
+func testDialerReverse(t *testing.T) { // skipcq: GO-R1005
+	tcpLis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcpLis.Close() // skipcq: GO-S2307
+
+	// Dial using water
+	config := &water.Config{
+		TransportModuleBin:  wasmReverse,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+	}
+	dialer, err := v1.NewDialerWithContext(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := dialer.DialContext(context.Background(), "tcp", tcpLis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close() // skipcq: GO-S2307
+
+	// type assertion: conn must be *v1.Conn
+	if _, ok := conn.(*v1.Conn); !ok {
+		t.Fatalf("returned conn is not *v1.Conn")
+	}
+
+	peerConn, err := tcpLis.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peerConn.Close() // skipcq: GO-S2307
+
+	tripleGC(100 * time.Microsecond)
+
+	var waterSendBuf []byte = make([]byte, 1024)
+	var peerSendBuf []byte = make([]byte, 1024)
+	var waterRecvBuf []byte = make([]byte, 1024)
+	var peerRecvBuf []byte = make([]byte, 1024)
+	// send 10 messages in each direction
+	for i := 0; i < 10; i++ {
+		_, err = rand.Read(waterSendBuf)
+		if err != nil {
+			t.Fatalf("rand.Read error: %s", err)
+		}
+
+		_, err = rand.Read(peerSendBuf)
+		if err != nil {
+			t.Fatalf("rand.Read error: %s", err)
+		}
+
+		// dialer -> listener
+		_, err = conn.Write(waterSendBuf)
+		if err != nil {
+			t.Fatalf("conn.Write error: %s", err)
+		}
+
+		n, err := peerConn.Read(peerRecvBuf)
+		if err != nil {
+			t.Fatalf("peerConn.Read error: %s", err)
+		}
+
+		if n != len(waterSendBuf) {
+			t.Fatalf("peerConn.Read error: read %d bytes, want %d bytes", n, len(waterSendBuf))
+		}
+
+		// reverse the waterSendBuf
+		for i := 0; i < len(waterSendBuf)/2; i++ {
+			waterSendBuf[i], waterSendBuf[len(waterSendBuf)-1-i] = waterSendBuf[len(waterSendBuf)-1-i], waterSendBuf[i]
+		}
+
+		if !bytes.Equal(peerRecvBuf[:n], waterSendBuf) {
+			t.Fatalf("peerRecvBuf != waterSendBuf")
+		}
+
+		// listener -> dialer
+		_, err = peerConn.Write(peerSendBuf)
+		if err != nil {
+			t.Fatalf("peerConn.Write error: %s", err)
+		}
+
+		n, err = conn.Read(waterRecvBuf)
+		if err != nil {
+			t.Fatalf("conn.Read error: %s", err)
+		}
+
+		if n != len(peerSendBuf) {
+			t.Fatalf("conn.Read error: read %d bytes, want %d bytes", n, len(peerSendBuf))
+		}
+
+		// reverse the peerSendBuf
+		for i := 0; i < len(peerSendBuf)/2; i++ {
+			peerSendBuf[i], peerSendBuf[len(peerSendBuf)-1-i] = peerSendBuf[len(peerSendBuf)-1-i], peerSendBuf[i]
+		}
+
+		if !bytes.Equal(waterRecvBuf[:n], peerSendBuf) {
+			t.Fatalf("waterRecvBuf != peerSendBuf")
+		}
+
+		tripleGC(100 * time.Microsecond)
+	}
+
+	// reading with a deadline
+	err = conn.SetDeadline(time.Now().Add(100 * time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = conn.Read(waterRecvBuf)
+	if err == nil {
+		t.Fatalf("conn.Read must timeout")
+	}
+
+	if err := conn.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// after closing the conn, read/write MUST fail
+	_, err = conn.Write(waterSendBuf)
+	if err == nil {
+		t.Fatalf("conn.Write must fail after closing the conn")
+	}
+
+	_, err = conn.Read(waterRecvBuf)
+	if err == nil {
+		t.Fatalf("conn.Read must fail after closing the conn")
+	}
+
+	if err := tcpLis.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tripleGC(100 * time.Microsecond)
+}
+
+func testDialerPartialWATM(t *testing.T) {
+	t.Skip("skipping [testDialerPartialWATM]...") // TODO: implement this with a few WebAssembly Transport Modules which partially implement the v1 dialer spec
+}
+
+// BenchmarkDialerOutbound currently measures only the outbound throughput
+// of the dialer. Inbound throughput is measured for the listener instead.
+//
+// Separate benchmark for the latency measurement will be needed.
+func BenchmarkDialerOutbound(b *testing.B) {
+	// create random TCP listener listening on localhost
+	tcpLis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer tcpLis.Close() // skipcq: GO-S2307
+
+	// Dial
+	config := &water.Config{
+		TransportModuleBin:  wasmPlain,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+	}
+	dialer, err := v1.NewDialerWithContext(context.Background(), config)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	waterConn, err := dialer.DialContext(context.Background(), "tcp", tcpLis.Addr().String())
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer waterConn.Close() // skipcq: GO-S2307
+
+	peerConn, err := tcpLis.Accept()
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer peerConn.Close() // skipcq: GO-S2307
+
+	err = sanityCheckConn(peerConn, waterConn, []byte("hello"), []byte("hello"))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	benchmarkUnidirectionalStream(b, waterConn, peerConn)
+
+	if err = waterConn.Close(); err != nil {
+		b.Fatal(err)
+	}
+
+	if err = tcpLis.Close(); err != nil {
+		b.Fatal(err)
+	}
+}
+
+// BenchmarkDialerOutboundReverse currently measures only the outbound throughput
+// of the dialer. Inbound throughput is measured for the listener instead.
+//
+// Different from BenchmarkDialerOutbound, this benchmark uses the reverse
+// WebAssembly Transport Module, which reverse the bytes of each message before
+// sending it to the peer.
+//
+// Separate benchmark for the latency measurement will be needed.
+func BenchmarkDialerOutboundReverse(b *testing.B) {
+	// create random TCP listener listening on localhost
+	tcpLis, err := net.ListenTCP("tcp", &net.TCPAddr{
+		IP: net.ParseIP("127.0.0.1"),
+		// Port: 0,
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer tcpLis.Close() // skipcq: GO-S2307
+
+	// Dial
+	config := &water.Config{
+		TransportModuleBin:  wasmReverse,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+	}
+	dialer, err := v1.NewDialerWithContext(context.Background(), config)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	waterConn, err := dialer.DialContext(context.Background(), "tcp", tcpLis.Addr().String())
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer waterConn.Close() // skipcq: GO-S2307
+
+	peerConn, err := tcpLis.Accept()
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer peerConn.Close() // skipcq: GO-S2307
+
+	err = sanityCheckConn(peerConn, waterConn, []byte("hello"), []byte("olleh"))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	benchmarkUnidirectionalStream(b, waterConn, peerConn)
+
+	if err = waterConn.Close(); err != nil {
+		b.Fatal(err)
+	}
+
+	if err = tcpLis.Close(); err != nil {
+		b.Fatal(err)
+	}
+}
+
+// ExampleFixedDialer demonstrates how to use v1.FixedDialer as a water.Dialer.
+func ExampleFixedDialer() {
+	config := &water.Config{
+		TransportModuleBin:  wasmReverse,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+		DialedAddressValidator: func(network, address string) error {
+			if network != "tcp" || address != "localhost:7700" {
+				return fmt.Errorf("invalid address: %s", address)
+			}
+			return nil
+		},
+	}
+
+	waterDialer, err := v1.NewFixedDialerWithContext(context.Background(), config)
+	if err != nil {
+		panic(err)
+	}
+
+	// create a local TCP listener
+	tcpListener, err := net.Listen("tcp", "localhost:7700")
+	if err != nil {
+		panic(err)
+	}
+	defer tcpListener.Close() // skipcq: GO-S2307
+
+	waterConn, err := waterDialer.DialFixedContext(context.Background())
+	if err != nil {
+		panic(err)
+	}
+	defer waterConn.Close() // skipcq: GO-S2307
+
+	tcpConn, err := tcpListener.Accept()
+	if err != nil {
+		panic(err)
+	}
+	defer tcpConn.Close() // skipcq: GO-S2307
+
+	var msg = []byte("hello")
+	n, err := waterConn.Write(msg)
+	if err != nil {
+		panic(err)
+	}
+	if n != len(msg) {
+		panic("short write")
+	}
+
+	buf := make([]byte, 1024)
+	n, err = tcpConn.Read(buf)
+	if err != nil {
+		panic(err)
+	}
+	if n != len(msg) {
+		panic("short read")
+	}
+
+	if err := waterConn.Close(); err != nil {
+		panic(err)
+	}
+
+	fmt.Println(string(buf[:n]))
+	// Output: olleh
+}
+
+// TestFixedDialer covers the following cases:
+//  1. FixedDialer must work with a plain WebAssembly Transport Module that
+//     doesn't transform the message.
+//  2. FixedDialer must work with a WebAssembly Transport Module that
+//     transforms the message by reversing it.
+//  3. FixedDialer must fail when an invalid address is supplied.
+//  4. FixedDialer must fail when a WebAssembly Transport Module does not
+//     fully implement the v1 dialer spec.
+func TestFixedDialer(t *testing.T) {
+	t.Run("plain must work", testFixedDialerPlain)
+	t.Run("reverse must work", testFixedDialerReverse)
+	t.Run("bad addr must fail", testFixedDialerBadAddr)
+	t.Run("partial WATM must fail", testFixedDialerPartialWATM)
+}
+
+func testFixedDialerBadAddr(t *testing.T) {
+	// Dial
+	config := &water.Config{
+		TransportModuleBin:  wasmPlain,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+		DialedAddressValidator: func(network, address string) error {
+			if network != "tcp" || address != "localhost:7700" {
+				return fmt.Errorf("invalid address: %s", address)
+			}
+			return nil
+		},
+	}
+
+	dialer, err := v1.NewFixedDialerWithContext(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = dialer.DialFixedContext(context.Background())
+	if err == nil {
+		t.Fatal("dialer.DialFixed should fail")
+	}
+}
+
+func testFixedDialerPlain(t *testing.T) { // skipcq: GO-R1005
+	tcpLis, err := net.Listen("tcp", "localhost:7700")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcpLis.Close() // skipcq: GO-S2307
+
+	// Dial using water
+	config := &water.Config{
+		TransportModuleBin:  wasmPlain,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+		DialedAddressValidator: func(network, address string) error {
+			if network != "tcp" || address != "localhost:7700" {
+				return fmt.Errorf("invalid address: %s", address)
+			}
+			return nil
+		},
+	}
+	dialer, err := v1.NewFixedDialerWithContext(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := dialer.DialFixedContext(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close() // skipcq: GO-S2307
+
+	// type assertion: conn must be *v1.Conn
+	if _, ok := conn.(*v1.Conn); !ok {
+		t.Fatalf("returned conn is not *v1.Conn")
+	}
+
+	peerConn, err := tcpLis.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peerConn.Close() // skipcq: GO-S2307
+
+	tripleGC(100 * time.Microsecond)
+
+	var waterSendBuf []byte = make([]byte, 1024)
+	var peerSendBuf []byte = make([]byte, 1024)
+	var waterRecvBuf []byte = make([]byte, 1024)
+	var peerRecvBuf []byte = make([]byte, 1024)
+	// send 10 messages in each direction
+	for i := 0; i < 10; i++ {
+		_, err = rand.Read(waterSendBuf)
+		if err != nil {
+			t.Fatalf("rand.Read error: %s", err)
+		}
+
+		_, err = rand.Read(peerSendBuf)
+		if err != nil {
+			t.Fatalf("rand.Read error: %s", err)
+		}
+
+		// dialer -> listener
+		_, err = conn.Write(waterSendBuf)
+		if err != nil {
+			t.Fatalf("conn.Write error: %s", err)
+		}
+
+		n, err := peerConn.Read(peerRecvBuf)
+		if err != nil {
+			t.Fatalf("peerConn.Read error: %s", err)
+		}
+
+		if n != len(waterSendBuf) {
+			t.Fatalf("peerConn.Read error: read %d bytes, want %d bytes", n, len(waterSendBuf))
+		}
+
+		if !bytes.Equal(peerRecvBuf[:n], waterSendBuf) {
+			t.Fatalf("peerRecvBuf != waterSendBuf")
+		}
+
+		// listener -> dialer
+		_, err = peerConn.Write(peerSendBuf)
+		if err != nil {
+			t.Fatalf("peerConn.Write error: %s", err)
+		}
+
+		n, err = conn.Read(waterRecvBuf)
+		if err != nil {
+			t.Fatalf("conn.Read error: %s", err)
+		}
+
+		if n != len(peerSendBuf) {
+			t.Fatalf("conn.Read error: read %d bytes, want %d bytes", n, len(peerSendBuf))
+		}
+
+		if !bytes.Equal(waterRecvBuf[:n], peerSendBuf) {
+			t.Fatalf("waterRecvBuf != peerSendBuf")
+		}
+
+		tripleGC(100 * time.Microsecond)
+	}
+
+	// reading with a deadline
+	err = conn.SetDeadline(time.Now().Add(100 * time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = conn.Read(waterRecvBuf)
+	if err == nil {
+		t.Fatalf("conn.Read must timeout")
+	}
+
+	if err := conn.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// after closing the conn, read/write MUST fail
+	_, err = conn.Write(waterSendBuf)
+	if err == nil {
+		t.Fatalf("conn.Write must fail after closing the conn")
+	}
+
+	_, err = conn.Read(waterRecvBuf)
+	if err == nil {
+		t.Fatalf("conn.Read must fail after closing the conn")
+	}
+
+	if err := tcpLis.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tripleGC(100 * time.Microsecond)
+}
+
+func testFixedDialerReverse(t *testing.T) { // skipcq: GO-R1005
+	tcpLis, err := net.Listen("tcp", "localhost:7700")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcpLis.Close() // skipcq: GO-S2307
+
+	// Dial using water
+	config := &water.Config{
+		TransportModuleBin:  wasmReverse,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+		DialedAddressValidator: func(network, address string) error {
+			if network != "tcp" || address != "localhost:7700" {
+				return fmt.Errorf("invalid address: %s", address)
+			}
+			return nil
+		},
+	}
+	dialer, err := v1.NewFixedDialerWithContext(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := dialer.DialFixedContext(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close() // skipcq: GO-S2307
+
+	// type assertion: conn must be *v1.Conn
+	if _, ok := conn.(*v1.Conn); !ok {
+		t.Fatalf("returned conn is not *v1.Conn")
+	}
+
+	peerConn, err := tcpLis.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peerConn.Close() // skipcq: GO-S2307
+
+	tripleGC(100 * time.Microsecond)
 
 	var waterSendBuf []byte = make([]byte, 1024)
 	var peerSendBuf []byte = make([]byte, 1024)
@@ -651,6 +1882,11 @@ func testFixedDialerPlain(t *testing.T) { // skipcq: GO-R1005
 			t.Fatalf("peerConn.Read error: read %d bytes, want %d bytes", n, len(waterSendBuf))
 		}
 
+		// reverse the waterSendBuf
+		for i := 0; i < len(waterSendBuf)/2; i++ {
+			waterSendBuf[i], waterSendBuf[len(waterSendBuf)-1-i] = waterSendBuf[len(waterSendBuf)-1-i], waterSendBuf[i]
+		}
+
 		if !bytes.Equal(peerRecvBuf[:n], waterSendBuf) {
 			t.Fatalf("peerRecvBuf != waterSendBuf")
 		}
@@ -666,83 +1902,337 @@ func testFixedDialerPlain(t *testing.T) { // skipcq: GO-R1005
 			t.Fatalf("conn.Read error: %s", err)
 		}
 
-		if n != len(peerSendBuf) {
-			t.Fatalf("conn.Read error: read %d bytes, want %d bytes", n, len(peerSendBuf))
-		}
+		if n != len(peerSendBuf) {
+			t.Fatalf("conn.Read error: read %d bytes, want %d bytes", n, len(peerSendBuf))
+		}
+
+		// reverse the peerSendBuf
+		for i := 0; i < len(peerSendBuf)/2; i++ {
+			peerSendBuf[i], peerSendBuf[len(peerSendBuf)-1-i] = peerSendBuf[len(peerSendBuf)-1-i], peerSendBuf[i]
+		}
+
+		if !bytes.Equal(waterRecvBuf[:n], peerSendBuf) {
+			t.Fatalf("waterRecvBuf != peerSendBuf")
+		}
+
+		tripleGC(100 * time.Microsecond)
+	}
+
+	// reading with a deadline
+	err = conn.SetDeadline(time.Now().Add(100 * time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = conn.Read(waterRecvBuf)
+	if err == nil {
+		t.Fatalf("conn.Read must timeout")
+	}
+
+	if err := conn.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// after closing the conn, read/write MUST fail
+	_, err = conn.Write(waterSendBuf)
+	if err == nil {
+		t.Fatalf("conn.Write must fail after closing the conn")
+	}
+
+	_, err = conn.Read(waterRecvBuf)
+	if err == nil {
+		t.Fatalf("conn.Read must fail after closing the conn")
+	}
+
+	if err := tcpLis.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tripleGC(100 * time.Microsecond)
+}
+
+func testFixedDialerPartialWATM(t *testing.T) {
+	t.Skip("skipping [testFixedDialerPartialWATM]...") // TODO: implement this with a few WebAssembly Transport Modules which partially implement the v1 dialer spec
+}
+
+func testDialerMultipath(t *testing.T) {
+	tcpLis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcpLis.Close() // skipcq: GO-S2307
+
+	config := &water.Config{
+		TransportModuleBin:  wasmMultipath,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+	}
+	dialer, err := v1.NewDialerWithContext(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := dialer.DialContext(context.Background(), "tcp", tcpLis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var peerConns []net.Conn
+	for i := 0; i < 2; i++ {
+		peerConn, err := tcpLis.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer peerConn.Close() // skipcq: GO-S2307
+		peerConns = append(peerConns, peerConn)
+	}
+
+	netConns := conn.NetConns()
+	if len(netConns) != 2 {
+		t.Fatalf("NetConns() returned %d connections, want 2", len(netConns))
+	}
+	if netConns[1] != conn.NetConn() {
+		t.Errorf("NetConns()[1] = %v, want NetConn() %v", netConns[1], conn.NetConn())
+	}
+
+	// the outbound connections are all closed with the Conn
+	if err = conn.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for i, peerConn := range peerConns {
+		if err := peerConn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := peerConn.Read(make([]byte, 1)); err != io.EOF {
+			t.Errorf("Read() from peer %d after Close = %v, want io.EOF", i, err)
+		}
+	}
+	if got := len(conn.NetConns()); got != 2 {
+		t.Errorf("NetConns() after Close returned %d connections, want 2", got)
+	}
+
+	// dials beyond MaxOutboundConns fail
+	config = config.Clone()
+	config.MaxOutboundConns = 1
+	dialer, err = v1.NewDialerWithContext(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conn, err := dialer.DialContext(context.Background(), "tcp", tcpLis.Addr().String()); err == nil {
+		conn.Close()
+		t.Fatal("DialContext() beyond MaxOutboundConns returned no error")
+	}
+}
+
+func testDialerPathInfo(t *testing.T) {
+	tcpLis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcpLis.Close() // skipcq: GO-S2307
+
+	var pathInfoConns []net.Conn
+	config := &water.Config{
+		TransportModuleBin:  wasmMultipathPathInfo,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+		PathInfoFunc: func(conn net.Conn) (water.PathInfo, error) {
+			pathInfoConns = append(pathInfoConns, conn)
+			return water.PathInfo{RTT: time.Millisecond}, nil
+		},
+	}
+	dialer, err := v1.NewDialerWithContext(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the peer connections are closed with the listener
+	go func() {
+		var peerConns []net.Conn
+		for {
+			peerConn, err := tcpLis.Accept()
+			if err != nil {
+				for _, peerConn := range peerConns {
+					peerConn.Close()
+				}
+				return
+			}
+			peerConns = append(peerConns, peerConn)
+		}
+	}()
+
+	// the WATM fails to dial unless the paths and the RTT are as expected
+	conn, err := dialer.DialContext(context.Background(), "tcp", tcpLis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close() // skipcq: GO-S2307
+
+	if len(pathInfoConns) != 1 || pathInfoConns[0] != conn.NetConns()[0] {
+		t.Errorf("PathInfoFunc called with %v, want the first of NetConns() %v", pathInfoConns, conn.NetConns())
+	}
+
+	// the WATM fails to dial if the path cannot be inspected
+	config = config.Clone()
+	config.PathInfoFunc = func(net.Conn) (water.PathInfo, error) {
+		return water.PathInfo{}, water.ErrPathInfoUnsupported
+	}
+	dialer, err = v1.NewDialerWithContext(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conn, err := dialer.DialContext(context.Background(), "tcp", tcpLis.Addr().String()); err == nil {
+		conn.Close()
+		t.Fatal("DialContext() with unsupported path info returned no error")
+	}
+}
+
+func testDialerRaw(t *testing.T) {
+	config := &water.Config{
+		TransportModuleBin:     wasmDialRaw,
+		ModuleConfigFactory:    water.NewWazeroModuleConfigFactory(),
+		DialedAddressValidator: func(_, _ string) error { return nil },
+	}
+
+	// raw sockets are not allowed unless AllowRaw is set
+	dialer, err := v1.NewDialerWithContext(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conn, err := dialer.DialContext(context.Background(), "tcp", "localhost:0"); err == nil {
+		conn.Close()
+		t.Fatal("DialContext() of raw socket without AllowRaw returned no error")
+	}
+
+	if rawConn, err := net.Dial("ip4:icmp", "127.0.0.1"); err != nil {
+		t.Skipf("raw sockets are unavailable: %v", err)
+	} else {
+		rawConn.Close()
+	}
+
+	// the host dialed is checked against the DialAllowlist
+	config = config.Clone()
+	config.AllowRaw = true
+	config.DialAllowlist = &water.DialAllowlist{
+		Prefixes: []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")},
+	}
+	dialer, err = v1.NewDialerWithContext(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conn, err := dialer.DialContext(context.Background(), "tcp", "localhost:0"); err == nil {
+		conn.Close()
+		t.Fatal("DialContext() of raw socket not allowed by DialAllowlist returned no error")
+	}
+
+	config = config.Clone()
+	config.DialAllowlist = &water.DialAllowlist{
+		Prefixes: []netip.Prefix{netip.MustParsePrefix("127.0.0.1/32")},
+	}
+	dialer, err = v1.NewDialerWithContext(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := dialer.DialContext(context.Background(), "tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close() // skipcq: GO-S2307
 
-		if !bytes.Equal(waterRecvBuf[:n], peerSendBuf) {
-			t.Fatalf("waterRecvBuf != peerSendBuf")
-		}
+	if _, ok := conn.NetConn().(*net.IPConn); !ok {
+		t.Errorf("NetConn() = %T, want *net.IPConn", conn.NetConn())
+	}
+}
 
-		tripleGC(100 * time.Microsecond)
+func testDialerTUN(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("TUN devices are supported on Linux only")
 	}
 
-	// reading with a deadline
-	err = conn.SetDeadline(time.Now().Add(100 * time.Millisecond))
+	tcpLis, err := net.Listen("tcp", "localhost:0")
 	if err != nil {
 		t.Fatal(err)
 	}
+	defer tcpLis.Close() // skipcq: GO-S2307
 
-	_, err = conn.Read(waterRecvBuf)
-	if err == nil {
-		t.Fatalf("conn.Read must timeout")
+	config := &water.Config{
+		TransportModuleBin:  wasmTUN,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
 	}
 
-	if err := conn.Close(); err != nil {
+	// the WATM fails to dial without a TUN device
+	dialer, err := v1.NewDialerWithContext(context.Background(), config)
+	if err != nil {
 		t.Fatal(err)
 	}
-
-	// after closing the conn, read/write MUST fail
-	_, err = conn.Write(waterSendBuf)
-	if err == nil {
-		t.Fatalf("conn.Write must fail after closing the conn")
+	if conn, err := dialer.DialContext(context.Background(), "tcp", tcpLis.Addr().String()); err == nil {
+		conn.Close()
+		t.Fatal("DialContext() without TUN returned no error")
 	}
 
-	_, err = conn.Read(waterRecvBuf)
-	if err == nil {
-		t.Fatalf("conn.Read must fail after closing the conn")
+	// a pipe stands in for the TUN device, as opening one needs privileges
+	tunPeer, tunFile, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
 	}
+	defer tunPeer.Close() // skipcq: GO-S2307
+	defer tunFile.Close() // skipcq: GO-S2307
 
-	if err := tcpLis.Close(); err != nil {
+	config = config.Clone()
+	config.TUN = &water.TUN{File: tunFile}
+	dialer, err = v1.NewDialerWithContext(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := dialer.DialContext(context.Background(), "tcp", tcpLis.Addr().String())
+	if err != nil {
 		t.Fatal(err)
 	}
+	defer conn.Close() // skipcq: GO-S2307
 
-	tripleGC(100 * time.Microsecond)
+	packet := make([]byte, 16)
+	if err := tunPeer.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	n, err := tunPeer.Read(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(packet[:n]) != "ping" {
+		t.Errorf("TUN device received %q, want %q", packet[:n], "ping")
+	}
 }
 
-func testFixedDialerReverse(t *testing.T) { // skipcq: GO-R1005
-	tcpLis, err := net.Listen("tcp", "localhost:7700")
+func testDialerLifecycle(t *testing.T) {
+	tcpLis, err := net.Listen("tcp", "localhost:0")
 	if err != nil {
 		t.Fatal(err)
 	}
 	defer tcpLis.Close() // skipcq: GO-S2307
 
-	// Dial using water
+	var steps []string
+	var events []*water.DialEvent
+	record := func(step string) func(*water.DialEvent) {
+		return func(event *water.DialEvent) {
+			steps = append(steps, step)
+			events = append(events, event)
+		}
+	}
 	config := &water.Config{
-		TransportModuleBin:  wasmReverse,
-		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
-		DialedAddressValidator: func(network, address string) error {
-			if network != "tcp" || address != "localhost:7700" {
-				return fmt.Errorf("invalid address: %s", address)
-			}
-			return nil
-		},
+		TransportModuleBin:    wasmPlain,
+		ModuleConfigFactory:   water.NewWazeroModuleConfigFactory(),
+		OnDialStart:           record("start"),
+		OnUnderlyingConnected: record("connected"),
+		OnHandshakeComplete:   record("handshake"),
+		OnClose:               record("close"),
 	}
-	dialer, err := v1.NewFixedDialerWithContext(context.Background(), config)
+	dialer, err := v1.NewDialerWithContext(context.Background(), config)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	conn, err := dialer.DialFixedContext(context.Background())
+	conn, err := dialer.DialContext(context.Background(), "tcp", tcpLis.Addr().String())
 	if err != nil {
 		t.Fatal(err)
 	}
-	defer conn.Close() // skipcq: GO-S2307
-
-	// type assertion: conn must be *v1.Conn
-	if _, ok := conn.(*v1.Conn); !ok {
-		t.Fatalf("returned conn is not *v1.Conn")
-	}
 
 	peerConn, err := tcpLis.Accept()
 	if err != nil {
@@ -750,108 +2240,253 @@ func testFixedDialerReverse(t *testing.T) { // skipcq: GO-R1005
 	}
 	defer peerConn.Close() // skipcq: GO-S2307
 
-	tripleGC(100 * time.Microsecond)
+	if err = conn.Close(); err != nil {
+		t.Fatal(err)
+	}
 
-	var waterSendBuf []byte = make([]byte, 1024)
-	var peerSendBuf []byte = make([]byte, 1024)
-	var waterRecvBuf []byte = make([]byte, 1024)
-	var peerRecvBuf []byte = make([]byte, 1024)
-	// send 10 messages in each direction
-	for i := 0; i < 10; i++ {
-		_, err = rand.Read(waterSendBuf)
-		if err != nil {
-			t.Fatalf("rand.Read error: %s", err)
+	if want := []string{"start", "connected", "handshake", "close"}; fmt.Sprint(steps) != fmt.Sprint(want) {
+		t.Fatalf("lifecycle callbacks called in order %v, want %v", steps, want)
+	}
+	for i, event := range events {
+		if event.Network != "tcp" || event.Address != tcpLis.Addr().String() {
+			t.Errorf("%s: dialed %s %s, want tcp %s", steps[i], event.Network, event.Address, tcpLis.Addr())
 		}
-
-		_, err = rand.Read(peerSendBuf)
-		if err != nil {
-			t.Fatalf("rand.Read error: %s", err)
+		if i > 0 && (event.Start != events[0].Start || event.Elapsed < events[i-1].Elapsed) {
+			t.Errorf("%s: started at %v after %v, want %v after more than %v", steps[i], event.Start, event.Elapsed, events[0].Start, events[i-1].Elapsed)
 		}
+	}
+	if events[1].NetConn != conn.NetConn() {
+		t.Errorf("connected: NetConn = %v, want %v", events[1].NetConn, conn.NetConn())
+	}
+	if events[2].Conn != conn || events[2].Err != nil {
+		t.Errorf("handshake: Conn = %v, Err = %v, want %v and no error", events[2].Conn, events[2].Err, conn)
+	}
 
-		// dialer -> listener
-		_, err = conn.Write(waterSendBuf)
-		if err != nil {
-			t.Fatalf("conn.Write error: %s", err)
-		}
+	// a failed dial completes with the error, and nothing to close
+	steps, events = nil, nil
+	tcpLis.Close()
+	if conn, err := dialer.DialContext(context.Background(), "tcp", tcpLis.Addr().String()); err == nil {
+		conn.Close()
+		t.Fatal("DialContext() to a closed listener returned no error")
+	}
+	if want := []string{"start", "handshake"}; fmt.Sprint(steps) != fmt.Sprint(want) {
+		t.Fatalf("lifecycle callbacks of failed dial called in order %v, want %v", steps, want)
+	}
+	if events[1].Err == nil {
+		t.Error("handshake of failed dial: Err = nil, want the error")
+	}
+}
 
-		n, err := peerConn.Read(peerRecvBuf)
-		if err != nil {
-			t.Fatalf("peerConn.Read error: %s", err)
-		}
+func testDialerEntropySource(t *testing.T) {
+	tcpLis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcpLis.Close() // skipcq: GO-S2307
 
-		if n != len(waterSendBuf) {
-			t.Fatalf("peerConn.Read error: read %d bytes, want %d bytes", n, len(waterSendBuf))
-		}
+	seed := []byte("deadbeef")
+	config := &water.Config{
+		TransportModuleBin:  wasmRandom,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+		EntropySource:       bytes.NewReader(seed),
+	}
+	dialer, err := v1.NewDialerWithContext(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
 
-		// reverse the waterSendBuf
-		for i := 0; i < len(waterSendBuf)/2; i++ {
-			waterSendBuf[i], waterSendBuf[len(waterSendBuf)-1-i] = waterSendBuf[len(waterSendBuf)-1-i], waterSendBuf[i]
-		}
+	conn, err := dialer.DialContext(context.Background(), "tcp", tcpLis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close() // skipcq: GO-S2307
 
-		if !bytes.Equal(peerRecvBuf[:n], waterSendBuf) {
-			t.Fatalf("peerRecvBuf != waterSendBuf")
-		}
+	peerConn, err := tcpLis.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peerConn.Close() // skipcq: GO-S2307
 
-		// listener -> dialer
-		_, err = peerConn.Write(peerSendBuf)
-		if err != nil {
-			t.Fatalf("peerConn.Write error: %s", err)
-		}
+	random := make([]byte, len(seed))
+	if err := peerConn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(peerConn, random); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(random, seed) {
+		t.Errorf("random_get returned %q, want %q from the EntropySource", random, seed)
+	}
+}
 
-		n, err = conn.Read(waterRecvBuf)
-		if err != nil {
-			t.Fatalf("conn.Read error: %s", err)
-		}
+// fixedClock is a water.Clock stopped at a fixed time.
+type fixedClock struct {
+	now time.Time
+}
 
-		if n != len(peerSendBuf) {
-			t.Fatalf("conn.Read error: read %d bytes, want %d bytes", n, len(peerSendBuf))
-		}
+func (c fixedClock) Now() time.Time          { return c.now }
+func (c fixedClock) Nanotime() int64         { return c.now.UnixNano() }
+func (fixedClock) Sleep(time.Duration)       {}
+func (fixedClock) Resolution() time.Duration { return time.Second }
 
-		// reverse the peerSendBuf
-		for i := 0; i < len(peerSendBuf)/2; i++ {
-			peerSendBuf[i], peerSendBuf[len(peerSendBuf)-1-i] = peerSendBuf[len(peerSendBuf)-1-i], peerSendBuf[i]
-		}
+func testDialerClock(t *testing.T) {
+	tcpLis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcpLis.Close() // skipcq: GO-S2307
 
-		if !bytes.Equal(waterRecvBuf[:n], peerSendBuf) {
-			t.Fatalf("waterRecvBuf != peerSendBuf")
-		}
+	now := time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+	config := &water.Config{
+		TransportModuleBin:  wasmClock,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+		Clock:               fixedClock{now: now},
+	}
+	dialer, err := v1.NewDialerWithContext(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
 
-		tripleGC(100 * time.Microsecond)
+	conn, err := dialer.DialContext(context.Background(), "tcp", tcpLis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
 	}
+	defer conn.Close() // skipcq: GO-S2307
 
-	// reading with a deadline
-	err = conn.SetDeadline(time.Now().Add(100 * time.Millisecond))
+	peerConn, err := tcpLis.Accept()
 	if err != nil {
 		t.Fatal(err)
 	}
+	defer peerConn.Close() // skipcq: GO-S2307
 
-	_, err = conn.Read(waterRecvBuf)
-	if err == nil {
-		t.Fatalf("conn.Read must timeout")
+	realtime := make([]byte, 8)
+	if err := peerConn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(peerConn, realtime); err != nil {
+		t.Fatal(err)
+	}
+	if got := binary.LittleEndian.Uint64(realtime); got != uint64(now.UnixNano()) {
+		t.Errorf("clock_time_get returned %d, want %d from the Clock", got, now.UnixNano())
 	}
+}
 
-	if err := conn.Close(); err != nil {
+func testDialerDeadline(t *testing.T) {
+	tcpLis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
 		t.Fatal(err)
 	}
+	defer tcpLis.Close() // skipcq: GO-S2307
 
-	// after closing the conn, read/write MUST fail
-	_, err = conn.Write(waterSendBuf)
-	if err == nil {
-		t.Fatalf("conn.Write must fail after closing the conn")
+	config := &water.Config{
+		TransportModuleBin:  wasmDeadline,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+	}
+	dialer, err := v1.NewDialerWithContext(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	_, err = conn.Read(waterRecvBuf)
-	if err == nil {
-		t.Fatalf("conn.Read must fail after closing the conn")
+	conn, err := dialer.DialContext(context.Background(), "tcp", tcpLis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
 	}
+	defer conn.Close() // skipcq: GO-S2307
 
-	if err := tcpLis.Close(); err != nil {
+	peerConn, err := tcpLis.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peerConn.Close() // skipcq: GO-S2307
+
+	readDeadline, writeDeadline := time.Now().Add(time.Hour), time.Now().Add(2*time.Hour)
+	if err := conn.SetReadDeadline(readDeadline); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.SetWriteDeadline(writeDeadline); err != nil {
 		t.Fatal(err)
 	}
 
-	tripleGC(100 * time.Microsecond)
+	deadlines := make([]byte, 16)
+	if err := peerConn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(peerConn, deadlines); err != nil {
+		t.Fatal(err)
+	}
+	if got := int64(binary.LittleEndian.Uint64(deadlines)); got != readDeadline.UnixNano() {
+		t.Errorf("water_get_deadline(read) returned %d, want %d", got, readDeadline.UnixNano())
+	}
+	if got := int64(binary.LittleEndian.Uint64(deadlines[8:])); got != writeDeadline.UnixNano() {
+		t.Errorf("water_get_deadline(write) returned %d, want %d", got, writeDeadline.UnixNano())
+	}
 }
 
-func testFixedDialerPartialWATM(t *testing.T) {
-	t.Skip("skipping [testFixedDialerPartialWATM]...") // TODO: implement this with a few WebAssembly Transport Modules which partially implement the v1 dialer spec
+func testDialerCredential(t *testing.T) {
+	now := time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		name  string
+		skew  uint
+		later int32 // the result for the epoch 2 periods later
+	}{
+		{"within skew", 2, 32},
+		{"beyond skew", 1, wasip1.EncodeWATERError(syscall.EINVAL)},
+		{"skew beyond int32", math.MaxInt32 + 1, 32},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tcpLis, err := net.Listen("tcp", "localhost:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer tcpLis.Close() // skipcq: GO-S2307
+
+			tbc := &water.TimeBasedCredential{
+				Secret: []byte("secret"),
+				Skew:   tc.skew,
+				Now:    func() time.Time { return now },
+			}
+			config := &water.Config{
+				TransportModuleBin:  wasmCredential,
+				ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+				TimeBasedCredential: tbc,
+			}
+			dialer, err := v1.NewDialerWithContext(context.Background(), config)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			conn, err := dialer.DialContext(context.Background(), "tcp", tcpLis.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close() // skipcq: GO-S2307
+
+			peerConn, err := tcpLis.Accept()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer peerConn.Close() // skipcq: GO-S2307
+
+			buf := make([]byte, 44)
+			if err := peerConn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := io.ReadFull(peerConn, buf); err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(buf[:32], tbc.Current()) {
+				t.Errorf("credential = %x, want %x", buf[:32], tbc.Current())
+			}
+			if n := int32(binary.LittleEndian.Uint32(buf[32:])); n != 32 {
+				t.Errorf("water_get_credential(0) = %d, want 32", n)
+			}
+			if n := int32(binary.LittleEndian.Uint32(buf[36:])); n != tc.later {
+				t.Errorf("water_get_credential(2) = %d, want %d", n, tc.later)
+			}
+			if n, want := int32(binary.LittleEndian.Uint32(buf[40:])), wasip1.EncodeWATERError(syscall.ENOBUFS); n != want {
+				t.Errorf("water_get_credential() with a short buffer = %d, want %d", n, want)
+			}
+		})
+	}
 }
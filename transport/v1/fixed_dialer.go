@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	"github.com/refraction-networking/water"
+	"github.com/refraction-networking/water/internal/driver"
 )
 
 func init() {
@@ -22,8 +23,13 @@ type FixedDialer struct {
 }
 
 func NewFixedDialerWithContext(ctx context.Context, c *water.Config) (water.FixedDialer, error) {
+	config, err := driver.Snapshot(c)
+	if err != nil {
+		return nil, err
+	}
+
 	return &FixedDialer{
-		config: c.Clone(),
+		config: config,
 		ctx:    ctx,
 	}, nil
 }
@@ -37,22 +43,26 @@ func (f *FixedDialer) DialFixedContext(ctx context.Context) (conn water.Conn, er
 		return nil, fmt.Errorf("water: dialing with nil config is not allowed")
 	}
 
+	// the results of the dial are not returned directly, as the dial
+	// may still complete after returning once ctx is done
+	var dialConn water.Conn
+	var dialErr error
 	ctxReady, dialFixedReady := context.WithCancel(context.Background())
 	go func() {
 		defer dialFixedReady()
 		var core water.Core
-		core, err = water.NewCoreWithContext(ctx, f.config)
-		if err != nil {
+		core, dialErr = water.NewCoreWithContext(ctx, f.config)
+		if dialErr != nil {
 			return
 		}
 
-		conn, err = dialFixed(core)
+		dialConn, dialErr = dialFixed(core)
 	}()
 
 	select {
 	case <-ctx.Done():
 		return nil, ctx.Err()
 	case <-ctxReady.Done():
-		return conn, err
+		return dialConn, dialErr
 	}
 }
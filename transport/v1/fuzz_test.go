@@ -0,0 +1,171 @@
+package v1
+
+import (
+	"context"
+	_ "embed"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/refraction-networking/water"
+)
+
+// wasmFuzz is a mock WATM which lets the fuzzer call each host function
+// with arbitrary arguments, write arbitrary bytes into its memory, and
+// decide which fd watm_dial_v1 returns.
+//
+//go:embed testdata/fuzz.wasm
+var wasmFuzz []byte
+
+type fuzzShaper struct{}
+
+func (fuzzShaper) Delay(n int) time.Duration { return time.Duration(n%1000) * time.Microsecond }
+
+func (fuzzShaper) Padding(n int) int { return n }
+
+// fuzzOps lists the operations a fuzzed program is made of, each taking
+// up to 4 arguments.
+var fuzzOps = []struct {
+	export string
+	nargs  int
+}{
+	{"fuzz_set_ret", 1},
+	{"fuzz_store8", 2},
+	{"fuzz_water_dial", 4},
+	{"fuzz_water_get_deadline", 1},
+	{"fuzz_water_get_credential", 3},
+	{"fuzz_water_import_session", 2},
+	{"fuzz_water_export_session", 2},
+	{"fuzz_water_get_remote_address", 2},
+	{"fuzz_water_shape_padding", 1},
+	{"fuzz_water_shape_delay", 1},
+	{"", 0}, // DialFrom, calling watm_dial_v1
+}
+
+const (
+	fuzzOpSize   = 1 + 4*4 // op, then 4 little-endian int32 arguments
+	fuzzMaxOps   = 64
+	fuzzOpDialTo = 10
+)
+
+func fuzzOp(op byte, args ...int32) []byte {
+	b := []byte{op}
+	for i := 0; i < 4; i++ {
+		var arg int32
+		if i < len(args) {
+			arg = args[i]
+		}
+		b = binary.LittleEndian.AppendUint32(b, uint32(arg))
+	}
+	return b
+}
+
+func fuzzProgram(ops ...[]byte) (program []byte) {
+	for _, op := range ops {
+		program = append(program, op...)
+	}
+	return program
+}
+
+// FuzzHostFunctions runs programs of calls from a mock WATM into the host
+// functions, with arbitrary pointers, lengths and fds, in arbitrary order.
+// The host must neither panic nor hand out a connection it does not own.
+//
+// As instantiating a WATM is slow, -fuzzminimizetime is best kept short:
+//
+//	go test -run '^$' -fuzz=FuzzHostFunctions -fuzzminimizetime=5s ./transport/v1
+func FuzzHostFunctions(f *testing.F) {
+	// "tcp" at 64 and "localhost:1" at 96, with an iovec for each at 0 and 8
+	storeString := func(addr int32, s string) (ops [][]byte) {
+		for i := 0; i < len(s); i++ {
+			ops = append(ops, fuzzOp(1, addr+int32(i), int32(s[i])))
+		}
+		return ops
+	}
+	storeIovec := func(addr, buf, length int32) (ops [][]byte) {
+		for i, v := range binary.LittleEndian.AppendUint32(binary.LittleEndian.AppendUint32(nil, uint32(buf)), uint32(length)) {
+			ops = append(ops, fuzzOp(1, addr+int32(i), int32(v)))
+		}
+		return ops
+	}
+	var dialOps [][]byte
+	dialOps = append(dialOps, storeString(64, "tcp")...)
+	dialOps = append(dialOps, storeString(96, "localhost:1")...)
+	dialOps = append(dialOps, storeIovec(0, 64, 3)...)
+	dialOps = append(dialOps, storeIovec(8, 96, 11)...)
+	dialOps = append(dialOps, fuzzOp(2, 0, 1, 8, 1))
+
+	f.Add(fuzzProgram(dialOps...))
+	f.Add(fuzzProgram(fuzzOp(2, 0, -1, 8, 0x20000000), fuzzOp(2, 65535, 1, -8, 1)))
+	f.Add(fuzzProgram(fuzzOp(3, 0), fuzzOp(3, 1), fuzzOp(3, -1)))
+	f.Add(fuzzProgram(fuzzOp(4, 1, 0, 64), fuzzOp(4, -2, 65530, 64), fuzzOp(4, 0, -1, -1)))
+	f.Add(fuzzProgram(fuzzOp(5, 0, 4), fuzzOp(5, 65535, 256), fuzzOp(6, 0, 1<<20), fuzzOp(6, -1, 16), fuzzOp(6, 0, 16)))
+	f.Add(fuzzProgram(fuzzOp(7, 65530, 64), fuzzOp(7, 0, -1), fuzzOp(8, -1), fuzzOp(8, 1<<30), fuzzOp(9, 5)))
+	f.Add(fuzzProgram(fuzzOp(0, 3), fuzzOp(fuzzOpDialTo)))  // returns some fd
+	f.Add(fuzzProgram(fuzzOp(0, -1), fuzzOp(fuzzOpDialTo))) // returns an error
+	f.Add(fuzzProgram(append(dialOps, fuzzOp(0, 4), fuzzOp(fuzzOpDialTo))...))
+
+	f.Fuzz(runFuzzProgram)
+}
+
+func runFuzzProgram(t *testing.T, program []byte) {
+	config := &water.Config{
+		TransportModuleBin:  wasmFuzz,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+		SessionState:        []byte("session"),
+		TimeBasedCredential: &water.TimeBasedCredential{Secret: []byte("secret"), Skew: 1},
+		Shaper:              fuzzShaper{},
+		RemoteAddress:       "example.com:443",
+	}
+
+	core, err := water.NewCoreWithContext(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tm := UpgradeCore(core)
+	defer tm.Close()
+
+	dialer := &networkDialer{
+		dialerFunc: func(network, address string) (net.Conn, error) {
+			c1, c2 := net.Pipe()
+			c2.Close()
+			return c1, nil
+		},
+		addressValidator: func(network, address string) error { return nil },
+	}
+	if err = tm.LinkNetworkInterface(dialer, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = tm.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+
+	dialed := false
+	for i := 0; i+fuzzOpSize <= len(program) && i < fuzzMaxOps*fuzzOpSize; i += fuzzOpSize {
+		op := fuzzOps[int(program[i])%len(fuzzOps)]
+
+		var args []uint64
+		for j := 0; j < op.nargs; j++ {
+			args = append(args, uint64(binary.LittleEndian.Uint32(program[i+1+4*j:])))
+		}
+
+		if op.export != "" {
+			// errors are expected, e.g., a trap on an out-of-bounds store
+			_, _ = core.ExportedFunction(op.export).Call(core.Context(), args...)
+			continue
+		}
+
+		if dialed {
+			continue // the caller connection can be pushed only once
+		}
+		dialed = true
+
+		callerConn, peerConn := net.Pipe()
+		defer peerConn.Close()
+		destConn, err := tm.DialFrom(callerConn)
+		if err == nil && destConn == callerConn {
+			t.Fatal("DialFrom returned the caller connection as the network connection")
+		}
+	}
+}
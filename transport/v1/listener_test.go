@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"context"
 	"crypto/rand"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"testing"
 	"time"
@@ -79,11 +81,24 @@ func ExampleListener() {
 //  3. Listener must fail when an invalid address is supplied.
 //  4. Listener must fail when a WebAssembly Transport Module does not
 //     fully implement the v1 listener spec.
+//  5. Listener must drop connections rejected by the AcceptFilter.
+//  6. Listener must wait for established connections on Shutdown, and
+//     close them forcibly once the context expires.
+//  7. Listener must use the updated WATM for new connections only.
 func TestListener(t *testing.T) {
 	t.Run("plain must work", testListenerPlain)
 	t.Run("reverse must work", testListenerReverse)
 	t.Run("bad addr must fail", testListenerBadAddr)
 	t.Run("partial WATM must fail", testListenerPartialWATM)
+	t.Run("accept filter must work", testListenerAcceptFilter)
+	t.Run("shutdown must drain", testListenerShutdown)
+	t.Run("shutdown must reject connections still in handshake", testListenerShutdownHandshake)
+	t.Run("config update must work", testListenerUpdateConfig)
+	t.Run("transport chain must work", testListenerTransportChain)
+	t.Run("connections channel must work", testListenerConnections)
+	t.Run("auth handler must work", testListenerAuthHandler)
+	t.Run("handshake offload must work", testListenerHandshakeOffload)
+	t.Run("handshake timeout must work", testListenerHandshakeTimeout)
 }
 
 func testListenerBadAddr(t *testing.T) {
@@ -359,6 +374,529 @@ func testListenerPartialWATM(t *testing.T) {
 	t.Skip("skipping [testListenerPartialWATM]...") // TODO: implement this with a few WebAssembly Transport Modules which partially implement the v1 listener spec
 }
 
+func testListenerAcceptFilter(t *testing.T) {
+	// prepare
+	var filtered int
+	config := &water.Config{
+		TransportModuleBin:  wasmReverse,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+		AcceptFilter: func(net.Conn) bool {
+			filtered++
+			return filtered > 1 // reject only the first connection
+		},
+	}
+
+	testLis, err := config.ListenContext(context.Background(), "tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testLis.Close() // skipcq: GO-S2307
+
+	rejectedConn, err := net.Dial("tcp", testLis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rejectedConn.Close() // skipcq: GO-S2307
+
+	peerConn, err := net.Dial("tcp", testLis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peerConn.Close() // skipcq: GO-S2307
+
+	conn, err := testLis.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close() // skipcq: GO-S2307
+
+	if filtered != 2 {
+		t.Fatalf("AcceptFilter called %d times, want 2", filtered)
+	}
+
+	// the rejected connection must have been closed by the listener
+	if err = rejectedConn.SetReadDeadline(time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = rejectedConn.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+		t.Fatalf("rejected connection must be closed, got %v", err)
+	}
+
+	// the accepted connection must work
+	if err = sanityCheckConn(peerConn, conn, []byte("hello"), []byte("olleh")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testListenerAuthHandler(t *testing.T) {
+	// prepare
+	var authorized []water.ConnMetadata
+	errUnauthorized := errors.New("unauthorized")
+	config := &water.Config{
+		TransportModuleBin:  wasmReverse,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+		AuthHandler: func(md water.ConnMetadata) error {
+			authorized = append(authorized, md)
+			if len(authorized) == 1 { // reject only the first connection
+				return errUnauthorized
+			}
+			return nil
+		},
+	}
+
+	testLis, err := config.ListenContext(context.Background(), "tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testLis.Close() // skipcq: GO-S2307
+
+	rejectedConn, err := net.Dial("tcp", testLis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rejectedConn.Close() // skipcq: GO-S2307
+
+	peerConn, err := net.Dial("tcp", testLis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peerConn.Close() // skipcq: GO-S2307
+
+	conn, err := testLis.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close() // skipcq: GO-S2307
+
+	if len(authorized) != 2 {
+		t.Fatalf("AuthHandler called %d times, want 2", len(authorized))
+	}
+	if md := authorized[1]; md.RemoteAddr == nil || md.RemoteAddr.String() != peerConn.LocalAddr().String() {
+		t.Errorf("RemoteAddr is %v, want %v", md.RemoteAddr, peerConn.LocalAddr())
+	}
+
+	// the rejected connection must have been closed by the listener
+	if err = rejectedConn.SetReadDeadline(time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = rejectedConn.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+		t.Fatalf("rejected connection must be closed, got %v", err)
+	}
+
+	// the accepted connection must work
+	if err = sanityCheckConn(peerConn, conn, []byte("hello"), []byte("olleh")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testListenerHandshakeOffload(t *testing.T) {
+	// prepare
+	config := &water.Config{
+		TransportModuleBin:   wasmReverse,
+		ModuleConfigFactory:  water.NewWazeroModuleConfigFactory(),
+		HandshakeConcurrency: 4,
+	}
+
+	testLis, err := config.ListenContext(context.Background(), "tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testLis.Close() // skipcq: GO-S2307
+
+	// the connections are handshaken concurrently, and each accepted one
+	// must work
+	peerConns := make(map[string]net.Conn)
+	for i := 0; i < 3; i++ {
+		peerConn, err := net.Dial("tcp", testLis.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer peerConn.Close() // skipcq: GO-S2307
+		peerConns[peerConn.LocalAddr().String()] = peerConn
+	}
+
+	for i := 0; i < 3; i++ {
+		conn, err := testLis.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close() // skipcq: GO-S2307
+
+		peerConn := peerConns[conn.RemoteAddr().String()]
+		if peerConn == nil {
+			t.Fatalf("accepted unexpected connection from %s", conn.RemoteAddr())
+		}
+		if err = sanityCheckConn(peerConn, conn, []byte("hello"), []byte("olleh")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Accept must return once the Listener is closed
+	accepted := make(chan error, 1)
+	go func() {
+		_, err := testLis.Accept()
+		accepted <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	testLis.Close()
+	select {
+	case err := <-accepted:
+		if err == nil {
+			t.Fatal("Accept must fail once the Listener is closed")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Accept did not return once the Listener is closed")
+	}
+}
+
+func testListenerHandshakeTimeout(t *testing.T) {
+	// prepare
+	config := &water.Config{
+		TransportModuleBin:  wasmReverse,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+		HandshakeTimeout:    time.Nanosecond, // shorter than instantiating the WATM
+	}
+
+	testLis, err := config.ListenContext(context.Background(), "tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testLis.Close() // skipcq: GO-S2307
+
+	peerConn, err := net.Dial("tcp", testLis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peerConn.Close() // skipcq: GO-S2307
+
+	if conn, err := testLis.Accept(); !errors.Is(err, water.ErrHandshakeTimeout) {
+		if conn != nil {
+			conn.Close()
+		}
+		t.Fatalf("Accept() = %v, want %v", err, water.ErrHandshakeTimeout)
+	}
+
+	// the connection must have been closed by the listener
+	if err = peerConn.SetReadDeadline(time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = peerConn.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+		t.Fatalf("connection timed out must be closed, got %v", err)
+	}
+}
+
+func testListenerTransportChain(t *testing.T) {
+	// prepare
+	config := &water.Config{
+		TransportModuleBin:  wasmPlain,
+		TransportChain:      []water.ModuleConfig{{TransportModuleBin: wasmReverse}},
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+	}
+
+	testLis, err := config.ListenContext(context.Background(), "tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testLis.Close() // skipcq: GO-S2307
+
+	// a plain peer must see the transformation by the chain
+	peerConn, err := net.Dial("tcp", testLis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peerConn.Close() // skipcq: GO-S2307
+
+	conn, err := testLis.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close() // skipcq: GO-S2307
+
+	if err = sanityCheckConn(peerConn, conn, []byte("hello"), []byte("olleh")); err != nil {
+		t.Fatal(err)
+	}
+
+	// a Dialer with the same chain must see no transformation
+	dialer, err := v1.NewDialerWithContext(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dialerConn, err := dialer.DialContext(context.Background(), "tcp", testLis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialerConn.Close() // skipcq: GO-S2307
+
+	lisConn, err := testLis.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lisConn.Close() // skipcq: GO-S2307
+
+	if err = sanityCheckConn(dialerConn, lisConn, []byte("hello"), []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = sanityCheckConn(lisConn, dialerConn, []byte("world"), []byte("world")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testListenerConnections(t *testing.T) {
+	// prepare
+	config := &water.Config{
+		TransportModuleBin:  wasmReverse,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+	}
+
+	testLis, err := config.ListenContext(context.Background(), "tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testLis.Close() // skipcq: GO-S2307
+
+	connections := testLis.Connections()
+	if testLis.Connections() != connections {
+		t.Fatal("Connections must return the same channel on every call")
+	}
+
+	peerConn, err := net.Dial("tcp", testLis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peerConn.Close() // skipcq: GO-S2307
+
+	var res water.AcceptResult
+	select {
+	case res = <-connections:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a connection")
+	}
+	if res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	defer res.Conn.Close() // skipcq: GO-S2307
+
+	if res.RemoteAddr == nil || res.RemoteAddr.String() != peerConn.LocalAddr().String() {
+		t.Fatalf("RemoteAddr is %v, want %v", res.RemoteAddr, peerConn.LocalAddr())
+	}
+	if res.HandshakeDuration <= 0 {
+		t.Fatalf("HandshakeDuration is %v, want positive", res.HandshakeDuration)
+	}
+
+	if err = sanityCheckConn(peerConn, res.Conn, []byte("hello"), []byte("olleh")); err != nil {
+		t.Fatal(err)
+	}
+
+	// the channel must be closed once the listener is closed
+	if err = testLis.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case res, ok := <-connections:
+		if ok {
+			t.Fatalf("Connections delivered %+v after Close, want the channel closed", res)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the channel to be closed")
+	}
+}
+
+func testListenerShutdown(t *testing.T) {
+	// prepare
+	config := &water.Config{
+		TransportModuleBin:  wasmPlain,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+	}
+
+	acceptOne := func(testLis water.Listener) (net.Conn, water.Conn) {
+		peerConn, err := net.Dial("tcp", testLis.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		conn, err := testLis.AcceptWATER()
+		if err != nil {
+			peerConn.Close()
+			t.Fatal(err)
+		}
+
+		return peerConn, conn
+	}
+
+	// drained: Shutdown returns once the connection is closed
+	testLis, err := config.ListenContext(context.Background(), "tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	peerConn, conn := acceptOne(testLis)
+	defer peerConn.Close() // skipcq: GO-S2307
+
+	shutdownErr := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		shutdownErr <- testLis.Shutdown(ctx)
+	}()
+
+	select {
+	case err := <-shutdownErr:
+		t.Fatalf("Shutdown returned before the connection is closed: %v", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// established connection must still work during shutdown
+	if err = sanityCheckConn(peerConn, conn, []byte("hello"), []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = conn.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = <-shutdownErr; err != nil {
+		t.Fatalf("Shutdown returned error: %v", err)
+	}
+
+	if _, err = testLis.Accept(); err == nil {
+		t.Fatal("Accept must fail after Shutdown")
+	}
+
+	// expired: the remaining connection is closed forcibly
+	testLis, err = config.ListenContext(context.Background(), "tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	peerConn2, conn2 := acceptOne(testLis)
+	defer peerConn2.Close() // skipcq: GO-S2307
+	defer conn2.Close()     // skipcq: GO-S2307
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err = testLis.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Shutdown returned %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// the WATM must have closed the connection to the peer
+	if err = peerConn2.SetReadDeadline(time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = peerConn2.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+		t.Fatalf("peer connection must be closed after the connection is forcibly closed, got %v", err)
+	}
+}
+
+func testListenerShutdownHandshake(t *testing.T) {
+	config := &water.Config{
+		TransportModuleBin:  wasmAcceptSlow,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+	}
+
+	testLis, err := config.ListenContext(context.Background(), "tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	peerConn, err := net.Dial("tcp", testLis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peerConn.Close() // skipcq: GO-S2307
+
+	type acceptResult struct {
+		conn water.Conn
+		err  error
+	}
+	accepted := make(chan acceptResult, 1)
+	go func() {
+		conn, err := testLis.AcceptWATER()
+		accepted <- acceptResult{conn, err}
+	}()
+	time.Sleep(50 * time.Millisecond) // the handshake is in progress
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err = testLis.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown returned error: %v", err)
+	}
+
+	// the connection must not be tracked after Shutdown returns
+	res := <-accepted
+	if res.err == nil {
+		res.conn.Close()
+		t.Fatal("AcceptWATER must fail once the Listener is shut down")
+	}
+
+	if err = peerConn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = peerConn.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+		t.Fatalf("peer connection must be closed, got %v", err)
+	}
+}
+
+func testListenerUpdateConfig(t *testing.T) {
+	// prepare
+	config := &water.Config{
+		TransportModuleBin:  wasmPlain,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+	}
+
+	testLis, err := config.ListenContext(context.Background(), "tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testLis.Close() // skipcq: GO-S2307
+
+	acceptOne := func() (net.Conn, net.Conn) {
+		peerConn, err := net.Dial("tcp", testLis.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		conn, err := testLis.Accept()
+		if err != nil {
+			peerConn.Close()
+			t.Fatal(err)
+		}
+
+		return peerConn, conn
+	}
+
+	oldPeerConn, oldConn := acceptOne()
+	defer oldPeerConn.Close() // skipcq: GO-S2307
+	defer oldConn.Close()     // skipcq: GO-S2307
+
+	// an invalid WATM must be refused
+	if err = testLis.UpdateConfig(&water.Config{TransportModuleBin: []byte("not a wasm binary")}); err == nil {
+		t.Fatal("UpdateConfig must fail with an invalid WATM")
+	}
+
+	newConfig := config.Clone()
+	newConfig.TransportModuleBin = wasmReverse
+	if err = testLis.UpdateConfig(newConfig); err != nil {
+		t.Fatal(err)
+	}
+
+	newPeerConn, newConn := acceptOne()
+	defer newPeerConn.Close() // skipcq: GO-S2307
+	defer newConn.Close()     // skipcq: GO-S2307
+
+	// the established connection keeps the old WATM
+	if err = sanityCheckConn(oldPeerConn, oldConn, []byte("hello"), []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	// the new connection uses the new WATM
+	if err = sanityCheckConn(newPeerConn, newConn, []byte("hello"), []byte("olleh")); err != nil {
+		t.Fatal(err)
+	}
+}
+
 // BenchmarkInboundListener currently measures only the inbound throughput
 // of the listener. Outbound throughput is measured for the dialer instead.
 //
@@ -11,6 +11,8 @@ import (
 	"time"
 
 	_ "embed"
+
+	"github.com/refraction-networking/water/internal/wat"
 )
 
 var (
@@ -21,6 +23,146 @@ var (
 	wasmReverse []byte
 )
 
+// The mock WATMs in testdata are assembled from their sources in the text
+// format, e.g., testdata/passthrough.wat into testdata/passthrough.wasm.
+//
+//go:generate go run ../../internal/wat/wat2wasm testdata
+
+func TestTestdata(t *testing.T) {
+	if err := wat.Verify("testdata"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// wasmPassthrough is a WATM which requests passthrough right away, leaving
+// the data to be copied by the host. It works as a Relay and Dialer, whose
+// watm_dial_v1 dials the address requested by the caller.
+//
+//go:embed testdata/passthrough.wasm
+var wasmPassthrough []byte
+
+// wasmSession is a WATM which exports the session state in the Config
+// as-is, or "new" if there is none. It works as a Dialer, whose worker
+// returns right away.
+//
+//go:embed testdata/session.wasm
+var wasmSession []byte
+
+// wasmKeepalive is a WATM which opts in to the keepalive control messages,
+// and writes each control message other than exit to the remote. It works
+// as a Dialer.
+//
+//go:embed testdata/keepalive.wasm
+var wasmKeepalive []byte
+
+// wasmShaper is a WATM which, once dialed, waits as long as the Shaper in
+// the Config decides before writing 1 byte, then writes the padding the
+// Shaper requests for it, as a single byte, to the remote. It works as a
+// Dialer, whose worker returns right away.
+//
+//go:embed testdata/shaper.wasm
+var wasmShaper []byte
+
+// wasmRemoteAddress is a WATM which writes the logical destination it
+// learns from the host to the remote. It works as a Dialer, whose worker
+// returns right away.
+//
+//go:embed testdata/remote_address.wasm
+var wasmRemoteAddress []byte
+
+// wasmCloseReason is a WATM which reports a peer reset as the close
+// reason. It works as a Dialer, whose worker returns right away.
+//
+//go:embed testdata/close_reason.wasm
+var wasmCloseReason []byte
+
+// wasmMetadata is a WATM which attaches the cipher it chose as metadata
+// of the connection. It works as a Dialer, whose worker returns right away.
+//
+//go:embed testdata/metadata.wasm
+var wasmMetadata []byte
+
+// wasmMultipath is a WATM which dials two connections to the remote, the
+// second being the one to the remote destination. It works as a Dialer,
+// whose worker returns right away.
+//
+//go:embed testdata/multipath.wasm
+var wasmMultipath []byte
+
+// wasmMultipathPathInfo is a WATM which dials two connections to the
+// remote, like wasmMultipath, and fails to dial unless it finds both paths
+// and the RTT of the first one is 1000 microseconds.
+//
+//go:embed testdata/multipath_path_info.wasm
+var wasmMultipathPathInfo []byte
+
+// wasmDialRaw is a WATM which dials a raw ICMP socket to 127.0.0.1 as the
+// connection to the remote. It works as a Dialer, whose worker returns
+// right away.
+//
+//go:embed testdata/dial_raw.wasm
+var wasmDialRaw []byte
+
+// wasmTUN is a WATM which writes an IP packet, "ping" for short, into the
+// TUN device of the host before dialing the remote. It works as a Dialer,
+// whose worker returns right away.
+//
+//go:embed testdata/tun.wasm
+var wasmTUN []byte
+
+// wasmRandom is a WATM which writes 8 random bytes from random_get to the
+// remote once dialed. It works as a Dialer, whose worker returns right
+// away.
+//
+//go:embed testdata/random.wasm
+var wasmRandom []byte
+
+// wasmClock is a WATM which writes the realtime clock from clock_time_get
+// to the remote once dialed, as a little-endian u64 of nanoseconds. It
+// works as a Dialer, whose worker returns right away.
+//
+//go:embed testdata/clock.wasm
+var wasmClock []byte
+
+// wasmCredential is a WATM which writes to the remote once dialed what
+// water_get_credential returns for the current epoch, for the epoch 2
+// periods later and for a buffer too short: the 32-byte credential of the
+// current epoch followed by the 3 results as little-endian i32s. It works
+// as a Dialer, whose worker returns right away.
+//
+//go:embed testdata/credential.wasm
+var wasmCredential []byte
+
+// wasmDeadline is a WATM which writes the read and write deadlines from
+// water_get_deadline to the remote, as little-endian i64s of Unix
+// nanoseconds, once the write deadline is set. It works as a Dialer, whose
+// worker returns right after.
+//
+//go:embed testdata/deadline.wasm
+var wasmDeadline []byte
+
+// wasmAcceptSlow is a WATM whose watm_accept_v1 spins for a while before
+// accepting, so that the handshake of a connection is still in progress
+// for a short time. It works as a Listener, whose worker returns right
+// away.
+//
+//go:embed testdata/accept_slow.wasm
+var wasmAcceptSlow []byte
+
+// wasmDialSlow is a WATM whose watm_dial_v1 spins for a while before dialing,
+// so that the dial completes only after a short context is done unless
+// interrupted. It works as a Dialer.
+//
+//go:embed testdata/dial_slow.wasm
+var wasmDialSlow []byte
+
+// wasmMemoryGrow is a WATM whose worker grows the memory by a page, then
+// writes 1 byte to the remote and blocks until the exit control message.
+// It works as a Dialer.
+//
+//go:embed testdata/memory_grow.wasm
+var wasmMemoryGrow []byte
+
 //// Gaukas: uncomment the following code once we decide to require
 //// go1.21 as minimum version
 // func init() {
@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"context"
 	"crypto/rand"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"sync"
 	"testing"
@@ -87,9 +89,15 @@ func ExampleRelay() {
 //     doesn't transform the message.
 //  2. Relay must work with a WebAssembly Transport Module that
 //     transforms the message by reversing it.
+//  3. Relay must send a PROXY protocol header carrying the address of
+//     the client to the upstream before relaying the data, if configured.
 func TestRelay(t *testing.T) {
 	t.Run("plain must work", testRelayPlain)
 	t.Run("reverse must work", testRelayReverse)
+	t.Run("PROXY protocol header must be sent", testRelayProxyProtocol)
+	t.Run("access must be logged", testRelayAccessLog)
+	t.Run("passthrough must work", testRelayPassthrough)
+	t.Run("idle connection must be closed", testRelayIdleTimeout)
 }
 
 func testRelayPlain(t *testing.T) { // skipcq: GO-R1005
@@ -367,3 +375,301 @@ func testRelayReverse(t *testing.T) { // skipcq: GO-R1005
 		t.Fatalf("serverRecvBuf != \"olleh\"")
 	}
 }
+
+func testRelayProxyProtocol(t *testing.T) {
+	// test destination: a local TCP server
+	tcpLis, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcpLis.Close() // skipcq: GO-S2307
+
+	config := &water.Config{
+		TransportModuleBin:  wasmPlain,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+		ProxyProtocol:       water.ProxyProtocolV2,
+	}
+	relay, err := v1.NewRelayWithContext(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var relayErr error
+	var relayWg *sync.WaitGroup = new(sync.WaitGroup)
+	relayWg.Add(1)
+	go func() {
+		relayErr = relay.ListenAndRelayTo("tcp", "127.0.0.1:0", "tcp", tcpLis.Addr().String())
+		relayWg.Done()
+	}()
+	time.Sleep(100 * time.Millisecond) // 100ms to spin up relay
+
+	clientConn, err := net.Dial("tcp", relay.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clientConn.Close() // skipcq: GO-S2307
+
+	serverConn, err := tcpLis.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer serverConn.Close() // skipcq: GO-S2307
+
+	if err := serverConn.SetDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	// the header must come first and describe the client-facing side of
+	// the relay, not the relay-facing side of the upstream
+	want, err := water.ProxyProtocolV2.Header(clientConn.LocalAddr(), clientConn.RemoteAddr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := make([]byte, len(want))
+	if _, err := io.ReadFull(serverConn, header); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(header, want) {
+		t.Fatalf("header = %x, want %x", header, want)
+	}
+
+	if _, err := clientConn.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(serverConn, buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "hello" {
+		t.Fatalf("serverConn received %q, want \"hello\"", buf)
+	}
+
+	if err := relay.Close(); err != nil {
+		t.Fatal(err)
+	}
+	relayWg.Wait()
+	if relayErr != nil {
+		t.Fatal(relayErr)
+	}
+}
+
+func testRelayAccessLog(t *testing.T) {
+	// test destination: a local TCP server
+	tcpLis, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcpLis.Close() // skipcq: GO-S2307
+
+	entries := make(chan *water.AccessLogEntry, 1)
+	config := &water.Config{
+		TransportModuleBin:  wasmPlain,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+		AccessLogger: water.AccessLoggerFunc(func(entry *water.AccessLogEntry) {
+			entries <- entry
+		}),
+	}
+	relay, err := v1.NewRelayWithContext(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var relayErr error
+	var relayWg *sync.WaitGroup = new(sync.WaitGroup)
+	relayWg.Add(1)
+	go func() {
+		relayErr = relay.ListenAndRelayTo("tcp", "127.0.0.1:0", "tcp", tcpLis.Addr().String())
+		relayWg.Done()
+	}()
+	time.Sleep(100 * time.Millisecond) // 100ms to spin up relay
+
+	clientConn, err := net.Dial("tcp", relay.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clientConn.Close() // skipcq: GO-S2307
+
+	serverConn, err := tcpLis.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer serverConn.Close() // skipcq: GO-S2307
+
+	if err := sanityCheckConn(clientConn, serverConn, []byte("hello"), []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if err := sanityCheckConn(serverConn, clientConn, []byte("hi"), []byte("hi")); err != nil {
+		t.Fatal(err)
+	}
+
+	// the client hanging up ends the relayed connection
+	if err := clientConn.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case entry := <-entries:
+		if entry.ClientAddr.String() != clientConn.LocalAddr().String() {
+			t.Errorf("ClientAddr = %v, want %v", entry.ClientAddr, clientConn.LocalAddr())
+		}
+		if entry.UpstreamAddr.String() != tcpLis.Addr().String() {
+			t.Errorf("UpstreamAddr = %v, want %v", entry.UpstreamAddr, tcpLis.Addr())
+		}
+		if entry.BytesFromClient != 5 || entry.BytesToUpstream != 5 {
+			t.Errorf("BytesFromClient, BytesToUpstream = %d, %d, want 5, 5", entry.BytesFromClient, entry.BytesToUpstream)
+		}
+		if entry.BytesFromUpstream != 2 || entry.BytesToClient != 2 {
+			t.Errorf("BytesFromUpstream, BytesToClient = %d, %d, want 2, 2", entry.BytesFromUpstream, entry.BytesToClient)
+		}
+		if entry.CloseReason != water.CloseReasonClient {
+			t.Errorf("CloseReason = %q, want %q", entry.CloseReason, water.CloseReasonClient)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no access log entry after the client closed")
+	}
+
+	if err := relay.Close(); err != nil {
+		t.Fatal(err)
+	}
+	relayWg.Wait()
+	if relayErr != nil {
+		t.Fatal(relayErr)
+	}
+}
+
+func testRelayIdleTimeout(t *testing.T) {
+	// test destination: a local TCP server
+	tcpLis, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcpLis.Close() // skipcq: GO-S2307
+
+	idled := make(chan water.Conn, 1)
+	config := &water.Config{
+		TransportModuleBin:  wasmPlain,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+		IdleTimeout:         200 * time.Millisecond,
+		OnIdleTimeout: func(conn water.Conn) {
+			idled <- conn
+		},
+	}
+	relay, err := v1.NewRelayWithContext(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var relayErr error
+	var relayWg *sync.WaitGroup = new(sync.WaitGroup)
+	relayWg.Add(1)
+	go func() {
+		relayErr = relay.ListenAndRelayTo("tcp", "127.0.0.1:0", "tcp", tcpLis.Addr().String())
+		relayWg.Done()
+	}()
+	time.Sleep(100 * time.Millisecond) // 100ms to spin up relay
+
+	clientConn, err := net.Dial("tcp", relay.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clientConn.Close() // skipcq: GO-S2307
+
+	serverConn, err := tcpLis.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer serverConn.Close() // skipcq: GO-S2307
+
+	// an active connection must outlive the IdleTimeout
+	for i := 0; i < 5; i++ {
+		if err := sanityCheckConn(clientConn, serverConn, []byte("hello"), []byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	select {
+	case <-idled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("idle connection is not closed")
+	}
+
+	if err = clientConn.SetReadDeadline(time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = clientConn.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+		t.Errorf("client connection must be closed, got %v", err)
+	}
+
+	if err := relay.Close(); err != nil {
+		t.Fatal(err)
+	}
+	relayWg.Wait()
+	if relayErr != nil {
+		t.Fatal(relayErr)
+	}
+}
+
+func testRelayPassthrough(t *testing.T) {
+	// test destination: a local TCP server
+	tcpLis, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcpLis.Close() // skipcq: GO-S2307
+
+	config := &water.Config{
+		TransportModuleBin:  wasmPassthrough,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+	}
+	relay, err := v1.NewRelayWithContext(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var relayErr error
+	var relayWg *sync.WaitGroup = new(sync.WaitGroup)
+	relayWg.Add(1)
+	go func() {
+		relayErr = relay.ListenAndRelayTo("tcp", "127.0.0.1:0", "tcp", tcpLis.Addr().String())
+		relayWg.Done()
+	}()
+	time.Sleep(100 * time.Millisecond) // 100ms to spin up relay
+
+	clientConn, err := net.Dial("tcp", relay.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clientConn.Close() // skipcq: GO-S2307
+
+	serverConn, err := tcpLis.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer serverConn.Close() // skipcq: GO-S2307
+
+	// the WATM copies nothing, so the data must be copied by the host
+	if err = sanityCheckConn(clientConn, serverConn, []byte("hello"), []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if err = sanityCheckConn(serverConn, clientConn, []byte("world"), []byte("world")); err != nil {
+		t.Fatal(err)
+	}
+
+	// closing one side must close the other
+	clientConn.Close()
+	if err := serverConn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := serverConn.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("serverConn.Read() error = %v, want %v", err, io.EOF)
+	}
+
+	if err := relay.Close(); err != nil {
+		t.Fatal(err)
+	}
+	relayWg.Wait()
+	if relayErr != nil {
+		t.Fatal(relayErr)
+	}
+}
@@ -0,0 +1,99 @@
+//go:build wasip1
+
+// Command async is a plain WATM v1 written with non-blocking I/O: it is a
+// WASI reactor whose connections are served by goroutines scheduled on the
+// event loop of the Go runtime, which waits on the sockets with poll_oneoff.
+//
+// Build with Go 1.24 or later:
+//
+//	GOOS=wasip1 GOARCH=wasm go build -buildmode=c-shared -o async.wasm .
+package main
+
+import (
+	"io"
+	"net"
+	"os"
+	"syscall"
+)
+
+//go:wasmimport env water_dial_fixed
+func waterDialFixed() int32
+
+//go:wasmimport env water_accept
+func waterAccept() int32
+
+var callerFd, remoteFd, ctrlFd int32
+
+//go:wasmexport watm_init_v1
+func watmInit() int32 { return 0 }
+
+//go:wasmexport watm_ctrlpipe_v1
+func watmCtrlpipe(fd int32) int32 {
+	ctrlFd = fd
+	return 0
+}
+
+//go:wasmexport watm_dial_v1
+func watmDial(fd int32) int32 {
+	callerFd = fd
+	remoteFd = waterDialFixed()
+	return remoteFd
+}
+
+//go:wasmexport watm_dial_fixed_v1
+func watmDialFixed(fd int32) int32 { return watmDial(fd) }
+
+//go:wasmexport watm_accept_v1
+func watmAccept(fd int32) int32 {
+	callerFd = fd
+	remoteFd = waterAccept()
+	return remoteFd
+}
+
+//go:wasmexport watm_start_v1
+func watmStart() int32 {
+	caller, err := fileConn(callerFd)
+	if err != nil {
+		return errno(err)
+	}
+	defer caller.Close()
+
+	remote, err := fileConn(remoteFd)
+	if err != nil {
+		return errno(err)
+	}
+	defer remote.Close()
+
+	ctrl, err := fileConn(ctrlFd)
+	if err != nil {
+		return errno(err)
+	}
+	defer ctrl.Close()
+
+	// return once either direction is closed or the host writes anything,
+	// which is the exit message, to the control pipe
+	done := make(chan struct{}, 3)
+	go func() { _, _ = io.Copy(remote, caller); done <- struct{}{} }()
+	go func() { _, _ = io.Copy(caller, remote); done <- struct{}{} }()
+	go func() { _, _ = ctrl.Read(make([]byte, 1)); done <- struct{}{} }()
+	<-done
+	return 0
+}
+
+// fileConn makes the fd non-blocking before wrapping it, so that it is
+// polled by the Go runtime instead of blocking the only thread.
+func fileConn(fd int32) (net.Conn, error) {
+	if err := syscall.SetNonblock(int(fd), true); err != nil {
+		return nil, err
+	}
+	return net.FileConn(os.NewFile(uintptr(fd), ""))
+}
+
+func errno(err error) int32 {
+	if e, ok := err.(syscall.Errno); ok {
+		return -int32(e)
+	}
+	return -int32(syscall.EIO)
+}
+
+func main() {}
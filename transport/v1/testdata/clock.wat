@@ -0,0 +1,14 @@
+(module
+  (import "env" "water_dial_fixed" (func (result i32)))
+  (import "wasi_snapshot_preview1" "clock_time_get" (func (param i32 i64 i32) (result i32)))
+  (import "wasi_snapshot_preview1" "fd_write" (func (param i32 i32 i32 i32) (result i32)))
+  (memory (export "memory") 1)
+  (data (i32.const 0) "\10\00\00\00\08\00\00\00") ;; iovec{buf: 16, len: 8}
+  (func (export "watm_init_v1") (result i32) (i32.const 0))
+  (func (export "watm_ctrlpipe_v1") (param i32) (result i32) (i32.const 0))
+  (func (export "watm_start_v1") (result i32) (i32.const 0))
+  (func (export "watm_dial_v1") (param i32) (result i32) (local i32)
+    (local.set 1 (call 0))
+    (drop (call 1 (i32.const 0) (i64.const 1) (i32.const 16))) ;; realtime
+    (drop (call 2 (local.get 1) (i32.const 0) (i32.const 1) (i32.const 8)))
+    (local.get 1)))
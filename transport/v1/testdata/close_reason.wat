@@ -0,0 +1,13 @@
+(module
+  (import "env" "water_dial_fixed" (func (result i32)))
+  (import "env" "water_set_close_reason" (func (param i32 i32 i32) (result i32)))
+  (memory (export "memory") 1)
+  (global $remote (mut i32) (i32.const 0))
+  (data (i32.const 16) "peer went away")
+  (func (export "watm_init_v1") (result i32) (i32.const 0))
+  (func (export "watm_ctrlpipe_v1") (param i32) (result i32) (i32.const 0))
+  (func (export "watm_start_v1") (result i32)
+    (drop (call 1 (i32.const 3) (i32.const 16) (i32.const 14))) ;; peer reset
+    (i32.const 0))
+  (func (export "watm_dial_v1") (param i32) (result i32)
+    (global.set $remote (call 0)) (global.get $remote)))
@@ -0,0 +1,16 @@
+(module
+  (import "env" "water_dial_fixed" (func (result i32)))
+  (import "env" "water_get_credential" (func (param i32 i32 i32) (result i32)))
+  (import "wasi_snapshot_preview1" "fd_write" (func (param i32 i32 i32 i32) (result i32)))
+  (memory (export "memory") 1)
+  (data (i32.const 0) "\10\00\00\00\2c\00\00\00") ;; iovec{buf: 16, len: 44}
+  (func (export "watm_init_v1") (result i32) (i32.const 0))
+  (func (export "watm_ctrlpipe_v1") (param i32) (result i32) (i32.const 0))
+  (func (export "watm_start_v1") (result i32) (i32.const 0))
+  (func (export "watm_dial_v1") (param i32) (result i32) (local i32)
+    (local.set 1 (call 0))
+    (i32.store (i32.const 48) (call 1 (i32.const 0) (i32.const 16) (i32.const 32))) ;; current
+    (i32.store (i32.const 52) (call 1 (i32.const 2) (i32.const 128) (i32.const 32))) ;; current + 2
+    (i32.store (i32.const 56) (call 1 (i32.const 0) (i32.const 128) (i32.const 8))) ;; too short
+    (drop (call 2 (local.get 1) (i32.const 0) (i32.const 1) (i32.const 8)))
+    (local.get 1)))
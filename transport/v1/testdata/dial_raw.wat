@@ -0,0 +1,11 @@
+(module
+  (import "env" "water_dial_raw" (func (param i32 i32 i32 i32) (result i32)))
+  (memory (export "memory") 1)
+  (func (export "watm_init_v1") (result i32) (i32.const 0))
+  (func (export "watm_ctrlpipe_v1") (param i32) (result i32) (i32.const 0))
+  (func (export "watm_start_v1") (result i32) (i32.const 0))
+  (func (export "watm_dial_v1") (param i32) (result i32)
+    (call 0 (i32.const 0) (i32.const 1) (i32.const 8) (i32.const 1)))
+  (data (i32.const 0) "\20\00\00\00\08\00\00\00\30\00\00\00\09\00\00\00")
+  (data (i32.const 32) "ip4:icmp")
+  (data (i32.const 48) "127.0.0.1"))
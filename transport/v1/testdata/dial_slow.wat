@@ -0,0 +1,10 @@
+(module
+  (import "env" "water_dial_fixed" (func (result i32)))
+  (memory (export "memory") 1)
+  (func (export "watm_init_v1") (result i32) (i32.const 0))
+  (func (export "watm_ctrlpipe_v1") (param i32) (result i32) (i32.const 0))
+  (func (export "watm_start_v1") (result i32) (i32.const 0))
+  (func (export "watm_dial_v1") (param i32) (result i32) (local i32)
+    (local.set 1 (i32.const 0x4000000))
+    (loop (br_if 0 (local.tee 1 (i32.sub (local.get 1) (i32.const 1)))))
+    (call 0)))
@@ -0,0 +1,31 @@
+(module
+  (import "env" "water_dial" (func (param i32 i32 i32 i32) (result i32)))
+  (import "env" "water_get_deadline" (func (param i32) (result i64)))
+  (import "env" "water_get_credential" (func (param i32 i32 i32) (result i32)))
+  (import "env" "water_import_session" (func (param i32 i32) (result i32)))
+  (import "env" "water_export_session" (func (param i32 i32) (result i32)))
+  (import "env" "water_get_remote_address" (func (param i32 i32) (result i32)))
+  (import "env" "water_shape_padding" (func (param i32) (result i32)))
+  (import "env" "water_shape_delay" (func (param i32) (result i32)))
+  (memory (export "memory") 1)
+  (global $ret (mut i32) (i32.const 0))
+  (func (export "watm_init_v1") (result i32) (i32.const 0))
+  (func (export "watm_ctrlpipe_v1") (param i32) (result i32) (i32.const 0))
+  (func (export "watm_start_v1") (result i32) (i32.const 0))
+  (func (export "watm_dial_v1") (param i32) (result i32) (global.get $ret))
+  (func (export "fuzz_set_ret") (param i32) (global.set $ret (local.get 0)))
+  (func (export "fuzz_store8") (param i32 i32) (i32.store8 (local.get 0) (local.get 1)))
+  ;; fuzz_<name> forwards its params to the import <name> and returns its result
+  (func (export "fuzz_water_dial") (param i32 i32 i32 i32) (result i32)
+    (call 0 (local.get 0) (local.get 1) (local.get 2) (local.get 3)))
+  (func (export "fuzz_water_get_deadline") (param i32) (result i64) (call 1 (local.get 0)))
+  (func (export "fuzz_water_get_credential") (param i32 i32 i32) (result i32)
+    (call 2 (local.get 0) (local.get 1) (local.get 2)))
+  (func (export "fuzz_water_import_session") (param i32 i32) (result i32)
+    (call 3 (local.get 0) (local.get 1)))
+  (func (export "fuzz_water_export_session") (param i32 i32) (result i32)
+    (call 4 (local.get 0) (local.get 1)))
+  (func (export "fuzz_water_get_remote_address") (param i32 i32) (result i32)
+    (call 5 (local.get 0) (local.get 1)))
+  (func (export "fuzz_water_shape_padding") (param i32) (result i32) (call 6 (local.get 0)))
+  (func (export "fuzz_water_shape_delay") (param i32) (result i32) (call 7 (local.get 0))))
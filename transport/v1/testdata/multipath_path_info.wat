@@ -0,0 +1,17 @@
+(module
+  (import "env" "water_dial_fixed" (func (result i32)))
+  (import "env" "water_paths" (func (param i32 i32) (result i32)))
+  (import "env" "water_path_info" (func (param i32 i32 i32) (result i32)))
+  (memory (export "memory") 1)
+  (func (export "watm_init_v1") (result i32) (i32.const 0))
+  (func (export "watm_ctrlpipe_v1") (param i32) (result i32) (i32.const 0))
+  (func (export "watm_start_v1") (result i32) (i32.const 0))
+  (func (export "watm_dial_v1") (param i32) (result i32)
+    (drop (call 0)) (drop (call 0))
+    (if (i32.ne (call 1 (i32.const 0) (i32.const 8)) (i32.const 2))
+      (then (return (i32.const -1))))
+    (if (call 2 (i32.load (i32.const 0)) (i32.const 16) (i32.const 40))
+      (then (return (i32.const -2))))
+    (if (i64.ne (i64.load (i32.const 16)) (i64.const 1000))
+      (then (return (i32.const -3))))
+    (i32.load offset=4 (i32.const 0))))
@@ -0,0 +1,11 @@
+(module
+  (import "env" "water_accept" (func (result i32)))
+  (import "env" "water_dial_fixed" (func (result i32)))
+  (import "env" "water_passthrough" (func (result i32)))
+  (memory (export "memory") 1)
+  (func (export "watm_init_v1") (result i32) (i32.const 0))
+  (func (export "watm_associate_v1") (result i32)
+    (drop (call 0)) (drop (call 1)) (i32.const 0))
+  (func (export "watm_ctrlpipe_v1") (param i32) (result i32) (i32.const 0))
+  (func (export "watm_start_v1") (result i32) (call 2))
+  (func (export "watm_dial_v1") (param i32) (result i32) (call 1)))
@@ -0,0 +1,14 @@
+(module
+  (import "env" "water_dial_fixed" (func (result i32)))
+  (import "env" "water_import_session" (func (param i32 i32) (result i32)))
+  (import "env" "water_export_session" (func (param i32 i32) (result i32)))
+  (memory (export "memory") 1)
+  (data (i32.const 256) "new")
+  (func (export "watm_init_v1") (result i32) (local i32)
+    (if (result i32) (i32.lt_s (local.tee 0 (call 1 (i32.const 0) (i32.const 256))) (i32.const 0))
+      (then (call 2 (i32.const 256) (i32.const 3)))
+      (else (call 2 (i32.const 0) (local.get 0))))
+    (drop) (i32.const 0))
+  (func (export "watm_ctrlpipe_v1") (param i32) (result i32) (i32.const 0))
+  (func (export "watm_start_v1") (result i32) (i32.const 0))
+  (func (export "watm_dial_v1") (param i32) (result i32) (call 0)))
@@ -0,0 +1,17 @@
+(module
+  (import "env" "water_dial_fixed" (func (result i32)))
+  (import "env" "water_shape_delay" (func (param i32) (result i32)))
+  (import "env" "water_shape_padding" (func (param i32) (result i32)))
+  (import "wasi_snapshot_preview1" "fd_write" (func (param i32 i32 i32 i32) (result i32)))
+  (memory (export "memory") 1)
+  (global $remote (mut i32) (i32.const 0))
+  (data (i32.const 0) "\10\00\00\00\01\00\00\00") ;; iovec{buf: 16, len: 1}
+  (func (export "watm_init_v1") (result i32) (i32.const 0))
+  (func (export "watm_ctrlpipe_v1") (param i32) (result i32) (i32.const 0))
+  (func (export "watm_start_v1") (result i32)
+    (drop (call 1 (i32.const 1)))
+    (i32.store8 (i32.const 16) (call 2 (i32.const 1)))
+    (drop (call 3 (global.get $remote) (i32.const 0) (i32.const 1) (i32.const 8)))
+    (i32.const 0))
+  (func (export "watm_dial_v1") (param i32) (result i32)
+    (global.set $remote (call 0)) (global.get $remote)))
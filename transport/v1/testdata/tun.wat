@@ -0,0 +1,15 @@
+(module
+  (import "env" "water_get_tun" (func (result i32)))
+  (import "env" "water_dial_fixed" (func (result i32)))
+  (import "wasi_snapshot_preview1" "fd_write" (func (param i32 i32 i32 i32) (result i32)))
+  (memory (export "memory") 1)
+  (data (i32.const 0) "\10\00\00\00\04\00\00\00") ;; iovec{buf: 16, len: 4}
+  (data (i32.const 16) "ping")
+  (func (export "watm_init_v1") (result i32) (i32.const 0))
+  (func (export "watm_ctrlpipe_v1") (param i32) (result i32) (i32.const 0))
+  (func (export "watm_start_v1") (result i32) (i32.const 0))
+  (func (export "watm_dial_v1") (param i32) (result i32) (local i32)
+    (local.set 1 (call 0))
+    (if (i32.lt_s (local.get 1) (i32.const 0)) (then (return (local.get 1))))
+    (drop (call 2 (local.get 1) (i32.const 0) (i32.const 1) (i32.const 8)))
+    (call 1)))
@@ -1,16 +1,23 @@
 package v1
 
 import (
+	"context"
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"math"
 	"net"
+	"os"
 	"runtime"
+	"runtime/pprof"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/refraction-networking/water"
+	"github.com/refraction-networking/water/internal/driver"
 	"github.com/refraction-networking/water/internal/log"
 	"github.com/refraction-networking/water/internal/socket"
 	"github.com/refraction-networking/water/internal/wasip1"
@@ -70,6 +77,15 @@ type TransportModule struct {
 		// blocking _start() function.
 		_ctrlpipe func(int32) (int32, error) // watm_ctrlpipe_v1(fd i32) -> (err i32)
 
+		// _keepalive is optionally exported by the WASM module to opt in to the
+		// keepalive control messages. It is called once before _start() with
+		// the interval in milliseconds, after which the host writes a keepalive
+		// control message to the control pipe every interval, upon which the
+		// WASM module may send protocol-level keepalives or padding.
+		//
+		// nil if not exported.
+		_keepalive func(int32) (int32, error) // watm_keepalive_v1(interval_ms i32) -> (err i32)
+
 		// _start provides a blocking function for the WASM module to run a worker thread.
 		// In the worker thread, WASM module should select on all previously pushed sockets
 		// (typically, two among callerConnFd, remoteConnFd, and sourceConnFd) and handle
@@ -91,6 +107,10 @@ type TransportModule struct {
 		exited     chan bool
 		exitedWith atomic.Value // error
 
+		// onExit is called after exited is closed, on the goroutine which
+		// ran the worker thread, see OnWorkerExit.
+		onExit func()
+
 		// a socket used to cancel the worker thread. When the host calls Cancel(), it should
 		// write to this socket.
 		controlPipe *CtrlPipe
@@ -99,6 +119,50 @@ type TransportModule struct {
 	managedConns      map[int32]net.Conn // the conn we want to keep alive
 	managedConnsMutex sync.RWMutex
 
+	// callerConn is the WATM's end of the connection to the caller, if any.
+	callerConn net.Conn
+
+	// networkConns are the network connections dialed or accepted for the
+	// WATM, as opposed to the connection to the caller and the control pipe.
+	networkConns      []net.Conn
+	networkConnsMutex sync.Mutex
+
+	// outboundConns is the number of network connections dialed for the
+	// WATM, capped by the MaxOutboundConns of the Config.
+	outboundConns atomic.Int32
+
+	// tun is the TUN device opened for the WATM via the optional
+	// `env.water_get_tun` import, and tunFd its file descriptor.
+	tun      *os.File
+	tunFd    int32
+	tunMutex sync.Mutex
+
+	// passthrough is set once the WATM declares that the data needs no more
+	// transformation via the optional `env.water_passthrough` import.
+	passthrough atomic.Bool
+
+	// session is the latest session state exported by the WATM via the
+	// optional `env.water_export_session` import.
+	session atomic.Pointer[[]byte]
+
+	// closeReason is the latest close reason reported by the WATM via the
+	// optional `env.water_set_close_reason` import.
+	closeReason atomic.Pointer[water.CloseReason]
+
+	// metadata is the key/value metadata attached to the connection by the
+	// WATM via the optional `env.water_set_metadata` import.
+	metadata      map[string]string
+	metadataMutex sync.Mutex
+
+	// deadlines set on the Conn, in Unix nanoseconds, 0 if none. They are
+	// exposed to the WATM via the optional `env.water_get_deadline` import.
+	readDeadline  atomic.Int64
+	writeDeadline atomic.Int64
+
+	// role is "dialer", "listener" or "relay" once the WATM is used as
+	// one, which labels its worker thread for the profiler.
+	role string
+
 	deferOnce     sync.Once
 	deferredFuncs []func()
 
@@ -136,15 +200,19 @@ func (tm *TransportModule) AcceptFor(reverseCallerConn net.Conn) (sourceConn net
 	if tm._accept == nil {
 		return nil, fmt.Errorf("water: WASM module does not export watm_accept_v1")
 	}
+	tm.role = "listener"
 
 	callerFd, err := tm.PushConn(reverseCallerConn)
 	if err != nil {
 		return nil, fmt.Errorf("water: pushing caller conn failed: %w", err)
 	}
+	tm.callerConn = reverseCallerConn
 
 	sourceFd, err := tm._accept(callerFd)
 	if err != nil {
 		return nil, fmt.Errorf("water: calling _accept: %w", err)
+	} else if sourceFd == callerFd {
+		return nil, fmt.Errorf("water: WATM returned the caller connection as the network connection")
 	} else {
 		sourceConn := tm.GetManagedConns(sourceFd)
 		if sourceConn == nil {
@@ -162,6 +230,7 @@ func (tm *TransportModule) Associate() error {
 	if tm._associate == nil {
 		return fmt.Errorf("water: WASM module does not export watm_associate_v1")
 	}
+	tm.role = "relay"
 
 	_, err := tm._associate()
 	if err != nil {
@@ -177,7 +246,7 @@ func (tm *TransportModule) Associate() error {
 // If a timeout is set, this function will cancel the underlying
 // context to terminate the WebAssembly execution if the worker
 // does not exit before the timeout.
-func (tm *TransportModule) Cancel(timeout time.Duration) error {
+func (tm *TransportModule) Cancel(timeout time.Duration) (err error) {
 	if tm.backgroundWorker == nil {
 		return fmt.Errorf("water: Transport Module is not initialized")
 	}
@@ -186,6 +255,15 @@ func (tm *TransportModule) Cancel(timeout time.Duration) error {
 		return fmt.Errorf("water: Transport Module is cancelled")
 	}
 
+	// the control pipe must be closed even if the worker thread has already
+	// exited or failed to be cancelled, otherwise it is leaked.
+	defer func() {
+		if closeErr := tm.backgroundWorker.controlPipe.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("water: closing cancel pipe failed: %w", closeErr)
+		}
+		tm.backgroundWorker.controlPipe = nil
+	}()
+
 	// Sanity check: if the worker thread has already exited, we don't need to cancel
 	select {
 	case <-tm.backgroundWorker.exited: // already exited
@@ -218,12 +296,6 @@ func (tm *TransportModule) Cancel(timeout time.Duration) error {
 		return fmt.Errorf("water: worker thread returned error: %w", err)
 	}
 
-	if err := tm.backgroundWorker.controlPipe.Close(); err != nil {
-		return fmt.Errorf("water: closing cancel pipe failed: %w", err)
-	}
-
-	tm.backgroundWorker.controlPipe = nil
-
 	return nil
 }
 
@@ -245,11 +317,22 @@ func (tm *TransportModule) Cleanup() {
 	}
 	tm.managedConnsMutex.Unlock()
 
+	// clean up the TUN device
+	tm.tunMutex.Lock()
+	if tm.tun != nil {
+		if err := tm.tun.Close(); err != nil {
+			log.LErrorf(tm.Core().Logger(), "water: closing TUN device failed: %v", err)
+		}
+		tm.tun = nil
+	}
+	tm.tunMutex.Unlock()
+
 	// clean up deferred functions
 	tm.deferredFuncs = nil
 
 	// clean up all saved functions
 	tm._init = nil
+	tm._dial_fixed = nil
 	tm._dial = nil
 	tm._accept = nil
 	tm._associate = nil
@@ -280,15 +363,19 @@ func (tm *TransportModule) DialFixedFrom(reverseCallerConn net.Conn) (destConn n
 	if tm._dial_fixed == nil {
 		return nil, fmt.Errorf("water: WASM module does not export watm_dial_fixed_v1")
 	}
+	tm.role = "dialer"
 
 	callerFd, err := tm.PushConn(reverseCallerConn)
 	if err != nil {
 		return nil, fmt.Errorf("water: pushing caller conn failed: %w", err)
 	}
+	tm.callerConn = reverseCallerConn
 
 	remoteFd, err := tm._dial_fixed(callerFd)
 	if err != nil {
 		return nil, fmt.Errorf("water: calling _dial_fixed: %w", err)
+	} else if remoteFd == callerFd {
+		return nil, fmt.Errorf("water: WATM returned the caller connection as the network connection")
 	} else {
 		destConn := tm.GetManagedConns(remoteFd)
 		if destConn == nil {
@@ -305,6 +392,24 @@ func (tm *TransportModule) Core() water.Core {
 	return core
 }
 
+// RuntimeStats returns a snapshot of the resources used by the WATM.
+func (tm *TransportModule) RuntimeStats() water.RuntimeStats {
+	var stats water.RuntimeStats
+
+	if core := tm.Core(); core != nil {
+		stats.MemorySize = core.MemorySize()
+	}
+
+	tm.managedConnsMutex.RLock()
+	stats.HostConns = len(tm.managedConns)
+	for _, conn := range tm.managedConns {
+		stats.HostBufferSize += socket.TotalBufferSize(conn)
+	}
+	tm.managedConnsMutex.RUnlock()
+
+	return stats
+}
+
 func (tm *TransportModule) Defer(f func()) {
 	tm.deferredFuncs = append(tm.deferredFuncs, f)
 }
@@ -327,15 +432,19 @@ func (tm *TransportModule) DialFrom(reverseCallerConn net.Conn) (destConn net.Co
 	if tm._dial == nil {
 		return nil, fmt.Errorf("water: WASM module does not export watm_dial_v1")
 	}
+	tm.role = "dialer"
 
 	callerFd, err := tm.PushConn(reverseCallerConn)
 	if err != nil {
 		return nil, fmt.Errorf("water: pushing caller conn failed: %w", err)
 	}
+	tm.callerConn = reverseCallerConn
 
 	remoteFd, err := tm._dial(callerFd)
 	if err != nil {
 		return nil, fmt.Errorf("water: calling _dial: %w", err)
+	} else if remoteFd == callerFd {
+		return nil, fmt.Errorf("water: WATM returned the caller connection as the network connection")
 	} else {
 		destConn := tm.GetManagedConns(remoteFd)
 		if destConn == nil {
@@ -399,7 +508,8 @@ func (tm *TransportModule) Initialize() error {
 		return err
 	}
 
-	coreCtx := tm.Core().Context()
+	core := tm.Core()
+	pool := core.Config().ExecutionPool
 
 	// _init
 	init := tm.Core().ExportedFunction("watm_init_v1")
@@ -419,7 +529,7 @@ func (tm *TransportModule) Initialize() error {
 		}
 
 		tm._init = func() (int32, error) {
-			ret, err := init.Call(coreCtx)
+			ret, err := core.Call(pool, init)
 			if err != nil {
 				return 0, fmt.Errorf("water: calling watm_init_v1 function returned error: %w", err)
 			}
@@ -451,7 +561,7 @@ func (tm *TransportModule) Initialize() error {
 		}
 
 		tm._dial_fixed = func(callerFd int32) (int32, error) {
-			ret, err := dial_fixed.Call(coreCtx, api.EncodeI32(callerFd))
+			ret, err := core.Call(pool, dial_fixed, api.EncodeI32(callerFd))
 			if err != nil {
 				return 0, fmt.Errorf("water: calling watm_dial_fixed_v1 function returned error: %w", err)
 			}
@@ -483,7 +593,7 @@ func (tm *TransportModule) Initialize() error {
 		}
 
 		tm._dial = func(callerFd int32) (int32, error) {
-			ret, err := dial.Call(coreCtx, api.EncodeI32(callerFd))
+			ret, err := core.Call(pool, dial, api.EncodeI32(callerFd))
 			if err != nil {
 				return 0, fmt.Errorf("water: calling watm_dial_v1 function returned error: %w", err)
 			}
@@ -515,7 +625,7 @@ func (tm *TransportModule) Initialize() error {
 		}
 
 		tm._accept = func(callerFd int32) (int32, error) {
-			ret, err := accept.Call(coreCtx, api.EncodeI32(callerFd))
+			ret, err := core.Call(pool, accept, api.EncodeI32(callerFd))
 			if err != nil {
 				return 0, fmt.Errorf("water: calling watm_accept_v1 function returned error: %w", err)
 			}
@@ -545,7 +655,7 @@ func (tm *TransportModule) Initialize() error {
 		}
 
 		tm._associate = func() (int32, error) {
-			ret, err := associate.Call(coreCtx)
+			ret, err := core.Call(pool, associate)
 			if err != nil {
 				return 0, fmt.Errorf("water: calling watm_associate_v1 function returned error: %w", err)
 			}
@@ -574,6 +684,24 @@ func (tm *TransportModule) Initialize() error {
 		}
 	}
 
+	// watm_keepalive_v1: optional, to receive keepalive control messages
+	keepalive := tm.Core().ExportedFunction("watm_keepalive_v1")
+	if keepalive != nil {
+		// check signature:
+		//  watm_keepalive_v1(interval_ms i32) -> (err i32)
+		if len(keepalive.Definition().ParamTypes()) != 1 {
+			return fmt.Errorf("water: watm_keepalive_v1 function expects 1 argument, got %d", len(keepalive.Definition().ParamTypes()))
+		} else if keepalive.Definition().ParamTypes()[0] != api.ValueTypeI32 {
+			return fmt.Errorf("water: watm_keepalive_v1 function expects argument type i32, got %s", api.ValueTypeName(keepalive.Definition().ParamTypes()[0]))
+		}
+
+		if len(keepalive.Definition().ResultTypes()) != 1 {
+			return fmt.Errorf("water: watm_keepalive_v1 function expects 1 result, got %d", len(keepalive.Definition().ResultTypes()))
+		} else if keepalive.Definition().ResultTypes()[0] != api.ValueTypeI32 {
+			return fmt.Errorf("water: watm_keepalive_v1 function expects result type i32, got %s", api.ValueTypeName(keepalive.Definition().ResultTypes()[0]))
+		}
+	}
+
 	// watm_start_v1: the mainloop entry point
 	start := tm.Core().ExportedFunction("watm_start_v1")
 	if start == nil {
@@ -595,13 +723,15 @@ func (tm *TransportModule) Initialize() error {
 	// set up the background worker
 	tm.backgroundWorker = &struct {
 		_ctrlpipe   func(int32) (int32, error)
+		_keepalive  func(int32) (int32, error)
 		_start      func() (int32, error)
 		exited      chan bool
 		exitedWith  atomic.Value
+		onExit      func()
 		controlPipe *CtrlPipe
 	}{
 		_ctrlpipe: func(fd int32) (int32, error) {
-			ret, err := ctrlPipe.Call(coreCtx, api.EncodeI32(fd))
+			ret, err := core.Call(pool, ctrlPipe, api.EncodeI32(fd))
 			if err != nil {
 				return 0, fmt.Errorf("water: calling watm_ctrlpipe_v1 function returned error: %w", err)
 			}
@@ -609,7 +739,7 @@ func (tm *TransportModule) Initialize() error {
 			return wasip1.DecodeWATERError(api.DecodeI32(ret[0]))
 		},
 		_start: func() (int32, error) {
-			ret, err := start.Call(coreCtx)
+			ret, err := core.Call(pool, start)
 			if err != nil {
 				return 0, fmt.Errorf("water: calling watm_start_v1 function returned error: %w", err)
 			}
@@ -621,6 +751,17 @@ func (tm *TransportModule) Initialize() error {
 		// controlPipe: nil,
 	}
 
+	if keepalive != nil {
+		tm.backgroundWorker._keepalive = func(intervalMs int32) (int32, error) {
+			ret, err := core.Call(pool, keepalive, api.EncodeI32(intervalMs))
+			if err != nil {
+				return 0, fmt.Errorf("water: calling watm_keepalive_v1 function returned error: %w", err)
+			}
+
+			return wasip1.DecodeWATERError(api.DecodeI32(ret[0]))
+		}
+	}
+
 	// call _init
 	if errno, err := tm._init(); err != nil {
 		return fmt.Errorf("water: calling watm_init_v1 function returned error: %w", err)
@@ -660,16 +801,9 @@ func (tm *TransportModule) LinkNetworkInterface(dialer *networkDialer, listener
 			}
 			address = string(addressStrBuf[:n])
 
-			conn, err := dialer.Dial(network, address)
-			if err != nil {
-				log.LErrorf(tm.Core().Logger(), "water: dialer.Dial: %v", err)
-				return wasip1.EncodeWATERError(syscall.ENOTCONN) // not connected
-			}
-			fd, err = tm.PushConn(conn)
-			if err != nil {
-				log.LErrorf(tm.Core().Logger(), "water: PushConn: %v", err)
-			}
-			return fd
+			return tm.dialOutbound("dialer.Dial", func() (net.Conn, error) {
+				return dialer.Dial(network, address)
+			})
 		}
 	} else {
 		waterDial = func(
@@ -692,16 +826,7 @@ func (tm *TransportModule) LinkNetworkInterface(dialer *networkDialer, listener
 	var waterDialFixed func() (fd int32)
 	if dialer != nil {
 		waterDialFixed = func() (fd int32) {
-			conn, err := dialer.DialFixed()
-			if err != nil {
-				log.LErrorf(tm.Core().Logger(), "water: dialer.DialFixed: %v", err)
-				return wasip1.EncodeWATERError(syscall.ENOTCONN) // not connected
-			}
-			fd, err = tm.PushConn(conn)
-			if err != nil {
-				log.LErrorf(tm.Core().Logger(), "water: PushConn: %v", err)
-			}
-			return fd
+			return tm.dialOutbound("dialer.DialFixed", dialer.DialFixed)
 		}
 	} else {
 		waterDialFixed = func() (fd int32) {
@@ -728,7 +853,9 @@ func (tm *TransportModule) LinkNetworkInterface(dialer *networkDialer, listener
 			fd, err = tm.PushConn(conn)
 			if err != nil {
 				log.LErrorf(tm.Core().Logger(), "water: PushConn: %v", err)
+				return fd
 			}
+			tm.recordNetworkConn(conn)
 			return fd
 		}
 	} else {
@@ -743,9 +870,752 @@ func (tm *TransportModule) LinkNetworkInterface(dialer *networkDialer, listener
 		}
 	}
 
+	if err := tm.linkDeadlineFunction(); err != nil {
+		return err
+	}
+
+	if err := tm.linkPassthroughFunction(); err != nil {
+		return err
+	}
+
+	if err := tm.linkSessionFunctions(); err != nil {
+		return err
+	}
+
+	if err := tm.linkShaperFunctions(); err != nil {
+		return err
+	}
+
+	if err := tm.linkRawFunction(); err != nil {
+		return err
+	}
+
+	if err := tm.linkTUNFunction(); err != nil {
+		return err
+	}
+
+	if err := tm.linkPathFunctions(); err != nil {
+		return err
+	}
+
+	if err := tm.linkRemoteAddressFunction(dialer); err != nil {
+		return err
+	}
+
+	if err := tm.linkCredentialFunction(); err != nil {
+		return err
+	}
+
+	if err := tm.linkCloseReasonFunction(); err != nil {
+		return err
+	}
+
+	return tm.linkMetadataFunction()
+}
+
+// linkRawFunction imports the optional
+// `env.water_dial_raw(networkIovs i32, networkIovsLen i32, addressIovs i32, addressIovsLen i32) -> (fd i32)`
+// function, which dials a raw IP socket, e.g., "ip4:icmp" or "ip6:ipv6-icmp",
+// for the WATM to read and write whole packets of the protocol with, like a
+// ping tunnel. It counts toward the MaxOutboundConns of the Config.
+//
+// It fails with EPERM unless AllowRaw is set in the Config, or if the host
+// lacks the privileges of the operating system to open raw sockets. The
+// host dialed is checked against the DialAllowlist of the Config, if set.
+func (tm *TransportModule) linkRawFunction() error {
+	config := tm.Core().Config()
+	dialer := &networkDialer{
+		dialerFunc:       config.DialAllowlist.DialFunc(net.Dial),
+		addressValidator: dialedAddressValidator(config),
+	}
+
+	waterDialRaw := func(
+		networkIovs, networkIovsLen int32,
+		addressIovs, addressIovsLen int32,
+	) (fd int32) {
+		if !config.AllowRaw {
+			log.LWarnf(tm.Core().Logger(), "water: WATM dialing raw socket without AllowRaw")
+			return wasip1.EncodeWATERError(syscall.EPERM) // operation not permitted
+		}
+
+		networkStrBuf := make([]byte, 256)
+		n, err := tm.Core().ReadIovs(networkIovs, networkIovsLen, networkStrBuf)
+		if err != nil {
+			log.LErrorf(tm.Core().Logger(), "water: ReadIovs: %v", err)
+			return wasip1.EncodeWATERError(syscall.EINVAL) // invalid argument
+		}
+		network := string(networkStrBuf[:n])
+
+		addressStrBuf := make([]byte, 256)
+		n, err = tm.Core().ReadIovs(addressIovs, addressIovsLen, addressStrBuf)
+		if err != nil {
+			log.LErrorf(tm.Core().Logger(), "water: ReadIovs: %v", err)
+			return wasip1.EncodeWATERError(syscall.EINVAL) // invalid argument
+		}
+		address := string(addressStrBuf[:n])
+
+		if !isRawNetwork(network) {
+			return wasip1.EncodeWATERError(syscall.EINVAL) // invalid argument
+		}
+
+		return tm.dialOutbound("water_dial_raw", func() (net.Conn, error) {
+			return dialer.Dial(network, address)
+		})
+	}
+
+	if err := tm.importOptionalFunction("water_dial_raw", waterDialRaw); err != nil {
+		return fmt.Errorf("water: linking raw function, (*water.Core).ImportFunction: %w", err)
+	}
+
+	return nil
+}
+
+// isRawNetwork reports whether network names a raw IP network with its
+// protocol, e.g., "ip4:icmp" or "ip6:58".
+func isRawNetwork(network string) bool {
+	ip, protocol, ok := strings.Cut(network, ":")
+	return ok && protocol != "" && (ip == "ip" || ip == "ip4" || ip == "ip6")
+}
+
+// linkTUNFunction imports the optional `env.water_get_tun() -> (fd i32)`
+// function, which opens the TUN device of the Config for the WATM, on the
+// first call, and returns its file descriptor, to read the outgoing IP
+// packets from and write the incoming ones into, one per call. It fails
+// with ENODEV if the Config has no TUN.
+func (tm *TransportModule) linkTUNFunction() error {
+	tun := tm.Core().Config().TUN
+
+	waterGetTUN := func() (fd int32) {
+		if tun == nil {
+			return wasip1.EncodeWATERError(syscall.ENODEV) // no such device
+		}
+
+		tm.tunMutex.Lock()
+		defer tm.tunMutex.Unlock()
+
+		if tm.tun != nil {
+			return tm.tunFd
+		}
+
+		f, err := driver.OpenTUN(tun)
+		if err != nil {
+			log.LErrorf(tm.Core().Logger(), "water: opening TUN device: %v", err)
+			if errors.Is(err, os.ErrPermission) {
+				return wasip1.EncodeWATERError(syscall.EPERM) // operation not permitted
+			}
+			return wasip1.EncodeWATERError(syscall.ENODEV) // no such device
+		}
+		fd, err = tm.Core().InsertFile(f)
+		if err != nil {
+			f.Close()
+			log.LErrorf(tm.Core().Logger(), "water: InsertFile: %v", err)
+			return wasip1.EncodeWATERError(syscall.EBADF) // bad file descriptor
+		}
+		tm.tun, tm.tunFd = f, fd
+		return fd
+	}
+
+	if err := tm.importOptionalFunction("water_get_tun", waterGetTUN); err != nil {
+		return fmt.Errorf("water: linking TUN function, (*water.Core).ImportFunction: %w", err)
+	}
+
+	return nil
+}
+
+// dialOutbound dials an outbound network connection for the WATM with
+// dial, up to the MaxOutboundConns of the Config, and pushes it into the
+// WATM. The connection is closed with the TransportModule.
+func (tm *TransportModule) dialOutbound(name string, dial func() (net.Conn, error)) (fd int32) {
+	maxConns := tm.Core().Config().MaxOutboundConnsOrDefault()
+	if tm.outboundConns.Add(1) > int32(maxConns) {
+		tm.outboundConns.Add(-1)
+		log.LErrorf(tm.Core().Logger(), "water: %s: WATM dialed more than MaxOutboundConns of %d", name, maxConns)
+		return wasip1.EncodeWATERError(syscall.EMFILE) // too many open files
+	}
+
+	conn, err := dial()
+	if err != nil {
+		tm.outboundConns.Add(-1)
+		log.LErrorf(tm.Core().Logger(), "water: %s: %v", name, err)
+		if errors.Is(err, os.ErrPermission) {
+			return wasip1.EncodeWATERError(syscall.EPERM) // operation not permitted
+		}
+		return wasip1.EncodeWATERError(syscall.ENOTCONN) // not connected
+	}
+	fd, err = tm.PushConn(conn)
+	if err != nil {
+		tm.outboundConns.Add(-1)
+		conn.Close()
+		log.LErrorf(tm.Core().Logger(), "water: PushConn: %v", err)
+		return fd
+	}
+	tm.recordNetworkConn(conn)
+	return fd
+}
+
+// NetworkConns returns the network connections dialed or accepted for the
+// WATM, in order.
+func (tm *TransportModule) NetworkConns() []net.Conn {
+	tm.networkConnsMutex.Lock()
+	defer tm.networkConnsMutex.Unlock()
+	return append([]net.Conn(nil), tm.networkConns...)
+}
+
+func (tm *TransportModule) recordNetworkConn(conn net.Conn) {
+	tm.networkConnsMutex.Lock()
+	tm.networkConns = append(tm.networkConns, conn)
+	tm.networkConnsMutex.Unlock()
+}
+
+// importOptionalFunction imports f as `env.<name>` only if the WATM imports it.
+// Unlike the network functions, optional functions are not expected to be
+// imported by every WATM, so no warning is logged if they are not.
+func (tm *TransportModule) importOptionalFunction(name string, f any) error {
+	if _, ok := tm.Core().ImportedFunctions()["env"][name]; !ok {
+		return nil
+	}
+
+	return tm.Core().ImportFunction("env", name, f)
+}
+
+const (
+	deadlineKindRead  int32 = 0
+	deadlineKindWrite int32 = 1
+)
+
+// linkDeadlineFunction imports the optional `env.water_get_deadline(kind i32) -> (deadline i64)`
+// function, which allows the WATM to query the read (kind = 0) or write (kind = 1)
+// deadline set on the Conn by the caller, in Unix nanoseconds, or 0 if no deadline
+// is set. A WATM may use it to abort its buffering or retry loops once the host
+// deadline expires, instead of relying only on the host cutting the socket.
+func (tm *TransportModule) linkDeadlineFunction() error {
+	waterGetDeadline := func(kind int32) int64 {
+		switch kind {
+		case deadlineKindRead:
+			return tm.readDeadline.Load()
+		case deadlineKindWrite:
+			return tm.writeDeadline.Load()
+		default:
+			return int64(wasip1.EncodeWATERError(syscall.EINVAL)) // invalid argument
+		}
+	}
+
+	if err := tm.importOptionalFunction("water_get_deadline", waterGetDeadline); err != nil {
+		return fmt.Errorf("water: linking deadline function, (*water.Core).ImportFunction: %w", err)
+	}
+
+	return nil
+}
+
+// linkPassthroughFunction imports the optional `env.water_passthrough() -> (err i32)`
+// function, which allows a WATM whose job is done, e.g., one transforming only the
+// handshake, to detach itself from the data path. Before calling it, the WATM MUST
+// have flushed all data it buffered, and once it succeeds, the WATM MUST return
+// from watm_start_v1 without touching the connections again. The host then copies
+// the data directly, with splice(2) on Linux, bypassing the WATM entirely:
+//   - Dialer: between the caller and the remote destination
+//   - Listener: between the caller and the remote source
+//   - Relay: between the remote source and the remote destination
+//
+// The instance is kept, idle, until the Conn is closed, since the connections are
+// owned by its WASI file table.
+//
+// It fails with ENOTSUP if the WATM has dialed or accepted more connections than
+// the above, or if any of them is not a *net.TCPConn, in which case the WATM is
+// expected to keep copying the data by itself.
+func (tm *TransportModule) linkPassthroughFunction() error {
+	waterPassthrough := func() int32 {
+		if _, _, ok := tm.passthroughConns(); !ok {
+			return wasip1.EncodeWATERError(syscall.ENOTSUP) // not supported
+		}
+		tm.passthrough.Store(true)
+		return 0
+	}
+
+	if err := tm.importOptionalFunction("water_passthrough", waterPassthrough); err != nil {
+		return fmt.Errorf("water: linking passthrough function, (*water.Core).ImportFunction: %w", err)
+	}
+
+	return nil
+}
+
+// PassthroughConns returns the connections to copy the data between once the
+// worker thread returns, if the WATM has requested passthrough.
+func (tm *TransportModule) PassthroughConns() (a, b *net.TCPConn, ok bool) {
+	if !tm.passthrough.Load() {
+		return nil, nil, false
+	}
+	return tm.passthroughConns()
+}
+
+func (tm *TransportModule) passthroughConns() (a, b *net.TCPConn, ok bool) {
+	tm.networkConnsMutex.Lock()
+	defer tm.networkConnsMutex.Unlock()
+
+	var conns []net.Conn
+	switch {
+	case tm.callerConn == nil && len(tm.networkConns) == 2: // Relay
+		conns = tm.networkConns
+	case tm.callerConn != nil && len(tm.networkConns) == 1: // Dialer or Listener
+		conns = []net.Conn{tm.callerConn, tm.networkConns[0]}
+	default:
+		return nil, nil, false
+	}
+
+	if a, ok = conns[0].(*net.TCPConn); !ok {
+		return nil, nil, false
+	}
+	if b, ok = conns[1].(*net.TCPConn); !ok {
+		return nil, nil, false
+	}
+	return a, b, true
+}
+
+// maxSessionSize caps the size of the session state exported by a WATM.
+const maxSessionSize = 64 << 10 // 64 KiB
+
+// linkSessionFunctions imports the optional functions which allow the WATM to
+// resume a previous session, e.g., for 0-RTT reconnects:
+//   - `env.water_import_session(bufPtr i32, bufLen i32) -> (n i32)` writes the
+//     session state in the Config into the buffer and returns its length, or
+//     fails with ENOENT if there is none.
+//   - `env.water_export_session(bufPtr i32, bufLen i32) -> (err i32)` records
+//     the buffer as the session state to be returned by [Conn.ExportSession],
+//     replacing any exported before. It must not exceed 64 KiB.
+func (tm *TransportModule) linkSessionFunctions() error {
+	state := tm.Core().Config().SessionState
+
+	waterImportSession := func(ctx context.Context, m api.Module, bufPtr, bufLen int32) (n int32) {
+		if len(state) == 0 {
+			return wasip1.EncodeWATERError(syscall.ENOENT) // no such file or directory
+		}
+
+		if int(bufLen) < len(state) {
+			return wasip1.EncodeWATERError(syscall.ENOBUFS) // no buffer space available
+		}
+
+		if !m.Memory().Write(uint32(bufPtr), state) {
+			return wasip1.EncodeWATERError(syscall.EFAULT) // bad address
+		}
+
+		return int32(len(state))
+	}
+
+	if err := tm.importOptionalFunction("water_import_session", waterImportSession); err != nil {
+		return fmt.Errorf("water: linking session function, (*water.Core).ImportFunction: %w", err)
+	}
+
+	waterExportSession := func(ctx context.Context, m api.Module, bufPtr, bufLen int32) (err int32) {
+		if bufLen < 0 || bufLen > maxSessionSize {
+			return wasip1.EncodeWATERError(syscall.EINVAL) // invalid argument
+		}
+
+		buf, ok := m.Memory().Read(uint32(bufPtr), uint32(bufLen))
+		if !ok {
+			return wasip1.EncodeWATERError(syscall.EFAULT) // bad address
+		}
+
+		// buf is a view of the linear memory, which the WATM may overwrite
+		session := append([]byte(nil), buf...)
+		tm.session.Store(&session)
+		return 0
+	}
+
+	if err := tm.importOptionalFunction("water_export_session", waterExportSession); err != nil {
+		return fmt.Errorf("water: linking session function, (*water.Core).ImportFunction: %w", err)
+	}
+
+	return nil
+}
+
+// Session returns the latest session state exported by the WATM, or nil if
+// none.
+func (tm *TransportModule) Session() []byte {
+	if session := tm.session.Load(); session != nil {
+		return *session
+	}
+	return nil
+}
+
+// linkCredentialFunction imports the optional
+// `env.water_get_credential(offset i32, bufPtr i32, bufLen i32) -> (n i32)` function,
+// which writes the credential of the current epoch plus offset, derived from the
+// [water.TimeBasedCredential] in the Config, into the buffer and returns its length.
+// The offset must be within the skew window of the credential.
+func (tm *TransportModule) linkCredentialFunction() error {
+	tbc := tm.Core().Config().TimeBasedCredential
+
+	waterGetCredential := func(ctx context.Context, m api.Module, offset, bufPtr, bufLen int32) (n int32) {
+		if tbc == nil {
+			return wasip1.EncodeWATERError(syscall.ENODEV) // no such device
+		}
+
+		// Skew is clamped to the range of offset, instead of overflowing it
+		skew := int32(math.MaxInt32)
+		if tbc.Skew < math.MaxInt32 {
+			skew = int32(tbc.Skew)
+		}
+		if offset < -skew || offset > skew {
+			return wasip1.EncodeWATERError(syscall.EINVAL) // invalid argument
+		}
+
+		cred := tbc.CredentialAt(tbc.CurrentEpoch() + int64(offset))
+		if int(bufLen) < len(cred) {
+			return wasip1.EncodeWATERError(syscall.ENOBUFS) // no buffer space available
+		}
+
+		if !m.Memory().Write(uint32(bufPtr), cred) {
+			return wasip1.EncodeWATERError(syscall.EFAULT) // bad address
+		}
+
+		return int32(len(cred))
+	}
+
+	if err := tm.importOptionalFunction("water_get_credential", waterGetCredential); err != nil {
+		return fmt.Errorf("water: linking credential function, (*water.Core).ImportFunction: %w", err)
+	}
+
+	return nil
+}
+
+// maxCloseReasonMessageSize caps the size of the message of a close reason
+// reported by a WATM.
+const maxCloseReasonMessageSize = 1 << 10 // 1 KiB
+
+// linkCloseReasonFunction imports the optional
+// `env.water_set_close_reason(code i32, msgPtr i32, msgLen i32) -> (err i32)`
+// function, which records the code and the message in the buffer as the reason
+// why the connection ended, to be returned by [Conn.CloseReason], replacing any
+// reported before. The message must not exceed 1 KiB.
+func (tm *TransportModule) linkCloseReasonFunction() error {
+	waterSetCloseReason := func(ctx context.Context, m api.Module, code, msgPtr, msgLen int32) (err int32) {
+		if msgLen < 0 || msgLen > maxCloseReasonMessageSize {
+			return wasip1.EncodeWATERError(syscall.EINVAL) // invalid argument
+		}
+
+		msg, ok := m.Memory().Read(uint32(msgPtr), uint32(msgLen))
+		if !ok {
+			return wasip1.EncodeWATERError(syscall.EFAULT) // bad address
+		}
+
+		tm.closeReason.Store(&water.CloseReason{
+			Code:    water.CloseCode(uint32(code)),
+			Message: string(msg), // copied, as the WATM may overwrite its memory
+		})
+		return 0
+	}
+
+	if err := tm.importOptionalFunction("water_set_close_reason", waterSetCloseReason); err != nil {
+		return fmt.Errorf("water: linking close reason function, (*water.Core).ImportFunction: %w", err)
+	}
+
+	return nil
+}
+
+// CloseReason returns the latest close reason reported by the WATM, or a zero
+// CloseReason if none.
+func (tm *TransportModule) CloseReason() water.CloseReason {
+	if reason := tm.closeReason.Load(); reason != nil {
+		return *reason
+	}
+	return water.CloseReason{}
+}
+
+const (
+	maxMetadataKeySize   = 256     // caps the size of a metadata key set by a WATM
+	maxMetadataValueSize = 4 << 10 // caps the size of a metadata value set by a WATM, 4 KiB
+	maxMetadataEntries   = 64      // caps the number of metadata entries set by a WATM
+)
+
+// linkMetadataFunction imports the optional
+// `env.water_set_metadata(keyPtr i32, keyLen i32, valuePtr i32, valueLen i32) -> (err i32)`
+// function, which attaches the key/value pair in the buffers to the connection,
+// e.g., negotiated parameters or the identity of the peer, to be returned by
+// [Conn.Metadata], replacing any value set before for the key. An empty value
+// removes the key. Keys must not exceed 256 bytes, values 4 KiB, and at most 64
+// keys may be set.
+func (tm *TransportModule) linkMetadataFunction() error {
+	waterSetMetadata := func(ctx context.Context, m api.Module, keyPtr, keyLen, valuePtr, valueLen int32) (err int32) {
+		if keyLen <= 0 || keyLen > maxMetadataKeySize || valueLen < 0 || valueLen > maxMetadataValueSize {
+			return wasip1.EncodeWATERError(syscall.EINVAL) // invalid argument
+		}
+
+		key, ok := m.Memory().Read(uint32(keyPtr), uint32(keyLen))
+		if !ok {
+			return wasip1.EncodeWATERError(syscall.EFAULT) // bad address
+		}
+		value, ok := m.Memory().Read(uint32(valuePtr), uint32(valueLen))
+		if !ok {
+			return wasip1.EncodeWATERError(syscall.EFAULT) // bad address
+		}
+
+		tm.metadataMutex.Lock()
+		defer tm.metadataMutex.Unlock()
+
+		if valueLen == 0 {
+			delete(tm.metadata, string(key))
+			return 0
+		}
+
+		if _, ok := tm.metadata[string(key)]; !ok && len(tm.metadata) >= maxMetadataEntries {
+			return wasip1.EncodeWATERError(syscall.ENOSPC) // no space left
+		}
+		if tm.metadata == nil {
+			tm.metadata = make(map[string]string)
+		}
+		tm.metadata[string(key)] = string(value) // copied, as the WATM may overwrite its memory
+		return 0
+	}
+
+	if err := tm.importOptionalFunction("water_set_metadata", waterSetMetadata); err != nil {
+		return fmt.Errorf("water: linking metadata function, (*water.Core).ImportFunction: %w", err)
+	}
+
+	return nil
+}
+
+// Metadata returns a copy of the metadata attached to the connection by the
+// WATM, or nil if none.
+func (tm *TransportModule) Metadata() map[string]string {
+	tm.metadataMutex.Lock()
+	defer tm.metadataMutex.Unlock()
+
+	if len(tm.metadata) == 0 {
+		return nil
+	}
+	metadata := make(map[string]string, len(tm.metadata))
+	for k, v := range tm.metadata {
+		metadata[k] = v
+	}
+	return metadata
+}
+
+// linkRemoteAddressFunction imports the optional
+// `env.water_get_remote_address(bufPtr i32, bufLen i32) -> (n i32)` function,
+// which writes the logical destination the WATM is to target, e.g., as the SNI,
+// into the buffer and returns its length. It is the RemoteAddress in the Config
+// if set, otherwise the address requested to the Dialer, which the socket is
+// connected to. It fails with ENOENT if neither is known, e.g., for a
+// FixedDialer without RemoteAddress.
+func (tm *TransportModule) linkRemoteAddressFunction(dialer *networkDialer) error {
+	remoteAddress := tm.Core().Config().RemoteAddress
+
+	waterGetRemoteAddress := func(ctx context.Context, m api.Module, bufPtr, bufLen int32) (n int32) {
+		address := remoteAddress
+		if address == "" && dialer != nil {
+			address = dialer.overrideAddress.address
+		}
+		if address == "" {
+			return wasip1.EncodeWATERError(syscall.ENOENT) // no such file or directory
+		}
+
+		if int(bufLen) < len(address) {
+			return wasip1.EncodeWATERError(syscall.ENOBUFS) // no buffer space available
+		}
+
+		if !m.Memory().Write(uint32(bufPtr), []byte(address)) {
+			return wasip1.EncodeWATERError(syscall.EFAULT) // bad address
+		}
+
+		return int32(len(address))
+	}
+
+	if err := tm.importOptionalFunction("water_get_remote_address", waterGetRemoteAddress); err != nil {
+		return fmt.Errorf("water: linking remote address function, (*water.Core).ImportFunction: %w", err)
+	}
+
+	return nil
+}
+
+// linkShaperFunctions imports the optional functions which allow the WATM to
+// shape its writes as decided by the [water.Shaper] in the Config:
+//   - `env.water_shape_delay(n i32) -> (err i32)` blocks for as long as the
+//     WATM is to wait before writing n bytes, or fails with ECANCELED if the
+//     Conn is closed meanwhile.
+//   - `env.water_shape_padding(n i32) -> (padding i32)` returns how many bytes
+//     of dummy padding the WATM is to write along with n bytes of data, to be
+//     framed by the WATM in its own protocol.
+//
+// If no Shaper is set, writes are not delayed and no padding is requested.
+func (tm *TransportModule) linkShaperFunctions() error {
+	shaper := tm.Core().Config().Shaper
+
+	waterShapeDelay := func(ctx context.Context, n int32) (err int32) {
+		if n < 0 {
+			return wasip1.EncodeWATERError(syscall.EINVAL) // invalid argument
+		}
+		if shaper == nil {
+			return 0
+		}
+
+		delay := shaper.Delay(int(n))
+		if delay <= 0 {
+			return 0
+		}
+
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			return 0
+		case <-ctx.Done():
+			return wasip1.EncodeWATERError(syscall.ECANCELED) // operation canceled
+		}
+	}
+
+	if err := tm.importOptionalFunction("water_shape_delay", waterShapeDelay); err != nil {
+		return fmt.Errorf("water: linking shaper function, (*water.Core).ImportFunction: %w", err)
+	}
+
+	waterShapePadding := func(n int32) (padding int32) {
+		if n < 0 {
+			return wasip1.EncodeWATERError(syscall.EINVAL) // invalid argument
+		}
+		if shaper == nil {
+			return 0
+		}
+
+		return int32(min(max(shaper.Padding(int(n)), 0), math.MaxInt32))
+	}
+
+	if err := tm.importOptionalFunction("water_shape_padding", waterShapePadding); err != nil {
+		return fmt.Errorf("water: linking shaper function, (*water.Core).ImportFunction: %w", err)
+	}
+
+	return nil
+}
+
+// pathInfoSize is the size of the PathInfo written by water_path_info.
+const pathInfoSize = 40
+
+// linkPathFunctions imports the optional functions which allow a multipath
+// WATM, e.g., a bonding or redundancy transport, to schedule its data over
+// the network connections it dialed or accepted:
+//   - `env.water_paths(bufPtr i32, bufLen i32) -> (n i32)` writes the file
+//     descriptors of the network connections, as i32 in the order dialed or
+//     accepted, into the buffer and returns how many there are. It fails
+//     with ENOBUFS if the buffer cannot hold all of them.
+//   - `env.water_path_info(fd i32, bufPtr i32, bufLen i32) -> (err i32)`
+//     writes the [water.PathInfo] of the network connection of fd into the
+//     buffer of 40 bytes, as the little-endian u64 RTT and u64 RTT variation
+//     in microseconds, u32 retransmits, u32 lost segments, u32 congestion
+//     window in bytes, 4 reserved bytes, and u64 delivery rate in bytes per
+//     second. It fails with EBADF if fd is not a network connection, or
+//     ENOTSUP if the path cannot be inspected.
+func (tm *TransportModule) linkPathFunctions() error {
+	waterPaths := func(ctx context.Context, m api.Module, bufPtr, bufLen int32) (n int32) {
+		fds := tm.networkConnFds()
+		if bufLen < 0 || int(bufLen) < 4*len(fds) {
+			return wasip1.EncodeWATERError(syscall.ENOBUFS) // no buffer space available
+		}
+
+		buf := make([]byte, 4*len(fds))
+		for i, fd := range fds {
+			binary.LittleEndian.PutUint32(buf[4*i:], uint32(fd))
+		}
+		if !m.Memory().Write(uint32(bufPtr), buf) {
+			return wasip1.EncodeWATERError(syscall.EFAULT) // bad address
+		}
+
+		return int32(len(fds))
+	}
+
+	if err := tm.importOptionalFunction("water_paths", waterPaths); err != nil {
+		return fmt.Errorf("water: linking path function, (*water.Core).ImportFunction: %w", err)
+	}
+
+	waterPathInfo := func(ctx context.Context, m api.Module, fd, bufPtr, bufLen int32) (err int32) {
+		conn := tm.networkConnOf(fd)
+		if conn == nil {
+			return wasip1.EncodeWATERError(syscall.EBADF) // bad file descriptor
+		}
+		if bufLen < pathInfoSize {
+			return wasip1.EncodeWATERError(syscall.ENOBUFS) // no buffer space available
+		}
+
+		info, infoErr := driver.PathInfoOf(tm.Core().Config(), conn)
+		if infoErr != nil {
+			if !errors.Is(infoErr, water.ErrPathInfoUnsupported) {
+				log.LErrorf(tm.Core().Logger(), "water: PathInfoOf: %v", infoErr)
+			}
+			return wasip1.EncodeWATERError(syscall.ENOTSUP) // not supported
+		}
+
+		buf := make([]byte, pathInfoSize)
+		binary.LittleEndian.PutUint64(buf[0:], uint64(info.RTT.Microseconds()))
+		binary.LittleEndian.PutUint64(buf[8:], uint64(info.RTTVar.Microseconds()))
+		binary.LittleEndian.PutUint32(buf[16:], info.Retransmits)
+		binary.LittleEndian.PutUint32(buf[20:], info.Lost)
+		binary.LittleEndian.PutUint32(buf[24:], info.CongestionWindow)
+		binary.LittleEndian.PutUint64(buf[32:], info.DeliveryRate)
+		if !m.Memory().Write(uint32(bufPtr), buf) {
+			return wasip1.EncodeWATERError(syscall.EFAULT) // bad address
+		}
+
+		return 0
+	}
+
+	if err := tm.importOptionalFunction("water_path_info", waterPathInfo); err != nil {
+		return fmt.Errorf("water: linking path function, (*water.Core).ImportFunction: %w", err)
+	}
+
 	return nil
 }
 
+// networkConnFds returns the file descriptors of the network connections
+// pushed into the WATM, in the order dialed or accepted.
+func (tm *TransportModule) networkConnFds() []int32 {
+	conns := tm.NetworkConns()
+
+	tm.managedConnsMutex.RLock()
+	defer tm.managedConnsMutex.RUnlock()
+
+	fds := make([]int32, 0, len(conns))
+	for _, conn := range conns {
+		for fd, managed := range tm.managedConns {
+			if managed == conn {
+				fds = append(fds, fd)
+				break
+			}
+		}
+	}
+	return fds
+}
+
+// networkConnOf returns the network connection of the file descriptor fd,
+// or nil if fd is not one, e.g., the caller connection.
+func (tm *TransportModule) networkConnOf(fd int32) net.Conn {
+	conn := tm.GetManagedConns(fd)
+	if conn == nil {
+		return nil
+	}
+	for _, networkConn := range tm.NetworkConns() {
+		if networkConn == conn {
+			return conn
+		}
+	}
+	return nil
+}
+
+// SetReadDeadline records the read deadline to be queried by the WATM.
+// A zero value of t means no deadline.
+func (tm *TransportModule) SetReadDeadline(t time.Time) {
+	tm.readDeadline.Store(unixNanoOrZero(t))
+}
+
+// SetWriteDeadline records the write deadline to be queried by the WATM.
+// A zero value of t means no deadline.
+func (tm *TransportModule) SetWriteDeadline(t time.Time) {
+	tm.writeDeadline.Store(unixNanoOrZero(t))
+}
+
+func unixNanoOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
 // PushConn pushes a net.Conn into the Transport Module.
 func (tm *TransportModule) PushConn(conn net.Conn) (fd int32, err error) {
 	fd, err = tm.Core().InsertConn(conn)
@@ -793,20 +1663,45 @@ func (tm *TransportModule) StartWorker() error {
 		return fmt.Errorf("water: calling watm_ctrlpipe_v1: %w", err)
 	}
 
+	if err := tm.setupKeepalive(); err != nil {
+		return err
+	}
+
 	log.LDebugf(tm.Core().Logger(), "water: starting worker thread")
 
-	// in a goroutine, call _worker
-	go func() {
-		defer close(tm.backgroundWorker.exited)
-		_, err := tm.backgroundWorker._start()
-		if err != nil && !errors.Is(err, syscall.ECANCELED) {
-			log.LErrorf(tm.Core().Logger(), "water: WATM worker thread exited with error: %v", err)
-			tm.backgroundWorker.exitedWith.Store(err)
-		} else {
-			// tm.backgroundWorker.exitedWith.Store(nil) // can't store nil value
-			log.LDebugf(tm.Core().Logger(), "water: WATM worker thread exited without error")
+	// the TransportModule does not keep what onExit notifies, e.g., its
+	// Conn, reachable once the worker thread exits
+	onExit := tm.backgroundWorker.onExit
+	tm.backgroundWorker.onExit = nil
+
+	// in a goroutine of the WorkerPool, if any, call _worker
+	labels := pprof.WithLabels(tm.Core().Context(), pprof.Labels(water.ProfilerLabelRole, tm.role))
+	err = driver.GoWorker(tm.Core().Context(), tm.Core().Config().WorkerPool, func() {
+		pprof.SetGoroutineLabels(labels)
+
+		func() {
+			defer close(tm.backgroundWorker.exited)
+			_, err := tm.backgroundWorker._start()
+			if err != nil && !errors.Is(err, syscall.ECANCELED) {
+				log.LErrorf(tm.Core().Logger(), "water: WATM worker thread exited with error: %v", err)
+				if errors.Is(err, water.ErrModuleCrashed) {
+					// a crashed WATM reports no close reason of its own
+					tm.closeReason.CompareAndSwap(nil, &water.CloseReason{Code: water.CloseCodeInternalError, Message: "WATM crashed"})
+				}
+				tm.backgroundWorker.exitedWith.Store(err)
+			} else {
+				// tm.backgroundWorker.exitedWith.Store(nil) // can't store nil value
+				log.LDebugf(tm.Core().Logger(), "water: WATM worker thread exited without error")
+			}
+		}()
+
+		if onExit != nil {
+			onExit()
 		}
-	}()
+	})
+	if err != nil {
+		return fmt.Errorf("water: waiting for the WorkerPool: %w", err)
+	}
 
 	log.LDebugf(tm.Core().Logger(), "water: worker thread started")
 
@@ -818,6 +1713,74 @@ func (tm *TransportModule) StartWorker() error {
 	return nil
 }
 
+// setupKeepalive lets the WASM module opt in to the keepalive control
+// messages if the KeepaliveInterval is set, and starts sending them once
+// the worker thread is started until it exits.
+func (tm *TransportModule) setupKeepalive() error {
+	interval := tm.Core().Config().KeepaliveInterval
+	if interval <= 0 {
+		return nil
+	}
+
+	if tm.backgroundWorker._keepalive == nil {
+		log.LWarnf(tm.Core().Logger(), "water: WASM module does not export watm_keepalive_v1, KeepaliveInterval is ignored")
+		return nil
+	}
+
+	intervalMs := interval.Milliseconds()
+	if intervalMs < 1 {
+		intervalMs = 1
+	} else if intervalMs > math.MaxInt32 {
+		intervalMs = math.MaxInt32
+	}
+
+	if _, err := tm.backgroundWorker._keepalive(int32(intervalMs)); err != nil {
+		if errors.Is(err, syscall.ENOTSUP) {
+			log.LDebugf(tm.Core().Logger(), "water: WASM module declined keepalive")
+			return nil
+		}
+		return fmt.Errorf("water: calling watm_keepalive_v1: %w", err)
+	}
+
+	// the ticker is stopped once the worker thread exits, along with
+	// whatever else is notified of it
+	exited, controlPipe := tm.backgroundWorker.exited, tm.backgroundWorker.controlPipe
+	ticker := time.NewTicker(time.Duration(intervalMs) * time.Millisecond)
+	onExit := tm.backgroundWorker.onExit
+	tm.backgroundWorker.onExit = func() {
+		ticker.Stop()
+		if onExit != nil {
+			onExit()
+		}
+	}
+
+	go func() {
+		for {
+			select {
+			case <-exited:
+				return
+			case <-ticker.C:
+			}
+
+			if err := controlPipe.WriteKeepalive(); err != nil {
+				log.LDebugf(tm.Core().Logger(), "water: writing keepalive to control pipe: %v", err)
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// OnWorkerExit sets f to be called once the worker thread exits, on the
+// goroutine which ran it, so that watching for it does not take a
+// goroutine of its own. It must be called before StartWorker.
+func (tm *TransportModule) OnWorkerExit(f func()) {
+	if tm.backgroundWorker != nil {
+		tm.backgroundWorker.onExit = f
+	}
+}
+
 // WaitWorker waits for the worker thread to exit and returns the error
 // if any.
 func (tm *TransportModule) WaitWorker() error {
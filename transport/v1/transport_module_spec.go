@@ -0,0 +1,54 @@
+package v1
+
+import (
+	"github.com/refraction-networking/water"
+	"github.com/refraction-networking/water/internal/driver"
+	"github.com/tetratelabs/wazero/api"
+)
+
+func init() {
+	err := driver.RegisterWATMSpec(Spec)
+	if err != nil {
+		panic(err)
+	}
+}
+
+var (
+	i32 = api.ValueTypeI32
+
+	sigVoidToI32 = water.FunctionSignature{Results: []api.ValueType{i32}}
+	sigI32ToI32  = water.FunctionSignature{Params: []api.ValueType{i32}, Results: []api.ValueType{i32}}
+)
+
+// Spec is the [water.TransportModuleSpec] of Water WATM API v1.
+var Spec = water.TransportModuleSpec{
+	Version: "v1",
+	Exports: map[string]water.FunctionSignature{
+		"watm_init_v1":     sigVoidToI32,
+		"watm_ctrlpipe_v1": sigI32ToI32,
+		"watm_start_v1":    sigVoidToI32,
+	},
+	RoleExports: map[water.Role]map[string]water.FunctionSignature{
+		water.RoleDialer:      {"watm_dial_v1": sigI32ToI32},
+		water.RoleFixedDialer: {"watm_dial_fixed_v1": sigI32ToI32},
+		water.RoleListener:    {"watm_accept_v1": sigI32ToI32},
+		water.RoleRelay:       {"watm_associate_v1": sigVoidToI32},
+	},
+	HostImports: map[string]map[string]water.FunctionSignature{
+		"env": {
+			"water_dial":               {Params: []api.ValueType{i32, i32, i32, i32}, Results: []api.ValueType{i32}},
+			"water_dial_fixed":         sigVoidToI32,
+			"water_accept":             sigVoidToI32,
+			"water_get_deadline":       {Params: []api.ValueType{i32}, Results: []api.ValueType{api.ValueTypeI64}},
+			"water_get_credential":     {Params: []api.ValueType{i32, i32, i32}, Results: []api.ValueType{i32}},
+			"water_passthrough":        sigVoidToI32,
+			"water_import_session":     {Params: []api.ValueType{i32, i32}, Results: []api.ValueType{i32}},
+			"water_export_session":     {Params: []api.ValueType{i32, i32}, Results: []api.ValueType{i32}},
+			"water_shape_delay":        sigI32ToI32,
+			"water_get_remote_address": {Params: []api.ValueType{i32, i32}, Results: []api.ValueType{i32}},
+			"water_shape_padding":      sigI32ToI32,
+			"water_set_close_reason":   {Params: []api.ValueType{i32, i32, i32}, Results: []api.ValueType{i32}},
+			"water_set_metadata":       {Params: []api.ValueType{i32, i32, i32, i32}, Results: []api.ValueType{i32}},
+		},
+	},
+}
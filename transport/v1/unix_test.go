@@ -0,0 +1,147 @@
+package v1_test
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/refraction-networking/water"
+	v1 "github.com/refraction-networking/water/transport/v1"
+)
+
+// TestUnix covers the following cases:
+//  1. Dialer must work when dialing a unix socket.
+//  2. Listener must work when listening on a unix socket.
+//  3. Relay must work when relaying from a unix socket to another.
+func TestUnix(t *testing.T) {
+	t.Run("dialer must work", testUnixDialer)
+	t.Run("listener must work", testUnixListener)
+	t.Run("relay must work", testUnixRelay)
+}
+
+func testUnixDialer(t *testing.T) {
+	unixLis, err := net.Listen("unix", filepath.Join(t.TempDir(), "server.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unixLis.Close() // skipcq: GO-S2307
+
+	config := &water.Config{
+		TransportModuleBin:  wasmPlain,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+	}
+	dialer, err := v1.NewDialerWithContext(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := dialer.DialContext(context.Background(), "unix", unixLis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close() // skipcq: GO-S2307
+
+	peerConn, err := unixLis.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peerConn.Close() // skipcq: GO-S2307
+
+	testUnixConnPair(t, conn, peerConn)
+}
+
+func testUnixListener(t *testing.T) {
+	config := &water.Config{
+		TransportModuleBin:  wasmPlain,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+	}
+	lis, err := config.ListenContext(context.Background(), "unix", filepath.Join(t.TempDir(), "water.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close() // skipcq: GO-S2307
+
+	peerConn, err := net.Dial("unix", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peerConn.Close() // skipcq: GO-S2307
+
+	conn, err := lis.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close() // skipcq: GO-S2307
+
+	testUnixConnPair(t, conn, peerConn)
+}
+
+func testUnixRelay(t *testing.T) {
+	dir := t.TempDir()
+	unixLis, err := net.Listen("unix", filepath.Join(dir, "server.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unixLis.Close() // skipcq: GO-S2307
+
+	config := &water.Config{
+		TransportModuleBin:  wasmPlain,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+	}
+	relay, err := v1.NewRelayWithContext(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	relayPath := filepath.Join(dir, "relay.sock")
+	relayErr := make(chan error, 1)
+	go func() {
+		relayErr <- relay.ListenAndRelayTo("unix", relayPath, "unix", unixLis.Addr().String())
+	}()
+	time.Sleep(100 * time.Millisecond) // 100ms to spin up relay
+
+	clientConn, err := net.Dial("unix", relayPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clientConn.Close() // skipcq: GO-S2307
+
+	serverConn, err := unixLis.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer serverConn.Close() // skipcq: GO-S2307
+
+	testUnixConnPair(t, clientConn, serverConn)
+
+	if err := relay.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-relayErr; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testUnixConnPair checks that messages are relayed in both directions
+// between two ends of a plain WATM.
+func testUnixConnPair(t *testing.T, conn, peerConn net.Conn) {
+	t.Helper()
+
+	tripleGC(100 * time.Microsecond)
+
+	for i := 0; i < 10; i++ {
+		msg := []byte("hello from the caller")
+		if err := sanityCheckConn(conn, peerConn, msg, msg); err != nil {
+			t.Fatal(err)
+		}
+
+		msg = []byte("hello from the peer")
+		if err := sanityCheckConn(peerConn, conn, msg, msg); err != nil {
+			t.Fatal(err)
+		}
+
+		tripleGC(100 * time.Microsecond)
+	}
+}
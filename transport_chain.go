@@ -0,0 +1,77 @@
+package water
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/refraction-networking/water/internal/socket"
+)
+
+// ModuleConfig specifies a WebAssembly Transport Module and its
+// configuration, to be composed with the one of a Config in its
+// TransportChain.
+type ModuleConfig struct {
+	// TransportModuleBin contains the binary format of the WebAssembly
+	// Transport Module. It is mandatory.
+	TransportModuleBin []byte
+
+	// TransportModuleConfig optionally provides a configuration file to be
+	// pushed into the WebAssembly Transport Module.
+	TransportModuleConfig TransportModuleConfig
+}
+
+// chainStage returns the Config of the i-th WATM in the TransportChain,
+// which inherits everything else but the TransportChain itself.
+func (c *Config) chainStage(i int) *Config {
+	stage := c.Clone()
+	stage.TransportModuleBin = append([]byte(nil), c.TransportChain[i].TransportModuleBin...)
+	stage.TransportModuleCompiled = nil
+	stage.TransportModuleConfig = c.TransportChain[i].TransportModuleConfig
+	stage.TransportChain = nil
+	return stage
+}
+
+// chainDialerFunc returns a func dialing through the WATMs in the
+// TransportChain, in order, with the last one dialing the network with
+// dialerFunc. Each connection dialed lives until it is closed.
+func (c *Config) chainDialerFunc(dialerFunc func(network, address string) (net.Conn, error)) func(network, address string) (net.Conn, error) {
+	for i := len(c.TransportChain) - 1; i >= 0; i-- {
+		stage := c.chainStage(i)
+		stage.NetworkDialerFunc = dialerFunc
+		stage.Resolver, stage.Failover, stage.TCPOptions, stage.UnderlyingTLS = nil, nil, nil, nil // already applied by dialerFunc
+		stage.ReadLimiter, stage.WriteLimiter, stage.ConnReadLimit, stage.ConnWriteLimit = nil, nil, 0, 0
+
+		dialerFunc = func(network, address string) (net.Conn, error) {
+			dialer, err := NewDialerWithContext(context.Background(), stage)
+			if err != nil {
+				return nil, fmt.Errorf("water: creating dialer for transport chain: %w", err)
+			}
+			return dialer.DialContext(context.Background(), network, address)
+		}
+	}
+	return dialerFunc
+}
+
+// acceptThroughChain accepts conn, accepted from the network, through the
+// WATMs in the TransportChain in reverse order, so that the chain unwraps
+// what a Dialer with the same TransportChain wraps.
+func (c *Config) acceptThroughChain(conn net.Conn) (net.Conn, error) {
+	for i := len(c.TransportChain) - 1; i >= 0; i-- {
+		stage := c.chainStage(i)
+		stage.NetworkListener = socket.NewSingleConnListener(conn, c.NetworkListener.Addr())
+		stage.AcceptFilter, stage.AcceptRateLimit, stage.TCPOptions, stage.UnderlyingTLS = nil, nil, nil, nil // already applied to conn
+		stage.ReadLimiter, stage.WriteLimiter, stage.ConnReadLimit, stage.ConnWriteLimit = nil, nil, 0, 0
+
+		lis, err := NewListenerWithContext(context.Background(), stage)
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("water: creating listener for transport chain: %w", err)
+		}
+
+		if conn, err = lis.Accept(); err != nil {
+			return nil, fmt.Errorf("water: accepting through transport chain: %w", err)
+		}
+	}
+	return conn, nil
+}
@@ -0,0 +1,101 @@
+package water
+
+import (
+	"errors"
+
+	"github.com/tetratelabs/wazero/api"
+)
+
+// Role is the role a WebAssembly Transport Module plays when driven
+// by the host.
+type Role uint8
+
+const (
+	RoleUnknown Role = iota
+	RoleDialer
+	RoleFixedDialer
+	RoleListener
+	RoleRelay
+)
+
+// String implements fmt.Stringer.
+func (r Role) String() string {
+	switch r {
+	case RoleDialer:
+		return "dialer"
+	case RoleFixedDialer:
+		return "fixed_dialer"
+	case RoleListener:
+		return "listener"
+	case RoleRelay:
+		return "relay"
+	default:
+		return "unknown"
+	}
+}
+
+// FunctionSignature describes the parameter and result types of a
+// WebAssembly function.
+type FunctionSignature struct {
+	Params  []api.ValueType
+	Results []api.ValueType
+}
+
+// matches reports whether the given function definition has exactly
+// the same signature as fs.
+func (fs FunctionSignature) matches(def api.FunctionDefinition) bool {
+	return valueTypesEqual(fs.Params, def.ParamTypes()) && valueTypesEqual(fs.Results, def.ResultTypes())
+}
+
+func valueTypesEqual(a, b []api.ValueType) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// TransportModuleSpec describes the ABI of one version of the WebAssembly
+// Transport Module specification, which allows a WATM binary to be
+// inspected statically without being instantiated.
+type TransportModuleSpec struct {
+	// Version is a human-readable name of the ABI version, e.g., "v1".
+	Version string
+
+	// Exports lists the functions every WATM of this version MUST export
+	// regardless of the role it plays.
+	Exports map[string]FunctionSignature
+
+	// RoleExports lists, for each role, the functions a WATM MUST export
+	// in order to play that role.
+	RoleExports map[Role]map[string]FunctionSignature
+
+	// HostImports lists the functions the host provides to a WATM of this
+	// version, indexed by module name then function name. A WATM importing
+	// anything not listed here (or in WASI preview 1) cannot be instantiated.
+	HostImports map[string]map[string]FunctionSignature
+}
+
+var (
+	knownTransportModuleSpecs []TransportModuleSpec
+
+	ErrTransportModuleSpecAlreadyRegistered = errors.New("water: transport module spec already registered")
+)
+
+// registerWATMSpec is a function used by Transport Module drivers
+// (e.g., `transport/v1`) to register the specification of the ABI version
+// they implement, so that [ValidateTransportModule] is able to recognize
+// it.
+func registerWATMSpec(spec TransportModuleSpec) error {
+	for _, known := range knownTransportModuleSpecs {
+		if known.Version == spec.Version {
+			return ErrTransportModuleSpecAlreadyRegistered
+		}
+	}
+	knownTransportModuleSpecs = append(knownTransportModuleSpecs, spec)
+	return nil
+}
@@ -0,0 +1,195 @@
+package water
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+// TransportModuleReport is the result of statically inspecting a
+// WebAssembly Transport Module with [ValidateTransportModule].
+type TransportModuleReport struct {
+	// Version is the ABI version the WATM conforms to. It is empty if
+	// the WATM does not conform to any registered version.
+	Version string
+
+	// Roles lists all roles the WATM is able to play.
+	Roles []Role
+
+	// TransportType is the transport type declared in the metadata of
+	// the WATM, or TransportTypeUnspecified if none is declared.
+	TransportType TransportType
+
+	// Problems lists human-readable descriptions of everything preventing
+	// the WATM from fully conforming to the spec of Version, including
+	// missing or mistyped exports and imports the host cannot satisfy.
+	Problems []string
+}
+
+// Supports reports whether the WATM is able to play the given role.
+func (r *TransportModuleReport) Supports(role Role) bool {
+	for _, supported := range r.Roles {
+		if supported == role {
+			return true
+		}
+	}
+	return false
+}
+
+// OK reports whether the WATM conforms to a registered version and
+// no problem was found.
+func (r *TransportModuleReport) OK() bool {
+	return r.Version != "" && len(r.Problems) == 0
+}
+
+// ValidateTransportModule statically inspects the exports and imports of
+// a WebAssembly Transport Module against all registered ABI versions and
+// reports which version and roles it supports. The WATM is compiled but
+// never instantiated.
+//
+// Only versions of the drivers imported (e.g., `transport/v1`) are
+// recognized. A WATM declaring its versions in the VersionSectionName
+// custom section is only checked against the version negotiated, see
+// NegotiateVersion. An error is returned only if the binary could not be
+// compiled at all, e.g., [ErrComponentUnsupported] for a component.
+func ValidateTransportModule(bin []byte) (*TransportModuleReport, error) {
+	if isComponent(bin) {
+		return nil, ErrComponentUnsupported
+	}
+
+	ctx := context.Background()
+	r := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfigInterpreter().WithCustomSections(true))
+	defer r.Close(ctx)
+
+	module, err := r.CompileModule(ctx, bin)
+	if err != nil {
+		return nil, fmt.Errorf("water: (*Runtime).CompileModule returned error: %w", err)
+	}
+	defer module.Close(ctx)
+
+	exports := module.ExportedFunctions()
+
+	transportType, metadataProblems := checkMetadata(module.CustomSections())
+
+	// a WATM declaring its versions is only checked against the version
+	// negotiated
+	specs := knownTransportModuleSpecs
+	if negotiated, err := negotiateVersion(bin); err != nil {
+		return &TransportModuleReport{
+			TransportType: transportType,
+			Problems:      append([]string{err.Error()}, metadataProblems...),
+		}, nil
+	} else if negotiated != nil {
+		specs = []TransportModuleSpec{*negotiated}
+	}
+
+	var best *TransportModuleReport
+	for _, spec := range specs {
+		report := &TransportModuleReport{
+			Version:       spec.Version,
+			TransportType: transportType,
+		}
+		report.Problems = checkExports(spec.Exports, exports)
+
+		if len(report.Problems) == 0 {
+			// the WATM is of this version, evaluate roles and imports
+			for _, role := range sortedRoles(spec.RoleExports) {
+				if len(checkExports(spec.RoleExports[role], exports)) == 0 {
+					report.Roles = append(report.Roles, role)
+				}
+			}
+			report.Problems = checkImports(spec.HostImports, module.ImportedFunctions())
+			report.Problems = append(report.Problems, metadataProblems...)
+			return report, nil
+		}
+
+		if best == nil || len(report.Problems) < len(best.Problems) {
+			best = report
+		}
+	}
+
+	if best == nil {
+		return &TransportModuleReport{
+			Problems: []string{"no transport module spec is registered"},
+		}, nil
+	}
+
+	// The closest version is not a match, report its problems only.
+	best.Problems = append([]string{fmt.Sprintf("closest version is %s", best.Version)}, best.Problems...)
+	best.Version = ""
+	return best, nil
+}
+
+func checkMetadata(sections []api.CustomSection) (transportType TransportType, problems []string) {
+	for _, section := range sections {
+		if section.Name() != TransportTypeSectionName {
+			continue
+		}
+
+		var err error
+		if transportType, err = parseTransportType(string(section.Data())); err != nil {
+			problems = append(problems, fmt.Sprintf("custom section %s: %v", TransportTypeSectionName, err))
+		}
+	}
+	return transportType, problems
+}
+
+func checkExports(required map[string]FunctionSignature, exports map[string]api.FunctionDefinition) (problems []string) {
+	names := make([]string, 0, len(required))
+	for name := range required {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		def, ok := exports[name]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("missing export %s", name))
+		} else if !required[name].matches(def) {
+			problems = append(problems, fmt.Sprintf("export %s has signature %v -> %v, want %v -> %v",
+				name, valueTypeNames(def.ParamTypes()), valueTypeNames(def.ResultTypes()),
+				valueTypeNames(required[name].Params), valueTypeNames(required[name].Results)))
+		}
+	}
+	return problems
+}
+
+func checkImports(provided map[string]map[string]FunctionSignature, imports []api.FunctionDefinition) (problems []string) {
+	for _, def := range imports {
+		moduleName, name, ok := def.Import()
+		if !ok || moduleName == wasi_snapshot_preview1.ModuleName {
+			continue
+		}
+
+		sig, ok := provided[moduleName][name]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("unsatisfiable import %s.%s", moduleName, name))
+		} else if !sig.matches(def) {
+			problems = append(problems, fmt.Sprintf("import %s.%s has signature %v -> %v, want %v -> %v",
+				moduleName, name, valueTypeNames(def.ParamTypes()), valueTypeNames(def.ResultTypes()),
+				valueTypeNames(sig.Params), valueTypeNames(sig.Results)))
+		}
+	}
+	return problems
+}
+
+func sortedRoles(m map[Role]map[string]FunctionSignature) []Role {
+	roles := make([]Role, 0, len(m))
+	for role := range m {
+		roles = append(roles, role)
+	}
+	sort.Slice(roles, func(i, j int) bool { return roles[i] < roles[j] })
+	return roles
+}
+
+func valueTypeNames(types []api.ValueType) []string {
+	names := make([]string, len(types))
+	for i, t := range types {
+		names[i] = api.ValueTypeName(t)
+	}
+	return names
+}
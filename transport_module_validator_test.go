@@ -0,0 +1,58 @@
+package water_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/refraction-networking/water"
+	_ "github.com/refraction-networking/water/transport/v1"
+)
+
+func TestValidateTransportModule(t *testing.T) {
+	t.Run("v1 WATM", testValidateTransportModuleV1)
+	t.Run("invalid binary", testValidateTransportModuleInvalid)
+	t.Run("component", testValidateTransportModuleComponent)
+}
+
+func testValidateTransportModuleV1(t *testing.T) {
+	report, err := water.ValidateTransportModule(wasmPlain)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !report.OK() {
+		t.Fatalf("report is not OK: %v", report.Problems)
+	}
+
+	if report.Version != "v1" {
+		t.Errorf("Version = %q, want %q", report.Version, "v1")
+	}
+
+	for _, role := range []water.Role{water.RoleDialer, water.RoleFixedDialer, water.RoleListener, water.RoleRelay} {
+		if !report.Supports(role) {
+			t.Errorf("WATM is expected to support role %s", role)
+		}
+	}
+}
+
+func testValidateTransportModuleInvalid(t *testing.T) {
+	_, err := water.ValidateTransportModule([]byte("not a wasm binary"))
+	if err == nil {
+		t.Fatal("ValidateTransportModule should fail on an invalid binary")
+	}
+}
+
+func testValidateTransportModuleComponent(t *testing.T) {
+	// an empty component: magic, version 0x0d and layer 1
+	component := []byte{0x00, 0x61, 0x73, 0x6d, 0x0d, 0x00, 0x01, 0x00}
+
+	if _, err := water.ValidateTransportModule(component); !errors.Is(err, water.ErrComponentUnsupported) {
+		t.Errorf("ValidateTransportModule() error = %v, want %v", err, water.ErrComponentUnsupported)
+	}
+
+	_, err := water.NewCoreWithContext(context.Background(), &water.Config{TransportModuleBin: component})
+	if !errors.Is(err, water.ErrComponentUnsupported) {
+		t.Errorf("NewCoreWithContext() error = %v, want %v", err, water.ErrComponentUnsupported)
+	}
+}
@@ -0,0 +1,118 @@
+package water
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TransportType is the kind of transport a WebAssembly Transport Module
+// implements, as declared in its metadata.
+type TransportType uint8
+
+const (
+	// TransportTypeUnspecified is reported for WATMs which do not declare
+	// their transport type. They are treated as stream transports.
+	TransportTypeUnspecified TransportType = iota
+	TransportTypeStream
+	TransportTypeDatagram
+)
+
+// TransportTypeSectionName is the name of the WebAssembly custom section
+// in which a WATM declares its transport type. The content of the section
+// must be either "stream" or "datagram".
+const TransportTypeSectionName = "watm_transport_type"
+
+// String implements fmt.Stringer.
+func (tt TransportType) String() string {
+	switch tt {
+	case TransportTypeStream:
+		return "stream"
+	case TransportTypeDatagram:
+		return "datagram"
+	default:
+		return "unspecified"
+	}
+}
+
+func parseTransportType(s string) (TransportType, error) {
+	switch strings.TrimSpace(s) {
+	case "stream":
+		return TransportTypeStream, nil
+	case "datagram":
+		return TransportTypeDatagram, nil
+	default:
+		return TransportTypeUnspecified, fmt.Errorf("unknown transport type %q", s)
+	}
+}
+
+// declaredTransportType returns the TransportType declared by the WATM
+// bin in the TransportTypeSectionName custom section, if any.
+func declaredTransportType(bin []byte) (TransportType, error) {
+	section, ok := customSection(bin, TransportTypeSectionName)
+	if !ok {
+		return TransportTypeUnspecified, nil
+	}
+
+	transportType, err := parseTransportType(string(section))
+	if err != nil {
+		return TransportTypeUnspecified, fmt.Errorf("water: custom section %s: %w", TransportTypeSectionName, err)
+	}
+	return transportType, nil
+}
+
+// networkTransportType returns the TransportType required by the named
+// network, as accepted by net.Dial and net.Listen.
+func networkTransportType(network string) TransportType {
+	switch network {
+	case "udp", "udp4", "udp6", "unixgram", "ip", "ip4", "ip6":
+		return TransportTypeDatagram
+	default:
+		if strings.HasPrefix(network, "ip:") || strings.HasPrefix(network, "ip4:") || strings.HasPrefix(network, "ip6:") {
+			return TransportTypeDatagram
+		}
+		return TransportTypeStream
+	}
+}
+
+// TransportTypeMismatchError is returned when the network requested by
+// the caller does not match the transport type declared by the WATM.
+type TransportTypeMismatchError struct {
+	Declared TransportType // declared by the WATM
+	Network  string        // requested by the caller
+}
+
+// Error implements error.
+func (e *TransportTypeMismatchError) Error() string {
+	return fmt.Sprintf("water: WATM declares a %s transport, which cannot be used on network %q", e.Declared, e.Network)
+}
+
+// CheckNetwork reports whether the WATM in the Config is able to be used
+// on the named network according to the transport type it declares in
+// its metadata. A *TransportTypeMismatchError is returned otherwise. It is
+// called by ListenContext and by the DialContext of the Dialers.
+//
+// WATMs which do not declare their transport type are treated as stream
+// transports. A WATM declaring a datagram transport is only able to be
+// used on a packet-oriented network by a UDPListener, e.g., as created
+// by ListenContext.
+//
+// The metadata is read from the binary without compiling the WATM.
+func (c *Config) CheckNetwork(network string) error {
+	declared, err := declaredTransportType(c.WATMBinOrPanic())
+	if err != nil {
+		return err
+	}
+
+	if declared == TransportTypeUnspecified {
+		declared = TransportTypeStream
+	}
+
+	if networkTransportType(network) != declared {
+		return &TransportTypeMismatchError{
+			Declared: declared,
+			Network:  network,
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,99 @@
+package water_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/refraction-networking/water"
+	_ "github.com/refraction-networking/water/transport/v1"
+)
+
+// withCustomSection appends a custom section to a WebAssembly binary.
+func withCustomSection(bin []byte, name string, data []byte) []byte {
+	payload := append(uleb128(uint32(len(name))), name...)
+	payload = append(payload, data...)
+
+	out := append([]byte{}, bin...)
+	out = append(out, 0x00) // custom section id
+	out = append(out, uleb128(uint32(len(payload)))...)
+	return append(out, payload...)
+}
+
+func uleb128(v uint32) (b []byte) {
+	for {
+		c := byte(v & 0x7f)
+		v >>= 7
+		if v != 0 {
+			c |= 0x80
+		}
+		b = append(b, c)
+		if v == 0 {
+			return b
+		}
+	}
+}
+
+func TestConfig_CheckNetwork(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		bin      []byte
+		network  string
+		mismatch bool
+	}{
+		{"unspecified on tcp", wasmPlain, "tcp", false},
+		{"unspecified on udp", wasmPlain, "udp", true},
+		{"stream on tcp", withCustomSection(wasmPlain, water.TransportTypeSectionName, []byte("stream")), "tcp", false},
+		{"stream on unixgram", withCustomSection(wasmPlain, water.TransportTypeSectionName, []byte("stream")), "unixgram", true},
+		{"datagram on tcp", withCustomSection(wasmPlain, water.TransportTypeSectionName, []byte("datagram")), "tcp", true},
+		{"datagram on udp", withCustomSection(wasmPlain, water.TransportTypeSectionName, []byte("datagram")), "udp", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			config := &water.Config{
+				TransportModuleBin: tc.bin,
+			}
+
+			err := config.CheckNetwork(tc.network)
+			var mismatchErr *water.TransportTypeMismatchError
+			if got := errors.As(err, &mismatchErr); got != tc.mismatch {
+				t.Fatalf("CheckNetwork() = %v, want mismatch: %v", err, tc.mismatch)
+			}
+		})
+	}
+}
+
+func TestValidateTransportModule_TransportType(t *testing.T) {
+	report, err := water.ValidateTransportModule(withCustomSection(wasmPlain, water.TransportTypeSectionName, []byte("datagram")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.TransportType != water.TransportTypeDatagram {
+		t.Errorf("TransportType = %s, want %s", report.TransportType, water.TransportTypeDatagram)
+	}
+
+	report, err = water.ValidateTransportModule(withCustomSection(wasmPlain, water.TransportTypeSectionName, []byte("bogus")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.OK() {
+		t.Error("report must not be OK with an unknown transport type")
+	}
+}
+
+func TestDialer_TransportTypeMismatch(t *testing.T) {
+	dialer, err := water.NewDialerWithContext(context.Background(), &water.Config{
+		TransportModuleBin: withCustomSection(wasmPlain, water.TransportTypeSectionName, []byte("datagram")),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// no connection is attempted
+	_, err = dialer.DialContext(context.Background(), "tcp", "localhost:0")
+	var mismatchErr *water.TransportTypeMismatchError
+	if !errors.As(err, &mismatchErr) {
+		t.Fatalf("DialContext() = %v, want a *TransportTypeMismatchError", err)
+	}
+}
@@ -0,0 +1,46 @@
+package water
+
+import (
+	"errors"
+	"os"
+)
+
+// ErrTUNUnsupported is returned when opening a TUN device on the platforms
+// where TUN devices are not supported.
+var ErrTUNUnsupported = errors.New("water: TUN device is not supported")
+
+// TUN describes the TUN device opened by the host for each WASM instance
+// which asks for it, e.g., a Dialer running a VPN client transport. The
+// WATM reads the outgoing IP packets from the device, one per read, and
+// writes the incoming ones into it, with no header before the packets.
+type TUN struct {
+	// Name is the name of the TUN device to open, or to create if it does
+	// not exist yet, e.g., "water0". If empty, the kernel names a new
+	// device. A device opened by a WASM instance cannot be opened by
+	// another one until closed.
+	Name string
+
+	// File optionally is a TUN device already opened, e.g., by a
+	// privileged helper or the VpnService of Android, used instead of
+	// opening Name. Each WASM instance is given a duplicate of it.
+	File *os.File
+}
+
+// OpenTUN opens the TUN device named name, creating it if it does not
+// exist yet, with no header before the packets read and written. If name
+// is empty, the kernel names a new device. The Name of the file returned
+// is the name of the device, e.g., to configure its addresses and routes
+// with. Creating a device usually requires the privileges of the
+// operating system, e.g., CAP_NET_ADMIN on Linux.
+func OpenTUN(name string) (*os.File, error) {
+	return openTUN(name)
+}
+
+// openFile opens the TUN device for a WASM instance, i.e., duplicates the
+// File if set, or opens the device of Name otherwise.
+func (t *TUN) openFile() (*os.File, error) {
+	if t.File != nil {
+		return dupTUN(t.File)
+	}
+	return openTUN(t.Name)
+}
@@ -0,0 +1,68 @@
+package water
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// openTUN opens the TUN device named name from /dev/net/tun.
+func openTUN(name string) (*os.File, error) {
+	if len(name) >= syscall.IFNAMSIZ {
+		return nil, fmt.Errorf("water: TUN device name %q is too long", name)
+	}
+
+	fd, err := syscall.Open("/dev/net/tun", syscall.O_RDWR|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("water: opening /dev/net/tun: %w", err)
+	}
+
+	// struct ifreq with the name and the flags of the device
+	var ifr [syscall.IFNAMSIZ + 24]byte
+	copy(ifr[:], name)
+	*(*uint16)(unsafe.Pointer(&ifr[syscall.IFNAMSIZ])) = syscall.IFF_TUN | syscall.IFF_NO_PI
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.TUNSETIFF, uintptr(unsafe.Pointer(&ifr))); errno != 0 {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("water: creating TUN device %q: %w", name, errno)
+	}
+
+	if err := syscall.SetNonblock(fd, true); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("water: setting TUN device non-blocking: %w", err)
+	}
+
+	// the kernel writes the name of the device back into the ifreq
+	name = string(ifr[:syscall.IFNAMSIZ])
+	if i := strings.IndexByte(name, 0); i >= 0 {
+		name = name[:i]
+	}
+
+	// as fd is non-blocking, the reads and writes of the file go through
+	// the poller of the runtime, and are interrupted by closing it
+	return os.NewFile(uintptr(fd), name), nil
+}
+
+// dupTUN duplicates the file descriptor of the TUN device f.
+func dupTUN(f *os.File) (*os.File, error) {
+	rawConn, err := f.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+
+	var fd int
+	var dupErr error
+	if err := rawConn.Control(func(sysfd uintptr) {
+		fd, dupErr = syscall.Dup(int(sysfd))
+	}); err != nil {
+		return nil, err
+	}
+	if dupErr != nil {
+		return nil, fmt.Errorf("water: duplicating TUN device: %w", dupErr)
+	}
+	syscall.CloseOnExec(fd)
+
+	// the duplicate shares the blocking mode of f, which is not changed
+	return os.NewFile(uintptr(fd), f.Name()), nil
+}
@@ -0,0 +1,43 @@
+package water_test
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/refraction-networking/water"
+	"github.com/refraction-networking/water/internal/driver"
+)
+
+func TestOpenTUN(t *testing.T) {
+	f, err := water.OpenTUN("")
+	if errors.Is(err, os.ErrPermission) || errors.Is(err, os.ErrNotExist) {
+		t.Skipf("TUN devices are unavailable: %v", err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close() // skipcq: GO-S2307
+
+	// the kernel names the device, e.g., "tun0"
+	if !strings.HasPrefix(f.Name(), "tun") {
+		t.Errorf("Name() = %q, want the name of the device", f.Name())
+	}
+
+	// a duplicate is given to each WASM instance
+	dup, err := driver.OpenTUN(&water.TUN{File: f})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dup.Name() != f.Name() {
+		t.Errorf("Name() of the duplicate = %q, want %q", dup.Name(), f.Name())
+	}
+	if err := dup.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := water.OpenTUN(strings.Repeat("x", 16)); err == nil {
+		t.Error("OpenTUN() with a name too long returned no error")
+	}
+}
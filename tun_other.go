@@ -0,0 +1,17 @@
+//go:build !linux
+
+package water
+
+import (
+	"os"
+)
+
+// openTUN fails with ErrTUNUnsupported, as there is no TUN device of the
+// same format as on Linux on this platform.
+func openTUN(string) (*os.File, error) {
+	return nil, ErrTUNUnsupported
+}
+
+func dupTUN(*os.File) (*os.File, error) {
+	return nil, ErrTUNUnsupported
+}
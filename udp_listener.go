@@ -0,0 +1,513 @@
+package water
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/refraction-networking/water/internal/idle"
+	"github.com/refraction-networking/water/internal/log"
+)
+
+// UDPListener is a Listener hosting a datagram-based WebAssembly Transport
+// Module, e.g., an obfuscated DTLS or QUIC lookalike, on a net.PacketConn.
+//
+// It demultiplexes the incoming datagrams by their source address into a
+// connection per peer, each accepted by its own WASM instance as if from
+// a stream Listener. The WATM reads and writes the datagrams of the peer
+// one at a time, with their boundaries kept, over a datagram socket
+// standing in for the connection. A peer sending no datagram and receiving
+// none for the IdleTimeout expires, closing its connection, so that a
+// later datagram from it is accepted as a new connection.
+//
+// The AcceptRateLimit and AcceptFilter of the Config apply to the peers
+// before their connection is accepted, while TCPOptions does not apply.
+//
+// A UDPListener does not support UpdateConfig. Instead, a new UDPListener
+// may be created on a new PacketConn.
+type UDPListener struct {
+	packetConn  net.PacketConn
+	config      *Config
+	listener    Listener
+	queue       *queueListener
+	idleTimeout time.Duration
+
+	mu        sync.Mutex
+	sessions  map[string]*udpSession
+	accepting bool
+	pending   chan *udpSession // sessions waiting to be accepted
+	serveErr  error            // error reading from the PacketConn
+
+	closed          atomic.Bool
+	done            chan struct{} // closed once the UDPListener stops accepting
+	doneOnce        sync.Once
+	connections     <-chan AcceptResult
+	connectionsOnce sync.Once
+
+	UnimplementedListener // embedded to ensure forward compatibility
+}
+
+// UDPListenerConfig configures a UDPListener.
+type UDPListenerConfig struct {
+	// Config configures the WATM accepting the connection of each peer.
+	// Its NetworkListener is ignored.
+	Config *Config
+
+	// PacketConn is the net.PacketConn to receive the datagrams from and
+	// to send the datagrams to, e.g., a *net.UDPConn. It is closed when
+	// the UDPListener is closed.
+	PacketConn net.PacketConn
+
+	// IdleTimeout optionally sets how long a peer may stay idle before its
+	// connection expires. If this field is unset, it defaults to 2
+	// minutes, the minimum recommended for the UDP mappings of NATs.
+	IdleTimeout time.Duration
+
+	// Backlog optionally limits the number of new peers waiting to be
+	// accepted, beyond which the datagrams from further new peers are
+	// dropped. If this field is unset, it defaults to 128.
+	Backlog int
+}
+
+const (
+	defaultUDPIdleTimeout = 2 * time.Minute
+	defaultUDPBacklog     = 128
+
+	// maxDatagramSize is the largest payload of a UDP datagram.
+	maxDatagramSize = 1<<16 - 1
+)
+
+var _ Listener = (*UDPListener)(nil) // type guard
+
+// NewUDPListener creates a UDPListener from the UDPListenerConfig, with a
+// Listener for the WATM created with NewListenerWithContext, and starts
+// receiving the datagrams from the PacketConn.
+func NewUDPListener(ctx context.Context, uc *UDPListenerConfig) (*UDPListener, error) {
+	if uc == nil || uc.PacketConn == nil {
+		return nil, errors.New("water: UDPListener requires a PacketConn")
+	}
+	if uc.Config == nil {
+		return nil, errors.New("water: UDPListener requires a Config")
+	}
+	config, err := uc.Config.snapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	l := &UDPListener{
+		packetConn:  uc.PacketConn,
+		config:      config,
+		queue:       &queueListener{addr: uc.PacketConn.LocalAddr()},
+		idleTimeout: uc.IdleTimeout,
+		sessions:    make(map[string]*udpSession),
+		accepting:   true,
+		done:        make(chan struct{}),
+	}
+	if l.idleTimeout <= 0 {
+		l.idleTimeout = defaultUDPIdleTimeout
+	}
+	backlog := uc.Backlog
+	if backlog <= 0 {
+		backlog = defaultUDPBacklog
+	}
+	l.pending = make(chan *udpSession, backlog)
+
+	// the peers are filtered by the UDPListener, by their address
+	listenerConfig := l.config.Clone()
+	listenerConfig.NetworkListener = l.queue
+	listenerConfig.AcceptRateLimit = nil
+	listenerConfig.AcceptFilter = nil
+
+	lis, err := NewListenerWithContext(ctx, listenerConfig)
+	if err != nil {
+		return nil, fmt.Errorf("water: creating Listener for UDPListener: %w", err)
+	}
+	l.listener = lis
+
+	go l.serve()
+	return l, nil
+}
+
+// Accept waits for and returns the connection of the next new peer.
+//
+// Implements [net.Listener].
+func (l *UDPListener) Accept() (net.Conn, error) {
+	return l.AcceptWATER()
+}
+
+// AcceptWATER waits for and returns the connection of the next new peer,
+// accepted by the WATM.
+//
+// Implements [Listener].
+func (l *UDPListener) AcceptWATER() (Conn, error) {
+	res := l.accept()
+	return res.Conn, res.Err
+}
+
+// Connections returns a channel delivering the result of accepting the
+// connection of each new peer, which is closed once the UDPListener is
+// closed.
+//
+// Implements [Listener].
+func (l *UDPListener) Connections() <-chan AcceptResult {
+	l.connectionsOnce.Do(func() {
+		l.connections = serveAcceptResults(l.accept, l.done)
+	})
+	return l.connections
+}
+
+func (l *UDPListener) accept() (res AcceptResult) {
+	for {
+		var s *udpSession
+		select {
+		case s = <-l.pending:
+		case <-l.done:
+		}
+		if s == nil || !l.isAccepting() {
+			if s != nil {
+				s.close()
+			}
+			res.Err = l.closedErr()
+			return res
+		}
+		start := time.Now()
+
+		if l.config.AcceptFilter != nil && !l.config.AcceptFilter(s.filterConn()) {
+			log.LDebugf(l.config.Logger(), "water: peer %s rejected by AcceptFilter", s.addr)
+			s.close()
+			continue
+		}
+
+		if !l.queue.push(s.watmConn) {
+			s.close()
+			res.Err = l.closedErr()
+			return res
+		}
+
+		conn, err := l.listener.AcceptWATER()
+		if errors.Is(err, errMuxQueueEmpty) {
+			s.close()
+			continue // rejected by the Config
+		}
+		if err != nil {
+			s.close()
+			res.Err = err
+			return res
+		}
+
+		udpConn, ok := s.accepted(conn)
+		if !ok {
+			continue // expired during the handshake
+		}
+		res.Conn = udpConn
+		res.RemoteAddr = s.addr
+		res.HandshakeDuration = time.Since(start)
+		return res
+	}
+}
+
+// serve receives the datagrams from the PacketConn and forwards each to
+// the session of its source, until the PacketConn fails or is closed.
+func (l *UDPListener) serve() {
+	buf := make([]byte, maxDatagramSize)
+	for {
+		n, addr, err := l.packetConn.ReadFrom(buf)
+		if err != nil {
+			l.mu.Lock()
+			l.serveErr = err
+			l.mu.Unlock()
+			l.stopAccepting()
+			return
+		}
+
+		s := l.session(addr)
+		if s == nil {
+			continue
+		}
+		s.idle.Touch()
+		if _, err := s.hostConn.Write(buf[:n]); err != nil {
+			log.LDebugf(l.config.Logger(), "water: forwarding datagram from %s: %v", addr, err)
+			s.close()
+		}
+	}
+}
+
+// session returns the session of the peer at addr, creating it if the
+// peer is new, or nil if the datagram from the peer is to be dropped.
+func (l *UDPListener) session(addr net.Addr) *udpSession {
+	key := addr.String()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if s, ok := l.sessions[key]; ok {
+		return s
+	}
+	if !l.accepting {
+		return nil
+	}
+	if !l.config.AcceptRateLimit.Allow(addr) {
+		log.LDebugf(l.config.Logger(), "water: peer %s rejected by AcceptRateLimit", addr)
+		return nil
+	}
+
+	hostConn, watmConn, err := datagramConnPair()
+	if err != nil {
+		log.LErrorf(l.config.Logger(), "water: creating connection for peer %s: %v", addr, err)
+		return nil
+	}
+	s := &udpSession{
+		listener: l,
+		key:      key,
+		addr:     addr,
+		hostConn: hostConn,
+		watmConn: watmConn,
+		idle:     idle.NewTimer(l.idleTimeout),
+	}
+
+	select {
+	case l.pending <- s:
+	default:
+		log.LDebugf(l.config.Logger(), "water: peer %s dropped as the backlog is full", addr)
+		hostConn.Close()
+		watmConn.Close()
+		return nil
+	}
+	l.sessions[key] = s
+
+	go s.forward()
+	s.idle.Start(s.close)
+	return s
+}
+
+func (l *UDPListener) isAccepting() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.accepting
+}
+
+func (l *UDPListener) closedErr() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.serveErr != nil && !l.closed.Load() {
+		return fmt.Errorf("water: reading from PacketConn: %w", l.serveErr)
+	}
+	return errors.New("water: listener is closed")
+}
+
+// stopAccepting stops creating sessions for new peers and closes those
+// waiting to be accepted.
+func (l *UDPListener) stopAccepting() {
+	l.doneOnce.Do(func() {
+		l.mu.Lock()
+		l.accepting = false
+		l.mu.Unlock()
+		close(l.done)
+
+		for {
+			select {
+			case s := <-l.pending:
+				s.close()
+			default:
+				return
+			}
+		}
+	})
+}
+
+// Close closes the UDPListener, along with its PacketConn. Unlike other
+// Listeners, it also closes the established connections, which cannot
+// send or receive any datagram without the PacketConn.
+//
+// Implements [net.Listener].
+func (l *UDPListener) Close() error {
+	l.stopAccepting()
+	if !l.closed.CompareAndSwap(false, true) {
+		return nil
+	}
+
+	err := l.packetConn.Close()
+	l.listener.Close()
+	l.queue.Close()
+
+	l.mu.Lock()
+	sessions := make([]*udpSession, 0, len(l.sessions))
+	for _, s := range l.sessions {
+		sessions = append(sessions, s)
+	}
+	l.mu.Unlock()
+	for _, s := range sessions {
+		s.close()
+	}
+
+	return err
+}
+
+// Addr returns the local address of the PacketConn.
+//
+// Implements [net.Listener].
+func (l *UDPListener) Addr() net.Addr {
+	return l.packetConn.LocalAddr()
+}
+
+// Shutdown gracefully shuts down the UDPListener. It first stops accepting
+// new peers, then waits for all established connections to be closed or
+// to expire before closing the UDPListener. If ctx expires before that,
+// the UDPListener is closed along with the remaining connections, and
+// ctx.Err() is returned.
+//
+// Implements [Listener].
+func (l *UDPListener) Shutdown(ctx context.Context) error {
+	l.stopAccepting()
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for {
+		if l.activeSessions() == 0 {
+			return l.Close()
+		}
+
+		select {
+		case <-ctx.Done():
+			l.Close()
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (l *UDPListener) activeSessions() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return len(l.sessions)
+}
+
+// shutdownPollInterval is how often Shutdown checks whether all
+// connections are closed.
+const shutdownPollInterval = 50 * time.Millisecond
+
+// udpSession is the connection of a peer of a UDPListener, carrying its
+// datagrams between the PacketConn and the WATM over a pair of datagram
+// sockets.
+type udpSession struct {
+	listener *UDPListener
+	key      string
+	addr     net.Addr
+	hostConn net.Conn // read and written by the UDPListener
+	watmConn net.Conn // read and written by the WATM
+	idle     *idle.Timer
+
+	mu        sync.Mutex
+	conn      Conn // once accepted
+	closed    bool
+	closeOnce sync.Once
+}
+
+// forward sends the datagrams written by the WATM to the peer, until the
+// session is closed.
+func (s *udpSession) forward() {
+	buf := make([]byte, maxDatagramSize)
+	for {
+		n, err := s.hostConn.Read(buf)
+		if err != nil {
+			s.close()
+			return
+		}
+		s.idle.Touch()
+		if _, err := s.listener.packetConn.WriteTo(buf[:n], s.addr); err != nil {
+			log.LDebugf(s.listener.config.Logger(), "water: sending datagram to %s: %v", s.addr, err)
+		}
+	}
+}
+
+// accepted records conn as the connection of the session, returning it
+// wrapped to report the address of the peer, or closes it and returns
+// false if the session is already closed.
+func (s *udpSession) accepted(conn Conn) (Conn, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		conn.Close()
+		return nil, false
+	}
+	s.conn = conn
+	return &udpConn{Conn: conn, session: s}, true
+}
+
+// close closes the session along with its connection, if accepted, and
+// forgets it, so that a later datagram from the peer creates a new one.
+func (s *udpSession) close() {
+	s.closeOnce.Do(func() {
+		l := s.listener
+		l.mu.Lock()
+		if l.sessions[s.key] == s {
+			delete(l.sessions, s.key)
+		}
+		l.mu.Unlock()
+
+		s.mu.Lock()
+		s.closed = true
+		conn := s.conn
+		s.mu.Unlock()
+
+		s.idle.Stop()
+		s.hostConn.Close()
+		s.watmConn.Close()
+		if conn != nil {
+			conn.Close()
+		}
+	})
+}
+
+// filterConn returns the connection of the session for the AcceptFilter,
+// reporting the addresses of the PacketConn and of the peer.
+func (s *udpSession) filterConn() net.Conn {
+	return &udpAddrConn{Conn: s.watmConn, session: s}
+}
+
+// udpAddrConn is a net.Conn reporting the addresses of a udpSession.
+type udpAddrConn struct {
+	net.Conn
+	session *udpSession
+}
+
+func (c *udpAddrConn) LocalAddr() net.Addr {
+	return c.session.listener.packetConn.LocalAddr()
+}
+
+func (c *udpAddrConn) RemoteAddr() net.Addr {
+	return c.session.addr
+}
+
+// udpConn is a Conn accepted by a UDPListener, reporting the addresses of
+// the PacketConn and of the peer, and closing the session of the peer once
+// closed.
+type udpConn struct {
+	Conn
+	session *udpSession
+}
+
+// LocalAddr implements net.Conn.LocalAddr().
+func (c *udpConn) LocalAddr() net.Addr {
+	return c.session.listener.packetConn.LocalAddr()
+}
+
+// RemoteAddr implements net.Conn.RemoteAddr().
+func (c *udpConn) RemoteAddr() net.Addr {
+	return c.session.addr
+}
+
+// Close implements net.Conn.Close().
+func (c *udpConn) Close() error {
+	err := c.Conn.Close()
+	c.session.close()
+	return err
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+
+package water
+
+import (
+	"errors"
+	"net"
+)
+
+// datagramConnPair fails, as there are no datagram socket pairs whose
+// file descriptors can be passed to the WATM on this platform.
+func datagramConnPair() (hostConn, watmConn net.Conn, err error) {
+	return nil, nil, errors.New("water: UDPListener is not supported on this platform")
+}
@@ -0,0 +1,150 @@
+//go:build unix
+
+package water_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/refraction-networking/water"
+	_ "github.com/refraction-networking/water/transport/v1"
+)
+
+func TestUDPListener(t *testing.T) {
+	config := &water.Config{
+		TransportModuleBin:  withCustomSection(wasmPlain, water.TransportTypeSectionName, []byte("datagram")),
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+	}
+
+	lis, err := config.ListenContext(context.Background(), "udp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close() // skipcq: GO-S2307
+
+	accept := func(peerConn net.Conn, msg string) water.Conn {
+		t.Helper()
+
+		if _, err := peerConn.Write([]byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+		conn, err := lis.AcceptWATER()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if conn.RemoteAddr().String() != peerConn.LocalAddr().String() {
+			t.Errorf("RemoteAddr() = %s, want %s", conn.RemoteAddr(), peerConn.LocalAddr())
+		}
+		if got := readDatagram(t, conn, len(msg)); got != msg {
+			t.Fatalf("read %q, want %q", got, msg)
+		}
+		return conn
+	}
+
+	// each peer is accepted as its own connection
+	peerConn1, err := net.Dial("udp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peerConn1.Close() // skipcq: GO-S2307
+	conn1 := accept(peerConn1, "hello")
+	defer conn1.Close() // skipcq: GO-S2307
+
+	peerConn2, err := net.Dial("udp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peerConn2.Close() // skipcq: GO-S2307
+	conn2 := accept(peerConn2, "world")
+	defer conn2.Close() // skipcq: GO-S2307
+
+	// later datagrams are delivered to the connection of their peer
+	if _, err := peerConn1.Write([]byte("again")); err != nil {
+		t.Fatal(err)
+	}
+	if got := readDatagram(t, conn1, 5); got != "again" {
+		t.Errorf("read %q, want %q", got, "again")
+	}
+
+	// each write is sent as a datagram to the peer
+	if _, err := conn2.Write([]byte("reply")); err != nil {
+		t.Fatal(err)
+	}
+	if got := readDatagram(t, peerConn2, 5); got != "reply" {
+		t.Errorf("peer read %q, want %q", got, "reply")
+	}
+}
+
+func TestUDPListener_IdleTimeout(t *testing.T) {
+	packetConn, err := net.ListenPacket("udp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lis, err := water.NewUDPListener(context.Background(), &water.UDPListenerConfig{
+		Config: &water.Config{
+			TransportModuleBin:  wasmPlain,
+			ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+		},
+		PacketConn:  packetConn,
+		IdleTimeout: 200 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close() // skipcq: GO-S2307
+
+	peerConn, err := net.Dial("udp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peerConn.Close() // skipcq: GO-S2307
+
+	if _, err := peerConn.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := lis.AcceptWATER()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close() // skipcq: GO-S2307
+
+	// the connection expires once idle, then the peer is accepted anew
+	if err := conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadAll(conn); errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatal("idle connection did not expire")
+	}
+
+	if _, err := peerConn.Write([]byte("again")); err != nil {
+		t.Fatal(err)
+	}
+	newConn, err := lis.AcceptWATER()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer newConn.Close() // skipcq: GO-S2307
+
+	if got := readDatagram(t, newConn, 5); got != "again" {
+		t.Errorf("read %q, want %q", got, "again")
+	}
+}
+
+func readDatagram(t *testing.T, conn net.Conn, n int) string {
+	t.Helper()
+
+	if err := conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatal(err)
+	}
+	return string(buf)
+}
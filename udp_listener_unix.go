@@ -0,0 +1,42 @@
+//go:build unix
+
+package water
+
+import (
+	"fmt"
+	"net"
+	"runtime"
+	"syscall"
+)
+
+// datagramConnPair returns a connected pair of unix sockets keeping the
+// boundaries of the datagrams written to them, for a udpSession. On Linux,
+// a SOCK_SEQPACKET pair also reports the closing of either end to the
+// other, as opposed to a SOCK_DGRAM pair.
+func datagramConnPair() (hostConn, watmConn net.Conn, err error) {
+	sotype := syscall.SOCK_DGRAM
+	if runtime.GOOS == "linux" {
+		sotype = syscall.SOCK_SEQPACKET
+	}
+
+	syscall.ForkLock.RLock()
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, sotype, 0)
+	if err == nil {
+		syscall.CloseOnExec(fds[0])
+		syscall.CloseOnExec(fds[1])
+	}
+	syscall.ForkLock.RUnlock()
+	if err != nil {
+		return nil, nil, fmt.Errorf("water: socketpair: %w", err)
+	}
+
+	if hostConn, err = fileConn(uintptr(fds[0]), "session host"); err != nil {
+		syscall.Close(fds[1])
+		return nil, nil, err
+	}
+	if watmConn, err = fileConn(uintptr(fds[1]), "session WATM"); err != nil {
+		hostConn.Close()
+		return nil, nil, err
+	}
+	return hostConn, watmConn, nil
+}
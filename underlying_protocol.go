@@ -0,0 +1,96 @@
+package water
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// UnderlyingProtocol is a protocol carrying the traffic of WATMs instead
+// of TCP, e.g., QUIC, selected by its name with Config.UnderlyingProtocol.
+//
+// Each connection it dials or accepts carries the traffic of one WATM
+// instance, so it must be reliable and ordered like a TCP connection,
+// e.g., a QUIC stream.
+type UnderlyingProtocol struct {
+	// Dial dials address for a WATM created with the Config. The network
+	// is the one the WATM requested, e.g., "tcp", which the protocol may
+	// ignore.
+	Dial func(ctx context.Context, c *Config, network, address string) (net.Conn, error)
+
+	// Listen listens on address for a Listener or a Relay created with
+	// the Config, like Config.ListenNetwork does for TCP.
+	Listen func(ctx context.Context, c *Config, network, address string) (net.Listener, error)
+
+	// TLS is true if the protocol secures its connections with the
+	// Config.UnderlyingTLS itself, e.g., QUIC, in which case TLS is not
+	// layered over them once more.
+	TLS bool
+}
+
+var (
+	knownUnderlyingProtocols = make(map[string]UnderlyingProtocol)
+
+	ErrUnderlyingProtocolAlreadyRegistered = errors.New("water: underlying protocol already registered")
+	ErrUnderlyingProtocolNotFound          = errors.New("water: underlying protocol not found")
+)
+
+// registerUnderlyingProtocol is a function used by the packages
+// implementing an UnderlyingProtocol (e.g., `quic`) to register it under
+// the given name, upon being imported.
+func registerUnderlyingProtocol(name string, protocol UnderlyingProtocol) error {
+	if name == "" || name == "tcp" {
+		return fmt.Errorf("water: underlying protocol name %q is reserved", name)
+	}
+	if _, ok := knownUnderlyingProtocols[name]; ok {
+		return ErrUnderlyingProtocolAlreadyRegistered
+	}
+	knownUnderlyingProtocols[name] = protocol
+	return nil
+}
+
+// underlyingProtocol returns the UnderlyingProtocol selected, or nil for
+// TCP.
+func (c *Config) underlyingProtocol() (*UnderlyingProtocol, error) {
+	switch c.UnderlyingProtocol {
+	case "", "tcp":
+		return nil, nil
+	}
+
+	protocol, ok := knownUnderlyingProtocols[c.UnderlyingProtocol]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q, is the package implementing it imported? (e.g., github.com/refraction-networking/water/quic)",
+			ErrUnderlyingProtocolNotFound, c.UnderlyingProtocol)
+	}
+	return &protocol, nil
+}
+
+// underlyingDialerFunc returns the func dialing with the UnderlyingProtocol,
+// or nil for TCP.
+func (c *Config) underlyingDialerFunc(ctx context.Context) func(network, address string) (net.Conn, error) {
+	protocol, err := c.underlyingProtocol()
+	if err != nil {
+		return func(_, _ string) (net.Conn, error) {
+			return nil, err
+		}
+	}
+	if protocol == nil {
+		return nil
+	}
+
+	return func(network, address string) (net.Conn, error) {
+		return protocol.Dial(ctx, c, network, address)
+	}
+}
+
+// underlyingTLS reports whether UnderlyingTLS is to be layered over the
+// connections of the UnderlyingProtocol, i.e., if it is set and the
+// protocol does not use it itself.
+func (c *Config) underlyingTLS() bool {
+	if c.UnderlyingTLS == nil {
+		return false
+	}
+	protocol, err := c.underlyingProtocol()
+	return err != nil || protocol == nil || !protocol.TLS
+}
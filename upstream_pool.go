@@ -0,0 +1,210 @@
+package water
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/refraction-networking/water/internal/log"
+)
+
+// ErrUpstreamPoolClosed is returned when dialing through an UpstreamPool
+// already closed.
+var ErrUpstreamPoolClosed = errors.New("water: upstream pool closed")
+
+// UpstreamPool keeps connections to the upstreams of a Relay dialed in
+// advance, so that relaying many short inbound connections to the same
+// upstream does not pay for dialing it (e.g., the TCP handshake over a
+// long path) on every inbound connection.
+//
+// An upstream connection is used for a single inbound connection: once
+// the WATM closes it, it is not reused for the next one, as the host has
+// no way to tell whether the protocol of the WATM left the stream at a
+// message boundary. The pool is instead refilled in the background each
+// time a connection is taken out of it, up to Size connections per
+// upstream address. The first connection to an address is dialed on
+// demand, after which the pool starts filling.
+//
+// The PROXY protocol header, if enabled, is written when the connection
+// is taken out of the pool, so it describes the right inbound connection.
+//
+// The exported fields must not be modified once the UpstreamPool is in
+// use.
+type UpstreamPool struct {
+	// Size is the number of idle connections kept dialed to each upstream
+	// address. If not positive, 1 will be used.
+	Size int
+
+	// MaxIdleTime is the maximum amount of time a connection may stay
+	// idle in the pool before being closed instead of being used, as the
+	// upstream may close idle connections itself. If zero, there is no
+	// limit. Each connection taken out of the pool is also checked not to
+	// be closed by the upstream already.
+	MaxIdleTime time.Duration
+
+	mutex  sync.Mutex
+	closed bool
+	idle   map[string]*upstreamIdle // by network and address
+}
+
+type upstreamIdle struct {
+	conns   []upstreamPoolConn
+	filling bool
+}
+
+type upstreamPoolConn struct {
+	conn    net.Conn
+	idledAt time.Time
+}
+
+// NewUpstreamPool creates an UpstreamPool keeping size idle connections
+// dialed to each upstream address.
+func NewUpstreamPool(size int) *UpstreamPool {
+	return &UpstreamPool{Size: size}
+}
+
+// Idle returns the number of idle connections in the pool, to all
+// upstream addresses.
+func (p *UpstreamPool) Idle() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	var n int
+	for _, idle := range p.idle {
+		n += len(idle.conns)
+	}
+	return n
+}
+
+// Close closes all idle connections and stops refilling the pool. The
+// connections already taken out of it are not affected.
+func (p *UpstreamPool) Close() error {
+	p.mutex.Lock()
+	p.closed = true
+	idle := p.idle
+	p.idle = nil
+	p.mutex.Unlock()
+
+	var errs []error
+	for _, i := range idle {
+		for _, pc := range i.conns {
+			if err := pc.conn.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// dialFunc returns dialerFunc, dialing through the pool if p is not nil.
+func (p *UpstreamPool) dialFunc(dialerFunc func(network, address string) (net.Conn, error)) func(network, address string) (net.Conn, error) {
+	if p == nil {
+		return dialerFunc
+	}
+
+	return func(network, address string) (net.Conn, error) {
+		key := network + " " + address
+		conn, err := p.take(key)
+		if err != nil {
+			return nil, err
+		}
+		p.fill(key, dialerFunc, network, address)
+
+		if conn != nil {
+			return conn, nil
+		}
+		return dialerFunc(network, address)
+	}
+}
+
+// take returns an idle connection to the upstream, or nil if there is
+// none usable.
+func (p *UpstreamPool) take(key string) (net.Conn, error) {
+	for {
+		p.mutex.Lock()
+		if p.closed {
+			p.mutex.Unlock()
+			return nil, ErrUpstreamPoolClosed
+		}
+		idle := p.idle[key]
+		if idle == nil || len(idle.conns) == 0 {
+			p.mutex.Unlock()
+			return nil, nil
+		}
+		pc := idle.conns[0] // the oldest, least likely to be fresh later
+		idle.conns = idle.conns[1:]
+		p.mutex.Unlock()
+
+		if p.MaxIdleTime > 0 && time.Since(pc.idledAt) >= p.MaxIdleTime {
+			pc.conn.Close()
+			continue
+		}
+		if err := probeIdleConn(pc.conn); err != nil {
+			log.Debugf("water: UpstreamPool closing broken connection to %s: %v", pc.conn.RemoteAddr(), err)
+			pc.conn.Close()
+			continue
+		}
+		return pc.conn, nil
+	}
+}
+
+// fill dials in the background until there are Size idle connections to
+// the upstream, unless already doing so.
+func (p *UpstreamPool) fill(key string, dialerFunc func(network, address string) (net.Conn, error), network, address string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.closed {
+		return
+	}
+	if p.idle == nil {
+		p.idle = make(map[string]*upstreamIdle)
+	}
+	idle := p.idle[key]
+	if idle == nil {
+		idle = &upstreamIdle{}
+		p.idle[key] = idle
+	}
+	if idle.filling {
+		return
+	}
+	idle.filling = true
+
+	go func() {
+		for {
+			p.mutex.Lock()
+			if p.closed || len(idle.conns) >= p.size() {
+				idle.filling = false
+				p.mutex.Unlock()
+				return
+			}
+			p.mutex.Unlock()
+
+			conn, err := dialerFunc(network, address)
+			if err != nil {
+				log.Debugf("water: UpstreamPool dialing %s %s: %v", network, address, err)
+				p.mutex.Lock()
+				idle.filling = false // retried upon the next connection taken
+				p.mutex.Unlock()
+				return
+			}
+
+			p.mutex.Lock()
+			if p.closed {
+				p.mutex.Unlock()
+				conn.Close()
+				return
+			}
+			idle.conns = append(idle.conns, upstreamPoolConn{conn: conn, idledAt: time.Now()})
+			p.mutex.Unlock()
+		}
+	}()
+}
+
+func (p *UpstreamPool) size() int {
+	if p.Size <= 0 {
+		return 1
+	}
+	return p.Size
+}
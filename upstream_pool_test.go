@@ -0,0 +1,150 @@
+package water_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/refraction-networking/water"
+)
+
+func TestUpstreamPool(t *testing.T) {
+	upstream, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer upstream.Close() // skipcq: GO-S2307
+
+	// the upstream side of each connection, by the address dialed from
+	var mutex sync.Mutex
+	accepted := make(map[string]net.Conn)
+	go func() {
+		for {
+			conn, err := upstream.Accept()
+			if err != nil {
+				return
+			}
+			mutex.Lock()
+			accepted[conn.RemoteAddr().String()] = conn
+			mutex.Unlock()
+		}
+	}()
+	defer func() {
+		mutex.Lock()
+		defer mutex.Unlock()
+		for _, conn := range accepted {
+			conn.Close()
+		}
+	}()
+	upstreamSideOf := func(conn net.Conn) net.Conn {
+		t.Helper()
+		for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			mutex.Lock()
+			c := accepted[conn.LocalAddr().String()]
+			mutex.Unlock()
+			if c != nil {
+				return c
+			}
+		}
+		t.Fatalf("upstream did not accept the connection from %s", conn.LocalAddr())
+		return nil
+	}
+
+	pool := water.NewUpstreamPool(2)
+	config := &water.Config{
+		ProxyProtocol: water.ProxyProtocolV2,
+		UpstreamPool:  pool,
+	}
+	waitIdle := func(want int) {
+		t.Helper()
+		deadline := time.Now().Add(time.Second)
+		for pool.Idle() != want && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if idle := pool.Idle(); idle != want {
+			t.Fatalf("Idle() = %d, want %d", idle, want)
+		}
+	}
+
+	inbound := &addrConn{
+		local:  &net.TCPAddr{IP: net.IPv4(198, 51, 100, 1), Port: 443},
+		remote: &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 56324},
+	}
+
+	// the first connection is dialed on demand, then the pool fills
+	conn, err := relayDialerFunc(config, inbound)("tcp", upstream.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close() // skipcq: GO-S2307
+	waitIdle(2)
+
+	// the next one is taken from the pool, and only then carries the
+	// PROXY protocol header of its own inbound connection
+	pooled := make(map[net.Conn]bool)
+	mutex.Lock()
+	for _, c := range accepted {
+		pooled[c] = true
+	}
+	mutex.Unlock()
+
+	inbound.remote = &net.TCPAddr{IP: net.IPv4(192, 0, 2, 2), Port: 41000}
+	want, err := water.ProxyProtocolV2.Header(inbound.remote, inbound.local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err = relayDialerFunc(config, inbound)("tcp", upstream.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close() // skipcq: GO-S2307
+
+	upstreamConn := upstreamSideOf(conn)
+	if !pooled[upstreamConn] {
+		t.Fatal("connection was not taken from the pool")
+	}
+	got := make([]byte, len(want))
+	if _, err := io.ReadFull(upstreamConn, got); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("upstream received %x, want %x", got, want)
+	}
+	waitIdle(2)
+
+	// idle connections closed by the upstream are not handed out
+	mutex.Lock()
+	for _, c := range accepted {
+		if c != upstreamConn {
+			c.Close()
+		}
+	}
+	mutex.Unlock()
+	time.Sleep(50 * time.Millisecond)
+
+	conn, err = relayDialerFunc(config, inbound)("tcp", upstream.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close() // skipcq: GO-S2307
+	if _, err := conn.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(upstreamSideOf(conn), make([]byte, len(want)+5)); err != nil {
+		t.Fatalf("reading from the connection handed out: %v", err)
+	}
+
+	if err := pool.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if idle := pool.Idle(); idle != 0 {
+		t.Errorf("Idle() = %d after Close, want 0", idle)
+	}
+	if _, err := relayDialerFunc(config, inbound)("tcp", upstream.Addr().String()); !errors.Is(err, water.ErrUpstreamPoolClosed) {
+		t.Errorf("dialing after Close = %v, want %v", err, water.ErrUpstreamPoolClosed)
+	}
+}
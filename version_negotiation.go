@@ -0,0 +1,182 @@
+package water
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// VersionSectionName is the name of the WebAssembly custom section in
+// which a WATM declares the ABI versions it implements, e.g., "v1" or
+// "v1,v0", separated by commas or spaces in order of preference.
+//
+// The host picks the first version declared by the WATM it has a driver
+// registered for, see NegotiateVersion. WATMs not declaring any version
+// are recognized by the functions they export instead.
+const VersionSectionName = "watm_versions"
+
+// ErrVersionMismatch is returned when none of the ABI versions declared
+// by a WATM is supported by the host. The error returned is a
+// *VersionMismatchError, which wraps it.
+var ErrVersionMismatch = errors.New("water: no ABI version in common with the WATM")
+
+// VersionMismatchError reports the ABI versions declared by a WATM, none
+// of which is supported by the host.
+type VersionMismatchError struct {
+	Declared  []string // declared by the WATM, in order of preference
+	Supported []string // supported by the host, see SupportedVersions
+}
+
+// Error implements error.
+func (e *VersionMismatchError) Error() string {
+	return fmt.Sprintf("water: WATM implements ABI versions [%s], but only [%s] are supported, the driver of a version it implements (e.g., transport/%s) may not be imported",
+		strings.Join(e.Declared, " "), strings.Join(e.Supported, " "), e.Declared[0])
+}
+
+// Unwrap returns ErrVersionMismatch.
+func (*VersionMismatchError) Unwrap() error {
+	return ErrVersionMismatch
+}
+
+// SupportedVersions returns the ABI versions supported by the host, i.e.,
+// those of the drivers imported (e.g., `transport/v1`), in lexical order.
+func SupportedVersions() []string {
+	versions := make([]string, 0, len(knownTransportModuleSpecs))
+	for _, spec := range knownTransportModuleSpecs {
+		versions = append(versions, spec.Version)
+	}
+	sort.Strings(versions)
+	return versions
+}
+
+// NegotiateVersion returns the ABI version the WATM is to be driven with:
+// the first version declared in its VersionSectionName custom section
+// which the host supports, or a *VersionMismatchError if none is.
+//
+// If the WATM declares no version, its version is detected from its
+// exports as with ValidateTransportModule, and an error describing what
+// is missing from the closest version is returned if none matches.
+func NegotiateVersion(bin []byte) (string, error) {
+	spec, err := negotiateVersion(bin)
+	if err != nil {
+		return "", err
+	}
+	if spec != nil {
+		return spec.Version, nil
+	}
+
+	report, err := ValidateTransportModule(bin)
+	if err != nil {
+		return "", err
+	}
+	if report.Version == "" {
+		return "", fmt.Errorf("water: WATM does not implement any supported ABI version: %s", strings.Join(report.Problems, "; "))
+	}
+	return report.Version, nil
+}
+
+// negotiateVersion returns the spec of the version negotiated with the
+// WATM, or nil if the WATM declares no version.
+func negotiateVersion(bin []byte) (*TransportModuleSpec, error) {
+	section, ok := customSection(bin, VersionSectionName)
+	if !ok {
+		return nil, nil
+	}
+
+	declared := parseVersions(string(section))
+	if len(declared) == 0 {
+		return nil, fmt.Errorf("water: custom section %s declares no version", VersionSectionName)
+	}
+
+	for _, version := range declared {
+		for i := range knownTransportModuleSpecs {
+			if knownTransportModuleSpecs[i].Version == version {
+				return &knownTransportModuleSpecs[i], nil
+			}
+		}
+	}
+
+	return nil, &VersionMismatchError{
+		Declared:  declared,
+		Supported: SupportedVersions(),
+	}
+}
+
+func parseVersions(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+	})
+}
+
+// exportNames returns the names of the functions a WATM of the spec
+// exports to play the role, under one of which the driver of the version
+// is registered.
+func (spec *TransportModuleSpec) exportNames(role Role) []string {
+	names := make([]string, 0, len(spec.Exports)+len(spec.RoleExports[role]))
+	for name := range spec.RoleExports[role] {
+		names = append(names, name)
+	}
+	for name := range spec.Exports {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// versionRoleError wraps err, e.g., ErrDialerVersionNotFound, to report
+// that the negotiated version has no driver registered for the role.
+func versionRoleError(err error, spec *TransportModuleSpec, role Role) error {
+	return fmt.Errorf("%w: the driver of ABI version %s does not support the %s role", err, spec.Version, role)
+}
+
+// versionNotFoundError wraps err, e.g., ErrDialerVersionNotFound, with
+// the reason why the WATM declaring no version could not be driven in
+// the role, instead of the export missing.
+func versionNotFoundError(err error, bin []byte, role Role) error {
+	report, rerr := ValidateTransportModule(bin)
+	switch {
+	case rerr != nil:
+		return err
+	case report.Version == "":
+		return fmt.Errorf("%w: WATM does not implement any supported ABI version [%s], importing transport/all supports all of them: %s",
+			err, strings.Join(SupportedVersions(), " "), strings.Join(report.Problems, "; "))
+	case !report.Supports(role):
+		return fmt.Errorf("%w: WATM of ABI version %s is unable to play the %s role", err, report.Version, role)
+	default:
+		return err
+	}
+}
+
+// customSection returns the content of the first custom section of the
+// WebAssembly module bin with the given name, without compiling it.
+func customSection(bin []byte, name string) ([]byte, bool) {
+	if len(bin) < 8 || string(bin[:4]) != "\x00asm" || isComponent(bin) {
+		return nil, false
+	}
+
+	rest := bin[8:]
+	for len(rest) > 0 {
+		id := rest[0]
+		size, n := binary.Uvarint(rest[1:])
+		if n <= 0 || size > uint64(len(rest)-1-n) {
+			return nil, false
+		}
+		content := rest[1+n : 1+n+int(size)]
+		rest = rest[1+n+int(size):]
+
+		if id != 0 { // not a custom section
+			continue
+		}
+
+		nameLen, n := binary.Uvarint(content)
+		if n <= 0 || nameLen > uint64(len(content)-n) {
+			return nil, false
+		}
+		if string(content[n:n+int(nameLen)]) == name {
+			return content[n+int(nameLen):], true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,74 @@
+package water_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/refraction-networking/water"
+	_ "github.com/refraction-networking/water/transport/v1"
+)
+
+func TestNegotiateVersion(t *testing.T) {
+	if versions := water.SupportedVersions(); len(versions) == 0 || versions[len(versions)-1] != "v1" {
+		t.Fatalf("SupportedVersions() = %v, want v1 as the latest", versions)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		bin     []byte
+		want    string
+		wantErr error
+	}{
+		{"undeclared", wasmPlain, "v1", nil},
+		{"declared", withCustomSection(wasmPlain, water.VersionSectionName, []byte("v1")), "v1", nil},
+		{"preferred unsupported", withCustomSection(wasmPlain, water.VersionSectionName, []byte("v9, v1")), "v1", nil},
+		{"none supported", withCustomSection(wasmPlain, water.VersionSectionName, []byte("v8 v9")), "", water.ErrVersionMismatch},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := water.NegotiateVersion(tc.bin)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("NegotiateVersion() error = %v, want %v", err, tc.wantErr)
+			}
+			if got != tc.want {
+				t.Errorf("NegotiateVersion() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+
+	if _, err := water.NegotiateVersion(withCustomSection(wasmPlain, water.VersionSectionName, nil)); err == nil {
+		t.Error("NegotiateVersion must fail if no version is declared in the section")
+	}
+}
+
+func TestNewDialerWithContext_VersionNegotiation(t *testing.T) {
+	newDialer := func(bin []byte) (water.Dialer, error) {
+		return water.NewDialerWithContext(context.Background(), &water.Config{
+			TransportModuleBin:  bin,
+			ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+		})
+	}
+
+	if _, err := newDialer(withCustomSection(wasmPlain, water.VersionSectionName, []byte("v9,v1"))); err != nil {
+		t.Fatalf("NewDialerWithContext() with a supported version declared: %v", err)
+	}
+
+	_, err := newDialer(withCustomSection(wasmPlain, water.VersionSectionName, []byte("v9")))
+	var mismatch *water.VersionMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("NewDialerWithContext() error = %v, want a *VersionMismatchError", err)
+	}
+	if len(mismatch.Declared) != 1 || mismatch.Declared[0] != "v9" {
+		t.Errorf("Declared = %v, want [v9]", mismatch.Declared)
+	}
+
+	// an empty module: magic and version 1
+	_, err = newDialer([]byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00})
+	if !errors.Is(err, water.ErrDialerVersionNotFound) {
+		t.Fatalf("NewDialerWithContext() error = %v, want %v", err, water.ErrDialerVersionNotFound)
+	}
+	if !strings.Contains(err.Error(), "missing export") {
+		t.Errorf("NewDialerWithContext() error = %q, want it to tell the missing exports", err)
+	}
+}
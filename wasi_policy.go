@@ -0,0 +1,57 @@
+package water
+
+import "errors"
+
+var ErrWASIPolicyDenied = errors.New("water: denied by WASI policy")
+
+// WASIPolicy controls which WASI capabilities are granted to the
+// WebAssembly Transport Module.
+//
+// A capability not granted is either withheld entirely or replaced by a
+// deterministic fake provided by the runtime, which allows an untrusted
+// WATM to run with no more access to the host than it needs.
+type WASIPolicy struct {
+	// Clock grants access to the host's wall clock, monotonic clock and
+	// sleep. If not granted, the WATM observes a fake clock.
+	Clock bool
+
+	// Random grants access to the host's cryptographically secure random
+	// source. If not granted, the WATM receives deterministic pseudo-random
+	// bytes which MUST NOT be used for any cryptographic purpose.
+	Random bool
+
+	// Environ grants access to the arguments and environment variables
+	// set via the ModuleConfigFactory, ModuleEnv and ModuleArgv.
+	Environ bool
+
+	// Preopens grants access to the directories preopened via the
+	// ModuleConfigFactory. Regardless of this capability, the
+	// TransportModuleConfig is always available to the WATM.
+	Preopens bool
+
+	// Network grants the WATM the ability to request the host to dial an
+	// address of its choice, which is still subject to the validation by
+	// the DialedAddressValidator in Config. Dialing the address requested
+	// by the caller is not affected by this capability.
+	Network bool
+}
+
+// DefaultWASIPolicy is the minimal WASIPolicy used if none is specified
+// in the Config. It grants clock, random source and networking, but
+// withholds arguments, environment variables and preopened directories
+// unless they are explicitly configured, see Config.WASIPolicyOrDefault.
+var DefaultWASIPolicy = WASIPolicy{
+	Clock:   true,
+	Random:  true,
+	Network: true,
+}
+
+// Clone returns a copy of the WASIPolicy.
+func (p *WASIPolicy) Clone() *WASIPolicy {
+	if p == nil {
+		return nil
+	}
+
+	policy := *p
+	return &policy
+}
@@ -0,0 +1,194 @@
+package water_test
+
+import (
+	"context"
+	_ "embed"
+	"testing"
+	"time"
+
+	"github.com/refraction-networking/water"
+	_ "github.com/refraction-networking/water/transport/v1"
+)
+
+func TestWASIPolicy_Network(t *testing.T) {
+	config := &water.Config{
+		TransportModuleBin: wasmReverse,
+		DialedAddressValidator: func(network, address string) error {
+			return nil // allow all
+		},
+		WASIPolicy: &water.WASIPolicy{
+			Clock:  true,
+			Random: true,
+		},
+	}
+
+	dialer, err := water.NewFixedDialerWithContext(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := dialer.DialFixedContext(context.Background())
+	if err == nil {
+		conn.Close()
+		t.Fatal("DialFixedContext should fail when networking is not granted")
+	}
+}
+
+// wasmWASIPolicy exports realtime, random and prestat, which report the
+// wall clock, 8 bytes from the random source and the errno of
+// fd_prestat_get on the first preopened file descriptor as observed by
+// the WATM.
+//
+//go:embed testdata/wasi_policy.wasm
+var wasmWASIPolicy []byte
+
+// invokeWASIPolicy instantiates wasmWASIPolicy with config and returns the
+// result of invoking the export name.
+func invokeWASIPolicy(t *testing.T, config *water.Config, name string) uint64 {
+	t.Helper()
+
+	core, err := water.NewCoreWithContext(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer core.Close() // skipcq: GO-S2307
+
+	if err := core.WASIPreview1(); err != nil {
+		t.Fatal(err)
+	}
+	if err := core.Instantiate(); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := core.Invoke(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return results[0]
+}
+
+func TestWASIPolicy_Clock(t *testing.T) {
+	t.Run("granted", func(t *testing.T) {
+		before := time.Now()
+		realtime := time.Unix(0, int64(invokeWASIPolicy(t, &water.Config{
+			TransportModuleBin: wasmWASIPolicy,
+		}, "realtime")))
+		if realtime.Before(before.Add(-time.Second)) || realtime.After(time.Now().Add(time.Second)) {
+			t.Errorf("realtime = %v, want around %v", realtime, before)
+		}
+	})
+
+	t.Run("withheld", func(t *testing.T) {
+		// the fake clock of wazero starts at 2022-01-01T00:00:00Z
+		const fakeEpochNanos = 1640995200000000000
+		if realtime := invokeWASIPolicy(t, &water.Config{
+			TransportModuleBin: wasmWASIPolicy,
+			WASIPolicy:         &water.WASIPolicy{},
+		}, "realtime"); realtime != fakeEpochNanos {
+			t.Errorf("realtime = %d, want %d", realtime, uint64(fakeEpochNanos))
+		}
+	})
+}
+
+func TestWASIPolicy_Random(t *testing.T) {
+	t.Run("granted", func(t *testing.T) {
+		config := &water.Config{
+			TransportModuleBin: wasmWASIPolicy,
+		}
+		if a, b := invokeWASIPolicy(t, config, "random"), invokeWASIPolicy(t, config, "random"); a == b {
+			t.Errorf("random = %#x twice, want different bytes from the host", a)
+		}
+	})
+
+	t.Run("withheld", func(t *testing.T) {
+		config := &water.Config{
+			TransportModuleBin: wasmWASIPolicy,
+			WASIPolicy:         &water.WASIPolicy{},
+		}
+		if a, b := invokeWASIPolicy(t, config, "random"), invokeWASIPolicy(t, config, "random"); a != b {
+			t.Errorf("random = %#x then %#x, want the same deterministic bytes", a, b)
+		}
+	})
+}
+
+func TestWASIPolicy_Environ(t *testing.T) {
+	argvConfigured := &water.Config{
+		TransportModuleBin:  wasmEnviron,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+	}
+	argvConfigured.ModuleConfigFactory.SetArgv([]string{"watm"})                        // "watm\x00" is 5 bytes
+	argvConfigured.ModuleConfigFactory.SetEnv([]string{"SNI"}, []string{"example.com"}) // "SNI=example.com\x00" is 16 bytes
+
+	for _, tc := range []struct {
+		name   string
+		ctx    context.Context
+		config *water.Config
+		argc   uint64
+		envc   uint64
+	}{
+		{
+			name:   "ModuleConfigFactory",
+			ctx:    context.Background(),
+			config: argvConfigured,
+			argc:   1,
+			envc:   1,
+		},
+		{
+			name: "ModuleArgv",
+			ctx:  context.Background(),
+			config: &water.Config{
+				TransportModuleBin: wasmEnviron,
+				ModuleArgv:         []string{"watm"},
+			},
+			argc: 1,
+		},
+		{
+			name: "WithModuleEnv",
+			ctx:  water.WithModuleEnv(context.Background(), map[string]string{"SNI": "example.com"}),
+			config: &water.Config{
+				TransportModuleBin: wasmEnviron,
+			},
+			envc: 1,
+		},
+		{
+			name: "withheld by policy",
+			ctx:  context.Background(),
+			config: func() *water.Config {
+				config := argvConfigured.Clone()
+				config.WASIPolicy = &water.WASIPolicy{}
+				return config
+			}(),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			argc, _, envc, _ := environSizes(t, tc.ctx, tc.config)
+			if argc != tc.argc || envc != tc.envc {
+				t.Errorf("argc, envc = %d, %d, want %d, %d", argc, envc, tc.argc, tc.envc)
+			}
+		})
+	}
+}
+
+func TestWASIPolicy_Preopens(t *testing.T) {
+	const errnoBadf = 8 // EBADF
+
+	config := &water.Config{
+		TransportModuleBin:  wasmWASIPolicy,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+	}
+	config.ModuleConfigFactory.SetPreopenDir(t.TempDir(), "/data")
+
+	t.Run("granted", func(t *testing.T) {
+		if errno := invokeWASIPolicy(t, config, "prestat"); errno != 0 {
+			t.Errorf("fd_prestat_get = %d, want 0", errno)
+		}
+	})
+
+	t.Run("withheld", func(t *testing.T) {
+		withheld := config.Clone()
+		withheld.WASIPolicy = &water.WASIPolicy{}
+		if errno := invokeWASIPolicy(t, withheld, "prestat"); errno != errnoBadf {
+			t.Errorf("fd_prestat_get = %d, want %d", errno, errnoBadf)
+		}
+	})
+}
@@ -0,0 +1,186 @@
+package water
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+
+	"github.com/refraction-networking/water/internal/log"
+)
+
+// WatchedConfig keeps a Config whose WebAssembly Transport Module binary
+// is reloaded from a file whenever the file changes, or on a signal, e.g.,
+// SIGHUP. It is meant for long-running listeners and relays whose WATM is
+// updated by a separate deployment pipeline, swapping the new WATM in for
+// new connections only:
+//
+//	wc, _ := water.NewWatchedConfig(config, "/etc/water/transport.wasm")
+//	lis, _ := wc.Config().ListenContext(ctx, "tcp", ":443")
+//	wc.OnReload = lis.UpdateConfig
+//	go wc.Watch(ctx)
+//
+// The file is checked by polling its size and modification time, so it
+// should be replaced atomically, e.g., by renaming a file written next to
+// it. A binary which cannot be compiled, e.g., one partially written, is
+// rejected and the current Config is kept.
+type WatchedConfig struct {
+	// PollInterval optionally sets how often the file is checked for
+	// changes. If this field is unset, it defaults to 5 seconds. A
+	// negative PollInterval disables polling, leaving the reload to the
+	// Signals and to calls to Reload.
+	PollInterval time.Duration
+
+	// Signals optionally lists the signals upon which the file is
+	// reloaded by Watch, e.g., syscall.SIGHUP.
+	Signals []os.Signal
+
+	// OnReload is optionally called with the Config reloaded before it
+	// replaces the current one, e.g., the UpdateConfig method of a
+	// Listener. If it returns an error, the current Config is kept.
+	OnReload func(*Config) error
+
+	// OnError is optionally called with each error reloading the file
+	// while watching it. If this field is unset, the errors are logged.
+	OnError func(error)
+
+	path string
+	base *Config
+
+	mu      sync.Mutex
+	current *Config
+	digest  [sha256.Size]byte
+	size    int64
+	modTime time.Time
+}
+
+const defaultWatchedConfigPollInterval = 5 * time.Second
+
+// NewWatchedConfig creates a WatchedConfig from a copy of config, with its
+// TransportModuleBin loaded from the file at path.
+func NewWatchedConfig(config *Config, path string) (*WatchedConfig, error) {
+	if config == nil {
+		return nil, errors.New("water: config is nil")
+	}
+
+	w := &WatchedConfig{
+		path: path,
+		base: config.Clone(),
+	}
+
+	if err := w.Reload(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Config returns a copy of the current Config.
+func (w *WatchedConfig) Config() *Config {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.current.Clone()
+}
+
+// Reload reloads the file, replacing the current Config if the binary has
+// changed and OnReload, if set, accepts it.
+func (w *WatchedConfig) Reload() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.reload()
+}
+
+func (w *WatchedConfig) reload() error {
+	info, err := os.Stat(w.path)
+	if err != nil {
+		return fmt.Errorf("water: reloading transport module: %w", err)
+	}
+
+	bin, err := os.ReadFile(w.path)
+	if err != nil {
+		return fmt.Errorf("water: reloading transport module: %w", err)
+	}
+	w.size, w.modTime = info.Size(), info.ModTime()
+
+	digest := sha256.Sum256(bin)
+	if w.current != nil && bytes.Equal(digest[:], w.digest[:]) {
+		return nil
+	}
+
+	if _, err := ValidateTransportModule(bin); err != nil {
+		return fmt.Errorf("water: reloading transport module from %s: %w", w.path, err)
+	}
+
+	config := w.base.Clone()
+	config.TransportModuleBin = bin
+
+	if w.current != nil && w.OnReload != nil {
+		if err := w.OnReload(config.Clone()); err != nil {
+			return fmt.Errorf("water: reloading transport module from %s: %w", w.path, err)
+		}
+	}
+
+	w.current, w.digest = config, digest
+	return nil
+}
+
+// changed reports whether the size or the modification time of the file
+// differs from when it was last reloaded.
+func (w *WatchedConfig) changed() bool {
+	info, err := os.Stat(w.path)
+	if err != nil {
+		return false // reported once the file is reloaded
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return info.Size() != w.size || !info.ModTime().Equal(w.modTime)
+}
+
+// Watch reloads the file whenever it changes or any of the Signals is
+// received, until ctx is done, upon which it returns ctx.Err().
+func (w *WatchedConfig) Watch(ctx context.Context) error {
+	signals := make(chan os.Signal, 1)
+	if len(w.Signals) > 0 {
+		signal.Notify(signals, w.Signals...)
+		defer signal.Stop(signals)
+	}
+
+	var poll <-chan time.Time
+	if w.PollInterval >= 0 {
+		interval := w.PollInterval
+		if interval == 0 {
+			interval = defaultWatchedConfigPollInterval
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-poll:
+			if !w.changed() {
+				continue
+			}
+		case <-signals:
+		}
+
+		if err := w.Reload(); err != nil {
+			if w.OnError != nil {
+				w.OnError(err)
+			} else {
+				log.LErrorf(w.base.Logger(), "%v", err)
+			}
+		}
+	}
+}
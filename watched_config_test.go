@@ -0,0 +1,121 @@
+package water_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/refraction-networking/water"
+)
+
+func TestWatchedConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "transport.wasm")
+	replace := func(bin []byte) {
+		t.Helper()
+
+		tmp := filepath.Join(dir, "transport.wasm.tmp")
+		if err := os.WriteFile(tmp, bin, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	replace(wasmPlain)
+
+	wc, err := water.NewWatchedConfig(&water.Config{
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+	}, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wc.PollInterval = 10 * time.Millisecond
+
+	lis, err := wc.Config().ListenContext(context.Background(), "tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close() // skipcq: GO-S2307
+
+	reloaded := make(chan *water.Config, 1)
+	wc.OnReload = func(c *water.Config) error {
+		if err := lis.UpdateConfig(c); err != nil {
+			return err
+		}
+		reloaded <- c
+		return nil
+	}
+
+	echo := func(msg string) string {
+		t.Helper()
+
+		peerConn, err := net.Dial("tcp", lis.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer peerConn.Close() // skipcq: GO-S2307
+
+		conn, err := lis.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close() // skipcq: GO-S2307
+
+		if _, err = peerConn.Write([]byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+		if err = conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, len(msg))
+		if _, err = io.ReadFull(conn, buf); err != nil {
+			t.Fatal(err)
+		}
+		return string(buf)
+	}
+
+	if got := echo("hello"); got != "hello" {
+		t.Fatalf("read %q before reload, want %q", got, "hello")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	watchErr := make(chan error, 1)
+	go func() { watchErr <- wc.Watch(ctx) }()
+
+	replace(wasmReverse)
+	select {
+	case c := <-reloaded:
+		if !bytes.Equal(c.TransportModuleBin, wasmReverse) {
+			t.Fatal("reloaded Config must have the new binary")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the reload")
+	}
+
+	if got := echo("hello"); got != "olleh" {
+		t.Fatalf("read %q after reload, want %q", got, "olleh")
+	}
+
+	// a binary which cannot be compiled must be rejected
+	if err = os.WriteFile(path, []byte("not a wasm"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err = wc.Reload(); err == nil {
+		t.Fatal("Reload must fail with an invalid binary")
+	}
+	if !bytes.Equal(wc.Config().TransportModuleBin, wasmReverse) {
+		t.Fatal("Config must be kept after a failed reload")
+	}
+
+	cancel()
+	if err = <-watchErr; err != context.Canceled {
+		t.Fatalf("Watch returned %v, want %v", err, context.Canceled)
+	}
+}
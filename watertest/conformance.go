@@ -0,0 +1,151 @@
+package watertest
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/refraction-networking/water"
+)
+
+// conformanceTimeout bounds each conformance test.
+const conformanceTimeout = 10 * time.Second
+
+// RunConformance runs a suite of tests checking that the WATM in the Config
+// behaves like a well-formed transport when dialing to a peer running the
+// same Config: it must conform to a registered ABI version, echo data
+// intact in both directions, serve concurrent connections, and honor
+// Close and read deadlines.
+//
+// Tests for a role the WATM is unable to play are skipped. Authors of a
+// WATM may run the suite from their own tests, with the drivers of the
+// versions they target imported:
+//
+//	func TestConformance(t *testing.T) {
+//		watertest.RunConformance(t, &water.Config{TransportModuleBin: wasm})
+//	}
+func RunConformance(t *testing.T, config *water.Config) {
+	report, err := water.ValidateTransportModule(config.WATMBinOrPanic())
+	if err != nil {
+		t.Fatalf("water.ValidateTransportModule: %v", err)
+	}
+
+	t.Run("Validate", func(t *testing.T) {
+		if !report.OK() {
+			t.Errorf("WATM does not conform to a registered version: %v", report.Problems)
+		}
+	})
+
+	for _, peer := range []water.Role{water.RoleListener, water.RoleRelay} {
+		peer := peer
+		t.Run(peer.String(), func(t *testing.T) {
+			if !report.Supports(water.RoleDialer) || !report.Supports(peer) {
+				t.Skipf("WATM is unable to play both the dialer and the %s role", peer)
+			}
+			runConformanceWithPeer(t, config, peer)
+		})
+	}
+}
+
+func runConformanceWithPeer(t *testing.T, config *water.Config, peer water.Role) {
+	ctx, cancel := context.WithTimeout(context.Background(), conformanceTimeout)
+	defer cancel()
+
+	peers, err := NewPeers(ctx, config, peer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peers.Close()
+
+	dial := peers.DialListener
+	if peer == water.RoleRelay {
+		dial = peers.DialRelay
+	}
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		for _, size := range []int{1, 1024, 65536} {
+			if err := roundTrip(ctx, dial, size); err != nil {
+				t.Fatalf("payload of %d bytes: %v", size, err)
+			}
+		}
+	})
+
+	t.Run("Bidirectional", func(t *testing.T) {
+		conn, err := dial(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		if _, err := MeasureThroughput(ctx, conn, 4<<20); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("Concurrent", func(t *testing.T) {
+		const conns = 8
+
+		var wg sync.WaitGroup
+		errs := make([]error, conns)
+		for i := 0; i < conns; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				errs[i] = roundTrip(ctx, dial, 4096)
+			}(i)
+		}
+		wg.Wait()
+
+		if err := errors.Join(errs...); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("Close", func(t *testing.T) {
+		conn, err := dial(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := roundTrip(ctx, func(context.Context) (net.Conn, error) { return nopCloseConn{conn}, nil }, 16); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := conn.Close(); err != nil {
+			t.Fatalf("Close: %v", err)
+		}
+
+		if _, err := conn.Write([]byte("after close")); err == nil {
+			t.Error("Write after Close must fail")
+		}
+	})
+
+	t.Run("ReadDeadline", func(t *testing.T) {
+		conn, err := dial(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		if err := conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond)); err != nil {
+			t.Fatalf("SetReadDeadline: %v", err)
+		}
+
+		// nothing is written, so nothing is to be echoed back
+		var netErr net.Error
+		if _, err := conn.Read(make([]byte, 16)); !errors.As(err, &netErr) || !netErr.Timeout() {
+			t.Fatalf("Read past the deadline must fail with a timeout, got %v", err)
+		}
+	})
+}
+
+// nopCloseConn is a net.Conn whose Close does nothing.
+type nopCloseConn struct {
+	net.Conn
+}
+
+// Close implements net.Conn.
+func (nopCloseConn) Close() error { return nil }
@@ -0,0 +1,30 @@
+package watertest_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/refraction-networking/water"
+	_ "github.com/refraction-networking/water/transport/v0"
+	"github.com/refraction-networking/water/watertest"
+)
+
+func TestRunConformance(t *testing.T) {
+	for name, watm := range map[string]string{
+		"v0_plain": "../transport/v0/testdata/plain.wasm",
+		"v1_plain": "../transport/v1/testdata/plain.wasm",
+	} {
+		watm := watm
+		t.Run(name, func(t *testing.T) {
+			wasm, err := os.ReadFile(watm)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			watertest.RunConformance(t, &water.Config{
+				TransportModuleBin:  wasm,
+				ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+			})
+		})
+	}
+}
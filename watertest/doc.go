@@ -0,0 +1,12 @@
+// Package watertest provides utilities for testing WebAssembly Transport
+// Modules and the applications built with WATER:
+//   - echo servers and [Peers] running a Config in the listener and relay
+//     roles, for a Dialer to connect to;
+//   - throughput and round-trip latency measurement against any Config,
+//     also available as benchmark helpers;
+//   - a conformance test suite third-party WATM authors may run, see
+//     [RunConformance];
+//   - a long-running soak test harness tracking resource leaks, see [Soak];
+//   - network failures (resets, short reads, slow writes) injected into the
+//     connections of a WATM under test, see [InjectFaults].
+package watertest
@@ -0,0 +1,37 @@
+package watertest
+
+import (
+	"io"
+	"net"
+)
+
+// ListenEcho listens on the local network address with a plain net.Listener
+// and echoes everything read back on each connection accepted, until the
+// returned listener is closed. It is used as the destination of a relay
+// or of a dialer under test.
+func ListenEcho(network, address string) (net.Listener, error) {
+	lis, err := net.Listen(network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	go ServeEcho(lis) // skipcq: GO-S2307
+	return lis, nil
+}
+
+// ServeEcho accepts connections from lis, e.g., a water.Listener, and
+// echoes everything read back on each of them. It blocks until lis is
+// closed and returns the error returned by Accept.
+func ServeEcho(lis net.Listener) error {
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			return err
+		}
+
+		go func(conn net.Conn) {
+			defer conn.Close()  // skipcq: GO-S2307
+			io.Copy(conn, conn) // skipcq: GO-S2307
+		}(conn)
+	}
+}
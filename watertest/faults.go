@@ -0,0 +1,237 @@
+package watertest
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/refraction-networking/water"
+	"github.com/refraction-networking/water/internal/socket"
+)
+
+// defaultReadChunkDelay separates the chunks of short reads, so that they
+// are not coalesced by the socket before the WATM reads them.
+const defaultReadChunkDelay = time.Millisecond
+
+// Faults are the network failures injected into the connections a WATM
+// reads from and writes to the network, so that WATM authors can verify
+// the WATM handles them, e.g., by reporting an error instead of hanging.
+//
+// The faults are deterministic: they are triggered by the number of bytes
+// transferred, not by timing.
+type Faults struct {
+	// ResetAfterRead resets the connection, i.e., the WATM gets
+	// ECONNRESET, once the WATM has been delivered this many bytes from
+	// the network. Zero disables it.
+	ResetAfterRead int64
+
+	// ResetAfterWrite resets the connection once the WATM has written
+	// this many bytes to the network. Zero disables it.
+	ResetAfterWrite int64
+
+	// ReadChunkSize delivers the data from the network to the WATM in
+	// chunks of at most this many bytes, separated by ReadChunkDelay, so
+	// that the WATM gets short reads. Zero disables it.
+	ReadChunkSize int
+
+	// ReadChunkDelay is the delay between the chunks of ReadChunkSize.
+	// If this field is unset, it defaults to 1 millisecond.
+	ReadChunkDelay time.Duration
+
+	// WriteDelay delays each write of the WATM before it reaches the
+	// network, so that the network appears slow. Once the socket buffers
+	// fill up, the writes of the WATM block. Zero disables it.
+	WriteDelay time.Duration
+}
+
+// InjectFaults returns a clone of the Config whose network connections,
+// dialed with its NetworkDialerFunc (or net.Dial if unset) or accepted
+// from its NetworkListener, are wrapped with NewFaultyConn before the
+// other options of the Config, e.g., the TCPOptions, apply to them.
+//
+// To inject faults into a water.Listener, the NetworkListener is to be set
+// before, e.g., with config.ListenNetwork, as ListenContext creates its
+// own.
+func InjectFaults(config *water.Config, faults Faults) *water.Config {
+	clone := config.Clone()
+
+	dialerFunc := clone.NetworkDialerFunc
+	if dialerFunc == nil {
+		dialerFunc = (&net.Dialer{Control: clone.TCPOptions.Control}).Dial
+	}
+	clone.NetworkDialerFunc = func(network, address string) (net.Conn, error) {
+		conn, err := dialerFunc(network, address)
+		if err != nil {
+			return nil, err
+		}
+		return NewFaultyConn(conn, faults)
+	}
+
+	if clone.NetworkListener != nil {
+		clone.NetworkListener = &faultyListener{Listener: clone.NetworkListener, faults: faults}
+	}
+
+	return clone
+}
+
+// NewFaultyConn returns a TCP connection on the loopback interface to be
+// read from and written to by a WATM in place of conn, forwarding the data
+// to and from conn with the Faults injected. Closing it shuts down the
+// writing side of conn, which is closed once the data in both directions
+// is forwarded or either fails.
+func NewFaultyConn(conn net.Conn, faults Faults) (*net.TCPConn, error) {
+	watmConn, proxyConn, err := socket.TCPConnPair()
+	if err != nil {
+		return nil, err
+	}
+
+	if faults.ReadChunkSize > 0 && faults.ReadChunkDelay <= 0 {
+		faults.ReadChunkDelay = defaultReadChunkDelay
+	}
+
+	fc := &faultyConn{conn: conn, proxyConn: proxyConn, faults: faults}
+	fc.wg.Add(2)
+	go fc.forwardReads()
+	go fc.forwardWrites()
+	go func() {
+		fc.wg.Wait()
+		fc.close()
+	}()
+
+	return watmConn, nil
+}
+
+type faultyConn struct {
+	conn      net.Conn     // the network connection
+	proxyConn *net.TCPConn // the peer of the connection of the WATM
+	faults    Faults
+
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+}
+
+// forwardReads forwards the data from the network to the WATM.
+func (fc *faultyConn) forwardReads() {
+	defer fc.wg.Done()
+
+	buf := make([]byte, 32<<10)
+	var delivered int64
+	for {
+		n, err := fc.conn.Read(buf)
+		data := buf[:n]
+
+		reset := false
+		if limit := fc.faults.ResetAfterRead; limit > 0 && delivered+int64(len(data)) >= limit {
+			data, reset = data[:limit-delivered], true
+		}
+
+		for len(data) > 0 {
+			chunk := data
+			if size := fc.faults.ReadChunkSize; size > 0 && len(chunk) > size {
+				chunk = chunk[:size]
+			}
+			if _, werr := fc.proxyConn.Write(chunk); werr != nil {
+				fc.close()
+				return
+			}
+			delivered += int64(len(chunk))
+			data = data[len(chunk):]
+			if fc.faults.ReadChunkSize > 0 {
+				time.Sleep(fc.faults.ReadChunkDelay)
+			}
+		}
+
+		if reset {
+			fc.reset()
+			return
+		}
+
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				fc.proxyConn.CloseWrite() // skipcq: GO-S2307
+			} else {
+				fc.close()
+			}
+			return
+		}
+	}
+}
+
+// forwardWrites forwards the data from the WATM to the network.
+func (fc *faultyConn) forwardWrites() {
+	defer fc.wg.Done()
+
+	buf := make([]byte, 32<<10)
+	var written int64
+	for {
+		n, err := fc.proxyConn.Read(buf)
+		data := buf[:n]
+
+		reset := false
+		if limit := fc.faults.ResetAfterWrite; limit > 0 && written+int64(len(data)) >= limit {
+			data, reset = data[:limit-written], true
+		}
+
+		if len(data) > 0 {
+			if fc.faults.WriteDelay > 0 {
+				time.Sleep(fc.faults.WriteDelay)
+			}
+			if _, werr := fc.conn.Write(data); werr != nil {
+				fc.close()
+				return
+			}
+			written += int64(len(data))
+		}
+
+		if reset {
+			fc.reset()
+			return
+		}
+
+		if err != nil {
+			if cw, ok := fc.conn.(interface{ CloseWrite() error }); ok && errors.Is(err, io.EOF) {
+				cw.CloseWrite() // skipcq: GO-S2307
+			} else {
+				fc.close()
+			}
+			return
+		}
+	}
+}
+
+// reset aborts the connection of the WATM with a TCP RST, and closes the
+// network connection.
+func (fc *faultyConn) reset() {
+	fc.proxyConn.SetLinger(0) // skipcq: GO-S2307
+	fc.close()
+}
+
+func (fc *faultyConn) close() {
+	fc.closeOnce.Do(func() {
+		fc.proxyConn.Close() // skipcq: GO-S2307
+		fc.conn.Close()      // skipcq: GO-S2307
+	})
+}
+
+// faultyListener wraps the connections accepted with NewFaultyConn.
+type faultyListener struct {
+	net.Listener
+	faults Faults
+}
+
+// Accept implements net.Listener.
+func (l *faultyListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	faulty, err := NewFaultyConn(conn, l.faults)
+	if err != nil {
+		conn.Close() // skipcq: GO-S2307
+		return nil, err
+	}
+	return faulty, nil
+}
@@ -0,0 +1,106 @@
+package watertest_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/refraction-networking/water"
+	"github.com/refraction-networking/water/watertest"
+)
+
+func TestInjectFaults(t *testing.T) {
+	wasm, err := os.ReadFile("../transport/v1/testdata/plain.wasm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &water.Config{
+		TransportModuleBin:  wasm,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+	}
+
+	dial := func(t *testing.T, faults watertest.Faults) net.Conn {
+		echo, err := watertest.ListenEcho("tcp", "localhost:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { echo.Close() })
+
+		dialer, err := water.NewDialerWithContext(context.Background(), watertest.InjectFaults(config, faults))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		conn, err := dialer.DialContext(context.Background(), "tcp", echo.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		return conn
+	}
+
+	t.Run("short reads", func(t *testing.T) {
+		conn := dial(t, watertest.Faults{ReadChunkSize: 7})
+
+		msg := make([]byte, 1024)
+		rand.Read(msg) // skipcq: GSC-G104
+		if _, err := conn.Write(msg); err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, len(msg))
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf, msg) {
+			t.Error("data read differs from data written")
+		}
+	})
+
+	t.Run("slow writes", func(t *testing.T) {
+		const delay = 50 * time.Millisecond
+		conn := dial(t, watertest.Faults{WriteDelay: delay})
+
+		start := time.Now()
+		if _, err := conn.Write([]byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.ReadFull(conn, make([]byte, 5)); err != nil {
+			t.Fatal(err)
+		}
+		if elapsed := time.Since(start); elapsed < delay {
+			t.Errorf("round trip took %v, want at least %v", elapsed, delay)
+		}
+	})
+
+	for _, tc := range []struct {
+		name   string
+		faults watertest.Faults
+	}{
+		{"reset mid-read", watertest.Faults{ResetAfterRead: 100}},
+		{"reset mid-write", watertest.Faults{ResetAfterWrite: 100}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			conn := dial(t, tc.faults)
+			if err := conn.SetDeadline(time.Now().Add(5 * time.Second)); err != nil {
+				t.Fatal(err)
+			}
+
+			// the connection must fail before all data is echoed back
+			go conn.Write(make([]byte, 64<<10)) // skipcq: GO-S2307
+			n, err := io.Copy(io.Discard, conn)
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				t.Fatal("the WATM hangs on a reset connection")
+			}
+			if n > 100 {
+				t.Errorf("read %d bytes, want at most 100", n)
+			}
+		})
+	}
+}
@@ -0,0 +1,281 @@
+package watertest
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/refraction-networking/water"
+)
+
+const (
+	// throughputChunkSize is the size of each write by MeasureThroughput.
+	throughputChunkSize = 32 * 1024
+
+	// throughputWindow is the maximum number of chunks written but not yet
+	// echoed back by MeasureThroughput.
+	throughputWindow = 8
+)
+
+// Throughput is the result of [MeasureThroughput].
+type Throughput struct {
+	// Bytes is the number of bytes transferred in each direction.
+	Bytes int64
+
+	// Elapsed is the time from the first write to the last byte echoed
+	// back.
+	Elapsed time.Duration
+}
+
+// BytesPerSecond returns the throughput in each direction.
+func (t Throughput) BytesPerSecond() float64 {
+	if t.Elapsed <= 0 {
+		return 0
+	}
+	return float64(t.Bytes) / t.Elapsed.Seconds()
+}
+
+// String implements fmt.Stringer.
+func (t Throughput) String() string {
+	return fmt.Sprintf("%d bytes in %v (%.2f MiB/s)", t.Bytes, t.Elapsed, t.BytesPerSecond()/(1<<20))
+}
+
+// MeasureThroughput writes size bytes to conn, which must be connected to
+// an echo server, while concurrently reading them back, so data flows in
+// both directions at the same time. At most 256 KiB are in flight at any
+// time. The data echoed back is verified.
+//
+// If ctx has a deadline, it is set on conn.
+func MeasureThroughput(ctx context.Context, conn net.Conn, size int64) (Throughput, error) {
+	if err := setDeadlineFromContext(ctx, conn); err != nil {
+		return Throughput{}, err
+	}
+
+	chunk := make([]byte, throughputChunkSize)
+	if _, err := rand.Read(chunk); err != nil {
+		return Throughput{}, err
+	}
+
+	start := time.Now()
+
+	window := make(chan struct{}, throughputWindow)
+	defer close(window)
+
+	writeErr := make(chan error, 1)
+	go func() {
+		for written := int64(0); written < size; {
+			if _, ok := <-window; !ok {
+				writeErr <- nil // reading failed
+				return
+			}
+
+			n := int64(len(chunk))
+			if size-written < n {
+				n = size - written
+			}
+			if _, err := conn.Write(chunk[:n]); err != nil {
+				writeErr <- err
+				return
+			}
+			written += n
+		}
+		writeErr <- nil
+	}()
+
+	for i := 0; i < throughputWindow; i++ {
+		window <- struct{}{}
+	}
+
+	echoed := make([]byte, len(chunk))
+	for read := int64(0); read < size; {
+		n := int64(len(echoed))
+		if size-read < n {
+			n = size - read
+		}
+		if _, err := io.ReadFull(conn, echoed[:n]); err != nil {
+			return Throughput{Bytes: read, Elapsed: time.Since(start)}, err
+		}
+		// writes are never split across chunks, so the echoed data is
+		// always aligned with the chunk
+		if !bytes.Equal(echoed[:n], chunk[:n]) {
+			return Throughput{Bytes: read, Elapsed: time.Since(start)}, errors.New("watertest: echoed data mismatch")
+		}
+		read += n
+
+		if read%throughputChunkSize == 0 {
+			window <- struct{}{}
+		}
+	}
+
+	elapsed := time.Since(start)
+	if err := <-writeErr; err != nil {
+		return Throughput{Bytes: size, Elapsed: elapsed}, err
+	}
+
+	return Throughput{Bytes: size, Elapsed: elapsed}, nil
+}
+
+// Latency is the result of [MeasureLatency].
+type Latency struct {
+	// Samples are the round-trip times measured, in chronological order.
+	Samples []time.Duration
+}
+
+// Min returns the shortest round-trip time.
+func (l Latency) Min() time.Duration {
+	return l.Percentile(0)
+}
+
+// Max returns the longest round-trip time.
+func (l Latency) Max() time.Duration {
+	return l.Percentile(100)
+}
+
+// Mean returns the average round-trip time.
+func (l Latency) Mean() time.Duration {
+	if len(l.Samples) == 0 {
+		return 0
+	}
+
+	var sum time.Duration
+	for _, sample := range l.Samples {
+		sum += sample
+	}
+	return sum / time.Duration(len(l.Samples))
+}
+
+// Percentile returns the p-th percentile (0 <= p <= 100) of the round-trip
+// times using the nearest-rank method.
+func (l Latency) Percentile(p float64) time.Duration {
+	if len(l.Samples) == 0 {
+		return 0
+	}
+
+	sorted := make([]time.Duration, len(l.Samples))
+	copy(sorted, l.Samples)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	rank := int(p / 100 * float64(len(sorted)))
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	} else if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
+
+// String implements fmt.Stringer.
+func (l Latency) String() string {
+	return fmt.Sprintf("%d samples: min=%v mean=%v p99=%v max=%v", len(l.Samples), l.Min(), l.Mean(), l.Percentile(99), l.Max())
+}
+
+// MeasureLatency writes a payload of payloadSize bytes to conn, which must
+// be connected to an echo server, and waits for it to be echoed back,
+// count times in a row, measuring each round trip. The data echoed back is
+// verified.
+//
+// If ctx has a deadline, it is set on conn.
+func MeasureLatency(ctx context.Context, conn net.Conn, count, payloadSize int) (Latency, error) {
+	if err := setDeadlineFromContext(ctx, conn); err != nil {
+		return Latency{}, err
+	}
+
+	payload := make([]byte, payloadSize)
+	if _, err := rand.Read(payload); err != nil {
+		return Latency{}, err
+	}
+	echoed := make([]byte, payloadSize)
+
+	latency := Latency{Samples: make([]time.Duration, 0, count)}
+	for i := 0; i < count; i++ {
+		start := time.Now()
+		if _, err := conn.Write(payload); err != nil {
+			return latency, err
+		}
+		if _, err := io.ReadFull(conn, echoed); err != nil {
+			return latency, err
+		}
+		latency.Samples = append(latency.Samples, time.Since(start))
+
+		if !bytes.Equal(payload, echoed) {
+			return latency, errors.New("watertest: echoed data mismatch")
+		}
+	}
+
+	return latency, nil
+}
+
+// BenchmarkThroughput benchmarks the throughput of a connection dialed
+// with the Config to a peer of the given role (RoleListener or RoleRelay)
+// running the same Config, with data flowing in both directions.
+func BenchmarkThroughput(b *testing.B, config *water.Config, peer water.Role) {
+	conn, cleanup := benchmarkConn(b, config, peer)
+	defer cleanup()
+
+	b.SetBytes(throughputChunkSize)
+	b.ResetTimer()
+	if _, err := MeasureThroughput(context.Background(), conn, int64(b.N)*throughputChunkSize); err != nil {
+		b.Fatal(err)
+	}
+	b.StopTimer()
+}
+
+// BenchmarkLatency benchmarks the round-trip time of a 64-byte payload
+// over a connection dialed with the Config to a peer of the given role
+// (RoleListener or RoleRelay) running the same Config. The median and
+// 99th percentile are reported as additional metrics.
+func BenchmarkLatency(b *testing.B, config *water.Config, peer water.Role) {
+	conn, cleanup := benchmarkConn(b, config, peer)
+	defer cleanup()
+
+	b.ResetTimer()
+	latency, err := MeasureLatency(context.Background(), conn, b.N, 64)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.StopTimer()
+
+	b.ReportMetric(float64(latency.Percentile(50).Nanoseconds()), "p50-ns")
+	b.ReportMetric(float64(latency.Percentile(99).Nanoseconds()), "p99-ns")
+}
+
+func benchmarkConn(b *testing.B, config *water.Config, peer water.Role) (net.Conn, func()) {
+	b.Helper()
+
+	ctx := context.Background()
+	peers, err := NewPeers(ctx, config, peer)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	var conn net.Conn
+	switch peer {
+	case water.RoleRelay:
+		conn, err = peers.DialRelay(ctx)
+	default:
+		conn, err = peers.DialListener(ctx)
+	}
+	if err != nil {
+		peers.Close()
+		b.Fatal(err)
+	}
+
+	return conn, func() {
+		conn.Close()
+		peers.Close()
+	}
+}
+
+func setDeadlineFromContext(ctx context.Context, conn net.Conn) error {
+	if deadline, ok := ctx.Deadline(); ok {
+		return conn.SetDeadline(deadline)
+	}
+	return nil
+}
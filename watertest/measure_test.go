@@ -0,0 +1,118 @@
+package watertest_test
+
+import (
+	"context"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/refraction-networking/water"
+	"github.com/refraction-networking/water/watertest"
+)
+
+func TestMeasureThroughput(t *testing.T) {
+	echo, err := watertest.ListenEcho("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer echo.Close()
+
+	conn, err := net.Dial("tcp", echo.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// not a multiple of the chunk size, on purpose
+	const size = 1<<20 + 123
+	throughput, err := watertest.MeasureThroughput(ctx, conn, size)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if throughput.Bytes != size {
+		t.Errorf("Bytes = %d, want %d", throughput.Bytes, size)
+	}
+	if throughput.BytesPerSecond() <= 0 {
+		t.Errorf("BytesPerSecond = %f, want > 0", throughput.BytesPerSecond())
+	}
+}
+
+func TestMeasureLatency(t *testing.T) {
+	echo, err := watertest.ListenEcho("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer echo.Close()
+
+	conn, err := net.Dial("tcp", echo.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	latency, err := watertest.MeasureLatency(context.Background(), conn, 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(latency.Samples) != 10 {
+		t.Fatalf("got %d samples, want 10", len(latency.Samples))
+	}
+	if latency.Min() > latency.Mean() || latency.Mean() > latency.Max() {
+		t.Errorf("inconsistent latency: %s", latency)
+	}
+}
+
+func TestLatencyPercentile(t *testing.T) {
+	var latency watertest.Latency
+	for i := 100; i > 0; i-- { // unsorted on purpose
+		latency.Samples = append(latency.Samples, time.Duration(i)*time.Millisecond)
+	}
+
+	for _, tc := range []struct {
+		p    float64
+		want time.Duration
+	}{
+		{0, 1 * time.Millisecond},
+		{50, 51 * time.Millisecond},
+		{99, 100 * time.Millisecond},
+		{100, 100 * time.Millisecond},
+	} {
+		if got := latency.Percentile(tc.p); got != tc.want {
+			t.Errorf("Percentile(%v) = %v, want %v", tc.p, got, tc.want)
+		}
+	}
+
+	if got := latency.Mean(); got != 50500*time.Microsecond {
+		t.Errorf("Mean() = %v, want 50.5ms", got)
+	}
+}
+
+func BenchmarkThroughput(b *testing.B) {
+	config := benchmarkConfig(b)
+	b.Run("listener", func(b *testing.B) { watertest.BenchmarkThroughput(b, config, water.RoleListener) })
+	b.Run("relay", func(b *testing.B) { watertest.BenchmarkThroughput(b, config, water.RoleRelay) })
+}
+
+func BenchmarkLatency(b *testing.B) {
+	config := benchmarkConfig(b)
+	b.Run("listener", func(b *testing.B) { watertest.BenchmarkLatency(b, config, water.RoleListener) })
+	b.Run("relay", func(b *testing.B) { watertest.BenchmarkLatency(b, config, water.RoleRelay) })
+}
+
+func benchmarkConfig(b *testing.B) *water.Config {
+	wasm, err := os.ReadFile("../transport/v1/testdata/plain.wasm")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	return &water.Config{
+		TransportModuleBin:  wasm,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+	}
+}
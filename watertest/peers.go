@@ -0,0 +1,117 @@
+package watertest
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/refraction-networking/water"
+)
+
+// Peers is a set of endpoints running the same Config, with an echo server
+// behind each of them, for a water.Dialer to connect to.
+type Peers struct {
+	// Dialer is the water.Dialer used to connect to the other peers.
+	Dialer water.Dialer
+
+	// Listener is a water.Listener echoing everything it reads back, or
+	// nil if the listener role was not requested.
+	Listener water.Listener
+
+	// Relay is a water.Relay relaying to Echo, or nil if the relay role
+	// was not requested.
+	Relay water.Relay
+
+	// RelayListener is the plain net.Listener the Relay accepts from.
+	RelayListener net.Listener
+
+	// Echo is the plain echo server the Relay relays to.
+	Echo net.Listener
+}
+
+// NewPeers sets up a Dialer and, for each role requested, the peer it
+// connects to on the loopback interface. Only RoleListener and RoleRelay
+// may be requested.
+//
+// The Config is cloned for each endpoint, so it is safe to reuse.
+func NewPeers(ctx context.Context, config *water.Config, roles ...water.Role) (p *Peers, err error) {
+	if config == nil {
+		return nil, errors.New("watertest: peers with nil config is not allowed")
+	}
+
+	p = &Peers{}
+	defer func() {
+		if err != nil {
+			p.Close()
+		}
+	}()
+
+	if p.Dialer, err = water.NewDialerWithContext(ctx, config.Clone()); err != nil {
+		return nil, err
+	}
+
+	for _, role := range roles {
+		switch role {
+		case water.RoleListener:
+			if p.Listener, err = config.Clone().ListenContext(ctx, "tcp", "localhost:0"); err != nil {
+				return nil, err
+			}
+			go ServeEcho(p.Listener) // skipcq: GO-S2307
+		case water.RoleRelay:
+			if p.Echo, err = ListenEcho("tcp", "localhost:0"); err != nil {
+				return nil, err
+			}
+
+			if p.RelayListener, err = net.Listen("tcp", "localhost:0"); err != nil {
+				return nil, err
+			}
+
+			relayConfig := config.Clone()
+			relayConfig.NetworkListener = p.RelayListener
+			if p.Relay, err = water.NewRelayWithContext(ctx, relayConfig); err != nil {
+				return nil, err
+			}
+			go p.Relay.RelayTo("tcp", p.Echo.Addr().String()) // skipcq: GO-S2307
+		default:
+			return nil, errors.New("watertest: unsupported peer role " + role.String())
+		}
+	}
+
+	return p, nil
+}
+
+// DialListener dials the Listener with the Dialer.
+func (p *Peers) DialListener(ctx context.Context) (net.Conn, error) {
+	if p.Listener == nil {
+		return nil, errors.New("watertest: listener role not requested")
+	}
+	return p.Dialer.DialContext(ctx, "tcp", p.Listener.Addr().String())
+}
+
+// DialRelay dials the Relay with the Dialer.
+func (p *Peers) DialRelay(ctx context.Context) (net.Conn, error) {
+	if p.Relay == nil {
+		return nil, errors.New("watertest: relay role not requested")
+	}
+	return p.Dialer.DialContext(ctx, "tcp", p.RelayListener.Addr().String())
+}
+
+// Close closes all peers. Connections already established are not closed.
+func (p *Peers) Close() error {
+	var errs []error
+	if p.Listener != nil {
+		errs = append(errs, p.Listener.Close())
+	}
+	if p.Relay != nil {
+		errs = append(errs, p.Relay.Close())
+	}
+	if p.RelayListener != nil { // usually already closed by the Relay
+		if err := p.RelayListener.Close(); !errors.Is(err, net.ErrClosed) {
+			errs = append(errs, err)
+		}
+	}
+	if p.Echo != nil {
+		errs = append(errs, p.Echo.Close())
+	}
+	return errors.Join(errs...)
+}
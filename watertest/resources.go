@@ -0,0 +1,76 @@
+package watertest
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/refraction-networking/water"
+)
+
+// ResourceSample is a snapshot of the resources used by the current process.
+type ResourceSample struct {
+	Time time.Time
+
+	// Goroutines is the number of goroutines.
+	Goroutines int
+
+	// FDs is the number of open file descriptors, or -1 if it cannot be
+	// determined on this platform.
+	FDs int
+
+	// Cores is the number of water.Core not yet closed, see [water.ActiveCores].
+	Cores int64
+
+	// RSS is the resident set size in bytes, or the memory obtained from
+	// the OS by the Go runtime if RSS cannot be determined on this platform.
+	RSS uint64
+}
+
+// String implements fmt.Stringer.
+func (s ResourceSample) String() string {
+	return fmt.Sprintf("goroutines=%d fds=%d cores=%d rss=%dKiB", s.Goroutines, s.FDs, s.Cores, s.RSS>>10)
+}
+
+// SampleResources collects a ResourceSample of the current process. It
+// runs the garbage collector first, so that objects pending finalization
+// (e.g., unreferenced Cores) are not reported as leaked.
+func SampleResources() ResourceSample {
+	for i := 0; i < 3; i++ {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond) // allow finalizers to run
+	}
+
+	return ResourceSample{
+		Time:       time.Now(),
+		Goroutines: runtime.NumGoroutine(),
+		FDs:        countFDs(),
+		Cores:      water.ActiveCores(),
+		RSS:        rss(),
+	}
+}
+
+func countFDs() int {
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		return -1
+	}
+	return len(entries) - 1 // exclude the fd used by ReadDir itself
+}
+
+func rss() uint64 {
+	if statm, err := os.ReadFile("/proc/self/statm"); err == nil {
+		if fields := strings.Fields(string(statm)); len(fields) > 1 {
+			if pages, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+				return pages * uint64(os.Getpagesize())
+			}
+		}
+	}
+
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return m.Sys
+}
@@ -0,0 +1,213 @@
+package watertest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/refraction-networking/water"
+)
+
+// SoakConfig configures [Soak].
+type SoakConfig struct {
+	// Config is the configuration soaked. The WATM must be able to play
+	// both the dialer and the listener role, and the relay role if Relay
+	// is set, as it is used on both ends of each connection.
+	Config *water.Config
+
+	// Duration bounds the total time spent on cycles. Zero means no bound,
+	// in which case MaxCycles must be set.
+	Duration time.Duration
+
+	// MaxCycles bounds the number of cycles. Zero means no bound, in which
+	// case Duration must be set.
+	MaxCycles int
+
+	// PayloadSize is the number of bytes transferred in each direction in
+	// each cycle. If zero, 1024 will be used.
+	PayloadSize int
+
+	// Relay additionally soaks the relay role in each cycle.
+	Relay bool
+
+	// SampleInterval is the number of cycles between two resource samples.
+	// If zero, 100 will be used.
+	SampleInterval int
+
+	// Logf, if set, is called with each resource sample taken.
+	Logf func(format string, args ...any)
+}
+
+// SoakReport is the result of [Soak].
+type SoakReport struct {
+	// Cycles is the number of cycles completed.
+	Cycles int
+
+	// Failures is the number of cycles failed.
+	Failures int
+
+	// LastFailure is the error of the last failed cycle, if any.
+	LastFailure error
+
+	// Baseline is sampled after a warm-up cycle, before soaking.
+	Baseline ResourceSample
+
+	// Samples are taken every SampleInterval cycles and once after the
+	// last cycle, in chronological order.
+	Samples []ResourceSample
+}
+
+// Final returns the last sample taken.
+func (r *SoakReport) Final() ResourceSample {
+	if len(r.Samples) == 0 {
+		return r.Baseline
+	}
+	return r.Samples[len(r.Samples)-1]
+}
+
+// LeakTolerance is the growth in resource usage from the baseline to the
+// final sample tolerated by [SoakReport.CheckLeaks].
+type LeakTolerance struct {
+	Goroutines int
+	FDs        int
+	Cores      int64
+	RSS        uint64
+}
+
+// CheckLeaks returns an error describing every resource whose usage has
+// grown by more than the tolerance during the soak.
+func (r *SoakReport) CheckLeaks(tolerance LeakTolerance) error {
+	baseline, final := r.Baseline, r.Final()
+
+	var errs []error
+	if final.Goroutines-baseline.Goroutines > tolerance.Goroutines {
+		errs = append(errs, fmt.Errorf("goroutines grew from %d to %d", baseline.Goroutines, final.Goroutines))
+	}
+	if baseline.FDs >= 0 && final.FDs-baseline.FDs > tolerance.FDs {
+		errs = append(errs, fmt.Errorf("file descriptors grew from %d to %d", baseline.FDs, final.FDs))
+	}
+	if final.Cores-baseline.Cores > tolerance.Cores {
+		errs = append(errs, fmt.Errorf("cores grew from %d to %d", baseline.Cores, final.Cores))
+	}
+	if final.RSS > baseline.RSS && final.RSS-baseline.RSS > tolerance.RSS {
+		errs = append(errs, fmt.Errorf("RSS grew from %d to %d bytes", baseline.RSS, final.RSS))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Soak repeatedly connects, transfers data in both directions and closes
+// connections through the WATM in all roles, sampling the resources used
+// by the process along the way, until ctx is done or the Duration or
+// MaxCycles is reached. Use [SoakReport.CheckLeaks] on the returned report
+// to detect leaked goroutines, file descriptors, WebAssembly instances or
+// memory.
+//
+// Each cycle dials a water.Listener with a water.Dialer, both using the
+// Config. If Relay is set, each cycle also dials through a water.Relay
+// with a water.Dialer to a plain TCP echo server.
+func Soak(ctx context.Context, sc SoakConfig) (*SoakReport, error) {
+	if sc.Config == nil {
+		return nil, errors.New("watertest: soaking with nil config is not allowed")
+	}
+	if sc.Duration <= 0 && sc.MaxCycles <= 0 {
+		return nil, errors.New("watertest: either Duration or MaxCycles must be set")
+	}
+	if sc.PayloadSize <= 0 {
+		sc.PayloadSize = 1024
+	}
+	if sc.SampleInterval <= 0 {
+		sc.SampleInterval = 100
+	}
+	if sc.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, sc.Duration)
+		defer cancel()
+	}
+
+	roles := []water.Role{water.RoleListener}
+	if sc.Relay {
+		roles = append(roles, water.RoleRelay)
+	}
+
+	peers, err := NewPeers(ctx, sc.Config, roles...)
+	if err != nil {
+		return nil, err
+	}
+	defer peers.Close()
+
+	// warm up, so lazily allocated resources are part of the baseline
+	if err := soakCycle(ctx, peers, sc.PayloadSize); err != nil {
+		return nil, fmt.Errorf("watertest: warm-up cycle failed: %w", err)
+	}
+
+	report := &SoakReport{
+		Baseline: SampleResources(),
+	}
+	logf(sc, "baseline: %s", report.Baseline)
+
+	for sc.MaxCycles <= 0 || report.Cycles < sc.MaxCycles {
+		if ctx.Err() != nil {
+			break
+		}
+
+		if err := soakCycle(ctx, peers, sc.PayloadSize); err != nil {
+			if ctx.Err() != nil { // interrupted, not failed
+				break
+			}
+			report.Failures++
+			report.LastFailure = err
+		}
+		report.Cycles++
+
+		if report.Cycles%sc.SampleInterval == 0 {
+			sample := SampleResources()
+			report.Samples = append(report.Samples, sample)
+			logf(sc, "cycle %d: %s", report.Cycles, sample)
+		}
+	}
+
+	if report.Cycles%sc.SampleInterval != 0 || report.Cycles == 0 {
+		sample := SampleResources()
+		report.Samples = append(report.Samples, sample)
+		logf(sc, "cycle %d: %s", report.Cycles, sample)
+	}
+
+	return report, nil
+}
+
+func logf(sc SoakConfig, format string, args ...any) {
+	if sc.Logf != nil {
+		sc.Logf(format, args...)
+	}
+}
+
+// soakCycle runs one connect/transfer/close cycle with each peer.
+func soakCycle(ctx context.Context, peers *Peers, payloadSize int) error {
+	if err := roundTrip(ctx, peers.DialListener, payloadSize); err != nil {
+		return fmt.Errorf("dialer to listener: %w", err)
+	}
+
+	if peers.Relay != nil {
+		if err := roundTrip(ctx, peers.DialRelay, payloadSize); err != nil {
+			return fmt.Errorf("dialer through relay: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// roundTrip dials a peer, writes a random payload and expects it to be
+// echoed back.
+func roundTrip(ctx context.Context, dial func(context.Context) (net.Conn, error), payloadSize int) error {
+	conn, err := dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close() // skipcq: GO-S2307
+
+	_, err = MeasureLatency(ctx, conn, 1, payloadSize)
+	return err
+}
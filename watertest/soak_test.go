@@ -0,0 +1,59 @@
+package watertest_test
+
+import (
+	"context"
+	"flag"
+	"os"
+	"testing"
+
+	"github.com/refraction-networking/water"
+	_ "github.com/refraction-networking/water/transport/v1"
+	"github.com/refraction-networking/water/watertest"
+)
+
+var (
+	soakDuration = flag.Duration("soak.duration", 0, "duration of TestSoak, e.g. 2h (default: bounded by -soak.cycles)")
+	soakCycles   = flag.Int("soak.cycles", 50, "maximum number of cycles of TestSoak, 0 for no limit")
+	soakWATM     = flag.String("soak.watm", "../transport/v1/testdata/reverse.wasm", "path to the WATM soaked by TestSoak")
+)
+
+// TestSoak runs a short soak by default. Run `make soak` for a long-run soak.
+func TestSoak(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping soak test in short mode")
+	}
+
+	wasm, err := os.ReadFile(*soakWATM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := watertest.Soak(context.Background(), watertest.SoakConfig{
+		Config: &water.Config{
+			TransportModuleBin:  wasm,
+			ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+		},
+		Duration:       *soakDuration,
+		MaxCycles:      *soakCycles,
+		Relay:          true,
+		SampleInterval: 10,
+		Logf:           t.Logf,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Failures > 0 {
+		t.Errorf("%d of %d cycles failed, last failure: %v", report.Failures, report.Cycles, report.LastFailure)
+	}
+
+	// a few in-flight goroutines and sockets are tolerated to avoid flakiness
+	if err := report.CheckLeaks(watertest.LeakTolerance{
+		Goroutines: 16,
+		FDs:        16,
+		Cores:      4,
+		RSS:        64 << 20,
+	}); err != nil {
+		t.Error(err)
+	}
+}
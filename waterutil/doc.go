@@ -0,0 +1,6 @@
+// Package waterutil provides the glue most applications need around a
+// water Dialer, such as exposing it to other programs as a local SOCKS5
+// proxy with [ServeSOCKS5] or as an HTTP proxy with [ServeHTTPConnect], to
+// the Outline SDK with [StreamDialer], or to proxy frameworks such as
+// v2ray/xray and sing-box with [Outbound].
+package waterutil
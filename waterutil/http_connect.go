@@ -0,0 +1,131 @@
+package waterutil
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/refraction-networking/water"
+	"github.com/refraction-networking/water/internal/log"
+)
+
+// HTTPConnectHandler is an http.Handler serving HTTP CONNECT requests by
+// dialing the requested host through a water Dialer, so browsers and
+// tools like curl can use a WATM transport as an HTTP proxy. Requests
+// with any other method are answered with 405 Method Not Allowed.
+//
+// HTTP/1.1 connections are hijacked and relayed as-is. An HTTP/2 CONNECT
+// request, which is served if the http.Server has HTTP/2 enabled (e.g.,
+// over TLS), is relayed over its stream.
+type HTTPConnectHandler struct {
+	// Dialer dials the host requested by each client. It must be set.
+	Dialer water.Dialer
+
+	// Network is the network passed to Dialer.DialContext. If empty, "tcp"
+	// will be used.
+	Network string
+}
+
+// ServeHTTPConnect serves HTTP CONNECT requests on lis, dialing through
+// dialer, until lis is closed. See HTTPConnectHandler for details.
+func ServeHTTPConnect(lis net.Listener, dialer water.Dialer) error {
+	server := &http.Server{
+		Handler:           &HTTPConnectHandler{Dialer: dialer},
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return server.Serve(lis)
+}
+
+// ServeHTTP implements http.Handler.
+func (h *HTTPConnectHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodConnect {
+		w.Header().Set("Allow", http.MethodConnect)
+		http.Error(w, "only CONNECT is supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	network := h.Network
+	if network == "" {
+		network = "tcp"
+	}
+
+	// the context also bounds the lifetime of the Conn, so it must not be
+	// the context of the request, canceled when the handler returns
+	remote, err := h.Dialer.DialContext(context.Background(), network, r.Host)
+	if err != nil {
+		log.Debugf("waterutil: HTTP CONNECT %s: %v", r.Host, err)
+		http.Error(w, "failed to dial "+r.Host, http.StatusBadGateway)
+		return
+	}
+	defer remote.Close() // skipcq: GO-S2307
+
+	if r.ProtoMajor >= 2 {
+		h.relayStream(w, r, remote)
+		return
+	}
+
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		http.Error(w, "hijacking is not supported", http.StatusInternalServerError)
+		return
+	}
+	defer conn.Close() // skipcq: GO-S2307
+
+	if _, err := io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n"); err != nil {
+		return
+	}
+
+	// forward anything the client sent ahead of the response
+	if n := rw.Reader.Buffered(); n > 0 {
+		buffered, _ := rw.Reader.Peek(n)
+		if _, err := remote.Write(buffered); err != nil {
+			return
+		}
+	}
+
+	Pipe(conn, remote)
+}
+
+// relayStream relays an HTTP/2 CONNECT stream, whose request body carries
+// the data from the client and response body the data to the client.
+func (*HTTPConnectHandler) relayStream(w http.ResponseWriter, r *http.Request, remote net.Conn) {
+	rc := http.NewResponseController(w)
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	uploaded, downloaded := make(chan struct{}), make(chan struct{})
+	go func() {
+		_, _ = io.Copy(remote, r.Body)
+		close(uploaded)
+	}()
+	go func() {
+		_, _ = io.Copy(flushWriter{w, rc}, remote)
+		close(downloaded)
+	}()
+
+	// w must not be written to once the handler returns
+	select {
+	case <-uploaded:
+		remote.Close()
+		<-downloaded
+	case <-downloaded:
+	}
+}
+
+// flushWriter flushes every write to the client.
+type flushWriter struct {
+	w  io.Writer
+	rc *http.ResponseController
+}
+
+func (fw flushWriter) Write(b []byte) (int, error) {
+	n, err := fw.w.Write(b)
+	if err != nil {
+		return n, err
+	}
+	return n, fw.rc.Flush()
+}
@@ -0,0 +1,109 @@
+package waterutil_test
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/refraction-networking/water/waterutil"
+)
+
+func TestServeHTTPConnect(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close() // skipcq: GO-S2307
+
+	go waterutil.ServeHTTPConnect(lis, newPlainDialer(t)) // nolint:errcheck
+
+	echoAddr := startEchoServer(t)
+
+	t.Run("CONNECT", func(t *testing.T) {
+		conn, err := net.Dial("tcp", lis.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close() // skipcq: GO-S2307
+		if err := conn.SetDeadline(time.Now().Add(5 * time.Second)); err != nil {
+			t.Fatal(err)
+		}
+
+		// the data sent along with the request must be relayed too
+		if _, err := fmt.Fprintf(conn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\nhello", echoAddr, echoAddr); err != nil {
+			t.Fatal(err)
+		}
+
+		br := bufio.NewReader(conn)
+		resp, err := http.ReadResponse(br, &http.Request{Method: http.MethodConnect})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("status = %d, want 200", resp.StatusCode)
+		}
+
+		buf := make([]byte, 5)
+		if _, err := io.ReadFull(br, buf); err != nil {
+			t.Fatal(err)
+		}
+		if string(buf) != "hello" {
+			t.Errorf("echo = %q, want %q", buf, "hello")
+		}
+	})
+
+	t.Run("GET", func(t *testing.T) {
+		resp, err := http.Get("http://" + lis.Addr().String() + "/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusMethodNotAllowed {
+			t.Errorf("status = %d, want 405", resp.StatusCode)
+		}
+	})
+}
+
+func TestHTTPConnectHandler_HTTP2(t *testing.T) {
+	server := httptest.NewUnstartedServer(&waterutil.HTTPConnectHandler{Dialer: newPlainDialer(t)})
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	echoAddr := startEchoServer(t)
+
+	pr, pw := io.Pipe()
+	defer pw.Close() // skipcq: GO-S2307
+
+	req, err := http.NewRequest(http.MethodConnect, server.URL, pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Host = echoAddr.String()
+
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.ProtoMajor != 2 || resp.StatusCode != http.StatusOK {
+		t.Fatalf("%s %d, want HTTP/2.0 200", resp.Proto, resp.StatusCode)
+	}
+
+	msg := []byte("hello")
+	go pw.Write(msg) // nolint:errcheck
+
+	buf := make([]byte, len(msg))
+	if _, err := io.ReadFull(resp.Body, buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, msg) {
+		t.Errorf("echo = %q, want %q", buf, msg)
+	}
+}
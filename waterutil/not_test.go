@@ -0,0 +1,56 @@
+package waterutil_test
+
+import (
+	"io"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/refraction-networking/water"
+	_ "github.com/refraction-networking/water/transport/v1"
+)
+
+// newPlainDialer creates a Dialer running the v1 plain WATM.
+func newPlainDialer(t *testing.T) water.Dialer {
+	t.Helper()
+
+	wasm, err := os.ReadFile("../transport/v1/testdata/plain.wasm")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dialer, err := water.NewDialer(&water.Config{
+		TransportModuleBin:  wasm,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dialer
+}
+
+// startEchoServer returns the address of a TCP server echoing everything.
+func startEchoServer(t *testing.T) *net.TCPAddr {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { lis.Close() })
+
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	return lis.Addr().(*net.TCPAddr)
+}
@@ -0,0 +1,110 @@
+package waterutil
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/refraction-networking/water"
+)
+
+// OutboundProtocol is the protocol name a WATER outbound is expected to be
+// registered under in a proxy framework.
+const OutboundProtocol = "water"
+
+// ErrOutboundExists is returned by RegisterOutbound if an Outbound with the
+// same tag is already registered.
+var ErrOutboundExists = errors.New("water: outbound already registered")
+
+// Outbound is a named water Dialer, built from the JSON config format of
+// WATER (see configbuilder.ConfigJSON), for proxy frameworks whose outbounds
+// are configured with a tag and a JSON settings object, such as
+// v2ray/xray and sing-box.
+//
+// The frameworks themselves are not imported, so an Outbound is to be
+// registered with them by the application, which is typically a few
+// lines: a v2ray/xray outbound handler, or a sing-box adapter.Outbound,
+// of protocol OutboundProtocol calling NewOutbound with its tag and
+// settings when created and DialContext when dialing.
+type Outbound struct {
+	tag    string
+	dialer water.Dialer
+}
+
+// NewOutbound creates an Outbound with the given tag from the settings,
+// a Config in the JSON format of WATER. Paths in the settings are
+// relative to the current working directory.
+func NewOutbound(tag string, settings json.RawMessage) (*Outbound, error) {
+	config := &water.Config{}
+	if err := json.Unmarshal(settings, config); err != nil {
+		return nil, fmt.Errorf("water: outbound %q: %w", tag, err)
+	}
+
+	dialer, err := water.NewDialer(config)
+	if err != nil {
+		return nil, fmt.Errorf("water: outbound %q: %w", tag, err)
+	}
+
+	return &Outbound{tag: tag, dialer: dialer}, nil
+}
+
+// Tag returns the tag of the Outbound.
+func (o *Outbound) Tag() string {
+	return o.tag
+}
+
+// Dialer returns the water Dialer of the Outbound.
+func (o *Outbound) Dialer() water.Dialer {
+	return o.dialer
+}
+
+// DialContext dials address through the Outbound. Unlike with a water
+// Dialer, the context only bounds the dialing, not the lifetime of the
+// returned net.Conn, as expected by proxy frameworks.
+func (o *Outbound) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	conn, err := dialDetached(ctx, o.dialer, network, address)
+	if err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+var (
+	outbounds      = make(map[string]*Outbound)
+	outboundsMutex sync.RWMutex
+)
+
+// RegisterOutbound registers o by its tag, so an integration with a proxy
+// framework could look it up with LookupOutbound instead of creating it
+// from the settings.
+func RegisterOutbound(o *Outbound) error {
+	outboundsMutex.Lock()
+	defer outboundsMutex.Unlock()
+
+	if _, ok := outbounds[o.tag]; ok {
+		return fmt.Errorf("%w: %q", ErrOutboundExists, o.tag)
+	}
+	outbounds[o.tag] = o
+	return nil
+}
+
+// UnregisterOutbound removes the Outbound registered with the given tag,
+// if any.
+func UnregisterOutbound(tag string) {
+	outboundsMutex.Lock()
+	defer outboundsMutex.Unlock()
+
+	delete(outbounds, tag)
+}
+
+// LookupOutbound returns the Outbound registered with the given tag.
+func LookupOutbound(tag string) (*Outbound, bool) {
+	outboundsMutex.RLock()
+	defer outboundsMutex.RUnlock()
+
+	o, ok := outbounds[tag]
+	return o, ok
+}
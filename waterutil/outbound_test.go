@@ -0,0 +1,63 @@
+package waterutil_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/refraction-networking/water/waterutil"
+)
+
+func TestOutbound(t *testing.T) {
+	settings := json.RawMessage(fmt.Sprintf(`{"transport_module": {"bin": %q}}`, "../transport/v1/testdata/plain.wasm"))
+
+	o, err := waterutil.NewOutbound("water-plain", settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := waterutil.RegisterOutbound(o); err != nil {
+		t.Fatal(err)
+	}
+	defer waterutil.UnregisterOutbound(o.Tag())
+
+	if err := waterutil.RegisterOutbound(o); !errors.Is(err, waterutil.ErrOutboundExists) {
+		t.Errorf("RegisterOutbound() error = %v, want %v", err, waterutil.ErrOutboundExists)
+	}
+
+	registered, ok := waterutil.LookupOutbound("water-plain")
+	if !ok || registered != o {
+		t.Fatal("LookupOutbound() did not return the registered Outbound")
+	}
+
+	echoAddr := startEchoServer(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	conn, err := registered.DialContext(ctx, "tcp", echoAddr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close() // skipcq: GO-S2307
+	cancel()
+
+	if err := conn.SetDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := []byte("hello")
+	if _, err := conn.Write(msg); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, len(msg))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, msg) {
+		t.Errorf("echo = %q, want %q", buf, msg)
+	}
+}
@@ -0,0 +1,15 @@
+package waterutil
+
+import (
+	"io"
+	"net"
+)
+
+// Pipe copies data between a and b in both directions until either
+// direction ends, e.g., when a or b is closed.
+func Pipe(a, b net.Conn) {
+	done := make(chan struct{}, 2)
+	go func() { _, _ = io.Copy(a, b); done <- struct{}{} }()
+	go func() { _, _ = io.Copy(b, a); done <- struct{}{} }()
+	<-done
+}
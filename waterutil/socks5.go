@@ -0,0 +1,210 @@
+package waterutil
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/refraction-networking/water"
+	"github.com/refraction-networking/water/internal/log"
+)
+
+// SOCKS5 constants, see RFC 1928.
+const (
+	socks5Version = 0x05
+
+	socks5MethodNoAuth       = 0x00
+	socks5MethodNoAcceptable = 0xFF
+
+	socks5CmdConnect      = 0x01
+	socks5CmdUDPAssociate = 0x03
+
+	socks5AtypIPv4   = 0x01
+	socks5AtypDomain = 0x03
+	socks5AtypIPv6   = 0x04
+
+	socks5RepSucceeded        = 0x00
+	socks5RepGeneralFailure   = 0x01
+	socks5RepCmdNotSupported  = 0x07
+	socks5RepAtypNotSupported = 0x08
+)
+
+const socks5DefaultHandshakeTimeout = 10 * time.Second
+
+var errSOCKS5Unsupported = errors.New("waterutil: unsupported SOCKS5 request")
+
+// SOCKS5Server is a SOCKS5 proxy server (RFC 1928) dialing the address of
+// each CONNECT request through a water Dialer. Only the "no authentication"
+// method is supported, so it should only listen on a local address.
+//
+// UDP ASSOCIATE is rejected as not supported, as WATER has no ABI for
+// datagram transports yet.
+type SOCKS5Server struct {
+	// Dialer dials the address requested by each client. It must be set.
+	Dialer water.Dialer
+
+	// Network is the network passed to Dialer.DialContext. If empty, "tcp"
+	// will be used.
+	Network string
+
+	// HandshakeTimeout bounds the time a client may take to send its
+	// request. If zero, 10 seconds will be used.
+	HandshakeTimeout time.Duration
+}
+
+// ServeSOCKS5 serves SOCKS5 requests on lis, dialing through dialer, until
+// lis is closed. See SOCKS5Server for details.
+func ServeSOCKS5(lis net.Listener, dialer water.Dialer) error {
+	return (&SOCKS5Server{Dialer: dialer}).Serve(lis)
+}
+
+// Serve accepts connections on lis and serves the SOCKS5 requests on each
+// of them, until lis is closed. It always returns a non-nil error, the one
+// returned by lis.Accept.
+func (s *SOCKS5Server) Serve(lis net.Listener) error {
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			return err
+		}
+
+		go func() {
+			defer conn.Close() // skipcq: GO-S2307
+
+			if err := s.handle(conn); err != nil {
+				log.Debugf("waterutil: SOCKS5 client %s: %v", conn.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+func (s *SOCKS5Server) handle(conn net.Conn) error {
+	timeout := s.HandshakeTimeout
+	if timeout == 0 {
+		timeout = socks5DefaultHandshakeTimeout
+	}
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+
+	address, err := readSOCKS5Request(conn)
+	if err != nil {
+		if errors.Is(err, errSOCKS5Unsupported) {
+			return err
+		}
+		return fmt.Errorf("reading request: %w", err)
+	}
+
+	network := s.Network
+	if network == "" {
+		network = "tcp"
+	}
+
+	// the context also bounds the lifetime of the Conn, so it must not be
+	// canceled once the handshake is done
+	remote, err := s.Dialer.DialContext(context.Background(), network, address)
+	if err != nil {
+		_ = writeSOCKS5Reply(conn, socks5RepGeneralFailure)
+		return fmt.Errorf("dialing %s: %w", address, err)
+	}
+	defer remote.Close() // skipcq: GO-S2307
+
+	if err := writeSOCKS5Reply(conn, socks5RepSucceeded); err != nil {
+		return err
+	}
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		return err
+	}
+
+	Pipe(conn, remote)
+	return nil
+}
+
+// readSOCKS5Request negotiates no authentication and reads a CONNECT
+// request, returning the address requested.
+func readSOCKS5Request(conn net.Conn) (string, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(conn, header[:]); err != nil {
+		return "", err
+	}
+	if header[0] != socks5Version {
+		return "", fmt.Errorf("%w: version %d", errSOCKS5Unsupported, header[0])
+	}
+
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return "", err
+	}
+
+	method := byte(socks5MethodNoAcceptable)
+	for _, m := range methods {
+		if m == socks5MethodNoAuth {
+			method = socks5MethodNoAuth
+		}
+	}
+	if _, err := conn.Write([]byte{socks5Version, method}); err != nil {
+		return "", err
+	}
+	if method == socks5MethodNoAcceptable {
+		return "", fmt.Errorf("%w: no acceptable authentication method", errSOCKS5Unsupported)
+	}
+
+	var request [4]byte // VER, CMD, RSV, ATYP
+	if _, err := io.ReadFull(conn, request[:]); err != nil {
+		return "", err
+	}
+	switch request[1] {
+	case socks5CmdConnect:
+	case socks5CmdUDPAssociate:
+		_ = writeSOCKS5Reply(conn, socks5RepCmdNotSupported)
+		return "", fmt.Errorf("%w: UDP ASSOCIATE", errSOCKS5Unsupported)
+	default:
+		_ = writeSOCKS5Reply(conn, socks5RepCmdNotSupported)
+		return "", fmt.Errorf("%w: command %d", errSOCKS5Unsupported, request[1])
+	}
+
+	var host string
+	switch request[3] {
+	case socks5AtypIPv4, socks5AtypIPv6:
+		ip := make(net.IP, net.IPv4len)
+		if request[3] == socks5AtypIPv6 {
+			ip = make(net.IP, net.IPv6len)
+		}
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return "", err
+		}
+		host = ip.String()
+	case socks5AtypDomain:
+		var length [1]byte
+		if _, err := io.ReadFull(conn, length[:]); err != nil {
+			return "", err
+		}
+		domain := make([]byte, length[0])
+		if _, err := io.ReadFull(conn, domain); err != nil {
+			return "", err
+		}
+		host = string(domain)
+	default:
+		_ = writeSOCKS5Reply(conn, socks5RepAtypNotSupported)
+		return "", fmt.Errorf("%w: address type %d", errSOCKS5Unsupported, request[3])
+	}
+
+	var port [2]byte
+	if _, err := io.ReadFull(conn, port[:]); err != nil {
+		return "", err
+	}
+
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port[:])))), nil
+}
+
+// writeSOCKS5Reply writes a reply with the unspecified IPv4 address as the
+// bound address, which clients are not expected to use.
+func writeSOCKS5Reply(conn net.Conn, rep byte) error {
+	_, err := conn.Write([]byte{socks5Version, rep, 0x00, socks5AtypIPv4, 0, 0, 0, 0, 0, 0})
+	return err
+}
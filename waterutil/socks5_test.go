@@ -0,0 +1,103 @@
+package waterutil_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/refraction-networking/water/waterutil"
+)
+
+// startSOCKS5Server serves SOCKS5 with a Dialer running the v1 plain WATM
+// and returns the address of the server.
+func startSOCKS5Server(t *testing.T) string {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { lis.Close() })
+
+	go waterutil.ServeSOCKS5(lis, newPlainDialer(t)) // nolint:errcheck
+
+	return lis.Addr().String()
+}
+
+// socks5Request sends a SOCKS5 greeting and request with the given command
+// and address, and returns the reply code.
+func socks5Request(t *testing.T, conn net.Conn, cmd byte, addr []byte) byte {
+	t.Helper()
+
+	if err := conn.SetDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := conn.Write([]byte{0x05, 0x01, 0x00}); err != nil {
+		t.Fatal(err)
+	}
+	method := make([]byte, 2)
+	if _, err := io.ReadFull(conn, method); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(method, []byte{0x05, 0x00}) {
+		t.Fatalf("method selection = %x, want 0500", method)
+	}
+
+	if _, err := conn.Write(append([]byte{0x05, cmd, 0x00}, addr...)); err != nil {
+		t.Fatal(err)
+	}
+	reply := make([]byte, 10)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		t.Fatal(err)
+	}
+	return reply[1]
+}
+
+func TestServeSOCKS5(t *testing.T) {
+	proxyAddr := startSOCKS5Server(t)
+	echoAddr := startEchoServer(t)
+
+	t.Run("CONNECT domain", func(t *testing.T) {
+		conn, err := net.Dial("tcp", proxyAddr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close() // skipcq: GO-S2307
+
+		domain := "localhost"
+		addr := append([]byte{0x03, byte(len(domain))}, domain...)
+		addr = binary.BigEndian.AppendUint16(addr, uint16(echoAddr.Port))
+		if rep := socks5Request(t, conn, 0x01, addr); rep != 0x00 {
+			t.Fatalf("reply = %d, want 0", rep)
+		}
+
+		msg := []byte("hello")
+		if _, err := conn.Write(msg); err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, len(msg))
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf, msg) {
+			t.Errorf("echo = %q, want %q", buf, msg)
+		}
+	})
+
+	t.Run("UDP ASSOCIATE", func(t *testing.T) {
+		conn, err := net.Dial("tcp", proxyAddr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close() // skipcq: GO-S2307
+
+		addr := append([]byte{0x01}, make([]byte, 6)...)
+		if rep := socks5Request(t, conn, 0x03, addr); rep != 0x07 {
+			t.Errorf("reply = %d, want 7 (command not supported)", rep)
+		}
+	})
+}
@@ -0,0 +1,93 @@
+package waterutil
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/refraction-networking/water"
+)
+
+// StreamConn is a net.Conn which could be half-closed. It matches the
+// transport.StreamConn interface of the Outline SDK
+// (golang.getoutline.org/sdk/transport).
+type StreamConn interface {
+	net.Conn
+
+	// CloseRead closes the reading side of the connection.
+	CloseRead() error
+
+	// CloseWrite closes the writing side of the connection.
+	CloseWrite() error
+}
+
+// StreamDialer dials StreamConns through a water Dialer. It matches the
+// transport.StreamDialer interface of the Outline SDK except for the
+// return type of DialStream, so it could be used with the Outline SDK
+// and in Outline-based apps by wrapping it as:
+//
+//	transport.FuncStreamDialer(func(ctx context.Context, raddr string) (transport.StreamConn, error) {
+//		return d.DialStream(ctx, raddr)
+//	})
+type StreamDialer struct {
+	// Dialer dials the remote address. It must be set.
+	Dialer water.Dialer
+
+	// Network is the network passed to Dialer.DialContext. If empty, "tcp"
+	// will be used.
+	Network string
+}
+
+// DialStream dials raddr through the Dialer. The context only bounds the
+// dialing, not the lifetime of the returned StreamConn.
+//
+// If the connection dialed cannot be half-closed, CloseRead and CloseWrite
+// of the returned StreamConn return errors.ErrUnsupported.
+func (d *StreamDialer) DialStream(ctx context.Context, raddr string) (StreamConn, error) {
+	network := d.Network
+	if network == "" {
+		network = "tcp"
+	}
+
+	conn, err := dialDetached(ctx, d.Dialer, network, raddr)
+	if err != nil {
+		return nil, err
+	}
+
+	if sc, ok := conn.(StreamConn); ok {
+		return sc, nil
+	}
+	return unsupportedHalfCloseConn{conn}, nil
+}
+
+// unsupportedHalfCloseConn is a StreamConn for a connection which cannot be
+// half-closed.
+type unsupportedHalfCloseConn struct {
+	net.Conn
+}
+
+func (unsupportedHalfCloseConn) CloseRead() error {
+	return errors.ErrUnsupported
+}
+
+func (unsupportedHalfCloseConn) CloseWrite() error {
+	return errors.ErrUnsupported
+}
+
+// dialDetached dials address through dialer, with ctx bounding only the
+// dialing. The context passed to a water Dialer otherwise also bounds the
+// lifetime of the Conn, which is not expected by most callers.
+func dialDetached(ctx context.Context, dialer water.Dialer, network, address string) (water.Conn, error) {
+	dialCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(ctx, cancel)
+	conn, err := dialer.DialContext(dialCtx, network, address)
+	if !stop() {
+		// ctx is done, which could have canceled the dialing
+		if err == nil {
+			conn.Close()
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	return conn, err
+}
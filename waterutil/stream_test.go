@@ -0,0 +1,50 @@
+package waterutil_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/refraction-networking/water/waterutil"
+)
+
+func TestStreamDialer(t *testing.T) {
+	echoAddr := startEchoServer(t)
+	d := &waterutil.StreamDialer{Dialer: newPlainDialer(t)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	conn, err := d.DialStream(ctx, echoAddr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close() // skipcq: GO-S2307
+
+	// the context must only bound the dialing
+	cancel()
+	time.Sleep(10 * time.Millisecond)
+
+	if err := conn.SetDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := []byte("hello")
+	if _, err := conn.Write(msg); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, len(msg))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, msg) {
+		t.Errorf("echo = %q, want %q", buf, msg)
+	}
+
+	if err := conn.CloseWrite(); err != nil {
+		t.Errorf("CloseWrite() error = %v", err)
+	}
+	if _, err := conn.Write(msg); err == nil {
+		t.Error("Write() after CloseWrite() succeeded")
+	}
+}
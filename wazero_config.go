@@ -15,12 +15,20 @@ import (
 type WazeroModuleConfigFactory struct {
 	moduleConfig wazero.ModuleConfig
 	fsconfig     wazero.FSConfig
+
+	// argv and env are recorded separately from moduleConfig so that
+	// they could be withheld from the WebAssembly module by a WASIPolicy.
+	argv      []string
+	envKeys   []string
+	envValues []string
+
+	preopens bool // set once a directory is preopened or the FSConfig set
 }
 
 // NewWazeroModuleConfigFactory creates a new WazeroModuleConfigFactory.
 func NewWazeroModuleConfigFactory() *WazeroModuleConfigFactory {
 	return &WazeroModuleConfigFactory{
-		moduleConfig: wazero.NewModuleConfig().WithSysWalltime().WithSysNanotime().WithSysNanosleep().WithRandSource(rand.Reader),
+		moduleConfig: wazero.NewModuleConfig(),
 		fsconfig:     wazero.NewFSConfig(),
 	}
 }
@@ -33,16 +41,63 @@ func (wmcf *WazeroModuleConfigFactory) Clone() *WazeroModuleConfigFactory {
 	return &WazeroModuleConfigFactory{
 		moduleConfig: wmcf.moduleConfig,
 		fsconfig:     wmcf.fsconfig,
+		argv:         append([]string(nil), wmcf.argv...),
+		envKeys:      append([]string(nil), wmcf.envKeys...),
+		envValues:    append([]string(nil), wmcf.envValues...),
+		preopens:     wmcf.preopens,
 	}
 }
 
-// GetConfig returns the latest wazero.ModuleConfig.
+// GetConfig returns the latest wazero.ModuleConfig with all WASI
+// capabilities granted.
 func (wmcf *WazeroModuleConfigFactory) GetConfig() wazero.ModuleConfig {
 	if wmcf == nil {
 		panic("water: GetConfig: wmcf is nil")
 	}
 
-	return wmcf.moduleConfig.WithFSConfig(wmcf.fsconfig)
+	return wmcf.getConfigWithPolicy(&WASIPolicy{
+		Clock:    true,
+		Random:   true,
+		Environ:  true,
+		Preopens: true,
+		Network:  true,
+	}).WithFSConfig(wmcf.fsconfig)
+}
+
+// getConfigWithPolicy returns the latest wazero.ModuleConfig with only
+// the WASI capabilities granted by the policy. The FSConfig is not set
+// and is up to the caller.
+func (wmcf *WazeroModuleConfigFactory) getConfigWithPolicy(policy *WASIPolicy) wazero.ModuleConfig {
+	mc := wmcf.moduleConfig
+
+	if policy.Clock {
+		mc = mc.WithSysWalltime().WithSysNanotime().WithSysNanosleep()
+	}
+
+	if policy.Random {
+		mc = mc.WithRandSource(rand.Reader)
+	}
+
+	if policy.Environ {
+		mc = mc.WithArgs(wmcf.argv...)
+		for i := range wmcf.envKeys {
+			mc = mc.WithEnv(wmcf.envKeys[i], wmcf.envValues[i])
+		}
+	}
+
+	return mc
+}
+
+// configuresEnviron reports whether any argument or environment variable
+// is set via the WazeroModuleConfigFactory.
+func (wmcf *WazeroModuleConfigFactory) configuresEnviron() bool {
+	return wmcf != nil && (len(wmcf.argv) > 0 || len(wmcf.envKeys) > 0)
+}
+
+// configuresPreopens reports whether any directory is preopened via the
+// WazeroModuleConfigFactory.
+func (wmcf *WazeroModuleConfigFactory) configuresPreopens() bool {
+	return wmcf != nil && wmcf.preopens
 }
 
 // GetFSConfig returns the latest wazero.FSConfig.
@@ -54,18 +109,23 @@ func (wmcf *WazeroModuleConfigFactory) GetFSConfig() wazero.FSConfig {
 	return wmcf.fsconfig
 }
 
-// SetFSConfig sets the wazero.FSConfig for the WebAssembly module.
+// SetFSConfig sets the wazero.FSConfig for the WebAssembly module. The
+// directories it mounts are withheld if the WASIPolicy in the Config does
+// not grant the Preopens capability.
 func (wmcf *WazeroModuleConfigFactory) SetFSConfig(fsconfig wazero.FSConfig) {
 	wmcf.fsconfig = fsconfig
+	wmcf.preopens = true
 }
 
-// SetArgv sets the arguments for the WebAssembly module.
+// SetArgv sets the arguments for the WebAssembly module. The arguments are
+// withheld if the WASIPolicy in the Config does not grant the Environ
+// capability.
 //
 // Warning: this isn't a recommended way to pass configuration to the
 // WebAssembly module. Instead, use TransportModuleConfig for a serializable
 // configuration file.
 func (wmcf *WazeroModuleConfigFactory) SetArgv(argv []string) {
-	wmcf.moduleConfig = wmcf.moduleConfig.WithArgs(argv...)
+	wmcf.argv = append([]string(nil), argv...)
 }
 
 // InheritArgv sets the arguments for the WebAssembly module to os.Args.
@@ -79,7 +139,9 @@ func (wmcf *WazeroModuleConfigFactory) InheritArgv() {
 	panic("water: InheritArgv: not implemented yet")
 }
 
-// SetEnv sets the environment variables for the WebAssembly module.
+// SetEnv sets the environment variables for the WebAssembly module. The
+// variables are withheld if the WASIPolicy in the Config does not grant
+// the Environ capability.
 //
 // Warning: this isn't a recommended way to pass configuration to the
 // WebAssembly module. Instead, use TransportModuleConfig for a serializable
@@ -89,9 +151,8 @@ func (wmcf *WazeroModuleConfigFactory) SetEnv(keys, values []string) {
 		panic("water: SetEnv: keys and values must have the same length")
 	}
 
-	for i := range keys {
-		wmcf.moduleConfig = wmcf.moduleConfig.WithEnv(keys[i], values[i])
-	}
+	wmcf.envKeys = append(wmcf.envKeys, keys...)
+	wmcf.envValues = append(wmcf.envValues, values...)
 }
 
 // InheritEnv sets the environment variables for the WebAssembly module to
@@ -136,9 +197,12 @@ func (wmcf *WazeroModuleConfigFactory) InheritStderr() {
 	wmcf.moduleConfig = wmcf.moduleConfig.WithStderr(os.Stderr)
 }
 
-// SetPreopenDir sets the preopened directory for the WebAssembly module.
+// SetPreopenDir sets the preopened directory for the WebAssembly module. The
+// directory is withheld if the WASIPolicy in the Config does not grant the
+// Preopens capability.
 func (wmcf *WazeroModuleConfigFactory) SetPreopenDir(path string, guestPath string) {
 	wmcf.fsconfig = wmcf.fsconfig.WithDirMount(path, guestPath)
+	wmcf.preopens = true
 }
 
 // TODO: consider adding SetPreopenReadonlyDir
@@ -146,15 +210,19 @@ func (wmcf *WazeroModuleConfigFactory) SetPreopenDir(path string, guestPath stri
 
 // WazeroRuntimeConfigFactory is used to spawn wazero.RuntimeConfig.
 type WazeroRuntimeConfigFactory struct {
-	runtimeConfig    wazero.RuntimeConfig
-	compilationCache wazero.CompilationCache
+	runtimeConfig      wazero.RuntimeConfig
+	compilationCache   wazero.CompilationCache
+	isolated           bool
+	interpreter        bool // set by Interpreter, cleared by Compiler
+	closeOnContextDone bool // kept when the mode is switched
 }
 
 // NewWazeroRuntimeConfigFactory creates a new WazeroRuntimeConfigFactory.
 func NewWazeroRuntimeConfigFactory() *WazeroRuntimeConfigFactory {
 	return &WazeroRuntimeConfigFactory{
-		runtimeConfig:    wazero.NewRuntimeConfig().WithCloseOnContextDone(true),
-		compilationCache: nil,
+		runtimeConfig:      wazero.NewRuntimeConfig().WithCloseOnContextDone(true),
+		compilationCache:   nil,
+		closeOnContextDone: true,
 	}
 }
 
@@ -165,8 +233,11 @@ func (wrcf *WazeroRuntimeConfigFactory) Clone() *WazeroRuntimeConfigFactory {
 	}
 
 	return &WazeroRuntimeConfigFactory{
-		runtimeConfig:    wrcf.runtimeConfig,
-		compilationCache: wrcf.compilationCache,
+		runtimeConfig:      wrcf.runtimeConfig,
+		compilationCache:   wrcf.compilationCache,
+		isolated:           wrcf.isolated,
+		interpreter:        wrcf.interpreter,
+		closeOnContextDone: wrcf.closeOnContextDone,
 	}
 }
 
@@ -176,6 +247,10 @@ func (wrcf *WazeroRuntimeConfigFactory) GetConfig() wazero.RuntimeConfig {
 		panic("water: GetConfig: wrcf is nil")
 	}
 
+	if wrcf.isolated {
+		return wrcf.runtimeConfig // no CompilationCache, nothing shared
+	}
+
 	if wrcf.compilationCache != nil {
 		return wrcf.runtimeConfig.WithCompilationCache(wrcf.compilationCache)
 	} else {
@@ -190,7 +265,8 @@ func (wrcf *WazeroRuntimeConfigFactory) GetConfig() wazero.RuntimeConfig {
 // If no mode is set, the WebAssembly module will run in the compiler mode if
 // supported, otherwise it will run in the interpreter mode.
 func (wrcf *WazeroRuntimeConfigFactory) Interpreter() {
-	wrcf.runtimeConfig = wazero.NewRuntimeConfigInterpreter()
+	wrcf.runtimeConfig = wazero.NewRuntimeConfigInterpreter().WithCloseOnContextDone(wrcf.closeOnContextDone)
+	wrcf.interpreter = true
 }
 
 // Compiler sets the WebAssembly module to run in the compiler mode.
@@ -200,7 +276,8 @@ func (wrcf *WazeroRuntimeConfigFactory) Interpreter() {
 // If no mode is set, the WebAssembly module will run in the compiler mode if
 // supported, otherwise it will run in the interpreter mode.
 func (wrcf *WazeroRuntimeConfigFactory) Compiler() {
-	wrcf.runtimeConfig = wazero.NewRuntimeConfigCompiler()
+	wrcf.runtimeConfig = wazero.NewRuntimeConfigCompiler().WithCloseOnContextDone(wrcf.closeOnContextDone)
+	wrcf.interpreter = false
 }
 
 // SetCloseOnContextDone sets the closeOnContextDone for the WebAssembly module.
@@ -210,6 +287,7 @@ func (wrcf *WazeroRuntimeConfigFactory) Compiler() {
 // By default it is set to true.
 func (wrcf *WazeroRuntimeConfigFactory) SetCloseOnContextDone(close bool) {
 	wrcf.runtimeConfig = wrcf.runtimeConfig.WithCloseOnContextDone(close)
+	wrcf.closeOnContextDone = close
 }
 
 // SetCompilationCache sets the CompilationCache for the WebAssembly module.
@@ -220,6 +298,24 @@ func (wrcf *WazeroRuntimeConfigFactory) SetCompilationCache(cache wazero.Compila
 	wrcf.compilationCache = cache
 }
 
+// SetIsolated sets whether each WebAssembly module instance should be
+// fully isolated from all others.
+//
+// Every Core already runs in a dedicated wazero.Runtime with its own store.
+// However, by default all runtimes share one engine, and thus the compiled
+// machine code, through the CompilationCache. When isolated, no
+// CompilationCache is used and the WATM is compiled from scratch by a
+// private engine for each connection, so a catastrophic runtime failure
+// (e.g., corrupted compiled code) on one connection cannot affect any
+// other. This comes at the cost of memory and a slower instantiation, and
+// is useful for high-assurance deployments or when bisecting runtime bugs.
+//
+// When isolated, the CompilationCache set with SetCompilationCache or
+// SetGlobalCompilationCache is ignored.
+func (wrcf *WazeroRuntimeConfigFactory) SetIsolated(isolated bool) {
+	wrcf.isolated = isolated
+}
+
 var globalCompilationCache wazero.CompilationCache
 var globalCompilationCacheMutex = new(sync.Mutex)
 
@@ -229,7 +325,7 @@ func getGlobalCompilationCache() wazero.CompilationCache {
 
 	if globalCompilationCache == nil {
 		var err error
-		globalCompilationCache, err = wazero.NewCompilationCacheWithDir(fmt.Sprintf("%s%c%s", os.TempDir(), os.PathSeparator, "waterwazerocache"))
+		globalCompilationCache, err = wazero.NewCompilationCacheWithDir(defaultCompilationCacheDir())
 		if err != nil {
 			panic(err)
 		}
@@ -237,6 +333,12 @@ func getGlobalCompilationCache() wazero.CompilationCache {
 	return globalCompilationCache
 }
 
+// defaultCompilationCacheDir returns the directory of the global
+// CompilationCache unless set with SetGlobalCompilationCache.
+func defaultCompilationCacheDir() string {
+	return fmt.Sprintf("%s%c%s", os.TempDir(), os.PathSeparator, "waterwazerocache")
+}
+
 // SetGlobalCompilationCache sets the global CompilationCache for the WebAssembly
 // runtime. This is useful for sharing the cache between multiple WebAssembly
 // modules and should be called before any WebAssembly module is instantiated.
@@ -0,0 +1,223 @@
+package water
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/refraction-networking/water/internal/log"
+	"github.com/refraction-networking/water/internal/websocket"
+)
+
+// webSocketHandshakeTimeout bounds the opening handshake of each WebSocket
+// connection, including the TLS handshake beneath it for "wss".
+const webSocketHandshakeTimeout = 10 * time.Second
+
+// WebSocketOptions controls the opening handshake of the WebSocket
+// connections carrying the traffic of the WATM when the
+// UnderlyingProtocol is "ws" or "wss".
+type WebSocketOptions struct {
+	// Host is the Host header of the requests dialed. It defaults to the
+	// ServerName of the UnderlyingTLS for "wss", if set, and to the
+	// address dialed otherwise. Fronting a CDN usually requires setting
+	// it to the domain served by the CDN.
+	Host string
+
+	// Path is the path of the requests dialed, e.g., "/ws", which may
+	// carry a query. It defaults to "/". If set, a Listener rejects the
+	// requests for other paths.
+	Path string
+
+	// Header optionally sets extra header fields of the requests dialed,
+	// e.g., User-Agent or Origin.
+	Header http.Header
+}
+
+// Clone returns a deep copy of the WebSocketOptions.
+func (o *WebSocketOptions) Clone() *WebSocketOptions {
+	if o == nil {
+		return nil
+	}
+
+	options := *o
+	options.Header = o.Header.Clone()
+	return &options
+}
+
+func init() {
+	// "ws" carries the WATM over WebSocket over TCP, and "wss" over
+	// WebSocket over TLS, so that it can be relayed by a CDN or any
+	// HTTP reverse proxy supporting WebSocket.
+	for name, secure := range map[string]bool{"ws": false, "wss": true} {
+		err := registerUnderlyingProtocol(name, UnderlyingProtocol{
+			Dial:   dialWebSocket(secure),
+			Listen: listenWebSocket(secure),
+			TLS:    secure,
+		})
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
+func dialWebSocket(secure bool) func(ctx context.Context, c *Config, network, address string) (net.Conn, error) {
+	return func(ctx context.Context, c *Config, _, address string) (net.Conn, error) {
+		options := c.WebSocketOptions
+		if options == nil {
+			options = &WebSocketOptions{}
+		}
+
+		var tlsConfig *tls.Config
+		host := options.Host
+		if secure {
+			if c.UnderlyingTLS == nil {
+				return nil, errors.New("water: UnderlyingProtocol \"wss\" requires UnderlyingTLS")
+			}
+			tlsConfig = c.UnderlyingTLS.Clone()
+			if tlsConfig.ServerName == "" {
+				serverName, _, err := net.SplitHostPort(address)
+				if err != nil {
+					serverName = address
+				}
+				tlsConfig.ServerName = serverName
+			} else if host == "" {
+				host = tlsConfig.ServerName
+			}
+			if len(tlsConfig.NextProtos) == 0 {
+				tlsConfig.NextProtos = []string{"http/1.1"} // WebSocket does not run over HTTP/2
+			}
+		}
+		if host == "" {
+			host = address
+		}
+
+		conn, err := (&net.Dialer{Control: c.TCPOptions.Control}).DialContext(ctx, "tcp", address)
+		if err != nil {
+			return nil, err
+		}
+		conn.SetDeadline(time.Now().Add(webSocketHandshakeTimeout)) // skipcq: GSC-G104
+
+		if secure {
+			tlsConn := tls.Client(conn, tlsConfig)
+			if err := tlsConn.HandshakeContext(ctx); err != nil {
+				conn.Close()
+				return nil, fmt.Errorf("water: TLS handshake with %s: %w", address, err)
+			}
+			conn = tlsConn
+		}
+
+		wsConn, err := websocket.Client(conn, host, options.Path, options.Header)
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("water: WebSocket handshake with %s: %w", address, err)
+		}
+		conn.SetDeadline(time.Time{}) // skipcq: GSC-G104
+		return wsConn, nil
+	}
+}
+
+func listenWebSocket(secure bool) func(ctx context.Context, c *Config, network, address string) (net.Listener, error) {
+	return func(ctx context.Context, c *Config, network, address string) (net.Listener, error) {
+		if secure && c.UnderlyingTLS == nil {
+			return nil, errors.New("water: UnderlyingProtocol \"wss\" requires UnderlyingTLS")
+		}
+
+		lis, err := c.listenTCP(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+		if secure {
+			lis = tls.NewListener(lis, c.UnderlyingTLS)
+		}
+
+		var path string
+		if c.WebSocketOptions != nil {
+			path = c.WebSocketOptions.Path
+			if u, err := url.ParseRequestURI(path); err == nil {
+				path = u.Path // the query, if any, is not matched
+			}
+		}
+
+		wl := &webSocketListener{
+			Listener: lis,
+			path:     path,
+			logger:   c.Logger(),
+			conns:    make(chan net.Conn),
+			closed:   make(chan struct{}),
+		}
+		go wl.run()
+		return wl, nil
+	}
+}
+
+// webSocketListener is a net.Listener accepting the connections completing
+// the opening handshake of a WebSocket server, in the background so that
+// a slow client does not hold back the others.
+type webSocketListener struct {
+	net.Listener
+
+	path   string
+	logger *log.Logger
+
+	conns chan net.Conn
+
+	closed    chan struct{}
+	closeOnce sync.Once
+	err       error // set before closed is closed
+}
+
+func (l *webSocketListener) run() {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			l.closeOnce.Do(func() {
+				l.err = err
+				close(l.closed)
+			})
+			return
+		}
+		go l.handshake(conn)
+	}
+}
+
+func (l *webSocketListener) handshake(conn net.Conn) {
+	conn.SetDeadline(time.Now().Add(webSocketHandshakeTimeout)) // skipcq: GSC-G104
+	wsConn, err := websocket.Server(conn, l.path)
+	if err != nil {
+		log.LDebugf(l.logger, "water: WebSocket handshake with %s: %v", conn.RemoteAddr(), err)
+		conn.Close()
+		return
+	}
+	conn.SetDeadline(time.Time{}) // skipcq: GSC-G104
+
+	select {
+	case l.conns <- wsConn:
+	case <-l.closed:
+		wsConn.Close()
+	}
+}
+
+// Accept implements net.Listener.
+func (l *webSocketListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closed:
+		return nil, l.err
+	}
+}
+
+// Close implements net.Listener.
+func (l *webSocketListener) Close() error {
+	l.closeOnce.Do(func() {
+		l.err = net.ErrClosed
+		close(l.closed)
+	})
+	return l.Listener.Close()
+}
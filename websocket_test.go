@@ -0,0 +1,123 @@
+package water_test
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/refraction-networking/water"
+)
+
+func TestConfig_UnderlyingProtocol_WebSocket(t *testing.T) {
+	serverTLS, clientTLS := testTLSConfigs(t)
+
+	for _, tc := range []struct {
+		protocol             string
+		serverTLS, clientTLS *tls.Config
+	}{
+		{"ws", nil, nil},
+		{"wss", serverTLS, clientTLS},
+	} {
+		t.Run(tc.protocol, func(t *testing.T) {
+			lis, err := (&water.Config{
+				TransportModuleBin:  wasmPlain,
+				ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+				UnderlyingProtocol:  tc.protocol,
+				UnderlyingTLS:       tc.serverTLS,
+				WebSocketOptions:    &water.WebSocketOptions{Path: "/ws"},
+			}).ListenContext(context.Background(), "tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer lis.Close() // skipcq: GO-S2307
+
+			dialer, err := water.NewDialerWithContext(context.Background(), &water.Config{
+				TransportModuleBin:  wasmPlain,
+				ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+				UnderlyingProtocol:  tc.protocol,
+				UnderlyingTLS:       tc.clientTLS,
+				WebSocketOptions: &water.WebSocketOptions{
+					Host:   "example.com",
+					Path:   "/ws?session=1",
+					Header: http.Header{"User-Agent": {"water test"}},
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			accepted := make(chan net.Conn, 1)
+			go func() {
+				conn, err := lis.Accept()
+				if err != nil {
+					t.Error(err)
+				}
+				accepted <- conn
+			}()
+
+			conn, err := dialer.DialContext(context.Background(), "tcp", lis.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close() // skipcq: GO-S2307
+
+			peer := <-accepted
+			if peer == nil {
+				t.FailNow()
+			}
+			defer peer.Close() // skipcq: GO-S2307
+
+			for _, rw := range []struct {
+				name string
+				w    io.Writer
+				r    io.Reader
+			}{
+				{"dialer to listener", conn, peer},
+				{"listener to dialer", peer, conn},
+			} {
+				msg := []byte("hello over water over " + tc.protocol + ", " + rw.name)
+				if _, err = rw.w.Write(msg); err != nil {
+					t.Fatal(err)
+				}
+				buf := make([]byte, len(msg))
+				if _, err = io.ReadFull(rw.r, buf); err != nil {
+					t.Fatal(err)
+				}
+				if string(buf) != string(msg) {
+					t.Errorf("%s: read %q, want %q", rw.name, buf, msg)
+				}
+			}
+		})
+	}
+
+	t.Run("wrong path", func(t *testing.T) {
+		lis, err := (&water.Config{
+			TransportModuleBin:  wasmPlain,
+			ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+			UnderlyingProtocol:  "ws",
+			WebSocketOptions:    &water.WebSocketOptions{Path: "/ws"},
+		}).ListenContext(context.Background(), "tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer lis.Close() // skipcq: GO-S2307
+
+		dialer, err := water.NewDialerWithContext(context.Background(), &water.Config{
+			TransportModuleBin:  wasmPlain,
+			ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+			UnderlyingProtocol:  "ws",
+			WebSocketOptions:    &water.WebSocketOptions{Path: "/other"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if conn, err := dialer.DialContext(context.Background(), "tcp", lis.Addr().String()); err == nil {
+			conn.Close()
+			t.Fatal("dialing a path the Listener does not serve must fail")
+		}
+	})
+}
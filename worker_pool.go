@@ -0,0 +1,120 @@
+package water
+
+import (
+	"context"
+	"runtime/pprof"
+	"time"
+)
+
+// workerPoolIdleTimeout is how long a goroutine of a WorkerPool waits for
+// the next worker thread to run before exiting.
+const workerPoolIdleTimeout = 30 * time.Second
+
+// WorkerPool runs the worker threads of WebAssembly Transport Modules
+// (e.g., `watm_start_v1`) on a pool of goroutines, bounding the number of
+// worker threads running concurrently, i.e., the number of connections
+// served at once, and reusing the goroutines across connections.
+//
+// Each connection otherwise runs its worker thread on a goroutine of its
+// own, for its whole lifetime, besides the goroutines of the Go runtime
+// polling its sockets. With a WorkerPool, once the pool is full, a new
+// connection waits for another one to be closed before its worker thread
+// starts, which bounds the memory and goroutines of a Listener or a Relay
+// serving tens of thousands of connections. A worker thread blocks in the
+// WATM while waiting for I/O, so it cannot be multiplexed with others on
+// the same goroutine.
+//
+// Setting the same WorkerPool in the Config of several Listeners or Relays
+// bounds their connections together.
+//
+// A nil *WorkerPool runs each worker thread on a new goroutine.
+type WorkerPool struct {
+	slots chan struct{} // nil if unbounded
+	idle  chan func()   // hands a worker thread over to an idle goroutine
+}
+
+// NewWorkerPool creates a WorkerPool running up to size worker threads
+// concurrently. If size is not positive, the number of worker threads is
+// not bounded, while the goroutines are still reused.
+func NewWorkerPool(size int) *WorkerPool {
+	p := &WorkerPool{
+		idle: make(chan func()),
+	}
+	if size > 0 {
+		p.slots = make(chan struct{}, size)
+	}
+	return p
+}
+
+// Size returns the maximum number of worker threads running concurrently,
+// or 0 if p is nil or unbounded.
+func (p *WorkerPool) Size() int {
+	if p == nil {
+		return 0
+	}
+	return cap(p.slots)
+}
+
+// Running returns the number of worker threads currently running, or 0
+// if p is nil or unbounded.
+func (p *WorkerPool) Running() int {
+	if p == nil {
+		return 0
+	}
+	return len(p.slots)
+}
+
+// goFunc runs f on a goroutine of the pool once the number of functions
+// running allows it, or returns ctx.Err() if ctx is done before.
+func (p *WorkerPool) goFunc(ctx context.Context, f func()) error {
+	if p == nil {
+		go f()
+		return nil
+	}
+
+	if p.slots != nil {
+		select {
+		case p.slots <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		task := f
+		f = func() {
+			defer func() { <-p.slots }()
+			task()
+		}
+	}
+
+	select {
+	case p.idle <- f:
+	default:
+		go p.run(f)
+	}
+	return nil
+}
+
+// run runs f, then the functions handed over to it until it stays idle
+// for workerPoolIdleTimeout.
+func (p *WorkerPool) run(f func()) {
+	timer := time.NewTimer(workerPoolIdleTimeout)
+	defer timer.Stop()
+
+	for {
+		f()
+		pprof.SetGoroutineLabels(context.Background()) // unset the profiler labels of the worker thread, if any
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(workerPoolIdleTimeout)
+
+		select {
+		case f = <-p.idle:
+		case <-timer.C:
+			return
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package water_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/refraction-networking/water"
+	"github.com/refraction-networking/water/internal/driver"
+	_ "github.com/refraction-networking/water/transport/v1"
+)
+
+func TestWorkerPool(t *testing.T) {
+	pool := water.NewWorkerPool(1)
+	if pool.Size() != 1 {
+		t.Fatalf("Size() = %d, want 1", pool.Size())
+	}
+
+	release, ran := make(chan struct{}), make(chan struct{})
+	if err := driver.GoWorker(context.Background(), pool, func() { <-release }); err != nil {
+		t.Fatal(err)
+	}
+	if pool.Running() != 1 {
+		t.Fatalf("Running() = %d, want 1", pool.Running())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := driver.GoWorker(ctx, pool, func() { close(ran) }); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("GoWorker() = %v on a full pool, want %v", err, context.DeadlineExceeded)
+	}
+
+	close(release)
+	if err := driver.GoWorker(context.Background(), pool, func() { close(ran) }); err != nil {
+		t.Fatal(err)
+	}
+	<-ran
+
+	// a nil pool must not bound anything
+	var nilPool *water.WorkerPool
+	done := make(chan struct{})
+	if err := driver.GoWorker(ctx, nilPool, func() { close(done) }); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+}
+
+func TestWorkerPool_Dialer(t *testing.T) {
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close() // skipcq: GO-S2307
+
+	pool := water.NewWorkerPool(1)
+	dialer, err := water.NewDialerWithContext(context.Background(), &water.Config{
+		TransportModuleBin: wasmPlain,
+		WorkerPool:         pool,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := dialer.DialContext(context.Background(), "tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	peerConn, err := lis.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peerConn.Close() // skipcq: GO-S2307
+
+	// the only worker thread allowed is running, so the next connection
+	// cannot start its own
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if conn, err := dialer.DialContext(ctx, "tcp", lis.Addr().String()); err == nil {
+		conn.Close()
+		t.Fatal("DialContext() must fail while the WorkerPool is full")
+	}
+
+	// closing the first connection frees the pool for the next one
+	if err := conn.Close(); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for pool.Running() > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	conn, err = dialer.DialContext(context.Background(), "tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close() // skipcq: GO-S2307
+}
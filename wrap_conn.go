@@ -0,0 +1,69 @@
+package water
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/refraction-networking/water/internal/socket"
+)
+
+// ErrWrapConnRole is returned by WrapConn for a role a single connection
+// cannot be wrapped in.
+var ErrWrapConnRole = errors.New("water: connection can only be wrapped in the dialer or listener role")
+
+// WrapConn runs the WebAssembly Transport Module in the Config over an
+// already established connection, e.g., accepted by a TLS listener or
+// handed over by a reverse proxy, instead of a connection created by
+// WATER. It makes WATER a layer composable with any other transport.
+//
+// In RoleDialer, the WATM acts as the client over existing, as with
+// Dialer.DialWithConn. In RoleListener, the WATM acts as the server over
+// existing, which is subject to the checks done on any connection
+// accepted, e.g., the AcceptFilter, and the NetworkListener of the
+// Config is ignored. ErrWrapConnRole is returned for any other role.
+//
+// The returned Conn takes the ownership of existing, which is closed if
+// an error is returned. The context is passed to NewCoreWithContext and
+// thus bounds the lifetime of the Conn, see NewDialerWithContext.
+func WrapConn(ctx context.Context, c *Config, existing net.Conn, role Role) (conn Conn, err error) {
+	if c == nil {
+		return nil, errors.New("water: wrapping a connection with nil config is not allowed")
+	}
+	if existing == nil {
+		return nil, errors.New("water: wrapping nil connection is not allowed")
+	}
+
+	defer func() {
+		if err != nil {
+			existing.Close()
+		}
+	}()
+
+	switch role {
+	case RoleDialer:
+		dialer, err := NewDialerWithContext(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		return dialer.DialWithConn(ctx, existing)
+	case RoleListener:
+		config, err := c.snapshot()
+		if err != nil {
+			return nil, err
+		}
+		config.NetworkListener = socket.NewSingleConnListener(existing, nil)
+
+		listener, err := NewListenerWithContext(ctx, config)
+		if err != nil {
+			return nil, err
+		}
+		// closing the listener does not close the connections accepted
+		defer listener.Close()
+
+		return listener.AcceptWATER()
+	default:
+		return nil, fmt.Errorf("%w, not %s", ErrWrapConnRole, role)
+	}
+}
@@ -0,0 +1,88 @@
+package water_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/refraction-networking/water"
+	_ "github.com/refraction-networking/water/transport/v1"
+)
+
+func TestWrapConn(t *testing.T) {
+	config := &water.Config{
+		TransportModuleBin:  wasmReverse,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+	}
+
+	tcpLis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcpLis.Close() // skipcq: GO-S2307
+
+	clientConn, err := net.Dial("tcp", tcpLis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverConn, err := tcpLis.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type wrapResult struct {
+		conn water.Conn
+		err  error
+	}
+	accepted := make(chan wrapResult, 1)
+	go func() {
+		conn, err := water.WrapConn(context.Background(), config, serverConn, water.RoleListener)
+		accepted <- wrapResult{conn, err}
+	}()
+
+	dialed, err := water.WrapConn(context.Background(), config, clientConn, water.RoleDialer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialed.Close() // skipcq: GO-S2307
+
+	res := <-accepted
+	if res.err != nil {
+		t.Fatal(res.err)
+	}
+	defer res.conn.Close() // skipcq: GO-S2307
+
+	msg := []byte("hello over an existing connection")
+	if _, err = dialed.Write(msg); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, len(msg))
+	if _, err = io.ReadFull(res.conn, buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, msg) {
+		t.Errorf("read %q, want %q", buf, msg)
+	}
+}
+
+func TestWrapConn_UnsupportedRole(t *testing.T) {
+	config := &water.Config{
+		TransportModuleBin:  wasmReverse,
+		ModuleConfigFactory: water.NewWazeroModuleConfigFactory(),
+	}
+
+	existing, peer := net.Pipe()
+	defer peer.Close() // skipcq: GO-S2307
+
+	if _, err := water.WrapConn(context.Background(), config, existing, water.RoleRelay); !errors.Is(err, water.ErrWrapConnRole) {
+		t.Fatalf("WrapConn() error = %v, want %v", err, water.ErrWrapConnRole)
+	}
+
+	// the existing connection is closed upon failure
+	if _, err := existing.Write([]byte("x")); !errors.Is(err, io.ErrClosedPipe) {
+		t.Errorf("Write() on the wrapped connection error = %v, want %v", err, io.ErrClosedPipe)
+	}
+}